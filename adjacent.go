@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// adjacentMerger coalesces contiguous regions with the same pathname and
+// permissions, into which the kernel splits a mapping, e.g. by mprotect
+// or madvise of a part of it, into one region of the logical mapping.
+type adjacentMerger struct {
+	// pending is the region being extended by the following ones.
+	pending *mapping
+}
+
+// add returns the region completed by m, which is nil if m is merged
+// into the pending region or there is no pending region.
+func (am *adjacentMerger) add(m *mapping) *mapping {
+	if am.pending != nil && adjacentRegions(am.pending, m) {
+		mergeRegion(am.pending, m)
+		return nil
+	}
+	prev := am.pending
+	am.pending = m
+	return prev
+}
+
+// flush returns the pending region at the end of the input, or nil if
+// there is none.
+func (am *adjacentMerger) flush() *mapping {
+	m := am.pending
+	am.pending = nil
+	return m
+}
+
+// adjacentRegions reports whether b starts at the end of a with the same
+// pathname, permissions and fields, in the same process.
+func adjacentRegions(a, b *mapping) bool {
+	if a.Process != b.Process || a.KernelThread || b.KernelThread ||
+		!bytes.Equal(a.Region.Pathname, b.Region.Pathname) || !bytes.Equal(a.Region.Perms, b.Region.Perms) ||
+		len(a.FieldNames) != len(b.FieldNames) {
+		return false
+	}
+	for i, name := range a.FieldNames {
+		if b.FieldNames[i] != name || b.FieldUnits[i] != a.FieldUnits[i] {
+			return false
+		}
+	}
+	end, err := strconv.ParseUint(string(a.Region.AddressEnd), 16, 64)
+	if err != nil {
+		return false
+	}
+	start, err := strconv.ParseUint(string(b.Region.AddressStart), 16, 64)
+	return err == nil && start == end
+}
+
+// mergeRegion extends a to the end of b, summing the kB fields other than
+// the page sizes and the counts of pages. The other fields, e.g. VmFlags,
+// and the offset are those of a.
+func mergeRegion(a, b *mapping) {
+	a.Region.AddressEnd = b.Region.AddressEnd
+	for i, name := range a.FieldNames {
+		if a.FieldUnits[i] != unitsKB || isPageSizeField(name) {
+			continue
+		}
+		x, okA := parseFieldNumber(a.FieldValues[i])
+		y, okB := parseFieldNumber(b.FieldValues[i])
+		if !okA || !okB {
+			// A missing value of a truncated capture makes the sum
+			// unknown.
+			a.FieldValues[i] = ""
+			continue
+		}
+		a.FieldValues[i] = strconv.FormatFloat(x+y, 'f', -1, 64)
+	}
+	a.Region.NumaPages = sumPages(a.Region.NumaPages, b.Region.NumaPages)
+	a.Region.SwapPages = sumPages(a.Region.SwapPages, b.Region.SwapPages)
+	if a.Region.PageCounts != nil && b.Region.PageCounts != nil {
+		a.Region.PageCounts = &pageCounts{
+			present:   a.Region.PageCounts.present + b.Region.PageCounts.present,
+			swapped:   a.Region.PageCounts.swapped + b.Region.PageCounts.swapped,
+			exclusive: a.Region.PageCounts.exclusive + b.Region.PageCounts.exclusive,
+		}
+	} else {
+		a.Region.PageCounts = nil
+	}
+	a.Truncated = a.Truncated || b.Truncated
+}
+
+// sumPages returns the sums of the pages of each key of a and b, which is
+// nil if either is nil, i.e. unknown.
+func sumPages(a, b map[int]int64) map[int]int64 {
+	if a == nil || b == nil {
+		return nil
+	}
+	sums := make(map[int]int64, len(a))
+	for k, v := range a {
+		sums[k] = v
+	}
+	for k, v := range b {
+		sums[k] += v
+	}
+	return sums
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvertMergeAdjacent(t *testing.T) {
+	input := "00400000-00401000 r--p 00000000 08:02 1 /a\nSize: 4 kB\nRss: 4 kB\nKernelPageSize: 4 kB\nVmFlags: rd\n" +
+		"00401000-00403000 r--p 00001000 08:02 1 /a\nSize: 8 kB\nRss: 4 kB\nKernelPageSize: 4 kB\nVmFlags: rd mr\n" +
+		"00403000-00404000 r-xp 00003000 08:02 1 /a\nSize: 4 kB\nRss: 0 kB\nKernelPageSize: 4 kB\nVmFlags: rd ex\n" +
+		"00405000-00406000 r-xp 00000000 00:00 0 \nSize: 4 kB\nRss: 4 kB\nKernelPageSize: 4 kB\nVmFlags: rd ex\n" +
+		"00406000-00407000 r-xp 00000000 00:00 0 \nSize: 4 kB\nRss: 4 kB\nKernelPageSize: 4 kB\nVmFlags: rd ex\n"
+	want := "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Size,Rss,KernelPageSize,VmFlags\n" +
+		"00400000,00403000,r--p,00000000,08:02,1,/a,12,8,4,rd\n" +
+		"00403000,00404000,r-xp,00003000,08:02,1,/a,4,0,4,rd ex\n" +
+		"00405000,00407000,r-xp,00000000,00:00,0,,8,8,4,rd ex\n"
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input), args{Separator: ",", mergeAdjacent: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestAdjacentMerger(t *testing.T) {
+	newMapping := func(start, end, perms, rss string) *mapping {
+		m := &mapping{Region: &region{AddressStart: []byte(start), AddressEnd: []byte(end), Perms: []byte(perms), Pathname: []byte("/a")}}
+		m.appendField("Rss", rss, unitsKB)
+		return m
+	}
+	am := &adjacentMerger{}
+	var got []string
+	for _, m := range []*mapping{
+		newMapping("1000", "2000", "r--p", "4"),
+		newMapping("2000", "3000", "r--p", ""),
+		newMapping("4000", "5000", "r--p", "4"),
+		newMapping("5000", "6000", "rw-p", "4"),
+	} {
+		if done := am.add(m); done != nil {
+			got = append(got, strings.Join(done.toCSVRecord(), " "))
+		}
+	}
+	if done := am.flush(); done != nil {
+		got = append(got, strings.Join(done.toCSVRecord(), " "))
+	}
+	want := []string{
+		"1000 3000 r--p    /a ",
+		"4000 5000 r--p    /a 4",
+		"5000 6000 rw-p    /a 4",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch,\n got=%q,\nwant=%q", got, want)
+	}
+}
+
+func TestSumPages(t *testing.T) {
+	if got, want := sumPages(map[int]int64{0: 1, 1: 2}, map[int]int64{1: 3, 2: 4}), map[int]int64{0: 1, 1: 5, 2: 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sums mismatch, got=%v, want=%v", got, want)
+	}
+	if got := sumPages(map[int]int64{0: 1}, nil); got != nil {
+		t.Errorf("sums with an unknown region = %v, want nil", got)
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of the rules of -alert-rules.
+const (
+	// alertKindThreshold fires while its condition holds for the sums and
+	// maxima of the fields of a sample, as with -fail-if.
+	alertKindThreshold = "threshold"
+	// alertKindRate fires while its condition holds for the changes of
+	// the variables per second since the previous sample.
+	alertKindRate = "rate"
+	// alertKindAbsence fires while its metric is missing from a sample,
+	// i.e. no region has the field, or there are no regions for regions,
+	// e.g. when the process selected by -filter-path has exited.
+	alertKindAbsence = "absence"
+)
+
+// Kinds of the sinks of the alerts.
+const (
+	alertSinkLog     = "log"
+	alertSinkExec    = "exec"
+	alertSinkWebhook = "webhook"
+)
+
+// States of the alerts sent to the sinks.
+const (
+	alertStateFiring   = "firing"
+	alertStateResolved = "resolved"
+)
+
+// alertRulesFile is the JSON file of -alert-rules.
+type alertRulesFile struct {
+	Rules []alertRuleSpec `json:"rules"`
+}
+
+// alertRuleSpec is a rule in the file of -alert-rules.
+type alertRuleSpec struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Condition is the condition of threshold and rate rules.
+	Condition string `json:"condition,omitempty"`
+	// Metric is the variable of absence rules.
+	Metric string `json:"metric,omitempty"`
+	// For is the number of consecutive samples the rule must hold in
+	// before it fires, 1 if zero.
+	For int `json:"for,omitempty"`
+	// Sinks are the destinations of the alerts, "log", "exec:<command>"
+	// or "webhook:<url>", ["log"] if empty.
+	Sinks []string `json:"sinks,omitempty"`
+}
+
+// alertSink is a destination of alerts.
+type alertSink struct {
+	kind string
+	// target is the command of exec run by sh -c, or the URL of webhook.
+	target string
+}
+
+func parseAlertSink(s string) (alertSink, error) {
+	if s == alertSinkLog {
+		return alertSink{kind: alertSinkLog}, nil
+	}
+	kind, target, _ := strings.Cut(s, ":")
+	switch {
+	case kind == alertSinkExec && target != "":
+	case kind == alertSinkWebhook && (strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")):
+	default:
+		return alertSink{}, fmt.Errorf("alert sink must be log, exec:<command> or webhook:<http or https URL>: %q", s)
+	}
+	return alertSink{kind: kind, target: target}, nil
+}
+
+// alertRule is a parsed rule of -alert-rules with its state.
+type alertRule struct {
+	name       string
+	kind       string
+	condition  *failCondition
+	metric     string
+	forSamples int
+	sinks      []alertSink
+	// holding is the number of consecutive samples the rule has held in.
+	holding int
+	firing  bool
+}
+
+// readAlertRules reads the rules of the JSON file of -alert-rules, e.g.
+//
+//	{"rules": [
+//	  {"name": "pss", "kind": "threshold", "condition": "total_pss > 8GiB", "for": 3},
+//	  {"name": "leak", "kind": "rate", "condition": "total_pss > 1MiB", "sinks": ["exec:logger -t leak"]},
+//	  {"name": "gone", "kind": "absence", "metric": "regions", "sinks": ["webhook:http://localhost:9000/"]}
+//	]}
+//
+// A threshold rule fires while its condition over the variables of
+// -fail-if holds, a rate rule while it holds for their changes per second
+// since the previous sample, and an absence rule while the variable of
+// metric is missing, e.g. regions when the regions of -filter-path are
+// gone. A rule fires after holding in for consecutive samples, and an
+// alert is sent to its sinks then and when it is resolved: "log",
+// "exec:<command>" run by sh -c with ALERT_RULE, ALERT_STATE,
+// ALERT_MESSAGE and ALERT_TIME in the environment, or "webhook:<url>"
+// receiving them in a JSON POST.
+func readAlertRules(filename string) ([]*alertRule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	// Unknown keys are rejected as they are likely misspelled options.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var f alertRulesFile
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse alert rules file %s: %w", filename, err)
+	}
+	if len(f.Rules) == 0 {
+		return nil, fmt.Errorf("alert rules file %s has no rules", filename)
+	}
+	var rules []*alertRule
+	seen := make(map[string]bool)
+	for i, spec := range f.Rules {
+		r, err := newAlertRule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", filename, i+1, err)
+		}
+		if seen[r.name] {
+			return nil, fmt.Errorf("%s: rule %d: duplicate name %q", filename, i+1, r.name)
+		}
+		seen[r.name] = true
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func newAlertRule(spec alertRuleSpec) (*alertRule, error) {
+	if spec.Name == "" {
+		return nil, errors.New("no name")
+	}
+	r := &alertRule{name: spec.Name, kind: spec.Kind, forSamples: spec.For}
+	switch spec.Kind {
+	case alertKindThreshold, alertKindRate:
+		if spec.Metric != "" {
+			return nil, fmt.Errorf("metric is only for %s rules", alertKindAbsence)
+		}
+		c, err := parseAggregateCondition("condition", spec.Condition)
+		if err != nil {
+			return nil, err
+		}
+		r.condition = c
+	case alertKindAbsence:
+		if spec.Condition != "" {
+			return nil, fmt.Errorf("condition is not for %s rules", alertKindAbsence)
+		}
+		if !isFailIfVariable(spec.Metric) {
+			return nil, fmt.Errorf("metric must be regions, total_<field> or max_<field>: %q", spec.Metric)
+		}
+		r.metric = spec.Metric
+	default:
+		return nil, fmt.Errorf("kind must be %s, %s or %s: %q", alertKindThreshold, alertKindRate, alertKindAbsence, spec.Kind)
+	}
+	if spec.For < 0 {
+		return nil, errors.New("for must not be negative")
+	}
+	if r.forSamples == 0 {
+		r.forSamples = 1
+	}
+	if len(spec.Sinks) == 0 {
+		spec.Sinks = []string{alertSinkLog}
+	}
+	for _, s := range spec.Sinks {
+		sink, err := parseAlertSink(s)
+		if err != nil {
+			return nil, err
+		}
+		r.sinks = append(r.sinks, sink)
+	}
+	return r, nil
+}
+
+// sendsOutside reports whether the rule has sinks running commands or
+// connecting to servers, which the sandbox denies.
+func (r *alertRule) sendsOutside() bool {
+	for _, s := range r.sinks {
+		if s.kind != alertSinkLog {
+			return true
+		}
+	}
+	return false
+}
+
+// alertEvent is an alert sent to the sinks, which is the body of the
+// requests of webhook in JSON.
+type alertEvent struct {
+	Rule    string    `json:"rule"`
+	State   string    `json:"state"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// alertEngine evaluates the rules of -alert-rules over the regions of each
+// sample of watch mode, each scrape of the exporter and each run of a
+// target of schedule, so that simple memory alerting can run on hosts
+// without a monitoring stack. An alert is sent when a rule starts firing
+// and when it is resolved, not for every sample it holds in.
+type alertEngine struct {
+	rules []*alertRule
+	// sample aggregates the regions of the current sample, and prev those
+	// of the previous one at prevTime for rate rules.
+	sample   *failChecker
+	prev     *failChecker
+	prevTime time.Time
+	client   *http.Client
+	// timeout bounds the commands of exec and the requests of webhook.
+	timeout time.Duration
+}
+
+func newAlertEngine(rules []*alertRule) *alertEngine {
+	return &alertEngine{
+		rules:   rules,
+		sample:  newFailChecker(nil),
+		client:  &http.Client{},
+		timeout: 30 * time.Second,
+	}
+}
+
+// add adds the fields of m to the current sample. It does nothing if e is
+// nil.
+func (e *alertEngine) add(m *mapping) {
+	if e == nil {
+		return
+	}
+	e.sample.add(m)
+}
+
+// evaluate evaluates the rules for the sample captured at t, sends the
+// alerts of the rules which start firing or are resolved, and starts the
+// next sample. It does nothing if e is nil.
+func (e *alertEngine) evaluate(t time.Time) {
+	if e == nil {
+		return
+	}
+	for _, r := range e.rules {
+		holds, message, ok := e.holds(r, t)
+		if !ok {
+			continue
+		}
+		if !holds {
+			r.holding = 0
+			if r.firing {
+				r.firing = false
+				e.send(r, alertEvent{Rule: r.name, State: alertStateResolved, Message: message, Time: t})
+			}
+			continue
+		}
+		r.holding++
+		if !r.firing && r.holding >= r.forSamples {
+			r.firing = true
+			e.send(r, alertEvent{Rule: r.name, State: alertStateFiring, Message: message, Time: t})
+		}
+	}
+	e.prev, e.prevTime = e.sample, t
+	e.sample = newFailChecker(nil)
+}
+
+// holds reports whether r holds in the current sample with the message of
+// the alert. ok is false if r cannot be evaluated, i.e. a rate rule for
+// the first sample.
+func (e *alertEngine) holds(r *alertRule, t time.Time) (holds bool, message string, ok bool) {
+	switch r.kind {
+	case alertKindAbsence:
+		v, present := e.sample.lookup(r.metric)
+		if !present || strings.EqualFold(r.metric, failIfRegions) && v == 0 {
+			return true, r.metric + " is absent", true
+		}
+		return false, r.metric + " is present", true
+	case alertKindRate:
+		seconds := t.Sub(e.prevTime).Seconds()
+		if e.prev == nil || seconds <= 0 {
+			return false, "", false
+		}
+		holds, x, y, present := r.condition.holds(func(name string) (float64, bool) {
+			cur, ok := e.sample.lookup(name)
+			prev, prevOK := e.prev.lookup(name)
+			return (cur - prev) / seconds, ok && prevOK
+		})
+		return holds, conditionMessage(r.condition, holds, x, y, present) + " per second", true
+	default:
+		holds, x, y, present := r.condition.holds(e.sample.lookup)
+		return holds, conditionMessage(r.condition, holds, x, y, present), true
+	}
+}
+
+func conditionMessage(c *failCondition, holds bool, x, y float64, present bool) string {
+	if !present {
+		return c.src + " refers to a field missing from the regions"
+	}
+	state := "holds"
+	if !holds {
+		state = "does not hold"
+	}
+	return fmt.Sprintf("%s %s: %s %s %s", c.src, state,
+		strconv.FormatFloat(x, 'f', -1, 64), c.op, strconv.FormatFloat(y, 'f', -1, 64))
+}
+
+// send sends the alert to the sinks of r. Failures are logged, so that
+// an unreachable sink does not stop watching.
+func (e *alertEngine) send(r *alertRule, ev alertEvent) {
+	for _, s := range r.sinks {
+		if err := e.sendTo(s, ev); err != nil {
+			log.Printf("warning: send alert %s to %s: %v", r.name, s.kind, err)
+		}
+	}
+}
+
+func (e *alertEngine) sendTo(s alertSink, ev alertEvent) error {
+	switch s.kind {
+	case alertSinkExec:
+		ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", s.target)
+		cmd.Env = append(os.Environ(),
+			"ALERT_RULE="+ev.Rule,
+			"ALERT_STATE="+ev.State,
+			"ALERT_MESSAGE="+ev.Message,
+			"ALERT_TIME="+ev.Time.Format(time.RFC3339),
+		)
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+		return cmd.Run()
+	case alertSinkWebhook:
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.target, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := e.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("webhook responded with %s", resp.Status)
+		}
+		return nil
+	default:
+		log.Printf("alert %s %s: %s", ev.Rule, ev.State, ev.Message)
+		return nil
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadAlertRules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		t.Helper()
+		filename := filepath.Join(dir, "rules.json")
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	rules, err := readAlertRules(write(`{"rules": [
+		{"name": "pss", "kind": "threshold", "condition": "total_pss > 8GiB", "for": 3},
+		{"name": "leak", "kind": "rate", "condition": "total_pss > 1MiB", "sinks": ["exec:true", "log"]},
+		{"name": "gone", "kind": "absence", "metric": "regions", "sinks": ["webhook:http://localhost:9000/"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 || rules[0].forSamples != 3 || rules[1].forSamples != 1 || len(rules[0].sinks) != 1 || rules[0].sinks[0].kind != alertSinkLog {
+		t.Errorf("rules mismatch, got=%+v", rules)
+	}
+	if rules[0].sendsOutside() || !rules[1].sendsOutside() || !rules[2].sendsOutside() {
+		t.Errorf("sendsOutside mismatch")
+	}
+
+	for _, content := range []string{
+		`{"rules": []}`,
+		`{"rules": [{"name": "a", "kind": "threshold", "condition": "total_pss > 1", "unknown": 1}]}`,
+		`{"rules": [{"kind": "threshold", "condition": "total_pss > 1"}]}`,
+		`{"rules": [{"name": "a", "kind": "other", "condition": "total_pss > 1"}]}`,
+		`{"rules": [{"name": "a", "kind": "threshold", "condition": "pss > 1"}]}`,
+		`{"rules": [{"name": "a", "kind": "threshold", "condition": "total_pss > 1", "metric": "regions"}]}`,
+		`{"rules": [{"name": "a", "kind": "absence", "metric": "pss"}]}`,
+		`{"rules": [{"name": "a", "kind": "absence", "metric": "regions", "for": -1}]}`,
+		`{"rules": [{"name": "a", "kind": "absence", "metric": "regions", "sinks": ["webhook:localhost"]}]}`,
+		`{"rules": [{"name": "a", "kind": "absence", "metric": "regions", "sinks": ["exec:"]}]}`,
+		`{"rules": [{"name": "a", "kind": "absence", "metric": "regions"}, {"name": "a", "kind": "absence", "metric": "regions"}]}`,
+	} {
+		if _, err := readAlertRules(write(content)); err == nil {
+			t.Errorf("%s: got no error", content)
+		}
+	}
+}
+
+func TestAlertEngine(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	var rules []*alertRule
+	for _, spec := range []alertRuleSpec{
+		{Name: "pss", Kind: alertKindThreshold, Condition: "total_pss > 10", For: 2},
+		{Name: "leak", Kind: alertKindRate, Condition: "total_pss > 1"},
+		{Name: "swap", Kind: alertKindAbsence, Metric: "total_swap"},
+	} {
+		r, err := newAlertRule(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, r)
+	}
+	e := newAlertEngine(rules)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, pss := range []string{"8", "12", "40", "40", "8"} {
+		e.add(&mapping{FieldNames: []string{"Pss"}, FieldValues: []string{pss}, FieldUnits: []string{"kB"}})
+		e.evaluate(start.Add(time.Duration(i) * 2 * time.Second))
+	}
+	// The threshold fires in the second sample it holds in, and the rate
+	// is first evaluated for the second sample.
+	want := "alert swap firing: total_swap is absent\n" +
+		"alert leak firing: total_pss > 1 holds: 2 > 1 per second\n" +
+		"alert pss firing: total_pss > 10 holds: 40 > 10\n" +
+		"alert leak resolved: total_pss > 1 does not hold: 0 > 1 per second\n" +
+		"alert pss resolved: total_pss > 10 does not hold: 8 > 10\n"
+	if got := buf.String(); got != want {
+		t.Errorf("alerts mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+
+	// A nil engine does nothing.
+	var nilEngine *alertEngine
+	nilEngine.add(&mapping{})
+	nilEngine.evaluate(start)
+}
+
+func TestAlertSinks(t *testing.T) {
+	var got alertEvent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer ts.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	e := newAlertEngine(nil)
+	ev := alertEvent{Rule: "pss", State: alertStateFiring, Message: "total_pss > 10 holds: 12 > 10", Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	if err := e.sendTo(alertSink{kind: alertSinkWebhook, target: ts.URL}, ev); err != nil {
+		t.Fatal(err)
+	}
+	if got != ev {
+		t.Errorf("webhook event mismatch, got=%+v, want=%+v", got, ev)
+	}
+	if err := e.sendTo(alertSink{kind: alertSinkWebhook, target: failing.URL}, ev); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("got error %v", err)
+	}
+
+	out := filepath.Join(t.TempDir(), "alert.txt")
+	if err := e.sendTo(alertSink{kind: alertSinkExec, target: `echo "$ALERT_RULE $ALERT_STATE $ALERT_TIME" > ` + out}, ev); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "pss firing 2024-01-02T03:04:05Z\n"; string(data) != want {
+		t.Errorf("exec mismatch, got=%q, want=%q", data, want)
+	}
+	if err := e.sendTo(alertSink{kind: alertSinkExec, target: "exit 1"}, ev); err == nil {
+		t.Error("want an error of a failing command")
+	}
+}
+
+func TestRunAlertRules(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-columns", "Pathname,Rss"}); err != nil {
+		t.Fatal(err)
+	}
+	a.inputFilename = writeTestFile(t, testSmapsSorted)
+	a.outputFilename = filepath.Join(t.TempDir(), "out.csv")
+	r, err := newAlertRule(alertRuleSpec{Name: "rss", Kind: alertKindThreshold, Condition: "total_rss >= 4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.alertRules = []*alertRule{r}
+	if err := a.validate(fs); err != nil {
+		t.Fatal(err)
+	}
+	a.stats = &runStats{}
+	if err := run(a); err != nil {
+		t.Fatal(err)
+	}
+	if want := "alert rss firing: total_rss >= 4 holds: 4 >= 4\n"; buf.String() != want {
+		t.Errorf("alerts mismatch,\n got=%s,\nwant=%s", buf.String(), want)
+	}
+}
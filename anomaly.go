@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// anomaly is a record of the NDJSON anomaly log.
+type anomaly struct {
+	Time   string `json:"time,omitempty"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+	Raw    string `json:"raw,omitempty"`
+}
+
+// anomalyLog reports parse warnings and skipped input to the standard
+// logger and, if enabled, as NDJSON records to a file. The zero value
+// with file set only logs to the standard logger and counts anomalies.
+// The methods can be called on a nil *anomalyLog, which only logs to the
+// standard logger.
+type anomalyLog struct {
+	file      string
+	out       *os.File
+	enc       *json.Encoder
+	timestamp bool
+	// count is the number of reported anomalies.
+	count int
+	// buffered keeps the anomalies in pending instead of reporting them,
+	// until they are replayed in the order of the inputs.
+	buffered bool
+	pending  []anomaly
+}
+
+// openAnomalyLog returns an anomalyLog for warnings about the input file.
+// The records are appended to the file at path, or written to the
+// standard error if path is "-". Records have no time if timestamp is
+// false.
+func openAnomalyLog(path, file string, timestamp bool) (*anomalyLog, error) {
+	l := &anomalyLog{file: file, timestamp: timestamp}
+	if path == "-" {
+		l.enc = json.NewEncoder(os.Stderr)
+		return l, nil
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l.out = out
+	l.enc = json.NewEncoder(out)
+	return l, nil
+}
+
+func (l *anomalyLog) report(line int, reason, raw string) {
+	if l == nil {
+		log.Printf("warning: line %d: %s", line, reason)
+		return
+	}
+	l.count++
+	if l.buffered {
+		l.pending = append(l.pending, anomaly{File: l.file, Line: line, Reason: reason, Raw: raw})
+		return
+	}
+	log.Printf("warning: %s: line %d: %s", l.file, line, reason)
+	if l.enc == nil {
+		return
+	}
+	a := anomaly{File: l.file, Line: line, Reason: reason, Raw: raw}
+	if l.timestamp {
+		a.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	if err := l.enc.Encode(a); err != nil {
+		log.Printf("warning: cannot write anomaly log: %v", err)
+	}
+}
+
+// replay reports the pending anomalies of the buffered l to to.
+func (l *anomalyLog) replay(to *anomalyLog) {
+	for _, a := range l.pending {
+		to.report(a.Line, a.Reason, a.Raw)
+	}
+	l.pending = nil
+}
+
+func (l *anomalyLog) Close() error {
+	if l == nil || l.out == nil {
+		return nil
+	}
+	return l.out.Close()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnomalyLogReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anomalies.ndjson")
+	for i := 0; i < 2; i++ {
+		l, err := openAnomalyLog(path, "smaps.txt", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := &mapping{
+			LineNo:      10,
+			FieldNames:  []string{"Size", "NewCounter"},
+			FieldValues: []string{"8", "1"},
+			FieldUnits:  []string{"kB", "kB"},
+		}
+		newKernelCompatNormalizer().normalize(m, l)
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var got []anomaly
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		var a anomaly
+		if err := json.Unmarshal(s.Bytes(), &a); err != nil {
+			t.Fatalf("invalid record %q: %v", s.Text(), err)
+		}
+		got = append(got, a)
+	}
+	want := anomaly{
+		File:   "smaps.txt",
+		Line:   12,
+		Reason: "dropped field NewCounter unknown to this tool",
+		Raw:    "NewCounter: 1",
+	}
+	if len(got) != 2 {
+		t.Fatalf("record count mismatch, got=%d, want=2", len(got))
+	}
+	for _, a := range got {
+		if a != want {
+			t.Errorf("record mismatch,\n got=%+v,\nwant=%+v", a, want)
+		}
+	}
+}
+
+func TestAnomalyLogNil(t *testing.T) {
+	var l *anomalyLog
+	l.report(1, "reason", "raw")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
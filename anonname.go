@@ -0,0 +1,26 @@
+package main
+
+import "strings"
+
+// anonName returns the name of an anonymous region set by
+// prctl(PR_SET_VMA, PR_SET_VMA_ANON_NAME, ...), which the kernel shows as
+// the pathname "[anon:name]", or "[anon_shmem:name]" for shared memory.
+// It returns "" for regions without a name.
+func anonName(pathname string) string {
+	for _, prefix := range []string{"[anon:", "[anon_shmem:"} {
+		if strings.HasPrefix(pathname, prefix) && strings.HasSuffix(pathname, "]") {
+			return pathname[len(prefix) : len(pathname)-1]
+		}
+	}
+	return ""
+}
+
+// anonNameGroup returns pathname of a named anonymous region, e.g.
+// "[anon:libc_malloc]", or the top-level path component like topDirGroup
+// for other regions.
+func anonNameGroup(pathname string) string {
+	if anonName(pathname) != "" {
+		return pathname
+	}
+	return topDirGroup(pathname)
+}
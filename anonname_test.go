@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestAnonName(t *testing.T) {
+	testCases := []struct {
+		pathname string
+		want     string
+	}{
+		{pathname: "[anon:scudo:primary]", want: "scudo:primary"},
+		{pathname: "[anon_shmem:dalvik-zygote space]", want: "dalvik-zygote space"},
+		{pathname: "[anon:]", want: ""},
+		{pathname: "[heap]", want: ""},
+		{pathname: "", want: ""},
+		{pathname: "/usr/lib/libc.so.6", want: ""},
+	}
+	for _, tc := range testCases {
+		if got := anonName(tc.pathname); got != tc.want {
+			t.Errorf("anonName(%q) = %q, want %q", tc.pathname, got, tc.want)
+		}
+	}
+}
+
+func TestConvertAnonName(t *testing.T) {
+	input := "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nRss: 4 kB\n" +
+		"7f0000000000-7f0000010000 rw-p 00000000 00:00 0                   [anon:libc_malloc]\nRss: 8 kB\n" +
+		"7f0000010000-7f0000020000 rw-p 00000000 00:00 0                   [anon:libc_malloc]\nRss: 16 kB\n" +
+		"7f0000020000-7f0000021000 rw-p 00000000 00:00 0 \nRss: 4 kB\n"
+
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", anonNameColumn: true, fieldNames: []string{"Rss"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,AnonName,Rss\n" +
+		"55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,,4\n" +
+		"7f0000000000,7f0000010000,rw-p,00000000,00:00,0,[anon:libc_malloc],libc_malloc,8\n" +
+		"7f0000010000,7f0000020000,rw-p,00000000,00:00,0,[anon:libc_malloc],libc_malloc,16\n" +
+		"7f0000020000,7f0000021000,rw-p,00000000,00:00,0,,,4\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+
+	buf.Reset()
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", groupBy: groupByAnonName, fieldNames: []string{"Rss"}, floatFormat: defaultFloatFormat}); err != nil {
+		t.Fatal(err)
+	}
+	want = "Group,Regions,Rss\n" +
+		"/usr,1,4\n" +
+		"[anon:libc_malloc],2,24\n" +
+		"[anon],1,4\n"
+	if got := buf.String(); got != want {
+		t.Errorf("group result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// validateAppend checks that -append is used with a single CSV output
+// file.
+func (a *args) validateAppend() error {
+	if !a.appendOutput {
+		return nil
+	}
+	switch {
+	case a.outputFilename == stdioName:
+		return errors.New("-append needs an output file instead of the standard output")
+	case a.format != "" && a.format != outputFormatCSV:
+		return fmt.Errorf("-append cannot be used with -format %s", a.format)
+	case a.compress == compressGzip, a.compress == compressZstd:
+		return fmt.Errorf("-append cannot be used with %s compression", a.compress)
+	case a.splitsOutput(), len(a.sinks) > 0, a.interval > 0:
+		return errors.New("-append cannot be used with -max-rows, -max-size, -sink or -interval")
+	}
+	return nil
+}
+
+// appendWriter appends CSV records to the output file of -append. The
+// header of a file which is not empty is compared with that of the
+// records instead of written again. The records are buffered and
+// appended by Close in one write, so that a failed run appends nothing,
+// as -atomic does for new files.
+type appendWriter struct {
+	recordWriter
+	buf  bytes.Buffer
+	name string
+	opts outputFileOptions
+	// header is the header of the existing file, or nil if the file is
+	// empty or does not exist.
+	header []string
+	// checked is true after the header is compared or written.
+	checked bool
+	done    bool
+}
+
+// newAppendWriter returns an appendWriter to filename, whose header is
+// not checked if noHeader is true.
+func newAppendWriter(filename string, dialect csvDialect, noHeader bool, opts outputFileOptions) (*appendWriter, error) {
+	w := &appendWriter{name: filename, opts: opts, checked: noHeader}
+	w.recordWriter = dialect.newWriter(&w.buf)
+	header, err := readAppendHeader(filename, dialect.comma)
+	if err != nil {
+		return nil, err
+	}
+	w.header = header
+	return w, nil
+}
+
+// readAppendHeader returns the header of the CSV file filename, skipping
+// comment lines such as the version comment, or nil if the file is empty
+// or does not exist.
+func readAppendHeader(filename string, comma rune) ([]string, error) {
+	file, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	st, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() == 0 {
+		return nil, nil
+	}
+	var last [1]byte
+	if _, err := file.ReadAt(last[:], st.Size()-1); err != nil {
+		return nil, err
+	}
+	if last[0] != '\n' {
+		return nil, fmt.Errorf("%s does not end with a line break, which a previous run may have been interrupted in", filename)
+	}
+	r := csv.NewReader(bufio.NewReader(file))
+	r.Comma = comma
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read header of %s: %w", filename, err)
+	}
+	return header, nil
+}
+
+func (w *appendWriter) Write(record []string) error {
+	if w.checked || w.header == nil {
+		if !w.checked && !isCommentRecord(record) {
+			w.checked = true
+		}
+		return w.recordWriter.Write(record)
+	}
+	if isCommentRecord(record) {
+		return nil
+	}
+	w.checked = true
+	if strings.Join(record, "\x00") != strings.Join(w.header, "\x00") {
+		return fmt.Errorf("header of %s differs from that of the output, which has the columns %s instead of %s",
+			w.name, strings.Join(record, ","), strings.Join(w.header, ","))
+	}
+	return nil
+}
+
+// isCommentRecord reports whether record is the version comment.
+func isCommentRecord(record []string) bool {
+	return len(record) == 1 && strings.HasPrefix(record[0], "#")
+}
+
+func (w *appendWriter) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	_, statErr := os.Stat(w.name)
+	created := errors.Is(statErr, os.ErrNotExist)
+	file, err := os.OpenFile(w.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return err
+	}
+	if created {
+		if w.opts.mode != 0 {
+			if err := file.Chmod(w.opts.mode); err != nil {
+				file.Close()
+				return err
+			}
+		}
+		if w.opts.owner != nil {
+			if err := file.Chown(w.opts.owner.uid, w.opts.owner.gid); err != nil {
+				file.Close()
+				return err
+			}
+		}
+	}
+	if _, err := file.Write(w.buf.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Abort discards the buffered records, as nothing is written before
+// Close.
+func (w *appendWriter) Abort() {
+	w.done = true
+}
+
+func (w *appendWriter) Files() []string {
+	return []string{w.name}
+}
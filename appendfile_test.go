@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunAppend(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.csv")
+	input := writeTestFile(t, testSmapsSorted)
+	runAppend := func(flags ...string) error {
+		t.Helper()
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var a args
+		a.registerFlags(fs)
+		if err := fs.Parse(flags); err != nil {
+			t.Fatal(err)
+		}
+		a.inputFilename = input
+		a.outputFilename = output
+		a.appendOutput = true
+		if err := a.validate(fs); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.validateAppend(); err != nil {
+			t.Fatal(err)
+		}
+		return run(a)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := runAppend("-columns", "Pathname,Rss", "-version-metadata", "comment"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := versionComment() + "\nPathname,Rss\n/usr/bin/cat,4\n/usr/bin/cat,0\n/usr/bin/cat,4\n/usr/bin/cat,0\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+
+	err = runAppend("-columns", "Pathname,Size")
+	if err == nil || !strings.Contains(err.Error(), "which has the columns Pathname,Size instead of Pathname,Rss") {
+		t.Errorf("error mismatch, got=%v", err)
+	}
+	if after, _ := os.ReadFile(output); string(after) != want {
+		t.Errorf("file changed by the failed run,\n got=%s", after)
+	}
+
+	if err := os.WriteFile(output, []byte("Pathname,Rss\n/usr/bin/cat,4"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAppend("-columns", "Pathname,Rss"); err == nil || !strings.Contains(err.Error(), "does not end with a line break") {
+		t.Errorf("error mismatch for a file without the last line break, got=%v", err)
+	}
+}
+
+func TestValidateAppend(t *testing.T) {
+	testCases := []struct {
+		args    args
+		wantErr string
+	}{
+		{args: args{appendOutput: true, outputFilename: "out.csv", format: outputFormatCSV}},
+		{args: args{appendOutput: true, outputFilename: stdioName}, wantErr: "-append needs an output file instead of the standard output"},
+		{args: args{appendOutput: true, outputFilename: "out.json", format: outputFormatJSON}, wantErr: "-append cannot be used with -format json"},
+		{args: args{appendOutput: true, outputFilename: "out.csv.gz", compress: compressGzip}, wantErr: "-append cannot be used with gzip compression"},
+		{args: args{appendOutput: true, outputFilename: "out.csv", maxRows: 10}, wantErr: "-append cannot be used with -max-rows, -max-size, -sink or -interval"},
+	}
+	for _, tc := range testCases {
+		err := tc.args.validateAppend()
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		} else if err == nil || err.Error() != tc.wantErr {
+			t.Errorf("error mismatch, got=%v, want=%s", err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+//go:build !minimal
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Constants of the Arrow IPC format, see
+// https://arrow.apache.org/docs/format/Columnar.html#serialization-and-interprocess-communication-ipc
+// and Schema.fbs and Message.fbs of the format.
+const (
+	arrowMetadataV5 = 4
+
+	arrowHeaderSchema      = 1
+	arrowHeaderRecordBatch = 3
+
+	arrowTypeInt           = 2
+	arrowTypeFloatingPoint = 3
+	arrowTypeUtf8          = 5
+
+	arrowPrecisionDouble = 2
+
+	arrowCompressionZstd = 1
+
+	// arrowContinuation starts each encapsulated message.
+	arrowContinuation = 0xffffffff
+)
+
+// arrowOptions are the compression of the buffers of the Arrow output
+// given by -arrow-compression and -arrow-column-compression. The zero
+// value writes uncompressed buffers.
+type arrowOptions struct {
+	// codec is parquetUncompressed or parquetZstd, as Arrow supports
+	// zstd and LZ4 frames only.
+	codec int
+	level int
+	// columnCompressions override codec and level for some columns.
+	columnCompressions map[string]columnCompression
+}
+
+// validateArrow checks that -arrow-compression and
+// -arrow-column-compression are used with -format arrow and sets
+// arrowOptions from them.
+func (a *args) validateArrow() error {
+	if (a.arrowCompress == "" || a.arrowCompress == "none") && a.arrowColumnCompress == "" {
+		return nil
+	}
+	if a.format != outputFormatArrow {
+		return errors.New("-arrow-compression and -arrow-column-compression require -format arrow")
+	}
+	codec, level, err := parseColumnarCompression("-arrow-compression", a.arrowCompress, false)
+	if err != nil {
+		return err
+	}
+	columns, err := parseColumnCompressions("-arrow-column-compression", a.arrowColumnCompress, false)
+	if err != nil {
+		return err
+	}
+	a.arrowOptions = arrowOptions{codec: codec, level: level, columnCompressions: columns}
+	return nil
+}
+
+// compressions returns the compressions of the columns, or nil if no
+// column is compressed.
+func (o arrowOptions) compressions(columns []string) ([]columnCompression, error) {
+	if err := checkColumnCompressions("-arrow-column-compression", o.columnCompressions, columns); err != nil {
+		return nil, err
+	}
+	compressions := make([]columnCompression, len(columns))
+	compressed := false
+	for i, name := range columns {
+		compressions[i] = columnCompression{codec: o.codec, level: o.level}
+		if cc, ok := o.columnCompressions[name]; ok {
+			compressions[i] = cc
+		}
+		compressed = compressed || compressions[i].codec != parquetUncompressed
+	}
+	if !compressed {
+		return nil, nil
+	}
+	return compressions, nil
+}
+
+// arrowWriter writes records as an Arrow IPC stream, whose schema is
+// created from the columns of the header with the types of the Parquet
+// output: the kB fields and other integer columns are 64-bit signed
+// integers, other numeric columns doubles and the rest UTF-8 strings. The
+// types are inferred from the rows of the first flush, and the rows of
+// each flush are written as a record batch, so a stream written in watch
+// mode has a batch per sample. The buffers of the columns are compressed
+// as given by opts.
+type arrowWriter struct {
+	file    *outputFile
+	headers headerRecords
+	opts    arrowOptions
+	rows    [][]string
+	// types are the parquet types of the columns, or nil until the schema
+	// is written.
+	types []int
+	// compressions are those of the columns, or nil if the buffers are
+	// not compressed.
+	compressions []columnCompression
+	err          error
+}
+
+func newArrowWriter(file *outputFile, headerLines int, opts arrowOptions) *arrowWriter {
+	return &arrowWriter{file: file, headers: headerRecords{headerLines: headerLines}, opts: opts}
+}
+
+func (w *arrowWriter) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.headers.take(record) {
+		return nil
+	}
+	w.rows = append(w.rows, append([]string(nil), record...))
+	return nil
+}
+
+// Flush writes the buffered rows as a record batch, preceded by the
+// schema at the first flush with rows.
+func (w *arrowWriter) Flush() {
+	if w.err != nil || len(w.rows) == 0 {
+		return
+	}
+	var data []byte
+	var err error
+	if w.types == nil {
+		if data, err = w.appendSchema(data); err != nil {
+			w.err = err
+			return
+		}
+	}
+	data, err = appendArrowRecordBatch(data, w.headers.header, w.types, w.compressions, w.rows)
+	if err != nil {
+		w.err = err
+		return
+	}
+	if _, err := w.file.Write(data); err != nil {
+		w.err = err
+		return
+	}
+	w.rows = nil
+}
+
+// appendSchema appends the schema message with the types inferred from
+// the buffered rows.
+func (w *arrowWriter) appendSchema(b []byte) ([]byte, error) {
+	columns := w.headers.header
+	compressions, err := w.opts.compressions(columns)
+	if err != nil {
+		return nil, err
+	}
+	w.compressions = compressions
+	w.types = make([]int, len(columns))
+	fields := make([]flatTable, len(columns))
+	for i, name := range columns {
+		w.types[i] = parquetColumnType(name, w.rows, i)
+		var typeType byte
+		var typ flatTable
+		switch w.types[i] {
+		case parquetInt64:
+			typeType, typ = arrowTypeInt, flatTable{flatI32(64), flatBool(true)}
+		case parquetDouble:
+			typeType, typ = arrowTypeFloatingPoint, flatTable{flatI16(arrowPrecisionDouble)}
+		default:
+			typeType, typ = arrowTypeUtf8, flatTable{}
+		}
+		fields[i] = flatTable{name, flatBool(true), flatU8(typeType), typ, nil, []flatTable{}}
+	}
+	return appendArrowMessage(b, arrowHeaderSchema, flatTable{nil, fields}, nil), nil
+}
+
+func (w *arrowWriter) Error() error {
+	return w.err
+}
+
+// Close writes the rest of the rows, the schema if no rows are written
+// and the end of the stream.
+func (w *arrowWriter) Close() error {
+	w.Flush()
+	if w.err == nil {
+		var data []byte
+		if w.types == nil {
+			data, w.err = w.appendSchema(data)
+		}
+		if w.err == nil {
+			data = appendLittleEndian32(data, arrowContinuation)
+			data = appendLittleEndian32(data, 0)
+			if _, err := w.file.Write(data); err != nil {
+				w.err = err
+			}
+		}
+	}
+	if w.err != nil {
+		w.file.abort()
+		return w.err
+	}
+	return w.file.commit()
+}
+
+func (w *arrowWriter) Abort() {
+	w.file.abort()
+}
+
+func (w *arrowWriter) Files() []string {
+	return []string{w.file.name}
+}
+
+// appendArrowMessage appends an encapsulated message of the header and
+// the body: the continuation marker, the size of the Message flatbuffer,
+// the flatbuffer padded to 8 bytes and the body.
+func appendArrowMessage(b []byte, headerType byte, header flatTable, body []byte) []byte {
+	meta := buildFlatBuffer(flatTable{flatI16(arrowMetadataV5), flatU8(headerType), header, flatI64(int64(len(body)))})
+	for len(meta)%8 != 0 {
+		meta = append(meta, 0)
+	}
+	b = appendLittleEndian32(b, arrowContinuation)
+	b = appendLittleEndian32(b, uint32(len(meta)))
+	b = append(b, meta...)
+	return append(b, body...)
+}
+
+// appendArrowRecordBatch appends a record batch message of the rows with
+// the columns of the parquet types. The buffers of the columns are
+// compressed with compressions if it is not nil, each prefixed by its
+// uncompressed length, or -1 for a buffer left uncompressed.
+func appendArrowRecordBatch(b []byte, columns []string, types []int, compressions []columnCompression, rows [][]string) ([]byte, error) {
+	var body, nodes, buffers []byte
+	var compression columnCompression
+	addBuffer := func(data []byte) error {
+		if compressions != nil && len(data) > 0 {
+			compressed, err := compressColumnar(compression, data)
+			if err != nil {
+				return err
+			}
+			var prefix [8]byte
+			if compression.codec == parquetUncompressed || len(compressed) >= len(data) {
+				binary.LittleEndian.PutUint64(prefix[:], math.MaxUint64)
+			} else {
+				binary.LittleEndian.PutUint64(prefix[:], uint64(len(data)))
+				data = compressed
+			}
+			data = append(prefix[:], data...)
+		}
+		buffers = appendLittleEndian64(buffers, uint64(len(body)))
+		buffers = appendLittleEndian64(buffers, uint64(len(data)))
+		body = append(body, data...)
+		for len(body)%8 != 0 {
+			body = append(body, 0)
+		}
+		return nil
+	}
+	for i, typ := range types {
+		if compressions != nil {
+			compression = compressions[i]
+		}
+		validity := make([]byte, (len(rows)+7)/8)
+		var values, offsets []byte
+		if typ == parquetByteArray {
+			offsets = appendLittleEndian32(offsets, 0)
+		}
+		nulls := 0
+		for j, row := range rows {
+			value := parquetValue(row, i)
+			if value == "" {
+				nulls++
+			} else {
+				validity[j/8] |= 1 << (j % 8)
+			}
+			switch typ {
+			case parquetInt64:
+				var v int64
+				if value != "" {
+					var err error
+					if v, err = parseInt64Value(value); err != nil {
+						return nil, fmt.Errorf("value %q of column %s is not an integer, which the column is in the schema inferred from the first rows", value, columns[i])
+					}
+				}
+				values = appendLittleEndian64(values, uint64(v))
+			case parquetDouble:
+				var v float64
+				if value != "" {
+					var err error
+					if v, err = parseFloatValue(value); err != nil {
+						return nil, fmt.Errorf("value %q of column %s is not a number, which the column is in the schema inferred from the first rows", value, columns[i])
+					}
+				}
+				values = appendLittleEndian64(values, math.Float64bits(v))
+			default:
+				values = append(values, value...)
+				offsets = appendLittleEndian32(offsets, uint32(len(values)))
+			}
+		}
+		nodes = appendLittleEndian64(nodes, uint64(len(rows)))
+		nodes = appendLittleEndian64(nodes, uint64(nulls))
+		if nulls == 0 {
+			// The validity bitmap may be omitted if there are no nulls.
+			validity = nil
+		}
+		if err := addBuffer(validity); err != nil {
+			return nil, err
+		}
+		if offsets != nil {
+			if err := addBuffer(offsets); err != nil {
+				return nil, err
+			}
+		}
+		if err := addBuffer(values); err != nil {
+			return nil, err
+		}
+	}
+	batch := flatTable{flatI64(int64(len(rows))), flatStructs(nodes), flatStructs(buffers)}
+	if compressions != nil {
+		// The BodyCompression of zstd and the method of compressing each
+		// buffer, which is the default 0.
+		batch = append(batch, flatTable{flatU8(arrowCompressionZstd)})
+	}
+	return appendArrowMessage(b, arrowHeaderRecordBatch, batch, body), nil
+}
@@ -0,0 +1,419 @@
+//go:build !minimal
+
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestArrowWriter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "memory.arrow")
+	file, err := createOutputFile(filename, outputFileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newArrowWriter(file, 1, arrowOptions{})
+	records := [][]string{
+		{"Pathname", "Rss", "Pss"},
+		{"[heap]", "4", "1.5"},
+		{"", "", "2"},
+	}
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Flush()
+	if err := w.Write([]string{"/usr/bin/cat", "8", ""}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, batches := readTestArrowStream(t, data)
+	wantSchema := []testArrowField{
+		{name: "Pathname", typ: arrowTypeUtf8},
+		{name: "Rss", typ: arrowTypeInt},
+		{name: "Pss", typ: arrowTypeFloatingPoint},
+	}
+	if !reflect.DeepEqual(schema, wantSchema) {
+		t.Errorf("schema mismatch,\n got=%v,\nwant=%v", schema, wantSchema)
+	}
+	want := [][][]interface{}{
+		{
+			{"[heap]", nil},
+			{int64(4), nil},
+			{1.5, 2.0},
+		},
+		{
+			{"/usr/bin/cat"},
+			{int64(8)},
+			{nil},
+		},
+	}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("batches mismatch,\n got=%v,\nwant=%v", batches, want)
+	}
+}
+
+func TestArrowWriterCompression(t *testing.T) {
+	records := [][]string{{"Pathname", "Rss", "Pss"}}
+	for i := 0; i < 100; i++ {
+		records = append(records, []string{"/usr/lib/x86_64-linux-gnu/libc.so.6", "4", ""})
+	}
+	write := func(opts arrowOptions) []byte {
+		t.Helper()
+		filename := filepath.Join(t.TempDir(), "memory.arrow")
+		file, err := createOutputFile(filename, outputFileOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := newArrowWriter(file, 1, opts)
+		for _, record := range records {
+			if err := w.Write(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	plain := write(arrowOptions{})
+	compressed := write(arrowOptions{codec: parquetZstd, level: 19, columnCompressions: map[string]columnCompression{"Rss": {codec: parquetUncompressed}}})
+	if len(compressed) >= len(plain) {
+		t.Errorf("compressed stream of %d bytes is not smaller than %d bytes", len(compressed), len(plain))
+	}
+	plainSchema, plainBatches := readTestArrowStream(t, plain)
+	schema, batches := readTestArrowStream(t, compressed)
+	if !reflect.DeepEqual(schema, plainSchema) || !reflect.DeepEqual(batches, plainBatches) {
+		t.Errorf("decompressed stream mismatch,\n got=%v,\nwant=%v", batches, plainBatches)
+	}
+
+	file, err := createOutputFile(filepath.Join(t.TempDir(), "memory.arrow"), outputFileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newArrowWriter(file, 1, arrowOptions{columnCompressions: map[string]columnCompression{"Inode": {codec: parquetZstd}}})
+	w.Write([]string{"Rss"})
+	w.Write([]string{"4"})
+	if err := w.Close(); err == nil {
+		t.Error("unexpected success with a compressed column not in the output")
+	}
+}
+
+func TestValidateArrow(t *testing.T) {
+	a := args{format: outputFormatArrow, arrowCompress: "zstd:9", arrowColumnCompress: "Rss=none"}
+	if err := a.validateArrow(); err != nil {
+		t.Fatal(err)
+	}
+	want := arrowOptions{codec: parquetZstd, level: 9, columnCompressions: map[string]columnCompression{"Rss": {codec: parquetUncompressed}}}
+	if !reflect.DeepEqual(a.arrowOptions, want) {
+		t.Errorf("options mismatch, got=%+v, want=%+v", a.arrowOptions, want)
+	}
+	for _, a := range []args{
+		{format: outputFormatParquet, arrowCompress: "zstd"},
+		{format: outputFormatArrow, arrowCompress: "gzip"},
+		{format: outputFormatArrow, arrowColumnCompress: "Rss"},
+	} {
+		if err := a.validateArrow(); err == nil {
+			t.Errorf("%+v: got no error", a)
+		}
+	}
+}
+
+func TestArrowWriterTypeMismatch(t *testing.T) {
+	file, err := createOutputFile(filepath.Join(t.TempDir(), "memory.arrow"), outputFileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newArrowWriter(file, 1, arrowOptions{})
+	w.Write([]string{"Rss"})
+	w.Write([]string{"4"})
+	w.Flush()
+	w.Write([]string{"4.5"})
+	if err := w.Close(); err == nil {
+		t.Error("unexpected success with a decimal value in an integer column")
+	}
+}
+
+func TestArrowWriterEmpty(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "memory.arrow")
+	file, err := createOutputFile(filename, outputFileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newArrowWriter(file, 1, arrowOptions{})
+	w.Write([]string{"Pathname", "Rss"})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, batches := readTestArrowStream(t, data)
+	if len(schema) != 2 || len(batches) != 0 {
+		t.Errorf("stream mismatch, schema=%v, batches=%v", schema, batches)
+	}
+}
+
+func TestRunArrow(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-columns", "Pathname,Rss"}); err != nil {
+		t.Fatal(err)
+	}
+	a.format = outputFormatArrow
+	a.inputFilename = writeTestFile(t, testTotalsInput)
+	a.outputFilename = filepath.Join(t.TempDir(), "memory.arrow")
+	if err := a.validate(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(a); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(a.outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, batches := readTestArrowStream(t, data)
+	if len(schema) == 0 || schema[0].name != "Pathname" {
+		t.Errorf("schema mismatch, got=%v", schema)
+	}
+	if len(batches) != 1 || len(batches[0][0]) != 3 {
+		t.Errorf("batches mismatch, got=%v", batches)
+	}
+}
+
+type testArrowField struct {
+	name string
+	typ  byte
+}
+
+// readTestArrowStream reads the schema and the columns of the record
+// batches of an Arrow IPC stream.
+func readTestArrowStream(t *testing.T, data []byte) ([]testArrowField, [][][]interface{}) {
+	t.Helper()
+	var schema []testArrowField
+	var batches [][][]interface{}
+	for {
+		if len(data) < 8 || binary.LittleEndian.Uint32(data) != arrowContinuation {
+			t.Fatal("missing continuation marker")
+		}
+		size := int(binary.LittleEndian.Uint32(data[4:]))
+		if size == 0 {
+			if len(data) != 8 {
+				t.Fatalf("%d bytes after the end of the stream", len(data)-8)
+			}
+			return schema, batches
+		}
+		if size%8 != 0 {
+			t.Fatalf("metadata size %d is not a multiple of 8", size)
+		}
+		msg := testFlatRoot(t, data[8:8+size])
+		if v := msg.i16(0); v != arrowMetadataV5 {
+			t.Errorf("version mismatch, got=%d", v)
+		}
+		bodyLength := int(msg.i64(3))
+		body := data[8+size : 8+size+bodyLength]
+		data = data[8+size+bodyLength:]
+		header := msg.table(2)
+		switch msg.u8(1) {
+		case arrowHeaderSchema:
+			for _, f := range header.tables(1) {
+				if f.u8(1) != 1 {
+					t.Errorf("field %s is not nullable", f.str(0))
+				}
+				typ := f.u8(2)
+				switch typ {
+				case arrowTypeInt:
+					if f.table(3).i32(0) != 64 || f.table(3).u8(1) != 1 {
+						t.Errorf("type of %s is not a signed 64-bit integer", f.str(0))
+					}
+				case arrowTypeFloatingPoint:
+					if f.table(3).i16(0) != arrowPrecisionDouble {
+						t.Errorf("type of %s is not a double", f.str(0))
+					}
+				}
+				if _, ok := f.field(5); !ok {
+					t.Errorf("field %s has no children", f.str(0))
+				}
+				schema = append(schema, testArrowField{name: f.str(0), typ: typ})
+			}
+		case arrowHeaderRecordBatch:
+			if schema == nil {
+				t.Fatal("record batch before the schema")
+			}
+			length := int(header.i64(0))
+			nodes, buffers := header.structs(1), header.structs(2)
+			_, compressed := header.field(3)
+			if compressed && header.table(3).u8(0) != arrowCompressionZstd {
+				t.Fatalf("unexpected compression codec %d", header.table(3).u8(0))
+			}
+			var columns [][]interface{}
+			for i, field := range schema {
+				if int(nodes[i][0]) != length {
+					t.Fatalf("length mismatch of %s, got=%d", field.name, nodes[i][0])
+				}
+				buffer := func() []byte {
+					b := buffers[0]
+					buffers = buffers[1:]
+					if b[0]%8 != 0 {
+						t.Fatalf("buffer of %s at %d is not aligned", field.name, b[0])
+					}
+					data := body[int(b[0]) : int(b[0])+int(b[1])]
+					if !compressed || len(data) == 0 {
+						return data
+					}
+					n := int64(binary.LittleEndian.Uint64(data))
+					if data = data[8:]; n == -1 {
+						return data
+					}
+					if data = testZstdDecode(t, data); int64(len(data)) != n {
+						t.Fatalf("uncompressed length mismatch of %s, got=%d, want=%d", field.name, len(data), n)
+					}
+					return data
+				}
+				validity := buffer()
+				var offsets []byte
+				if field.typ == arrowTypeUtf8 {
+					offsets = buffer()
+				}
+				values := buffer()
+				var column []interface{}
+				nulls := 0
+				for j := 0; j < length; j++ {
+					if len(validity) > 0 && validity[j/8]&(1<<(j%8)) == 0 {
+						column = append(column, nil)
+						nulls++
+						continue
+					}
+					switch field.typ {
+					case arrowTypeInt:
+						column = append(column, int64(binary.LittleEndian.Uint64(values[8*j:])))
+					case arrowTypeFloatingPoint:
+						column = append(column, math.Float64frombits(binary.LittleEndian.Uint64(values[8*j:])))
+					default:
+						start, end := binary.LittleEndian.Uint32(offsets[4*j:]), binary.LittleEndian.Uint32(offsets[4*j+4:])
+						column = append(column, string(values[start:end]))
+					}
+				}
+				if int(nodes[i][1]) != nulls {
+					t.Errorf("null_count mismatch of %s, got=%d, want=%d", field.name, nodes[i][1], nulls)
+				}
+				columns = append(columns, column)
+			}
+			batches = append(batches, columns)
+		default:
+			t.Fatalf("unexpected message header type %d", msg.u8(1))
+		}
+	}
+}
+
+// testFlatTable reads a table of a FlatBuffer, checking the alignment of
+// the values as the verifier of FlatBuffers does.
+type testFlatTable struct {
+	t   *testing.T
+	b   []byte
+	pos int
+}
+
+func testFlatRoot(t *testing.T, b []byte) testFlatTable {
+	return testFlatTable{t: t, b: b, pos: int(binary.LittleEndian.Uint32(b))}
+}
+
+// field returns the position of the field id, or false if it is absent.
+func (f testFlatTable) field(id int) (int, bool) {
+	if f.pos%4 != 0 {
+		f.t.Fatalf("table at %d is not aligned", f.pos)
+	}
+	vtable := f.pos - int(int32(binary.LittleEndian.Uint32(f.b[f.pos:])))
+	if 4+2*id >= int(binary.LittleEndian.Uint16(f.b[vtable:])) {
+		return 0, false
+	}
+	offset := int(binary.LittleEndian.Uint16(f.b[vtable+4+2*id:]))
+	if offset == 0 {
+		return 0, false
+	}
+	return f.pos + offset, true
+}
+
+func (f testFlatTable) scalar(id, size int) []byte {
+	pos, ok := f.field(id)
+	if !ok {
+		return make([]byte, size)
+	}
+	if pos%size != 0 {
+		f.t.Fatalf("field %d at %d is not aligned", id, pos)
+	}
+	return f.b[pos : pos+size]
+}
+
+func (f testFlatTable) u8(id int) byte   { return f.scalar(id, 1)[0] }
+func (f testFlatTable) i16(id int) int16 { return int16(binary.LittleEndian.Uint16(f.scalar(id, 2))) }
+func (f testFlatTable) i32(id int) int32 { return int32(binary.LittleEndian.Uint32(f.scalar(id, 4))) }
+func (f testFlatTable) i64(id int) int64 { return int64(binary.LittleEndian.Uint64(f.scalar(id, 8))) }
+
+// ref returns the position of the object which the field id refers to.
+func (f testFlatTable) ref(id int) int {
+	pos := int(binary.LittleEndian.Uint32(f.scalar(id, 4)))
+	p, _ := f.field(id)
+	return p + pos
+}
+
+func (f testFlatTable) table(id int) testFlatTable {
+	return testFlatTable{t: f.t, b: f.b, pos: f.ref(id)}
+}
+
+func (f testFlatTable) str(id int) string {
+	pos := f.ref(id)
+	n := int(binary.LittleEndian.Uint32(f.b[pos:]))
+	if f.b[pos+4+n] != 0 {
+		f.t.Fatal("string is not null terminated")
+	}
+	return string(f.b[pos+4 : pos+4+n])
+}
+
+func (f testFlatTable) tables(id int) []testFlatTable {
+	pos := f.ref(id)
+	n := int(binary.LittleEndian.Uint32(f.b[pos:]))
+	tables := make([]testFlatTable, n)
+	for i := range tables {
+		p := pos + 4 + 4*i
+		tables[i] = testFlatTable{t: f.t, b: f.b, pos: p + int(binary.LittleEndian.Uint32(f.b[p:]))}
+	}
+	return tables
+}
+
+// structs returns the elements of a vector of structs of two longs.
+func (f testFlatTable) structs(id int) [][2]int64 {
+	pos := f.ref(id)
+	if (pos+4)%8 != 0 {
+		f.t.Fatalf("vector of structs at %d is not aligned", pos)
+	}
+	n := int(binary.LittleEndian.Uint32(f.b[pos:]))
+	elems := make([][2]int64, n)
+	for i := range elems {
+		p := pos + 4 + 16*i
+		elems[i] = [2]int64{int64(binary.LittleEndian.Uint64(f.b[p:])), int64(binary.LittleEndian.Uint64(f.b[p+8:]))}
+	}
+	return elems
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// outputFile is a created output file. An atomic output file is written
+// to a temporary file in the same directory, which is renamed to the
+// final name by commit, so that readers never see a truncated file.
+type outputFile struct {
+	*os.File
+	name    string
+	tmpName string
+	done    bool
+}
+
+// outputFileOptions are the options of creating output files.
+type outputFileOptions struct {
+	// atomic makes the data written to a temporary file until commit is
+	// called.
+	atomic bool
+	// mode is the permission bits of the file regardless of the umask,
+	// or zero for the default.
+	mode os.FileMode
+	// owner is the owner of the file, or nil for the default.
+	owner *fileOwner
+}
+
+// fileOwner is the owner user and group of a file.
+type fileOwner struct {
+	uid, gid int
+}
+
+// stdioName is the filename of the standard input or output.
+const stdioName = "-"
+
+// createOutputFile creates the output file name, or returns the standard
+// output if name is "-".
+func createOutputFile(name string, opts outputFileOptions) (*outputFile, error) {
+	if name == stdioName {
+		return &outputFile{File: os.Stdout, name: name}, nil
+	}
+	f, err := openOutputFile(name, opts.atomic)
+	if err != nil {
+		return nil, err
+	}
+	if opts.mode != 0 {
+		if err := f.Chmod(opts.mode); err != nil {
+			f.abort()
+			return nil, err
+		}
+	}
+	if opts.owner != nil {
+		if err := f.Chown(opts.owner.uid, opts.owner.gid); err != nil {
+			f.abort()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func openOutputFile(name string, atomic bool) (*outputFile, error) {
+	if !atomic {
+		file, err := os.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		return &outputFile{File: file, name: name}, nil
+	}
+	dir, base := filepath.Split(name)
+	for i := 0; i < 10; i++ {
+		var b [6]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, err
+		}
+		tmpName := filepath.Join(dir, "."+base+"."+hex.EncodeToString(b[:])+".tmp")
+		file, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &outputFile{File: file, name: name, tmpName: tmpName}, nil
+	}
+	return nil, &fs.PathError{Op: "create temporary file for", Path: name, Err: fs.ErrExist}
+}
+
+// close closes the file without committing it. The standard output is
+// left open.
+func (f *outputFile) close() error {
+	if f.File == nil {
+		return nil
+	}
+	if f.name == stdioName {
+		f.File = nil
+		return nil
+	}
+	err := f.File.Close()
+	f.File = nil
+	return err
+}
+
+// writeOutputFile writes data to the output file name.
+func writeOutputFile(name string, data []byte, opts outputFileOptions) error {
+	f, err := createOutputFile(name, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
+
+// parseFileMode parses octal permission bits such as "0640".
+func parseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode == 0 || mode > 0o777 {
+		return 0, fmt.Errorf("invalid file mode: %q", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// parseFileOwner parses an owner in the form user[:group], where user
+// and group are names or numeric ids. The group defaults to the primary
+// group of the user.
+func parseFileOwner(s string) (*fileOwner, error) {
+	userName, groupName, hasGroup := strings.Cut(s, ":")
+	u, err := lookupUser(userName)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported uid %q of user %s", u.Uid, userName)
+	}
+	gidStr := u.Gid
+	if hasGroup {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if _, numErr := strconv.Atoi(groupName); numErr != nil {
+				return nil, err
+			}
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return nil, err
+			}
+		}
+		gidStr = g.Gid
+	}
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported gid %q of group of %s", gidStr, s)
+	}
+	return &fileOwner{uid: uid, gid: gid}, nil
+}
+
+// commit closes the file and renames the temporary file to the final
+// name. The temporary file and then the directory are synced, so that
+// the file is not lost or truncated after a crash.
+func (f *outputFile) commit() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	if f.tmpName != "" && f.File != nil {
+		if err := f.Sync(); err != nil {
+			f.close()
+			f.remove()
+			return err
+		}
+	}
+	if err := f.close(); err != nil {
+		f.remove()
+		return err
+	}
+	if f.tmpName == "" {
+		return nil
+	}
+	if err := os.Rename(f.tmpName, f.name); err != nil {
+		f.remove()
+		return err
+	}
+	return syncDir(filepath.Dir(f.name))
+}
+
+// syncDir syncs the directory dir, e.g. to persist a rename in it.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// abort closes the file and removes the temporary file unless the file
+// is already committed. The partially written file is kept if the file
+// is not atomic.
+func (f *outputFile) abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.close()
+	f.remove()
+}
+
+func (f *outputFile) remove() {
+	if f.tmpName != "" {
+		os.Remove(f.tmpName)
+	}
+}
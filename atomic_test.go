@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestOutputFileCommit(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out.csv")
+	f, err := createOutputFile(name, outputFileOptions{atomic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("a,b\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("output file must not exist before commit, err=%v", err)
+	}
+	if err := f.commit(); err != nil {
+		t.Fatal(err)
+	}
+	f.abort()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "a,b\n"; got != want {
+		t.Errorf("content mismatch, got=%q, want=%q", got, want)
+	}
+	assertDirEntries(t, dir, 1)
+}
+
+func TestOutputFileAbort(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out.csv")
+	if err := os.WriteFile(name, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := createOutputFile(name, outputFileOptions{atomic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("trunc"); err != nil {
+		t.Fatal(err)
+	}
+	f.abort()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "old\n"; got != want {
+		t.Errorf("existing output must be kept, got=%q, want=%q", got, want)
+	}
+	assertDirEntries(t, dir, 1)
+}
+
+func assertDirEntries(t *testing.T, dir string, want int) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != want {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("directory entries mismatch, got=%v, want %d entries", names, want)
+	}
+}
+
+func TestCreateOutputFileMode(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "out.csv")
+	mode, err := parseFileMode("0640")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := createOutputFile(name, outputFileOptions{atomic: true, mode: mode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.commit(); err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := st.Mode().Perm(), os.FileMode(0o640); got != want {
+		t.Errorf("mode mismatch, got=%v, want=%v", got, want)
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	for _, s := range []string{"", "0", "0800", "1777", "rw"} {
+		if _, err := parseFileMode(s); err == nil {
+			t.Errorf("in=%q: expected error", s)
+		}
+	}
+}
+
+func TestParseFileOwner(t *testing.T) {
+	uid, gid := os.Getuid(), os.Getgid()
+	owner, err := parseFileOwner(strconv.Itoa(uid) + ":" + strconv.Itoa(gid))
+	if err != nil {
+		t.Skip(err)
+	}
+	if owner.uid != uid || owner.gid != gid {
+		t.Errorf("owner mismatch, got=%+v, want uid=%d gid=%d", owner, uid, gid)
+	}
+}
+
+func TestCreateOutputFileStdout(t *testing.T) {
+	f, err := createOutputFile(stdioName, outputFileOptions{atomic: true, mode: 0o600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.File != os.Stdout {
+		t.Fatal("output file must be the standard output")
+	}
+	if err := f.commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stdout.Stat(); err != nil {
+		t.Errorf("standard output must be left open: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "strings"
+
+// Types of the objects backing regions in the BackingType column.
+const (
+	backingFile      = "file"
+	backingMemfd     = "memfd"
+	backingShm       = "shm"
+	backingSysV      = "sysv"
+	backingAnonInode = "anon_inode"
+	backingAnon      = "anon"
+	backingPseudo    = "pseudo"
+)
+
+// regionBacking returns the type of the object backing a region of the
+// pathname and whether it is a file which has been removed or replaced.
+//
+// The kernel appends " (deleted)" to the pathnames of memfd, SysV shared
+// memory and shared anonymous mappings, which show as /dev/zero or
+// /anon_hugepage, regardless of any file, so only files, including POSIX
+// shared memory under /dev/shm, are deleted. Anonymous regions are anon,
+// including those named by PR_SET_VMA_ANON_NAME, and the other bracketed
+// pathnames, e.g. [heap] and [vdso], are pseudo.
+func regionBacking(pathname string) (backing string, deleted bool) {
+	trimmed := strings.TrimSuffix(pathname, deletedSuffix)
+	switch {
+	case pathname == "" || anonName(pathname) != "":
+		return backingAnon, false
+	case strings.HasPrefix(pathname, "["):
+		return backingPseudo, false
+	case strings.HasPrefix(pathname, "anon_inode:"):
+		return backingAnonInode, false
+	case trimmed == "/dev/zero" && trimmed != pathname, trimmed == "/anon_hugepage":
+		return backingAnon, false
+	}
+	switch kind, _ := classifyShm(pathname); kind {
+	case shmKindMemfd:
+		return backingMemfd, false
+	case shmKindPOSIX:
+		return backingShm, trimmed != pathname
+	case shmKindSysV:
+		return backingSysV, false
+	}
+	return backingFile, trimmed != pathname
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestRegionBacking(t *testing.T) {
+	for _, tc := range []struct {
+		pathname    string
+		wantBacking string
+		wantDeleted bool
+	}{
+		{pathname: "/usr/lib/libc.so.6", wantBacking: backingFile},
+		{pathname: "/usr/lib/libssl.so.3 (deleted)", wantBacking: backingFile, wantDeleted: true},
+		{pathname: "/memfd:pool (deleted)", wantBacking: backingMemfd},
+		{pathname: "/dev/shm/queue", wantBacking: backingShm},
+		{pathname: "/dev/shm/queue (deleted)", wantBacking: backingShm, wantDeleted: true},
+		{pathname: "/SYSV0000abcd (deleted)", wantBacking: backingSysV},
+		{pathname: "anon_inode:[perf_event]", wantBacking: backingAnonInode},
+		{pathname: "/dev/zero (deleted)", wantBacking: backingAnon},
+		{pathname: "/dev/zero", wantBacking: backingFile},
+		{pathname: "/anon_hugepage (deleted)", wantBacking: backingAnon},
+		{pathname: "", wantBacking: backingAnon},
+		{pathname: "[anon:libc_malloc]", wantBacking: backingAnon},
+		{pathname: "[heap]", wantBacking: backingPseudo},
+		{pathname: "[vdso]", wantBacking: backingPseudo},
+	} {
+		backing, deleted := regionBacking(tc.pathname)
+		if backing != tc.wantBacking || deleted != tc.wantDeleted {
+			t.Errorf("%q: got %s, %v, want %s, %v", tc.pathname, backing, deleted, tc.wantBacking, tc.wantDeleted)
+		}
+	}
+}
+
+func TestConvertStripDeleted(t *testing.T) {
+	input := "7f0020000000-7f0020001000 r-xp 00000000 fe:00 42 /usr/lib/libssl.so.3\nRss: 4 kB\n" +
+		"7f0020001000-7f0020002000 r-xp 00000000 fe:00 43 /usr/lib/libssl.so.3 (deleted)\nRss: 8 kB\n" +
+		"7f0030000000-7f0030001000 rw-s 00000000 00:01 4 /memfd:pool (deleted)\nRss: 4 kB\n"
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", backingColumns: true, stripDeleted: true, columns: []string{"Pathname", "IsDeleted", "BackingType", "Rss"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "Pathname,IsDeleted,BackingType,Rss\n" +
+		"/usr/lib/libssl.so.3,false,file,4\n" +
+		"/usr/lib/libssl.so.3,true,file,8\n" +
+		"/memfd:pool,false,memfd,4\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+
+	buf.Reset()
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", stripDeleted: true, groupBy: groupByPathname, floatFormat: defaultFloatFormat, columns: []string{"Group", "Regions", "Rss"}}); err != nil {
+		t.Fatal(err)
+	}
+	want = "Group,Regions,Rss\n" +
+		"/usr/lib/libssl.so.3,2,12\n" +
+		"/memfd:pool,1,4\n"
+	if got := buf.String(); got != want {
+		t.Errorf("group result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Scopes of regression rules.
+const (
+	regressionScopeTotal    = "total"
+	regressionScopePathname = "pathname"
+)
+
+// regressionRule is a tolerance given by -regression-rule as
+// scope:field:+limit, e.g. "total:Pss:+10%" for the sum of Pss of all
+// regions or "pathname:Pss:+5M" for the sum of Pss of each pathname. The
+// limit is a percentage of the baseline or a size.
+type regressionRule struct {
+	scope string
+	field string
+	// limit is a percentage if relative is true, in kB otherwise.
+	limit    float64
+	relative bool
+}
+
+func parseRegressionRule(s string) (regressionRule, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return regressionRule{}, fmt.Errorf("regression rule must be scope:field:+limit: %q", s)
+	}
+	r := regressionRule{scope: parts[0], field: parts[1]}
+	if r.scope != regressionScopeTotal && r.scope != regressionScopePathname {
+		return regressionRule{}, fmt.Errorf("unsupported regression rule scope: %q", r.scope)
+	}
+	if r.field == "" {
+		return regressionRule{}, fmt.Errorf("regression rule without a field: %q", s)
+	}
+	limit := strings.TrimPrefix(parts[2], "+")
+	if strings.HasSuffix(limit, "%") {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(limit, "%"), 64)
+		if err != nil || v < 0 {
+			return regressionRule{}, fmt.Errorf("invalid regression rule limit: %q", parts[2])
+		}
+		r.limit, r.relative = v, true
+		return r, nil
+	}
+	size, err := parseByteSize(limit)
+	if err != nil {
+		return regressionRule{}, fmt.Errorf("invalid regression rule limit: %w", err)
+	}
+	r.limit = float64(size) / 1024
+	return r, nil
+}
+
+func (r regressionRule) String() string {
+	if r.relative {
+		return fmt.Sprintf("+%s%%", strconv.FormatFloat(r.limit, 'f', -1, 64))
+	}
+	return fmt.Sprintf("+%s kB", strconv.FormatFloat(r.limit, 'f', -1, 64))
+}
+
+// exceeds reports whether cur exceeds the tolerance of r over base.
+func (r regressionRule) exceeds(base, cur float64) bool {
+	if r.relative {
+		return cur > base*(1+r.limit/100)
+	}
+	return cur-base > r.limit
+}
+
+// fieldSums is the sums of fields in all regions and in the regions of
+// each pathname.
+type fieldSums struct {
+	total      map[string]float64
+	byPathname map[string]map[string]float64
+	// pathnames are the pathnames in the order of appearance.
+	pathnames []string
+}
+
+func newFieldSums() *fieldSums {
+	return &fieldSums{total: make(map[string]float64), byPathname: make(map[string]map[string]float64)}
+}
+
+func (s *fieldSums) add(pathname, field string, v float64) {
+	s.total[field] += v
+	sums := s.byPathname[pathname]
+	if sums == nil {
+		sums = make(map[string]float64)
+		s.byPathname[pathname] = sums
+		s.pathnames = append(s.pathnames, pathname)
+	}
+	sums[field] += v
+}
+
+// readBaseline reads the sums of fields from a CSV file written by this
+// tool with a Pathname column and a column of each field in kB.
+func readBaseline(filename string, comma rune, fields []string) (*fieldSums, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.Comma = comma
+	r.Comment = '#'
+	header, err := r.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("baseline %s is empty", filename)
+		}
+		return nil, fmt.Errorf("baseline %s: %w", filename, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	pathnameColumn, ok := columns["Pathname"]
+	if !ok {
+		return nil, fmt.Errorf("baseline %s has no Pathname column", filename)
+	}
+	for _, field := range fields {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("baseline %s has no %s column", filename, field)
+		}
+	}
+
+	s := newFieldSums()
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("baseline %s: %w", filename, err)
+		}
+		for _, field := range fields {
+			value := record[columns[field]]
+			if value == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				line, _ := r.FieldPos(columns[field])
+				return nil, fmt.Errorf("baseline %s: line %d: invalid %s: %q", filename, line, field, value)
+			}
+			s.add(record[pathnameColumn], field, v)
+		}
+	}
+}
+
+// regressionChecker checks the sums of fields of a run against the
+// baseline with the regression rules.
+type regressionChecker struct {
+	rules    []regressionRule
+	baseline *fieldSums
+	current  *fieldSums
+}
+
+// newRegressionChecker returns a checker against the baseline CSV file at
+// filename.
+func newRegressionChecker(filename string, comma rune, rules []regressionRule) (*regressionChecker, error) {
+	if len(rules) == 0 {
+		return nil, errors.New("no regression rules for the baseline")
+	}
+	baseline, err := readBaseline(filename, comma, regressionFields(rules))
+	if err != nil {
+		return nil, err
+	}
+	return &regressionChecker{rules: rules, baseline: baseline, current: newFieldSums()}, nil
+}
+
+// regressionFields returns the fields of rules without duplicates.
+func regressionFields(rules []regressionRule) []string {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, r := range rules {
+		if !seen[r.field] {
+			seen[r.field] = true
+			fields = append(fields, r.field)
+		}
+	}
+	return fields
+}
+
+// add adds the fields of m in the rules to the sums of the run.
+func (c *regressionChecker) add(m *mapping) {
+	for _, field := range regressionFields(c.rules) {
+		if v, ok := m.numericFieldValue(field); ok {
+			c.current.add(string(m.Region.Pathname), field, v)
+		}
+	}
+}
+
+// violations returns the descriptions of the sums exceeding the rules.
+func (c *regressionChecker) violations() []string {
+	var violations []string
+	for _, r := range c.rules {
+		switch r.scope {
+		case regressionScopeTotal:
+			base, cur := c.baseline.total[r.field], c.current.total[r.field]
+			if r.exceeds(base, cur) {
+				violations = append(violations, formatRegression("total "+r.field, base, cur, r))
+			}
+		case regressionScopePathname:
+			for _, pathname := range c.current.pathnames {
+				base, cur := c.baseline.byPathname[pathname][r.field], c.current.byPathname[pathname][r.field]
+				if r.exceeds(base, cur) {
+					if pathname == "" {
+						pathname = "[anon]"
+					}
+					violations = append(violations, formatRegression(r.field+" of "+pathname, base, cur, r))
+				}
+			}
+		}
+	}
+	return violations
+}
+
+func formatRegression(what string, base, cur float64, r regressionRule) string {
+	change := "new"
+	if base != 0 {
+		change = fmt.Sprintf("%+.1f%%", (cur-base)/base*100)
+	}
+	return fmt.Sprintf("%s grew from %s kB to %s kB (%s), exceeding %s",
+		what, strconv.FormatFloat(base, 'f', -1, 64), strconv.FormatFloat(cur, 'f', -1, 64), change, r)
+}
+
+// check writes the violations to w and returns an error if there are any.
+func (c *regressionChecker) check(w io.Writer) error {
+	violations := c.violations()
+	for _, v := range violations {
+		fmt.Fprintln(w, "regression:", v)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%d memory regressions against the baseline", len(violations))
+	}
+	return nil
+}
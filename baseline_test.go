@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseRegressionRule(t *testing.T) {
+	testCases := []struct {
+		in      string
+		want    regressionRule
+		wantErr bool
+	}{
+		{in: "total:Pss:+10%", want: regressionRule{scope: "total", field: "Pss", limit: 10, relative: true}},
+		{in: "pathname:Pss:+5M", want: regressionRule{scope: "pathname", field: "Pss", limit: 5120}},
+		{in: "pathname:Rss:512K", want: regressionRule{scope: "pathname", field: "Rss", limit: 512}},
+		{in: "total:Pss", wantErr: true},
+		{in: "library:Pss:+5M", wantErr: true},
+		{in: "total::+5M", wantErr: true},
+		{in: "total:Pss:+x%", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := parseRegressionRule(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("in=%s: got error %v, wantErr=%v", tc.in, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("in=%s: result mismatch, got=%+v, want=%+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRegressionChecker(t *testing.T) {
+	baseline := writeTestFile(t, "# linuxprocsmapstocsv schema_version=1 tool_version=test\n"+
+		"AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Pss\n"+
+		"55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/app,100\n"+
+		"55e000,580000,rw-p,00000000,00:00,0,[heap],1000\n"+
+		"7f0000001000,7f0000002000,r--p,00000000,fe:00,42,/usr/lib/libc.so.6,2000\n")
+	rules := []regressionRule{
+		{scope: regressionScopeTotal, field: "Pss", limit: 10, relative: true},
+		{scope: regressionScopePathname, field: "Pss", limit: 1024},
+	}
+	c, err := newRegressionChecker(baseline, ',', rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/app\nPss: 100 kB\n" +
+		"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nPss: 1500 kB\n" +
+		"7f0000000000-7f0000001000 rw-p 00000000 00:00 0 \nPss: 1200 kB\n" +
+		"7f0000001000-7f0000002000 r--p 00000000 fe:00 42                         /usr/lib/libc.so.6\nPss: 2000 kB\n"
+	if err := convertSmapsToCsv(csv.NewWriter(io.Discard), strings.NewReader(input),
+		args{Separator: ",", regression: c}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := c.check(&buf); err == nil {
+		t.Error("got no error for regressions")
+	}
+	want := "regression: total Pss grew from 3100 kB to 4800 kB (+54.8%), exceeding +10%\n" +
+		"regression: Pss of [anon] grew from 0 kB to 1200 kB (new), exceeding +1024 kB\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+
+	if _, err := newRegressionChecker(baseline, ',', []regressionRule{{scope: regressionScopeTotal, field: "Rss", limit: 1}}); err == nil {
+		t.Error("got no error for a baseline without the field of a rule")
+	}
+}
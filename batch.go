@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hnakamur/linuxprocsmapstocsv/smaps"
+)
+
+// Values of -kernel-threads.
+const (
+	kernelThreadsSkip    = "skip"
+	kernelThreadsInclude = "include"
+)
+
+// parsePidList parses a comma separated list of pids given by -p.
+func parsePidList(s string) ([]int, error) {
+	var pids []int
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		pid, err := strconv.Atoi(f)
+		if err != nil || pid <= 0 {
+			return nil, fmt.Errorf("invalid pid: %q", f)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// resolveInputs sets the source and the input filenames from the pids
+// given by -p, or from the glob pattern given by -i, e.g.
+// "/proc/[0-9]*/smaps", or of all processes with -all-processes. The pids
+// are read from smaps or smaps_rollup depending on -kind. Each converts
+// the inputs in batch into one output with a Pid column.
+func (a *args) resolveInputs() error {
+	switch {
+	case len(a.pids) > 0:
+		a.source = smaps.ProcSource{Root: procRoot, File: a.procKindName()}
+		for _, pid := range a.pids {
+			a.inputFilenames = append(a.inputFilenames, procPath(pid, a.procKindName()))
+		}
+	case a.allProcesses || strings.ContainsAny(a.inputFilename, "*?["):
+		if a.allProcesses {
+			a.inputFilename = filepath.Join(procRoot, "[0-9]*", a.procKindName())
+			a.source = smaps.ProcSource{Root: procRoot, File: a.procKindName()}
+		} else {
+			a.source = smaps.FileSource{Pattern: a.inputFilename}
+		}
+		names, err := a.source.List()
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("no input files match %s", a.inputFilename)
+		}
+		sortInputFilenames(names)
+		a.inputFilenames = names
+	default:
+		return nil
+	}
+	a.batch = true
+	a.inputFilename = a.inputFilenames[0]
+	return nil
+}
+
+// sortInputFilenames sorts the input filenames by their pids.
+func sortInputFilenames(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		return pidFromInputPath(names[i]) < pidFromInputPath(names[j]) ||
+			pidFromInputPath(names[i]) == pidFromInputPath(names[j]) && names[i] < names[j]
+	})
+}
+
+// inputSource is an opened input of a run with the options prepared for
+// its process.
+type inputSource struct {
+	file     io.ReadCloser
+	args     args
+	archiver *rawArchiver
+	// checkpoint saves the input into the checkpoint of -checkpoint.
+	checkpoint *rawArchiver
+	// saved is true if the input is read from the checkpoint of a
+	// resumed run instead of its process.
+	saved bool
+}
+
+// openInput opens the input filename from the source of the inputs, or
+// the standard input if it is "-", and prepares the options which depend
+// on its process. An input saved in the checkpoint of a resumed run is
+// read from it instead.
+func openInput(args args, filename string) (*inputSource, error) {
+	if args.batch {
+		args.inputFilename = filename
+		if err := args.prepareInput(); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	var file io.ReadCloser = os.Stdin
+	var saved bool
+	if args.checkpoint != nil {
+		f, err := args.checkpoint.open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s: read checkpoint: %w", filename, err)
+		}
+		if saved = f != nil; saved {
+			file = f
+		}
+	}
+	var err error
+	if !saved && filename != stdioName {
+		source := args.source
+		if source == nil {
+			source = smaps.FileSource{}
+		}
+		var failures int
+		failures, err = args.retry.do(isTransientProcessError, func() error {
+			file, err = source.Open(filename)
+			return err
+		})
+		if args.stats != nil {
+			args.stats.addSource(filename, failures, err)
+		}
+		if err != nil {
+			return nil, diagnoseOpenError(filename, err)
+		}
+	}
+	src := &inputSource{file: file, args: args, saved: saved}
+	if args.checkpoint != nil && !saved {
+		src.checkpoint, err = args.checkpoint.archiver(filename)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if args.keepRawDir != "" {
+		src.archiver, err = newRawArchiver(args.keepRawDir, filename)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return src, nil
+}
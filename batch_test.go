@@ -0,0 +1,300 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParsePidList(t *testing.T) {
+	got, err := parsePidList("1234, 1235,1236")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1234, 1235, 1236}; !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch, got=%v, want=%v", got, want)
+	}
+	for _, s := range []string{"", "1234,", "abc", "-1"} {
+		if _, err := parsePidList(s); err == nil {
+			t.Errorf("%q: error expected", s)
+		}
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	for _, pid := range []string{"10", "9"} {
+		if err := os.MkdirAll(filepath.Join(procRoot, pid), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(procRoot, pid, "smaps"), []byte(testSmapsSorted), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name         string
+		pids         []int
+		input        string
+		sortOrder    string
+		wantInputs   int
+		wantWarnings int
+	}{
+		{name: "pids", pids: []int{9, 10, 11}, wantInputs: 3, wantWarnings: 1},
+		// The rows of equal addresses are sorted by PID.
+		{name: "sort addresses", pids: []int{10, 9}, sortOrder: sortByAddresses, wantInputs: 2},
+		{name: "glob", input: filepath.Join(procRoot, "[0-9]*", "smaps"), wantInputs: 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			var a args
+			a.registerFlags(fs)
+			if err := fs.Parse([]string{"-fields-file", writeTestFile(t, "Rss\n")}); err != nil {
+				t.Fatal(err)
+			}
+			a.pids = tc.pids
+			a.inputFilename = tc.input
+			a.sortOrder = tc.sortOrder
+			a.outputFilename = filepath.Join(t.TempDir(), "out.csv")
+			if err := a.resolveInputs(); err != nil {
+				t.Fatal(err)
+			}
+			if len(a.inputFilenames) != tc.wantInputs {
+				t.Fatalf("input count mismatch, got=%d, want=%d", len(a.inputFilenames), tc.wantInputs)
+			}
+			a.stats = &runStats{}
+			if err := run(a); err != nil {
+				t.Fatal(err)
+			}
+			if got := a.stats.warnings; got != tc.wantWarnings {
+				t.Errorf("warning count mismatch, got=%d, want=%d", got, tc.wantWarnings)
+			}
+			got, err := os.ReadFile(a.outputFilename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "Pid,AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Rss\n" +
+				"9,55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4\n" +
+				"9,55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat,0\n" +
+				"10,55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4\n" +
+				"10,55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat,0\n"
+			if string(got) != want {
+				t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+			}
+		})
+	}
+}
+
+func TestRunBatchKernelThreads(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	for pid, smaps := range map[string]string{"2": "", "10": testSmapsSorted} {
+		if err := os.MkdirAll(filepath.Join(procRoot, pid), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(procRoot, pid, "smaps"), []byte(smaps), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		kernelThreads string
+		want          string
+	}{
+		{
+			kernelThreads: kernelThreadsSkip,
+			want: "Pid,AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Rss\n" +
+				"10,55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4\n" +
+				"10,55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat,0\n",
+		},
+		{
+			kernelThreads: kernelThreadsInclude,
+			want: "Pid,AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Rss\n" +
+				"2,,,,,,,,0\n" +
+				"10,55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4\n" +
+				"10,55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat,0\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.kernelThreads, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			var a args
+			a.registerFlags(fs)
+			if err := fs.Parse([]string{"-fields-file", writeTestFile(t, "Rss\n")}); err != nil {
+				t.Fatal(err)
+			}
+			a.pids = []int{2, 10}
+			a.kernelThreads = tc.kernelThreads
+			a.outputFilename = filepath.Join(t.TempDir(), "out.csv")
+			if err := a.resolveInputs(); err != nil {
+				t.Fatal(err)
+			}
+			a.stats = &runStats{}
+			if err := run(a); err != nil {
+				t.Fatal(err)
+			}
+			if a.stats.kernelThreads != 1 {
+				t.Errorf("kernel thread count mismatch, got=%d, want=1", a.stats.kernelThreads)
+			}
+			got, err := os.ReadFile(a.outputFilename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRunBatchSourceColumns(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	for _, pid := range []string{"10", "9"} {
+		if err := os.MkdirAll(filepath.Join(procRoot, pid), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(procRoot, pid, "smaps"), []byte(testSmapsSorted), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-source-columns", "-fields-file", writeTestFile(t, "Rss\n")}); err != nil {
+		t.Fatal(err)
+	}
+	a.inputFilename = filepath.Join(procRoot, "[0-9]*", "smaps")
+	a.outputFilename = filepath.Join(t.TempDir(), "out.csv")
+	if err := a.resolveInputs(); err != nil {
+		t.Fatal(err)
+	}
+	a.stats = &runStats{}
+	if err := run(a); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(a.outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smaps9, smaps10 := filepath.Join(procRoot, "9", "smaps"), filepath.Join(procRoot, "10", "smaps")
+	want := "Pid,AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,SourceFile,SourceLine,Rss\n" +
+		"9,55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat," + smaps9 + ",1,4\n" +
+		"9,55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat," + smaps9 + ",5,0\n" +
+		"10,55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat," + smaps10 + ",1,4\n" +
+		"10,55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat," + smaps10 + ",5,0\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestRunAllProcesses(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	for _, pid := range []string{"10", "9"} {
+		if err := os.MkdirAll(filepath.Join(procRoot, pid), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(procRoot, pid, "smaps"), []byte(testSmapsSorted), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(procRoot, pid, "comm"), []byte("cat"+pid+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files of the system are not processes.
+	if err := os.WriteFile(filepath.Join(procRoot, "meminfo"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-fields-file", writeTestFile(t, "Rss\n")}); err != nil {
+		t.Fatal(err)
+	}
+	a.allProcesses = true
+	a.outputFilename = filepath.Join(t.TempDir(), "out.csv")
+	if err := a.resolveInputs(); err != nil {
+		t.Fatal(err)
+	}
+	a.stats = &runStats{}
+	if err := run(a); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(a.outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Pid,Comm,AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Rss\n" +
+		"9,cat9,55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4\n" +
+		"9,cat9,55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat,0\n" +
+		"10,cat10,55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4\n" +
+		"10,cat10,55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat,0\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+// testMemorySource is a smaps.Source of inputs in memory.
+type testMemorySource map[string]string
+
+func (s testMemorySource) List() ([]string, error) {
+	var names []string
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s testMemorySource) Open(name string) (io.ReadCloser, error) {
+	data, ok := s[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+func TestRunSource(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-fields-file", writeTestFile(t, "Rss\n")}); err != nil {
+		t.Fatal(err)
+	}
+	convert := func(a args) string {
+		t.Helper()
+		a.outputFilename = filepath.Join(t.TempDir(), "out.csv")
+		if err := run(a); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(a.outputFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(got)
+	}
+	fromFile := a
+	fromFile.inputFilename = writeTestFile(t, testSmapsSorted)
+	want := convert(fromFile)
+
+	// The inputs are read through the source instead of the local files.
+	a.source = testMemorySource{"capture:1": testSmapsSorted}
+	a.inputFilename = "capture:1"
+	if got := convert(a); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
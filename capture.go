@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+// captureProcFiles are the files in /proc/<pid> added to a capture bundle
+// in addition to smaps. They are skipped if the kernel lacks them, e.g.
+// numa_maps without CONFIG_NUMA.
+var captureProcFiles = []string{"smaps_rollup", "status", "numa_maps"}
+
+// runCapture runs the capture subcommand, which gathers the memory
+// information of processes into a gzipped tar bundle with the converted
+// CSV files, so that the same set of files is collected in every
+// incident.
+func runCapture(arguments []string) error {
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s capture -p <pids> -o <bundle.tar.gz> [conversion options]\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	var args args
+	pidList := fs.String("p", "", "comma separated pids of the processes to capture")
+	outputFilename := fs.String("o", "", "bundle file to write, a gzipped tar of <pid>/smaps, <pid>/smaps.csv, <pid>/smaps_rollup, <pid>/status, <pid>/numa_maps, meminfo and metadata.json")
+	args.registerFlags(fs)
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if *pidList == "" || *outputFilename == "" {
+		fs.Usage()
+		return errors.New("both flags -p and -o must be set")
+	}
+	if err := args.validate(fs); err != nil {
+		return err
+	}
+	switch {
+	case args.kind != smapsKindSmaps:
+		return errors.New("-kind is not supported by capture, which always captures both smaps and smaps_rollup")
+	case args.keepRawDir != "", args.teeRawPath != "", len(args.sinks) > 0, args.splitsOutput(), args.writeMeta, args.versionMeta == versionMetadataSidecar:
+		return errors.New("-keep-raw, -tee-raw, -sink, -max-rows, -max-size, -meta and -version-metadata sidecar are not supported by capture")
+	}
+	pids, err := parsePidList(*pidList)
+	if err != nil {
+		return err
+	}
+	args.pids = pids
+	if err := args.resolveInputs(); err != nil {
+		return err
+	}
+	if err := args.prepare(); err != nil {
+		return err
+	}
+
+	var captureTime time.Time
+	if !args.reproducible {
+		captureTime = time.Now()
+	}
+	f, err := createOutputFile(*outputFilename, args.outputFileOptions)
+	if err != nil {
+		return err
+	}
+	defer f.abort()
+	b := newCaptureBundle(f, captureTime)
+	for _, pid := range pids {
+		if err := b.addProcess(args, pid); err != nil {
+			return err
+		}
+	}
+	if data, err := os.ReadFile(procSysPath("meminfo")); err != nil {
+		log.Printf("warning: skip meminfo: %v", err)
+	} else if err := b.add("meminfo", data); err != nil {
+		return err
+	}
+	md := newCaptureMetadata(captureTime, pids)
+	if args.anonymizesPaths() {
+		md.anonymize(args.pseudonymizer)
+	}
+	data, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := b.add("metadata.json", append(data, '\n')); err != nil {
+		return err
+	}
+	if err := b.close(); err != nil {
+		return err
+	}
+	if err := f.commit(); err != nil {
+		return err
+	}
+	log.Printf("captured %d processes to %s", len(pids), *outputFilename)
+	return nil
+}
+
+// captureBundle writes the files of a capture to a gzipped tar.
+type captureBundle struct {
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	modTime time.Time
+}
+
+func newCaptureBundle(w io.Writer, captureTime time.Time) *captureBundle {
+	gz := gzip.NewWriter(w)
+	return &captureBundle{gz: gz, tw: tar.NewWriter(gz), modTime: captureTime}
+}
+
+// add adds a file named name with data to the bundle.
+func (b *captureBundle) add(name string, data []byte) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		ModTime:  b.modTime,
+	}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := b.tw.Write(data)
+	return err
+}
+
+// addProcess adds the files of the process pid and its smaps converted
+// with the options of args.
+func (b *captureBundle) addProcess(args args, pid int) error {
+	dir := strconv.Itoa(pid)
+	src, err := openInput(args, procPath(pid, "smaps"))
+	if err != nil {
+		return err
+	}
+	live := &liveProcessReader{r: src.file, pid: pid}
+	raw, err := io.ReadAll(live)
+	src.file.Close()
+	if err != nil {
+		return fmt.Errorf("read %s: %w", procPath(pid, "smaps"), err)
+	}
+	if live.exited {
+		log.Printf("warning: process %d exited while its smaps was read, so the capture may be incomplete", pid)
+	}
+	if err := b.add(path.Join(dir, "smaps"), raw); err != nil {
+		return err
+	}
+
+	for _, name := range captureProcFiles {
+		data, err := os.ReadFile(procPath(pid, name))
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("warning: skip %s: %v", procPath(pid, name), err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := b.add(path.Join(dir, name), data); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	w := args.csvDialect().newWriter(&buf)
+	in := src.args
+	in.anomalies = &anomalyLog{file: procPath(pid, "smaps")}
+	in.captureTime = b.modTime
+	if err := convertSmapsToCsv(w, bytes.NewReader(raw), in); err != nil {
+		return fmt.Errorf("convert %s: %w", procPath(pid, "smaps"), err)
+	}
+	return b.add(path.Join(dir, "smaps.csv"), buf.Bytes())
+}
+
+// close finishes the tar and the gzip stream.
+func (b *captureBundle) close() error {
+	if err := b.tw.Close(); err != nil {
+		return err
+	}
+	return b.gz.Close()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunCapture(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+
+	files := map[string]string{
+		"1234/smaps":        "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nSize: 4 kB\nRss: 4 kB\n",
+		"1234/smaps_rollup": "55d000-7ffd1000 ---p 00000000 00:00 0                          [rollup]\nRss: 4 kB\n",
+		"1234/status":       "Name:\tcat\nVmRSS:\t4 kB\n",
+		"meminfo":           "MemTotal:       16384000 kB\n",
+	}
+	for name, content := range files {
+		filename := filepath.Join(procRoot, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	if err := runCapture([]string{"-p", "1234", "-o", output, "-fields-file", writeTestFile(t, "Rss\n")}); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	got := make(map[string]string)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		got[hdr.Name] = string(data)
+	}
+	wantNames := []string{"1234/smaps", "1234/smaps_rollup", "1234/status", "1234/smaps.csv", "meminfo", "metadata.json"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("bundle entries mismatch, got=%v, want=%v", names, wantNames)
+	}
+	for name, content := range files {
+		if got[name] != content {
+			t.Errorf("%s: content mismatch, got=%q, want=%q", name, got[name], content)
+		}
+	}
+	wantCSV := "Pid,AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Rss\n" +
+		"1234,55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4\n"
+	if got["1234/smaps.csv"] != wantCSV {
+		t.Errorf("smaps.csv mismatch,\n got=%s,\nwant=%s", got["1234/smaps.csv"], wantCSV)
+	}
+}
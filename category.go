@@ -0,0 +1,87 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// Categories of regions in the Category column.
+const (
+	categoryFile       = "file"
+	categoryLib        = "lib"
+	categoryDeleted    = "deleted"
+	categoryDevice     = "device"
+	categoryAnon       = "anon"
+	categoryHeap       = "heap"
+	categoryStack      = "stack"
+	categoryStackGuard = "stack-guard"
+	categoryGuard      = "guard"
+	categoryShm        = "shm"
+	categoryKernel     = "kernel"
+)
+
+// regionCategory returns the category of the region r, which is followed
+// by next in address order, or nil for the last region.
+//
+// Inaccessible private mappings ("---p") are guards, which reserve
+// address space without using memory, so they must not be mistaken for
+// leaks. A guard directly below a writable anonymous mapping is the guard
+// of a thread stack allocated by the C library. The stack guard gap of the
+// main thread is not a mapping on kernels since 4.12, and was a page
+// within [stack] before.
+//
+// Shared memory including memfd is shm regardless of the pathname. Other
+// files are deleted if they are removed or replaced, e.g. libraries of
+// an upgraded package still mapped by a process started before, device
+// files under /dev, libraries if their names have a .so extension with
+// an optional version, and otherwise file.
+func regionCategory(r, next *region) string {
+	pathname := string(r.Pathname)
+	if string(r.Perms) == "---p" {
+		if pathname == "" && next != nil && string(next.AddressStart) == string(r.AddressEnd) &&
+			string(next.Perms) == "rw-p" && len(next.Pathname) == 0 {
+			return categoryStackGuard
+		}
+		return categoryGuard
+	}
+	switch {
+	case pathname == "[heap]":
+		return categoryHeap
+	case pathname == "[stack]" || strings.HasPrefix(pathname, "[stack:"):
+		return categoryStack
+	case pathname == "[vdso]" || pathname == "[vvar]" || pathname == "[vsyscall]" || pathname == "[vectors]":
+		return categoryKernel
+	}
+	if kind, _ := classifyShm(pathname); kind != "" {
+		return categoryShm
+	}
+	if strings.HasPrefix(pathname, "/") {
+		switch {
+		case strings.HasSuffix(pathname, " (deleted)"):
+			return categoryDeleted
+		case strings.HasPrefix(pathname, "/dev/"):
+			return categoryDevice
+		case isSharedLibrary(pathname):
+			return categoryLib
+		}
+		return categoryFile
+	}
+	return categoryAnon
+}
+
+// isSharedLibrary reports whether the file name has a .so extension,
+// which may be followed by a version, e.g. libc.so.6.
+func isSharedLibrary(pathname string) bool {
+	base := path.Base(pathname)
+	i := strings.Index(base, ".so")
+	if i <= 0 {
+		return false
+	}
+	rest := base[i+len(".so"):]
+	return rest == "" || rest[0] == '.'
+}
+
+// isGuardCategory reports whether the category is a guard region.
+func isGuardCategory(category string) bool {
+	return category == categoryGuard || category == categoryStackGuard
+}
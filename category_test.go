@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestConvertCategory(t *testing.T) {
+	// Region lines of anonymous mappings end with a space.
+	input := "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nRss: 4 kB\n" +
+		"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nRss: 12 kB\n" +
+		"7f0000000000-7f0000001000 ---p 00000000 00:00 0 \nRss: 0 kB\n" +
+		"7f0000001000-7f0000801000 rw-p 00000000 00:00 0 \nRss: 16 kB\n" +
+		"7f0000801000-7f0004000000 ---p 00000000 00:00 0 \nRss: 0 kB\n" +
+		"7f0010000000-7f0010001000 rw-s 00000000 00:01 4                          /memfd:pool (deleted)\nRss: 4 kB\n" +
+		"7ffd0000-7ffd1000 rw-p 00000000 00:00 0                          [stack]\nRss: 4 kB\n" +
+		"ffffffffff600000-ffffffffff601000 --xp 00000000 00:00 0                  [vsyscall]\nRss: 0 kB\n" +
+		"7f0020000000-7f0020001000 r-xp 00000000 fe:00 42                         /usr/lib/libc.so.6\nRss: 4 kB\n" +
+		"7f0020001000-7f0020002000 r-xp 00000000 fe:00 43                         /usr/lib/libssl.so.3 (deleted)\nRss: 4 kB\n" +
+		"7f0020002000-7f0020003000 rw-s 00000000 00:05 44                         /dev/dri/card0\nRss: 4 kB\n" +
+		"7f0020003000-7f0020004000 r--p 00000000 fe:00 45                         /usr/share/locale/sonames.txt\nRss: 4 kB\n"
+	stats := &runStats{}
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", categoryColumn: true, fieldNames: []string{"Rss"}, stats: stats}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Category", "file", "heap", "stack-guard", "anon", "guard", "shm", "stack", "kernel", "lib", "deleted", "device", "file"}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("line count mismatch, got=%d, want=%d", len(lines), len(want))
+	}
+	for i, line := range lines {
+		if got := strings.Split(line, ",")[7]; got != want[i] {
+			t.Errorf("line %d: category mismatch, got=%q, want=%q", i+1, got, want[i])
+		}
+	}
+	if got, want := stats.guardRegions, 2; got != want {
+		t.Errorf("guard region count mismatch, got=%d, want=%d", got, want)
+	}
+}
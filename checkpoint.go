@@ -0,0 +1,141 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checkpoint keeps the inputs converted so far by a batch or fleet run in
+// the directory of -checkpoint, in the format of -keep-raw, so that an
+// interrupted run can be continued with -resume without reading them
+// again. The files are removed when the run succeeds.
+type checkpoint struct {
+	dir string
+	// saved are the files of the inputs saved by the interrupted run,
+	// keyed by their sources, i.e. input filenames or hosts.
+	saved map[string]string
+}
+
+// openCheckpoint opens the checkpoint in dir. It is an error if dir has
+// the checkpoint of an interrupted run and resume is false, so that a
+// new run does not mix its inputs with those of another one.
+func openCheckpoint(dir string, resume bool) (*checkpoint, error) {
+	m, err := readRawManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+	if !resume && len(m.Captures) > 0 {
+		return nil, fmt.Errorf("%s has the checkpoint of an interrupted run; continue it with -resume or remove it", dir)
+	}
+	c := &checkpoint{dir: dir, saved: make(map[string]string, len(m.Captures))}
+	for _, capture := range m.Captures {
+		c.saved[capture.Source] = filepath.Join(dir, capture.File)
+	}
+	return c, nil
+}
+
+// inputs returns the filenames of the inputs of the run resumed, the
+// saved ones followed by the others in the order of resolveInputs.
+// The saved inputs are included even if their processes have exited.
+func (c *checkpoint) inputs(filenames []string) []string {
+	seen := make(map[string]bool, len(filenames))
+	var inputs []string
+	for _, filename := range filenames {
+		seen[filename] = true
+		inputs = append(inputs, filename)
+	}
+	for source := range c.saved {
+		if !seen[source] {
+			inputs = append(inputs, source)
+		}
+	}
+	sortInputFilenames(inputs)
+	return inputs
+}
+
+// open opens the saved file of the source, or returns nil if the source
+// is not saved.
+func (c *checkpoint) open(source string) (*os.File, error) {
+	name, ok := c.saved[source]
+	if !ok {
+		return nil, nil
+	}
+	return os.Open(name)
+}
+
+// read returns the saved data of the source, or false if the source is
+// not saved.
+func (c *checkpoint) read(source string) ([]byte, bool, error) {
+	file, err := c.open(source)
+	if file == nil || err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+	r, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// archiver returns the archiver saving the input of the source into the
+// checkpoint.
+func (c *checkpoint) archiver(source string) (*rawArchiver, error) {
+	return newRawArchiver(c.dir, source)
+}
+
+// save saves the data of the source into the checkpoint.
+func (c *checkpoint) save(source string, data []byte, output string) error {
+	a, err := c.archiver(source)
+	if err != nil {
+		return err
+	}
+	if _, err := a.Write(data); err != nil {
+		return err
+	}
+	return a.finish(time.Time{}, output)
+}
+
+// remove removes the files of the checkpoint after the run succeeds, and
+// the directory if nothing else is in it.
+func (c *checkpoint) remove() error {
+	m, err := readRawManifest(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, capture := range m.Captures {
+		if err := os.Remove(filepath.Join(c.dir, capture.File)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Remove(filepath.Join(c.dir, rawManifestFilename)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	os.Remove(c.dir)
+	return nil
+}
+
+// validateCheckpoint checks that -checkpoint is used in batch mode and
+// -resume with -checkpoint.
+func (a *args) validateCheckpoint() error {
+	switch {
+	case a.resume && a.checkpointDir == "":
+		return errors.New("-resume requires -checkpoint")
+	case a.checkpointDir == "":
+		return nil
+	case !a.batch:
+		return errors.New("-checkpoint requires -p, -all-processes or a glob pattern of -i")
+	case a.interval > 0:
+		return errors.New("-checkpoint cannot be used with -interval")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCheckpointResume(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	writeSmaps := func(pid, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(procRoot, pid), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(procRoot, pid, "smaps"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSmaps("9", testSmapsSorted)
+	writeSmaps("10", "bad region\n")
+
+	dir := t.TempDir()
+	checkpointDir := filepath.Join(dir, "checkpoint")
+	newArgs := func(resume bool) args {
+		t.Helper()
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var a args
+		a.registerFlags(fs)
+		if err := fs.Parse([]string{"-fields-file", writeTestFile(t, "Rss\n")}); err != nil {
+			t.Fatal(err)
+		}
+		a.inputFilename = filepath.Join(procRoot, "[0-9]*", "smaps")
+		a.outputFilename = filepath.Join(dir, "out.csv")
+		a.checkpointDir = checkpointDir
+		a.resume = resume
+		if err := a.resolveInputs(); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.validateCheckpoint(); err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+
+	// The run is interrupted by the malformed input of pid 10 after
+	// converting pid 9.
+	if err := run(newArgs(false)); err == nil {
+		t.Fatal("unexpected success with a malformed input")
+	}
+	m, err := readRawManifest(checkpointDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Captures) != 1 || m.Captures[0].Source != filepath.Join(procRoot, "9", "smaps") {
+		t.Fatalf("checkpoint mismatch, got=%+v", m.Captures)
+	}
+
+	if err := run(newArgs(false)); err == nil || !strings.Contains(err.Error(), "-resume") {
+		t.Errorf("unexpected result of a new run with the checkpoint, err=%v", err)
+	}
+
+	// Pid 9 exits, and is converted from the checkpoint.
+	if err := os.RemoveAll(filepath.Join(procRoot, "9")); err != nil {
+		t.Fatal(err)
+	}
+	writeSmaps("10", testSmapsSorted)
+	if err := run(newArgs(true)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "out.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Pid,AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Rss\n" +
+		"9,55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4\n" +
+		"9,55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat,0\n" +
+		"10,55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4\n" +
+		"10,55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat,0\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+	if _, err := os.Stat(checkpointDir); !os.IsNotExist(err) {
+		t.Errorf("checkpoint is not removed, err=%v", err)
+	}
+}
+
+func TestCollectFleetResumable(t *testing.T) {
+	cp, err := openCheckpoint(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.save("web1", []byte("saved\n"), "out.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if cp, err = openCheckpoint(cp.dir, true); err != nil {
+		t.Fatal(err)
+	}
+	// The script is echoed by sh -c, ignoring the host given as $0.
+	outputs, err := collectFleetResumable(cp, []string{"web1", "web2"}, []string{"sh", "-c", "echo collected"}, "", 2, retryPolicy{}, "out.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(outputs[0].data); got != "saved\n" {
+		t.Errorf("output of web1 mismatch, got=%q", got)
+	}
+	if got := string(outputs[1].data); got != "collected\n" {
+		t.Errorf("output of web2 mismatch, got=%q", got)
+	}
+	if cp, err = openCheckpoint(cp.dir, true); err != nil {
+		t.Fatal(err)
+	}
+	data, ok, err := cp.read("web2")
+	if err != nil || !ok || string(data) != "collected\n" {
+		t.Errorf("checkpoint of web2 mismatch, got=%q, %v, %v", data, ok, err)
+	}
+}
+
+func TestValidateCheckpoint(t *testing.T) {
+	testCases := []struct {
+		a       args
+		wantErr bool
+	}{
+		{a: args{}},
+		{a: args{checkpointDir: "cp", batch: true}},
+		{a: args{resume: true}, wantErr: true},
+		{a: args{checkpointDir: "cp"}, wantErr: true},
+		{a: args{checkpointDir: "cp", batch: true, interval: 1}, wantErr: true},
+	}
+	for i, tc := range testCases {
+		if err := tc.a.validateCheckpoint(); (err != nil) != tc.wantErr {
+			t.Errorf("case %d: err=%v, wantErr=%v", i, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Actions of -column-rule.
+const (
+	columnRuleDrop     = "drop"
+	columnRuleHash     = "hash"
+	columnRuleTruncate = "truncate"
+	columnRuleBucket   = "bucket"
+)
+
+// columnRule is a transformation of the values of a column given by
+// -column-rule as Column:action[:argument].
+type columnRule struct {
+	column string
+	action string
+	// length is the number of characters kept by truncate.
+	length int
+	// size is the size of the buckets of bucket, which are powers of two
+	// if it is zero.
+	size float64
+}
+
+func parseColumnRule(s string) (columnRule, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || parts[0] == "" {
+		return columnRule{}, fmt.Errorf("column rule must be in the form Column:action[:argument]: %q", s)
+	}
+	r := columnRule{column: parts[0], action: parts[1]}
+	switch {
+	case (r.action == columnRuleDrop || r.action == columnRuleHash) && len(parts) == 2:
+	case r.action == columnRuleTruncate && len(parts) == 3:
+		n, err := strconv.Atoi(parts[2])
+		if err != nil || n <= 0 {
+			return columnRule{}, fmt.Errorf("length of truncate must be a positive integer: %q", s)
+		}
+		r.length = n
+	case r.action == columnRuleBucket && len(parts) == 2:
+	case r.action == columnRuleBucket && len(parts) == 3:
+		size, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || !(size > 0) || math.IsInf(size, 1) {
+			return columnRule{}, fmt.Errorf("size of bucket must be a positive number: %q", s)
+		}
+		r.size = size
+	default:
+		return columnRule{}, fmt.Errorf("column rule must be Column:drop, Column:hash, Column:truncate:<length> or Column:bucket[:<size>]: %q", s)
+	}
+	return r, nil
+}
+
+// apply returns the value v of the column transformed by r. Empty values
+// are kept, as are values of bucket which are not numbers, e.g. NULL of
+// -null-as.
+func (r columnRule) apply(v string) string {
+	if v == "" {
+		return v
+	}
+	switch r.action {
+	case columnRuleHash:
+		return hashComponent(v)
+	case columnRuleTruncate:
+		n := 0
+		for i := range v {
+			if n == r.length {
+				return v[:i]
+			}
+			n++
+		}
+		return v
+	case columnRuleBucket:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f == 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+			return v
+		}
+		b := math.Abs(f)
+		if r.size > 0 {
+			b = math.Floor(b/r.size) * r.size
+		} else {
+			b = math.Exp2(math.Floor(math.Log2(b)))
+		}
+		return strconv.FormatFloat(math.Copysign(b, f), 'f', -1, 64)
+	}
+	return v
+}
+
+// validateColumnRules parses the rules of -column-rule.
+func (a *args) validateColumnRules() error {
+	seen := make(map[string]bool)
+	for _, s := range a.columnRuleSpecs {
+		r, err := parseColumnRule(s)
+		if err != nil {
+			return err
+		}
+		if seen[r.column] {
+			return fmt.Errorf("column %s has more than one -column-rule", r.column)
+		}
+		seen[r.column] = true
+		if r.action == columnRuleBucket && (a.decimalSep != "." || a.thousandsSep != "") {
+			return errors.New("-column-rule bucket requires numbers with a '.' decimal separator and no thousands separator")
+		}
+		a.columnRules = append(a.columnRules, r)
+	}
+	return nil
+}
+
+// columnTransform applies the column rules to the records of a header.
+type columnTransform struct {
+	// rules are the rules of the columns by their indexes, nil for
+	// columns without rules.
+	rules []*columnRule
+	// keep are the indexes of the columns which are not dropped, or nil
+	// if none are.
+	keep []int
+}
+
+// newColumnTransform returns the transform of rules for the records of
+// header, failing for columns which are not in it.
+func newColumnTransform(header []string, rules []columnRule) (*columnTransform, error) {
+	t := &columnTransform{rules: make([]*columnRule, len(header))}
+	dropped := make([]bool, len(header))
+	for i := range rules {
+		r := &rules[i]
+		j := indexOf(header, r.column)
+		if j < 0 {
+			return nil, fmt.Errorf("unknown column %s in -column-rule, the columns are %s", r.column, strings.Join(header, ","))
+		}
+		if r.action == columnRuleDrop {
+			dropped[j] = true
+		} else {
+			t.rules[j] = r
+		}
+	}
+	for i := range header {
+		if !dropped[i] {
+			t.keep = append(t.keep, i)
+		}
+	}
+	if len(t.keep) == 0 {
+		return nil, errors.New("-column-rule drops all columns")
+	}
+	if len(t.keep) == len(header) {
+		t.keep = nil
+	}
+	return t, nil
+}
+
+// header returns header without the dropped columns.
+func (t *columnTransform) header(header []string) []string {
+	if t.keep == nil {
+		return header
+	}
+	return selectColumns(header, t.keep)
+}
+
+// columnTypes returns the types of the columns of the transformed
+// records, where hashed and truncated columns are strings.
+func (t *columnTransform) columnTypes(types []columnType) []columnType {
+	types = append([]columnType(nil), types...)
+	for i, r := range t.rules {
+		if r != nil && r.action != columnRuleBucket {
+			types[i].Type, types[i].Unit = columnTypeString, ""
+		}
+	}
+	if t.keep == nil {
+		return types
+	}
+	return selectColumnTypes(types, t.keep)
+}
+
+// apply transforms record, whose values are changed in place.
+func (t *columnTransform) apply(record []string) []string {
+	for i, r := range t.rules {
+		if r != nil {
+			record[i] = r.apply(record[i])
+		}
+	}
+	if t.keep == nil {
+		return record
+	}
+	return selectColumns(record, t.keep)
+}
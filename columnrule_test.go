@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseColumnRule(t *testing.T) {
+	for _, s := range []string{"Pathname:drop", "Pathname:hash", "Comm:truncate:4", "Rss:bucket", "Rss:bucket:1024"} {
+		if _, err := parseColumnRule(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	for _, s := range []string{"Pathname", ":drop", "Pathname:hash:1", "Comm:truncate", "Comm:truncate:0", "Rss:bucket:-1", "Rss:round"} {
+		if _, err := parseColumnRule(s); err == nil {
+			t.Errorf("%s: got no error", s)
+		}
+	}
+}
+
+func TestColumnRuleApply(t *testing.T) {
+	for _, tc := range []struct {
+		rule  string
+		value string
+		want  string
+	}{
+		{rule: "Comm:truncate:3", value: "nginx", want: "ngi"},
+		{rule: "Comm:truncate:3", value: "né", want: "né"},
+		{rule: "Comm:truncate:2", value: "日本語", want: "日本"},
+		{rule: "Rss:bucket", value: "1000", want: "512"},
+		{rule: "Rss:bucket", value: "1024", want: "1024"},
+		{rule: "Rss:bucket", value: "0.3", want: "0.25"},
+		{rule: "Rss:bucket", value: "-100", want: "-64"},
+		{rule: "Rss:bucket", value: "0", want: "0"},
+		{rule: "Rss:bucket", value: "NULL", want: "NULL"},
+		{rule: "Rss:bucket:1024", value: "3000", want: "2048"},
+		{rule: "Rss:bucket:1024", value: "1000", want: "0"},
+		{rule: "Pathname:hash", value: "", want: ""},
+	} {
+		r, err := parseColumnRule(tc.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.apply(tc.value); got != tc.want {
+			t.Errorf("%s of %q = %q, want %q", tc.rule, tc.value, got, tc.want)
+		}
+	}
+	r, _ := parseColumnRule("Pathname:hash")
+	if got1, got2 := r.apply("/usr/bin/cat"), r.apply("/usr/bin/cat"); got1 != got2 || got1 == "/usr/bin/cat" {
+		t.Errorf("hashes of the same value are %q and %q", got1, got2)
+	}
+}
+
+func TestConvertColumnRules(t *testing.T) {
+	dir := t.TempDir()
+	a := args{
+		floatFormat:       defaultFloatFormat,
+		Separator:         ",",
+		units:             unitsKB,
+		decimalSep:        ".",
+		columns:           []string{"Pathname", "Perms", "Rss"},
+		columnRuleSpecs:   stringListFlag{"Perms:drop", "Pathname:hash", "Rss:bucket"},
+		outputFileOptions: outputFileOptions{atomic: true},
+		sinks:             []sinkSpec{{format: sinkFormatCSV, address: filepath.Join(dir, "sink.csv")}},
+	}
+	if err := a.validateColumnRules(); err != nil {
+		t.Fatal(err)
+	}
+	w, err := createOutputs(a, filepath.Join(dir, "out.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Abort()
+	input := "55d000-55e000 r--p 00000000 fe:00 1234 /usr/bin/cat\nRss: 12 kB\n" +
+		"7ffd0000-7ffd1000 rw-p 00000000 00:00 0 [stack]\nRss: 4 kB\n"
+	if err := convertSmapsToCsv(w, strings.NewReader(input), a); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := "Pathname,Rss\n" + hashComponent("/usr/bin/cat") + ",8\n" + hashComponent("[stack]") + ",4\n"
+	for _, name := range []string{"out.csv", "sink.csv"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); got != want {
+			t.Errorf("%s: result mismatch,\n got=%s,\nwant=%s", name, got, want)
+		}
+	}
+}
+
+func TestValidateColumnRules(t *testing.T) {
+	for _, a := range []args{
+		{decimalSep: ".", columnRuleSpecs: stringListFlag{"Rss:bucket", "Rss:hash"}},
+		{decimalSep: ",", columnRuleSpecs: stringListFlag{"Rss:bucket"}},
+		{decimalSep: ".", columnRuleSpecs: stringListFlag{"Rss"}},
+	} {
+		if err := a.validateColumnRules(); err == nil {
+			t.Errorf("%q: got no error", a.columnRuleSpecs)
+		}
+	}
+	if _, err := newColumnTransform([]string{"Pathname"}, []columnRule{{column: "Rss", action: columnRuleHash}}); err == nil {
+		t.Error("want an error for an unknown column")
+	}
+	if _, err := newColumnTransform([]string{"Pathname"}, []columnRule{{column: "Pathname", action: columnRuleDrop}}); err == nil {
+		t.Error("want an error for dropping all columns")
+	}
+}
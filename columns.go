@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseColumnList parses the comma separated column names of -columns.
+func parseColumnList(s string) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("empty column name in -columns: %q", s)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate column %s in -columns", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// columnIndexes returns the indexes of names in header.
+func columnIndexes(header, names []string) ([]int, error) {
+	indexes := make([]int, len(names))
+	for i, name := range names {
+		indexes[i] = -1
+		for j, h := range header {
+			if h == name {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] == -1 {
+			return nil, fmt.Errorf("unknown column %s in -columns, the columns are %s", name, strings.Join(header, ","))
+		}
+	}
+	return indexes, nil
+}
+
+// selectColumns returns the values of record at indexes.
+func selectColumns(record []string, indexes []int) []string {
+	selected := make([]string, len(indexes))
+	for i, j := range indexes {
+		selected[i] = record[j]
+	}
+	return selected
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestConvertColumns(t *testing.T) {
+	input := "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nRss: 4 kB\nPss: 2 kB\nSwap: 0 kB\n" +
+		"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nRss: 12 kB\nPss: 12 kB\nSwap: 4 kB\n"
+	columns, err := parseColumnList("Rss, Pss,Swap,Pathname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", columns: columns}); err != nil {
+		t.Fatal(err)
+	}
+	want := "Rss,Pss,Swap,Pathname\n" +
+		"4,2,0,/usr/bin/cat\n" +
+		"12,12,4,[heap]\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+
+	err = convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input), args{Separator: ",", columns: []string{"Rss", "Uss"}})
+	if err == nil || !strings.Contains(err.Error(), "unknown column Uss") {
+		t.Errorf("got error %v for an unknown column", err)
+	}
+}
+
+func TestParseColumnList(t *testing.T) {
+	for _, s := range []string{"", "Rss,,Pss", "Rss,Rss"} {
+		if _, err := parseColumnList(s); err == nil {
+			t.Errorf("%q: error expected", s)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// runCompare runs the compare subcommand, which writes a wide table of
+// the Pss of each pathname in several processes or captures, e.g. canary
+// and baseline instances of a service.
+func runCompare(arguments []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s compare [-o <file>] [-top <n>] <pid|capture file>...\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	outputFilename := fs.String("o", stdioName, "output CSV filename, or \"-\" for the standard output")
+	top := fs.Int("top", 0, "write only the pathnames with the n largest differences (default: all)")
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("at least two pids or capture files must be given")
+	}
+
+	c := newPssComparison(fs.Args())
+	for i, source := range fs.Args() {
+		if err := c.read(i, source); err != nil {
+			return err
+		}
+	}
+	data, err := c.csv(*top)
+	if err != nil {
+		return err
+	}
+	return writeOutputFile(*outputFilename, data, outputFileOptions{})
+}
+
+// pssComparison sums the Pss of each pathname in sources.
+type pssComparison struct {
+	sources   []string
+	pathnames []string
+	sums      map[string][]float64
+}
+
+func newPssComparison(sources []string) *pssComparison {
+	return &pssComparison{sources: sources, sums: make(map[string][]float64)}
+}
+
+// read adds the Pss of the mappings of the i-th source, which is a pid
+// of a live process or a capture file.
+func (c *pssComparison) read(i int, source string) error {
+	return readSource(source, func(m *mapping) error {
+		c.add(i, m)
+		return nil
+	})
+}
+
+// readSource reads the mappings of source, which is a pid of a live
+// process or a capture file.
+func readSource(source string, fn func(m *mapping) error) error {
+	var r io.Reader
+	if pid, err := strconv.Atoi(source); err == nil && pid > 0 {
+		file, err := os.Open(procPath(pid, "smaps"))
+		if err != nil {
+			return diagnoseOpenError(procPath(pid, "smaps"), err)
+		}
+		defer file.Close()
+		r = &liveProcessReader{r: file, pid: pid}
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	if err := readMappings(r, fn); err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	return nil
+}
+
+func (c *pssComparison) add(i int, m *mapping) {
+	pss, ok := m.numericFieldValue("Pss")
+	if !ok {
+		return
+	}
+	pathname := string(m.Region.Pathname)
+	if pathname == "" {
+		pathname = "[anon]"
+	}
+	sums := c.sums[pathname]
+	if sums == nil {
+		sums = make([]float64, len(c.sources))
+		c.sums[pathname] = sums
+		c.pathnames = append(c.pathnames, pathname)
+	}
+	sums[i] += pss
+}
+
+// csv returns the table with a column of the Pss in kB for each source
+// and the difference between the largest and the smallest Pss, sorted by
+// the difference in descending order. If top is positive, only the top
+// rows are returned.
+func (c *pssComparison) csv(top int) ([]byte, error) {
+	diffs := make(map[string]float64, len(c.pathnames))
+	for _, pathname := range c.pathnames {
+		sums := c.sums[pathname]
+		min, max := sums[0], sums[0]
+		for _, v := range sums[1:] {
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		diffs[pathname] = max - min
+	}
+	pathnames := append([]string(nil), c.pathnames...)
+	sort.SliceStable(pathnames, func(i, j int) bool {
+		if diffs[pathnames[i]] != diffs[pathnames[j]] {
+			return diffs[pathnames[i]] > diffs[pathnames[j]]
+		}
+		return pathnames[i] < pathnames[j]
+	})
+	if top > 0 && len(pathnames) > top {
+		pathnames = pathnames[:top]
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := append(append([]string{"Pathname"}, c.sources...), "Diff")
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, pathname := range pathnames {
+		record := []string{pathname}
+		for _, v := range c.sums[pathname] {
+			record = append(record, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		record = append(record, strconv.FormatFloat(diffs[pathname], 'f', -1, 64))
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
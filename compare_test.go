@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunCompare(t *testing.T) {
+	dir := t.TempDir()
+	baseline := filepath.Join(dir, "baseline.smaps")
+	canary := filepath.Join(dir, "canary.smaps")
+	if err := os.WriteFile(baseline, []byte(
+		"55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/app\nPss: 4 kB\n"+
+			"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nPss: 100 kB\n"+
+			"7f0000000000-7f0000001000 rw-p 00000000 00:00 0 \nPss: 8 kB\n"+
+			"7f0000001000-7f0000002000 r--p 00000000 fe:00 42                         /usr/lib/libc.so.6\nPss: 20 kB\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(canary, []byte(
+		"55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/app\nPss: 4 kB\n"+
+			"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nPss: 250 kB\n"+
+			"7f0000000000-7f0000001000 rw-p 00000000 00:00 0 \nPss: 4 kB\n"+
+			"7f0000001000-7f0000002000 rw-p 00000000 00:00 0 \nPss: 4 kB\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "compare.csv")
+	if err := runCompare([]string{"-o", output, "-top", "3", baseline, canary}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Pathname," + baseline + "," + canary + ",Diff\n" +
+		"[heap],100,250,150\n" +
+		"/usr/lib/libc.so.6,20,0,20\n" +
+		"/usr/bin/app,4,4,0\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressions of the output given by -compress.
+const (
+	compressNone = "none"
+	compressGzip = "gzip"
+	compressZstd = "zstd"
+)
+
+// Magic numbers at the start of compressed inputs.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressionOf returns the compression implied by the extension of the
+// output filename.
+func compressionOf(filename string) string {
+	switch {
+	case strings.HasSuffix(filename, ".gz"):
+		return compressGzip
+	case strings.HasSuffix(filename, ".zst"):
+		return compressZstd
+	}
+	return compressNone
+}
+
+// validateCompress resolves -compress from the extension of the output
+// filename if it is not set, and checks that the output can be
+// compressed.
+func (a *args) validateCompress() error {
+	if a.compress == "" {
+		a.compress = compressionOf(a.outputFilename)
+	}
+	switch a.compress {
+	case compressNone:
+		return nil
+	case compressGzip, compressZstd:
+	default:
+		return fmt.Errorf("unsupported -compress: %q", a.compress)
+	}
+	if a.format != "" && a.format != outputFormatCSV {
+		return fmt.Errorf("-compress %s cannot be used with -format %s", a.compress, a.format)
+	}
+	if a.splitsOutput() {
+		return fmt.Errorf("-compress %s cannot be used with -max-rows or -max-size", a.compress)
+	}
+	return nil
+}
+
+// newCompressWriter returns the writer compressing the data written to w
+// with compress, gzip or zstd.
+func newCompressWriter(compress string, w io.Writer) (io.WriteCloser, error) {
+	if compress == compressZstd {
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return zw, nil
+	}
+	return gzip.NewWriter(w), nil
+}
+
+// decompressReader returns the reader of the decompressed data of r if it
+// starts with the magic number of gzip or zstd, and r otherwise, so
+// compressed inputs are read regardless of their filenames.
+func decompressReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		// The stream is decoded in the calling goroutine, so that the
+		// decoder needs no Close.
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr, nil
+	}
+	return br, nil
+}
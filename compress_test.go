@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunGzip(t *testing.T) {
+	dir := t.TempDir()
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write([]byte(testTotalsInput)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	inputFilename := filepath.Join(dir, "smaps.gz")
+	if err := os.WriteFile(inputFilename, compressed.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-columns", "Pathname,Rss"}); err != nil {
+		t.Fatal(err)
+	}
+	a.inputFilename = inputFilename
+	a.outputFilename = filepath.Join(dir, "out.csv.gz")
+	if err := a.validate(fs); err != nil {
+		t.Fatal(err)
+	}
+	if a.compress != compressGzip {
+		t.Fatalf("compress mismatch, got=%q, want=%q", a.compress, compressGzip)
+	}
+	if err := run(a); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(a.outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Pathname,Rss\n/usr/bin/cat,4\n[heap],12\n/usr/lib/libc.so.6,32\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestValidateCompress(t *testing.T) {
+	testCases := []struct {
+		args    args
+		want    string
+		wantErr string
+	}{
+		{args: args{outputFilename: "out.csv"}, want: compressNone},
+		{args: args{outputFilename: stdioName, compress: compressGzip}, want: compressGzip},
+		{args: args{outputFilename: "out.csv.gz", compress: compressNone}, want: compressNone},
+		{args: args{outputFilename: "out.csv.zst"}, want: compressZstd},
+		{args: args{outputFilename: "out.csv", compress: "xz"}, wantErr: `unsupported -compress: "xz"`},
+		{args: args{outputFilename: "out.json.gz", format: outputFormatJSON}, wantErr: "-compress gzip cannot be used with -format json"},
+		{args: args{outputFilename: "out.csv.gz", maxRows: 10}, wantErr: "-compress gzip cannot be used with -max-rows or -max-size"},
+	}
+	for _, tc := range testCases {
+		a := tc.args
+		err := a.validateCompress()
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("error mismatch for %s, got=%v, want=%s", tc.args.outputFilename, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", tc.args.outputFilename, err)
+		} else if a.compress != tc.want {
+			t.Errorf("compress mismatch for %s, got=%q, want=%q", tc.args.outputFilename, a.compress, tc.want)
+		}
+	}
+}
+
+func TestDecompressReader(t *testing.T) {
+	r, err := decompressReader(strings.NewReader("plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "plain" {
+		t.Errorf("result mismatch, got=%q, want=%q", got, "plain")
+	}
+	for _, compress := range []string{compressGzip, compressZstd} {
+		var buf bytes.Buffer
+		zw, err := newCompressWriter(compress, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := zw.Write([]byte(testTotalsInput)); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := decompressReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := io.ReadAll(r); err != nil || string(got) != testTotalsInput {
+			t.Errorf("%s: result mismatch, got=%q, err=%v", compress, got, err)
+		}
+	}
+}
+
+func TestRunZstd(t *testing.T) {
+	dir := t.TempDir()
+	var compressed bytes.Buffer
+	zw, err := newCompressWriter(compressZstd, &compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write([]byte(testTotalsInput)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	inputFilename := filepath.Join(dir, "smaps.zst")
+	if err := os.WriteFile(inputFilename, compressed.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-columns", "Pathname,Rss"}); err != nil {
+		t.Fatal(err)
+	}
+	a.inputFilename = inputFilename
+	a.outputFilename = filepath.Join(dir, "out.csv.zst")
+	if err := a.validate(fs); err != nil {
+		t.Fatal(err)
+	}
+	if a.compress != compressZstd {
+		t.Fatalf("compress mismatch, got=%q, want=%q", a.compress, compressZstd)
+	}
+	if err := run(a); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(a.outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := decompressReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Pathname,Rss\n/usr/bin/cat,4\n[heap],12\n/usr/lib/libc.so.6,32\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
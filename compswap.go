@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sysRoot is the mount point of the sysfs to read the compressed swap
+// statistics from.
+var sysRoot = "/sys"
+
+// compressedSwapBackend is the statistics of a compressed swap backend,
+// zswap or a zram device, in bytes.
+type compressedSwapBackend struct {
+	name string
+	// orig is the size of the swapped pages and stored is the memory
+	// used to store them compressed.
+	orig, stored int64
+}
+
+// readCompressedSwapBackends reads the statistics of zswap from
+// /sys/kernel/debug/zswap, which requires root, and of the zram devices
+// from /sys/block/zram*/mm_stat. Backends which are not enabled are
+// skipped.
+func readCompressedSwapBackends() ([]compressedSwapBackend, error) {
+	var backends []compressedSwapBackend
+	dir := filepath.Join(sysRoot, "kernel", "debug", "zswap")
+	storedPages, err1 := readSysInt(filepath.Join(dir, "stored_pages"))
+	poolSize, err2 := readSysInt(filepath.Join(dir, "pool_total_size"))
+	if err1 == nil && err2 == nil && storedPages > 0 {
+		backends = append(backends, compressedSwapBackend{
+			name:   "zswap",
+			orig:   storedPages * int64(os.Getpagesize()),
+			stored: poolSize,
+		})
+	}
+	names, err := filepath.Glob(filepath.Join(sysRoot, "block", "zram*", "mm_stat"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		b, err := parseZramMmStat(filepath.Base(filepath.Dir(name)), string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if b.orig > 0 {
+			backends = append(backends, b)
+		}
+	}
+	return backends, nil
+}
+
+func readSysInt(filename string) (int64, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// parseZramMmStat parses mm_stat of the zram device name, whose first
+// fields are orig_data_size, compr_data_size and mem_used_total in bytes.
+// The memory used to store the pages is mem_used_total, which includes the
+// allocator overhead.
+func parseZramMmStat(name, s string) (compressedSwapBackend, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return compressedSwapBackend{}, fmt.Errorf("too few fields in mm_stat: %q", s)
+	}
+	orig, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return compressedSwapBackend{}, fmt.Errorf("invalid orig_data_size: %q", fields[0])
+	}
+	stored, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return compressedSwapBackend{}, fmt.Errorf("invalid mem_used_total: %q", fields[2])
+	}
+	return compressedSwapBackend{name: name, orig: orig, stored: stored}, nil
+}
+
+// compressedSwapReport sums Swap and SwapPss of each process across the
+// inputs of a run, to estimate the memory saved by compressing their
+// swapped pages with zswap or zram.
+type compressedSwapReport struct {
+	pids []int
+	sums map[int][2]float64
+}
+
+func newCompressedSwapReport() *compressedSwapReport {
+	return &compressedSwapReport{sums: make(map[int][2]float64)}
+}
+
+// add adds Swap and SwapPss of m to the process pid.
+func (r *compressedSwapReport) add(pid int, m *mapping) {
+	sums, ok := r.sums[pid]
+	if !ok {
+		r.pids = append(r.pids, pid)
+	}
+	swap, _ := m.numericFieldValue("Swap")
+	swapPss, ok := m.numericFieldValue("SwapPss")
+	if !ok {
+		swapPss = swap
+	}
+	sums[0] += swap
+	sums[1] += swapPss
+	r.sums[pid] = sums
+}
+
+// csv returns the report with a row for each process and a total row.
+// The stored size and the savings are estimated in kB from SwapPss with
+// the compression ratio of all backends, assuming that all swapped pages
+// of the processes are in them, and are empty without backends.
+func (r *compressedSwapReport) csv(backends []compressedSwapBackend) ([]byte, error) {
+	var names []string
+	var orig, stored int64
+	for _, b := range backends {
+		names = append(names, b.name)
+		orig += b.orig
+		stored += b.stored
+	}
+	ratio := ""
+	if orig > 0 {
+		ratio = strconv.FormatFloat(float64(stored)/float64(orig), 'f', 4, 64)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := []string{"Pid", "Swap", "SwapPss", "Backends", "CompressionRatio", "EstimatedStored", "EstimatedSavings"}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	row := func(pid string, sums [2]float64) []string {
+		record := []string{pid, formatFloatKB(sums[0]), formatFloatKB(sums[1]), strings.Join(names, " "), ratio, "", ""}
+		if orig > 0 {
+			estimated := sums[1] * float64(stored) / float64(orig)
+			record[5] = formatFloatKB(estimated)
+			record[6] = formatFloatKB(sums[1] - estimated)
+		}
+		return record
+	}
+	var total [2]float64
+	for _, pid := range r.pids {
+		sums := r.sums[pid]
+		total[0] += sums[0]
+		total[1] += sums[1]
+		p := ""
+		if pid != 0 {
+			p = strconv.Itoa(pid)
+		}
+		if err := w.Write(row(p, sums)); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Write(row("[total]", total)); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// formatFloatKB formats a size in kB rounded to an integer.
+func formatFloatKB(v float64) string {
+	return strconv.FormatFloat(v, 'f', 0, 64)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseZramMmStat(t *testing.T) {
+	got, err := parseZramMmStat("zram0", "  4096000   1024000   1200000        0  1300000      100        0       10\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (compressedSwapBackend{name: "zram0", orig: 4096000, stored: 1200000}); got != want {
+		t.Errorf("result mismatch, got=%+v, want=%+v", got, want)
+	}
+	if _, err := parseZramMmStat("zram0", "1 2\n"); err == nil {
+		t.Error("want an error for too few fields")
+	}
+}
+
+func TestReadCompressedSwapBackends(t *testing.T) {
+	orig := sysRoot
+	sysRoot = t.TempDir()
+	defer func() { sysRoot = orig }()
+	files := map[string]string{
+		"kernel/debug/zswap/stored_pages":    "100\n",
+		"kernel/debug/zswap/pool_total_size": strconv.Itoa(25*os.Getpagesize()) + "\n",
+		"block/zram0/mm_stat":                "4096000 1024000 1200000 0 1300000 100 0 10\n",
+		"block/zram1/mm_stat":                "0 0 0 0 0 0 0 0\n",
+	}
+	for name, content := range files {
+		filename := filepath.Join(sysRoot, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := readCompressedSwapBackends()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []compressedSwapBackend{
+		{name: "zswap", orig: 100 * int64(os.Getpagesize()), stored: 25 * int64(os.Getpagesize())},
+		{name: "zram0", orig: 4096000, stored: 1200000},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch, got=%+v, want=%+v", got, want)
+	}
+}
+
+func TestCompressedSwapReportCSV(t *testing.T) {
+	r := newCompressedSwapReport()
+	for _, tc := range []struct {
+		pid   int
+		input string
+	}{
+		{pid: 10, input: "55e000-580000 rw-p 00000000 00:00 0 [heap]\nSwap: 400 kB\nSwapPss: 400 kB\n"},
+		{pid: 10, input: "7f0000000000-7f0000001000 rw-s 00000000 00:01 5 /dev/shm/x\nSwap: 200 kB\nSwapPss: 100 kB\n"},
+		{pid: 20, input: "55e000-580000 rw-p 00000000 00:00 0 [heap]\nSwap: 100 kB\n"},
+	} {
+		if err := readMappings(strings.NewReader(tc.input), func(m *mapping) error {
+			r.add(tc.pid, m)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := r.csv([]compressedSwapBackend{{name: "zram0", orig: 4000, stored: 1000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Pid,Swap,SwapPss,Backends,CompressionRatio,EstimatedStored,EstimatedSavings\n" +
+		"10,600,500,zram0,0.2500,125,375\n" +
+		"20,100,100,zram0,0.2500,25,75\n" +
+		"[total],700,600,zram0,0.2500,150,450\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+
+	got, err = r.csv(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[total],700,600,,,,\n"; !strings.HasSuffix(string(got), want) {
+		t.Errorf("report without backends must have empty estimates, got=%s", got)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Quoting policies of CSV fields given by -quote.
+const (
+	// quoteMinimal quotes the fields containing the separator, quotes or
+	// line breaks, as encoding/csv does.
+	quoteMinimal = "minimal"
+	// quoteAll quotes every field.
+	quoteAll = "all"
+	// quoteNonNumeric quotes every field which is not a number.
+	quoteNonNumeric = "nonnumeric"
+	// quoteEscape quotes no field and escapes the separator, line breaks
+	// and backslashes with a backslash, for tools splitting lines and
+	// fields naively.
+	quoteEscape = "escape"
+)
+
+// csvDialect is the format of the CSV output.
+type csvDialect struct {
+	comma rune
+	crlf  bool
+	quote string
+}
+
+// csvDialect returns the dialect of -sep, -crlf and -quote.
+func (a *args) csvDialect() csvDialect {
+	comma, _ := utf8.DecodeRuneInString(a.Separator)
+	return csvDialect{comma: comma, crlf: a.crlf, quote: a.quote}
+}
+
+// validateCSVDialect checks -quote, and that -no-header, -crlf and
+// -quote are used with the CSV output.
+func (a *args) validateCSVDialect() error {
+	switch a.quote {
+	case "", quoteMinimal, quoteAll, quoteNonNumeric, quoteEscape:
+	default:
+		return fmt.Errorf("unsupported -quote: %q", a.quote)
+	}
+	if (a.noHeader || a.crlf || a.quote != "" && a.quote != quoteMinimal) && a.format != "" && a.format != outputFormatCSV {
+		return fmt.Errorf("-no-header, -crlf and -quote cannot be used with -format %s", a.format)
+	}
+	return nil
+}
+
+// newWriter returns a writer of CSV records to w in the dialect.
+func (d csvDialect) newWriter(w io.Writer) recordWriter {
+	if d.quote == "" || d.quote == quoteMinimal {
+		cw := csv.NewWriter(w)
+		if d.comma != 0 {
+			cw.Comma = d.comma
+		}
+		cw.UseCRLF = d.crlf
+		return cw
+	}
+	comma := d.comma
+	if comma == 0 {
+		comma = ','
+	}
+	return &dialectWriter{w: bufio.NewWriter(w), comma: comma, crlf: d.crlf, quote: d.quote}
+}
+
+// dialectWriter writes CSV records with the quoting policies which
+// encoding/csv does not have.
+type dialectWriter struct {
+	w     *bufio.Writer
+	comma rune
+	crlf  bool
+	quote string
+	err   error
+}
+
+func (w *dialectWriter) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	for i, field := range record {
+		if i > 0 {
+			w.w.WriteRune(w.comma)
+		}
+		switch {
+		case w.quote == quoteEscape:
+			w.writeEscaped(field)
+		case w.quote == quoteNonNumeric && isNumericField(field):
+			w.w.WriteString(field)
+		default:
+			w.w.WriteByte('"')
+			w.w.WriteString(strings.ReplaceAll(field, `"`, `""`))
+			w.w.WriteByte('"')
+		}
+	}
+	if w.crlf {
+		w.w.WriteString("\r\n")
+	} else {
+		w.w.WriteByte('\n')
+	}
+	return nil
+}
+
+func (w *dialectWriter) writeEscaped(field string) {
+	for _, r := range field {
+		switch r {
+		case '\\':
+			w.w.WriteString(`\\`)
+		case '\n':
+			w.w.WriteString(`\n`)
+		case '\r':
+			w.w.WriteString(`\r`)
+		case w.comma:
+			w.w.WriteByte('\\')
+			w.w.WriteRune(r)
+		default:
+			w.w.WriteRune(r)
+		}
+	}
+}
+
+// isNumericField reports whether field is written unquoted by
+// quoteNonNumeric, i.e. it is empty or a number in the default format.
+func isNumericField(field string) bool {
+	if field == "" {
+		return true
+	}
+	_, err := strconv.ParseFloat(field, 64)
+	return err == nil
+}
+
+func (w *dialectWriter) Flush() {
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+}
+
+func (w *dialectWriter) Error() error {
+	return w.err
+}
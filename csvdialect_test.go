@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCSVDialectWriter(t *testing.T) {
+	record := []string{"55d000", "/tmp/a,b\nc \"d\" (deleted)", "4", ""}
+	testCases := []struct {
+		dialect csvDialect
+		want    string
+	}{
+		{dialect: csvDialect{comma: ','}, want: "55d000,\"/tmp/a,b\nc \"\"d\"\" (deleted)\",4,\n"},
+		{dialect: csvDialect{comma: ',', crlf: true}, want: "55d000,\"/tmp/a,b\r\nc \"\"d\"\" (deleted)\",4,\r\n"},
+		{dialect: csvDialect{comma: ',', quote: quoteAll}, want: "\"55d000\",\"/tmp/a,b\nc \"\"d\"\" (deleted)\",\"4\",\"\"\n"},
+		{dialect: csvDialect{comma: ';', quote: quoteNonNumeric, crlf: true}, want: "\"55d000\";\"/tmp/a,b\nc \"\"d\"\" (deleted)\";4;\r\n"},
+		{dialect: csvDialect{comma: ',', quote: quoteEscape}, want: "55d000,/tmp/a\\,b\\nc \"d\" (deleted),4,\n"},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		w := tc.dialect.newWriter(&buf)
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("result mismatch for %+v,\n got=%q,\nwant=%q", tc.dialect, got, tc.want)
+		}
+	}
+}
+
+func TestConvertNoHeader(t *testing.T) {
+	var buf bytes.Buffer
+	a := args{Separator: ",", noHeader: true, columns: []string{"Pathname", "Rss"}, versionMeta: versionMetadataComment}
+	if err := convertSmapsToCsv(a.csvDialect().newWriter(&buf), strings.NewReader(testSmapsSorted), a); err != nil {
+		t.Fatal(err)
+	}
+	want := "/usr/bin/cat,4\n/usr/bin/cat,0\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestValidateCSVDialect(t *testing.T) {
+	testCases := []struct {
+		args    args
+		wantErr string
+	}{
+		{args: args{format: outputFormatCSV, quote: quoteAll, crlf: true, noHeader: true}},
+		{args: args{format: outputFormatJSON, quote: quoteMinimal}},
+		{args: args{quote: "some"}, wantErr: `unsupported -quote: "some"`},
+		{args: args{format: outputFormatNDJSON, noHeader: true}, wantErr: "-no-header, -crlf and -quote cannot be used with -format ndjson"},
+	}
+	for _, tc := range testCases {
+		err := tc.args.validateCSVDialect()
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		} else if err == nil || err.Error() != tc.wantErr {
+			t.Errorf("error mismatch, got=%v, want=%s", err, tc.wantErr)
+		}
+	}
+}
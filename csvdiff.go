@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// runCSVDiff runs the csvdiff subcommand, which is the diff subcommand
+// for the CSV outputs of the tool, e.g. archived from past incidents
+// whose captures are gone. The rows are matched by the Pid, AddressStart
+// and Pathname columns, or by the Pid and Group columns of -group-by.
+func runCSVDiff(arguments []string) error {
+	fs := flag.NewFlagSet("csvdiff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s csvdiff [-fields <fields>] [-all] [-o <file>] <old csv file> <new csv file>\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	fieldList := fs.String("fields", "", "comma separated columns to write the deltas of (default: the kB fields of smaps in both files)")
+	all := fs.Bool("all", false, "write also the rows whose fields are unchanged")
+	outputFilename := fs.String("o", stdioName, "output CSV filename, or \"-\" for the standard output")
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("two CSV files must be given")
+	}
+	var inputs [2]*mergeInput
+	for i, filename := range fs.Args() {
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		r, err := decompressReader(file)
+		if err == nil {
+			inputs[i], err = readMergeInput(r, filename)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	var fields []string
+	if *fieldList != "" {
+		fields = strings.Split(*fieldList, ",")
+		for _, field := range fields {
+			if field == "" {
+				return fmt.Errorf("empty field name in -fields: %q", *fieldList)
+			}
+		}
+	}
+	d, err := newCSVDiff(inputs[0], inputs[1], fields)
+	if err != nil {
+		return err
+	}
+	data, err := d.csv(*all)
+	if err != nil {
+		return err
+	}
+	return writeOutputFile(*outputFilename, data, outputFileOptions{})
+}
+
+// csvDiffRow is a row of a CSV file of the csvdiff subcommand.
+type csvDiffRow struct {
+	// columns are the values of the columns of the output other than the
+	// change and the fields.
+	columns []string
+	values  []float64
+}
+
+// csvDiffFile is the rows of a CSV file by their keys.
+type csvDiffFile struct {
+	keys []string
+	rows map[string]*csvDiffRow
+}
+
+// csvDiff compares the rows of two CSV files.
+type csvDiff struct {
+	// columns are the columns identifying the rows in the output.
+	columns []string
+	// numeric are whether the key columns are compared as numbers in
+	// the output order, i.e. the Pid and AddressStart.
+	numeric       []bool
+	fields        []string
+	before, after *csvDiffFile
+}
+
+// newCSVDiff returns the diff of the files before and after, whose fields
+// are the columns of the kB fields in both other than the page sizes if
+// fields is nil.
+func newCSVDiff(before, after *mergeInput, fields []string) (*csvDiff, error) {
+	var keyColumns []string
+	if hasPid := indexOf(before.header, columnPid) != -1; hasPid != (indexOf(after.header, columnPid) != -1) {
+		return nil, errors.New("only one of the files has the Pid column")
+	} else if hasPid {
+		keyColumns = append(keyColumns, columnPid)
+	}
+	d := &csvDiff{columns: append([]string(nil), keyColumns...)}
+	for range keyColumns {
+		d.numeric = append(d.numeric, true)
+	}
+	switch {
+	case indexOf(before.header, "Group") != -1 && indexOf(after.header, "Group") != -1:
+		keyColumns = append(keyColumns, "Group")
+		d.numeric = append(d.numeric, false)
+		d.columns = append(d.columns, "Group")
+	case indexOf(before.header, "AddressStart") != -1 && indexOf(after.header, "AddressStart") != -1 &&
+		indexOf(before.header, "Pathname") != -1 && indexOf(after.header, "Pathname") != -1:
+		keyColumns = append(keyColumns, "AddressStart", "Pathname")
+		d.numeric = append(d.numeric, true, false)
+		d.columns = append(d.columns, "AddressStart", "AddressEnd", "Perms", "Pathname")
+	default:
+		return nil, errors.New("the files must both have the AddressStart and Pathname columns, or the Group column of -group-by")
+	}
+
+	if fields == nil {
+		for _, name := range after.header {
+			if f, ok := lookupKnownField(name); ok && f.kind == fieldKindKB && !isPageSizeField(name) && indexOf(before.header, name) != -1 {
+				fields = append(fields, name)
+			}
+		}
+		if len(fields) == 0 {
+			return nil, errors.New("the files have no kB fields in common, which can be given by -fields")
+		}
+	}
+	d.fields = fields
+
+	var err error
+	if d.before, err = d.read(before, keyColumns); err != nil {
+		return nil, err
+	}
+	if d.after, err = d.read(after, keyColumns); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// read reads the rows of in by the values of keyColumns.
+func (d *csvDiff) read(in *mergeInput, keyColumns []string) (*csvDiffFile, error) {
+	indexes := func(names []string, optional bool) ([]int, error) {
+		var indexes []int
+		for _, name := range names {
+			i := indexOf(in.header, name)
+			if i == -1 && !optional {
+				return nil, fmt.Errorf("%s has no %s column", in.filename, name)
+			}
+			indexes = append(indexes, i)
+		}
+		return indexes, nil
+	}
+	keyIndexes, _ := indexes(keyColumns, false)
+	// AddressEnd and Perms are written if they are in the file.
+	columnIndexes, _ := indexes(d.columns, true)
+	fieldIndexes, err := indexes(d.fields, false)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &csvDiffFile{rows: make(map[string]*csvDiffRow)}
+	for n, record := range in.rows {
+		key := strings.Join(selectColumns(record, keyIndexes), "\x00")
+		if _, ok := f.rows[key]; ok {
+			return nil, fmt.Errorf("%s: line %d: duplicate row of %s, e.g. of several samples written with -append",
+				in.filename, n+2, strings.Join(keyColumns, ", "))
+		}
+		row := &csvDiffRow{values: make([]float64, len(d.fields))}
+		for _, i := range columnIndexes {
+			v := ""
+			if i != -1 {
+				v = record[i]
+			}
+			row.columns = append(row.columns, v)
+		}
+		for j, i := range fieldIndexes {
+			if record[i] == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(record[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: line %d: value of %s is not a number: %q", in.filename, n+2, d.fields[j], record[i])
+			}
+			row.values[j] = v
+		}
+		f.keys = append(f.keys, key)
+		f.rows[key] = row
+	}
+	return f, nil
+}
+
+// csv returns the rows sorted by the Pid, the address and the pathname,
+// or the group, with the kind of the change, the columns of the new file,
+// or the old file for removed rows, and the delta of each field. Unchanged
+// rows are included only if all is true.
+func (d *csvDiff) csv(all bool) ([]byte, error) {
+	keys := append([]string(nil), d.before.keys...)
+	for _, key := range d.after.keys {
+		if _, ok := d.before.rows[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sortKeys := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		sortKeys[key] = strings.Split(key, "\x00")
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return lessCSVDiffKey(sortKeys[keys[i]], sortKeys[keys[j]], d.numeric)
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := append(append([]string{"Change"}, d.columns...), d.fields...)
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		before, inBefore := d.before.rows[key]
+		after, inAfter := d.after.rows[key]
+		change := diffChanged
+		row := after
+		switch {
+		case !inBefore:
+			change = diffAdded
+			before = &csvDiffRow{values: make([]float64, len(d.fields))}
+		case !inAfter:
+			change = diffRemoved
+			row = before
+			after = &csvDiffRow{values: make([]float64, len(d.fields))}
+		}
+		record := append([]string{change}, row.columns...)
+		changed := false
+		for i := range d.fields {
+			delta := after.values[i] - before.values[i]
+			if delta != 0 {
+				changed = true
+			}
+			record = append(record, strconv.FormatFloat(delta, 'f', -1, 64))
+		}
+		if change == diffChanged && !changed {
+			if !all {
+				continue
+			}
+			record[0] = diffUnchanged
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// lessCSVDiffKey compares the values of the key columns. Those of the
+// numeric columns are compared as hexadecimal numbers, which also orders
+// decimal ones, e.g. the Pid and AddressStart of -addr-format dec, and as
+// text if they are not numbers.
+func lessCSVDiffKey(a, b []string, numeric []bool) bool {
+	for i := range a {
+		if a[i] == b[i] {
+			continue
+		}
+		if numeric[i] {
+			x, errX := strconv.ParseUint(a[i], 16, 64)
+			y, errY := strconv.ParseUint(b[i], 16, 64)
+			if errX == nil && errY == nil {
+				return x < y
+			}
+		}
+		return a[i] < b[i]
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCSVDiff(t *testing.T) {
+	dir := t.TempDir()
+	before := filepath.Join(dir, "before.csv")
+	after := filepath.Join(dir, "after.csv")
+	if err := os.WriteFile(before, []byte(
+		"Pid,AddressStart,AddressEnd,Perms,Pathname,KernelPageSize,Rss,Pss,VmFlags\n"+
+			"10,55d000,55e000,r--p,/usr/bin/app,4,4,4,rd mr\n"+
+			"10,55e000,580000,rw-p,[heap],4,100,100,rd wr\n"+
+			"9,7f0000000000,7f0000001000,rw-p,,4,8,8,rd wr\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(after, []byte(
+		"Pid,AddressStart,AddressEnd,Perms,Pathname,KernelPageSize,Rss,Pss\n"+
+			"10,55d000,55e000,r--p,/usr/bin/app,4,4,4\n"+
+			"10,55e000,590000,rw-p,[heap],4,250,200\n"+
+			"10,7f0000001000,7f0000002000,r--p,/usr/lib/libc.so.6,4,20,10\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "default",
+			want: "Change,Pid,AddressStart,AddressEnd,Perms,Pathname,Rss,Pss\n" +
+				"removed,9,7f0000000000,7f0000001000,rw-p,,-8,-8\n" +
+				"changed,10,55e000,590000,rw-p,[heap],150,100\n" +
+				"added,10,7f0000001000,7f0000002000,r--p,/usr/lib/libc.so.6,20,10\n",
+		},
+		{
+			name: "all",
+			args: []string{"-fields", "Pss", "-all"},
+			want: "Change,Pid,AddressStart,AddressEnd,Perms,Pathname,Pss\n" +
+				"removed,9,7f0000000000,7f0000001000,rw-p,,-8\n" +
+				"unchanged,10,55d000,55e000,r--p,/usr/bin/app,0\n" +
+				"changed,10,55e000,590000,rw-p,[heap],100\n" +
+				"added,10,7f0000001000,7f0000002000,r--p,/usr/lib/libc.so.6,10\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "diff.csv")
+			if err := runCSVDiff(append(tc.args, "-o", output, before, after)); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCSVDiffGroups(t *testing.T) {
+	before, err := readMergeInput(strings.NewReader("Group,Regions,Rss\n[heap],1,100\n/usr/bin/app,2,8\n"), "before.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := readMergeInput(strings.NewReader("Group,Regions,Rss\n/usr/bin/app,2,8\n[heap],1,300\n"), "after.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := newCSVDiff(before, after, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.csv(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Change,Group,Rss\nchanged,[heap],200\n"; string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestCSVDiffErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		before, after string
+		fields        []string
+	}{
+		{name: "pid in one file", before: "Pid,AddressStart,Pathname,Rss\n1,1000,,4\n", after: "AddressStart,Pathname,Rss\n1000,,4\n"},
+		{name: "no key columns", before: "Pathname,Rss\n,4\n", after: "Pathname,Rss\n,4\n"},
+		{name: "no kB fields", before: "AddressStart,Pathname,VmFlags\n1000,,rd\n", after: "AddressStart,Pathname,VmFlags\n1000,,rd\n"},
+		{name: "missing field", before: "AddressStart,Pathname,Rss\n1000,,4\n", after: "AddressStart,Pathname,Rss\n1000,,4\n", fields: []string{"Pss"}},
+		{name: "not a number", before: "AddressStart,Pathname,Rss\n1000,,4\n", after: "AddressStart,Pathname,Rss\n1000,,4.0.0\n"},
+		{name: "duplicate row", before: "AddressStart,Pathname,Rss\n1000,,4\n1000,,8\n", after: "AddressStart,Pathname,Rss\n1000,,4\n"},
+	} {
+		before, err := readMergeInput(strings.NewReader(tc.before), "before.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, err := readMergeInput(strings.NewReader(tc.after), "after.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := newCSVDiff(before, after, tc.fields); err == nil {
+			t.Errorf("%s: got no error", tc.name)
+		}
+	}
+}
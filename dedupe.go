@@ -0,0 +1,25 @@
+package main
+
+import "strings"
+
+// regionDeduper finds exact duplicates of mappings, which appear when
+// captures are concatenated by accident.
+type regionDeduper struct {
+	// seen maps the contents of mappings to the line numbers of their
+	// first occurrences.
+	seen map[string]int
+}
+
+// duplicate returns the line number of the first occurrence of a mapping
+// with the same region and counters as m, and whether there is one.
+func (d *regionDeduper) duplicate(m *mapping) (int, bool) {
+	key := strings.Join(m.toCSVRecord(), "\x00") + "\x00\x00" + strings.Join(m.FieldNames, "\x00")
+	if lineNo, ok := d.seen[key]; ok {
+		return lineNo, true
+	}
+	if d.seen == nil {
+		d.seen = make(map[string]int)
+	}
+	d.seen[key] = m.LineNo
+	return 0, false
+}
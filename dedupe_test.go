@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestConvertDedupe(t *testing.T) {
+	var want bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&want), strings.NewReader(testSmapsSorted), args{Separator: ","}); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &anomalyLog{file: "smaps"}
+	stats := &runStats{}
+	var got bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&got), strings.NewReader(testSmapsSorted+testSmapsSorted),
+		args{Separator: ",", dedupe: true, anomalies: l, stats: stats}); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got.String(), want.String())
+	}
+	if got, want := l.count, 2; got != want {
+		t.Errorf("anomaly count mismatch, got=%d, want=%d", got, want)
+	}
+	if got, want := stats.rows, 2; got != want {
+		t.Errorf("row count mismatch, got=%d, want=%d", got, want)
+	}
+}
+
+func TestRegionDeduperDuplicate(t *testing.T) {
+	newMapping := func(lineNo int, rss string) *mapping {
+		m := &mapping{Region: &region{AddressStart: []byte("1000"), AddressEnd: []byte("2000")}, LineNo: lineNo}
+		m.appendField("Rss", rss, "kB")
+		return m
+	}
+	d := &regionDeduper{}
+	if _, ok := d.duplicate(newMapping(1, "4")); ok {
+		t.Error("first mapping must not be a duplicate")
+	}
+	if _, ok := d.duplicate(newMapping(3, "8")); ok {
+		t.Error("mapping with different counters must not be a duplicate")
+	}
+	if lineNo, ok := d.duplicate(newMapping(5, "4")); !ok || lineNo != 1 {
+		t.Errorf("duplicate mismatch, got=(%d, %v), want=(1, true)", lineNo, ok)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultDiffFields are the fields compared by the diff subcommand by
+// default.
+const defaultDiffFields = "Rss,Pss,Private_Dirty,Swap"
+
+// Kinds of changes of regions in the diff subcommand.
+const (
+	diffAdded     = "added"
+	diffRemoved   = "removed"
+	diffChanged   = "changed"
+	diffUnchanged = "unchanged"
+)
+
+// runDiff runs the diff subcommand, which matches the regions of two
+// snapshots by the address range and the pathname and writes the deltas
+// of fields of each region, with the regions only in one of them as added
+// or removed.
+func runDiff(arguments []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff [-fields <fields>] [-all] [-o <file>] <before> <after>\n\nbefore and after are capture files or pids of live processes.\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	fieldList := fs.String("fields", defaultDiffFields, "comma separated fields to write the deltas of")
+	all := fs.Bool("all", false, "write also the regions whose fields are unchanged")
+	outputFilename := fs.String("o", stdioName, "output CSV filename, or \"-\" for the standard output")
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("two capture files or pids must be given")
+	}
+	fields := strings.Split(*fieldList, ",")
+	for _, field := range fields {
+		if field == "" {
+			return fmt.Errorf("empty field name in -fields: %q", *fieldList)
+		}
+	}
+
+	d := newSnapshotDiff(fields)
+	for i, source := range fs.Args() {
+		snapshot := d.before
+		if i == 1 {
+			snapshot = d.after
+		}
+		if err := readSource(source, func(m *mapping) error {
+			return snapshot.add(m)
+		}); err != nil {
+			return err
+		}
+	}
+	data, err := d.csv(*all)
+	if err != nil {
+		return err
+	}
+	return writeOutputFile(*outputFilename, data, outputFileOptions{})
+}
+
+// diffSnapshot is the fields of each region in a snapshot.
+type diffSnapshot struct {
+	fields  []string
+	keys    []regionKey
+	perms   map[regionKey]string
+	values  map[regionKey][]float64
+	address map[regionKey][2]string
+}
+
+func newDiffSnapshot(fields []string) *diffSnapshot {
+	return &diffSnapshot{
+		fields:  fields,
+		perms:   make(map[regionKey]string),
+		values:  make(map[regionKey][]float64),
+		address: make(map[regionKey][2]string),
+	}
+}
+
+// add adds the fields of m. The values of a region appearing more than
+// once, e.g. in concatenated captures, are summed.
+func (s *diffSnapshot) add(m *mapping) error {
+	start, end, err := m.Region.addressRange()
+	if err != nil {
+		return fmt.Errorf("line %d: %w", m.LineNo, err)
+	}
+	key := regionKey{start: start, end: end, pathname: string(m.Region.Pathname)}
+	values, ok := s.values[key]
+	if !ok {
+		values = make([]float64, len(s.fields))
+		s.values[key] = values
+		s.keys = append(s.keys, key)
+		s.perms[key] = string(m.Region.Perms)
+		s.address[key] = [2]string{string(m.Region.AddressStart), string(m.Region.AddressEnd)}
+	}
+	for i, field := range s.fields {
+		if v, ok := m.numericFieldValue(field); ok {
+			values[i] += v
+		}
+	}
+	return nil
+}
+
+// snapshotDiff compares the regions of two snapshots.
+type snapshotDiff struct {
+	fields        []string
+	before, after *diffSnapshot
+}
+
+func newSnapshotDiff(fields []string) *snapshotDiff {
+	return &snapshotDiff{fields: fields, before: newDiffSnapshot(fields), after: newDiffSnapshot(fields)}
+}
+
+// csv returns the regions sorted by the address with the kind of the
+// change, the permissions in the after snapshot, or the before snapshot
+// for removed regions, and the delta of each field in kB. Unchanged
+// regions are included only if all is true.
+func (d *snapshotDiff) csv(all bool) ([]byte, error) {
+	keys := append([]regionKey(nil), d.before.keys...)
+	for _, key := range d.after.keys {
+		if _, ok := d.before.values[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		if a.end != b.end {
+			return a.end < b.end
+		}
+		return a.pathname < b.pathname
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := append([]string{"Change", "AddressStart", "AddressEnd", "Perms", "Pathname"}, d.fields...)
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		before, inBefore := d.before.values[key]
+		after, inAfter := d.after.values[key]
+		snapshot := d.after
+		change := diffChanged
+		switch {
+		case !inBefore:
+			change = diffAdded
+			before = make([]float64, len(d.fields))
+		case !inAfter:
+			change = diffRemoved
+			after = make([]float64, len(d.fields))
+			snapshot = d.before
+		}
+		record := []string{change, snapshot.address[key][0], snapshot.address[key][1], snapshot.perms[key], key.pathname}
+		changed := false
+		for i := range d.fields {
+			delta := after[i] - before[i]
+			if delta != 0 {
+				changed = true
+			}
+			record = append(record, strconv.FormatFloat(delta, 'f', -1, 64))
+		}
+		if change == diffChanged && !changed {
+			if !all {
+				continue
+			}
+			record[0] = diffUnchanged
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
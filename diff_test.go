@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	before := filepath.Join(dir, "before.smaps")
+	after := filepath.Join(dir, "after.smaps")
+	if err := os.WriteFile(before, []byte(
+		"55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/app\nRss: 4 kB\nPss: 4 kB\n"+
+			"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nRss: 100 kB\nPss: 100 kB\n"+
+			"7f0000000000-7f0000001000 rw-p 00000000 00:00 0 \nRss: 8 kB\nPss: 8 kB\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(after, []byte(
+		"55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/app\nRss: 4 kB\nPss: 4 kB\n"+
+			"55e000-590000 rw-p 00000000 00:00 0                          [heap]\nRss: 250 kB\nPss: 250 kB\n"+
+			"7f0000001000-7f0000002000 r--p 00000000 fe:00 42                         /usr/lib/libc.so.6\nRss: 20 kB\nPss: 10 kB\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "changed",
+			args: []string{"-fields", "Rss,Pss"},
+			want: "Change,AddressStart,AddressEnd,Perms,Pathname,Rss,Pss\n" +
+				"removed,55e000,580000,rw-p,[heap],-100,-100\n" +
+				"added,55e000,590000,rw-p,[heap],250,250\n" +
+				"removed,7f0000000000,7f0000001000,rw-p,,-8,-8\n" +
+				"added,7f0000001000,7f0000002000,r--p,/usr/lib/libc.so.6,20,10\n",
+		},
+		{
+			name: "all",
+			args: []string{"-fields", "Pss", "-all"},
+			want: "Change,AddressStart,AddressEnd,Perms,Pathname,Pss\n" +
+				"unchanged,55d000,55e000,r--p,/usr/bin/app,0\n" +
+				"removed,55e000,580000,rw-p,[heap],-100\n" +
+				"added,55e000,590000,rw-p,[heap],250\n" +
+				"removed,7f0000000000,7f0000001000,rw-p,,-8\n" +
+				"added,7f0000001000,7f0000002000,r--p,/usr/lib/libc.so.6,10\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "diff.csv")
+			if err := runDiff(append(tc.args, "-o", output, before, after)); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotDiffChanged(t *testing.T) {
+	d := newSnapshotDiff([]string{"Rss", "Swap"})
+	if err := readMappings(strings.NewReader("55e000-580000 rw-p 00000000 00:00 0 [heap]\nRss: 100 kB\nSwap: 0 kB\n"), d.before.add); err != nil {
+		t.Fatal(err)
+	}
+	if err := readMappings(strings.NewReader("55e000-580000 rw-p 00000000 00:00 0 [heap]\nRss: 60 kB\nSwap: 40 kB\n"), d.after.add); err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.csv(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Change,AddressStart,AddressEnd,Perms,Pathname,Rss,Swap\n" +
+		"changed,55e000,580000,rw-p,[heap],-40,40\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	dumpFormatRaw = "raw"
+	dumpFormatHex = "hex"
+)
+
+// dumpChunkSize is the maximum number of bytes read from the target
+// process at once.
+const dumpChunkSize = 1 << 20
+
+// regionDumper writes the memory contents of selected regions of a live
+// process to files.
+type regionDumper struct {
+	pid    int
+	dir    string
+	format string
+	pathRe *regexp.Regexp
+	// start and end limit dumped bytes to an address range. end is zero
+	// when no range is set.
+	start, end uint64
+}
+
+func newRegionDumper(pid int, dir, format, pathPattern, addrRange string) (*regionDumper, error) {
+	if pid <= 0 {
+		return nil, errors.New("pid of the target process is unknown; set -dump-pid or use /proc/<pid>/smaps as input")
+	}
+	if format != dumpFormatRaw && format != dumpFormatHex {
+		return nil, fmt.Errorf("unsupported dump format: %q", format)
+	}
+	if pathPattern == "" && addrRange == "" {
+		return nil, errors.New("dumping regions requires -dump-path or -dump-range")
+	}
+	d := &regionDumper{pid: pid, dir: dir, format: format}
+	if pathPattern != "" {
+		re, err := regexp.Compile(pathPattern)
+		if err != nil {
+			return nil, err
+		}
+		d.pathRe = re
+	}
+	if addrRange != "" {
+		start, end, err := parseAddressRange(addrRange)
+		if err != nil {
+			return nil, err
+		}
+		d.start, d.end = start, end
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// parseAddressRange parses a range of hexadecimal addresses in the same
+// form as the first column of smaps, e.g. "7f0000000000-7f0000001000".
+func parseAddressRange(s string) (start, end uint64, err error) {
+	startStr, endStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("address range must be in the form start-end: %q", s)
+	}
+	start, err = strconv.ParseUint(strings.TrimPrefix(startStr, "0x"), 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err = strconv.ParseUint(strings.TrimPrefix(endStr, "0x"), 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start >= end {
+		return 0, 0, fmt.Errorf("start address must be less than end address: %q", s)
+	}
+	return start, end, nil
+}
+
+// pidFromSmapsPath returns the pid in a path like /proc/<pid>/smaps, or
+// zero if filename is not such a path.
+func pidFromSmapsPath(filename string) int {
+	dir, base := filepath.Split(filepath.Clean(filename))
+	if base != "smaps" || filepath.Dir(filepath.Clean(dir)) != filepath.Clean(procRoot) {
+		return 0
+	}
+	return pidFromProcPath(filename)
+}
+
+// dump writes the contents of the region of m if it is selected. Regions
+// which are not readable are skipped.
+func (d *regionDumper) dump(m *mapping) error {
+	start, end, err := m.Region.addressRange()
+	if err != nil {
+		return err
+	}
+	if d.pathRe != nil && !d.pathRe.Match(m.Region.Pathname) {
+		return nil
+	}
+	if d.end != 0 {
+		if end <= d.start || d.end <= start {
+			return nil
+		}
+		if start < d.start {
+			start = d.start
+		}
+		if end > d.end {
+			end = d.end
+		}
+	}
+	if len(m.Region.Perms) == 0 || m.Region.Perms[0] != 'r' {
+		return nil
+	}
+
+	ext := ".bin"
+	if d.format == dumpFormatHex {
+		ext = ".hex"
+	}
+	filename := filepath.Join(d.dir, fmt.Sprintf("%x-%x%s", start, end, ext))
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var w io.Writer = file
+	if d.format == dumpFormatHex {
+		dumper := hex.Dumper(file)
+		defer dumper.Close()
+		w = dumper
+	}
+	buf := make([]byte, dumpChunkSize)
+	for addr := start; addr < end; {
+		n := uint64(len(buf))
+		if end-addr < n {
+			n = end - addr
+		}
+		read, err := readProcessMemory(d.pid, addr, buf[:n])
+		if err != nil {
+			return fmt.Errorf("read memory of pid %d at %x: %w", d.pid, addr, err)
+		}
+		if _, err := w.Write(buf[:read]); err != nil {
+			return err
+		}
+		if read < int(n) {
+			break
+		}
+		addr += uint64(read)
+	}
+	return nil
+}
+
+// addressRange returns the start and end addresses of the region.
+func (r *region) addressRange() (start, end uint64, err error) {
+	start, err = strconv.ParseUint(string(r.AddressStart), 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err = strconv.ParseUint(string(r.AddressEnd), 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
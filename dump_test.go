@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"unsafe"
+)
+
+func TestPidFromSmapsPath(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want int
+	}{
+		{in: "/proc/1234/smaps", want: 1234},
+		{in: "/proc/1234/smaps_rollup", want: 0},
+		{in: "/proc/self/smaps", want: 0},
+		{in: "/tmp/1234/smaps", want: 0},
+		{in: "smaps", want: 0},
+	}
+	for _, tc := range testCases {
+		if got := pidFromSmapsPath(tc.in); got != tc.want {
+			t.Errorf("in=%s: result mismatch, got=%d, want=%d", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRegionDumperDump(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process_vm_readv is supported only on Linux")
+	}
+	data := []byte("hello, linuxprocsmapstocsv")
+	start := uint64(uintptr(unsafe.Pointer(&data[0])))
+	end := start + uint64(len(data))
+	m := &mapping{Region: &region{
+		AddressStart: []byte(fmt.Sprintf("%x", start)),
+		AddressEnd:   []byte(fmt.Sprintf("%x", end)),
+		Perms:        []byte("rw-p"),
+		Pathname:     []byte("[heap]"),
+	}}
+
+	dir := t.TempDir()
+	d, err := newRegionDumper(os.Getpid(), dir, dumpFormatRaw, `^\[heap\]$`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.dump(m); err != nil {
+		t.Fatal(err)
+	}
+	runtime.KeepAlive(data)
+	got, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("%x-%x.bin", start, end)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("result mismatch,\n got=%q,\nwant=%q", got, data)
+	}
+}
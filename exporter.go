@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hnakamur/linuxprocsmapstocsv/smaps"
+)
+
+// runExporter runs the exporter subcommand, a Prometheus exporter which
+// reads the smaps of processes periodically and serves the Rss, Pss and
+// Swap of each pathname with pid and pathname labels. With -scan-budget,
+// a slow scrape makes it read smaps_rollup instead, degrading the metrics
+// to a series of each process to bound its overhead, until a scrape of
+// smaps tried again fits in the budget.
+func runExporter(arguments []string) error {
+	fs := flag.NewFlagSet("exporter", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s exporter -listen <address> -p <pids> [-scrape-interval <duration>]\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	listen := fs.String("listen", "", "address to serve the metrics on at /metrics, e.g. :9200")
+	pidList := fs.String("p", "", "comma separated pids of the processes to read /proc/<pid>/smaps of")
+	interval := fs.Duration("scrape-interval", 15*time.Second, "interval of reading the smaps of the processes")
+	alertRulesPath := fs.String("alert-rules", "", "JSON file of alert rules evaluated for each scrape, as of -alert-rules of the conversion")
+	budget := fs.Duration("scan-budget", 0, fmt.Sprintf("if a scrape takes longer than this, e.g. 2s, read smaps_rollup instead of smaps in the following scrapes, serving a series of each process with the pathname [rollup], which is much cheaper on hosts with huge address spaces; smaps is tried again every %d scrapes (default: never)", exporterRetryScrapes))
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if *listen == "" || *pidList == "" {
+		fs.Usage()
+		return errors.New("both flags -listen and -p must be set")
+	}
+	if *interval <= 0 {
+		return errors.New("-scrape-interval must be positive")
+	}
+	if *budget < 0 {
+		return errors.New("-scan-budget must not be negative")
+	}
+	pids, err := parsePidList(*pidList)
+	if err != nil {
+		return err
+	}
+
+	e := newPromExporter(pids)
+	e.budget = *budget
+	if *alertRulesPath != "" {
+		rules, err := readAlertRules(*alertRulesPath)
+		if err != nil {
+			return err
+		}
+		e.alerts = newAlertEngine(rules)
+	}
+	e.scrape(time.Now())
+	go func() {
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for t := range ticker.C {
+			e.scrape(t)
+		}
+	}()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	log.Printf("serving metrics of %d processes on %s", len(pids), *listen)
+	return http.ListenAndServe(*listen, mux)
+}
+
+// exporterRetryScrapes is the number of scrapes of smaps_rollup after
+// which a degraded exporter tries reading smaps again.
+const exporterRetryScrapes = 10
+
+// promExporter holds the metrics of the last scrape of the processes.
+type promExporter struct {
+	pids []int
+	// budget is the duration of -scan-budget, over which a scrape of
+	// smaps makes the following ones read smaps_rollup, i.e. rollup,
+	// until a scrape of smaps tried again after rollupScrapes of
+	// exporterRetryScrapes fits in it.
+	budget        time.Duration
+	rollup        bool
+	rollupScrapes int
+	// alerts evaluates the rules of -alert-rules for each scrape, or is
+	// nil.
+	alerts *alertEngine
+	// The counters of the exporter itself over all scrapes, for alerting
+	// on the exporter failing to read processes.
+	scrapes     int
+	readErrors  int
+	parseErrors int
+	regions     int
+
+	mu      sync.Mutex
+	metrics []byte
+}
+
+func newPromExporter(pids []int) *promExporter {
+	return &promExporter{pids: pids}
+}
+
+// scrape reads the smaps of the processes and replaces the metrics.
+// Processes which cannot be read, e.g. which have exited, are skipped
+// with warnings.
+func (e *promExporter) scrape(now time.Time) {
+	start := time.Now()
+	rollup := e.rollup && e.rollupScrapes < exporterRetryScrapes
+	// sums are the sums of promMetrics per pathname of each process.
+	sums := make(map[int]map[string][]float64)
+	up := make(map[int]bool)
+	var series int
+	for _, pid := range e.pids {
+		byPathname := make(map[string][]float64)
+		source := strconv.Itoa(pid)
+		if rollup {
+			source = procPath(pid, smapsKindRollup)
+		}
+		err := readSource(source, func(m *mapping) error {
+			e.regions++
+			e.alerts.add(m)
+			pathname := string(m.Region.Pathname)
+			s, ok := byPathname[pathname]
+			if !ok {
+				s = make([]float64, len(promMetrics))
+				byPathname[pathname] = s
+			}
+			for i, metric := range promMetrics {
+				if v, ok := m.numericFieldValue(metric.column); ok {
+					s[i] += v
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			var perr *smaps.ParseError
+			if errors.As(err, &perr) {
+				e.parseErrors++
+			} else {
+				e.readErrors++
+			}
+			log.Printf("warning: skip process %d: %v", pid, err)
+			continue
+		}
+		sums[pid] = byPathname
+		up[pid] = true
+		series += len(byPathname) * len(promMetrics)
+	}
+	e.scrapes++
+	duration := time.Since(start)
+	e.alerts.evaluate(now)
+	switch {
+	case rollup:
+		e.rollupScrapes++
+	case e.budget > 0 && duration > e.budget:
+		log.Printf("warning: scrape took %v, longer than -scan-budget %v, so smaps_rollup is read from now on", duration.Round(time.Millisecond), e.budget)
+		e.rollup = true
+		e.rollupScrapes = 0
+	case e.rollup:
+		log.Printf("scrape took %v, within -scan-budget %v, so smaps is read again", duration.Round(time.Millisecond), e.budget)
+		e.rollup = false
+	}
+	degraded := 0
+	if e.rollup {
+		degraded = 1
+	}
+
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	for i, metric := range promMetrics {
+		fmt.Fprintf(bw, "# HELP %s Sum of %s of the regions per pathname.\n", metric.name, metric.column)
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", metric.name)
+		for _, pid := range e.pids {
+			pathnames := make([]string, 0, len(sums[pid]))
+			for pathname := range sums[pid] {
+				pathnames = append(pathnames, pathname)
+			}
+			sort.Strings(pathnames)
+			for _, pathname := range pathnames {
+				fmt.Fprintf(bw, "%s{pid=\"%d\",pathname=%s} %s\n", metric.name, pid, strconv.Quote(pathname),
+					strconv.FormatFloat(sums[pid][pathname][i]*1024, 'f', -1, 64))
+			}
+		}
+	}
+	fmt.Fprintln(bw, "# HELP smaps_up Whether the smaps of the process was read in the last scrape.")
+	fmt.Fprintln(bw, "# TYPE smaps_up gauge")
+	for _, pid := range e.pids {
+		v := 0
+		if up[pid] {
+			v = 1
+		}
+		fmt.Fprintf(bw, "smaps_up{pid=\"%d\"} %d\n", pid, v)
+	}
+	fmt.Fprintln(bw, "# HELP smaps_last_scrape_timestamp_seconds Time of the last scrape of the processes.")
+	fmt.Fprintln(bw, "# TYPE smaps_last_scrape_timestamp_seconds gauge")
+	fmt.Fprintf(bw, "smaps_last_scrape_timestamp_seconds %d\n", now.Unix())
+	for _, m := range []struct {
+		name, typ, help string
+		value           float64
+	}{
+		{"smaps_exporter_scrape_duration_seconds", "gauge", "Duration of the last scrape of the processes.", duration.Seconds()},
+		{"smaps_exporter_degraded", "gauge", "Whether smaps_rollup is read instead of smaps after a scrape exceeded -scan-budget.", float64(degraded)},
+		{"smaps_exporter_scrape_processes", "gauge", "Number of processes read in the last scrape.", float64(len(sums))},
+		{"smaps_exporter_scrape_series", "gauge", "Number of series of the processes written by the last scrape.", float64(series)},
+		{"smaps_exporter_scrapes_total", "counter", "Number of scrapes of the processes.", float64(e.scrapes)},
+		{"smaps_exporter_read_errors_total", "counter", "Number of processes whose smaps could not be read, e.g. which have exited.", float64(e.readErrors)},
+		{"smaps_exporter_parse_errors_total", "counter", "Number of processes whose smaps could not be parsed.", float64(e.parseErrors)},
+		{"smaps_exporter_regions_total", "counter", "Number of regions read from the processes.", float64(e.regions)},
+	} {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.typ)
+		fmt.Fprintf(bw, "%s %s\n", m.name, strconv.FormatFloat(m.value, 'f', -1, 64))
+	}
+	bw.Flush()
+
+	e.mu.Lock()
+	e.metrics = buf.Bytes()
+	e.mu.Unlock()
+}
+
+func (e *promExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	e.mu.Lock()
+	metrics := e.metrics
+	e.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(metrics)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPromExporter(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	if err := os.MkdirAll(filepath.Join(procRoot, "10"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "10", "smaps"), []byte(
+		"55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nRss: 4 kB\nPss: 2 kB\nSwap: 0 kB\n"+
+			"55e000-55f000 r-xp 00001000 fe:00 1234                       /usr/bin/cat\nRss: 8 kB\nPss: 8 kB\nSwap: 0 kB\n"+
+			"7f0000000000-7f0000001000 rw-p 00000000 00:00 0 \nRss: 4 kB\nPss: 4 kB\nSwap: 4 kB\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(procRoot, "30"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "30", "smaps"), []byte("bad region: x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := newPromExporter([]int{10, 20, 30})
+	e.scrape(time.Unix(1700000000, 0))
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`smaps_rss_bytes{pid="10",pathname="/usr/bin/cat"} 12288` + "\n",
+		`smaps_pss_bytes{pid="10",pathname="/usr/bin/cat"} 10240` + "\n",
+		`smaps_swap_bytes{pid="10",pathname=""} 4096` + "\n",
+		`smaps_up{pid="10"} 1` + "\n",
+		`smaps_up{pid="20"} 0` + "\n",
+		"smaps_last_scrape_timestamp_seconds 1700000000\n",
+		"smaps_exporter_scrape_processes 1\n",
+		"smaps_exporter_scrape_series 6\n",
+		"smaps_exporter_scrapes_total 1\n",
+		"smaps_exporter_read_errors_total 1\n",
+		"smaps_exporter_parse_errors_total 1\n",
+		"smaps_exporter_regions_total 3\n",
+		"# TYPE smaps_exporter_scrape_duration_seconds gauge\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics must contain %q, got=%s", want, body)
+		}
+	}
+	if strings.Contains(string(body), `pid="20",pathname`) {
+		t.Errorf("metrics must not contain regions of the unreadable process, got=%s", body)
+	}
+}
+
+func TestPromExporterScanBudget(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	if err := os.MkdirAll(filepath.Join(procRoot, "10"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "10", "smaps"), []byte(
+		"55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nRss: 4 kB\nPss: 2 kB\nSwap: 0 kB\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "10", "smaps_rollup"), []byte(
+		"55d000-7ffd1000 ---p 00000000 00:00 0                          [rollup]\nRss: 40 kB\nPss: 20 kB\nSwap: 0 kB\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Any scrape exceeds the budget of a nanosecond.
+	e := newPromExporter([]int{10})
+	e.budget = time.Nanosecond
+	e.scrape(time.Unix(1700000000, 0))
+	if !strings.Contains(string(e.metrics), `smaps_rss_bytes{pid="10",pathname="/usr/bin/cat"} 4096`+"\n") {
+		t.Errorf("first scrape must read smaps, got=%s", e.metrics)
+	}
+	e.scrape(time.Unix(1700000015, 0))
+	for _, want := range []string{
+		`smaps_rss_bytes{pid="10",pathname="[rollup]"} 40960` + "\n",
+		"smaps_exporter_degraded 1\n",
+	} {
+		if !strings.Contains(string(e.metrics), want) {
+			t.Errorf("metrics must contain %q, got=%s", want, e.metrics)
+		}
+	}
+	if strings.Contains(string(e.metrics), "/usr/bin/cat") {
+		t.Errorf("degraded scrape must not read smaps, got=%s", e.metrics)
+	}
+
+	// smaps is tried again after exporterRetryScrapes scrapes of
+	// smaps_rollup, and read from then on as it fits in the budget.
+	e.budget = time.Hour
+	for i := 1; i < exporterRetryScrapes; i++ {
+		e.scrape(time.Unix(1700000015, 0))
+	}
+	if !strings.Contains(string(e.metrics), "smaps_exporter_degraded 1\n") {
+		t.Errorf("exporter must stay degraded until smaps is tried again, got=%s", e.metrics)
+	}
+	for i := 0; i < 2; i++ {
+		e.scrape(time.Unix(1700000030, 0))
+		for _, want := range []string{
+			`smaps_rss_bytes{pid="10",pathname="/usr/bin/cat"} 4096` + "\n",
+			"smaps_exporter_degraded 0\n",
+		} {
+			if !strings.Contains(string(e.metrics), want) {
+				t.Errorf("scrape %d in the budget: metrics must contain %q, got=%s", i, want, e.metrics)
+			}
+		}
+	}
+}
+
+func TestPromExporterAlerts(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	if err := os.MkdirAll(filepath.Join(procRoot, "10"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "10", "smaps"), []byte(testSmapsSorted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	r, err := newAlertRule(alertRuleSpec{Name: "rss", Kind: alertKindThreshold, Condition: "total_rss >= 4", For: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newPromExporter([]int{10})
+	e.alerts = newAlertEngine([]*alertRule{r})
+	e.scrape(time.Unix(1700000000, 0))
+	if buf.Len() != 0 {
+		t.Errorf("rule must not fire before holding in 2 scrapes, got=%s", buf.String())
+	}
+	e.scrape(time.Unix(1700000015, 0))
+	if want := "alert rss firing: total_rss >= 4 holds: 4 >= 4\n"; buf.String() != want {
+		t.Errorf("alerts mismatch,\n got=%s,\nwant=%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// expr is a node of the small arithmetic expression language used for
+// computed columns. It supports decimal numbers, sizes with a unit of
+// parseByteSize in kB like the fields, e.g. 2GiB, smaps field names, the
+// binary operators + - * /, unary minus and parentheses.
+type expr interface {
+	// eval returns the value of the expression. ok is false when a
+	// field referenced by the expression cannot be looked up.
+	eval(lookup func(name string) (float64, bool)) (v float64, ok bool)
+}
+
+type numberExpr float64
+
+type fieldExpr string
+
+type negExpr struct {
+	x expr
+}
+
+type binaryExpr struct {
+	op   byte
+	x, y expr
+}
+
+func (e numberExpr) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	return float64(e), true
+}
+
+func (e fieldExpr) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	return lookup(string(e))
+}
+
+func (e *negExpr) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	v, ok := e.x.eval(lookup)
+	return -v, ok
+}
+
+func (e *binaryExpr) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	x, ok := e.x.eval(lookup)
+	if !ok {
+		return 0, false
+	}
+	y, ok := e.y.eval(lookup)
+	if !ok {
+		return 0, false
+	}
+	switch e.op {
+	case '+':
+		return x + y, true
+	case '-':
+		return x - y, true
+	case '*':
+		return x * y, true
+	default:
+		return x / y, true
+	}
+}
+
+var errUnexpectedEnd = errors.New("unexpected end of expression")
+
+type exprParser struct {
+	src string
+	pos int
+}
+
+func parseExpr(src string) (expr, error) {
+	p := &exprParser{src: src}
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at offset %d in expression %q", p.src[p.pos], p.pos, src)
+	}
+	return e, nil
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte or 0 at the end of the source.
+func (p *exprParser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) parseSum() (expr, error) {
+	x, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return x, nil
+		}
+		p.pos++
+		y, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryExpr{op: op, x: x, y: y}
+	}
+}
+
+func (p *exprParser) parseProduct() (expr, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return x, nil
+		}
+		p.pos++
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryExpr{op: op, x: x, y: y}
+	}
+}
+
+func (p *exprParser) parseUnary() (expr, error) {
+	if p.peek() == '-' {
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negExpr{x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (expr, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, errUnexpectedEnd
+	case c == '(':
+		p.pos++
+		x, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ')' at offset %d in expression %q", p.pos, p.src)
+		}
+		p.pos++
+		return x, nil
+	case isDigit(c) || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		number := p.pos
+		for p.pos < len(p.src) && isIdentStart(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos > number {
+			size, err := parseByteSize(p.src[start:p.pos])
+			if err != nil {
+				return nil, fmt.Errorf("invalid size %q in expression %q", p.src[start:p.pos], p.src)
+			}
+			return numberExpr(float64(size) / 1024), nil
+		}
+		v, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in expression %q", p.src[start:p.pos], p.src)
+		}
+		return numberExpr(v), nil
+	case isIdentStart(c):
+		start := p.pos
+		for p.pos < len(p.src) && (isIdentStart(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		return fieldExpr(p.src[start:p.pos]), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at offset %d in expression %q", c, p.pos, p.src)
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || c == '_'
+}
+
+// derivedColumn is a column computed from the fields of each mapping.
+type derivedColumn struct {
+	Name string
+	Expr expr
+}
+
+// parseDerivedColumn parses a definition in the form "Name=expression".
+func parseDerivedColumn(def string) (derivedColumn, error) {
+	name, src, ok := strings.Cut(def, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return derivedColumn{}, fmt.Errorf("derived column must be in the form Name=expression: %q", def)
+	}
+	e, err := parseExpr(src)
+	if err != nil {
+		return derivedColumn{}, err
+	}
+	return derivedColumn{Name: name, Expr: e}, nil
+}
+
+// value returns the value of the column for m formatted with f. It
+// returns an empty string when a referenced field is missing or not
+// numeric, or the result is not a finite number.
+func (c *derivedColumn) value(m *mapping, f floatFormat) string {
+	v, ok := c.Expr.eval(m.numericFieldValue)
+	if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+		return ""
+	}
+	return f.format(v)
+}
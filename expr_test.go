@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestDerivedColumnValue(t *testing.T) {
+	m := &mapping{
+		FieldNames:  []string{"Size", "Rss", "Private_Dirty", "VmFlags"},
+		FieldValues: []string{"8", "6", "2", "rd wr"},
+	}
+	testCases := []struct {
+		def  string
+		want string
+	}{
+		{def: "DirtyRatio=Private_Dirty/Size", want: "0.25"},
+		{def: "X = (Size - Rss) * 2 + -1", want: "3"},
+		{def: "X=Rss/0", want: ""},
+		{def: "X=Missing+1", want: ""},
+		{def: "X=VmFlags", want: ""},
+	}
+	for _, tc := range testCases {
+		c, err := parseDerivedColumn(tc.def)
+		if err != nil {
+			t.Fatalf("def=%q: %v", tc.def, err)
+		}
+		if got := c.value(m, defaultFloatFormat); got != tc.want {
+			t.Errorf("def=%q: result mismatch, got=%q, want=%q", tc.def, got, tc.want)
+		}
+	}
+}
+
+func TestParseDerivedColumnError(t *testing.T) {
+	for _, def := range []string{"Rss/Size", "X=", "X=(Rss", "X=Rss +", "X=Rss $ 2"} {
+		if _, err := parseDerivedColumn(def); err == nil {
+			t.Errorf("def=%q: want error, got nil", def)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Prefixes of the variables of -fail-if, which are followed by the name
+// of a field in any case, e.g. total_pss for the sum of Pss.
+const (
+	failIfTotalPrefix = "total_"
+	failIfMaxPrefix   = "max_"
+	failIfRegions     = "regions"
+)
+
+// failCondition is a condition of -fail-if, a comparison of expressions
+// over the fields aggregated over all written regions, e.g.
+// "total_pss > 2GiB" or "max_swap / total_swap > 0.5".
+type failCondition struct {
+	src  string
+	op   string
+	x, y expr
+}
+
+// failOperators are the comparison operators, the longer ones first.
+var failOperators = []string{">=", "<=", "==", "!=", ">", "<"}
+
+func parseFailCondition(s string) (*failCondition, error) {
+	return parseAggregateCondition("-fail-if", s)
+}
+
+// parseAggregateCondition parses a condition of the option, e.g. -fail-if,
+// whose name is in the errors.
+func parseAggregateCondition(option, s string) (*failCondition, error) {
+	i := strings.IndexAny(s, "<>=!")
+	if i < 0 {
+		return nil, fmt.Errorf("%s must compare two expressions with one of %s: %q", option, strings.Join(failOperators, " "), s)
+	}
+	c := &failCondition{src: s}
+	for _, op := range failOperators {
+		if strings.HasPrefix(s[i:], op) {
+			c.op = op
+			break
+		}
+	}
+	if c.op == "" {
+		return nil, fmt.Errorf("invalid operator at offset %d in %s %q", i, option, s)
+	}
+	var err error
+	if c.x, err = parseExpr(s[:i]); err != nil {
+		return nil, fmt.Errorf("%s %q: %w", option, s, err)
+	}
+	if c.y, err = parseExpr(s[i+len(c.op):]); err != nil {
+		return nil, fmt.Errorf("%s %q: %w", option, s, err)
+	}
+	// The names are checked by evaluating with dummy values.
+	var invalid string
+	check := func(name string) (float64, bool) {
+		if !isFailIfVariable(name) && invalid == "" {
+			invalid = name
+		}
+		return 1, true
+	}
+	c.x.eval(check)
+	c.y.eval(check)
+	if invalid != "" {
+		return nil, fmt.Errorf("%s %q: unknown variable %s, which must be regions, total_<field> or max_<field>", option, s, invalid)
+	}
+	return c, nil
+}
+
+// isFailIfVariable reports whether name is a variable of the conditions,
+// regions, total_<field> or max_<field> in any case.
+func isFailIfVariable(name string) bool {
+	lower := strings.ToLower(name)
+	return lower == failIfRegions ||
+		len(lower) > len(failIfTotalPrefix) && strings.HasPrefix(lower, failIfTotalPrefix) ||
+		len(lower) > len(failIfMaxPrefix) && strings.HasPrefix(lower, failIfMaxPrefix)
+}
+
+// holds reports whether the condition holds for the values of lookup, with
+// the values of both sides. ok is false if a field is missing.
+func (c *failCondition) holds(lookup func(string) (float64, bool)) (holds bool, x, y float64, ok bool) {
+	if x, ok = c.x.eval(lookup); !ok {
+		return false, 0, 0, false
+	}
+	if y, ok = c.y.eval(lookup); !ok {
+		return false, 0, 0, false
+	}
+	switch c.op {
+	case ">=":
+		holds = x >= y
+	case "<=":
+		holds = x <= y
+	case "==":
+		holds = x == y
+	case "!=":
+		holds = x != y
+	case ">":
+		holds = x > y
+	default:
+		holds = x < y
+	}
+	return holds, x, y, true
+}
+
+// failChecker aggregates the fields of the written regions for the
+// conditions of -fail-if, which are checked after the output is written.
+type failChecker struct {
+	conditions []*failCondition
+	// totals and maxima are keyed by the lowercased field names.
+	totals  map[string]float64
+	maxima  map[string]float64
+	regions int
+}
+
+func newFailChecker(conditions []*failCondition) *failChecker {
+	return &failChecker{
+		conditions: conditions,
+		totals:     make(map[string]float64),
+		maxima:     make(map[string]float64),
+	}
+}
+
+// add adds the fields of m. It must be called with the counters of the
+// input in kB, before units are converted.
+func (c *failChecker) add(m *mapping) {
+	c.regions++
+	for _, name := range m.FieldNames {
+		v, ok := m.numericFieldValue(name)
+		if !ok {
+			continue
+		}
+		key := strings.ToLower(name)
+		c.totals[key] += v
+		if prev, seen := c.maxima[key]; !seen || v > prev {
+			c.maxima[key] = v
+		}
+	}
+}
+
+func (c *failChecker) lookup(name string) (float64, bool) {
+	lower := strings.ToLower(name)
+	if lower == failIfRegions {
+		return float64(c.regions), true
+	}
+	if field := strings.TrimPrefix(lower, failIfTotalPrefix); field != lower {
+		v, ok := c.totals[field]
+		return v, ok
+	}
+	v, ok := c.maxima[strings.TrimPrefix(lower, failIfMaxPrefix)]
+	return v, ok
+}
+
+// check writes the conditions which hold to w and returns an error if
+// there are any, or if one refers to a field missing from all regions.
+func (c *failChecker) check(w io.Writer) error {
+	failed := 0
+	for _, cond := range c.conditions {
+		holds, x, y, ok := cond.holds(c.lookup)
+		if !ok {
+			return fmt.Errorf("-fail-if %q refers to a field missing from the regions", cond.src)
+		}
+		if holds {
+			fmt.Fprintf(w, "fail-if: %s holds: %s %s %s\n", cond.src,
+				strconv.FormatFloat(x, 'f', -1, 64), cond.op, strconv.FormatFloat(y, 'f', -1, 64))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d -fail-if conditions hold", failed)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseFailCondition(t *testing.T) {
+	for _, s := range []string{"total_pss > 2GiB", "max_Swap/total_swap>=0.5", "regions != 0", "(total_rss - total_pss) * 2 < 1M"} {
+		if _, err := parseFailCondition(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	for _, s := range []string{"total_pss", "total_pss = 1", "total_pss ! 1", "pss > 1", "total_ > 1", "total_pss > 2XB", "total_pss > > 1"} {
+		if _, err := parseFailCondition(s); err == nil {
+			t.Errorf("%s: got no error", s)
+		}
+	}
+}
+
+func TestFailChecker(t *testing.T) {
+	var conditions []*failCondition
+	for _, s := range []string{"total_pss > 10", "max_rss >= 8kB", "regions < 2", "total_Swap == 0"} {
+		c, err := parseFailCondition(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conditions = append(conditions, c)
+	}
+	c := newFailChecker(conditions)
+	c.add(&mapping{FieldNames: []string{"Rss", "Pss", "Swap"}, FieldValues: []string{"8", "6", "0"}, FieldUnits: []string{"kB", "kB", "kB"}})
+	c.add(&mapping{FieldNames: []string{"Rss", "Pss", "Swap"}, FieldValues: []string{"4", "4", "0"}, FieldUnits: []string{"kB", "kB", "kB"}})
+	var buf bytes.Buffer
+	err := c.check(&buf)
+	if err == nil || err.Error() != "2 -fail-if conditions hold" {
+		t.Errorf("got error %v", err)
+	}
+	want := "fail-if: total_pss > 10 holds: 10 > 10\n"
+	if strings.Contains(buf.String(), want) {
+		t.Errorf("output must not contain %q", want)
+	}
+	for _, want := range []string{
+		"fail-if: max_rss >= 8kB holds: 8 >= 8\n",
+		"fail-if: total_Swap == 0 holds: 0 == 0\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output must contain %q, got=%s", want, buf.String())
+		}
+	}
+
+	missing, _ := parseFailCondition("total_anonhugepages > 0")
+	if err := newFailChecker([]*failCondition{missing}).check(&buf); err == nil {
+		t.Error("want an error for a missing field")
+	}
+}
+
+func TestRunFailIf(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-columns", "Pathname,Rss"}); err != nil {
+		t.Fatal(err)
+	}
+	a.inputFilename = writeTestFile(t, testSmapsSorted)
+	a.outputFilename = filepath.Join(t.TempDir(), "out.csv")
+	for _, s := range []string{"total_rss > 3", "total_rss > 4M"} {
+		c, err := parseFailCondition(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.failConditions = append(a.failConditions, c)
+	}
+	if err := a.validate(fs); err != nil {
+		t.Fatal(err)
+	}
+	a.stats = &runStats{}
+	if err := run(a); err == nil || err.Error() != "1 -fail-if conditions hold" {
+		t.Errorf("got error %v", err)
+	}
+	// The output is written regardless.
+	got, err := os.ReadFile(a.outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Pathname,Rss\n/usr/bin/cat,4\n/usr/bin/cat,0\n"; string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
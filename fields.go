@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hnakamur/linuxprocsmapstocsv/smaps"
+)
+
+// readFieldsFile reads field names from the file at filename, one per
+// line. Blank lines and lines starting with '#' are ignored.
+func readFieldsFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var names []string
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		name := strings.TrimSpace(s.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		names = append(names, name)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// selectFields replaces the fields of m with the ones in names, in that
+// order. Fields missing in m get empty values.
+func (m *mapping) selectFields(names []string) {
+	values := make([]string, len(names))
+	units := make([]string, len(names))
+	for i, name := range names {
+		if j := m.fieldIndex(name); j != -1 {
+			values[i] = m.FieldValues[j]
+			units[i] = m.FieldUnits[j]
+		}
+	}
+	m.FieldNames = names
+	m.FieldValues = values
+	m.FieldUnits = units
+}
+
+func (m *mapping) fieldIndex(name string) int {
+	for i, n := range m.FieldNames {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *mapping) fieldValue(name string) (string, bool) {
+	if i := m.fieldIndex(name); i != -1 {
+		return m.FieldValues[i], true
+	}
+	return "", false
+}
+
+// numericFieldValue returns the value of the field as a number.
+func (m *mapping) numericFieldValue(name string) (float64, bool) {
+	s, ok := m.fieldValue(name)
+	if !ok {
+		return 0, false
+	}
+	return parseFieldNumber(s)
+}
+
+// parseFieldNumber parses a field value. Most values are sizes in kB,
+// which are parsed by parseKBValue without allocating; the others, e.g.
+// fractions of converted units, are parsed by strconv.ParseFloat.
+func parseFieldNumber(s string) (float64, bool) {
+	if kb, ok := parseKBValue(s); ok {
+		return float64(kb), true
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// parseKBValue parses a value of the output by smaps.ParseKB. Only the
+// plain digits are accepted, not the unit and the spaces ParseKB accepts
+// in the field lines, so a value is a number exactly when strconv would
+// parse it as one.
+func parseKBValue(s string) (uint64, bool) {
+	if s == "" || !isDigit(s[0]) || !isDigit(s[len(s)-1]) {
+		return 0, false
+	}
+	n, err := smaps.ParseKB(s)
+	return n, err == nil
+}
+
+// parseInt64Value parses an integer value. Sizes in kB are parsed by
+// parseKBValue and the others, e.g. negative deltas, by strconv.ParseInt.
+func parseInt64Value(s string) (int64, error) {
+	if n, ok := parseKBValue(s); ok && n <= math.MaxInt64 {
+		return int64(n), nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// parseUint64Value parses an unsigned integer value like parseInt64Value.
+func parseUint64Value(s string) (uint64, error) {
+	if n, ok := parseKBValue(s); ok {
+		return n, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// parseFloatValue parses a number value like parseFieldNumber, with the
+// error of strconv.ParseFloat.
+func parseFloatValue(s string) (float64, error) {
+	if n, ok := parseKBValue(s); ok {
+		return float64(n), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// fieldUnion collects the union of the field names of mappings. A name
+// first seen in a later mapping is placed after the field preceding it in
+// that mapping, so the order of the input is kept as far as possible.
+type fieldUnion struct {
+	names []string
+	units map[string]string
+}
+
+func newFieldUnion() *fieldUnion {
+	return &fieldUnion{units: make(map[string]string)}
+}
+
+func (u *fieldUnion) add(m *mapping) {
+	pos := 0
+	for i, name := range m.FieldNames {
+		if _, ok := u.units[name]; ok {
+			for j, n := range u.names {
+				if n == name {
+					pos = j + 1
+					break
+				}
+			}
+			continue
+		}
+		u.units[name] = m.FieldUnits[i]
+		u.names = append(u.names, "")
+		copy(u.names[pos+1:], u.names[pos:])
+		u.names[pos] = name
+		pos++
+	}
+}
+
+// align replaces the fields of m with the ones in the union. Fields
+// missing in m get empty values.
+func (u *fieldUnion) align(m *mapping) {
+	m.selectFields(u.names)
+	for i, name := range u.names {
+		if m.FieldUnits[i] == "" {
+			m.FieldUnits[i] = u.units[name]
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestConvertFieldNames(t *testing.T) {
+	input := `55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat
+Size:                  4 kB
+Rss:                   4 kB
+VmFlags: rd mr mw me
+55e000-55f000 r-xp 00001000 fe:00 1234                       /usr/bin/cat
+Size:                  4 kB
+Rss:                   0 kB
+THPeligible:           0
+VmFlags: rd ex mr mw me
+`
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := convertSmapsToCsv(w, strings.NewReader(input), args{fieldNames: []string{"Rss", "THPeligible"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Rss,THPeligible\n" +
+		"55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4,\n" +
+		"55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat,0,0\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestConvertUnionFields(t *testing.T) {
+	input := `55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat
+Size:                  4 kB
+Rss:                   4 kB
+VmFlags: rd mr mw me
+55e000-55f000 r-xp 00001000 fe:00 1234                       /usr/bin/cat
+Size:                  4 kB
+KernelPageSize:        4 kB
+Rss:                   0 kB
+THPeligible:           0
+VmFlags: rd ex mr mw me
+`
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := convertSmapsToCsv(w, strings.NewReader(input), args{unionFields: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Size,KernelPageSize,Rss,THPeligible,VmFlags\n" +
+		"55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4,,4,,rd mr mw me\n" +
+		"55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat,4,4,0,0,rd ex mr mw me\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+
+	buf.Reset()
+	w = csv.NewWriter(&buf)
+	if err := convertSmapsToCsv(w, strings.NewReader(input), args{}); err == nil {
+		t.Error("got no error for different fields without unionFields")
+	}
+}
+
+func TestParseFieldNumber(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want float64
+		ok   bool
+	}{
+		{s: "1234", want: 1234, ok: true},
+		{s: "-4", want: -4, ok: true},
+		{s: "0.5", want: 0.5, ok: true},
+		{s: "", ok: false},
+		{s: "rd mr", ok: false},
+		// Unlike smaps.ParseKB, only the plain values are numbers.
+		{s: "12 kB", ok: false},
+		{s: " 12", ok: false},
+		{s: "12 ", ok: false},
+	} {
+		got, ok := parseFieldNumber(tc.s)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%q: got %v, %v, want %v, %v", tc.s, got, ok, tc.want, tc.ok)
+		}
+	}
+	if n := testing.AllocsPerRun(100, func() { parseFieldNumber("1234") }); n != 0 {
+		t.Errorf("got %v allocations for a size in kB, want none", n)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// regionFilter selects the mappings to write by -filter-perms,
+// -filter-path and -min-rss.
+type regionFilter struct {
+	perms    map[string]bool
+	pathRe   *regexp.Regexp
+	minRssKB float64
+}
+
+// newRegionFilter returns a filter of the comma separated permissions,
+// the regular expression of pathnames and the minimum Rss in kB, or nil
+// if none of them is given.
+func newRegionFilter(perms, pathPattern string, minRssKB float64) (*regionFilter, error) {
+	if perms == "" && pathPattern == "" && minRssKB == 0 {
+		return nil, nil
+	}
+	f := &regionFilter{minRssKB: minRssKB}
+	if perms != "" {
+		f.perms = make(map[string]bool)
+		for _, p := range strings.Split(perms, ",") {
+			p = strings.TrimSpace(p)
+			if len(p) != 4 {
+				return nil, fmt.Errorf("invalid permissions in -filter-perms: %q", p)
+			}
+			f.perms[p] = true
+		}
+	}
+	if pathPattern != "" {
+		re, err := regexp.Compile(pathPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -filter-path: %w", err)
+		}
+		f.pathRe = re
+	}
+	return f, nil
+}
+
+// match reports whether m is to be written. Mappings without an Rss
+// field have zero Rss.
+func (f *regionFilter) match(m *mapping) bool {
+	if f.perms != nil && !f.perms[string(m.Region.Perms)] {
+		return false
+	}
+	if f.pathRe != nil && !f.pathRe.Match(m.Region.Pathname) {
+		return false
+	}
+	if f.minRssKB > 0 {
+		rss, _ := m.numericFieldValue("Rss")
+		if rss < f.minRssKB {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestConvertFilter(t *testing.T) {
+	input := "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nRss: 4 kB\n" +
+		"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nRss: 2048 kB\n" +
+		"7f0000000000-7f0000010000 r-xp 00000000 fe:00 42                         /usr/lib/libc.so.6\nRss: 1024 kB\n" +
+		"7f0000010000-7f0000011000 ---p 00000000 00:00 0 \nRss: 0 kB\n" +
+		"7f0000011000-7f0000020000 rw-p 00000000 fe:00 42                         /usr/lib/libc.so.6\nRss: 8 kB\n"
+	testCases := []struct {
+		name        string
+		filterPerms string
+		filterPath  string
+		minRss      float64
+		want        []string
+	}{
+		{name: "perms", filterPerms: "rw-p, r-xp", want: []string{"[heap]", "/usr/lib/libc.so.6", "/usr/lib/libc.so.6"}},
+		{name: "path", filterPath: `libc|\.so`, want: []string{"/usr/lib/libc.so.6", "/usr/lib/libc.so.6"}},
+		{name: "min rss", minRss: 1024, want: []string{"[heap]", "/usr/lib/libc.so.6"}},
+		{name: "all", filterPerms: "rw-p", filterPath: "libc", minRss: 1, want: []string{"/usr/lib/libc.so.6"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := newRegionFilter(tc.filterPerms, tc.filterPath, tc.minRss)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+				args{Separator: ",", filter: f}); err != nil {
+				t.Fatal(err)
+			}
+			records, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range records[1:] {
+				got = append(got, r[6])
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("pathnames mismatch, got=%q, want=%q", got, tc.want)
+			}
+		})
+	}
+
+	for _, perms := range []string{"rw", "rw-p,"} {
+		if _, err := newRegionFilter(perms, "", 0); err == nil {
+			t.Errorf("perms=%q: got no error", perms)
+		}
+	}
+	if _, err := newRegionFilter("", "(", 0); err == nil {
+		t.Error("got no error for an invalid regular expression")
+	}
+	if f, err := newRegionFilter("", "", 0); f != nil || err != nil {
+		t.Errorf("got filter %v, error %v without conditions", f, err)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// flagSetting is a flag of the file of -config with its values, of which
+// a list has more than one.
+type flagSetting struct {
+	line   int
+	name   string
+	values []string
+	list   bool
+}
+
+// applyFlagsFile sets the flags of fs which are not set on the command
+// line to the values of the file of -config, so that the command line
+// overrides the file. The keys of the file are the names of the flags,
+// with '_' for '-' allowed, e.g.
+//
+//	p: [1234, 5678]
+//	kind: smaps_rollup
+//	interval: 15s
+//	filter_path: '^/(usr|opt)/'
+//	format: ndjson
+//	o: /var/lib/smaps/collect.ndjson
+//	sink:
+//	  - prom:/var/lib/node_exporter/smaps.prom
+//
+// A list sets a repeatable flag, e.g. -sink, for each of its values and
+// any other flag to the values joined with commas, e.g. -p and -columns.
+func applyFlagsFile(fs *flag.FlagSet, filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	settings, err := parseFlagsFile(filename, data)
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", filename, err)
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	seen := make(map[string]bool)
+	for _, s := range settings {
+		if err := s.apply(fs, set, seen); err != nil {
+			if s.line > 0 {
+				return fmt.Errorf("%s:%d: %w", filename, s.line, err)
+			}
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+func (s flagSetting) apply(fs *flag.FlagSet, set, seen map[string]bool) error {
+	name := strings.ReplaceAll(s.name, "_", "-")
+	f := fs.Lookup(name)
+	switch {
+	case f == nil:
+		return fmt.Errorf("unknown flag %q", s.name)
+	case name == "config":
+		return errors.New("-config cannot be set in the config file")
+	case seen[name]:
+		return fmt.Errorf("flag %q is set more than once", s.name)
+	}
+	seen[name] = true
+	if set[name] {
+		return nil
+	}
+	values := s.values
+	if _, repeatable := f.Value.(*stringListFlag); !repeatable && s.list {
+		values = []string{strings.Join(values, ",")}
+	}
+	for _, v := range values {
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("-%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// parseFlagsFile parses the settings of a file of -config by the format
+// of its extension: flat YAML with scalars and lists, flat TOML with
+// scalars and arrays, or a JSON object.
+func parseFlagsFile(filename string, data []byte) ([]flagSetting, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return parseFlagsYAML(string(data))
+	case ".toml":
+		return parseFlagsTOML(string(data))
+	case ".json":
+		return parseFlagsJSON(data)
+	default:
+		return nil, errors.New("unsupported extension, which must be .yaml, .yml, .toml or .json")
+	}
+}
+
+// parseFlagsYAML parses the subset of YAML of a mapping of keys to
+// scalars, flow lists "[a, b]" or block lists of "- a" lines.
+func parseFlagsYAML(data string) ([]flagSetting, error) {
+	var settings []flagSetting
+	// block is the setting whose block list is being read.
+	var block *flagSetting
+	for i, line := range strings.Split(data, "\n") {
+		lineNo := i + 1
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if block == nil {
+				return nil, fmt.Errorf("line %d: list item without a key", lineNo)
+			}
+			v, err := parseConfigScalar(strings.TrimPrefix(trimmed, "-"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			block.values = append(block.values, v)
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested mappings are not supported", lineNo)
+		}
+		if block != nil && len(block.values) == 0 {
+			return nil, fmt.Errorf("line %d: key %q has no value", block.line, block.name)
+		}
+		block = nil
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: want key: value", lineNo)
+		}
+		s := flagSetting{line: lineNo, name: strings.TrimSpace(key)}
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "" || strings.HasPrefix(value, "#"):
+			s.list = true
+			settings = append(settings, s)
+			block = &settings[len(settings)-1]
+			continue
+		case strings.HasPrefix(value, "["):
+			values, err := parseConfigList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			s.values, s.list = values, true
+		default:
+			v, err := parseConfigScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			s.values = []string{v}
+		}
+		settings = append(settings, s)
+	}
+	if block != nil && len(block.values) == 0 {
+		return nil, fmt.Errorf("line %d: key %q has no value", block.line, block.name)
+	}
+	return settings, nil
+}
+
+// parseFlagsTOML parses the subset of TOML of keys with scalars or
+// arrays on one line, without tables.
+func parseFlagsTOML(data string) ([]flagSetting, error) {
+	var settings []flagSetting
+	for i, line := range strings.Split(data, "\n") {
+		lineNo := i + 1
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: tables are not supported", lineNo)
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: want key = value", lineNo)
+		}
+		s := flagSetting{line: lineNo, name: strings.Trim(strings.TrimSpace(key), `"`)}
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "[") {
+			values, err := parseConfigList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			s.values, s.list = values, true
+		} else {
+			v, err := parseConfigScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			s.values = []string{v}
+		}
+		settings = append(settings, s)
+	}
+	return settings, nil
+}
+
+// parseFlagsJSON parses an object of strings, numbers, booleans or
+// arrays of them. The settings are sorted by key as JSON objects have
+// no order.
+func parseFlagsJSON(data []byte) ([]flagSetting, error) {
+	var object map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&object); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	settings := make([]flagSetting, 0, len(names))
+	for _, name := range names {
+		s := flagSetting{name: name}
+		items, list := object[name].([]interface{})
+		if !list {
+			items = []interface{}{object[name]}
+		}
+		for _, item := range items {
+			switch v := item.(type) {
+			case string:
+				s.values = append(s.values, v)
+			case json.Number:
+				s.values = append(s.values, v.String())
+			case bool:
+				s.values = append(s.values, strconv.FormatBool(v))
+			default:
+				return nil, fmt.Errorf("key %q: unsupported value %v", name, item)
+			}
+		}
+		if len(s.values) == 0 {
+			return nil, fmt.Errorf("key %q: empty list", name)
+		}
+		s.list = list
+		settings = append(settings, s)
+	}
+	return settings, nil
+}
+
+// parseConfigScalar parses a value quoted with double quotes, which has
+// the escapes of Go, single quotes, in which a quote is doubled, or
+// none, where a comment starting with " #" is removed.
+func parseConfigScalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := closingQuote(s)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		if rest := strings.TrimSpace(s[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after string", rest)
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		end := closingQuote(s)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		if rest := strings.TrimSpace(s[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after string", rest)
+		}
+		return strings.ReplaceAll(s[1:end], "''", "'"), nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if s == "" {
+		return "", errors.New("empty value")
+	}
+	return s, nil
+}
+
+// closingQuote returns the index of the quote closing the string at the
+// start of s, or -1 if there is none.
+func closingQuote(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// parseConfigList parses a list "[a, b]" of scalars on one line.
+func parseConfigList(s string) ([]string, error) {
+	var values []string
+	rest := strings.TrimSpace(strings.TrimPrefix(s, "["))
+	for {
+		if strings.HasPrefix(rest, "]") {
+			if after := strings.TrimSpace(rest[1:]); after != "" && !strings.HasPrefix(after, "#") {
+				return nil, fmt.Errorf("unexpected %q after list", after)
+			}
+			if len(values) == 0 {
+				return nil, errors.New("empty list")
+			}
+			return values, nil
+		}
+		end := strings.IndexAny(rest, ",]")
+		if strings.HasPrefix(rest, `"`) || strings.HasPrefix(rest, "'") {
+			q := closingQuote(rest)
+			if q < 0 {
+				return nil, fmt.Errorf("unterminated string %s", rest)
+			}
+			end = strings.IndexAny(rest[q:], ",]")
+			if end >= 0 {
+				end += q
+			}
+		}
+		if end < 0 {
+			return nil, errors.New("unterminated list")
+		}
+		v, err := parseConfigScalar(rest[:end])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		if rest[end] == ',' {
+			end++
+		}
+		rest = strings.TrimSpace(rest[end:])
+	}
+}
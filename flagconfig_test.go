@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFlagsFile(t *testing.T) {
+	want := []flagSetting{
+		{name: "p", values: []string{"1234", "5678"}, list: true},
+		{name: "kind", values: []string{"smaps_rollup"}},
+		{name: "filter", values: []string{"Rss > 1024 # kB"}},
+		{name: "columns", values: []string{"Pid,Rss"}},
+		{name: "sink", values: []string{"prom:/tmp/smaps.prom", "ndjson:unix:/run/collector.sock"}, list: true},
+	}
+	for _, tc := range []struct {
+		filename string
+		data     string
+	}{
+		{
+			filename: "collect.yaml",
+			data: "# collector\n---\np: [1234, 5678]\nkind: smaps_rollup # rollup only\n" +
+				"filter: 'Rss > 1024 # kB'\ncolumns: \"Pid,Rss\"\nsink:\n  - prom:/tmp/smaps.prom\n  - ndjson:unix:/run/collector.sock\n",
+		},
+		{
+			filename: "collect.toml",
+			data: "# collector\np = [1234, 5678]\nkind = \"smaps_rollup\"\n" +
+				"filter = 'Rss > 1024 # kB'\ncolumns = \"Pid,Rss\"\nsink = [\"prom:/tmp/smaps.prom\", \"ndjson:unix:/run/collector.sock\"]\n",
+		},
+	} {
+		got, err := parseFlagsFile(tc.filename, []byte(tc.data))
+		if err != nil {
+			t.Errorf("%s: %v", tc.filename, err)
+			continue
+		}
+		for i := range got {
+			got[i].line = 0
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: result mismatch,\n got=%+v,\nwant=%+v", tc.filename, got, want)
+		}
+	}
+
+	got, err := parseFlagsFile("collect.json", []byte(`{"p": [1234, 5678], "append": true, "min_rss": 1.5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []flagSetting{
+		{name: "append", values: []string{"true"}},
+		{name: "min_rss", values: []string{"1.5"}},
+		{name: "p", values: []string{"1234", "5678"}, list: true},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("json: result mismatch,\n got=%+v,\nwant=%+v", got, want)
+	}
+}
+
+func TestParseFlagsFileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		filename string
+		data     string
+		wantErr  string
+	}{
+		{filename: "a.ini", data: "p=1", wantErr: "unsupported extension"},
+		{filename: "a.yaml", data: "p: 1\n- 2\n", wantErr: "line 2: list item without a key"},
+		{filename: "a.yaml", data: "sink:\nkind: smaps\n", wantErr: `line 1: key "sink" has no value`},
+		{filename: "a.yaml", data: "p:\n  pids: 1\n", wantErr: "line 2: nested mappings are not supported"},
+		{filename: "a.yaml", data: "filter: 'Rss\n", wantErr: "line 1: unterminated string"},
+		{filename: "a.yaml", data: "p: [1, 2\n", wantErr: "line 1: unterminated list"},
+		{filename: "a.toml", data: "[collect]\n", wantErr: "line 1: tables are not supported"},
+		{filename: "a.toml", data: "p 1\n", wantErr: "line 1: want key = value"},
+		{filename: "a.json", data: `{"p": {"a": 1}}`, wantErr: `key "p": unsupported value`},
+	} {
+		_, err := parseFlagsFile(tc.filename, []byte(tc.data))
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s %q: got error %v, want %q", tc.filename, tc.data, err, tc.wantErr)
+		}
+	}
+}
+
+func TestApplyFlagsFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "collect.yaml")
+	data := "p: [1, 2]\ncolumns: [Pathname, Rss]\nsep: ';'\nsink:\n  - csv:a.csv\n  - csv:b.csv\nunion_fields: true\n"
+	if err := os.WriteFile(filename, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	pidList := fs.String("p", "", "")
+	a.registerFlags(fs)
+	// The command line overrides the file.
+	if err := fs.Parse([]string{"-sep", "\t"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyFlagsFile(fs, filename); err != nil {
+		t.Fatal(err)
+	}
+	if *pidList != "1,2" || a.columnList != "Pathname,Rss" || a.Separator != "\t" || !a.unionFields {
+		t.Errorf("got -p %q, -columns %q, -sep %q and -union-fields %v", *pidList, a.columnList, a.Separator, a.unionFields)
+	}
+	if got, want := []string(a.sinkSpecs), []string{"csv:a.csv", "csv:b.csv"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("-sink = %q, want %q", got, want)
+	}
+
+	for _, tc := range []struct {
+		data    string
+		wantErr string
+	}{
+		{data: "no_such_flag: 1\n", wantErr: `collect.yaml:1: unknown flag "no_such_flag"`},
+		{data: "sep: ','\nsep: ';'\n", wantErr: `collect.yaml:2: flag "sep" is set more than once`},
+		{data: "\nunion-fields: maybe\n", wantErr: "collect.yaml:2: -union-fields: "},
+	} {
+		if err := os.WriteFile(filename, []byte(tc.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var a args
+		a.registerFlags(fs)
+		err := applyFlagsFile(fs, filename)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%q: got error %v, want %q", tc.data, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+//go:build !minimal
+
+package main
+
+import "encoding/binary"
+
+// flatTable is a table of the FlatBuffers format built by
+// buildFlatBuffer, whose fields are indexed by their ids. A field is nil
+// if absent, a scalar of flatScalar, a string, a table of flatTable, a
+// vector of tables of []flatTable or a vector of 8-byte aligned structs
+// of flatStructs. A union is a flatU8 of its type followed by its table.
+type flatTable []interface{}
+
+// flatScalar is a little endian scalar field of a flatTable.
+type flatScalar []byte
+
+func flatU8(v byte) flatScalar { return flatScalar{v} }
+
+func flatBool(v bool) flatScalar {
+	if v {
+		return flatScalar{1}
+	}
+	return flatScalar{0}
+}
+
+func flatI16(v int16) flatScalar {
+	return appendLittleEndian16(nil, uint16(v))
+}
+
+func flatI32(v int32) flatScalar {
+	return appendLittleEndian32(nil, uint32(v))
+}
+
+func flatI64(v int64) flatScalar {
+	return appendLittleEndian64(nil, uint64(v))
+}
+
+// flatStructs are the bytes of the elements of a vector of 16-byte
+// structs aligned to 8 bytes, such as FieldNode and Buffer of Arrow.
+type flatStructs []byte
+
+// flatBuilder lays out a FlatBuffer from the front, writing each object
+// before the objects it refers to, as the offsets to them are unsigned.
+type flatBuilder struct {
+	b []byte
+}
+
+// buildFlatBuffer returns a FlatBuffer of the root table.
+func buildFlatBuffer(root flatTable) []byte {
+	f := &flatBuilder{b: make([]byte, 4)}
+	f.patch(0, f.table(root))
+	return f.b
+}
+
+func (f *flatBuilder) pad(align int) {
+	for len(f.b)%align != 0 {
+		f.b = append(f.b, 0)
+	}
+}
+
+// patch sets the offset at the position at to target.
+func (f *flatBuilder) patch(at, target int) {
+	binary.LittleEndian.PutUint32(f.b[at:], uint32(target-at))
+}
+
+// table writes the vtable and the table t and returns the position of t.
+func (f *flatBuilder) table(t flatTable) int {
+	// The inline fields follow the offset to the vtable in descending
+	// order of their sizes, each aligned to its size.
+	offsets := make([]int, len(t))
+	size := 4
+	for _, want := range []int{8, 4, 2, 1} {
+		for id, v := range t {
+			if v == nil || flatInlineSize(v) != want {
+				continue
+			}
+			size = (size + want - 1) / want * want
+			offsets[id] = size
+			size += want
+		}
+	}
+
+	f.pad(2)
+	vtable := len(f.b)
+	f.b = appendLittleEndian16(f.b, uint16(4+2*len(t)))
+	f.b = appendLittleEndian16(f.b, uint16(size))
+	for _, offset := range offsets {
+		f.b = appendLittleEndian16(f.b, uint16(offset))
+	}
+
+	f.pad(8)
+	pos := len(f.b)
+	f.b = appendLittleEndian32(f.b, uint32(pos-vtable))
+	f.b = append(f.b, make([]byte, size-4)...)
+	for id, v := range t {
+		if s, ok := v.(flatScalar); ok {
+			copy(f.b[pos+offsets[id]:], s)
+		}
+	}
+	for id, v := range t {
+		if _, ok := v.(flatScalar); v == nil || ok {
+			continue
+		}
+		f.patch(pos+offsets[id], f.object(v))
+	}
+	return pos
+}
+
+// flatInlineSize returns the size of the field v in its table.
+func flatInlineSize(v interface{}) int {
+	if s, ok := v.(flatScalar); ok {
+		return len(s)
+	}
+	return 4
+}
+
+// object writes the string, table or vector v and returns its position.
+func (f *flatBuilder) object(v interface{}) int {
+	switch v := v.(type) {
+	case flatTable:
+		return f.table(v)
+	case string:
+		f.pad(4)
+		pos := len(f.b)
+		f.b = appendLittleEndian32(f.b, uint32(len(v)))
+		f.b = append(f.b, v...)
+		f.b = append(f.b, 0)
+		return pos
+	case []flatTable:
+		f.pad(4)
+		pos := len(f.b)
+		f.b = appendLittleEndian32(f.b, uint32(len(v)))
+		f.b = append(f.b, make([]byte, 4*len(v))...)
+		for i, t := range v {
+			f.patch(pos+4+4*i, f.table(t))
+		}
+		return pos
+	case flatStructs:
+		// The length precedes the elements aligned to 8 bytes.
+		f.pad(8)
+		f.b = append(f.b, 0, 0, 0, 0)
+		pos := len(f.b)
+		f.b = appendLittleEndian32(f.b, uint32(len(v)/16))
+		f.b = append(f.b, v...)
+		return pos
+	}
+	panic("unsupported flatbuffers value")
+}
+
+func appendLittleEndian16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendLittleEndian32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendLittleEndian64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
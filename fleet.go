@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hnakamur/linuxprocsmapstocsv/smaps"
+)
+
+// fleetMarker starts the smaps of each process in the output of the
+// remote script of the fleet subcommand, followed by the pid and the
+// command name.
+const fleetMarker = "==> smaps "
+
+// runFleet runs the fleet subcommand, which reads the smaps of the
+// matching processes on hosts over SSH in parallel and writes them into
+// one CSV with Host, Pid and Comm columns, like the merge subcommand.
+func runFleet(arguments []string) (err error) {
+	fs := flag.NewFlagSet("fleet", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s fleet -hosts <file> [-match <pattern>] [-o <file>] [conversion options]\n\n"+
+			"Only a POSIX shell, cat and pgrep are needed on the hosts. With -strict, hosts which\n"+
+			"cannot be collected from and conflicts of the merge are errors instead of warnings.\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	var args args
+	hostsFilename := fs.String("hosts", "", "file of the hosts to collect from, one per line as accepted by ssh, e.g. an Ansible inventory flattened with ansible-inventory --list; empty lines and lines starting with # are ignored")
+	match := fs.String("match", "", "pgrep pattern of the command names of the processes to collect, e.g. ^nginx$ (default: all processes)")
+	parallel := fs.Int("parallel", 8, "number of hosts to collect from at the same time")
+	sshCommand := fs.String("ssh", "ssh -o BatchMode=yes", "command to run the collection script on a host, which is given the host and the script as arguments")
+	outputFilename := fs.String("o", stdioName, "output CSV filename, or \"-\" for the standard output")
+	checkpointDir := fs.String("checkpoint", "", "directory to save the outputs of the hosts into as they are collected, removed when the run succeeds, so that an interrupted run can be continued with -resume")
+	resume := fs.Bool("resume", false, "continue the interrupted run of -checkpoint, collecting only from the hosts not saved in it")
+	plan := fs.Bool("plan", false, "print the hosts which would be collected from and the output, without connecting to the hosts")
+	args.registerFlags(fs)
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if *hostsFilename == "" {
+		fs.Usage()
+		return errors.New("-hosts must be set")
+	}
+	if *parallel <= 0 {
+		return errors.New("-parallel must be positive")
+	}
+	if *resume && *checkpointDir == "" {
+		return errors.New("-resume requires -checkpoint")
+	}
+	if err := args.validate(fs); err != nil {
+		return err
+	}
+	if err := args.validateFleet(); err != nil {
+		return err
+	}
+	if err := args.prepare(); err != nil {
+		return err
+	}
+	hosts, err := readHostList(*hostsFilename)
+	if err != nil {
+		return err
+	}
+	if *plan {
+		writeFleetPlan(os.Stdout, hosts, strings.Fields(*sshCommand), *match, *outputFilename)
+		return nil
+	}
+	stats := &runStats{}
+	if args.summaryPath != "" {
+		startTime := time.Now()
+		defer func() {
+			s := newRunSummary(stats, time.Since(startTime), err)
+			if err := writeSummary(args.summaryPath, s, args.outputFileOptions); err != nil {
+				log.Printf("warning: write summary: %v", err)
+			}
+		}()
+	}
+
+	var cp *checkpoint
+	if *checkpointDir != "" {
+		if cp, err = openCheckpoint(*checkpointDir, *resume); err != nil {
+			return err
+		}
+	}
+	outputs, err := collectFleetResumable(cp, hosts, strings.Fields(*sshCommand), fleetScript(*match), *parallel, args.retry, *outputFilename)
+	if err != nil {
+		return err
+	}
+	m := &csvMerge{}
+	m.comma, _ = utf8.DecodeRuneInString(args.Separator)
+	var failed int
+	for i, host := range hosts {
+		if outputs[i].err == nil {
+			if outputs[i].err = m.addFleetHost(host, outputs[i].data, args); outputs[i].err != nil {
+				outputs[i].failures++
+			}
+		}
+		stats.addSource(host, outputs[i].failures, outputs[i].err)
+		if outputs[i].err != nil {
+			failed++
+			stats.warnings++
+			log.Printf("warning: %s: %v", host, outputs[i].err)
+			continue
+		}
+		stats.inputFiles = append(stats.inputFiles, host)
+	}
+	if failed == len(hosts) {
+		return errors.New("no hosts could be collected from")
+	}
+	if args.strict && failed > 0 {
+		return fmt.Errorf("%d of %d hosts could not be collected from", failed, len(hosts))
+	}
+	data, conflicts, err := m.csv()
+	if err != nil {
+		return err
+	}
+	for _, c := range conflicts {
+		stats.warnings++
+		log.Printf("warning: %s", c)
+	}
+	if args.strict && len(conflicts) > 0 {
+		return fmt.Errorf("%d conflicts found", len(conflicts))
+	}
+	if err := writeOutputFile(*outputFilename, data, args.outputFileOptions); err != nil {
+		return err
+	}
+	if *outputFilename != stdioName {
+		stats.outputFiles = append(stats.outputFiles, *outputFilename)
+	}
+	if cp != nil {
+		if err := cp.remove(); err != nil {
+			log.Printf("warning: remove checkpoint: %v", err)
+		}
+	}
+	return nil
+}
+
+// collectFleetResumable collects from the hosts like collectFleet, except
+// that the outputs of the hosts saved in the checkpoint cp are read from
+// it, and the others are saved into it as they are collected. cp may be
+// nil.
+func collectFleetResumable(cp *checkpoint, hosts, sshCommand []string, script string, parallel int, retry retryPolicy, output string) ([]fleetOutput, error) {
+	if cp == nil {
+		return collectFleet(hosts, sshCommand, script, parallel, retry, nil), nil
+	}
+	outputs := make([]fleetOutput, len(hosts))
+	var rest []string
+	var restIndexes []int
+	for i, host := range hosts {
+		data, ok, err := cp.read(host)
+		if err != nil {
+			return nil, fmt.Errorf("%s: read checkpoint: %w", host, err)
+		}
+		if ok {
+			outputs[i] = fleetOutput{data: data}
+			continue
+		}
+		rest = append(rest, host)
+		restIndexes = append(restIndexes, i)
+	}
+	var mu sync.Mutex
+	for j, o := range collectFleet(rest, sshCommand, script, parallel, retry, func(host string, data []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := cp.save(host, data, output); err != nil {
+			log.Printf("warning: %s: save checkpoint: %v", host, err)
+		}
+	}) {
+		outputs[restIndexes[j]] = o
+	}
+	return outputs, nil
+}
+
+// validateFleet rejects the options which read local files about the
+// processes, as the processes are on the hosts.
+func (a *args) validateFleet() error {
+	switch {
+	case a.dumpDir != "", a.hostPaths, a.resolveInodes, a.mountColumns, a.swapDevices, a.pagemap, a.pageContent > 0, a.mincore, a.threadStacks, a.numa, a.nsPid, a.cgroupPath, a.withProcInfo:
+		return errors.New("-dump-dir, -host-paths, -resolve-inodes, -mounts, -swap-devices, -pagemap, -page-content, -mincore, -thread-stacks, -numa, -ns-pid, -cgroup-path and -with-proc-info are not supported by fleet")
+	case a.keepRawDir != "", a.teeRawPath != "", len(a.sinks) > 0, a.splitsOutput(), a.interval > 0:
+		return errors.New("-keep-raw, -tee-raw, -sink, -max-rows, -max-size and -interval are not supported by fleet")
+	case a.noHeader, a.crlf, a.quote != "" && a.quote != quoteMinimal:
+		return errors.New("-no-header, -crlf and -quote are not supported by fleet")
+	}
+	return nil
+}
+
+// readHostList reads the hosts in filename, one per line.
+func readHostList(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var hosts []string
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts in %s", filename)
+	}
+	return hosts, nil
+}
+
+// fleetScript returns the shell script run on each host, which prints
+// the smaps of each process matching the pgrep pattern, or of all
+// processes if it is empty, after a line of fleetMarker, the pid and the
+// command name. Processes whose smaps are not readable are skipped.
+func fleetScript(match string) string {
+	pids := "ls /proc | grep '^[0-9][0-9]*$'"
+	if match != "" {
+		pids = "pgrep -- " + shellQuote(match)
+	}
+	return "for p in $(" + pids + "); do " +
+		"s=$(cat /proc/$p/smaps 2>/dev/null) || continue; " +
+		"[ -n \"$s\" ] || continue; " +
+		"printf '" + fleetMarker + "%s %s\\n%s\\n' \"$p\" \"$(cat /proc/$p/comm 2>/dev/null)\" \"$s\"; " +
+		"done"
+}
+
+// shellQuote quotes s as a single word of a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fleetOutput is the output of the script on a host.
+type fleetOutput struct {
+	data []byte
+	err  error
+	// failures is the number of the failed attempts to collect from the
+	// host, including the last one if err is not nil.
+	failures int
+}
+
+// collectFleet runs the script on the hosts with at most parallel hosts
+// at the same time, and returns their outputs in the order of hosts. A
+// host is collected from again after an SSH connection failure as
+// retry allows. collected is called with the output of each host collected from
+// successfully as soon as it is, unless it is nil.
+func collectFleet(hosts, sshCommand []string, script string, parallel int, retry retryPolicy, collected func(host string, data []byte)) []fleetOutput {
+	outputs := make([]fleetOutput, len(hosts))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, host string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			var data []byte
+			src := smaps.SSHSource{Host: host, Command: sshCommand}
+			failures, err := retry.do(isTransientSSHError, func() error {
+				var err error
+				data, err = src.Run(script)
+				return err
+			})
+			if err == nil && collected != nil {
+				collected(host, data)
+			}
+			outputs[i] = fleetOutput{data: data, err: err, failures: failures}
+		}(i, host)
+	}
+	wg.Wait()
+	return outputs
+}
+
+// fleetProcess is the smaps of a process in the output of a host.
+type fleetProcess struct {
+	pid   int
+	comm  string
+	smaps []byte
+}
+
+// splitFleetOutput splits the output of the script on a host into the
+// smaps of each process.
+func splitFleetOutput(data []byte) ([]fleetProcess, error) {
+	var procs []fleetProcess
+	for len(data) > 0 {
+		line := data
+		rest := []byte(nil)
+		if i := bytes.IndexByte(data, '\n'); i != -1 {
+			line, rest = data[:i], data[i+1:]
+		}
+		data = rest
+		if bytes.HasPrefix(line, []byte(fleetMarker)) {
+			pidStr, comm, _ := strings.Cut(string(line[len(fleetMarker):]), " ")
+			pid, err := strconv.Atoi(pidStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pid in %q", line)
+			}
+			procs = append(procs, fleetProcess{pid: pid, comm: comm})
+			continue
+		}
+		if len(procs) == 0 {
+			return nil, fmt.Errorf("unexpected output before the first process: %q", line)
+		}
+		p := &procs[len(procs)-1]
+		p.smaps = append(append(p.smaps, line...), '\n')
+	}
+	return procs, nil
+}
+
+// addFleetHost converts the smaps of the processes in the output of host
+// and adds them as inputs with Pid and Comm columns.
+func (m *csvMerge) addFleetHost(host string, data []byte, args args) error {
+	procs, err := splitFleetOutput(data)
+	if err != nil {
+		return err
+	}
+	for _, p := range procs {
+		name := fmt.Sprintf("%s:/proc/%d/smaps", host, p.pid)
+		args.anomalies = &anomalyLog{file: name}
+		// The records are converted with the default separator, as the
+		// merged output is written with that of -sep.
+		var buf bytes.Buffer
+		if err := convertSmapsToCsv(csv.NewWriter(&buf), bytes.NewReader(p.smaps), args); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		in, err := readMergeInput(&buf, name)
+		if err != nil {
+			return err
+		}
+		in.host = host
+		pid, comm := p.pid, p.comm
+		if args.pseudonymizer != nil {
+			pid, comm = args.pseudonymizer.pid(pid), args.pseudonymizer.hash(comm)
+		}
+		in.header = append([]string{columnPid, columnComm}, in.header...)
+		for i, row := range in.rows {
+			in.rows[i] = append([]string{strconv.Itoa(pid), comm}, row...)
+		}
+		m.inputs = append(m.inputs, in)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitFleetOutput(t *testing.T) {
+	data := fleetMarker + "10 nginx\n" + testSmapsSorted + fleetMarker + "11 my app\n" + testSmapsSorted
+	procs, err := splitFleetOutput([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) != 2 {
+		t.Fatalf("process count mismatch, got=%d, want=2", len(procs))
+	}
+	for i, want := range []fleetProcess{{pid: 10, comm: "nginx"}, {pid: 11, comm: "my app"}} {
+		if procs[i].pid != want.pid || procs[i].comm != want.comm || string(procs[i].smaps) != testSmapsSorted {
+			t.Errorf("process %d mismatch, got=%d %q %q", i, procs[i].pid, procs[i].comm, procs[i].smaps)
+		}
+	}
+
+	if _, err := splitFleetOutput([]byte(testSmapsSorted)); err == nil {
+		t.Error("got no error for output without a process")
+	}
+}
+
+func TestFleetScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	// The script must be valid even if the pattern has quotes.
+	out, err := exec.Command("sh", "-n", "-c", fleetScript(`it's`)).CombinedOutput()
+	if err != nil {
+		t.Errorf("invalid script: %v: %s", err, out)
+	}
+	if got := shellQuote(`it's`); got != `'it'\''s'` {
+		t.Errorf("quote mismatch, got=%s", got)
+	}
+}
+
+func TestRunFleet(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	// The fake ssh prints the smaps of a process on web1 and fails on
+	// web2 instead of running the script.
+	ssh := filepath.Join(dir, "ssh")
+	output := filepath.Join(dir, "web1.out")
+	if err := os.WriteFile(output, []byte(fleetMarker+"10 cat\n"+testSmapsSorted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\n[ \"$1\" = web1 ] || { echo unreachable >&2; exit 255; }\ncat " + output + "\n"
+	if err := os.WriteFile(ssh, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	hosts := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(hosts, []byte("# web servers\nweb1\n\nweb2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	outputFilename := filepath.Join(dir, "out.csv")
+	arguments := []string{"-hosts", hosts, "-ssh", ssh, "-o", outputFilename, "-columns", "Pathname,Rss"}
+	if err := runFleet(arguments); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Host,Pid,Comm,Pathname,Rss\nweb1,10,cat,/usr/bin/cat,4\nweb1,10,cat,/usr/bin/cat,0\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+
+	err = runFleet(append(arguments, "-strict"))
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 hosts could not be collected from") {
+		t.Errorf("error mismatch, got=%v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// outputFormatFolded writes the groups of -group-by as folded stacks.
+const outputFormatFolded = "folded"
+
+// stackGroup returns the group of -group-by stack, which is the category
+// and the pathname of m as frames of a folded stack, e.g.
+// "lib;/usr/lib/libc.so.6".
+func stackGroup(m *mapping) string {
+	return foldedFrame(m.Category) + ";" + foldedFrame(pathnameGroup(string(m.Region.Pathname)))
+}
+
+// foldedFrame replaces the characters which separate frames and the
+// value in a line of folded stacks.
+func foldedFrame(s string) string {
+	return strings.NewReplacer(";", ":", "\n", " ").Replace(s)
+}
+
+// foldedWriter writes the rows of groups as folded stacks, one
+// "frame;frame value" line per group weighted by Pss in kB, which is the
+// input of flamegraph.pl and speedscope. The process of a group is the
+// first frame in the form comm-pid if the rows have a Pid column.
+type foldedWriter struct {
+	file    *outputFile
+	headers headerRecords
+	bw      *bufio.Writer
+	err     error
+}
+
+func newFoldedWriter(file *outputFile, headerLines int) *foldedWriter {
+	return &foldedWriter{file: file, headers: headerRecords{headerLines: headerLines}, bw: bufio.NewWriter(file)}
+}
+
+func (w *foldedWriter) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.headers.take(record) {
+		return nil
+	}
+	header := w.headers.header
+	groupIndex, pssIndex := indexOf(header, "Group"), indexOf(header, "Pss")
+	if groupIndex == -1 || pssIndex == -1 || groupIndex >= len(record) || pssIndex >= len(record) {
+		w.err = errors.New("-format folded requires the Group and Pss columns")
+		return w.err
+	}
+	group := record[groupIndex]
+	if group == "[total]" {
+		return nil
+	}
+	pss, err := strconv.ParseFloat(record[pssIndex], 64)
+	if err != nil || math.Round(pss) <= 0 {
+		// Stacks without weight are not drawn.
+		return nil
+	}
+	if i := indexOf(header, columnPid); i != -1 && i < len(record) {
+		process := record[i]
+		if j := indexOf(header, columnComm); j != -1 && j < len(record) && record[j] != "" {
+			process = foldedFrame(record[j]) + "-" + process
+		}
+		w.bw.WriteString(process + ";")
+	}
+	w.bw.WriteString(group)
+	w.bw.WriteByte(' ')
+	w.bw.WriteString(strconv.FormatFloat(math.Round(pss), 'f', 0, 64))
+	w.bw.WriteByte('\n')
+	return nil
+}
+
+func (w *foldedWriter) Flush() {
+	if w.err == nil {
+		w.err = w.bw.Flush()
+	}
+}
+
+func (w *foldedWriter) Error() error {
+	return w.err
+}
+
+func (w *foldedWriter) Close() error {
+	w.Flush()
+	if w.err != nil {
+		w.file.abort()
+		return w.err
+	}
+	return w.file.commit()
+}
+
+func (w *foldedWriter) Abort() {
+	w.file.abort()
+}
+
+func (w *foldedWriter) Files() []string {
+	return []string{w.file.name}
+}
+
+// validateFolded defaults -group-by of -format folded to stack, and
+// checks that the Pss of the groups is in kB.
+func (a *args) validateFolded() error {
+	if a.format != outputFormatFolded {
+		return nil
+	}
+	if a.groupBy == "" {
+		a.groupBy = groupByStack
+	}
+	switch {
+	case canonicalUnits(a.units) != unitsKB:
+		return errors.New("-format folded requires -units kB")
+	case a.shape == shapeLong:
+		return errors.New("-format folded cannot be used with -shape long")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunFolded(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	input := "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/lib/libc.so.6\nPss: 4 kB\n" +
+		"55e000-55f000 r-xp 00001000 fe:00 1234                       /usr/lib/libc.so.6\nPss: 8 kB\n" +
+		"560000-580000 rw-p 00000000 00:00 0                          [heap]\nPss: 12 kB\n" +
+		"7f0000000000-7f0000001000 rw-p 00000000 00:00 0 \nPss: 0 kB\n"
+	for _, pid := range []string{"9", "10"} {
+		if err := os.MkdirAll(filepath.Join(procRoot, pid), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(procRoot, pid, "smaps"), []byte(input), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name      string
+		arguments []string
+		batch     bool
+		want      string
+	}{
+		{
+			name:  "processes",
+			batch: true,
+			want: "9;lib;/usr/lib/libc.so.6 12\n9;heap;[heap] 12\n" +
+				"10;lib;/usr/lib/libc.so.6 12\n10;heap;[heap] 12\n",
+		},
+		{
+			name:      "group-by",
+			arguments: []string{"-group-by", "perms", "-totals"},
+			want:      "r--p 4\nr-xp 8\nrw-p 12\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			var a args
+			a.registerFlags(fs)
+			if err := fs.Parse(tc.arguments); err != nil {
+				t.Fatal(err)
+			}
+			a.format = outputFormatFolded
+			a.inputFilename = filepath.Join(procRoot, "9", "smaps")
+			if tc.batch {
+				a.inputFilename = filepath.Join(procRoot, "[0-9]*", "smaps")
+				if err := a.resolveInputs(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			a.outputFilename = filepath.Join(t.TempDir(), "out.folded")
+			if err := a.validate(fs); err != nil {
+				t.Fatal(err)
+			}
+			if err := run(a); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(a.outputFilename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateFolded(t *testing.T) {
+	a := args{format: outputFormatFolded, units: "KB"}
+	if err := a.validateFolded(); err != nil || a.groupBy != groupByStack {
+		t.Errorf("unexpected result, err=%v, groupBy=%q", err, a.groupBy)
+	}
+	a = args{format: outputFormatFolded, units: unitsMiB}
+	if err := a.validateFolded(); err == nil || !strings.Contains(err.Error(), "-units kB") {
+		t.Errorf("unexpected result with -units MiB, err=%v", err)
+	}
+}
+
+func TestStackGroup(t *testing.T) {
+	m := &mapping{Region: &region{Pathname: []byte("/tmp/a;b")}, Category: "file"}
+	if got, want := stackGroup(m), "file;/tmp/a:b"; got != want {
+		t.Errorf("result mismatch, got=%q, want=%q", got, want)
+	}
+}
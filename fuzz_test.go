@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+)
+
+func FuzzConvertSmapsToCsv(f *testing.F) {
+	f.Add(testSmapsUnsorted)
+	f.Add("55d000-55e000 r--p 00000000 fe:00 1234 /usr/bin/cat\nRss: 4 kB\nVmFlags: rd mr\n")
+	f.Add("55d000-55e000 r--p 00000000 fe:00 1234\nRss 4 kB\n")
+	f.Add("Rss: 4 kB\n")
+	f.Add("no colon\n")
+	f.Add("zz-yy r--p 0 0 0 0\nSize: x kB\n")
+	f.Add("55d000-55e000 r--p 00000000 fe:00 1234 /a\nSize: 4 kB\n55e000-55f000 r--p 00000000 fe:00 1234 /a\nRss: 4 kB")
+	f.Fuzz(func(t *testing.T, input string) {
+		for _, a := range []args{
+			{},
+			{sortOrder: sortByAddresses, units: unitsPages, unitConverter: &unitConverter{units: unitsPages, pageSize: 4096}},
+			{fieldNames: []string{"Rss", "Size"}, compat: newKernelCompatNormalizer(), canonicalOrder: true},
+		} {
+			w := csv.NewWriter(io.Discard)
+			// Errors are expected for malformed input, but it must
+			// never panic.
+			_ = convertSmapsToCsv(w, strings.NewReader(input), a)
+		}
+	})
+}
@@ -1,3 +1,17 @@
 module github.com/hnakamur/linuxprocsmapstocsv
 
-go 1.13
+go 1.18
+
+require (
+	github.com/klauspost/compress v1.15.15
+	golang.org/x/sys v0.25.0
+	google.golang.org/grpc v1.56.3
+	google.golang.org/protobuf v1.30.0
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	golang.org/x/net v0.9.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+)
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Keys of -group-by.
+const (
+	groupByTopDir   = "top-dir"
+	groupByAnonName = "anon-name"
+	groupByPathname = "pathname"
+	groupByBasename = "basename"
+	groupByPerms    = "perms"
+	groupByCategory = "category"
+	groupByStack    = "stack"
+)
+
+// groupKeyFuncs are the functions returning the group of a mapping for
+// each key of -group-by.
+var groupKeyFuncs = map[string]func(m *mapping) string{
+	groupByTopDir:   func(m *mapping) string { return topDirGroup(string(m.Region.Pathname)) },
+	groupByAnonName: func(m *mapping) string { return anonNameGroup(string(m.Region.Pathname)) },
+	groupByPathname: func(m *mapping) string { return pathnameGroup(string(m.Region.Pathname)) },
+	groupByBasename: func(m *mapping) string { return basenameGroup(string(m.Region.Pathname)) },
+	groupByPerms:    func(m *mapping) string { return string(m.Region.Perms) },
+	groupByCategory: func(m *mapping) string { return m.Category },
+	groupByStack:    stackGroup,
+}
+
+// pathnameGroup returns pathname, or "[anon]" for mappings without a
+// pathname.
+func pathnameGroup(pathname string) string {
+	if pathname == "" {
+		return "[anon]"
+	}
+	return pathname
+}
+
+// basenameGroup returns the last element of pathname of a file, e.g.
+// "libc.so.6", which groups the same library in different directories,
+// or pathnameGroup for other mappings.
+func basenameGroup(pathname string) string {
+	if !strings.HasPrefix(pathname, "/") {
+		return pathnameGroup(pathname)
+	}
+	return path.Base(pathname)
+}
+
+// topDirDepths are the directories whose subdirectories are groups of
+// their own, as each of them is typically an application.
+var topDirDepths = map[string]bool{
+	"/home": true,
+	"/opt":  true,
+	"/snap": true,
+	"/srv":  true,
+}
+
+// topDirGroup returns the top-level path component of pathname, e.g.
+// "/usr" or "/opt/app", or the kind of a mapping without a file, e.g.
+// "[heap]" or "[anon]".
+func topDirGroup(pathname string) string {
+	pathname = strings.TrimSuffix(pathname, " (deleted)")
+	if kind, _ := classifyShm(pathname); kind == shmKindMemfd || kind == shmKindSysV {
+		return "[" + kind + "]"
+	}
+	switch {
+	case pathname == "" || strings.HasPrefix(pathname, "[anon:"):
+		return "[anon]"
+	case !strings.HasPrefix(pathname, "/"):
+		return pathname
+	}
+	components := strings.SplitN(pathname[1:], "/", 3)
+	dir := "/" + components[0]
+	if topDirDepths[dir] && len(components) > 2 {
+		dir += "/" + components[1]
+	}
+	return dir
+}
+
+// mappingGroups aggregates mappings into groups having the number of
+// regions and the sums of kB fields. Mappings of different processes
+// are in different groups.
+type mappingGroups struct {
+	key func(m *mapping) string
+	// fieldNames are the names of the summed fields in the order of
+	// appearance.
+	fieldNames []string
+	fieldIndex map[string]int
+	groups     []*mappingGroup
+	byKey      map[string]*mappingGroup
+	// acrossProcesses is true if mappings of different processes are in
+	// the same group.
+	acrossProcesses bool
+	// maxMemory is the size of the groups in bytes above which they are
+	// spilled to file in runs sorted by their keys, or zero. size is the
+	// estimated size of the groups in memory, and err is the error of
+	// spilling them, which is returned by each.
+	maxMemory int64
+	size      int64
+	file      *spillFile
+	err       error
+}
+
+type mappingGroup struct {
+	key     string
+	name    string
+	process *processInfo
+	regions int
+	sums    []float64
+}
+
+func newMappingGroups(key string) (*mappingGroups, error) {
+	f, ok := groupKeyFuncs[key]
+	if !ok {
+		return nil, fmt.Errorf("unsupported group key: %q", key)
+	}
+	return &mappingGroups{key: f, fieldIndex: make(map[string]int), byKey: make(map[string]*mappingGroup)}, nil
+}
+
+func (gs *mappingGroups) add(m *mapping) {
+	name := gs.key(m)
+	key := name
+	if m.Process != nil && !gs.acrossProcesses {
+		key = strconv.Itoa(m.Process.Pid) + "\x00" + name
+	}
+	g := gs.byKey[key]
+	if g == nil {
+		g = &mappingGroup{key: key, name: name, process: m.Process}
+		gs.byKey[key] = g
+		gs.groups = append(gs.groups, g)
+		gs.size += groupSize(key)
+	}
+	g.regions++
+	for i, name := range m.FieldNames {
+		if m.FieldUnits[i] != unitsKB || isPageSizeField(name) {
+			continue
+		}
+		v, ok := parseFieldNumber(m.FieldValues[i])
+		if !ok {
+			continue
+		}
+		j, ok := gs.fieldIndex[name]
+		if !ok {
+			j = len(gs.fieldNames)
+			gs.fieldIndex[name] = j
+			gs.fieldNames = append(gs.fieldNames, name)
+		}
+		for len(g.sums) <= j {
+			g.sums = append(g.sums, 0)
+			gs.size += 8
+		}
+		g.sums[j] += v
+	}
+	if gs.maxMemory > 0 && gs.size > gs.maxMemory && gs.err == nil {
+		gs.err = gs.spill()
+	}
+}
+
+// mappings returns the groups as mappings having the same fields.
+func (gs *mappingGroups) mappings() []*mapping {
+	ms := make([]*mapping, 0, len(gs.groups))
+	for _, g := range gs.groups {
+		ms = append(ms, gs.groupMapping(g))
+	}
+	return ms
+}
+
+func (gs *mappingGroups) groupMapping(g *mappingGroup) *mapping {
+	m := &mapping{Region: &region{}, Group: g.name, Regions: g.regions, Process: g.process}
+	for j, name := range gs.fieldNames {
+		var sum float64
+		if j < len(g.sums) {
+			sum = g.sums[j]
+		}
+		m.appendField(name, strconv.FormatFloat(sum, 'f', -1, 64), unitsKB)
+	}
+	return m
+}
+
+// each calls fn with the groups as mappings having the same fields, in
+// the order of appearance, or of their keys if they are spilled.
+func (gs *mappingGroups) each(fn func(m *mapping) error) error {
+	if gs.err != nil {
+		return gs.err
+	}
+	if gs.file == nil {
+		for _, m := range gs.mappings() {
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return gs.eachMerged(func(g *mappingGroup) error {
+		return fn(gs.groupMapping(g))
+	})
+}
+
+// newTotalGroups returns groups having a single group of all mappings.
+func newTotalGroups() *mappingGroups {
+	return &mappingGroups{
+		key:             func(m *mapping) string { return "[total]" },
+		fieldIndex:      make(map[string]int),
+		byKey:           make(map[string]*mappingGroup),
+		acrossProcesses: true,
+	}
+}
+
+// totalMapping returns the group of all mappings as a total row having the
+// fields names with units, whose pathname is "[total]", or nil if no
+// mappings are added. Fields which are not summed are empty.
+func (gs *mappingGroups) totalMapping(names, units []string) *mapping {
+	ms := gs.mappings()
+	if len(ms) == 0 {
+		return nil
+	}
+	m := ms[0]
+	m.Process = nil
+	m.Region.Pathname = []byte(m.Group)
+	m.selectFields(names)
+	m.FieldUnits = units
+	return m
+}
+
+// eachSubtotal calls fn with the groups as subtotal rows having the
+// fields names with units, whose pathname is "[subtotal:<group>]". Fields
+// which are not summed are empty.
+func (gs *mappingGroups) eachSubtotal(names, units []string, fn func(m *mapping) error) error {
+	return gs.each(func(m *mapping) error {
+		m.Region.Pathname = []byte("[subtotal:" + m.Group + "]")
+		m.selectFields(names)
+		m.FieldUnits = units
+		return fn(m)
+	})
+}
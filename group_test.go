@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestTopDirGroup(t *testing.T) {
+	testCases := []struct {
+		pathname, want string
+	}{
+		{pathname: "/usr/lib/x86_64-linux-gnu/libc.so.6", want: "/usr"},
+		{pathname: "/opt/app/bin/server", want: "/opt/app"},
+		{pathname: "/opt/server", want: "/opt"},
+		{pathname: "/tmp/cache (deleted)", want: "/tmp"},
+		{pathname: "/memfd:pool (deleted)", want: "[memfd]"},
+		{pathname: "", want: "[anon]"},
+		{pathname: "[anon:scudo:primary]", want: "[anon]"},
+		{pathname: "[heap]", want: "[heap]"},
+	}
+	for _, tc := range testCases {
+		if got := topDirGroup(tc.pathname); got != tc.want {
+			t.Errorf("pathname=%q: result mismatch, got=%q, want=%q", tc.pathname, got, tc.want)
+		}
+	}
+}
+
+func TestConvertGroupBy(t *testing.T) {
+	input := "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nSize: 4 kB\nRss: 4 kB\nVmFlags: rd mr\n" +
+		"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nSize: 136 kB\nRss: 12 kB\nVmFlags: rd wr\n" +
+		"7f0000000000-7f0000010000 r--p 00000000 fe:00 42                         /usr/lib/libc.so.6\nSize: 64 kB\nRss: 32 kB\nVmFlags: rd mr\n" +
+		"7f0000010000-7f0000020000 rw-p 00000000 00:00 0 \nSize: 64 kB\nRss: 8 kB\nVmFlags: rd wr\n"
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", floatFormat: defaultFloatFormat, groupBy: groupByTopDir, derivedColumns: []derivedColumn{mustParseDerivedColumn(t, "RssRatio=Rss/Size")}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "Group,Regions,Size,Rss,RssRatio\n" +
+		"/usr,2,68,36,0.5294117647058824\n" +
+		"[heap],1,136,12,0.08823529411764706\n" +
+		"[anon],1,64,8,0.125\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func mustParseDerivedColumn(t *testing.T, def string) derivedColumn {
+	t.Helper()
+	c, err := parseDerivedColumn(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestConvertAggregate(t *testing.T) {
+	input := "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nRss: 4 kB\nSwap: 0 kB\n" +
+		"55e000-55f000 r-xp 00001000 fe:00 1234                       /usr/bin/cat\nRss: 8 kB\nSwap: 0 kB\n" +
+		"7f0000000000-7f0000010000 r--p 00000000 fe:00 42                         /usr/lib/libc.so.6\nRss: 32 kB\nSwap: 0 kB\n" +
+		"7f0000010000-7f0000020000 rw-p 00000000 00:00 0 \nRss: 8 kB\nSwap: 4 kB\n" +
+		"7f0000020000-7f0000030000 r--p 00000000 fe:00 43                         /opt/app/lib/libc.so.6\nRss: 16 kB\nSwap: 0 kB\n"
+	testCases := []struct {
+		key  string
+		want string
+	}{
+		{
+			key: groupByPathname,
+			want: "Group,Regions,Rss,Swap\n" +
+				"/usr/bin/cat,2,12,0\n" +
+				"/usr/lib/libc.so.6,1,32,0\n" +
+				"[anon],1,8,4\n" +
+				"/opt/app/lib/libc.so.6,1,16,0\n",
+		},
+		{
+			key: groupByBasename,
+			want: "Group,Regions,Rss,Swap\n" +
+				"cat,2,12,0\n" +
+				"libc.so.6,2,48,0\n" +
+				"[anon],1,8,4\n",
+		},
+		{
+			key: groupByPerms,
+			want: "Group,Regions,Rss,Swap\n" +
+				"r--p,3,52,0\n" +
+				"r-xp,1,8,0\n" +
+				"rw-p,1,8,4\n",
+		},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+			args{Separator: ",", floatFormat: defaultFloatFormat, groupBy: tc.key}); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("key=%s: result mismatch,\n got=%s,\nwant=%s", tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestConvertSubtotals(t *testing.T) {
+	input := "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nKernelPageSize: 4 kB\nRss: 4 kB\nTHPeligible: 0\n" +
+		"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nKernelPageSize: 4 kB\nRss: 12 kB\nTHPeligible: 0\n" +
+		"7f0000000000-7f0000010000 r--p 00000000 fe:00 42                         /usr/lib/libc.so.6\nKernelPageSize: 4 kB\nRss: 32 kB\nTHPeligible: 0\n" +
+		"7f0000010000-7f0000020000 rw-p 00000000 00:00 0 \nKernelPageSize: 4 kB\nRss: 8 kB\nTHPeligible: 0\n"
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", floatFormat: defaultFloatFormat, subtotals: groupByCategory, categoryColumn: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Category,KernelPageSize,Rss,THPeligible\n" +
+		"55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,file,4,4,0\n" +
+		"55e000,580000,rw-p,00000000,00:00,0,[heap],heap,4,12,0\n" +
+		"7f0000000000,7f0000010000,r--p,00000000,fe:00,42,/usr/lib/libc.so.6,lib,4,32,0\n" +
+		"7f0000010000,7f0000020000,rw-p,00000000,00:00,0,,anon,4,8,0\n" +
+		",,,,,,[subtotal:file],,,4,\n" +
+		",,,,,,[subtotal:heap],,,12,\n" +
+		",,,,,,[subtotal:lib],,,32,\n" +
+		",,,,,,[subtotal:anon],,,8,\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+)
+
+// growthLogHeader is the header of the growth log, written when the file
+// is created. Sizes are in kB.
+var growthLogHeader = []string{"Timestamp", "Pid", "HeapSize", "HeapRss", "StackSize", "StackRss"}
+
+// growthSample is the sizes of the heap and the main thread stack of a
+// process in a capture.
+type growthSample struct {
+	pid                 int
+	heapSize, heapRss   int64
+	stackSize, stackRss int64
+}
+
+// growthTracker tracks the heap and stack sizes of each process in a
+// capture. Appending a sample of every capture to the growth log makes a
+// compact series answering whether the heap or stack of a process grows,
+// without keeping the full conversions.
+type growthTracker struct {
+	samples []*growthSample
+}
+
+// add adds the sizes of m to the sample of the process pid if m is the
+// heap or the stack.
+func (t *growthTracker) add(pid int, m *mapping) {
+	pathname := string(m.Region.Pathname)
+	if pathname != "[heap]" && pathname != "[stack]" {
+		return
+	}
+	var s *growthSample
+	for _, sample := range t.samples {
+		if sample.pid == pid {
+			s = sample
+			break
+		}
+	}
+	if s == nil {
+		s = &growthSample{pid: pid}
+		t.samples = append(t.samples, s)
+	}
+	size, _ := m.numericFieldValue("Size")
+	rss, _ := m.numericFieldValue("Rss")
+	if pathname == "[heap]" {
+		s.heapSize += int64(size)
+		s.heapRss += int64(rss)
+	} else {
+		s.stackSize += int64(size)
+		s.stackRss += int64(rss)
+	}
+}
+
+// growthLog is a CSV file which a sample per process is appended to by
+// each run.
+type growthLog struct {
+	file *os.File
+}
+
+func openGrowthLog(path string) (*growthLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &growthLog{file: file}, nil
+}
+
+// append appends the samples of t captured at timestamp.
+func (l *growthLog) append(timestamp string, t *growthTracker) error {
+	st, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(l.file)
+	if st.Size() == 0 {
+		if err := w.Write(growthLogHeader); err != nil {
+			return err
+		}
+	}
+	for _, s := range t.samples {
+		pid := ""
+		if s.pid != 0 {
+			pid = strconv.Itoa(s.pid)
+		}
+		if err := w.Write([]string{
+			timestamp,
+			pid,
+			strconv.FormatInt(s.heapSize, 10),
+			strconv.FormatInt(s.heapRss, 10),
+			strconv.FormatInt(s.stackSize, 10),
+			strconv.FormatInt(s.stackRss, 10),
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func (l *growthLog) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGrowthLogAppend(t *testing.T) {
+	input := `55e000-580000 rw-p 00000000 00:00 0                          [heap]
+Size:                136 kB
+Rss:                  12 kB
+7f0000300000-7f0000301000 r--p 00000000 fe:00 1234                       /usr/lib/libc.so.6
+Size:                  4 kB
+Rss:                   4 kB
+7ffd0000-7ffd1000 rw-p 00000000 00:00 0                          [stack]
+Size:                132 kB
+Rss:                   8 kB
+`
+	path := filepath.Join(t.TempDir(), "growth.csv")
+	for _, timestamp := range []string{"2024-01-02T03:04:05Z", "2024-01-02T03:05:05Z"} {
+		tracker := &growthTracker{}
+		var buf bytes.Buffer
+		if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+			args{Separator: ",", growth: tracker, inputFilename: "/proc/1234/smaps"}); err != nil {
+			t.Fatal(err)
+		}
+		l, err := openGrowthLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.append(timestamp, tracker); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Timestamp,Pid,HeapSize,HeapRss,StackSize,StackRss\n" +
+		"2024-01-02T03:04:05Z,1234,136,12,132,8\n" +
+		"2024-01-02T03:05:05Z,1234,136,12,132,8\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sort"
+	"strconv"
+)
+
+// regionGrowth is the growth of the metric of a region between the first
+// and the last snapshot of a series.
+type regionGrowth struct {
+	key         regionKey
+	first, last float64
+	// newRegion is true if the region is missing in the first snapshot.
+	newRegion bool
+}
+
+func (g regionGrowth) growth() float64 {
+	return g.last - g.first
+}
+
+// growthPercent returns the growth relative to the first snapshot, which
+// is not defined for new regions and regions growing from zero.
+func (g regionGrowth) growthPercent() (float64, bool) {
+	if g.newRegion || g.first == 0 {
+		return 0, false
+	}
+	return g.growth() / g.first * 100, true
+}
+
+// growths returns the growths of the regions in the last snapshot.
+func (s *regionSeries) growths() []regionGrowth {
+	if len(s.snapshots) < 2 {
+		return nil
+	}
+	var growths []regionGrowth
+	for _, key := range s.keys {
+		values := s.values[key]
+		if len(values) < len(s.snapshots) || values[len(values)-1] == "" {
+			continue
+		}
+		last, err := strconv.ParseFloat(values[len(values)-1], 64)
+		if err != nil {
+			continue
+		}
+		g := regionGrowth{key: key, last: last, newRegion: values[0] == ""}
+		if !g.newRegion {
+			if g.first, err = strconv.ParseFloat(values[0], 64); err != nil {
+				continue
+			}
+		}
+		growths = append(growths, g)
+	}
+	return growths
+}
+
+// growthReport returns a CSV report of the top regions with the largest
+// absolute growth and the top regions with the largest relative growth
+// of the metric between the first and the last snapshot. Regions which
+// did not grow are omitted.
+func (s *regionSeries) growthReport(top int) ([]byte, error) {
+	growths := s.growths()
+	absolute := append([]regionGrowth(nil), growths...)
+	sort.SliceStable(absolute, func(i, j int) bool { return absolute[i].growth() > absolute[j].growth() })
+	var relative []regionGrowth
+	for _, g := range growths {
+		if _, ok := g.growthPercent(); ok {
+			relative = append(relative, g)
+		}
+	}
+	sort.SliceStable(relative, func(i, j int) bool {
+		pi, _ := relative[i].growthPercent()
+		pj, _ := relative[j].growthPercent()
+		return pi > pj
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := []string{"Ranking", "Rank"}
+	if s.hasPid {
+		header = append(header, "Pid")
+	}
+	header = append(append(header, s.regionColumns()...), "First", "Last", "Growth", "GrowthPercent")
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, ranking := range []struct {
+		name    string
+		growths []regionGrowth
+	}{
+		{name: "absolute", growths: absolute},
+		{name: "relative", growths: relative},
+	} {
+		for i, g := range ranking.growths {
+			if i == top || g.growth() <= 0 {
+				break
+			}
+			record := []string{ranking.name, strconv.Itoa(i + 1)}
+			if s.hasPid {
+				record = append(record, strconv.Itoa(g.key.pid))
+			}
+			percent := ""
+			if p, ok := g.growthPercent(); ok {
+				percent = strconv.FormatFloat(p, 'f', 1, 64)
+			}
+			first := ""
+			if !g.newRegion {
+				first = strconv.FormatFloat(g.first, 'f', -1, 64)
+			}
+			record = append(append(record, s.regionValues(g.key)...),
+				first, strconv.FormatFloat(g.last, 'f', -1, 64), strconv.FormatFloat(g.growth(), 'f', -1, 64), percent)
+			if err := w.Write(record); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGrowthReport(t *testing.T) {
+	snapshots := []string{
+		"55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/app\nPss: 4 kB\n" +
+			"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nPss: 1000 kB\n" +
+			"7f0000000000-7f0000001000 rw-p 00000000 00:00 0 \nPss: 10 kB\n",
+		"55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/app\nPss: 4 kB\n" +
+			"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nPss: 1500 kB\n",
+		"55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/app\nPss: 2 kB\n" +
+			"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nPss: 1800 kB\n" +
+			"7f0000000000-7f0000001000 rw-p 00000000 00:00 0 \nPss: 40 kB\n" +
+			"7f0000001000-7f0000002000 rw-p 00000000 00:00 0 \nPss: 400 kB\n",
+	}
+	s := newRegionSeries("Pss")
+	for i, snapshot := range snapshots {
+		if err := s.readSnapshot(string(rune('a'+i)), 0, strings.NewReader(snapshot)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := s.growthReport(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Ranking,Rank,AddressStart,AddressEnd,Pathname,First,Last,Growth,GrowthPercent\n" +
+		"absolute,1,55e000,580000,[heap],1000,1800,800,80.0\n" +
+		"absolute,2,7f0000001000,7f0000002000,,,400,400,\n" +
+		"relative,1,7f0000000000,7f0000001000,,10,40,30,300.0\n" +
+		"relative,2,55e000,580000,[heap],1000,1800,800,80.0\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+
+	"github.com/hnakamur/linuxprocsmapstocsv/smapspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer is the gRPC server of the serve subcommand.
+type grpcServer struct {
+	smapspb.UnimplementedSmapsConverterServer
+	args args
+}
+
+// newGRPCServer returns a gRPC server accepting requests of at most
+// maxRequestSize bytes with the additional options opts.
+func newGRPCServer(args args, maxRequestSize int64, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(append([]grpc.ServerOption{grpc.MaxRecvMsgSize(int(maxRequestSize))}, opts...)...)
+	smapspb.RegisterSmapsConverterServer(s, &grpcServer{args: args})
+	return s
+}
+
+// serveGRPC serves gRPC on ln with the TLS and the authentication of sec
+// until an error occurs.
+func serveGRPC(ln net.Listener, args args, maxRequestSize int64, sec *serveSecurity) error {
+	return newGRPCServer(args, maxRequestSize, sec.grpcOptions()...).Serve(ln)
+}
+
+// grpcOptions returns the options of the gRPC server for TLS and the
+// bearer tokens in the authorization metadata.
+func (s *serveSecurity) grpcOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if s.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	}
+	if s.tokens != nil {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if err := s.authorizeGRPC(ctx); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := s.authorizeGRPC(ss.Context()); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}))
+	}
+	return opts
+}
+
+func (s *serveSecurity) authorizeGRPC(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if s.authorized(v) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "unauthorized")
+}
+
+// sendError is an error sending a message to the client.
+type sendError struct {
+	err error
+}
+
+func (e *sendError) Error() string { return e.err.Error() }
+
+func (s *grpcServer) ConvertSmaps(req *smapspb.ConvertSmapsRequest, stream smapspb.SmapsConverter_ConvertSmapsServer) error {
+	err := convertMappings(bytes.NewReader(req.Smaps), s.args.forRequest(), func(m *mapping) error {
+		if err := stream.Send(m.toProto()); err != nil {
+			return &sendError{err: err}
+		}
+		return nil
+	})
+	var se *sendError
+	if errors.As(err, &se) {
+		return se.err
+	}
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+func (m *mapping) toProto() *smapspb.Mapping {
+	pm := &smapspb.Mapping{
+		AddressStart: string(m.Region.AddressStart),
+		AddressEnd:   string(m.Region.AddressEnd),
+		Perms:        string(m.Region.Perms),
+		Offset:       string(m.Region.Offset),
+		Dev:          string(m.Region.Dev),
+		Inode:        string(m.Region.Inode),
+		Pathname:     string(m.Region.Pathname),
+		Fields:       make([]*smapspb.Field, len(m.FieldNames)),
+		LineNo:       int64(m.LineNo),
+	}
+	for i, name := range m.FieldNames {
+		pm.Fields[i] = &smapspb.Field{Name: name, Value: m.FieldValues[i], Unit: m.FieldUnits[i]}
+	}
+	return pm
+}
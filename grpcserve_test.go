@@ -0,0 +1,110 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/hnakamur/linuxprocsmapstocsv/smapspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCServerConvertSmaps(t *testing.T) {
+	ln := bufconn.Listen(1 << 20)
+	s := newGRPCServer(args{sortOrder: sortByAddresses}, 1<<20)
+	go s.Serve(ln)
+	defer s.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := smapspb.NewSmapsConverterClient(conn)
+
+	stream, err := client.ConvertSmaps(context.Background(), &smapspb.ConvertSmapsRequest{Smaps: []byte(testSmapsUnsorted)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []*smapspb.Mapping
+	for {
+		m, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, m)
+	}
+	if len(got) != 3 {
+		t.Fatalf("mapping count mismatch, got=%d, want=3", len(got))
+	}
+	if got, want := got[0].AddressStart, "55d000"; got != want {
+		t.Errorf("first address mismatch, got=%s, want=%s", got, want)
+	}
+	if f := got[2].Fields[1]; f.Name != "Rss" || f.Value != "4" || f.Unit != "kB" {
+		t.Errorf("field mismatch, got=%v", f)
+	}
+
+	stream, err = client.ConvertSmaps(context.Background(), &smapspb.ConvertSmapsRequest{Smaps: []byte("Size: 4 kB\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("error code mismatch, got=%v, want=%v", err, codes.InvalidArgument)
+	}
+}
+
+func TestServeSecurityGRPC(t *testing.T) {
+	sec := &serveSecurity{tokens: []string{"secret"}}
+	ln := bufconn.Listen(1 << 20)
+	s := newGRPCServer(args{}, 1<<20, sec.grpcOptions()...)
+	go s.Serve(ln)
+	defer s.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := smapspb.NewSmapsConverterClient(conn)
+
+	for _, tc := range []struct {
+		token string
+		want  codes.Code
+	}{
+		{token: "", want: codes.Unauthenticated},
+		{token: "secret", want: codes.OK},
+	} {
+		ctx := context.Background()
+		if tc.token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+tc.token)
+		}
+		stream, err := client.ConvertSmaps(ctx, &smapspb.ConvertSmapsRequest{Smaps: []byte(testSmapsSorted)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for err == nil {
+			_, err = stream.Recv()
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		if got := status.Code(err); got != tc.want {
+			t.Errorf("code mismatch with %q, got=%v, want=%v", tc.token, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hostPathResolver resolves file pathnames of a process, which are
+// relative to its root directory, to pathnames on the host. For a process
+// in a container the host pathname is under the root of the container,
+// e.g. an overlayfs merged directory.
+type hostPathResolver struct {
+	root string
+}
+
+func newHostPathResolver(pid int) (*hostPathResolver, error) {
+	if pid <= 0 {
+		return nil, errors.New("pid of the target process is unknown; use /proc/<pid>/smaps as input")
+	}
+	root, err := os.Readlink(procPath(pid, "root"))
+	if err != nil {
+		return nil, fmt.Errorf("resolve root directory of process %d: %w", pid, err)
+	}
+	return &hostPathResolver{root: root}, nil
+}
+
+// resolve returns the host pathname of pathname. Pseudo paths such as
+// "[heap]" and anonymous regions resolve to an empty string, and the
+// " (deleted)" suffix is kept.
+func (r *hostPathResolver) resolve(pathname string) string {
+	if !strings.HasPrefix(pathname, "/") {
+		return ""
+	}
+	deleted := strings.HasSuffix(pathname, deletedSuffix)
+	hostPath := filepath.Join(r.root, strings.TrimSuffix(pathname, deletedSuffix))
+	if deleted {
+		hostPath += deletedSuffix
+	}
+	return hostPath
+}
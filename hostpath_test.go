@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestHostPathResolverResolve(t *testing.T) {
+	r := &hostPathResolver{root: "/var/lib/docker/overlay2/abc/merged"}
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{in: "/usr/lib/libc.so.6", want: "/var/lib/docker/overlay2/abc/merged/usr/lib/libc.so.6"},
+		{in: "/tmp/x (deleted)", want: "/var/lib/docker/overlay2/abc/merged/tmp/x (deleted)"},
+		{in: "[heap]", want: ""},
+		{in: "", want: ""},
+	}
+	for _, tc := range testCases {
+		if got := r.resolve(tc.in); got != tc.want {
+			t.Errorf("in=%s: result mismatch, got=%q, want=%q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestNewHostPathResolverSelf(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("procfs is supported only on Linux")
+	}
+	r, err := newHostPathResolver(os.Getpid())
+	if err != nil {
+		t.Skip(err)
+	}
+	if got, want := r.resolve("/usr/lib/x"), r.root+"/usr/lib/x"; r.root != "/" && got != want {
+		t.Errorf("result mismatch, got=%q, want=%q", got, want)
+	}
+	if r.root == "/" {
+		if got, want := r.resolve("/usr/lib/x"), "/usr/lib/x"; got != want {
+			t.Errorf("result mismatch, got=%q, want=%q", got, want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// deviceNumber is the major and minor numbers of a device.
+type deviceNumber struct {
+	major, minor uint32
+}
+
+// parseDeviceNumber parses a device number like "fd:01" in smaps with
+// base 16 or "253:1" in mountinfo with base 10.
+func parseDeviceNumber(s string, base int) (deviceNumber, error) {
+	majorStr, minorStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return deviceNumber{}, fmt.Errorf("invalid device number: %q", s)
+	}
+	major, err := strconv.ParseUint(majorStr, base, 32)
+	if err != nil {
+		return deviceNumber{}, fmt.Errorf("invalid device number: %q", s)
+	}
+	minor, err := strconv.ParseUint(minorStr, base, 32)
+	if err != nil {
+		return deviceNumber{}, fmt.Errorf("invalid device number: %q", s)
+	}
+	return deviceNumber{major: uint32(major), minor: uint32(minor)}, nil
+}
+
+// inodeResolver resolves the device and inode of regions without a
+// pathname, e.g. some shmem mappings, to a file of the process. The
+// directories to search are the mount points of the device in
+// /proc/<pid>/mountinfo, or the search directories if given, and they
+// are searched through /proc/<pid>/root so that the pathnames are the
+// ones seen by the process.
+type inodeResolver struct {
+	root   string
+	mounts *mountInfo
+	search []string
+	// indexes are the pathnames of the inodes of each device searched
+	// so far.
+	indexes map[deviceNumber]map[uint64]string
+}
+
+func newInodeResolver(pid int, search []string) (*inodeResolver, error) {
+	if pid <= 0 {
+		return nil, errors.New("pid of the target process is unknown; use /proc/<pid>/smaps as input")
+	}
+	mounts, err := readMountInfo(pid)
+	if err != nil {
+		return nil, err
+	}
+	return &inodeResolver{
+		root:    procPath(pid, "root"),
+		mounts:  mounts,
+		search:  search,
+		indexes: make(map[deviceNumber]map[uint64]string),
+	}, nil
+}
+
+// resolve returns the pathname of the file with the inode on the device
+// dev of r, or an empty string if r has a pathname, the inode is zero or
+// no file is found.
+func (ir *inodeResolver) resolve(r *region) string {
+	if len(r.Pathname) != 0 {
+		return ""
+	}
+	inode, err := strconv.ParseUint(string(r.Inode), 10, 64)
+	if err != nil || inode == 0 {
+		return ""
+	}
+	dev, err := parseDeviceNumber(string(r.Dev), 16)
+	if err != nil {
+		return ""
+	}
+	index, ok := ir.indexes[dev]
+	if !ok {
+		index = ir.index(dev)
+		ir.indexes[dev] = index
+	}
+	return index[inode]
+}
+
+// index walks the directories to search for dev and returns the pathnames
+// of the inodes on dev. Files on other devices, i.e. under other mount
+// points, are skipped.
+func (ir *inodeResolver) index(dev deviceNumber) map[uint64]string {
+	index := make(map[uint64]string)
+	dirs := ir.search
+	if len(dirs) == 0 {
+		dirs = ir.mounts.mountPoints(dev)
+	}
+	for _, dir := range dirs {
+		// The trailing slash makes the walk follow /proc/<pid>/root,
+		// which is a symbolic link.
+		top := filepath.Join(ir.root, dir) + "/"
+		filepath.WalkDir(top, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Skip unreadable directories and keep walking.
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			fileDev, ino, ok := fileDeviceInode(info)
+			if !ok || fileDev != dev {
+				if d.IsDir() && path != top {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if _, ok := index[ino]; !ok {
+				rel, err := filepath.Rel(ir.root, path)
+				if err == nil {
+					index[ino] = filepath.Join("/", rel)
+				}
+			}
+			return nil
+		})
+	}
+	return index
+}
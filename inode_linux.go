@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileDeviceInode returns the device and inode numbers of the file of
+// info.
+func fileDeviceInode(info os.FileInfo) (deviceNumber, uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return deviceNumber{}, 0, false
+	}
+	dev := uint64(st.Dev)
+	return deviceNumber{major: unix.Major(dev), minor: unix.Minor(dev)}, st.Ino, true
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+func fileDeviceInode(info os.FileInfo) (deviceNumber, uint64, bool) {
+	return deviceNumber{}, 0, false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestParseDeviceNumber(t *testing.T) {
+	testCases := []struct {
+		in      string
+		base    int
+		want    deviceNumber
+		wantErr bool
+	}{
+		{in: "fd:01", base: 16, want: deviceNumber{major: 253, minor: 1}},
+		{in: "00:00", base: 16, want: deviceNumber{}},
+		{in: "253:1", base: 10, want: deviceNumber{major: 253, minor: 1}},
+		{in: "fd", base: 16, wantErr: true},
+		{in: "fd:01", base: 10, wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := parseDeviceNumber(tc.in, tc.base)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("in=%s: error mismatch, got=%v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("in=%s: result mismatch, got=%v, want=%v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestInodeResolverResolve(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("device and inode numbers are supported only on Linux")
+	}
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dev", "shm"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(root, "dev", "shm", "segment")
+	if err := os.WriteFile(filename, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, ino, ok := fileDeviceInode(info)
+	if !ok {
+		t.Fatal("no device and inode numbers")
+	}
+	r := &inodeResolver{
+		root:    root,
+		mounts:  &mountInfo{entries: []mountEntry{{dev: dev, mountPoint: "/"}}},
+		indexes: make(map[deviceNumber]map[uint64]string),
+	}
+	smapsDev := []byte(strconv.FormatUint(uint64(dev.major), 16) + ":" + strconv.FormatUint(uint64(dev.minor), 16))
+	inode := []byte(strconv.FormatUint(ino, 10))
+
+	if got, want := r.resolve(&region{Dev: smapsDev, Inode: inode}), "/dev/shm/segment"; got != want {
+		t.Errorf("result mismatch, got=%q, want=%q", got, want)
+	}
+	if got := r.resolve(&region{Dev: smapsDev, Inode: inode, Pathname: []byte("/x")}); got != "" {
+		t.Errorf("region with a pathname: result mismatch, got=%q", got)
+	}
+	if got := r.resolve(&region{Dev: []byte("00:00"), Inode: []byte("0")}); got != "" {
+		t.Errorf("region without an inode: result mismatch, got=%q", got)
+	}
+
+	r = &inodeResolver{root: root, search: []string{"/dev"}, indexes: make(map[deviceNumber]map[uint64]string)}
+	if got, want := r.resolve(&region{Dev: smapsDev, Inode: inode}), "/dev/shm/segment"; got != want {
+		t.Errorf("search directories: result mismatch, got=%q, want=%q", got, want)
+	}
+}
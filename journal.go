@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// Priorities of journal entries, as in syslog(3).
+const (
+	journalPriorityWarning = 4
+	journalPriorityInfo    = 6
+)
+
+// journalWriter sends log messages to journald using its native protocol
+// (see systemd-journald.service(8)), so that they can have structured
+// fields in addition to the message.
+type journalWriter struct {
+	conn *net.UnixConn
+}
+
+// newJournalWriter connects to journald. It must be called before
+// entering the sandbox, which denies creating sockets.
+func newJournalWriter() (*journalWriter, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalWriter{conn: conn}, nil
+}
+
+// Write sends p written by the standard logger as an entry. Messages
+// starting with "warning:" get the warning priority.
+func (w *journalWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	priority := journalPriorityInfo
+	if strings.HasPrefix(msg, "warning:") {
+		priority = journalPriorityWarning
+	}
+	if err := w.send(msg, priority, nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// send sends an entry with the message, priority and additional fields.
+// Field names must consist of uppercase letters, digits and underscores.
+func (w *journalWriter) send(msg string, priority int, fields map[string]string) error {
+	var b bytes.Buffer
+	appendJournalField(&b, "MESSAGE", msg)
+	appendJournalField(&b, "PRIORITY", strconv.Itoa(priority))
+	appendJournalField(&b, "SYSLOG_IDENTIFIER", toolName)
+	for name, value := range fields {
+		appendJournalField(&b, name, value)
+	}
+	_, err := w.conn.Write(b.Bytes())
+	return err
+}
+
+// appendJournalField appends a field in the native protocol, where values
+// with newlines are written with their length instead of as a line.
+func appendJournalField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	b.Write(size[:])
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+func (w *journalWriter) Close() error {
+	return w.conn.Close()
+}
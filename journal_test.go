@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendJournalField(t *testing.T) {
+	var b bytes.Buffer
+	appendJournalField(&b, "MESSAGE", "hello")
+	appendJournalField(&b, "MESSAGE", "a\nb")
+	want := "MESSAGE=hello\n" + "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n"
+	if got := b.String(); got != want {
+		t.Errorf("result mismatch, got=%q, want=%q", got, want)
+	}
+}
+
+func TestJournalWriterWrite(t *testing.T) {
+	dir, err := os.MkdirTemp("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := &net.UnixAddr{Name: filepath.Join(dir, "sock"), Net: "unixgram"}
+	server, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer server.Close()
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &journalWriter{conn: conn}
+	defer w.Close()
+
+	if _, err := w.Write([]byte("warning: line 3: bad\n")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(buf[:n])
+	for _, want := range []string{"MESSAGE=warning: line 3: bad\n", "PRIORITY=4\n", "SYSLOG_IDENTIFIER=" + toolName + "\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("entry %q must contain %q", got, want)
+		}
+	}
+}
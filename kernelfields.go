@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Kinds of the values of the known fields.
+const (
+	// fieldKindKB is a size in kB, e.g. Rss.
+	fieldKindKB = "kB"
+	// fieldKindInt is an integer without a unit, e.g. THPeligible.
+	fieldKindInt = "int"
+	// fieldKindFlags is a list of two-letter flags, i.e. VmFlags.
+	fieldKindFlags = "flags"
+)
+
+// kernelField is a field of /proc/<pid>/smaps known to this tool with the
+// kind of its values.
+type kernelField struct {
+	name string
+	kind string
+}
+
+// knownFields are the fields of /proc/<pid>/smaps in the order printed by
+// recent kernels, as documented in
+// https://docs.kernel.org/filesystems/proc.html
+//
+// Older kernels lack some of them, e.g. Pss_Dirty, SwapPss and
+// THPeligible, and ProtectionKey is printed only on architectures with
+// memory protection keys.
+var knownFields = []kernelField{
+	{"Size", fieldKindKB},
+	{"KernelPageSize", fieldKindKB},
+	{"MMUPageSize", fieldKindKB},
+	{"Rss", fieldKindKB},
+	{"Pss", fieldKindKB},
+	{"Pss_Dirty", fieldKindKB},
+	{"Shared_Clean", fieldKindKB},
+	{"Shared_Dirty", fieldKindKB},
+	{"Private_Clean", fieldKindKB},
+	{"Private_Dirty", fieldKindKB},
+	{"Referenced", fieldKindKB},
+	{"Anonymous", fieldKindKB},
+	{"KSM", fieldKindKB},
+	{"LazyFree", fieldKindKB},
+	{"AnonHugePages", fieldKindKB},
+	{"ShmemPmdMapped", fieldKindKB},
+	{"FilePmdMapped", fieldKindKB},
+	{"Shared_Hugetlb", fieldKindKB},
+	{"Private_Hugetlb", fieldKindKB},
+	{"Swap", fieldKindKB},
+	{"SwapPss", fieldKindKB},
+	{"Locked", fieldKindKB},
+	{"THPeligible", fieldKindInt},
+	{"ProtectionKey", fieldKindInt},
+	{"VmFlags", fieldKindFlags},
+}
+
+// knownFieldNames are the names of knownFields.
+var knownFieldNames = func() []string {
+	names := make([]string, len(knownFields))
+	for i, f := range knownFields {
+		names[i] = f.name
+	}
+	return names
+}()
+
+func isKnownField(name string) bool {
+	return knownFieldIndex(name) != -1
+}
+
+// lookupKnownField returns the known field of name, and whether there is
+// one.
+func lookupKnownField(name string) (kernelField, bool) {
+	if i := knownFieldIndex(name); i != -1 {
+		return knownFields[i], true
+	}
+	return kernelField{}, false
+}
+
+// parse parses the value of the field with the unit into an integer,
+// which is zero for VmFlags. An empty value, e.g. of a truncated capture,
+// is zero without an error.
+func (f kernelField) parse(value, unit string) (int64, error) {
+	switch f.kind {
+	case fieldKindFlags:
+		return 0, nil
+	case fieldKindKB:
+		if unit != unitsKB {
+			return 0, fmt.Errorf("field %s is in %q instead of kB", f.name, unit)
+		}
+	default:
+		if unit != "" {
+			return 0, fmt.Errorf("field %s has the unit %q", f.name, unit)
+		}
+	}
+	if value == "" {
+		return 0, nil
+	}
+	n, err := parseInt64Value(value)
+	if err != nil || f.kind == fieldKindKB && n < 0 {
+		return 0, fmt.Errorf("field %s has a non-numeric value %q", f.name, value)
+	}
+	return n, nil
+}
+
+// Policies of -unknown-fields for fields unknown to this tool.
+const (
+	unknownFieldsKeep  = "keep"
+	unknownFieldsDrop  = "drop"
+	unknownFieldsError = "error"
+)
+
+// fieldChecker checks the values of the known fields of mappings and
+// applies the policy of -unknown-fields to the other fields. It keeps the
+// fields it has warned about, so that a checker is for one conversion and
+// must not be shared by conversions running concurrently, e.g. the
+// requests of serve and the workers of -jobs.
+type fieldChecker struct {
+	unknownFields string
+	// skipBadValues replaces malformed values with empty ones, reporting
+	// them, instead of failing.
+	skipBadValues bool
+	warnedFields  map[string]bool
+}
+
+func newFieldChecker(unknownFields string, skipBadValues bool) *fieldChecker {
+	return &fieldChecker{unknownFields: unknownFields, skipBadValues: skipBadValues, warnedFields: make(map[string]bool)}
+}
+
+// check checks the fields of m, reporting the first occurrence of each
+// dropped field and the skipped values to anomalies.
+func (c *fieldChecker) check(m *mapping, anomalies *anomalyLog) error {
+	unknown := false
+	for i, name := range m.FieldNames {
+		line := m.LineNo + 1 + i
+		f, ok := lookupKnownField(name)
+		if !ok {
+			switch c.unknownFields {
+			case unknownFieldsError:
+				return fmt.Errorf("line %d: field %s is unknown to this tool", line, name)
+			case unknownFieldsDrop:
+				if !c.warnedFields[name] {
+					anomalies.report(line, "dropped field "+name+" unknown to this tool", name+": "+m.FieldValues[i])
+					c.warnedFields[name] = true
+				}
+				unknown = true
+			}
+			continue
+		}
+		if _, err := f.parse(m.FieldValues[i], m.FieldUnits[i]); err != nil {
+			if !c.skipBadValues {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			anomalies.report(line, fmt.Sprintf("skipped bad value: %v", err), name+": "+m.FieldValues[i])
+			m.FieldValues[i] = ""
+		}
+	}
+	if unknown {
+		m.dropUnknownFields()
+	}
+	return nil
+}
+
+// dropUnknownFields removes the fields of m unknown to this tool.
+func (m *mapping) dropUnknownFields() {
+	var names, values, units []string
+	for i, name := range m.FieldNames {
+		if isKnownField(name) {
+			names = append(names, name)
+			values = append(values, m.FieldValues[i])
+			units = append(units, m.FieldUnits[i])
+		}
+	}
+	m.FieldNames, m.FieldValues, m.FieldUnits = names, values, units
+}
+
+// validateUnknownFields checks -unknown-fields.
+func (a *args) validateUnknownFields() error {
+	switch a.unknownFields {
+	case "", unknownFieldsKeep, unknownFieldsDrop, unknownFieldsError:
+		return nil
+	}
+	return fmt.Errorf("unsupported -unknown-fields: %q", a.unknownFields)
+}
+
+// kernelCompatNormalizer normalizes the fields of mappings to
+// knownFieldNames so that captures from kernels of different versions
+// have the same columns. Fields missing in a capture are written as
+// empty values, and fields unknown to this tool are dropped.
+type kernelCompatNormalizer struct {
+	warnedFields map[string]bool
+}
+
+func newKernelCompatNormalizer() *kernelCompatNormalizer {
+	return &kernelCompatNormalizer{warnedFields: make(map[string]bool)}
+}
+
+// normalize normalizes the fields of m, reporting the first occurrence
+// of each unknown field to anomalies.
+func (n *kernelCompatNormalizer) normalize(m *mapping, anomalies *anomalyLog) {
+	for i, name := range m.FieldNames {
+		if !isKnownField(name) && !n.warnedFields[name] {
+			anomalies.report(m.LineNo+1+i, "dropped field "+name+" unknown to this tool", name+": "+m.FieldValues[i])
+			n.warnedFields[name] = true
+		}
+	}
+	m.selectFields(knownFieldNames)
+}
+
+// knownFieldIndex returns the index of name in knownFieldNames, or -1 if
+// it is not a known field.
+func knownFieldIndex(name string) int {
+	for i, n := range knownFieldNames {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortFieldsCanonically reorders the fields of m to the order of
+// knownFieldNames. Unknown fields follow the known ones in input order.
+func (m *mapping) sortFieldsCanonically() {
+	order := make([]int, len(m.FieldNames))
+	for i := range order {
+		order[i] = i
+	}
+	rank := func(i int) int {
+		if r := knownFieldIndex(m.FieldNames[i]); r != -1 {
+			return r
+		}
+		return len(knownFieldNames)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return rank(order[i]) < rank(order[j])
+	})
+
+	names := make([]string, len(order))
+	values := make([]string, len(order))
+	units := make([]string, len(order))
+	for i, j := range order {
+		names[i], values[i], units[i] = m.FieldNames[j], m.FieldValues[j], m.FieldUnits[j]
+	}
+	m.FieldNames, m.FieldValues, m.FieldUnits = names, values, units
+}
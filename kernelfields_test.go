@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKernelCompatNormalizerNormalize(t *testing.T) {
+	m := &mapping{
+		FieldNames:  []string{"Size", "Rss", "Pss", "NewCounter", "VmFlags"},
+		FieldValues: []string{"8", "4", "2", "1", "rd mr"},
+		FieldUnits:  []string{"kB", "kB", "kB", "kB", ""},
+	}
+	newKernelCompatNormalizer().normalize(m, nil)
+	if got, want := strings.Join(m.FieldNames, ","), strings.Join(knownFieldNames, ","); got != want {
+		t.Errorf("field names mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+	want := []string{"8", "", "", "4", "2"}
+	if got := m.FieldValues[:len(want)]; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("field values mismatch, got=%q, want=%q", got, want)
+	}
+	if got, want := m.FieldValues[len(m.FieldValues)-1], "rd mr"; got != want {
+		t.Errorf("VmFlags mismatch, got=%q, want=%q", got, want)
+	}
+}
+
+func TestMappingSortFieldsCanonically(t *testing.T) {
+	m := &mapping{
+		FieldNames:  []string{"Rss", "Extra", "Size", "VmFlags", "Pss"},
+		FieldValues: []string{"4", "9", "8", "rd", "2"},
+		FieldUnits:  []string{"kB", "kB", "kB", "", "kB"},
+	}
+	m.sortFieldsCanonically()
+	if got, want := strings.Join(m.FieldNames, ","), "Size,Rss,Pss,VmFlags,Extra"; got != want {
+		t.Errorf("field names mismatch, got=%s, want=%s", got, want)
+	}
+	if got, want := strings.Join(m.FieldValues, ","), "8,4,2,rd,9"; got != want {
+		t.Errorf("field values mismatch, got=%s, want=%s", got, want)
+	}
+}
+
+func TestKernelFieldParse(t *testing.T) {
+	testCases := []struct {
+		name, value, unit string
+		want              int64
+		wantErr           bool
+	}{
+		{name: "Rss", value: "4", unit: "kB", want: 4},
+		{name: "Rss", value: "", unit: "kB"},
+		{name: "Rss", value: "4", unit: "MB", wantErr: true},
+		{name: "Rss", value: "x", unit: "kB", wantErr: true},
+		{name: "Rss", value: "-4", unit: "kB", wantErr: true},
+		{name: "THPeligible", value: "1", want: 1},
+		{name: "ProtectionKey", value: "0", unit: "kB", wantErr: true},
+		{name: "VmFlags", value: "rd mr"},
+	}
+	for _, tc := range testCases {
+		f, ok := lookupKnownField(tc.name)
+		if !ok {
+			t.Fatalf("field %s is unknown", tc.name)
+		}
+		got, err := f.parse(tc.value, tc.unit)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("%s: %q %q: got=%d, %v, want=%d, error=%v", tc.name, tc.value, tc.unit, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestFieldCheckerCheck(t *testing.T) {
+	newMapping := func() *mapping {
+		return &mapping{
+			FieldNames:  []string{"Rss", "NewCounter", "Pss", "VmFlags"},
+			FieldValues: []string{"4", "1", "x", "rd"},
+			FieldUnits:  []string{"kB", "kB", "kB", ""},
+			LineNo:      10,
+		}
+	}
+	if err := newFieldChecker(unknownFieldsKeep, false).check(newMapping(), nil); err == nil || err.Error() != `line 13: field Pss has a non-numeric value "x"` {
+		t.Errorf("error of a bad value = %v", err)
+	}
+	if err := newFieldChecker(unknownFieldsError, false).check(newMapping(), nil); err == nil || err.Error() != "line 12: field NewCounter is unknown to this tool" {
+		t.Errorf("error of an unknown field = %v", err)
+	}
+
+	l := &anomalyLog{}
+	m := newMapping()
+	if err := newFieldChecker(unknownFieldsDrop, true).check(m, l); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(m.FieldNames, ","), "Rss,Pss,VmFlags"; got != want {
+		t.Errorf("field names mismatch, got=%s, want=%s", got, want)
+	}
+	if got, want := strings.Join(m.FieldValues, ","), "4,,rd"; got != want {
+		t.Errorf("field values mismatch, got=%s, want=%s", got, want)
+	}
+	if got, want := l.count, 2; got != want {
+		t.Errorf("anomaly count mismatch, got=%d, want=%d", got, want)
+	}
+
+	m = newMapping()
+	m.FieldValues[2] = "2"
+	if err := newFieldChecker(unknownFieldsKeep, false).check(m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(m.FieldNames, ","), "Rss,NewCounter,Pss,VmFlags"; got != want {
+		t.Errorf("kept field names mismatch, got=%s, want=%s", got, want)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Policies of LazyFree in the Uss column given by -lazyfree-policy.
+// Pages freed with MADV_FREE, e.g. by jemalloc, stay resident and private
+// until the kernel reclaims them under memory pressure, so "include"
+// counts them as the kernel does and "exclude" subtracts them as memory
+// which the process has already given back.
+const (
+	lazyFreeInclude = "include"
+	lazyFreeExclude = "exclude"
+)
+
+// ussColumn returns the derived column of the unique set size, the
+// private memory of the region, with LazyFree handled by policy.
+func ussColumn(policy string) (derivedColumn, error) {
+	switch policy {
+	case lazyFreeInclude:
+		return parseDerivedColumn("Uss=Private_Clean+Private_Dirty")
+	case lazyFreeExclude:
+		return parseDerivedColumn("Uss=Private_Clean+Private_Dirty-LazyFree")
+	}
+	return derivedColumn{}, fmt.Errorf("unsupported -lazyfree-policy: %q", policy)
+}
+
+type lazyFreeRegion struct {
+	pid      int
+	region   []string
+	pathname string
+	rss      float64
+	lazyFree float64
+}
+
+// lazyFreeReport collects the regions with LazyFree of at least minKB
+// across the inputs of a run.
+type lazyFreeReport struct {
+	minKB   float64
+	regions []lazyFreeRegion
+}
+
+func newLazyFreeReport(minKB float64) *lazyFreeReport {
+	return &lazyFreeReport{minKB: minKB}
+}
+
+// add adds m of the process pid, or zero if unknown, if its LazyFree is
+// large enough.
+func (r *lazyFreeReport) add(pid int, m *mapping) {
+	lazyFree, ok := m.numericFieldValue("LazyFree")
+	if !ok || lazyFree == 0 || lazyFree < r.minKB {
+		return
+	}
+	rss, _ := m.numericFieldValue("Rss")
+	r.regions = append(r.regions, lazyFreeRegion{
+		pid: pid,
+		region: []string{
+			string(m.Region.AddressStart),
+			string(m.Region.AddressEnd),
+			string(m.Region.Perms),
+		},
+		pathname: string(m.Region.Pathname),
+		rss:      rss,
+		lazyFree: lazyFree,
+	})
+}
+
+// csv returns the report sorted by LazyFree in descending order, with the
+// ratio of LazyFree to Rss, which is the part of Rss the kernel can
+// reclaim without swapping.
+func (r *lazyFreeReport) csv() ([]byte, error) {
+	sort.SliceStable(r.regions, func(i, j int) bool {
+		return r.regions[i].lazyFree > r.regions[j].lazyFree
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := []string{"Pid", "AddressStart", "AddressEnd", "Perms", "Pathname", "Rss", "LazyFree", "LazyFreeRatio"}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, lr := range r.regions {
+		pid := ""
+		if lr.pid != 0 {
+			pid = strconv.Itoa(lr.pid)
+		}
+		ratio := ""
+		if lr.rss > 0 {
+			ratio = strconv.FormatFloat(lr.lazyFree/lr.rss, 'f', 4, 64)
+		}
+		record := append([]string{pid}, lr.region...)
+		record = append(record, lr.pathname,
+			strconv.FormatFloat(lr.rss, 'f', -1, 64), strconv.FormatFloat(lr.lazyFree, 'f', -1, 64), ratio)
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
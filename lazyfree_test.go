@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testLazyFreeInput = "55e000-580000 rw-p 00000000 00:00 0                          [heap]\nRss: 8192 kB\nPrivate_Clean: 0 kB\nPrivate_Dirty: 8192 kB\nLazyFree: 6144 kB\n" +
+	"7f0000000000-7f0000100000 rw-p 00000000 00:00 0 \nRss: 4096 kB\nPrivate_Clean: 0 kB\nPrivate_Dirty: 4096 kB\nLazyFree: 2048 kB\n" +
+	"7f0000100000-7f0000101000 r--p 00000000 fe:00 42                         /usr/lib/libc.so.6\nRss: 4 kB\nPrivate_Clean: 4 kB\nPrivate_Dirty: 0 kB\nLazyFree: 0 kB\n"
+
+func TestUssColumn(t *testing.T) {
+	for _, tc := range []struct {
+		policy string
+		want   string
+	}{
+		{policy: lazyFreeInclude, want: "Pathname,Uss\n[heap],8192\n,4096\n/usr/lib/libc.so.6,4\n"},
+		{policy: lazyFreeExclude, want: "Pathname,Uss\n[heap],2048\n,2048\n/usr/lib/libc.so.6,4\n"},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			var a args
+			a.registerFlags(fs)
+			dir := t.TempDir()
+			if err := fs.Parse([]string{"-uss", "-lazyfree-policy", tc.policy, "-columns", "Pathname,Uss"}); err != nil {
+				t.Fatal(err)
+			}
+			a.inputFilename = writeTestFile(t, testLazyFreeInput)
+			a.outputFilename = filepath.Join(dir, "out.csv")
+			if err := a.validate(fs); err != nil {
+				t.Fatal(err)
+			}
+			if err := run(a); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(a.outputFilename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := ussColumn("ignore"); err == nil {
+		t.Error("want an error for an unsupported policy")
+	}
+}
+
+func TestLazyFreeReportCSV(t *testing.T) {
+	r := newLazyFreeReport(1024)
+	if err := readMappings(strings.NewReader(testLazyFreeInput), func(m *mapping) error {
+		r.add(10, m)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.csv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Pid,AddressStart,AddressEnd,Perms,Pathname,Rss,LazyFree,LazyFreeRatio\n" +
+		"10,55e000,580000,rw-p,[heap],8192,6144,0.7500\n" +
+		"10,7f0000000000,7f0000100000,rw-p,,4096,2048,0.5000\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestRunStatsLazyFree(t *testing.T) {
+	var s runStats
+	if err := readMappings(strings.NewReader(testLazyFreeInput), func(m *mapping) error {
+		s.add(m)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if s.lazyFreeKB != 8192 {
+		t.Errorf("lazyFreeKB mismatch, got=%v, want=8192", s.lazyFreeKB)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hnakamur/linuxprocsmapstocsv/smaps"
+)
+
+// lintProblem is a problem found in an input by -validate.
+type lintProblem struct {
+	line    int
+	message string
+}
+
+// smapsLinter checks the mappings of an input for problems which
+// indicate a truncated, concatenated or edited capture.
+type smapsLinter struct {
+	order      regionOrderChecker
+	truncation truncationChecker
+	// units are the units of the fields in their first occurrence.
+	units    map[string]string
+	problems []lintProblem
+}
+
+func newSmapsLinter() *smapsLinter {
+	return &smapsLinter{units: make(map[string]string)}
+}
+
+func (l *smapsLinter) report(line int, format string, a ...interface{}) {
+	l.problems = append(l.problems, lintProblem{line: line, message: fmt.Sprintf(format, a...)})
+}
+
+// check checks the mapping m.
+func (l *smapsLinter) check(m *mapping) {
+	violation, err := l.order.check(m)
+	if err != nil {
+		l.report(m.LineNo, "%v", err)
+		return
+	}
+	if violation != "" {
+		l.report(m.LineNo, "%s", violation)
+	}
+	l.truncation.observe(m)
+	for i, name := range m.FieldNames {
+		line, value, unit := m.LineNo+1+i, m.FieldValues[i], m.FieldUnits[i]
+		if !isKnownField(name) {
+			l.report(line, "unknown field %s", name)
+		}
+		if u, ok := l.units[name]; !ok {
+			l.units[name] = unit
+		} else if u != unit {
+			l.report(line, "field %s is in %q while it is in %q in the first region", name, unit, u)
+		}
+		if name == "VmFlags" {
+			continue
+		}
+		if f, ok := lookupKnownField(name); ok && f.kind == fieldKindKB && unit != unitsKB {
+			l.report(line, "field %s is in %q instead of kB", name, unit)
+		}
+		if _, err := parseUint64Value(value); err != nil {
+			l.report(line, "field %s has a non-numeric value %q", name, value)
+		}
+	}
+	l.checkSizes(m)
+}
+
+// checkSizes checks that Size is the size of the address range and that
+// Rss is not larger than Size and Pss not larger than Rss.
+func (l *smapsLinter) checkSizes(m *mapping) {
+	start, end, err := m.Region.addressRange()
+	if err != nil || end <= start {
+		return
+	}
+	size, hasSize := m.numericFieldValue("Size")
+	rss, hasRss := m.numericFieldValue("Rss")
+	pss, hasPss := m.numericFieldValue("Pss")
+	if hasSize && size != float64((end-start)/1024) {
+		l.report(m.LineNo, "Size %v kB differs from the %d kB of the address range", size, (end-start)/1024)
+	}
+	if hasSize && hasRss && rss > size {
+		l.report(m.LineNo, "Rss %v kB is larger than Size %v kB", rss, size)
+	}
+	if hasRss && hasPss && pss > rss {
+		l.report(m.LineNo, "Pss %v kB is larger than Rss %v kB", pss, rss)
+	}
+}
+
+// lint reads the smaps in r and returns the problems found in it, of
+// which malformed lines are skipped to check the rest of the input.
+func lint(r io.Reader) ([]lintProblem, error) {
+	l := newSmapsLinter()
+	var last *mapping
+	if err := readMappingsSkipping(r, func(perr *smaps.ParseError) {
+		l.report(perr.Line, "malformed line %q: %s", perr.Text, perr.Reason())
+	}, func(m *mapping) error {
+		l.check(m)
+		last = m
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if last != nil {
+		if problem := l.truncation.check(last); problem != "" {
+			l.report(last.LineNo, "%s", problem)
+		}
+	}
+	return l.problems, nil
+}
+
+// runLint checks the inputs of -validate without writing any output and
+// prints the problems as <file>:<line>: <message> to w. An error is
+// returned if any problems are found.
+func runLint(args args, w io.Writer) error {
+	filenames := args.inputFilenames
+	if !args.batch {
+		filenames = []string{args.inputFilename}
+	}
+	var count int
+	for _, filename := range filenames {
+		problems, err := lintFile(filename)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		for _, p := range problems {
+			fmt.Fprintf(w, "%s:%d: %s\n", filename, p.line, p.message)
+		}
+		count += len(problems)
+	}
+	if count > 0 {
+		return fmt.Errorf("%d problems found", count)
+	}
+	return nil
+}
+
+func lintFile(filename string) ([]lintProblem, error) {
+	file := os.Stdin
+	if filename != stdioName {
+		var err error
+		file, err = os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+	}
+	r, err := decompressReader(file)
+	if err != nil {
+		return nil, err
+	}
+	return lint(r)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	input := "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\n" +
+		"Size:                  4 kB\n" +
+		"Rss:                   4 kB\n" +
+		"Pss:                   4 kB\n" +
+		"THPeligible:    0\n" +
+		"VmFlags: rd mr mw me\n" +
+		"55d800-560000 r-xp 00001000 fe:00 1234                       /usr/bin/cat\n" +
+		"Size:                  8 kB\n" +
+		"Rss:                  12 kB\n" +
+		"Pss:                  x kB\n" +
+		"THPeligible:    0\n" +
+		"Bogus:                 1 kB\n" +
+		"VmFlags: rd ex mr mw me\n" +
+		"not a line\n" +
+		"7ffd0000-7ffd1000 rw-p 00000000 00:00 0                          [stack]\n" +
+		"Size:                  4 MB\n" +
+		"Rss:                   4 kB\n"
+	problems, err := lint(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []lintProblem{
+		{line: 14, message: `malformed line "not a line": neither a region line nor a field line: bad format`},
+		{line: 7, message: "region 55d800-560000 overlaps the region 55d000-55e000 at line 1"},
+		{line: 10, message: `field Pss has a non-numeric value "x"`},
+		{line: 12, message: "unknown field Bogus"},
+		{line: 7, message: "Size 8 kB differs from the 10 kB of the address range"},
+		{line: 7, message: "Rss 12 kB is larger than Size 8 kB"},
+		{line: 16, message: `field Size is in "MB" while it is in "kB" in the first region`},
+		{line: 16, message: `field Size is in "MB" instead of kB`},
+		{line: 15, message: "capture ends in the last region with 2 of 5 fields, missing Pss, THPeligible, VmFlags"},
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("problem count mismatch, got=%v, want=%v", problems, want)
+	}
+	for i := range want {
+		if problems[i] != want[i] {
+			t.Errorf("problem %d mismatch, got=%v, want=%v", i, problems[i], want[i])
+		}
+	}
+}
+
+func TestRunLint(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "smaps")
+	if err := os.WriteFile(filename, []byte(testSmapsSorted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := runLint(args{inputFilename: filename}, &buf); err != nil {
+		t.Fatalf("unexpected error: %v, output=%s", err, buf.String())
+	}
+
+	if err := os.WriteFile(filename, []byte(testSmapsUnsorted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	err := runLint(args{inputFilename: filename}, &buf)
+	if err == nil || err.Error() != "1 problems found" {
+		t.Errorf("error mismatch, got=%v", err)
+	}
+	want := filename + ":5: region 55d000-55e000 starts before the region 7ffd0000-7ffd1000 at line 1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
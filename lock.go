@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// errLocked is returned by lockFile when another process holds the lock.
+var errLocked = errors.New("locked by another process")
+
+// lockFile is an exclusive lock held on a file while this process runs,
+// so that two instances do not write the same output. The file records
+// the holder to explain conflicts.
+type lockFile struct {
+	file *os.File
+}
+
+// acquireLock creates the lock file at path if needed and locks it. If
+// it is already locked, the returned error identifies the holder.
+func acquireLock(path string) (*lockFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockExclusive(file); err != nil {
+		file.Close()
+		if !errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		holder := "another process"
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			holder = strings.TrimSpace(string(data))
+		}
+		return nil, fmt.Errorf("lock file %s is held by %s", path, holder)
+	}
+
+	hostname, _ := os.Hostname()
+	holder := fmt.Sprintf("pid %d on host %s since %s\n", os.Getpid(), hostname, time.Now().Format(time.RFC3339))
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.WriteAt([]byte(holder), 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &lockFile{file: file}, nil
+}
+
+// release unlocks the lock file. The file is kept, as removing it would
+// race with another process which has opened it to lock.
+func (l *lockFile) release() error {
+	return l.file.Close()
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockExclusive locks file with flock(2) without blocking. The lock is
+// released when the file is closed or this process exits.
+func lockExclusive(file *os.File) error {
+	if err := unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		if err == unix.EWOULDBLOCK {
+			return errLocked
+		}
+		return err
+	}
+	return nil
+}
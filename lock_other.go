@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func lockExclusive(file *os.File) error {
+	return errors.New("lock files are supported only on Linux")
+}
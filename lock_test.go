@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAcquireLock(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("lock files are supported only on Linux")
+	}
+	path := filepath.Join(t.TempDir(), "convert.lock")
+	lock, err := acquireLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flock locks are per open file description, so a second open
+	// conflicts even in the same process.
+	if _, err := acquireLock(path); err == nil {
+		t.Fatal("second lock must fail")
+	} else if !strings.Contains(err.Error(), "pid "+strconv.Itoa(os.Getpid())) {
+		t.Errorf("error must name the holder, got=%v", err)
+	}
+	if err := lock.release(); err != nil {
+		t.Fatal(err)
+	}
+	lock, err = acquireLock(path)
+	if err != nil {
+		t.Fatalf("lock after release must succeed, got=%v", err)
+	}
+	lock.release()
+}
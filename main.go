@@ -1,25 +1,259 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/csv"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"os"
-	"reflect"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
 	"unicode/utf8"
+
+	"github.com/hnakamur/linuxprocsmapstocsv/smaps"
 )
 
 // https://docs.kernel.org/filesystems/proc.html
 
 type args struct {
-	inputFilename  string
+	inputFilename string
+	// inputFilenames are the inputs of a batch conversion given by -p
+	// or a glob pattern of -i.
+	inputFilenames []string
+	pids           []int
+	allProcesses   bool
+	batch          bool
 	outputFilename string
 	Separator      string
+	sortOrder      string
+	sortByStr      string
+	sortBy         *sortKey
+	fieldsFilename string
+	fieldNames     []string
+	derive         stringListFlag
+	derivedColumns []derivedColumn
+	units          string
+	unitConverter  *unitConverter
+	locale         string
+	decimalSep     string
+	thousandsSep   string
+	numberFormat   *numberFormat
+	floatFormat    floatFormat
+	dumpDir        string
+	dumpFormat     string
+	dumpPath       string
+	dumpRange      string
+	dumpPid        int
+	regionDumper   *regionDumper
+	redactPaths    bool
+	redactDepth    int
+	redactPattern  string
+	pathRedactor   *pathRedactor
+	pseudonymize   bool
+	salt           string
+	pseudonymizer  *pseudonymizer
+	rebaseAddrs    bool
+	addressRebaser *addressRebaser
+	versionMeta    string
+	writeMeta      bool
+	kernelCompat   bool
+	compat         *kernelCompatNormalizer
+	// unknownFields is the policy of -unknown-fields, which is applied
+	// with the checks of the values of the known fields by fieldChecker.
+	unknownFields   string
+	fieldChecker    *fieldChecker
+	canonicalOrder  bool
+	throttle        time.Duration
+	nice            int
+	ionice          string
+	requireRoot     bool
+	dropUser        string
+	sandbox         bool
+	reproducible    bool
+	maxRows         int
+	maxSizeStr      string
+	maxSize         int64
+	maxMemoryStr    string
+	maxMemory       int64
+	keepRawDir      string
+	teeRawPath      string
+	anomalyLogPath  string
+	anomalies       *anomalyLog
+	hostPaths       bool
+	resolveInodes   bool
+	inodeSearch     string
+	mountColumns    bool
+	mountInfo       *mountInfo
+	threadStacks    bool
+	numa            bool
+	numaMaps        *numaMaps
+	numaNodes       []int
+	swapDevices     bool
+	swapDeviceNames []string
+	swapAttributor  *swapAttributor
+	pagemap         bool
+	pagemapReader   *pagemapReader
+	mincore         bool
+	// pageContent is the number of the pages sampled in each region by
+	// -page-content, which are read by pageContentSampler.
+	pageContent        int
+	pageContentPath    string
+	pageContentSampler *pageContentSampler
+	nsPid              bool
+	withProcInfo       bool
+	cgroupPath         bool
+	outputMode         string
+	outputOwner        string
+	outputFileOptions  outputFileOptions
+	lockFilename       string
+	logJournald        bool
+	journal            *journalWriter
+	stats              *runStats
+	timestampColumn    bool
+	timeFormat         string
+	timeZone           string
+	timestampFormat    *timestampFormat
+	captureTime        time.Time
+	sinkSpecs          stringListFlag
+	columnRuleSpecs    stringListFlag
+	normalizePaths     string
+	normalizeRuleSpecs stringListFlag
+	pathNormalizer     *pathNormalizer
+	summaryPath        string
+	retry              retryPolicy
+	shmReportPath      string
+	shmReport          *shmReport
+	compSwapPath       string
+	compSwapReport     *compressedSwapReport
+	lazyFreePath       string
+	lazyFreeMin        float64
+	lazyFreeReport     *lazyFreeReport
+	numaReportPath     string
+	numaReport         *numaReport
+	uss                bool
+	lazyFreePolicy     string
+	trueCost           bool
+	trueCostExpr       string
+	trueCostColumn     *derivedColumn
+	shape              string
+	templatePath       string
+	skipBadLines       bool
+	jsonLayout         string
+	compress           string
+	nullAs             string
+	template           *template.Template
+	growthLogPath      string
+	format             string
+	growth             *growthTracker
+	spread             time.Duration
+	// jobs is the number of the workers converting the inputs of a batch.
+	jobs              int
+	interval          time.Duration
+	count             int
+	scanBudget        time.Duration
+	compactAfter      time.Duration
+	compactTo         time.Duration
+	retain            time.Duration
+	kernelThreads     string
+	baselinePath      string
+	lint              bool
+	plan              bool
+	checkpointDir     string
+	resume            bool
+	checkpoint        *checkpoint
+	noHeader          bool
+	crlf              bool
+	quote             string
+	sample            float64
+	sampleSeed        uint64
+	sampler           *regionSampler
+	appendOutput      bool
+	parquetDictionary string
+	parquetCompress   string
+	parquetOptions    parquetOptions
+	regressionRules   []regressionRule
+	regression        *regressionChecker
+	failConditions    []*failCondition
+	failIf            *failChecker
+	printStats        bool
+	checkOrder        bool
+	strict            bool
+	truncatedColumn   bool
+	dedupe            bool
+	mergeAdjacent     bool
+	categoryColumn    bool
+	anonNameColumn    bool
+	backingColumns    bool
+	stripDeleted      bool
+	regionSizeColumn  bool
+	// regionKey adds the RegionKey column hashing the components of
+	// regionKeyComponents, which are parsed into regionKeyParts.
+	regionKey           bool
+	regionKeyComponents string
+	regionKeyParts      []string
+	sourceColumns       bool
+	addrFormat          string
+	groupBy             string
+	subtotals           string
+	totals              bool
+	totalsPath          string
+	// typesPath is the type manifest of -types, which is read into
+	// typeManifest, and typesOutPath is the file of -types-out.
+	typesPath        string
+	typesOutPath     string
+	typeManifest     *typeManifest
+	expandVmFlags    bool
+	columnList       string
+	columns          []string
+	filterPerms      string
+	filterPath       string
+	minRss           float64
+	filter           *regionFilter
+	kind             string
+	unionFields      bool
+	sinks            []sinkSpec
+	columnRules      []columnRule
+	processColumns   []string
+	process          *processInfo
+	hostPathResolver *hostPathResolver
+	inodeResolver    *inodeResolver
+	stackLabeler     *threadStackLabeler
+	// maxConcurrentReads and maxReadsPerSec limit the reads of the
+	// inputs of a batch by readLimiter.
+	maxConcurrentReads int
+	maxReadsPerSec     float64
+	readLimiter        *readLimiter
+	// alertRules are the rules of -alert-rules, which are evaluated by
+	// alerts for each sample.
+	alertRules []*alertRule
+	alerts     *alertEngine
+	// parquetColumnCompress, arrowCompress and arrowColumnCompress are
+	// the compressions of the columns of the columnar outputs.
+	parquetColumnCompress string
+	arrowCompress         string
+	arrowColumnCompress   string
+	arrowOptions          arrowOptions
+	// source is the source of the inputs, the local files if nil.
+	source smaps.Source
+}
+
+// stringListFlag is a flag.Value which may be set multiple times.
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
 }
 
 type region struct {
@@ -30,240 +264,1981 @@ type region struct {
 	Dev          []byte
 	Inode        []byte
 	Pathname     []byte
+	// HostPath is the pathname resolved through the root directory of
+	// the process, set only with -host-paths.
+	HostPath []byte
+	// ResolvedPath is the pathname of the file found by the device and
+	// inode of a region without a pathname, set only with
+	// -resolve-inodes.
+	ResolvedPath []byte
+	// MountPoint and FsType are the mount point and the filesystem type
+	// of the file of the region, set only with -mounts.
+	MountPoint string
+	FsType     string
+	// StackThread is the thread whose stack is in the region, set only
+	// with -thread-stacks.
+	StackThread string
+	// NumaPages is the number of pages on each NUMA node, set only with
+	// -numa.
+	NumaPages map[int]int64
+	// SwapPages is the number of swapped pages on each swap type, set
+	// only with -swap-devices.
+	SwapPages map[int]int64
+	// PageCounts are the counts of the pages in pagemap, set only with
+	// -pagemap.
+	PageCounts *pageCounts
+	// PageContent is the estimate of the contents of the resident pages,
+	// set only with -page-content.
+	PageContent *pageContent
+	// CachedPages is the number of the pages of the file in the page
+	// cache, set only with -mincore for file-backed regions.
+	CachedPages *int64
+	// Key is the RegionKey, set only with -region-key.
+	Key string
+	// Backing and Deleted are the results of regionBacking, set only
+	// with -backing or -strip-deleted.
+	Backing string
+	Deleted bool
 }
 
 type mapping struct {
 	Region      *region
 	FieldNames  []string
 	FieldValues []string
+	FieldUnits  []string
+	LineNo      int
+	// Process is the process of the mapping, set only when process
+	// columns are written.
+	Process *processInfo
+	// Truncated is true if the mapping is the last one of a truncated
+	// capture, whose missing fields are empty.
+	Truncated bool
+	// SourceFile is the input filename of the mapping, set only with
+	// -source-columns in batch mode.
+	SourceFile string
+	// Category is the category of the region from regionCategory.
+	Category string
+	// Group is the group of a mapping aggregated by -group-by, which
+	// sums the fields of Regions mappings.
+	Group   string
+	Regions int
+	// KernelThread is true for the row of a process without mappings
+	// written with -kernel-threads include.
+	KernelThread bool
 }
 
-var errBadFormat = errors.New("bad format")
-
-const maxLineLength = 256
+// reproduciblePrecision is the number of decimal places of computed
+// columns in reproducible mode. Rounding hides differences in the last
+// bits of floating point results, e.g. by fused multiply-add on some
+// architectures.
+const reproduciblePrecision = 6
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			if err := runReplay(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "serve":
+			if err := runServe(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "capture":
+			if err := runCapture(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "timeseries":
+			if err := runTimeseries(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "compare":
+			if err := runCompare(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "diff":
+			if err := runDiff(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "csvdiff":
+			if err := runCSVDiff(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "schedule":
+			if err := runSchedule(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "exporter":
+			if err := runExporter(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "fleet":
+			if err := runFleet(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "merge":
+			if err := runMerge(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "top":
+			if err := runTop(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "selftest":
+			if err := runSelftest(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "report":
+			// A report is the conversion with the flags of its preset.
+			arguments, err := reportArguments(os.Args[2:])
+			if err != nil {
+				log.Fatal(err)
+			}
+			os.Args = append([]string{os.Args[0]}, arguments...)
+		}
+	}
+
 	var args args
-	flag.StringVar(&args.inputFilename, "i", "", "input filename to parse (in /proc/<pid>/smaps format)")
-	flag.StringVar(&args.outputFilename, "o", "", "output CSV filename")
-	flag.StringVar(&args.Separator, "sep", ",", "field separator")
+	flag.StringVar(&args.inputFilename, "i", "", "input filename to parse (in /proc/<pid>/smaps format), or a glob pattern such as \"/proc/[0-9]*/smaps\" to convert into one output with a Pid column, or \"-\" for the standard input (default)")
+	flag.DurationVar(&args.spread, "spread", 0, "spread the reads of the inputs of -p or a glob pattern of -i evenly over this duration, each at a random time in its share, instead of reading them in a burst, to flatten the load on busy hosts")
+	flag.IntVar(&args.jobs, "jobs", 1, "number of the inputs of -p or a glob pattern of -i read and converted concurrently; the rows are written in the order of the inputs as with 1")
+	flag.IntVar(&args.maxConcurrentReads, "max-concurrent-reads", 0, "maximum number of the smaps files of -p, -all-processes or a glob pattern of -i read at once by the workers of -jobs, to bound the contention with the processes being measured, whose address spaces are locked while their smaps are read (default: -jobs)")
+	flag.Float64Var(&args.maxReadsPerSec, "max-reads-per-sec", 0, "maximum number of the smaps files of -p, -all-processes or a glob pattern of -i started to be read per second over all workers, e.g. 50 (default: unlimited)")
+	flag.DurationVar(&args.interval, "interval", 0, "watch mode: read the inputs again at this interval, e.g. 5s, appending the rows of each sample with a Timestamp column of its capture time to the same output, which is written directly as with -atomic=false")
+	flag.IntVar(&args.count, "count", 0, "number of samples to take with -interval (default: until interrupted)")
+	flag.DurationVar(&args.scanBudget, "scan-budget", 0, "watch mode: if a sample takes longer than this, e.g. 2s, lengthen -interval in proportion for the next one, so that the share of the time spent reading stays bounded on hosts with huge address spaces; the interval is restored when a sample is within the budget again")
+	flag.DurationVar(&args.compactAfter, "compact-after", 0, "watch mode: downsample the samples older than this, e.g. 1h, to one per -compact-to, e.g. 5m, with the average of each field of each region, so that watching for days produces a manageable file; the output, which must be csv, sqlite, parquet or xlsx, is rewritten at each sample")
+	flag.DurationVar(&args.compactTo, "compact-to", 0, "watch mode: period of the samples downsampled by -compact-after, whose Timestamp is the start of the period")
+	flag.DurationVar(&args.retain, "retain", 0, "watch mode: drop the samples older than this, e.g. 168h, from the output, which is rewritten at each sample as with -compact-after")
+	flag.StringVar(&args.kernelThreads, "kernel-threads", kernelThreadsSkip, "what to do with processes without mappings, i.e. kernel threads, in -p or a glob pattern of -i: \"skip\" them or \"include\" a row of each with empty region columns and zero kB fields")
+	pidList := flag.String("p", "", "comma separated pids of live processes to read /proc/<pid>/smaps of into one output with a Pid column (mutually exclusive with -i)")
+	flag.BoolVar(&args.allProcesses, "all-processes", false, "read the smaps, or smaps_rollup with -kind smaps_rollup, of all processes in /proc into one output with Pid and Comm columns; processes whose files are not readable are skipped with a warning")
+	flag.StringVar(&args.outputFilename, "o", stdioName, "output CSV filename, or \"-\" for the standard output")
+	flag.BoolVar(&args.appendOutput, "append", false, "append the rows to the CSV file of -o if it exists, failing if its header differs from that of the output; use -timestamp to tell the rows of each run apart, e.g. of runs by cron")
+	flag.StringVar(&args.shmReportPath, "shm-report", "", "file to write a CSV report of memfd, POSIX (/dev/shm) and SysV shared memory mappings across the inputs to, with their sizes and counters in kB")
+	flag.StringVar(&args.compSwapPath, "compressed-swap-report", "", "file to write a CSV report of Swap and SwapPss of each process to, with the memory saved by compressing them estimated from the compression ratio of zswap (/sys/kernel/debug/zswap, requires root) and zram (/sys/block/zram*/mm_stat)")
+	flag.StringVar(&args.lazyFreePath, "lazyfree-report", "", "file to write a CSV report of the regions with LazyFree, i.e. pages freed with MADV_FREE which are still counted in Rss, to, sorted by LazyFree")
+	flag.Float64Var(&args.lazyFreeMin, "lazyfree-min", 1024, "minimum LazyFree in kB of the regions in -lazyfree-report")
+	flag.StringVar(&args.numaReportPath, "numa-report", "", "file to write a CSV report of the pages of -numa on each NUMA node to, summed for each process and for each library, i.e. mapped file, with the node having the most pages and its share of them")
+	flag.StringVar(&args.format, "format", outputFormatCSV, "output format: \"csv\", \"json\" (an array of objects with the kB fields nested in \"Fields\"), \"ndjson\" (the same objects, one per line), \"sqlite\" (a SQLite database with a mappings table created from the columns) or \"parquet\" (a Parquet file with INT64 or DOUBLE numeric columns and UTF8 string columns), \"arrow\" (an Arrow IPC stream with the same column types and a record batch per sample of -interval), \"xlsx\" (an Excel workbook with numeric cells, a frozen header row and an autofilter), \"folded\" (folded stacks of the groups of -group-by, stack by default, weighted by Pss in kB for flamegraph.pl or speedscope); sqlite, parquet and xlsx require -o; \"template\" executes the template of -template")
+	flag.StringVar(&args.parquetDictionary, "parquet-dictionary", "", "comma separated columns of -format parquet to write with the dictionary encoding, e.g. Pathname,Perms, which makes columns of few distinct values much smaller")
+	flag.StringVar(&args.parquetCompress, "parquet-compression", "none", "compression of the pages of -format parquet: \"none\", or \"gzip\" or \"zstd\" optionally followed by the level, e.g. gzip:9 or zstd:19")
+	flag.StringVar(&args.parquetColumnCompress, "parquet-column-compression", "", "comma separated <column>=<compression> of -format parquet overriding -parquet-compression for the columns, e.g. Pathname=zstd:19,Rss=none")
+	flag.StringVar(&args.arrowCompress, "arrow-compression", "none", "compression of the buffers of -format arrow: \"none\", or \"zstd\" optionally followed by the level, e.g. zstd:19")
+	flag.StringVar(&args.arrowColumnCompress, "arrow-column-compression", "", "comma separated <column>=<compression> of -format arrow overriding -arrow-compression for the columns, e.g. Pathname=zstd:19,Rss=none")
+	flag.StringVar(&args.growthLogPath, "growth-log", "", "CSV file to append the sizes and Rss of the [heap] and [stack] mappings of each process to, making a compact series over repeated runs")
+	flag.StringVar(&args.baselinePath, "baseline", "", "CSV file written by this tool with the default units to check the run against with -regression-rule; the violations are printed and the exit status is nonzero if there are any")
+	var regressionRules, failConditions stringListFlag
+	alertRulesPath := flag.String("alert-rules", "", "JSON file of threshold, rate and absence alert rules evaluated for each sample, e.g. of -interval, sending alerts to log, exec and webhook sinks")
+	flag.Var(&failConditions, "fail-if", "condition making the exit status nonzero after the output is written, a comparison with >, >=, <, <=, == or != of expressions over regions, total_<field> and max_<field>, the sum and the maximum of a field over the written regions in kB, where sizes may have a unit, e.g. 'total_pss > 2GiB' (may be repeated)")
+	flag.Var(&regressionRules, "regression-rule", "tolerance of -baseline as scope:field:+limit, where scope is \"total\" for the sum of all regions or \"pathname\" for the sum of each pathname and limit is a percentage or a size, e.g. total:Pss:+10% or pathname:Pss:+5M (may be repeated)")
+	flag.StringVar(&args.jsonLayout, "json-layout", jsonLayoutFields, "layout of the objects of -format json and ndjson: \"fields\" with the kB fields nested in \"Fields\" and the other columns as members, or \"typed\" with the region columns in a \"Region\" object, the kB fields as numbers in a \"Counters\" object and VmFlags as an array of strings")
+	flag.StringVar(&args.compress, "compress", "", "compression of the output CSV file: \"none\", \"gzip\" or \"zstd\"; defaults to gzip or zstd if the -o filename ends with .gz or .zst (gzip and zstd compressed inputs are decompressed regardless of this flag)")
+	flag.StringVar(&args.nullAs, "null-as", "", "representation of missing kB fields, e.g. with -union-fields: \"empty\", \"NULL\", \"null\" or \"NaN\"; JSON has null for NULL and null, an empty string for empty and a string for NaN (default: empty in CSV and null in JSON)")
+	flag.StringVar(&args.templatePath, "template", "", "file of a Go text/template of -format template, executed with .Columns, .Mappings, the rows keyed by column names, and .Totals, the sums of the kB fields, e.g. {{range .Mappings}}{{.Pathname}} {{.Rss}}{{\"\\n\"}}{{end}}; the function num converts a value to a number")
+	flag.StringVar(&args.checkpointDir, "checkpoint", "", "directory to save the inputs of a batch run of -p, -all-processes or a glob pattern of -i into as they are converted, removed when the run succeeds, so that an interrupted run can be continued with -resume")
+	flag.BoolVar(&args.resume, "resume", false, "continue the interrupted run of -checkpoint, reading the inputs saved in it from there instead of again; processes which have exited since are included and new ones added")
+	flag.BoolVar(&args.plan, "plan", false, "print the inputs with their pids and the outputs which the run would read and write, without reading or writing any of them, e.g. to review a batch run of -all-processes first")
+	flag.BoolVar(&args.lint, "validate", false, "check the inputs without writing any output and print the problems found with their line numbers, i.e. malformed lines, regions out of order or overlapping, unknown fields, non-numeric values, inconsistent units, a Size differing from the address range and truncation; the exit status is nonzero if there are any")
+	flag.StringVar(&procRoot, "procfs", procRoot, "mount point of the procfs to read process and system information from, e.g. /host/proc in a container")
+	args.registerFlags(flag.CommandLine)
+	configPath := flag.String("config", "", "YAML (.yaml, .yml), TOML (.toml) or JSON (.json) file of the flags of the run, keyed by their names, e.g. \"p: [1234, 5678]\" and \"interval: 15s\"; flags on the command line override those of the file")
+	showVersion := flag.Bool("version", false, "print the version and exit")
 	flag.Parse()
+	if *configPath != "" {
+		if err := applyFlagsFile(flag.CommandLine, *configPath); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	if args.inputFilename == "" || args.outputFilename == "" {
-		flag.Usage()
-		log.Fatal("both flags -i and -o must be set")
+	if *showVersion {
+		fmt.Println(toolName, toolVersion())
+		return
+	}
+
+	if args.allProcesses && (args.inputFilename != "" || *pidList != "") {
+		log.Fatal("flag -all-processes cannot be used with -i or -p")
+	}
+	if *pidList != "" {
+		if args.inputFilename != "" {
+			log.Fatal("flags -i and -p are mutually exclusive")
+		}
+		pids, err := parsePidList(*pidList)
+		if err != nil {
+			log.Fatal(err)
+		}
+		args.pids = pids
+	}
+	for _, s := range regressionRules {
+		r, err := parseRegressionRule(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		args.regressionRules = append(args.regressionRules, r)
+	}
+	if *alertRulesPath != "" {
+		rules, err := readAlertRules(*alertRulesPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, r := range rules {
+			if args.sandbox && r.sendsOutside() {
+				log.Fatalf("alert rule %s: the sinks exec and webhook cannot be used with -sandbox", r.name)
+			}
+		}
+		args.alertRules = rules
+	}
+	for _, s := range failConditions {
+		c, err := parseFailCondition(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		args.failConditions = append(args.failConditions, c)
+	}
+	if (args.baselinePath != "") != (len(args.regressionRules) > 0) {
+		log.Fatal("flags -baseline and -regression-rule must be used together")
+	}
+	if args.inputFilename == "" && len(args.pids) == 0 && !args.allProcesses {
+		args.inputFilename = stdioName
+	}
+	if args.outputFilename == "" {
+		args.outputFilename = stdioName
+	}
+	if args.outputFilename == stdioName && (args.splitsOutput() || args.writeMeta || args.versionMeta == versionMetadataSidecar) {
+		log.Fatal("-max-rows, -max-size, -meta and -version-metadata sidecar need an output file instead of the standard output")
+	}
+	if err := args.resolveInputs(); err != nil {
+		log.Fatal(err)
+	}
+	if args.lint {
+		if args.plan {
+			writePlan(args, os.Stdout)
+			return
+		}
+		if err := runLint(args, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if args.kernelThreads != kernelThreadsSkip && args.kernelThreads != kernelThreadsInclude {
+		log.Fatalf("unsupported -kernel-threads: %q", args.kernelThreads)
+	}
+	if args.spread < 0 || args.spread > 0 && !args.batch {
+		log.Fatal("-spread must be positive and requires -p or a glob pattern of -i")
+	}
+	if err := args.validateJobs(); err != nil {
+		log.Fatal(err)
+	}
+	if err := args.validateReadLimits(); err != nil {
+		log.Fatal(err)
+	}
+	if args.numaReportPath != "" && !args.numa {
+		log.Fatal("-numa-report requires -numa")
+	}
+	if args.teeRawPath != "" && args.batch {
+		log.Fatal("-tee-raw cannot be used with -p or a glob pattern of -i, whose inputs can be kept with -keep-raw")
+	}
+	if err := args.validateWatch(); err != nil {
+		log.Fatal(err)
 	}
-	if len(args.Separator) != 1 {
-		log.Fatal("separator (-sep) must be one character")
+	if err := args.validate(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+	if err := args.validateAppend(); err != nil {
+		log.Fatal(err)
+	}
+	if err := args.validateRetention(); err != nil {
+		log.Fatal(err)
+	}
+	if err := args.validateParquet(); err != nil {
+		log.Fatal(err)
+	}
+	if err := args.validateArrow(); err != nil {
+		log.Fatal(err)
+	}
+	if err := args.validateCheckpoint(); err != nil {
+		log.Fatal(err)
+	}
+	if args.plan {
+		writePlan(args, os.Stdout)
+		return
+	}
+	if args.logJournald {
+		jw, err := newJournalWriter()
+		if err != nil {
+			log.Fatalf("connect to journald: %v", err)
+		}
+		defer jw.Close()
+		log.SetOutput(jw)
+		log.SetFlags(0)
+		args.journal = jw
 	}
 
-	if err := run(args); err != nil {
+	startTime := time.Now()
+	args.stats = &runStats{}
+	err := run(args)
+	if args.summaryPath != "" {
+		s := newRunSummary(args.stats, time.Since(startTime), err)
+		if err := writeSummary(args.summaryPath, s, args.outputFileOptions); err != nil {
+			log.Printf("warning: write summary: %v", err)
+		}
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
+	if args.printStats {
+		fmt.Fprintln(os.Stderr, args.stats.humanSummary(time.Since(startTime)))
+	}
 }
 
-func run(args args) error {
-	inputFile, err := os.Open(args.inputFilename)
-	if err != nil {
-		return err
+// registerFlags defines the flags of conversion options in fs.
+func (a *args) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&a.Separator, "sep", ",", "field separator")
+	fs.Float64Var(&a.sample, "sample", 0, "fraction of the regions to write as a deterministic sample, e.g. 0.1, with a SampleWeight column of the number of regions each sampled one stands for (default: all regions)")
+	fs.Uint64Var(&a.sampleSeed, "sample-seed", 0, "seed of -sample; the same seed samples the same regions of a process")
+	fs.BoolVar(&a.noHeader, "no-header", false, "omit the header of the CSV output, e.g. to append to an existing file")
+	fs.BoolVar(&a.crlf, "crlf", false, "end the lines of the CSV output with CRLF instead of LF, e.g. for Excel")
+	fs.StringVar(&a.quote, "quote", quoteMinimal, "quoting of the CSV fields: \"minimal\" quotes the fields containing the separator, quotes or line breaks, \"all\" every field, \"nonnumeric\" every field which is not a number, and \"escape\" none, escaping the separator, line breaks and backslashes in pathnames with a backslash instead")
+	fs.StringVar(&a.sortOrder, "sort", "", "sort output rows; \"addresses\" sorts by numeric start address, then PID, and \"truecost\" by TrueCost in descending order, which requires -true-cost (default: input order, or truecost for -group-by with -true-cost)")
+	fs.StringVar(&a.sortByStr, "sort-by", "", "sort output rows by a numeric field, a column of -derive or a region column, followed by \":asc\" or \":desc\", e.g. Rss:desc; rows without the field come last; all mappings are buffered before writing, and the groups of -group-by are sorted instead of the mappings (cannot be used with -sort)")
+	fs.StringVar(&a.fieldsFilename, "fields-file", "", "file listing the smaps fields to emit, one per line, in output order (default: all fields in input order)")
+	fs.Var(&a.derive, "derive", "add a computed column in the form Name=expression, e.g. DirtyRatio=Private_Dirty/Size (may be repeated)")
+	fs.StringVar(&a.units, "units", unitsKB, "unit of memory size fields: \"kB\", \"bytes\", \"MiB\" or \"pages\" (counts of system pages, or huge pages for hugetlb fields); the unit is appended to the header of fields in units other than kB, e.g. Rss_bytes")
+	fs.StringVar(&a.locale, "locale", "", "number format preset; \"eu\" uses a decimal comma, '.' thousands separators and ';' as the field separator unless overridden by -sep, -decimal-sep or -thousands-sep")
+	fs.StringVar(&a.decimalSep, "decimal-sep", ".", "decimal separator for numeric values")
+	fs.StringVar(&a.thousandsSep, "thousands-sep", "", "thousands separator for numeric values (default: none)")
+	fs.IntVar(&a.floatFormat.precision, "precision", -1, "number of decimal places for computed columns (default: as many as needed)")
+	fs.IntVar(&a.floatFormat.sigDigits, "sig-digits", 0, "number of significant digits for computed columns (default: no rounding)")
+	fs.StringVar(&a.dumpDir, "dump-dir", "", "directory to write memory contents of regions selected by -dump-path and -dump-range (requires root or CAP_SYS_PTRACE)")
+	fs.StringVar(&a.dumpFormat, "dump-format", dumpFormatRaw, "format of dumped memory contents: \"raw\" or \"hex\"")
+	fs.StringVar(&a.dumpPath, "dump-path", "", "regular expression of pathnames of regions to dump")
+	fs.StringVar(&a.dumpRange, "dump-range", "", "hexadecimal address range to dump in the form start-end")
+	fs.IntVar(&a.dumpPid, "dump-pid", 0, "pid of the process to dump memory of (default: the pid in the input filename /proc/<pid>/smaps)")
+	fs.BoolVar(&a.redactPaths, "redact-paths", false, "replace pathname components beyond -redact-depth or matching -redact-pattern with hashes")
+	fs.IntVar(&a.redactDepth, "redact-depth", 2, "number of leading pathname components kept by -redact-paths")
+	fs.StringVar(&a.redactPattern, "redact-pattern", "", "regular expression of pathname components always hashed by -redact-paths")
+	fs.BoolVar(&a.pseudonymize, "pseudonymize", false, "replace pathnames, pids, tids, command names and command lines with salted hashes which are consistent within a run")
+	fs.StringVar(&a.salt, "salt", "", "hex encoded salt for -pseudonymize (default: random per run)")
+	fs.BoolVar(&a.rebaseAddrs, "rebase-addresses", false, "write addresses relative to the start address of the first region")
+	fs.StringVar(&a.versionMeta, "version-metadata", versionMetadataNone, "where to record the schema and tool versions: \"none\", \"comment\" (a record before the header), \"column\" or \"sidecar\" (<output>.meta.json)")
+	fs.BoolVar(&a.writeMeta, "meta", false, "write capture metadata (hostname, kernel version, page size, capture time, command line and processes) to <output>.meta.json")
+	fs.StringVar(&a.unknownFields, "unknown-fields", unknownFieldsKeep, "what to do with fields unknown to this tool, e.g. of a newer kernel: \"keep\" them as they are, \"drop\" them with a warning of the first occurrence of each, or fail with an \"error\"; the values of the known fields are checked to be integers in their units, and malformed ones fail the conversion unless -skip-bad-lines")
+	fs.BoolVar(&a.kernelCompat, "kernel-compat", false, "emit the same fields for captures from any kernel version: fields missing in the capture are written empty and unknown fields are dropped (ignored with -fields-file)")
+	fs.BoolVar(&a.canonicalOrder, "canonical-order", false, "emit fields in the documented kernel order regardless of the input order; unknown fields follow in input order")
+	fs.DurationVar(&a.throttle, "throttle", 0, "time to sleep after reading each region, to reduce the impact on the observed process")
+	fs.IntVar(&a.nice, "nice", 0, "nice value to run with, e.g. 19 for the lowest CPU priority (default: unchanged)")
+	fs.StringVar(&a.ionice, "ionice", "", "I/O scheduling priority to run with: \"idle\" or \"best-effort[:level]\" (default: unchanged)")
+	fs.BoolVar(&a.requireRoot, "require-root", false, "exit with an error unless running as root")
+	fs.StringVar(&a.dropUser, "drop-privileges", "", "when running as root, switch to this user (name or uid) after opening the input and before parsing and writing output")
+	fs.BoolVar(&a.sandbox, "sandbox", false, "after opening the input and output, restrict this process with Landlock and seccomp to reading /proc and writing the output (requires a build with CGO_ENABLED=0)")
+	fs.BoolVar(&a.reproducible, "reproducible", false, "produce byte-identical output for identical input: sort by addresses unless -sort is set, round computed columns to 6 decimal places unless -precision or -sig-digits is set, and omit capture time and hostname from metadata")
+	fs.IntVar(&a.maxRows, "max-rows", 0, "split output into numbered files (e.g. out.0001.csv) of at most this many rows each, not counting headers (default: no limit)")
+	fs.StringVar(&a.maxSizeStr, "max-size", "", "split output into numbered files (e.g. out.0001.csv) of at most this size each, e.g. 100M (default: no limit)")
+	fs.StringVar(&a.maxMemoryStr, "max-memory", "", "bound the memory of the rows buffered by -union-fields and of the groups of -group-by and -subtotals to about this size, e.g. 64M, by spilling them to temporary files, whose groups are then written in the order of their keys; cannot be used with the sorts of -sort, -sort-by and -reproducible (default: no limit)")
+	fs.BoolVar(&a.hostPaths, "host-paths", false, "add a HostPath column with file pathnames resolved through /proc/<pid>/root, e.g. into the overlayfs of a container (requires /proc/<pid>/smaps as input)")
+	fs.BoolVar(&a.resolveInodes, "resolve-inodes", false, "add a ResolvedPath column with the pathname of the file found by the device and inode of regions without a pathname, e.g. some shmem mappings, searching the mount points of the device in /proc/<pid>/mountinfo (requires /proc/<pid>/smaps as input)")
+	fs.StringVar(&a.inodeSearch, "inode-search", "", "comma separated directories of the process to search for -resolve-inodes instead of the mount points of the device, e.g. /dev/shm")
+	fs.BoolVar(&a.mountColumns, "mounts", false, "add MountPoint and FsType columns with the mount point and the filesystem type, e.g. overlay, tmpfs, ext4 or nfs4, of the files of file-backed regions, from /proc/<pid>/mountinfo (requires /proc/<pid>/smaps as input)")
+	fs.BoolVar(&a.numa, "numa", false, "add columns N0, N1, ... with the number of pages of the region on each NUMA node, from /proc/<pid>/numa_maps (requires /proc/<pid>/smaps as input)")
+	fs.BoolVar(&a.swapDevices, "swap-devices", false, "add a column Swap_<device>, e.g. Swap_zram0, for each swap device in /proc/swaps with the swap of the region on it in kB, from /proc/<pid>/pagemap (requires /proc/<pid>/smaps as input, and root or CAP_SYS_ADMIN)")
+	fs.IntVar(&a.pageContent, "page-content", 0, "sample the contents of up to this many resident pages of each readable region, adding columns SampledPages, ZeroPageRatio with the fraction of the sampled pages which are all zero, and Entropy with the bits per byte of the other sampled pages, whose ratio to 8 roughly estimates their compressibility, e.g. for sizing zram, zswap or ballooning (requires /proc/<pid>/smaps of a live process as input, and root or CAP_SYS_PTRACE)")
+	fs.StringVar(&a.pageContentPath, "page-content-path", "", "regular expression of the pathnames of the regions sampled by -page-content (default: all readable regions)")
+	fs.BoolVar(&a.mincore, "mincore", false, "add a CachedPages column with the number of the pages of the file of a file-backed region which are in the page cache, by mapping the file read-only and calling mincore, which needs only the permission to read the file rather than access to the process like -pagemap; the files are opened on this host, through the root of the process with -host-paths")
+	fs.BoolVar(&a.pagemap, "pagemap", false, "add columns PresentPages, SwappedPages and ExclusivePages with the numbers of the pages of the region which are resident, swapped out and resident and mapped only by the process, from /proc/<pid>/pagemap (requires /proc/<pid>/smaps of a live process as input, and the permission to ptrace it)")
+	fs.BoolVar(&a.threadStacks, "thread-stacks", false, "add a StackThread column with the tid and name of the threads whose stack pointers are in the region, from /proc/<pid>/task (requires /proc/<pid>/smaps as input, and root or CAP_SYS_PTRACE for other users' processes)")
+	fs.BoolVar(&a.withProcInfo, "with-proc-info", false, "add Pid, Comm, Cmdline and Uid columns with the pid, the command name, the command line and the real uid of the process (requires /proc/<pid>/smaps as input)")
+	fs.BoolVar(&a.nsPid, "ns-pid", false, "add Pid and NsPid columns with the pid of the process and its pid in the innermost pid namespace, e.g. of a container (requires /proc/<pid>/smaps as input)")
+	fs.BoolVar(&a.cgroupPath, "cgroup-path", false, "add a CgroupPath column with the cgroup of the process from /proc/<pid>/cgroup (requires /proc/<pid>/smaps as input)")
+	fs.BoolVar(&a.outputFileOptions.atomic, "atomic", true, "write output to a temporary file in the output directory and rename it when the conversion succeeds, so that an interrupted run never leaves a truncated file; -atomic=false writes to the output file directly")
+	fs.StringVar(&a.outputMode, "output-mode", "", "octal permission bits of output files regardless of the umask, e.g. 0640 (default: 0666 minus the umask)")
+	fs.StringVar(&a.outputOwner, "output-owner", "", "owner of output files in the form user[:group] (requires root; default: the user running this tool)")
+	fs.StringVar(&a.lockFilename, "lock-file", "", "lock file held while running, so that another instance with the same lock file fails with an error naming the holder instead of writing the same output")
+	fs.BoolVar(&a.logJournald, "log-journald", false, "send log messages to journald, with a summary entry having the fields TARGET_PID, DURATION_USEC and ROWS at the end of a run")
+	fs.BoolVar(&a.timestampColumn, "timestamp", false, "add a Timestamp column with the capture time (empty with -reproducible)")
+	fs.StringVar(&a.timeFormat, "time-format", timeFormatRFC3339, "format of timestamp columns: \"rfc3339\", \"unix\" (seconds) or \"unixms\" (milliseconds)")
+	fs.StringVar(&a.timeZone, "time-zone", "UTC", "time zone of timestamp columns in the rfc3339 format, e.g. \"Local\" or \"Asia/Tokyo\"")
+	fs.Var(&a.sinkSpecs, "sink", "additional output written in the same run as format:destination, where format is \"csv\", \"ndjson\" or \"prom\" (Rss, Pss and Swap per pathname in the Prometheus text format) and destination is a file, or unix:path or tcp:host:port for ndjson (may be repeated)")
+	fs.StringVar(&a.summaryPath, "summary", "", "file to write a JSON summary of the run to (input and output files, regions, warnings, sources which failed to be read, bytes read and written, duration and error), or \"-\" for the standard error")
+	fs.IntVar(&a.retry.retries, "retries", 0, "number of times to read a source again after a transient failure, i.e. a process in /proc which is busy, e.g. stopped by a tracer, or an SSH connection of fleet which fails; the failures of each source are in the summary of -summary")
+	fs.DurationVar(&a.retry.backoff, "retry-backoff", time.Second, "time to wait before the first retry of -retries, doubled before each of the following ones")
+	fs.BoolVar(&a.printStats, "stats", false, "print a human-readable summary (regions, processes, total Pss, warnings and elapsed time) to the standard error at the end of the run")
+	fs.BoolVar(&a.checkOrder, "check-order", false, "report regions whose address ranges overlap or are not in increasing order, which indicates a capture racing with mapping changes or concatenated captures")
+	fs.BoolVar(&a.strict, "strict", false, "fail on problems in the input which are otherwise reported as warnings, such as violations found by -check-order and truncated captures")
+	fs.StringVar(&a.groupBy, "group-by", "", "aggregate mappings into one row per group with the number of regions and the sums of kB fields; \"pathname\" groups by pathname, with [anon] for anonymous mappings; \"basename\" groups files by their last path element, e.g. libc.so.6; \"perms\" groups by permissions, e.g. r-xp; \"category\" groups by the categories of -category; \"top-dir\" groups by the top-level path component, e.g. /usr, /opt/app, [heap] or [anon]; \"anon-name\" groups anonymous regions named by PR_SET_VMA_ANON_NAME by their name, e.g. [anon:libc_malloc], and other regions like top-dir; \"stack\" groups by category and pathname as the frames of -format folded")
+	fs.StringVar(&a.groupBy, "aggregate", "", "same as -group-by")
+	fs.BoolVar(&a.expandVmFlags, "expand-vmflags", false, "replace the VmFlags column with a 0/1 column for each known flag, e.g. VmFlags_wr and VmFlags_hg, and VmFlags_other with the unknown flags")
+	fs.StringVar(&a.columnList, "columns", "", "comma separated names of the columns to write in this order, e.g. Pathname,Rss,Pss,Swap (default: all columns)")
+	fs.Var(&a.columnRuleSpecs, "column-rule", "transformation of a column applied to the rows of the output and of -sink alike, as Column:drop, Column:hash (a hash of each value, which is the same for the same value), Column:truncate:<length> in characters or Column:bucket[:<size>] rounding numbers down to multiples of size, or to powers of two without it, e.g. Pathname:hash or Rss:bucket; set them in -config to enforce them centrally (may be repeated)")
+	fs.StringVar(&a.filterPerms, "filter-perms", "", "write only the mappings with one of the comma separated permissions, e.g. rw-p,r-xp")
+	fs.StringVar(&a.filterPath, "filter-path", "", "write only the mappings whose pathname matches this regular expression, e.g. 'libc|\\.so'")
+	fs.Float64Var(&a.minRss, "min-rss", 0, "write only the mappings whose Rss is at least this many kB, e.g. to drop guard pages without resident memory")
+	fs.StringVar(&a.subtotals, "subtotals", "", "append subtotal rows of each group of -group-by keys, e.g. \"category\" for heap, stack, anon, file, lib and so on, after the mappings; a subtotal row has the pathname [subtotal:<group>] and the sums of kB fields")
+	fs.BoolVar(&a.totals, "totals", false, "append a total row with the pathname [total], the number of regions and the sums of kB fields of all mappings, as in smaps_rollup")
+	fs.StringVar(&a.totalsPath, "totals-out", "", "CSV file to write the header and the total row of -totals to instead of, or in addition to with -totals, appending it to the output")
+	fs.StringVar(&a.typesPath, "types", "", "JSON type manifest of -types-out declaring the type of each output column (uint64, int64, float64, string or bool), which is enforced while converting so that a malformed value fails the conversion rather than the load of the output")
+	fs.StringVar(&a.typesOutPath, "types-out", "", "JSON file to write the type manifest of the output columns to, with the units of memory sizes, for loaders to declare the column types")
+	fs.BoolVar(&a.uss, "uss", false, "add a Uss column with the unique set size of the region, Private_Clean + Private_Dirty, computed like -derive (requires these fields in the output)")
+	fs.StringVar(&a.lazyFreePolicy, "lazyfree-policy", lazyFreeInclude, "how -uss counts LazyFree pages freed with MADV_FREE, e.g. by jemalloc: \"include\" them as the kernel does until it reclaims them, or \"exclude\" them as already given back (requires LazyFree in the output)")
+	fs.BoolVar(&a.trueCost, "true-cost", false, "add a TrueCost column computed by -true-cost-expr like -derive, which is also the default sort key of the groups of -group-by")
+	fs.StringVar(&a.trueCostExpr, "true-cost-expr", defaultTrueCostExpr, "formula of the TrueCost column of -true-cost")
+	fs.StringVar(&a.shape, "shape", shapeWide, "shape of the output: \"wide\" with a row per region and a column per field, or \"long\" with a row per region and kB field with the columns AddressStart, Pathname, FieldName and ValueKB, after Timestamp and process columns, or Group for -group-by")
+	fs.BoolVar(&a.skipBadLines, "skip-bad-lines", false, "skip malformed lines, e.g. of truncated or edited captures, with warnings of their line numbers and contents, instead of failing; the fields of a malformed region line are skipped with it")
+	fs.BoolVar(&a.sourceColumns, "source-columns", false, "add a SourceLine column with the line number of the region line in the input, preceded by a SourceFile column with the input filename with -p or a glob pattern of -i")
+	fs.BoolVar(&a.regionSizeColumn, "region-size", false, "add a RegionSize column with the size of the region in bytes, AddressEnd - AddressStart, formatted like the addresses")
+	fs.BoolVar(&a.regionKey, "region-key", false, "add a RegionKey column with a hash of the components of -region-key-components, which stays the same for a region across snapshots of a process despite ASLR, for time series databases to track regions by; regions with the same components are told apart by their order")
+	fs.StringVar(&a.regionKeyComponents, "region-key-components", "", "comma separated components of -region-key from pathname, perms, offset, size, dev and inode (default "+defaultRegionKeyComponents+")")
+	fs.StringVar(&a.addrFormat, "addr-format", addrFormatHex, "format of AddressStart, AddressEnd, Offset and RegionSize: \"hex\" as in smaps or \"dec\" for decimal numbers")
+	fs.BoolVar(&a.anonNameColumn, "anon-name", false, "add an AnonName column with the name of anonymous regions named by PR_SET_VMA_ANON_NAME, e.g. libc_malloc for [anon:libc_malloc]")
+	fs.BoolVar(&a.backingColumns, "backing", false, "add an IsDeleted column, true for files which have been removed or replaced, and a BackingType column of the object backing the region: file, memfd, shm (POSIX shared memory under /dev/shm), sysv, anon_inode, anon or pseudo (other bracketed pathnames, e.g. [heap])")
+	fs.StringVar(&a.normalizePaths, "normalize-paths", "", "comma separated rules rewriting the pathnames before they are grouped, filtered and written, so that aggregations are not fragmented by incidental naming differences: \"so-version\" strips the version suffixes of shared libraries (libfoo.so.1.2.3 to libfoo.so), \"overlay-id\" replaces the hash-named layer and snapshot directories of container runtimes with <id>, \"proc-fd\" maps /proc/<pid>/fd/<n> and /dev/fd/<n> to /proc/self/fd/<fd>, or \"all\"")
+	fs.Var(&a.normalizeRuleSpecs, "normalize-rule", "rule rewriting the pathnames as with -normalize-paths, as regexp=>replacement, in which $1 refers to the first submatch, e.g. '/build-[0-9]+/=>/build-N/'; applied after those of -normalize-paths (may be repeated)")
+	fs.BoolVar(&a.stripDeleted, "strip-deleted", false, "remove the \" (deleted)\" suffix from pathnames, so that the regions of a replaced file are grouped and filtered with those of the file; use -backing to keep telling them apart")
+	fs.StringVar(&a.kind, "kind", smapsKindSmaps, "kind of input: \"smaps\", or \"smaps_rollup\" for /proc/<pid>/smaps_rollup, whose single pseudo-region with the sums of all mappings is written as one row; -p then reads smaps_rollup, which is much cheaper for sampling many processes")
+	fs.BoolVar(&a.unionFields, "union-fields", false, "allow regions with different fields, e.g. THPeligible only in some of them, by writing the union of the fields with empty values for missing ones; the whole input is buffered to write the header, in temporary files beyond -max-memory")
+	fs.BoolVar(&a.categoryColumn, "category", false, "add a Category column classifying regions as file, lib (shared libraries), deleted (removed or replaced files), device (files under /dev), anon, heap, stack, stack-guard (the guard page below a thread stack), guard (other inaccessible ---p regions reserving address space), shm or kernel")
+	fs.BoolVar(&a.dedupe, "dedupe", false, "drop regions which are exact duplicates of earlier ones (same addresses, permissions, pathname and counters), e.g. in concatenated captures")
+	fs.BoolVar(&a.mergeAdjacent, "merge-adjacent", false, "merge contiguous regions with the same pathname and permissions, into which the kernel splits a mapping, into one region spanning their addresses with the sums of their kB fields; the offset and the other fields, e.g. VmFlags, are those of the first region")
+	fs.BoolVar(&a.truncatedColumn, "truncated-column", false, "add a Truncated column which is true for the last region of a capture ending in the middle of the region, whose missing fields are empty")
+	fs.StringVar(&a.anomalyLogPath, "anomaly-log", "", "file to append parse warnings and skipped input to as NDJSON, or \"-\" for the standard error")
+	fs.StringVar(&a.keepRawDir, "keep-raw", "", "directory to save the gzip compressed raw input and a manifest, for converting it again later")
+	fs.StringVar(&a.teeRawPath, "tee-raw", "", "file to copy the exact bytes of the input to while converting, e.g. to preserve a live /proc/<pid>/smaps or the standard input; the rest of the input is copied even if the conversion fails")
+}
+
+// validate checks the conversion options and applies presets. It must be
+// called after fs is parsed.
+func (a *args) validate(fs *flag.FlagSet) error {
+	if a.locale != "" {
+		if a.locale != localeEU {
+			return fmt.Errorf("unsupported locale (-locale): %q", a.locale)
+		}
+		setFlags := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+		if !setFlags["sep"] {
+			a.Separator = ";"
+		}
+		if !setFlags["decimal-sep"] {
+			a.decimalSep = ","
+		}
+		if !setFlags["thousands-sep"] {
+			a.thousandsSep = "."
+		}
 	}
-	defer inputFile.Close()
 
-	outputFile, err := os.Create(args.outputFilename)
-	if err != nil {
+	if len(a.Separator) != 1 {
+		return errors.New("separator (-sep) must be one character")
+	}
+	switch a.versionMeta {
+	case versionMetadataNone, versionMetadataComment, versionMetadataColumn, versionMetadataSidecar:
+	default:
+		return fmt.Errorf("unsupported version metadata location (-version-metadata): %q", a.versionMeta)
+	}
+	if a.trueCostExpr != defaultTrueCostExpr && !a.trueCost {
+		return errors.New("-true-cost-expr requires -true-cost")
+	}
+	if err := a.validateFolded(); err != nil {
 		return err
 	}
-	defer outputFile.Close()
+	if a.trueCost && a.groupBy != "" && a.sortOrder == "" {
+		a.sortOrder = sortByTrueCost
+	}
+	if a.reproducible {
+		// The stable sort of -sort-by is deterministic by itself.
+		if a.sortOrder == "" && a.sortByStr == "" {
+			a.sortOrder = sortByAddresses
+		}
+		if a.floatFormat.precision == -1 && a.floatFormat.sigDigits == 0 {
+			a.floatFormat.precision = reproduciblePrecision
+		}
+		if a.pseudonymize && a.salt == "" {
+			return errors.New("-pseudonymize with -reproducible requires -salt")
+		}
+	}
+	if a.floatFormat.precision != -1 && a.floatFormat.sigDigits != 0 {
+		return errors.New("-precision and -sig-digits are mutually exclusive")
+	}
+	if a.floatFormat.precision < -1 || a.floatFormat.sigDigits < 0 {
+		return errors.New("-precision and -sig-digits must not be negative")
+	}
+	switch a.sortOrder {
+	case "", sortByAddresses:
+	case sortByTrueCost:
+		if !a.trueCost {
+			return errors.New("-sort truecost requires -true-cost")
+		}
+	default:
+		return fmt.Errorf("unsupported sort order (-sort): %q", a.sortOrder)
+	}
+	if a.sortByStr != "" {
+		if a.sortOrder != "" {
+			return errors.New("-sort-by cannot be used with -sort")
+		}
+		key, err := parseSortKey(a.sortByStr)
+		if err != nil {
+			return err
+		}
+		a.sortBy = key
+	}
 
-	w := csv.NewWriter(outputFile)
-	sep, _ := utf8.DecodeRuneInString(args.Separator)
-	w.Comma = sep
-	if err := convertSmapsToCsv(w, inputFile); err != nil {
+	if err := a.validateUnknownFields(); err != nil {
 		return err
 	}
-	return err
+	if err := a.validatePageContent(); err != nil {
+		return err
+	}
+	if err := a.validateRegionKey(); err != nil {
+		return err
+	}
+	if a.dropUser != "" && a.dumpDir != "" {
+		return errors.New("-drop-privileges cannot be used with -dump-dir, which needs privileges while converting")
+	}
+	if a.maxSizeStr != "" {
+		size, err := parseByteSize(a.maxSizeStr)
+		if err != nil {
+			return fmt.Errorf("invalid -max-size: %w", err)
+		}
+		a.maxSize = size
+	}
+	if a.maxRows < 0 || a.maxSize < 0 {
+		return errors.New("-max-rows and -max-size must not be negative")
+	}
+	if err := a.validateMaxMemory(); err != nil {
+		return err
+	}
+	if a.outputMode != "" {
+		mode, err := parseFileMode(a.outputMode)
+		if err != nil {
+			return fmt.Errorf("invalid -output-mode: %w", err)
+		}
+		a.outputFileOptions.mode = mode
+	}
+	if a.outputOwner != "" {
+		if a.dropUser != "" {
+			return errors.New("-output-owner cannot be used with -drop-privileges, as output files are created by the user to drop privileges to")
+		}
+		owner, err := parseFileOwner(a.outputOwner)
+		if err != nil {
+			return fmt.Errorf("invalid -output-owner: %w", err)
+		}
+		a.outputFileOptions.owner = owner
+	}
+	if a.groupBy != "" {
+		if _, ok := groupKeyFuncs[a.groupBy]; !ok {
+			return fmt.Errorf("unsupported -group-by: %q", a.groupBy)
+		}
+	}
+	if a.minRss < 0 {
+		return errors.New("-min-rss must not be negative")
+	}
+	if a.addrFormat != addrFormatHex && a.addrFormat != addrFormatDec {
+		return fmt.Errorf("unsupported -addr-format: %q", a.addrFormat)
+	}
+	if a.subtotals != "" {
+		if _, ok := groupKeyFuncs[a.subtotals]; !ok {
+			return fmt.Errorf("unsupported -subtotals: %q", a.subtotals)
+		}
+		if a.groupBy != "" {
+			return errors.New("-subtotals cannot be used with -group-by")
+		}
+	}
+	if err := a.validateKind(); err != nil {
+		return err
+	}
+	if err := a.validateShape(); err != nil {
+		return err
+	}
+	if err := a.validateColumnRules(); err != nil {
+		return err
+	}
+	if err := a.validatePathNormalization(); err != nil {
+		return err
+	}
+	switch a.format {
+	case "", outputFormatCSV:
+	case outputFormatJSON, outputFormatNDJSON, outputFormatSQLite, outputFormatParquet, outputFormatArrow, outputFormatFolded, outputFormatXLSX:
+		if a.decimalSep != "." || a.thousandsSep != "" {
+			return fmt.Errorf("-format %s requires numbers with a '.' decimal separator and no thousands separator", a.format)
+		}
+		if a.splitsOutput() {
+			return fmt.Errorf("-format %s cannot be used with -max-rows or -max-size", a.format)
+		}
+		if tableFileBuilders[a.format] != nil && a.outputFilename == stdioName {
+			return errTableFileStdout(a.format)
+		}
+	case outputFormatTemplate:
+		if a.templatePath == "" {
+			return errors.New("-format template requires -template")
+		}
+		if a.splitsOutput() {
+			return fmt.Errorf("-format %s cannot be used with -max-rows or -max-size", a.format)
+		}
+	default:
+		return fmt.Errorf("unsupported output format: %q", a.format)
+	}
+	switch a.jsonLayout {
+	case "", jsonLayoutFields:
+	case jsonLayoutTyped:
+		if a.format != outputFormatJSON && a.format != outputFormatNDJSON {
+			return errors.New("-json-layout typed requires -format json or ndjson")
+		}
+	default:
+		return fmt.Errorf("unsupported -json-layout: %q", a.jsonLayout)
+	}
+	if err := a.validateSample(); err != nil {
+		return err
+	}
+	if err := a.validateCSVDialect(); err != nil {
+		return err
+	}
+	if err := a.validateNullAs(); err != nil {
+		return err
+	}
+	if err := a.validateCompress(); err != nil {
+		return err
+	}
+	if a.templatePath != "" && a.format != outputFormatTemplate {
+		return errors.New("-template requires -format template")
+	}
+	a.units = canonicalUnits(a.units)
+	for _, s := range a.sinkSpecs {
+		spec, err := parseSinkSpec(s)
+		if err != nil {
+			return fmt.Errorf("invalid -sink: %w", err)
+		}
+		if spec.format != sinkFormatCSV && (a.decimalSep != "." || a.thousandsSep != "") {
+			return fmt.Errorf("-sink %s requires numbers with a '.' decimal separator and no thousands separator", spec.format)
+		}
+		if spec.format == sinkFormatProm && a.units != unitsKB {
+			return errors.New("-sink prom requires -units kB")
+		}
+		if spec.format == sinkFormatProm && a.groupBy != "" {
+			return errors.New("-sink prom cannot be used with -group-by")
+		}
+		a.sinks = append(a.sinks, spec)
+	}
+	if a.inodeSearch != "" && !a.resolveInodes {
+		return errors.New("-inode-search requires -resolve-inodes")
+	}
+	if err := a.validateTypes(); err != nil {
+		return err
+	}
+	if err := a.validateRetry(); err != nil {
+		return err
+	}
+	if a.requireRoot && os.Geteuid() != 0 {
+		return errors.New("must be run as root (-require-root)")
+	}
+	return nil
 }
 
-func convertSmapsToCsv(w *csv.Writer, r io.Reader) error {
-	br := bufio.NewReaderSize(r, maxLineLength)
-	var m mapping
-	var firstLineFieldLabels []string
-	regionIndex := -1
-	var prevRegionLineNo int
-	lineNo := 0
-	for {
-		line, err := readLine(br)
+func run(args args) error {
+	if args.stats == nil {
+		args.stats = &runStats{}
+	}
+	if args.lockFilename != "" {
+		lock, err := acquireLock(args.lockFilename)
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
 			return err
 		}
-		lineNo++
-
-		if isRegionLine(line) {
-			regionIndex++
-
-			if regionIndex > 0 {
-				if regionIndex == 1 {
-					if err := w.Write(m.toCSVHeader()); err != nil {
-						return err
-					}
-					firstLineFieldLabels = m.FieldNames
-				} else {
-					if err := m.checkFieldNames(firstLineFieldLabels, prevRegionLineNo); err != nil {
-						return err
-					}
-				}
-
-				if err := w.Write(m.toCSVRecord()); err != nil {
-					return err
-				}
-			}
-
-			r, err := parseRegion(line)
+		defer lock.release()
+	}
+	if err := args.prepare(); err != nil {
+		return err
+	}
+	if args.nice != 0 || args.ionice != "" {
+		var ioClass, ioLevel int
+		if args.ionice != "" {
+			var err error
+			ioClass, ioLevel, err = parseIOPriority(args.ionice)
 			if err != nil {
 				return err
 			}
-			m.clear()
-			m.Region = r
+		}
+		if err := lowerPriority(args.nice, ioClass, ioLevel); err != nil {
+			return fmt.Errorf("adjust priority: %w", err)
+		}
+	}
 
-			prevRegionLineNo = lineNo
-		} else {
-			name, value, err := parseField(line)
-			if err != nil {
+	// All inputs are opened before dropping privileges. In batch mode,
+	// inputs which cannot be read, e.g. of processes which have exited,
+	// are skipped with warnings.
+	inputFilenames := args.inputFilenames
+	if len(inputFilenames) == 0 {
+		inputFilenames = []string{args.inputFilename}
+	} else if args.sortOrder == sortByAddresses {
+		// The mappings of each input are sorted by start address, so the
+		// inputs are sorted to order those of equal addresses by PID.
+		inputFilenames = append([]string(nil), inputFilenames...)
+		sortInputFilenames(inputFilenames)
+	}
+	if args.checkpointDir != "" {
+		cp, err := openCheckpoint(args.checkpointDir, args.resume)
+		if err != nil {
+			return err
+		}
+		args.checkpoint = cp
+		inputFilenames = args.checkpoint.inputs(inputFilenames)
+	}
+	var sources []*inputSource
+	var skipped []error
+	for _, filename := range inputFilenames {
+		src, err := openInput(args, filename)
+		if err != nil {
+			if !args.batch {
 				return err
 			}
-			m.appendField(string(name), string(value))
+			skipped = append(skipped, err)
+			continue
 		}
+		defer src.file.Close()
+		sources = append(sources, src)
 	}
 
-	if err := m.checkFieldNames(firstLineFieldLabels, prevRegionLineNo); err != nil {
-		return err
-	}
-	if err := w.Write(m.toCSVRecord()); err != nil {
-		return err
+	if args.dropUser != "" {
+		if err := dropPrivileges(args.dropUser); err != nil {
+			return fmt.Errorf("drop privileges: %w", err)
+		}
 	}
-	w.Flush()
 
-	if err := w.Error(); err != nil {
+	w, err := createOutputs(args, args.outputFilename)
+	if err != nil {
 		return err
 	}
-	return nil
-}
-
-const lf = '\n'
-
-func readLine(r *bufio.Reader) ([]byte, error) {
-	line, err := r.ReadBytes(lf)
-	if err != nil {
-		return nil, err
+	defer w.Abort()
+	var teeRaw *outputFile
+	if args.teeRawPath != "" {
+		teeRaw, err = createOutputFile(args.teeRawPath, args.outputFileOptions)
+		if err != nil {
+			return fmt.Errorf("tee raw input: %w", err)
+		}
+		defer teeRaw.abort()
 	}
-	return bytes.TrimRight(line, "\n"), nil
-}
 
-func isRegionLine(line []byte) bool {
-	// Region line contains ASCII space before colon
-	// fcf0001000-fcf0002000 rw-p 00000000 00:00 0
-	i := bytes.IndexByte(line, ':')
-	if i == -1 {
-		panic("unexpected line format, no colon found")
+	if args.anomalyLogPath != "" {
+		args.anomalies, err = openAnomalyLog(args.anomalyLogPath, args.inputFilename, !args.reproducible)
+		if err != nil {
+			return err
+		}
+		defer args.anomalies.Close()
+	} else {
+		args.anomalies = &anomalyLog{file: args.inputFilename}
 	}
-	return bytes.IndexByte(line[:i], ' ') != -1
-}
-
-func parseRegion(line []byte) (*region, error) {
-	addressStart, rest, ok := bytes.Cut(line, []byte{'-'})
-	if !ok {
-		return nil, errBadFormat
-	}
-	addressEnd, rest, ok := bytes.Cut(rest, []byte{' '})
-	if !ok {
-		return nil, errBadFormat
-	}
-	perms, rest, ok := bytes.Cut(rest, []byte{' '})
-	if !ok {
-		return nil, errBadFormat
-	}
-	offset, rest, ok := bytes.Cut(rest, []byte{' '})
-	if !ok {
-		return nil, errBadFormat
-	}
-	dev, rest, ok := bytes.Cut(rest, []byte{' '})
-	if !ok {
-		return nil, errBadFormat
-	}
-	inode, rest, ok := bytes.Cut(rest, []byte{' '})
-	if !ok {
-		return nil, errBadFormat
-	}
-	pathname := bytes.TrimSpace(rest)
-	return &region{
-		AddressStart: addressStart,
-		AddressEnd:   addressEnd,
-		Perms:        perms,
-		Offset:       offset,
-		Dev:          dev,
-		Inode:        inode,
-		Pathname:     pathname,
-	}, nil
-}
-
-func (m *mapping) clear() {
-	m.Region = nil
-	m.FieldNames = nil
-	m.FieldValues = nil
-}
-
-func (m *mapping) appendField(name, value string) {
-	m.FieldNames = append(m.FieldNames, name)
-	m.FieldValues = append(m.FieldValues, value)
-}
-
-func (m *mapping) toCSVHeader() []string {
-	return append([]string{
-		"AddressStart",
-		"AddressEnd",
-		"Perms",
-		"Offset",
-		"Dev",
-		"Inode",
-		"Pathname",
-	}, m.FieldNames...)
-}
+	defer func() { args.stats.warnings += args.anomalies.count }()
 
-func (m *mapping) toCSVRecord() []string {
-	return append([]string{
-		string(m.Region.AddressStart),
-		string(m.Region.AddressEnd),
-		string(m.Region.Perms),
-		string(m.Region.Offset),
-		string(m.Region.Dev),
-		string(m.Region.Inode),
-		string(m.Region.Pathname),
-	}, m.FieldValues...)
-}
-
-func (m *mapping) checkFieldNames(firstLineFieldNames []string, regionLineNo int) error {
-	if !reflect.DeepEqual(m.FieldNames, firstLineFieldNames) {
-		return fmt.Errorf("field names mismatch betweeen the first region and the region at line %d\n"+
-			"fields in first region:%v\n"+
-			"feilds in region at line %d:%v",
-			regionLineNo, firstLineFieldNames,
-			regionLineNo, m.FieldNames)
+	var growth *growthLog
+	if args.growthLogPath != "" {
+		growth, err = openGrowthLog(args.growthLogPath)
+		if err != nil {
+			return err
+		}
+		defer growth.Close()
+		args.growth = &growthTracker{}
+	}
+	if args.baselinePath != "" {
+		sep, _ := utf8.DecodeRuneInString(args.Separator)
+		args.regression, err = newRegressionChecker(args.baselinePath, sep, args.regressionRules)
+		if err != nil {
+			return err
+		}
+	}
+	if len(args.failConditions) > 0 {
+		args.failIf = newFailChecker(args.failConditions)
+	}
+	if len(args.alertRules) > 0 {
+		args.alerts = newAlertEngine(args.alertRules)
 	}
-	return nil
-}
 
-func parseField(line []byte) (name, value []byte, err error) {
-	name, rest, ok := bytes.Cut(line, []byte{':'})
-	if !ok {
-		return nil, nil, errBadFormat
+	for _, err := range skipped {
+		args.anomalies.report(0, fmt.Sprintf("skipped input: %v", err), "")
+	}
+	if len(sources) == 0 {
+		return errors.New("none of the inputs could be read")
 	}
 
-	value = bytes.TrimLeft(rest, " ")
-	if !bytes.Equal(name, []byte("VmFlags")) {
-		value, _, _ = bytes.Cut(value, []byte{' '})
+	notifier, err := newSystemdNotifier()
+	if err != nil {
+		return fmt.Errorf("connect to systemd notification socket: %w", err)
 	}
-	return name, value, nil
+	defer notifier.Close()
+
+	if args.sandbox {
+		var writableDirs []string
+		if args.outputFilename != stdioName && (args.outputFileOptions.atomic || args.splitsOutput() || args.writeMeta || args.versionMeta == versionMetadataSidecar) {
+			writableDirs = append(writableDirs, filepath.Dir(args.outputFilename))
+		}
+		if args.dumpDir != "" {
+			writableDirs = append(writableDirs, args.dumpDir)
+		}
+		if args.keepRawDir != "" {
+			writableDirs = append(writableDirs, args.keepRawDir)
+		}
+		if args.checkpointDir != "" {
+			writableDirs = append(writableDirs, args.checkpointDir)
+		}
+		if args.teeRawPath != "" {
+			writableDirs = append(writableDirs, filepath.Dir(args.teeRawPath))
+		}
+		for _, spec := range args.sinks {
+			if dir := spec.dir(); dir != "" {
+				writableDirs = append(writableDirs, dir)
+			}
+		}
+		if args.summaryPath != "" && args.summaryPath != "-" {
+			writableDirs = append(writableDirs, filepath.Dir(args.summaryPath))
+		}
+		if args.shmReportPath != "" {
+			writableDirs = append(writableDirs, filepath.Dir(args.shmReportPath))
+		}
+		if args.compSwapPath != "" {
+			writableDirs = append(writableDirs, filepath.Dir(args.compSwapPath))
+		}
+		if args.lazyFreePath != "" {
+			writableDirs = append(writableDirs, filepath.Dir(args.lazyFreePath))
+		}
+		if args.numaReportPath != "" {
+			writableDirs = append(writableDirs, filepath.Dir(args.numaReportPath))
+		}
+		if args.totalsPath != "" {
+			writableDirs = append(writableDirs, filepath.Dir(args.totalsPath))
+		}
+		if args.typesOutPath != "" {
+			writableDirs = append(writableDirs, filepath.Dir(args.typesOutPath))
+		}
+		if err := enterSandbox(procRoot, writableDirs); err != nil {
+			return fmt.Errorf("enter sandbox: %w", err)
+		}
+	}
+
+	status := "converting " + args.inputFilename
+	if args.batch {
+		status = fmt.Sprintf("converting %d inputs", len(sources))
+	}
+	if err := notifier.notify("READY=1\nSTATUS=" + status); err != nil {
+		return fmt.Errorf("notify systemd: %w", err)
+	}
+	notifier.startWatchdog()
+
+	var captureTime time.Time
+	if !args.reproducible {
+		captureTime = time.Now()
+	}
+	startTime := time.Now()
+	args.captureTime = captureTime
+	if args.shmReportPath != "" {
+		args.shmReport = &shmReport{}
+	}
+	if args.compSwapPath != "" {
+		args.compSwapReport = newCompressedSwapReport()
+	}
+	if args.lazyFreePath != "" {
+		args.lazyFreeReport = newLazyFreeReport(args.lazyFreeMin)
+	}
+	if args.numaReportPath != "" {
+		args.numaReport = newNumaReport()
+	}
+	if args.numa && args.batch {
+		// Processes may have pages on different nodes, while the header
+		// must have all of them.
+		for _, src := range sources {
+			args.numaNodes = mergeNumaNodes(args.numaNodes, src.args.numaNodes)
+		}
+	}
+	mw := newMappingWriter(w, args)
+	var pids []int
+	if args.batch && args.readLimiter == nil {
+		// The limiter is shared by the samples of watch mode.
+		args.readLimiter = newReadLimiter(args.maxConcurrentReads, args.maxReadsPerSec)
+	}
+	convertSources := func(sources []*inputSource, captureTime time.Time) error {
+		var schedule *readSchedule
+		if args.spread > 0 {
+			schedule = newReadSchedule(time.Now(), args.spread, len(sources), rand.New(rand.NewSource(time.Now().UnixNano())))
+		}
+		var pc *parallelConversion
+		if args.jobs > 1 && args.batch {
+			pc = startParallelConversion(sources, args, captureTime, args.jobs)
+			defer pc.close()
+		}
+		for i, src := range sources {
+			if schedule != nil {
+				schedule.wait(i)
+			}
+			in := src.args
+			in.stats, in.anomalies, in.captureTime = args.stats, args.anomalies, captureTime
+			in.shmReport, in.growth, in.regression = args.shmReport, args.growth, args.regression
+			in.compSwapReport, in.lazyFreeReport, in.numaReport = args.compSwapReport, args.lazyFreeReport, args.numaReport
+			args.anomalies.file = in.inputFilename
+			pid := pidFromInputPath(in.inputFilename)
+			if pid != 0 {
+				pids = append(pids, pid)
+			}
+
+			args.stats.inputFiles = append(args.stats.inputFiles, in.inputFilename)
+			regions := 0
+			write := func(m *mapping) error {
+				regions++
+				if args.sourceColumns {
+					m.SourceFile = args.anonymizePath(in.inputFilename)
+				}
+				return mw.write(m)
+			}
+			var input io.Reader = src.file
+			var live *liveProcessReader
+			var err error
+			if pc != nil {
+				r := pc.result(i)
+				r.anomalies.replay(args.anomalies)
+				args.stats.merge(r.stats)
+				live, err = r.live, r.err
+				for _, m := range r.mappings {
+					if writeErr := write(m); writeErr != nil {
+						err = writeErr
+						break
+					}
+				}
+				pc.release(i)
+			} else {
+				if args.batch && pid != 0 && !src.saved {
+					live = &liveProcessReader{r: src.file, pid: pid, retry: args.retry}
+					input = live
+				}
+				input = countingReader{r: input, n: &args.stats.bytesRead}
+				if teeRaw != nil {
+					input = io.TeeReader(input, teeRaw)
+				}
+				input, err = decompressReader(input)
+				if err != nil {
+					return fmt.Errorf("%s: %w", in.inputFilename, err)
+				}
+				if src.archiver != nil {
+					input = io.TeeReader(input, src.archiver)
+				}
+				if src.checkpoint != nil {
+					input = io.TeeReader(input, src.checkpoint)
+				}
+				args.readLimiter.acquire()
+				err = convertMappings(input, in, write)
+				args.readLimiter.release()
+			}
+			if live != nil {
+				args.stats.addSource(in.inputFilename, live.failures, nil)
+			}
+			if err != nil {
+				if args.batch {
+					return fmt.Errorf("%s: %w", in.inputFilename, err)
+				}
+				if teeRaw != nil {
+					// The input is kept for investigating the failure.
+					if _, copyErr := io.Copy(io.Discard, input); copyErr == nil {
+						teeRaw.commit()
+					}
+				}
+				return err
+			}
+			if live != nil && live.exited {
+				args.anomalies.report(0, fmt.Sprintf("process %d exited while its smaps was read, so the output may be incomplete", pid), "")
+			} else if live != nil && regions == 0 {
+				// Kernel threads have no mappings.
+				args.stats.kernelThreads++
+				if args.kernelThreads == kernelThreadsInclude {
+					if err := mw.writeKernelThread(in.process); err != nil {
+						return err
+					}
+				}
+			}
+			if src.archiver != nil {
+				if err := src.archiver.finish(captureTime, args.outputFilename); err != nil {
+					return fmt.Errorf("keep raw input: %w", err)
+				}
+			}
+			if src.checkpoint != nil {
+				if err := src.checkpoint.finish(captureTime, args.outputFilename); err != nil {
+					return fmt.Errorf("save checkpoint: %w", err)
+				}
+			}
+		}
+		args.alerts.evaluate(captureTime)
+		return nil
+	}
+	scanStart := time.Now()
+	if err := convertSources(sources, captureTime); err != nil {
+		return err
+	}
+	scanDuration := time.Since(scanStart)
+	if teeRaw != nil {
+		if err := teeRaw.commit(); err != nil {
+			return fmt.Errorf("tee raw input: %w", err)
+		}
+		args.stats.outputFiles = append(args.stats.outputFiles, args.teeRawPath)
+	}
+	// Samples are taken at i intervals from sampleStart, which moves to
+	// the last sample when -scan-budget changes the interval.
+	sampleStart, sampleIndex, interval := startTime, 0, args.interval
+	for i := 1; args.interval > 0 && (args.count == 0 || i < args.count); i++ {
+		// Rows of each sample are written out before waiting for the
+		// next one, so that the output grows while watching.
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		if growth != nil {
+			if err := growth.append(args.timestampFormat.formatTime(captureTime), args.growth); err != nil {
+				return fmt.Errorf("append to growth log: %w", err)
+			}
+			args.growth.samples = nil
+		}
+		if d := degradedInterval(args.interval, args.scanBudget, scanDuration); d != interval {
+			if d > args.interval {
+				log.Printf("warning: sample %d took %v, longer than -scan-budget %v, so the interval is %v", i, scanDuration.Round(time.Millisecond), args.scanBudget, d.Round(time.Millisecond))
+			} else {
+				log.Printf("sample %d took %v, within -scan-budget %v, so the interval is %v again", i, scanDuration.Round(time.Millisecond), args.scanBudget, d)
+			}
+			sampleStart, sampleIndex, interval = sampleTime(sampleStart, interval, sampleIndex), 0, d
+		}
+		sampleIndex++
+		time.Sleep(time.Until(sampleTime(sampleStart, interval, sampleIndex)))
+		sources, err := reopenInputs(args, inputFilenames)
+		if err != nil {
+			return err
+		}
+		captureTime = time.Now()
+		mw.timestamp = args.timestampFormat.formatTime(captureTime)
+		if err := notifier.notify(fmt.Sprintf("STATUS=%s, sample %d", status, i+1)); err != nil {
+			return fmt.Errorf("notify systemd: %w", err)
+		}
+		scanStart = time.Now()
+		err = convertSources(sources, captureTime)
+		scanDuration = time.Since(scanStart)
+		for _, src := range sources {
+			src.file.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := mw.flush(args.stats); err != nil {
+		return err
+	}
+	if args.totalsPath != "" {
+		if err := writeTotalsFile(args.totalsPath, args, mw); err != nil {
+			return fmt.Errorf("write totals: %w", err)
+		}
+		args.stats.outputFiles = append(args.stats.outputFiles, args.totalsPath)
+	}
+	if args.typesOutPath != "" && mw.types != nil {
+		if err := writeTypeManifest(args.typesOutPath, mw.types.manifest(), args.outputFileOptions); err != nil {
+			return fmt.Errorf("write type manifest: %w", err)
+		}
+		args.stats.outputFiles = append(args.stats.outputFiles, args.typesOutPath)
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	args.stats.outputFiles = append(args.stats.outputFiles, w.Files()...)
+	if args.writeMeta || args.versionMeta == versionMetadataSidecar {
+		md := newCaptureMetadata(captureTime, pids)
+		if args.reproducible {
+			md.Hostname = ""
+		}
+		if args.anonymizesPaths() {
+			md.anonymize(args.pseudonymizer)
+		}
+		if err := writeMetadataFile(metadataFilename(args.outputFilename), md, args.outputFileOptions); err != nil {
+			return err
+		}
+		args.stats.outputFiles = append(args.stats.outputFiles, metadataFilename(args.outputFilename))
+	}
+	if growth != nil {
+		if err := growth.append(args.timestampFormat.formatTime(captureTime), args.growth); err != nil {
+			return fmt.Errorf("append to growth log: %w", err)
+		}
+	}
+	if args.shmReport != nil {
+		data, err := args.shmReport.csv()
+		if err != nil {
+			return err
+		}
+		if err := writeOutputFile(args.shmReportPath, data, args.outputFileOptions); err != nil {
+			return fmt.Errorf("write shared memory report: %w", err)
+		}
+		args.stats.outputFiles = append(args.stats.outputFiles, args.shmReportPath)
+	}
+	if args.compSwapReport != nil {
+		backends, err := readCompressedSwapBackends()
+		if err != nil {
+			return fmt.Errorf("read compressed swap statistics: %w", err)
+		}
+		if len(backends) == 0 {
+			log.Printf("warning: neither zswap nor zram is in use, so the compressed swap report has no estimates")
+		}
+		data, err := args.compSwapReport.csv(backends)
+		if err != nil {
+			return err
+		}
+		if err := writeOutputFile(args.compSwapPath, data, args.outputFileOptions); err != nil {
+			return fmt.Errorf("write compressed swap report: %w", err)
+		}
+		args.stats.outputFiles = append(args.stats.outputFiles, args.compSwapPath)
+	}
+	if args.lazyFreeReport != nil {
+		data, err := args.lazyFreeReport.csv()
+		if err != nil {
+			return err
+		}
+		if err := writeOutputFile(args.lazyFreePath, data, args.outputFileOptions); err != nil {
+			return fmt.Errorf("write LazyFree report: %w", err)
+		}
+		args.stats.outputFiles = append(args.stats.outputFiles, args.lazyFreePath)
+	}
+	if args.numaReport != nil {
+		data, err := args.numaReport.csv()
+		if err != nil {
+			return err
+		}
+		if err := writeOutputFile(args.numaReportPath, data, args.outputFileOptions); err != nil {
+			return fmt.Errorf("write NUMA report: %w", err)
+		}
+		args.stats.outputFiles = append(args.stats.outputFiles, args.numaReportPath)
+	}
+	if args.checkpoint != nil {
+		if err := args.checkpoint.remove(); err != nil {
+			log.Printf("warning: remove checkpoint: %v", err)
+		}
+	}
+	if args.journal != nil {
+		duration := time.Since(startTime)
+		input := args.inputFilename
+		if args.batch {
+			input = fmt.Sprintf("%d inputs", len(sources))
+		}
+		msg := fmt.Sprintf("converted %s to %s: %d rows in %v", input, args.outputFilename, args.stats.rows, duration)
+		fields := map[string]string{
+			"DURATION_USEC": strconv.FormatInt(duration.Microseconds(), 10),
+			"ROWS":          strconv.Itoa(args.stats.rows),
+		}
+		if len(pids) == 1 {
+			fields["TARGET_PID"] = strconv.Itoa(pids[0])
+		}
+		if err := args.journal.send(msg, journalPriorityInfo, fields); err != nil {
+			return fmt.Errorf("log to journald: %w", err)
+		}
+	}
+	if args.regression != nil {
+		err = args.regression.check(os.Stderr)
+	}
+	if args.failIf != nil {
+		if failErr := args.failIf.check(os.Stderr); err == nil {
+			err = failErr
+		}
+	}
+	return err
+}
+
+// prepareInput prepares the values derived from flags which depend on the
+// process of the input.
+func (a *args) prepareInput() error {
+	if a.dumpDir != "" {
+		pid := a.dumpPid
+		if pid == 0 {
+			pid = pidFromSmapsPath(a.inputFilename)
+		}
+		d, err := newRegionDumper(pid, a.dumpDir, a.dumpFormat, a.dumpPath, a.dumpRange)
+		if err != nil {
+			return err
+		}
+		a.regionDumper = d
+	}
+	if a.hostPaths {
+		r, err := newHostPathResolver(pidFromSmapsPath(a.inputFilename))
+		if err != nil {
+			return err
+		}
+		a.hostPathResolver = r
+	}
+	if a.resolveInodes {
+		var search []string
+		if a.inodeSearch != "" {
+			search = strings.Split(a.inodeSearch, ",")
+		}
+		r, err := newInodeResolver(pidFromSmapsPath(a.inputFilename), search)
+		if err != nil {
+			return err
+		}
+		a.inodeResolver = r
+	}
+	if a.mountColumns {
+		pid := pidFromSmapsPath(a.inputFilename)
+		if pid == 0 {
+			return errors.New("pid of the target process is unknown; use /proc/<pid>/smaps as input")
+		}
+		mi, err := readMountInfo(pid)
+		if err != nil {
+			return err
+		}
+		a.mountInfo = mi
+	}
+	if a.swapDevices {
+		sa, err := newSwapAttributor(pidFromSmapsPath(a.inputFilename))
+		if err != nil {
+			return err
+		}
+		a.swapAttributor = sa
+	}
+	if a.pagemap {
+		pr, err := newPagemapReader(pidFromSmapsPath(a.inputFilename))
+		if err != nil {
+			return err
+		}
+		a.pagemapReader = pr
+	}
+	if a.pageContent > 0 {
+		s, err := newPageContentSampler(pidFromSmapsPath(a.inputFilename), a.pageContent, a.pageContentPath)
+		if err != nil {
+			return err
+		}
+		a.pageContentSampler = s
+	}
+	if a.threadStacks {
+		pid := pidFromSmapsPath(a.inputFilename)
+		if pid == 0 {
+			return errors.New("pid of the target process is unknown; use /proc/<pid>/smaps as input")
+		}
+		l, err := newThreadStackLabeler(pid)
+		if err != nil {
+			return err
+		}
+		if a.pseudonymizer != nil {
+			for i := range l.threads {
+				l.threads[i].tid = a.pseudonymizer.pid(l.threads[i].tid)
+				l.threads[i].name = a.pseudonymizer.hash(l.threads[i].name)
+			}
+		}
+		a.stackLabeler = l
+	}
+	if a.numa {
+		pid := pidFromSmapsPath(a.inputFilename)
+		if pid == 0 {
+			return errors.New("pid of the target process is unknown; use /proc/<pid>/smaps as input")
+		}
+		nm, err := readNumaMaps(pid)
+		if err != nil {
+			return err
+		}
+		a.numaMaps = nm
+		a.numaNodes = nm.nodes
+	}
+	if a.nsPid || a.cgroupPath || a.withProcInfo || a.batch && pidFromInputPath(a.inputFilename) != 0 {
+		pid := pidFromInputPath(a.inputFilename)
+		if pid == 0 {
+			return errors.New("pid of the target process is unknown; use /proc/<pid>/smaps as input")
+		}
+		a.process = &processInfo{Pid: pid}
+		if a.allProcesses || a.withProcInfo {
+			comm, err := readComm(pid)
+			if err != nil {
+				return err
+			}
+			a.process.Comm = comm
+		}
+		if a.withProcInfo {
+			cmdline, err := readCmdline(pid)
+			if err != nil {
+				return err
+			}
+			a.process.Cmdline = strings.Join(cmdline, " ")
+			uid, err := readUid(pid)
+			if err != nil {
+				return err
+			}
+			a.process.Uid = uid
+		}
+		if a.nsPid {
+			nsPid, err := readNsPid(pid)
+			if err != nil {
+				return err
+			}
+			a.process.NsPid = nsPid
+		}
+		if a.cgroupPath {
+			path, err := readCgroupPath(pid)
+			if err != nil {
+				return err
+			}
+			a.process.CgroupPath = path
+		}
+		if a.pseudonymizer != nil {
+			a.process = a.pseudonymizer.process(a.process)
+		}
+	}
+	return nil
+}
+
+// splitsOutput reports whether the output is split into numbered files.
+func (a *args) splitsOutput() bool {
+	return a.maxRows > 0 || a.maxSize > 0
+}
+
+// prepare parses and loads the values derived from flags.
+func (a *args) prepare() error {
+	if a.sample > 0 {
+		a.sampler = newRegionSampler(a.sample, a.sampleSeed)
+	}
+	if a.fieldsFilename != "" {
+		names, err := readFieldsFile(a.fieldsFilename)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("no field names in fields file %s", a.fieldsFilename)
+		}
+		a.fieldNames = names
+	}
+	for _, def := range a.derive {
+		c, err := parseDerivedColumn(def)
+		if err != nil {
+			return err
+		}
+		a.derivedColumns = append(a.derivedColumns, c)
+	}
+	if a.uss {
+		c, err := ussColumn(a.lazyFreePolicy)
+		if err != nil {
+			return err
+		}
+		a.derivedColumns = append(a.derivedColumns, c)
+	}
+	if a.templatePath != "" {
+		tmpl, err := parseTemplateFile(a.templatePath)
+		if err != nil {
+			return err
+		}
+		a.template = tmpl
+	}
+	if a.trueCost {
+		c, err := parseTrueCost(a.trueCostExpr)
+		if err != nil {
+			return err
+		}
+		a.derivedColumns = append(a.derivedColumns, c)
+		a.trueCostColumn = &c
+	}
+	if a.sortBy != nil {
+		for _, c := range a.derivedColumns {
+			if c.Name == a.sortBy.column {
+				a.sortBy.expr = c.Expr
+			}
+		}
+	}
+	uc, err := newUnitConverter(a.units)
+	if err != nil {
+		return err
+	}
+	a.unitConverter = uc
+	if a.columnList != "" {
+		columns, err := parseColumnList(a.columnList)
+		if err != nil {
+			return err
+		}
+		a.columns = columns
+	}
+	filter, err := newRegionFilter(a.filterPerms, a.filterPath, a.minRss)
+	if err != nil {
+		return err
+	}
+	a.filter = filter
+	tf, err := newTimestampFormat(a.timeFormat, a.timeZone)
+	if err != nil {
+		return err
+	}
+	a.timestampFormat = tf
+	nf, err := newNumberFormat(a.decimalSep, a.thousandsSep)
+	if err != nil {
+		return err
+	}
+	a.numberFormat = nf
+	if a.swapDevices {
+		devices, err := readSwapDevices()
+		if err != nil {
+			return err
+		}
+		a.swapDeviceNames = devices
+	}
+	if a.batch || a.nsPid || a.withProcInfo {
+		a.processColumns = append(a.processColumns, columnPid)
+	}
+	if a.allProcesses || a.withProcInfo {
+		a.processColumns = append(a.processColumns, columnComm)
+	}
+	if a.withProcInfo {
+		a.processColumns = append(a.processColumns, columnCmdline, columnUid)
+	}
+	if a.nsPid {
+		a.processColumns = append(a.processColumns, columnNsPid)
+	}
+	if a.cgroupPath {
+		a.processColumns = append(a.processColumns, columnCgroupPath)
+	}
+	if a.redactPaths {
+		r, err := newPathRedactor(a.redactDepth, a.redactPattern)
+		if err != nil {
+			return err
+		}
+		a.pathRedactor = r
+	}
+	if a.pseudonymize {
+		// The pseudonymizer is created before prepareInput, which
+		// pseudonymizes the process information with it.
+		p, err := newPseudonymizer(a.salt)
+		if err != nil {
+			return err
+		}
+		a.pseudonymizer = p
+	}
+	if !a.batch {
+		if err := a.prepareInput(); err != nil {
+			return err
+		}
+	}
+	if a.kernelCompat && a.fieldNames == nil {
+		a.compat = newKernelCompatNormalizer()
+	}
+	if a.unknownFields != "" {
+		a.fieldChecker = newFieldChecker(a.unknownFields, a.skipBadLines)
+	}
+	if a.rebaseAddrs {
+		a.addressRebaser = &addressRebaser{}
+	}
+	return nil
+}
+
+func convertSmapsToCsv(w recordWriter, r io.Reader, args args) error {
+	mw := newMappingWriter(w, args)
+	if err := convertMappings(r, args, mw.write); err != nil {
+		return err
+	}
+	return mw.flush(args.stats)
+}
+
+// newMappingWriter returns a mappingWriter with the output options of
+// args.
+func newMappingWriter(w recordWriter, args args) *mappingWriter {
+	mw := &mappingWriter{
+		w:               w,
+		derivedColumns:  args.derivedColumns,
+		failIf:          args.failIf,
+		alerts:          args.alerts,
+		unitConverter:   args.unitConverter,
+		numberFormat:    args.numberFormat,
+		floatFormat:     args.floatFormat,
+		nullValue:       args.nullValue(),
+		versionMetadata: args.versionMeta,
+		hostPaths:       args.hostPaths,
+		resolvedPaths:   args.resolveInodes,
+		mountColumns:    args.mountColumns,
+		stackThreads:    args.threadStacks,
+		numaNodes:       args.numaNodes,
+		swapDevices:     args.swapDeviceNames,
+		pagemap:         args.pagemap,
+		pageContent:     args.pageContent > 0,
+		mincore:         args.mincore,
+		categoryColumn:  args.categoryColumn,
+		anonNameColumn:  args.anonNameColumn,
+		backingColumns:  args.backingColumns,
+		regionSize:      args.regionSizeColumn,
+		regionKey:       args.regionKey,
+		noHeader:        args.noHeader,
+		sourceLine:      args.sourceColumns,
+		sourceFile:      args.sourceColumns && args.batch,
+		decAddresses:    args.addrFormat == addrFormatDec,
+		columns:         args.columns,
+		columnRules:     args.columnRules,
+		processColumns:  args.processColumns,
+		truncatedColumn: args.truncatedColumn,
+		sampleWeight:    sampleWeight(args.sampler),
+		longShape:       args.shape == shapeLong,
+		checkTypes:      args.typesPath != "" || args.typesOutPath != "",
+		typeManifest:    args.typeManifest,
+	}
+	if args.timestampColumn {
+		mw.timestampColumn = true
+		mw.timestamp = args.timestampFormat.formatTime(args.captureTime)
+	}
+	if args.groupBy != "" {
+		// Columns of each region are meaningless for groups.
+		mw.groups, _ = newMappingGroups(args.groupBy)
+		mw.hostPaths, mw.stackThreads, mw.categoryColumn, mw.anonNameColumn, mw.truncatedColumn = false, false, false, false, false
+		mw.resolvedPaths, mw.mountColumns, mw.backingColumns = false, false, false
+		mw.regionSize, mw.regionKey, mw.sourceLine, mw.sourceFile = false, false, false, false
+		mw.numaNodes, mw.swapDevices, mw.pagemap, mw.pageContent, mw.mincore = nil, nil, false, false, false
+	} else if args.unionFields {
+		mw.union = newFieldUnion()
+	}
+	if args.subtotals != "" && args.groupBy == "" {
+		mw.subtotals, _ = newMappingGroups(args.subtotals)
+	}
+	// Only the rows buffered until flush are spilled, as the total is a
+	// single group.
+	mw.pending.maxMemory = args.maxMemory
+	if mw.groups != nil {
+		mw.groups.maxMemory = args.maxMemory
+	}
+	if mw.subtotals != nil {
+		mw.subtotals.maxMemory = args.maxMemory
+	}
+	if args.groupBy != "" && args.sortOrder == sortByTrueCost {
+		mw.groupCost = args.trueCostColumn.Expr
+	}
+	if args.groupBy != "" {
+		mw.groupSort = args.sortBy
+	}
+	if args.totals || args.totalsPath != "" {
+		mw.totals = newTotalGroups()
+		mw.totalRow = args.totals
+	}
+	return mw
+}
+
+// convertMappings parses smaps formatted text from r, applies the
+// conversion options to each mapping and calls fn for each mapping in
+// the output order.
+func convertMappings(r io.Reader, args args, fn func(m *mapping) error) error {
+	var orderChecker *regionOrderChecker
+	if args.checkOrder {
+		orderChecker = &regionOrderChecker{}
+	}
+	inputPid := pidFromInputPath(args.inputFilename)
+	var deduper *regionDeduper
+	if args.dedupe {
+		deduper = &regionDeduper{}
+	}
+	var merger *adjacentMerger
+	if args.mergeAdjacent {
+		merger = &adjacentMerger{}
+	}
+	var keyer *regionKeyer
+	if args.regionKey {
+		keyer = newRegionKeyer(args.regionKeyParts)
+	}
+	// Groups are sorted by the mappingWriter by TrueCost or -sort-by
+	// instead of their regions.
+	sortsRegions := args.sortBy != nil && args.groupBy == "" || args.sortOrder != "" && !(args.sortOrder == sortByTrueCost && args.groupBy != "")
+	var mappings []*mapping
+	emit := func(m *mapping) error {
+		if sortsRegions {
+			mappings = append(mappings, m)
+			return nil
+		}
+		return fn(m)
+	}
+	process := func(m *mapping) error {
+		if args.fieldChecker != nil {
+			if err := args.fieldChecker.check(m, args.anomalies); err != nil {
+				return err
+			}
+		}
+		if deduper != nil {
+			if lineNo, ok := deduper.duplicate(m); ok {
+				args.anomalies.report(m.LineNo, fmt.Sprintf("dropped duplicate of the region at line %d", lineNo),
+					string(m.Region.AddressStart)+"-"+string(m.Region.AddressEnd))
+				return nil
+			}
+		}
+		if args.stats != nil {
+			args.stats.add(m)
+		}
+		if args.throttle > 0 {
+			time.Sleep(args.throttle)
+		}
+		if orderChecker != nil {
+			violation, err := orderChecker.check(m)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", m.LineNo, err)
+			}
+			if violation != "" {
+				if args.strict {
+					return fmt.Errorf("line %d: %s", m.LineNo, violation)
+				}
+				args.anomalies.report(m.LineNo, violation, string(m.Region.AddressStart)+"-"+string(m.Region.AddressEnd))
+			}
+		}
+		if args.sampler != nil {
+			pid := inputPid
+			if args.process != nil {
+				pid = args.process.Pid
+			}
+			if !args.sampler.keep(pid, m) {
+				return nil
+			}
+		}
+		if args.regionDumper != nil {
+			if err := args.regionDumper.dump(m); err != nil {
+				if errors.Is(err, syscall.EPERM) {
+					return err
+				}
+				args.anomalies.report(m.LineNo, fmt.Sprintf("skipped dumping region: %v", err),
+					string(m.Region.AddressStart)+"-"+string(m.Region.AddressEnd))
+			}
+		}
+		m.Process = args.process
+		if args.backingColumns || args.stripDeleted {
+			m.Region.Backing, m.Region.Deleted = regionBacking(string(m.Region.Pathname))
+			if args.stripDeleted {
+				m.Region.Pathname = bytes.TrimSuffix(m.Region.Pathname, []byte(deletedSuffix))
+			}
+		}
+		if args.hostPathResolver != nil {
+			m.Region.HostPath = []byte(args.hostPathResolver.resolve(string(m.Region.Pathname)))
+		}
+		if args.inodeResolver != nil {
+			m.Region.ResolvedPath = []byte(args.inodeResolver.resolve(m.Region))
+		}
+		if args.mountInfo != nil {
+			if e := args.mountInfo.lookup(string(m.Region.Pathname)); e != nil {
+				m.Region.MountPoint, m.Region.FsType = e.mountPoint, e.fsType
+			}
+		}
+		if args.stackLabeler != nil {
+			m.Region.StackThread = args.stackLabeler.label(m.Region)
+		}
+		if args.numaMaps != nil {
+			m.Region.NumaPages = args.numaMaps.regionPages(m.Region.AddressStart)
+		}
+		if args.swapAttributor != nil {
+			if swap, _ := m.numericFieldValue("Swap"); swap == 0 {
+				m.Region.SwapPages = map[int]int64{}
+			} else if pages, err := args.swapAttributor.regionPages(m.Region); err != nil {
+				args.anomalies.report(m.LineNo, fmt.Sprintf("skipped attributing swap to devices: %v", err),
+					string(m.Region.AddressStart)+"-"+string(m.Region.AddressEnd))
+			} else {
+				m.Region.SwapPages = pages
+			}
+		}
+		if args.pagemapReader != nil {
+			rss, _ := m.numericFieldValue("Rss")
+			swap, _ := m.numericFieldValue("Swap")
+			if rss == 0 && swap == 0 {
+				// Nothing is resident or swapped, which saves reading the
+				// entries of large reservations.
+				m.Region.PageCounts = &pageCounts{}
+			} else if counts, err := args.pagemapReader.regionCounts(m.Region); err != nil {
+				args.anomalies.report(m.LineNo, fmt.Sprintf("skipped counting pages in pagemap: %v", err),
+					string(m.Region.AddressStart)+"-"+string(m.Region.AddressEnd))
+			} else {
+				m.Region.PageCounts = counts
+			}
+		}
+		if args.mincore {
+			if pages, err := regionCachedPages(m.Region); err != nil {
+				args.anomalies.report(m.LineNo, fmt.Sprintf("skipped counting cached pages: %v", err),
+					string(m.Region.AddressStart)+"-"+string(m.Region.AddressEnd))
+			} else {
+				m.Region.CachedPages = pages
+			}
+		}
+		if args.pageContentSampler != nil && args.pageContentSampler.selects(m.Region) {
+			if content, err := args.pageContentSampler.sample(m.Region); err != nil {
+				if errors.Is(err, syscall.EPERM) {
+					return err
+				}
+				args.anomalies.report(m.LineNo, fmt.Sprintf("skipped sampling page contents: %v", err),
+					string(m.Region.AddressStart)+"-"+string(m.Region.AddressEnd))
+			} else {
+				m.Region.PageContent = content
+			}
+		}
+		if args.pathNormalizer != nil {
+			// The files are read by their real pathnames above.
+			m.Region.Pathname = []byte(args.pathNormalizer.normalize(string(m.Region.Pathname)))
+		}
+		pid := inputPid
+		if m.Process != nil {
+			pid = m.Process.Pid
+		}
+		if args.shmReport != nil {
+			if kind, name := classifyShm(string(m.Region.Pathname)); kind != "" {
+				args.shmReport.add(kind, args.anonymizePath(name), pid, m)
+			}
+		}
+		if args.growth != nil {
+			args.growth.add(pid, m)
+		}
+		if args.compSwapReport != nil {
+			args.compSwapReport.add(pid, m)
+		}
+		if args.lazyFreeReport != nil {
+			args.lazyFreeReport.add(pid, m)
+		}
+		if args.numaReport != nil {
+			args.numaReport.add(pid, args.anonymizePath(numaLibrary(m.Region)), m)
+		}
+		if keyer != nil {
+			// Keys are given before filtering, so that the order of
+			// the regions with the same components does not depend on
+			// the filter.
+			m.Region.Key = keyer.key(m.Region, args.anonymizePath(string(m.Region.Pathname)))
+		}
+		if args.filter != nil && !args.filter.match(m) {
+			return nil
+		}
+		if args.anonymizesPaths() {
+			m.Region.Pathname = []byte(args.anonymizePath(string(m.Region.Pathname)))
+			m.Region.HostPath = []byte(args.anonymizePath(string(m.Region.HostPath)))
+			m.Region.ResolvedPath = []byte(args.anonymizePath(string(m.Region.ResolvedPath)))
+			m.Region.MountPoint = args.anonymizePath(m.Region.MountPoint)
+		}
+		if args.regression != nil {
+			args.regression.add(m)
+		}
+		if args.addressRebaser != nil {
+			if err := args.addressRebaser.rebase(m.Region); err != nil {
+				return err
+			}
+		}
+		if args.fieldNames != nil {
+			m.selectFields(args.fieldNames)
+		} else if args.compat != nil {
+			args.compat.normalize(m, args.anomalies)
+		} else if args.canonicalOrder {
+			m.sortFieldsCanonically()
+		}
+		if args.expandVmFlags {
+			m.expandVmFlags()
+		}
+		if merger != nil {
+			if m = merger.add(m); m == nil {
+				return nil
+			}
+		}
+		return emit(m)
+	}
+
+	// The processing of each mapping is delayed until the next one is
+	// read, so the last mapping can be checked for truncation.
+	var truncation truncationChecker
+	var last *mapping
+	var skip func(*smaps.ParseError)
+	if args.skipBadLines {
+		skip = func(err *smaps.ParseError) {
+			args.anomalies.report(err.Line, fmt.Sprintf("skipped bad line %q: %s", err.Text, err.Reason()), err.Text)
+		}
+	}
+	if err := readMappingsSkipping(r, skip, func(m *mapping) error {
+		if last != nil && args.kind == smapsKindRollup {
+			return fmt.Errorf("line %d: %s has more than one region", m.LineNo, smapsKindRollup)
+		}
+		truncation.observe(m)
+		if last != nil {
+			last.Category = regionCategory(last.Region, m.Region)
+			if err := process(last); err != nil {
+				return err
+			}
+		}
+		last = m
+		return nil
+	}); err != nil {
+		return err
+	}
+	if last != nil {
+		if args.kind != smapsKindRollup {
+			last.Category = regionCategory(last.Region, nil)
+		}
+		if problem := truncation.check(last); problem != "" {
+			if args.strict {
+				return fmt.Errorf("line %d: %s", last.LineNo, problem)
+			}
+			args.anomalies.report(last.LineNo, problem, string(last.Region.AddressStart)+"-"+string(last.Region.AddressEnd))
+			truncation.complete(last)
+		}
+		if err := process(last); err != nil {
+			return err
+		}
+	}
+	if merger != nil {
+		if m := merger.flush(); m != nil {
+			if err := emit(m); err != nil {
+				return err
+			}
+		}
+	}
+
+	if sortsRegions {
+		if args.sortBy != nil {
+			if err := sortMappingsByKey(mappings, args.sortBy); err != nil {
+				return err
+			}
+		} else if args.sortOrder == sortByTrueCost {
+			sortMappingsByCost(mappings, args.trueCostColumn.Expr)
+		} else if err := sortMappings(mappings, args.sortOrder); err != nil {
+			return err
+		}
+		for _, m := range mappings {
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// anonymizesPaths reports whether anonymizePath changes any pathname.
+func (a *args) anonymizesPaths() bool {
+	return a.pathRedactor != nil || a.pseudonymizer != nil
+}
+
+// anonymizePath applies -redact-paths and -pseudonymize to a pathname.
+func (a *args) anonymizePath(pathname string) string {
+	if a.pathRedactor != nil {
+		pathname = a.pathRedactor.redact(pathname)
+	}
+	if a.pseudonymizer != nil {
+		pathname = a.pseudonymizer.pathname(pathname)
+	}
+	return pathname
+}
+
+// readMappings parses smaps formatted text from r and calls fn for each
+// mapping in input order.
+func readMappings(r io.Reader, fn func(m *mapping) error) error {
+	return readMappingsSkipping(r, nil, fn)
+}
+
+// readMappingsSkipping is readMappings which skips malformed lines,
+// calling skip for each of them, if skip is not nil.
+func readMappingsSkipping(r io.Reader, skip func(*smaps.ParseError), fn func(m *mapping) error) error {
+	p := smaps.NewParser(r)
+	if skip != nil {
+		p.SkipBadLines(skip)
+	}
+	for {
+		sm, err := p.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := fn(newMapping(sm)); err != nil {
+			return err
+		}
+	}
+}
+
+// newMapping returns the mapping of sm to convert.
+func newMapping(sm *smaps.Mapping) *mapping {
+	// The parts of the region are copied into one buffer, and the field
+	// slices share one array, which saves allocations for each part and
+	// slice. The slices are capped so that appending to one of them does
+	// not overwrite the next one.
+	r := &sm.Region
+	parts := [...]string{r.AddressStart, r.AddressEnd, r.Perms, r.Offset, r.Dev, r.Inode, r.Pathname}
+	size := 0
+	for _, s := range parts {
+		size += len(s)
+	}
+	buf := make([]byte, 0, size)
+	var values [len(parts)][]byte
+	for i, s := range parts {
+		start := len(buf)
+		buf = append(buf, s...)
+		values[i] = buf[start:len(buf):len(buf)]
+	}
+	n := len(sm.Fields)
+	fields := make([]string, 3*n)
+	m := &mapping{
+		Region: &region{
+			AddressStart: values[0],
+			AddressEnd:   values[1],
+			Perms:        values[2],
+			Offset:       values[3],
+			Dev:          values[4],
+			Inode:        values[5],
+			Pathname:     values[6],
+		},
+		FieldNames:  fields[:0:n],
+		FieldValues: fields[n : n : 2*n],
+		FieldUnits:  fields[2*n : 2*n : 3*n],
+		LineNo:      sm.LineNo,
+	}
+	for _, f := range sm.Fields {
+		m.appendField(f.Name, f.Value, f.Unit)
+	}
+	return m
+}
+
+func (m *mapping) appendField(name, value, unit string) {
+	m.FieldNames = append(m.FieldNames, name)
+	m.FieldValues = append(m.FieldValues, value)
+	m.FieldUnits = append(m.FieldUnits, unit)
+}
+
+func (m *mapping) toCSVHeader() []string {
+	return append(append(make([]string, 0, len(regionColumnNames)+len(m.FieldNames)), regionColumnNames[:]...), m.FieldNames...)
+}
+
+func (m *mapping) toCSVRecord() []string {
+	return m.appendCSVRecord(make([]string, 0, len(regionColumnNames)+len(m.FieldValues)))
+}
+
+// regionColumnNames are the columns of the region line.
+var regionColumnNames = [...]string{"AddressStart", "AddressEnd", "Perms", "Offset", "Dev", "Inode", "Pathname"}
+
+// appendCSVRecord appends the values of the region columns and the fields
+// to record. The region values are sliced from one string instead of
+// converting each of them.
+func (m *mapping) appendCSVRecord(record []string) []string {
+	r := m.Region
+	parts := [len(regionColumnNames)][]byte{r.AddressStart, r.AddressEnd, r.Perms, r.Offset, r.Dev, r.Inode, r.Pathname}
+	size := 0
+	for _, p := range parts {
+		size += len(p)
+	}
+	var b strings.Builder
+	b.Grow(size)
+	for _, p := range parts {
+		b.Write(p)
+	}
+	s := b.String()
+	for _, p := range parts {
+		record = append(record, s[:len(p)])
+		s = s[len(p):]
+	}
+	return append(record, m.FieldValues...)
+}
+
+// equalStrings reports whether a and b have the same strings, without
+// the allocations of reflect.DeepEqual for each region.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *mapping) checkFieldNames(firstLineFieldNames []string, regionLineNo int) error {
+	if !equalStrings(m.FieldNames, firstLineFieldNames) {
+		return fmt.Errorf("field names mismatch betweeen the first region and the region at line %d\n"+
+			"fields in first region:%v\n"+
+			"feilds in region at line %d:%v\n"+
+			"use -union-fields to write regions with different fields",
+			regionLineNo, firstLineFieldNames,
+			regionLineNo, m.FieldNames)
+	}
+	return nil
 }
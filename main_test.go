@@ -1,17 +1,136 @@
 package main
 
 import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/hnakamur/linuxprocsmapstocsv/smaps"
 )
 
-func TestParseRegion(t *testing.T) {
-	r, err := parseRegion([]byte("4d400283000-4d400284000 ---p 00000000 00:00 0                            [anon:partition_alloc]"))
-	if err != nil {
+func TestReadMappings(t *testing.T) {
+	input := "4d400283000-4d400284000 ---p 00000000 00:00 0                            [anon:partition_alloc]\n" +
+		"Size:                  4 kB\n"
+	var got []string
+	if err := readMappings(strings.NewReader(input), func(m *mapping) error {
+		got = append(got, strings.Join(m.toCSVRecord(), ","))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := "4d400283000,4d400284000,---p,00000000,00:00,0,[anon:partition_alloc],4"
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("result mismatch,\n got=%q,\nwant=%q", got, want)
+	}
+}
+
+func TestConvertRegionSizeAndAddrFormat(t *testing.T) {
+	input := "0055d000-0055f000 r--p 00001000 fe:00 1234                       /usr/bin/cat\nRss: 4 kB\n"
+	testCases := []struct {
+		addrFormat string
+		want       string
+	}{
+		{
+			addrFormat: addrFormatHex,
+			want: "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,RegionSize,Rss\n" +
+				"0055d000,0055f000,r--p,00001000,fe:00,1234,/usr/bin/cat,2000,4\n",
+		},
+		{
+			addrFormat: addrFormatDec,
+			want: "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,RegionSize,Rss\n" +
+				"5623808,5632000,r--p,4096,fe:00,1234,/usr/bin/cat,8192,4\n",
+		},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+			args{Separator: ",", regionSizeColumn: true, addrFormat: tc.addrFormat}); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("addrFormat=%s: result mismatch,\n got=%s,\nwant=%s", tc.addrFormat, got, tc.want)
+		}
+	}
+}
+
+func TestConvertSkipBadLines(t *testing.T) {
+	input := "55d000-55e000 r--p 00000000 fe:00 1234 /a\nRss: 4 kB\nno colon\n" +
+		"7ffd0000-7ffd1000 rw-p 00000000 00:00 0 [stack]\nRss: 12 kB\n"
+	var buf bytes.Buffer
+	a := args{Separator: ",", floatFormat: defaultFloatFormat}
+	err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input), a)
+	if err == nil || !strings.Contains(err.Error(), `"no colon"`) {
+		t.Errorf("want an error with the bad line, got=%v", err)
+	}
+
+	buf.Reset()
+	a.skipBadLines = true
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input), a); err != nil {
 		t.Fatal(err)
 	}
-	m := mapping{Region: r}
-	if got, want := strings.Join(m.toCSVRecord(), ","), "4d400283000,4d400284000,---p,00000000,00:00,0,[anon:partition_alloc]"; got != want {
+	want := "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Rss\n" +
+		"55d000,55e000,r--p,00000000,fe:00,1234,/a,4\n" +
+		"7ffd0000,7ffd1000,rw-p,00000000,00:00,0,[stack],12\n"
+	if got := buf.String(); got != want {
 		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
 	}
 }
+
+// benchmarkSmaps returns smaps formatted text of n regions with the fields
+// of a recent kernel.
+func benchmarkSmaps(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "%x-%x r-xp %08x fe:00 %d                       /usr/lib/x86_64-linux-gnu/lib%d.so.6\n", 0x7f0000000000+i*0x2000, 0x7f0000002000+i*0x2000, i*0x1000, 1000+i, i%16)
+		for _, f := range knownFields {
+			switch f.kind {
+			case fieldKindFlags:
+				fmt.Fprintf(&b, "%s: rd ex mr mw me sd\n", f.name)
+			case fieldKindInt:
+				fmt.Fprintf(&b, "%s: %d\n", f.name, i%2)
+			default:
+				fmt.Fprintf(&b, "%s: %d kB\n", f.name, (i*4)%64)
+			}
+		}
+	}
+	return b.String()
+}
+
+func BenchmarkConvertSmapsToCsv(b *testing.B) {
+	input := benchmarkSmaps(500)
+	a := args{Separator: ",", floatFormat: defaultFloatFormat}
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := convertSmapsToCsv(csv.NewWriter(io.Discard), strings.NewReader(input), a); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestNewMappingSlices(t *testing.T) {
+	sm := &smaps.Mapping{
+		Region: smaps.Region{AddressStart: "1000", AddressEnd: "2000", Perms: "r--p", Offset: "0", Dev: "00:00", Inode: "0", Pathname: "/a"},
+		Fields: []smaps.Field{{Name: "Rss", Value: "4", Unit: unitsKB}, {Name: "Pss", Value: "2", Unit: unitsKB}},
+	}
+	m := newMapping(sm)
+	// Appending to a slice must not overwrite the next one sharing its
+	// array.
+	m.Region.AddressStart = append(m.Region.AddressStart, '0')
+	m.appendField("Swap", "0", unitsKB)
+	want := []string{"10000", "2000", "r--p", "0", "00:00", "0", "/a", "4", "2", "0"}
+	if got := m.toCSVRecord(); !reflect.DeepEqual(got, want) {
+		t.Errorf("record mismatch,\n got=%q,\nwant=%q", got, want)
+	}
+	if want := []string{"Rss", "Pss", "Swap"}; !reflect.DeepEqual(m.FieldNames, want) {
+		t.Errorf("names mismatch, got=%q, want=%q", m.FieldNames, want)
+	}
+	if want := []string{unitsKB, unitsKB, unitsKB}; !reflect.DeepEqual(m.FieldUnits, want) {
+		t.Errorf("units mismatch, got=%q, want=%q", m.FieldUnits, want)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// columnHost is the column of the host of each row in the output of the
+// merge subcommand.
+const columnHost = "Host"
+
+// runMerge runs the merge subcommand, which combines the CSV outputs of
+// several hosts into one CSV with a Host column and the union of their
+// columns.
+func runMerge(arguments []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s merge [-o <file>] [-strict] [<host>=]<csv file>...\n\n"+
+			"The host of a file is given as <host>=<csv file>, or read from its Host column or\n"+
+			"the hostname of its <csv file>.meta.json written with -meta.\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	outputFilename := fs.String("o", stdioName, "output CSV filename, or \"-\" for the standard output")
+	strict := fs.Bool("strict", false, "fail on conflicts, i.e. missing columns and duplicate rows, instead of printing warnings")
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("at least one CSV file must be given")
+	}
+
+	m := &csvMerge{}
+	for _, arg := range fs.Args() {
+		host, filename, ok := strings.Cut(arg, "=")
+		if !ok {
+			host, filename = "", arg
+		}
+		if err := m.read(host, filename); err != nil {
+			return err
+		}
+	}
+	data, conflicts, err := m.csv()
+	if err != nil {
+		return err
+	}
+	for _, c := range conflicts {
+		log.Printf("warning: %s", c)
+	}
+	if *strict && len(conflicts) > 0 {
+		return fmt.Errorf("%d conflicts found", len(conflicts))
+	}
+	return writeOutputFile(*outputFilename, data, outputFileOptions{})
+}
+
+// mergeInput is a CSV file of the merge subcommand.
+type mergeInput struct {
+	filename string
+	host     string
+	header   []string
+	rows     [][]string
+}
+
+// csvMerge combines the CSV files of hosts.
+type csvMerge struct {
+	inputs []*mergeInput
+	// comma is the separator of the output, or zero for a comma.
+	comma rune
+}
+
+// read reads the CSV file filename of host, which is read from the file
+// or its metadata if it is empty.
+func (m *csvMerge) read(host, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	in, err := readMergeInput(file, filename)
+	if err != nil {
+		return err
+	}
+	in.host = host
+	if in.host == "" && indexOf(in.header, columnHost) == -1 {
+		in.host, err = readMetadataHostname(filename)
+		if err != nil {
+			return err
+		}
+	}
+	m.inputs = append(m.inputs, in)
+	return nil
+}
+
+// readMergeInput reads the CSV of r whose name is used in messages.
+func readMergeInput(r io.Reader, name string) (*mergeInput, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s is empty", name)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	in := &mergeInput{filename: name, header: header}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if len(record) != len(header) {
+			return nil, fmt.Errorf("%s: line %d has %d columns while the header has %d", name, len(in.rows)+2, len(record), len(header))
+		}
+		in.rows = append(in.rows, record)
+	}
+	return in, nil
+}
+
+// readMetadataHostname returns the hostname in the metadata file of the
+// output filename.
+func readMetadataHostname(filename string) (string, error) {
+	data, err := os.ReadFile(metadataFilename(filename))
+	if err != nil {
+		return "", fmt.Errorf("host of %s is unknown; give it as <host>=%s or write the file with -meta", filename, filename)
+	}
+	var md captureMetadata
+	if err := json.Unmarshal(data, &md); err != nil {
+		return "", fmt.Errorf("parse %s: %w", metadataFilename(filename), err)
+	}
+	if md.Hostname == "" {
+		return "", fmt.Errorf("%s has no hostname; give it as <host>=%s", metadataFilename(filename), filename)
+	}
+	return md.Hostname, nil
+}
+
+// mergeShapeColumns are the columns which tell the shape of a CSV file,
+// which must be the same in all files: regions, groups of -group-by or
+// the long shape of -shape long.
+var mergeShapeColumns = []string{"AddressStart", "Group", "FieldName"}
+
+// checkSchemas returns an error if the files have different shapes or
+// fields in different units, e.g. Rss in one and Rss_MiB in another.
+func (m *csvMerge) checkSchemas() error {
+	first := m.inputs[0]
+	units := make(map[string]string)
+	unitFiles := make(map[string]string)
+	for _, in := range m.inputs {
+		for _, name := range mergeShapeColumns {
+			if (indexOf(first.header, name) == -1) != (indexOf(in.header, name) == -1) {
+				return fmt.Errorf("%s and %s have different shapes: only one of them has the %s column", first.filename, in.filename, name)
+			}
+		}
+		for _, column := range in.header {
+			field, unit := splitUnitsSuffix(column)
+			if u, ok := units[field]; ok && u != unit {
+				return fmt.Errorf("%s has %s in %s while %s has it in %s", in.filename, field, unitName(unit), unitFiles[field], unitName(u))
+			}
+			units[field], unitFiles[field] = unit, in.filename
+		}
+	}
+	return nil
+}
+
+// splitUnitsSuffix splits a column written with -units into the field
+// and the units, e.g. "Rss" and "MiB" for "Rss_MiB". The units are empty
+// for columns without the suffix.
+func splitUnitsSuffix(column string) (field, units string) {
+	for _, u := range []string{unitsKB, unitsPages, unitsBytes, unitsMiB} {
+		if strings.HasSuffix(column, "_"+u) {
+			return strings.TrimSuffix(column, "_"+u), u
+		}
+	}
+	return column, ""
+}
+
+func unitName(units string) string {
+	if units == "" {
+		return "the default units"
+	}
+	return units
+}
+
+// csv returns the merged CSV with the Host column followed by the union
+// of the columns of the files in the order of appearance, and the
+// conflicts: the columns missing in some files, which are written empty,
+// and the rows of a host duplicated with different values, of which the
+// first one is written. Total and subtotal rows are dropped, as they are
+// of each host.
+func (m *csvMerge) csv() ([]byte, []string, error) {
+	if err := m.checkSchemas(); err != nil {
+		return nil, nil, err
+	}
+	header := []string{columnHost}
+	for _, in := range m.inputs {
+		for _, name := range in.header {
+			if indexOf(header, name) == -1 {
+				header = append(header, name)
+			}
+		}
+	}
+	var conflicts []string
+	for _, in := range m.inputs {
+		var missing []string
+		for _, name := range header[1:] {
+			if indexOf(in.header, name) == -1 {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			conflicts = append(conflicts, fmt.Sprintf("%s has no %s columns, which are written empty", in.filename, strings.Join(missing, ",")))
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if m.comma != 0 {
+		w.Comma = m.comma
+	}
+	if err := w.Write(header); err != nil {
+		return nil, nil, err
+	}
+	// Rows are identified by their addresses or groups, without which
+	// duplicates are not detected, e.g. if -columns omits them.
+	seen := make(map[string][]string)
+	identified := indexOf(header, "AddressStart") != -1 || indexOf(header, "Group") != -1
+	for _, in := range m.inputs {
+		for i, row := range in.rows {
+			record := make([]string, len(header))
+			for j, name := range in.header {
+				record[indexOf(header, name)] = row[j]
+			}
+			if in.host != "" {
+				record[0] = in.host
+			}
+			if isTotalRow(rowMap(header, record)) {
+				continue
+			}
+			key := mergeRowKey(header, record)
+			if prev, ok := seen[key]; ok && identified {
+				if strings.Join(prev, "\x00") != strings.Join(record, "\x00") {
+					conflicts = append(conflicts, fmt.Sprintf("%s: line %d duplicates a row of host %s with different values", in.filename, i+2, record[0]))
+				}
+				continue
+			}
+			seen[key] = record
+			if err := w.Write(record); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), conflicts, nil
+}
+
+func rowMap(header, record []string) map[string]string {
+	m := make(map[string]string, len(header))
+	for i, name := range header {
+		m[name] = record[i]
+	}
+	return m
+}
+
+// mergeRowKeyColumns identify a row of a host.
+var mergeRowKeyColumns = []string{columnHost, "Timestamp", columnPid, "AddressStart", "Group", "FieldName"}
+
+func mergeRowKey(header, record []string) string {
+	var key []string
+	for _, name := range mergeRowKeyColumns {
+		if i := indexOf(header, name); i != -1 {
+			key = append(key, record[i])
+		}
+	}
+	return strings.Join(key, "\x00")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVMerge(t *testing.T) {
+	dir := t.TempDir()
+	web1 := filepath.Join(dir, "web1.csv")
+	web2 := filepath.Join(dir, "web2.csv")
+	files := map[string]string{
+		web1: "Pid,AddressStart,Pathname,Rss\n" +
+			"10,55d000,/usr/bin/cat,4\n" +
+			"10,55d000,/usr/bin/cat,4\n" +
+			",,[total],4\n",
+		web2: "Pid,AddressStart,Pathname,Rss,Pss\n" +
+			"10,55d000,/usr/bin/cat,8,2\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(metadataFilename(web2), []byte(`{"hostname":"web2.example.com"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &csvMerge{}
+	if err := m.read("web1", web1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.read("", web2); err != nil {
+		t.Fatal(err)
+	}
+	data, conflicts, err := m.csv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Host,Pid,AddressStart,Pathname,Rss,Pss\n" +
+		"web1,10,55d000,/usr/bin/cat,4,\n" +
+		"web2.example.com,10,55d000,/usr/bin/cat,8,2\n"
+	if string(data) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", data, want)
+	}
+	wantConflicts := []string{web1 + " has no Pss columns, which are written empty"}
+	if !reflect.DeepEqual(conflicts, wantConflicts) {
+		t.Errorf("conflicts mismatch,\n got=%q,\nwant=%q", conflicts, wantConflicts)
+	}
+}
+
+func TestCSVMergeConflicts(t *testing.T) {
+	testCases := []struct {
+		name    string
+		files   []string
+		wantErr string
+	}{
+		{
+			name:    "units",
+			files:   []string{"Pathname,Rss\n/usr/bin/cat,4\n", "Pathname,Rss_MiB\n/usr/bin/cat,1\n"},
+			wantErr: "has Rss in MiB while",
+		},
+		{
+			name:    "shape",
+			files:   []string{"AddressStart,Pathname,Rss\n55d000,/usr/bin/cat,4\n", "Group,Regions,Rss\n/usr/bin/cat,1,4\n"},
+			wantErr: "have different shapes",
+		},
+		{
+			name:    "duplicate",
+			files:   []string{"Pid,AddressStart,Rss\n10,55d000,4\n10,55d000,8\n"},
+			wantErr: "line 3 duplicates a row of host h0 with different values",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &csvMerge{}
+			for i, content := range tc.files {
+				filename := filepath.Join(t.TempDir(), "in.csv")
+				if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := m.read("h"+string(rune('0'+i)), filename); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Schemas are errors while duplicates are conflicts.
+			_, conflicts, err := m.csv()
+			got := strings.Join(conflicts, "; ")
+			if err != nil {
+				got = err.Error()
+			}
+			if !strings.Contains(got, tc.wantErr) {
+				t.Errorf("error mismatch, got=%s, want=%s", got, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCSVMergeUnknownHost(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "in.csv")
+	if err := os.WriteFile(filename, []byte("Pathname,Rss\n/usr/bin/cat,4\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := &csvMerge{}
+	if err := m.read("", filename); err == nil || !strings.Contains(err.Error(), "host of "+filename+" is unknown") {
+		t.Errorf("error mismatch, got=%v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// cachedFilePages returns the number of the pages of the file of name
+// from offset for length bytes which are in the page cache, by mapping
+// them read-only into this process and asking mincore(2). The range is
+// cut at the end of the file, and nothing of the file is read.
+func cachedFilePages(name string, offset, length int64) (int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if rest := fi.Size() - offset; length > rest {
+		length = rest
+	}
+	if length <= 0 {
+		return 0, nil
+	}
+	data, err := unix.Mmap(int(file.Fd()), offset, int(length), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return 0, err
+	}
+	defer unix.Munmap(data)
+	pageSize := int64(os.Getpagesize())
+	vec := make([]byte, (length+pageSize-1)/pageSize)
+	// x/sys/unix has no wrapper of mincore on Linux.
+	if _, _, errno := unix.Syscall(unix.SYS_MINCORE, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(unsafe.Pointer(&vec[0]))); errno != 0 {
+		return 0, errno
+	}
+	var n int64
+	for _, v := range vec {
+		n += int64(v & 1)
+	}
+	return n, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func cachedFilePages(name string, offset, length int64) (int64, error) {
+	return 0, errors.New("mincore is supported only on Linux")
+}
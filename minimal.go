@@ -0,0 +1,84 @@
+//go:build minimal
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// This file replaces the optional features left out of a minimal build
+// with -tags minimal, which is a static binary of the CSV converter
+// without the dependencies of gRPC and the binary output formats for initramfs and rescue environments:
+//
+//	CGO_ENABLED=0 go build -tags minimal
+
+// errNotInMinimalBuild returns the error of using feature in a minimal
+// build.
+func errNotInMinimalBuild(feature string) error {
+	return fmt.Errorf("%s is not supported by this build, which is built with -tags minimal", feature)
+}
+
+// selftestDecoders are empty in a minimal build, whose selftest skips
+// the binary formats.
+var selftestDecoders = map[string]func(data []byte, column string) ([]string, error){}
+
+// parquetOptions are the options of -format parquet, which are not used
+// in a minimal build.
+type parquetOptions struct{}
+
+// validateParquet rejects the output formats left out of a minimal
+// build, and the options of -format parquet.
+func (a *args) validateParquet() error {
+	switch a.format {
+	case outputFormatSQLite, outputFormatParquet, outputFormatArrow, outputFormatXLSX:
+		return errNotInMinimalBuild("-format " + a.format)
+	}
+	if a.parquetDictionary != "" || a.parquetCompress != "" && a.parquetCompress != "none" || a.parquetColumnCompress != "" {
+		return errors.New("-parquet-dictionary, -parquet-compression and -parquet-column-compression require -format parquet")
+	}
+	return nil
+}
+
+func (o parquetOptions) build(columns []string, rows [][]string) ([]byte, error) {
+	return buildParquetFile(columns, rows)
+}
+
+func buildParquetFile(columns []string, rows [][]string) ([]byte, error) {
+	return nil, errNotInMinimalBuild("-format parquet")
+}
+
+const sqliteTable = "mappings"
+
+func buildSQLiteDatabase(table string, columns []string, rows [][]string) ([]byte, error) {
+	return nil, errNotInMinimalBuild("-format sqlite")
+}
+
+func buildXLSXWorkbook(columns []string, rows [][]string) ([]byte, error) {
+	return nil, errNotInMinimalBuild("-format xlsx")
+}
+
+// arrowOptions are the options of -format arrow, which are not used in a
+// minimal build.
+type arrowOptions struct{}
+
+// validateArrow rejects the options of -format arrow, which is left out
+// of a minimal build.
+func (a *args) validateArrow() error {
+	if a.arrowColumnCompress != "" || a.arrowCompress != "" && a.arrowCompress != "none" {
+		return errors.New("-arrow-compression and -arrow-column-compression require -format arrow")
+	}
+	return nil
+}
+
+func newArrowWriter(file *outputFile, headerLines int, opts arrowOptions) outputWriter {
+	return newTableFileWriter(file, headerLines, func(columns []string, rows [][]string) ([]byte, error) {
+		return nil, errNotInMinimalBuild("-format arrow")
+	})
+}
+
+func serveGRPC(ln net.Listener, args args, maxRequestSize int64, sec *serveSecurity) error {
+	ln.Close()
+	return errNotInMinimalBuild("-grpc-listen")
+}
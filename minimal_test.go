@@ -0,0 +1,21 @@
+//go:build minimal
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateParquetMinimal(t *testing.T) {
+	for _, format := range []string{outputFormatSQLite, outputFormatParquet, outputFormatArrow, outputFormatXLSX} {
+		a := args{format: format}
+		if err := a.validateParquet(); err == nil || !strings.Contains(err.Error(), "-tags minimal") {
+			t.Errorf("unexpected result of -format %s, err=%v", format, err)
+		}
+	}
+	a := args{format: outputFormatCSV, parquetCompress: "none"}
+	if err := a.validateParquet(); err != nil {
+		t.Errorf("unexpected error of -format csv, err=%v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mountEntry is a mount in /proc/<pid>/mountinfo.
+type mountEntry struct {
+	dev        deviceNumber
+	mountPoint string
+	fsType     string
+}
+
+// mountInfo is the mounts of a process in the order of mountinfo, where
+// later mounts are on top of earlier ones.
+type mountInfo struct {
+	entries []mountEntry
+}
+
+// readMountInfo reads /proc/<pid>/mountinfo.
+func readMountInfo(pid int) (*mountInfo, error) {
+	file, err := os.Open(procPath(pid, "mountinfo"))
+	if err != nil {
+		return nil, diagnoseOpenError(procPath(pid, "mountinfo"), err)
+	}
+	defer file.Close()
+	return parseMountInfo(file)
+}
+
+// parseMountInfo parses mountinfo lines like
+//
+//	36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw
+//
+// where the third field is the device, the fifth is the mount point and
+// the first one after the "-" separator is the filesystem type.
+func parseMountInfo(r io.Reader) (*mountInfo, error) {
+	mi := &mountInfo{}
+	s := bufio.NewScanner(r)
+	lineNo := 0
+	for s.Scan() {
+		lineNo++
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("mountinfo: line %d: too few fields", lineNo)
+		}
+		dev, err := parseDeviceNumber(fields[2], 10)
+		if err != nil {
+			return nil, fmt.Errorf("mountinfo: line %d: %w", lineNo, err)
+		}
+		e := mountEntry{dev: dev, mountPoint: unescapeMountPath(fields[4])}
+		for i := 5; i+1 < len(fields); i++ {
+			if fields[i] == "-" {
+				e.fsType = fields[i+1]
+				break
+			}
+		}
+		mi.entries = append(mi.entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return mi, nil
+}
+
+// unescapeMountPath replaces the octal escapes like \040 for a space in
+// a path in mountinfo.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// mountPoints returns the mount points of dev.
+func (mi *mountInfo) mountPoints(dev deviceNumber) []string {
+	var mountPoints []string
+	for _, e := range mi.entries {
+		if e.dev == dev {
+			mountPoints = append(mountPoints, e.mountPoint)
+		}
+	}
+	return mountPoints
+}
+
+// lookup returns the mount containing the file pathname, i.e. the one
+// with the longest mount point which is a prefix of pathname, or nil if
+// pathname is not a file pathname. Of mounts on the same mount point, the
+// last one is on top.
+func (mi *mountInfo) lookup(pathname string) *mountEntry {
+	if !strings.HasPrefix(pathname, "/") {
+		return nil
+	}
+	pathname = strings.TrimSuffix(pathname, deletedSuffix)
+	var found *mountEntry
+	for i := range mi.entries {
+		e := &mi.entries[i]
+		if !pathUnder(pathname, e.mountPoint) {
+			continue
+		}
+		if found == nil || len(e.mountPoint) >= len(found.mountPoint) {
+			found = e
+		}
+	}
+	return found
+}
+
+// pathUnder reports whether pathname is dir or under dir.
+func pathUnder(pathname, dir string) bool {
+	if dir == "/" {
+		return true
+	}
+	return pathname == dir || strings.HasPrefix(pathname, dir+"/")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testMountInfo = "22 1 253:1 / / rw,relatime shared:1 - ext4 /dev/mapper/root rw\n" +
+	"25 22 0:22 / /dev/shm rw,nosuid,nodev shared:4 - tmpfs tmpfs rw\n" +
+	"26 22 0:22 /x /mnt/with\\040space rw - tmpfs tmpfs rw\n" +
+	"27 22 0:45 / /srv/data rw,relatime shared:5 master:1 - nfs4 server:/export rw\n" +
+	"28 22 0:46 / /srv/data rw,relatime - tmpfs tmpfs rw\n"
+
+func TestParseMountInfo(t *testing.T) {
+	got, err := parseMountInfo(strings.NewReader(testMountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mountEntry{
+		{dev: deviceNumber{major: 253, minor: 1}, mountPoint: "/", fsType: "ext4"},
+		{dev: deviceNumber{major: 0, minor: 22}, mountPoint: "/dev/shm", fsType: "tmpfs"},
+		{dev: deviceNumber{major: 0, minor: 22}, mountPoint: "/mnt/with space", fsType: "tmpfs"},
+		{dev: deviceNumber{major: 0, minor: 45}, mountPoint: "/srv/data", fsType: "nfs4"},
+		{dev: deviceNumber{major: 0, minor: 46}, mountPoint: "/srv/data", fsType: "tmpfs"},
+	}
+	if !reflect.DeepEqual(got.entries, want) {
+		t.Errorf("result mismatch, got=%v, want=%v", got.entries, want)
+	}
+	if got, want := got.mountPoints(deviceNumber{major: 0, minor: 22}), []string{"/dev/shm", "/mnt/with space"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mount points mismatch, got=%v, want=%v", got, want)
+	}
+
+	if _, err := parseMountInfo(strings.NewReader("22 1 253:1\n")); err == nil {
+		t.Error("want an error for a line with too few fields")
+	}
+}
+
+func TestMountInfoLookup(t *testing.T) {
+	mi, err := parseMountInfo(strings.NewReader(testMountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		pathname   string
+		mountPoint string
+		fsType     string
+	}{
+		{pathname: "/usr/lib/libc.so.6", mountPoint: "/", fsType: "ext4"},
+		{pathname: "/dev/shm/segment (deleted)", mountPoint: "/dev/shm", fsType: "tmpfs"},
+		{pathname: "/dev/shmx", mountPoint: "/", fsType: "ext4"},
+		{pathname: "/srv/data/cache", mountPoint: "/srv/data", fsType: "tmpfs"},
+		{pathname: "[heap]"},
+		{pathname: ""},
+	}
+	for _, tc := range testCases {
+		e := mi.lookup(tc.pathname)
+		var mountPoint, fsType string
+		if e != nil {
+			mountPoint, fsType = e.mountPoint, e.fsType
+		}
+		if mountPoint != tc.mountPoint || fsType != tc.fsType {
+			t.Errorf("pathname=%s: result mismatch, got=%s %s, want=%s %s", tc.pathname, mountPoint, fsType, tc.mountPoint, tc.fsType)
+		}
+	}
+}
+
+func TestConvertMountColumns(t *testing.T) {
+	mi, err := parseMountInfo(strings.NewReader(testMountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "7f0000000000-7f0000001000 rw-s 00000000 00:16 42                         /dev/shm/segment\nRss: 4 kB\n" +
+		"7f0000001000-7f0000002000 rw-p 00000000 00:00 0 \nRss: 8 kB\n"
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", mountColumns: true, mountInfo: mi}); err != nil {
+		t.Fatal(err)
+	}
+	want := "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,MountPoint,FsType,Rss\n" +
+		"7f0000000000,7f0000001000,rw-s,00000000,00:16,42,/dev/shm/segment,/dev/shm,tmpfs,4\n" +
+		"7f0000001000,7f0000002000,rw-p,00000000,00:00,0,,,,8\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
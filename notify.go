@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// systemdNotifier sends service state notifications to systemd (see
+// sd_notify(3)) so that this tool can run as a Type=notify service, and
+// pings the service watchdog while running.
+type systemdNotifier struct {
+	conn             *net.UnixConn
+	watchdogInterval time.Duration
+	stop             chan struct{}
+}
+
+// newSystemdNotifier connects to the socket in NOTIFY_SOCKET. It returns
+// nil if this process is not run by systemd with notification enabled.
+// It must be called before entering the sandbox, which denies creating
+// sockets.
+func newSystemdNotifier() (*systemdNotifier, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil, nil
+	}
+	if path[0] == '@' {
+		// abstract namespace socket
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	n := &systemdNotifier{conn: conn}
+	if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+		pid, err := strconv.Atoi(os.Getenv("WATCHDOG_PID"))
+		if err != nil || pid == os.Getpid() {
+			n.watchdogInterval = time.Duration(usec) * time.Microsecond
+		}
+	}
+	return n, nil
+}
+
+// notify sends state, e.g. "READY=1". It does nothing if n is nil.
+func (n *systemdNotifier) notify(state string) error {
+	if n == nil {
+		return nil
+	}
+	_, err := n.conn.Write([]byte(state))
+	return err
+}
+
+// startWatchdog pings the watchdog at half the interval configured by
+// WatchdogSec= until Close is called. It does nothing if the watchdog is
+// not enabled.
+func (n *systemdNotifier) startWatchdog() {
+	if n == nil || n.watchdogInterval == 0 || n.stop != nil {
+		return
+	}
+	n.stop = make(chan struct{})
+	ticker := time.NewTicker(n.watchdogInterval / 2)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				n.notify("WATCHDOG=1")
+			case <-n.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close sends STOPPING=1, stops the watchdog pings and closes the
+// connection.
+func (n *systemdNotifier) Close() error {
+	if n == nil {
+		return nil
+	}
+	if n.stop != nil {
+		close(n.stop)
+	}
+	n.notify("STOPPING=1")
+	return n.conn.Close()
+}
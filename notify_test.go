@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSystemdNotifier(t *testing.T) {
+	dir, err := os.MkdirTemp("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	n, err := newSystemdNotifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.notify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	n.startWatchdog()
+
+	buf := make([]byte, 256)
+	receive := func() string {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		nr, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:nr])
+	}
+	if got, want := receive(), "READY=1"; got != want {
+		t.Errorf("first state mismatch, got=%q, want=%q", got, want)
+	}
+	if got, want := receive(), "WATCHDOG=1"; got != want {
+		t.Errorf("watchdog ping mismatch, got=%q, want=%q", got, want)
+	}
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if got := receive(); got != "WATCHDOG=1" {
+			if want := "STOPPING=1"; got != want {
+				t.Errorf("last state mismatch, got=%q, want=%q", got, want)
+			}
+			break
+		}
+	}
+}
+
+func TestSystemdNotifierDisabled(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	n, err := newSystemdNotifier()
+	if err != nil || n != nil {
+		t.Fatalf("notifier must be nil without NOTIFY_SOCKET, got=%v, err=%v", n, err)
+	}
+	if err := n.notify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	n.startWatchdog()
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
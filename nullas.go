@@ -0,0 +1,44 @@
+package main
+
+import "fmt"
+
+// Representations of missing kB fields given by -null-as. The default is
+// the native one of the format, an empty value in CSV and null in JSON,
+// SQLite and Parquet.
+const (
+	nullAsEmpty = "empty"
+	nullAsUpper = "NULL"
+	nullAsJSON  = "null"
+	nullAsNaN   = "NaN"
+)
+
+// validateNullAs checks -null-as, which is applied to the text formats.
+func (a *args) validateNullAs() error {
+	switch a.nullAs {
+	case "":
+		return nil
+	case nullAsEmpty, nullAsUpper, nullAsJSON, nullAsNaN:
+	default:
+		return fmt.Errorf("unsupported -null-as: %q", a.nullAs)
+	}
+	if tableFileBuilders[a.format] != nil || a.format == outputFormatArrow {
+		return fmt.Errorf("-null-as cannot be used with -format %s, which always stores missing fields as null", a.format)
+	}
+	return nil
+}
+
+// nullValue returns the value written for missing kB fields. An empty
+// value is written as null in JSON unless the policy is empty, and NaN
+// is written as a string, which JSON has no number for.
+func (a *args) nullValue() string {
+	switch a.nullAs {
+	case nullAsUpper, nullAsJSON:
+		if a.format == outputFormatJSON || a.format == outputFormatNDJSON {
+			return ""
+		}
+		return a.nullAs
+	case nullAsNaN:
+		return a.nullAs
+	}
+	return ""
+}
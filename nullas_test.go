@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNullAs(t *testing.T) {
+	input := `55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat
+Size:                  4 kB
+Rss:                   4 kB
+55e000-55f000 r-xp 00001000 fe:00 1234                       /usr/bin/cat
+Size:                  4 kB
+KernelPageSize:        4 kB
+Rss:                   0 kB
+`
+	testCases := []struct {
+		format string
+		nullAs string
+		want   string
+	}{
+		{format: outputFormatCSV, want: "/usr/bin/cat,4,,4\n"},
+		{format: outputFormatCSV, nullAs: nullAsEmpty, want: "/usr/bin/cat,4,,4\n"},
+		{format: outputFormatCSV, nullAs: nullAsUpper, want: "/usr/bin/cat,4,NULL,4\n"},
+		{format: outputFormatCSV, nullAs: nullAsJSON, want: "/usr/bin/cat,4,null,4\n"},
+		{format: outputFormatCSV, nullAs: nullAsNaN, want: "/usr/bin/cat,4,NaN,4\n"},
+		{format: outputFormatNDJSON, want: `{"Pathname":"/usr/bin/cat","Fields":{"Size":4,"KernelPageSize":null,"Rss":4}}` + "\n"},
+		{format: outputFormatNDJSON, nullAs: nullAsEmpty, want: `{"Pathname":"/usr/bin/cat","Fields":{"Size":4,"KernelPageSize":"","Rss":4}}` + "\n"},
+		{format: outputFormatNDJSON, nullAs: nullAsUpper, want: `{"Pathname":"/usr/bin/cat","Fields":{"Size":4,"KernelPageSize":null,"Rss":4}}` + "\n"},
+		{format: outputFormatNDJSON, nullAs: nullAsNaN, want: `{"Pathname":"/usr/bin/cat","Fields":{"Size":4,"KernelPageSize":"NaN","Rss":4}}` + "\n"},
+	}
+	for _, tc := range testCases {
+		filename := filepath.Join(t.TempDir(), "out")
+		a := args{floatFormat: defaultFloatFormat, Separator: ",", format: tc.format, nullAs: tc.nullAs, unionFields: true}
+		a.columns = []string{"Pathname", "Size", "KernelPageSize", "Rss"}
+		if err := a.validateNullAs(); err != nil {
+			t.Fatal(err)
+		}
+		w, err := createOutput(a, filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := convertSmapsToCsv(w, strings.NewReader(input), a); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Only the first region has the missing field.
+		lines := strings.SplitAfter(string(data), "\n")
+		got := lines[0]
+		if tc.format == outputFormatCSV {
+			got = lines[1]
+		}
+		if got != tc.want {
+			t.Errorf("format=%s, null-as=%s: result mismatch,\n got=%s,\nwant=%s", tc.format, tc.nullAs, got, tc.want)
+		}
+	}
+}
+
+func TestValidateNullAs(t *testing.T) {
+	a := args{nullAs: "nil"}
+	if err := a.validateNullAs(); err == nil || err.Error() != `unsupported -null-as: "nil"` {
+		t.Errorf("error mismatch, got=%v", err)
+	}
+	a = args{nullAs: nullAsNaN, format: outputFormatSQLite}
+	if err := a.validateNullAs(); err == nil || !strings.Contains(err.Error(), "-format sqlite") {
+		t.Errorf("error mismatch, got=%v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// numaMaps is the number of pages on each NUMA node of the regions in
+// /proc/<pid>/numa_maps, keyed by the start address of the region.
+type numaMaps struct {
+	// nodes are the nodes having pages of any region in ascending order.
+	nodes []int
+	pages map[uint64]map[int]int64
+}
+
+// readNumaMaps reads /proc/<pid>/numa_maps.
+func readNumaMaps(pid int) (*numaMaps, error) {
+	file, err := os.Open(procPath(pid, "numa_maps"))
+	if err != nil {
+		return nil, diagnoseOpenError(procPath(pid, "numa_maps"), err)
+	}
+	defer file.Close()
+	return parseNumaMaps(file)
+}
+
+// parseNumaMaps parses lines of numa_maps like
+//
+//	7f0000000000 default anon=3 dirty=3 N0=2 N1=1 kernelpagesize_kB=4
+//
+// where Nx=count is the number of pages of the region on node x.
+func parseNumaMaps(r io.Reader) (*numaMaps, error) {
+	nm := &numaMaps{pages: make(map[uint64]map[int]int64)}
+	seen := make(map[int]bool)
+	s := bufio.NewScanner(r)
+	lineNo := 0
+	for s.Scan() {
+		lineNo++
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		start, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("numa_maps: line %d: invalid start address: %q", lineNo, fields[0])
+		}
+		pages := make(map[int]int64)
+		for _, f := range fields[1:] {
+			key, value, ok := strings.Cut(f, "=")
+			if !ok || len(key) < 2 || key[0] != 'N' {
+				continue
+			}
+			node, err := strconv.Atoi(key[1:])
+			if err != nil {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("numa_maps: line %d: invalid page count: %q", lineNo, f)
+			}
+			pages[node] = n
+			if !seen[node] {
+				seen[node] = true
+				nm.nodes = append(nm.nodes, node)
+			}
+		}
+		nm.pages[start] = pages
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	sort.Ints(nm.nodes)
+	return nm, nil
+}
+
+// regionPages returns the pages on each node of the region starting at
+// start, or nil if numa_maps has no such region.
+func (nm *numaMaps) regionPages(start []byte) map[int]int64 {
+	addr, err := strconv.ParseUint(string(start), 16, 64)
+	if err != nil {
+		return nil
+	}
+	return nm.pages[addr]
+}
+
+// mergeNumaNodes returns the union of the sorted node lists a and b.
+func mergeNumaNodes(a, b []int) []int {
+	merged := append(append([]int(nil), a...), b...)
+	sort.Ints(merged)
+	nodes := merged[:0]
+	for i, node := range merged {
+		if i == 0 || node != merged[i-1] {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// numaColumn returns the name of the column of pages on node.
+func numaColumn(node int) string {
+	return "N" + strconv.Itoa(node)
+}
+
+// numaValue returns the number of pages on node in pages, which is empty
+// if the region is missing in numa_maps.
+func numaValue(pages map[int]int64, node int) string {
+	if pages == nil {
+		return ""
+	}
+	return strconv.FormatInt(pages[node], 10)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNumaMaps(t *testing.T) {
+	input := "55d000 default file=/usr/bin/cat mapped=1 N0=1 kernelpagesize_kB=4\n" +
+		"7f0000000000 interleave:0-1 anon=3 dirty=3 N1=2 N0=1 kernelpagesize_kB=4\n" +
+		"7ffd0000 default stack anon=1 dirty=1 N2=1 kernelpagesize_kB=4\n"
+	nm, err := parseNumaMaps(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1, 2}; !reflect.DeepEqual(nm.nodes, want) {
+		t.Errorf("nodes mismatch, got=%v, want=%v", nm.nodes, want)
+	}
+	if got, want := nm.regionPages([]byte("7f0000000000")), map[int]int64{0: 1, 1: 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pages mismatch, got=%v, want=%v", got, want)
+	}
+	if got := nm.regionPages([]byte("0055d000")); got[0] != 1 {
+		t.Errorf("pages of zero padded address mismatch, got=%v", got)
+	}
+	if got := nm.regionPages([]byte("1000")); got != nil {
+		t.Errorf("got pages %v of a missing region", got)
+	}
+
+	if _, err := parseNumaMaps(strings.NewReader("xyz default\n")); err == nil {
+		t.Error("got no error for an invalid address")
+	}
+}
+
+func TestMergeNumaNodes(t *testing.T) {
+	if got, want := mergeNumaNodes([]int{0, 2}, []int{1, 2}), []int{0, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch, got=%v, want=%v", got, want)
+	}
+}
+
+func TestConvertNuma(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+
+	dir := filepath.Join(procRoot, "1234")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	numaMaps := "0055d000 default file=/usr/bin/cat mapped=1 N0=1 kernelpagesize_kB=4\n" +
+		"7f0000000000 default anon=3 dirty=3 N0=1 N1=2 kernelpagesize_kB=4\n"
+	if err := os.WriteFile(filepath.Join(dir, "numa_maps"), []byte(numaMaps), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a := args{Separator: ",", numa: true, fieldNames: []string{"Rss"}, inputFilename: filepath.Join(dir, "smaps")}
+	if err := a.prepareInput(); err != nil {
+		t.Fatal(err)
+	}
+	input := "0055d000-0055e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nRss: 4 kB\n" +
+		"7f0000000000-7f0000003000 rw-p 00000000 00:00 0 \nRss: 12 kB\n" +
+		"7f0000003000-7f0000004000 rw-p 00000000 00:00 0 \nRss: 4 kB\n"
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input), a); err != nil {
+		t.Fatal(err)
+	}
+	want := "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,N0,N1,Rss\n" +
+		"0055d000,0055e000,r--p,00000000,fe:00,1234,/usr/bin/cat,1,0,4\n" +
+		"7f0000000000,7f0000003000,rw-p,00000000,00:00,0,,1,2,12\n" +
+		"7f0000003000,7f0000004000,rw-p,00000000,00:00,0,,,,4\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Scopes of the rows of -numa-report.
+const (
+	numaScopeProcess = "process"
+	numaScopeLibrary = "library"
+	numaScopeTotal   = "total"
+)
+
+// numaReport sums the pages on each NUMA node of -numa across the inputs
+// of a run, for each process and for each library, i.e. each mapped file
+// summed over the processes mapping it, so that processes and libraries
+// whose pages are not on one node stand out.
+type numaReport struct {
+	pids      []int
+	processes map[int]map[int]int64
+	libraries map[string]map[int]int64
+}
+
+func newNumaReport() *numaReport {
+	return &numaReport{processes: make(map[int]map[int]int64), libraries: make(map[string]map[int]int64)}
+}
+
+// add adds the pages of m of the process pid, or zero if unknown, with
+// the pathname of the library, which is empty for the regions not backed
+// by a file. Regions missing in numa_maps are skipped.
+func (r *numaReport) add(pid int, library string, m *mapping) {
+	pages := m.Region.NumaPages
+	if pages == nil {
+		return
+	}
+	if _, ok := r.processes[pid]; !ok {
+		r.pids = append(r.pids, pid)
+		r.processes[pid] = make(map[int]int64)
+	}
+	addNumaPages(r.processes[pid], pages)
+	if library != "" {
+		if _, ok := r.libraries[library]; !ok {
+			r.libraries[library] = make(map[int]int64)
+		}
+		addNumaPages(r.libraries[library], pages)
+	}
+}
+
+func addNumaPages(sums, pages map[int]int64) {
+	for node, n := range pages {
+		sums[node] += n
+	}
+}
+
+// numaLibrary returns the pathname of the file mapped by the region r,
+// which is empty for anonymous and special regions.
+func numaLibrary(r *region) string {
+	pathname := strings.TrimSuffix(string(r.Pathname), deletedSuffix)
+	if !strings.HasPrefix(pathname, "/") {
+		return ""
+	}
+	return pathname
+}
+
+// csv returns the report with a row for each process in the order of the
+// inputs, a row for each library sorted by pathname and a total row.
+// MaxNode is the node with the most pages, and MaxNodeRatio is the ratio
+// of its pages to all, which is 1 if all the pages are on one node.
+func (r *numaReport) csv() ([]byte, error) {
+	// Every page is in a process, so its nodes are those of the processes.
+	var nodes []int
+	for _, pages := range r.processes {
+		for node := range pages {
+			nodes = append(nodes, node)
+		}
+	}
+	nodes = mergeNumaNodes(nil, nodes)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := []string{"Scope", "Pid", "Pathname", "Pages"}
+	for _, node := range nodes {
+		header = append(header, numaColumn(node))
+	}
+	header = append(header, "MaxNode", "MaxNodeRatio")
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	row := func(scope, pid, pathname string, pages map[int]int64) []string {
+		var total, max int64
+		maxNode := -1
+		record := []string{scope, pid, pathname, ""}
+		for _, node := range nodes {
+			n := pages[node]
+			total += n
+			if maxNode < 0 || n > max {
+				maxNode, max = node, n
+			}
+			record = append(record, strconv.FormatInt(n, 10))
+		}
+		record[3] = strconv.FormatInt(total, 10)
+		if total == 0 {
+			return append(record, "", "")
+		}
+		return append(record, strconv.Itoa(maxNode), strconv.FormatFloat(float64(max)/float64(total), 'f', 4, 64))
+	}
+	total := make(map[int]int64)
+	for _, pid := range r.pids {
+		pages := r.processes[pid]
+		addNumaPages(total, pages)
+		p := ""
+		if pid != 0 {
+			p = strconv.Itoa(pid)
+		}
+		if err := w.Write(row(numaScopeProcess, p, "", pages)); err != nil {
+			return nil, err
+		}
+	}
+	libraries := make([]string, 0, len(r.libraries))
+	for library := range r.libraries {
+		libraries = append(libraries, library)
+	}
+	sort.Strings(libraries)
+	for _, library := range libraries {
+		if err := w.Write(row(numaScopeLibrary, "", library, r.libraries[library])); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Write(row(numaScopeTotal, "", "", total)); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
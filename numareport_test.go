@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNumaReportCSV(t *testing.T) {
+	r := newNumaReport()
+	for _, tc := range []struct {
+		pid      int
+		pathname string
+		pages    map[int]int64
+	}{
+		{pid: 10, pathname: "/usr/lib/libc.so.6", pages: map[int]int64{0: 3, 1: 1}},
+		{pid: 10, pathname: "[heap]", pages: map[int]int64{1: 4}},
+		{pid: 10, pathname: "/gone", pages: nil},
+		{pid: 9, pathname: "/usr/lib/libc.so.6 (deleted)", pages: map[int]int64{0: 2}},
+		{pid: 9, pathname: "", pages: map[int]int64{}},
+	} {
+		m := &mapping{Region: &region{Pathname: []byte(tc.pathname), NumaPages: tc.pages}}
+		r.add(tc.pid, numaLibrary(m.Region), m)
+	}
+	data, err := r.csv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Scope,Pid,Pathname,Pages,N0,N1,MaxNode,MaxNodeRatio\n" +
+		"process,10,,8,3,5,1,0.6250\n" +
+		"process,9,,2,2,0,0,1.0000\n" +
+		"library,,/usr/lib/libc.so.6,6,5,1,0,0.8333\n" +
+		"total,,,10,5,5,0,0.5000\n"
+	if got := string(data); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestNumaReportCSVEmpty(t *testing.T) {
+	data, err := newNumaReport().csv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "Scope,Pid,Pathname,Pages,MaxNode,MaxNodeRatio\ntotal,,,0,,\n"; got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
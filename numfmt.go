@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const localeEU = "eu"
+
+// numberFormat localizes numbers written in the C locale, i.e. with a
+// '.' decimal point and without thousands separators.
+type numberFormat struct {
+	decimalSep   string
+	thousandsSep string
+}
+
+// newNumberFormat returns a numberFormat, or nil if numbers are to be
+// written in the C locale as they are.
+func newNumberFormat(decimalSep, thousandsSep string) (*numberFormat, error) {
+	if decimalSep == thousandsSep {
+		return nil, fmt.Errorf("decimal separator and thousands separator must be different: %q", decimalSep)
+	}
+	if decimalSep == "." && thousandsSep == "" {
+		return nil, nil
+	}
+	return &numberFormat{decimalSep: decimalSep, thousandsSep: thousandsSep}, nil
+}
+
+// format localizes s if it is a decimal number, otherwise it returns s
+// unchanged.
+func (f *numberFormat) format(s string) string {
+	if !isDecimalNumber(s) {
+		return s
+	}
+	sign, s := "", s
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, fracPart, hasFrac := strings.Cut(s, ".")
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i := 0; i < len(intPart); i++ {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(f.thousandsSep)
+		}
+		b.WriteByte(intPart[i])
+	}
+	if hasFrac {
+		b.WriteString(f.decimalSep)
+		b.WriteString(fracPart)
+	}
+	return b.String()
+}
+
+// isDecimalNumber reports whether s consists of an optional minus sign,
+// digits and at most one decimal point.
+func isDecimalNumber(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	digits, dots := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case isDigit(s[i]):
+			digits++
+		case s[i] == '.':
+			dots++
+		default:
+			return false
+		}
+	}
+	return digits > 0 && dots <= 1
+}
+
+// floatFormat controls how computed floating point values are written.
+type floatFormat struct {
+	// precision is the number of digits after the decimal point, or -1
+	// for the smallest number of digits necessary to represent the value.
+	precision int
+	// sigDigits is the number of significant digits to round to, or 0
+	// for no rounding. It is used only when precision is -1.
+	sigDigits int
+}
+
+var defaultFloatFormat = floatFormat{precision: -1}
+
+func (f floatFormat) format(v float64) string {
+	if f.precision == -1 && f.sigDigits > 0 {
+		v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', f.sigDigits, 64), 64)
+	}
+	return strconv.FormatFloat(v, 'f', f.precision, 64)
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestNumberFormat(t *testing.T) {
+	f := &numberFormat{decimalSep: ",", thousandsSep: "."}
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{in: "0", want: "0"},
+		{in: "123", want: "123"},
+		{in: "1234", want: "1.234"},
+		{in: "1234567.125", want: "1.234.567,125"},
+		{in: "-123456", want: "-123.456"},
+		{in: "0.5", want: "0,5"},
+		{in: "rd wr mr", want: "rd wr mr"},
+		{in: "", want: ""},
+	}
+	for _, tc := range testCases {
+		if got := f.format(tc.in); got != tc.want {
+			t.Errorf("in=%q: result mismatch, got=%q, want=%q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestFloatFormat(t *testing.T) {
+	testCases := []struct {
+		f    floatFormat
+		in   float64
+		want string
+	}{
+		{f: defaultFloatFormat, in: 1.0 / 3, want: "0.3333333333333333"},
+		{f: floatFormat{precision: 2}, in: 1.0 / 3, want: "0.33"},
+		{f: floatFormat{precision: 0}, in: 2.5, want: "2"},
+		{f: floatFormat{precision: -1, sigDigits: 3}, in: 123456, want: "123000"},
+		{f: floatFormat{precision: -1, sigDigits: 2}, in: 0.012345, want: "0.012"},
+	}
+	for _, tc := range testCases {
+		if got := tc.f.format(tc.in); got != tc.want {
+			t.Errorf("format=%+v, in=%v: result mismatch, got=%q, want=%q", tc.f, tc.in, got, tc.want)
+		}
+	}
+}
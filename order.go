@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+// regionOrderChecker checks that region address ranges are in increasing
+// order without overlaps, as the kernel writes them. Violations indicate
+// that the capture raced with changes of the mappings, or that captures
+// were concatenated.
+type regionOrderChecker struct {
+	started            bool
+	prevStart, prevEnd uint64
+	prevLineNo         int
+}
+
+// check returns a description of the violation by the region of m, or
+// an empty string if there is none.
+func (c *regionOrderChecker) check(m *mapping) (string, error) {
+	start, end, err := m.Region.addressRange()
+	if err != nil {
+		return "", err
+	}
+	var violation string
+	switch {
+	case end <= start:
+		violation = fmt.Sprintf("region %x-%x is empty or inverted", start, end)
+	case !c.started:
+	case start < c.prevStart:
+		violation = fmt.Sprintf("region %x-%x starts before the region %x-%x at line %d",
+			start, end, c.prevStart, c.prevEnd, c.prevLineNo)
+	case start < c.prevEnd:
+		violation = fmt.Sprintf("region %x-%x overlaps the region %x-%x at line %d",
+			start, end, c.prevStart, c.prevEnd, c.prevLineNo)
+	}
+	c.started = true
+	c.prevStart, c.prevEnd, c.prevLineNo = start, end, m.LineNo
+	return violation, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestRegionOrderCheckerCheck(t *testing.T) {
+	testCases := []struct {
+		start, end string
+		want       string
+	}{
+		{start: "1000", end: "2000"},
+		{start: "2000", end: "3000"},
+		{start: "2800", end: "4000", want: "region 2800-4000 overlaps the region 2000-3000 at line 2"},
+		{start: "1000", end: "1800", want: "region 1000-1800 starts before the region 2800-4000 at line 3"},
+		{start: "5000", end: "5000", want: "region 5000-5000 is empty or inverted"},
+	}
+	c := &regionOrderChecker{}
+	for i, tc := range testCases {
+		m := &mapping{Region: &region{AddressStart: []byte(tc.start), AddressEnd: []byte(tc.end)}, LineNo: i + 1}
+		got, err := c.check(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("region %s-%s: result mismatch,\n got=%q,\nwant=%q", tc.start, tc.end, got, tc.want)
+		}
+	}
+}
+
+func TestConvertCheckOrderStrict(t *testing.T) {
+	var buf bytes.Buffer
+	err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(testSmapsUnsorted), args{checkOrder: true, strict: true})
+	if err == nil || !strings.HasPrefix(err.Error(), "line 5: region 55d000-55e000 starts before") {
+		t.Errorf("error mismatch, got=%v", err)
+	}
+
+	l := &anomalyLog{file: "smaps"}
+	buf.Reset()
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(testSmapsUnsorted), args{checkOrder: true, anomalies: l}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := l.count, 1; got != want {
+		t.Errorf("anomaly count mismatch, got=%d, want=%d", got, want)
+	}
+}
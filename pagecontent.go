@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// pageContentColumns are the columns added by -page-content.
+var pageContentColumns = []string{"SampledPages", "ZeroPageRatio", "Entropy"}
+
+// pageContent is the estimate of the contents of the resident pages of a
+// region from a sample of them.
+type pageContent struct {
+	sampled int64
+	zero    int64
+	// entropy is the Shannon entropy of the bytes of the sampled pages
+	// other than the zero pages in bits per byte, from 0 to 8. Dividing
+	// it by 8 roughly estimates the ratio of the compressed size.
+	entropy float64
+}
+
+// values returns the values of pageContentColumns, which are empty if c
+// is nil, i.e. the region is not sampled.
+func (c *pageContent) values() []string {
+	if c == nil {
+		return []string{"", "", ""}
+	}
+	ratio := 0.0
+	if c.sampled > 0 {
+		ratio = float64(c.zero) / float64(c.sampled)
+	}
+	return []string{
+		strconv.FormatInt(c.sampled, 10),
+		strconv.FormatFloat(ratio, 'f', 3, 64),
+		strconv.FormatFloat(c.entropy, 'f', 3, 64),
+	}
+}
+
+// pageContentSampler reads samples of the resident pages of regions of a
+// live process with process_vm_readv, which needs the same access to
+// the process as ptrace. Only the pages present in pagemap are read, so
+// that sampling neither faults in nor swaps in pages.
+type pageContentSampler struct {
+	pid      int
+	pageSize int64
+	// pages is the maximum number of the pages sampled in each region.
+	pages  int
+	pathRe *regexp.Regexp
+}
+
+func newPageContentSampler(pid, pages int, pathPattern string) (*pageContentSampler, error) {
+	if pid <= 0 {
+		return nil, errors.New("pid of the target process is unknown; use /proc/<pid>/smaps as input")
+	}
+	s := &pageContentSampler{pid: pid, pageSize: int64(os.Getpagesize()), pages: pages}
+	if pathPattern != "" {
+		re, err := regexp.Compile(pathPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -page-content-path: %w", err)
+		}
+		s.pathRe = re
+	}
+	return s, nil
+}
+
+// selects reports whether the region r is sampled, which is readable and
+// matches -page-content-path.
+func (s *pageContentSampler) selects(r *region) bool {
+	if len(r.Perms) == 0 || r.Perms[0] != 'r' {
+		return false
+	}
+	return s.pathRe == nil || s.pathRe.Match(r.Pathname)
+}
+
+// sample returns the estimate of the contents of the region r.
+func (s *pageContentSampler) sample(r *region) (*pageContent, error) {
+	start, end, err := r.addressRange()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(procPath(s.pid, "pagemap"))
+	if err != nil {
+		return nil, diagnoseOpenError(procPath(s.pid, "pagemap"), err)
+	}
+	defer file.Close()
+	present, err := presentPages(file, start/uint64(s.pageSize), end/uint64(s.pageSize))
+	if err != nil {
+		return nil, err
+	}
+	c := &pageContent{}
+	var counts [256]int64
+	buf := make([]byte, s.pageSize)
+	for _, page := range samplePages(present, s.pages) {
+		n, err := readProcessMemory(s.pid, page*uint64(s.pageSize), buf)
+		if err != nil {
+			return nil, fmt.Errorf("read memory of pid %d at %x: %w", s.pid, page*uint64(s.pageSize), err)
+		}
+		c.sampled++
+		if isZeroPage(buf[:n]) {
+			c.zero++
+			continue
+		}
+		for _, b := range buf[:n] {
+			counts[b]++
+		}
+	}
+	c.entropy = entropy(counts[:])
+	return c, nil
+}
+
+// presentPages returns the numbers of the present pages from first to
+// before last in pagemap.
+func presentPages(pagemap io.ReaderAt, first, last uint64) ([]uint64, error) {
+	var pages []uint64
+	buf := make([]byte, pagemapChunk*pagemapEntry)
+	for page := first; page < last; {
+		n := last - page
+		if n > pagemapChunk {
+			n = pagemapChunk
+		}
+		b := buf[:n*pagemapEntry]
+		if _, err := pagemap.ReadAt(b, int64(page*pagemapEntry)); err != nil {
+			return nil, fmt.Errorf("read pagemap: %w", err)
+		}
+		for i := 0; i < len(b); i += pagemapEntry {
+			if binary.LittleEndian.Uint64(b[i:])&pagemapPresent != 0 {
+				pages = append(pages, page+uint64(i/pagemapEntry))
+			}
+		}
+		page += n
+	}
+	return pages, nil
+}
+
+// samplePages returns at most n of pages spread evenly over them, so that
+// the same region gives the same sample.
+func samplePages(pages []uint64, n int) []uint64 {
+	if len(pages) <= n {
+		return pages
+	}
+	sample := make([]uint64, n)
+	for i := range sample {
+		sample[i] = pages[i*len(pages)/n]
+	}
+	return sample
+}
+
+// isZeroPage reports whether all the bytes of b are zero.
+func isZeroPage(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// entropy returns the Shannon entropy in bits per byte of the bytes
+// counted in counts.
+func entropy(counts []int64) float64 {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	var h float64
+	for _, n := range counts {
+		if n == 0 {
+			continue
+		}
+		p := float64(n) / float64(total)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// validatePageContent checks -page-content and -page-content-path.
+func (a *args) validatePageContent() error {
+	switch {
+	case a.pageContent < 0:
+		return errors.New("-page-content must not be negative")
+	case a.pageContentPath != "" && a.pageContent == 0:
+		return errors.New("-page-content-path requires -page-content")
+	case a.pageContent > 0 && a.dropUser != "":
+		return errors.New("-drop-privileges cannot be used with -page-content, which needs privileges while converting")
+	}
+	return nil
+}
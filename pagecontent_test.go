@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+	"unsafe"
+)
+
+func TestPresentPages(t *testing.T) {
+	pagemap := bytes.NewReader(testPagemap(-1, 0, -1, -1, 1))
+	got, err := presentPages(pagemap, 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch, got=%v, want=%v", got, want)
+	}
+}
+
+func TestSamplePages(t *testing.T) {
+	pages := []uint64{10, 11, 12, 13, 14, 15}
+	if got := samplePages(pages, 10); !reflect.DeepEqual(got, pages) {
+		t.Errorf("sample of fewer pages mismatch, got=%v, want=%v", got, pages)
+	}
+	if got, want := samplePages(pages, 3), []uint64{10, 12, 14}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sample mismatch, got=%v, want=%v", got, want)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	var counts [256]int64
+	if got := entropy(counts[:]); got != 0 {
+		t.Errorf("entropy of nothing = %v, want 0", got)
+	}
+	counts['x'] = 100
+	if got := entropy(counts[:]); got != 0 {
+		t.Errorf("entropy of a single byte = %v, want 0", got)
+	}
+	for i := range counts {
+		counts[i] = 3
+	}
+	if got := entropy(counts[:]); got != 8 {
+		t.Errorf("entropy of uniform bytes = %v, want 8", got)
+	}
+}
+
+func TestPageContentValues(t *testing.T) {
+	var c *pageContent
+	if got, want := c.values(), []string{"", "", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("values of a region not sampled mismatch, got=%q, want=%q", got, want)
+	}
+	c = &pageContent{sampled: 4, zero: 1, entropy: 2.5}
+	if got, want := c.values(), []string{"4", "0.250", "2.500"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("values mismatch, got=%q, want=%q", got, want)
+	}
+}
+
+func TestPageContentSamplerSample(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process_vm_readv is supported only on Linux")
+	}
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+
+	// The first page is all zero and the second one has all byte values
+	// equally, in a buffer of this process.
+	pageSize := os.Getpagesize()
+	data := make([]byte, 3*pageSize)
+	offset := pageSize - int(uintptr(unsafe.Pointer(&data[0])))%pageSize
+	for i := 0; i < pageSize; i++ {
+		data[offset+pageSize+i] = byte(i)
+	}
+	start := uint64(uintptr(unsafe.Pointer(&data[offset])))
+	firstPage := start / uint64(pageSize)
+
+	pid := os.Getpid()
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(filepath.Join(dir, "pagemap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make([]byte, 2*pagemapEntry)
+	binary.LittleEndian.PutUint64(entries, pagemapPresent)
+	binary.LittleEndian.PutUint64(entries[pagemapEntry:], pagemapPresent)
+	if _, err := file.WriteAt(entries, int64(firstPage*pagemapEntry)); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newPageContentSampler(pid, 16, `^\[heap\]$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &region{
+		AddressStart: []byte(fmt.Sprintf("%x", start)),
+		AddressEnd:   []byte(fmt.Sprintf("%x", start+2*uint64(pageSize))),
+		Perms:        []byte("rw-p"),
+		Pathname:     []byte("[heap]"),
+	}
+	if !s.selects(r) {
+		t.Fatal("region not selected")
+	}
+	got, err := s.sample(r)
+	runtime.KeepAlive(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&pageContent{sampled: 2, zero: 1, entropy: 8}); *got != *want {
+		t.Errorf("result mismatch, got=%+v, want=%+v", *got, *want)
+	}
+	if s.selects(&region{Perms: []byte("rw-p"), Pathname: []byte("/a")}) || s.selects(&region{Perms: []byte("---p"), Pathname: []byte("[heap]")}) {
+		t.Error("want regions not matching the pathname or not readable unselected")
+	}
+}
+
+func TestValidatePageContent(t *testing.T) {
+	for _, a := range []args{
+		{pageContent: -1},
+		{pageContentPath: "heap"},
+		{pageContent: 8, dropUser: "nobody"},
+	} {
+		if err := a.validatePageContent(); err == nil {
+			t.Errorf("args=%+v: got no error", a)
+		}
+	}
+}
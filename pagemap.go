@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// More bits of an entry of /proc/<pid>/pagemap. A page is mapped
+// exclusively if it is present and mapped only by this process.
+const (
+	pagemapPresent   = 1 << 63
+	pagemapExclusive = 1 << 56
+)
+
+// pagemapColumns are the columns added by -pagemap.
+var pagemapColumns = []string{"PresentPages", "SwappedPages", "ExclusivePages"}
+
+// pageCounts are the numbers of the pages of a region in pagemap.
+type pageCounts struct {
+	present   int64
+	swapped   int64
+	exclusive int64
+}
+
+// values returns the values of pagemapColumns, which are empty if c is
+// nil, i.e. the region could not be read.
+func (c *pageCounts) values() []string {
+	if c == nil {
+		return []string{"", "", ""}
+	}
+	return []string{
+		strconv.FormatInt(c.present, 10),
+		strconv.FormatInt(c.swapped, 10),
+		strconv.FormatInt(c.exclusive, 10),
+	}
+}
+
+// pagemapReader counts the pages of regions from /proc/<pid>/pagemap,
+// which needs the same access to the process as ptrace.
+type pagemapReader struct {
+	pid      int
+	pageSize int64
+}
+
+func newPagemapReader(pid int) (*pagemapReader, error) {
+	if pid <= 0 {
+		return nil, errors.New("pid of the target process is unknown; use /proc/<pid>/smaps as input")
+	}
+	return &pagemapReader{pid: pid, pageSize: int64(os.Getpagesize())}, nil
+}
+
+// regionCounts returns the page counts of the region r.
+func (p *pagemapReader) regionCounts(r *region) (*pageCounts, error) {
+	start, end, err := r.addressRange()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(procPath(p.pid, "pagemap"))
+	if err != nil {
+		return nil, diagnoseOpenError(procPath(p.pid, "pagemap"), err)
+	}
+	defer file.Close()
+	return countPages(file, start/uint64(p.pageSize), end/uint64(p.pageSize))
+}
+
+// countPages counts the present, swapped and exclusively mapped pages in
+// the entries of the pages from first to before last in pagemap.
+func countPages(pagemap io.ReaderAt, first, last uint64) (*pageCounts, error) {
+	c := &pageCounts{}
+	buf := make([]byte, pagemapChunk*pagemapEntry)
+	for page := first; page < last; {
+		n := last - page
+		if n > pagemapChunk {
+			n = pagemapChunk
+		}
+		b := buf[:n*pagemapEntry]
+		if _, err := pagemap.ReadAt(b, int64(page*pagemapEntry)); err != nil {
+			return nil, fmt.Errorf("read pagemap: %w", err)
+		}
+		for i := 0; i < len(b); i += pagemapEntry {
+			entry := binary.LittleEndian.Uint64(b[i:])
+			if entry&pagemapPresent != 0 {
+				c.present++
+				if entry&pagemapExclusive != 0 {
+					c.exclusive++
+				}
+			}
+			if entry&pagemapSwapped != 0 {
+				c.swapped++
+			}
+		}
+		page += n
+	}
+	return c, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCountPages(t *testing.T) {
+	entries := []uint64{
+		pagemapPresent | pagemapExclusive,
+		pagemapPresent,
+		pagemapSwapped | 1,
+		0,
+		pagemapPresent | pagemapExclusive,
+	}
+	b := make([]byte, len(entries)*pagemapEntry)
+	for i, entry := range entries {
+		binary.LittleEndian.PutUint64(b[i*pagemapEntry:], entry)
+	}
+	got, err := countPages(bytes.NewReader(b), 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&pageCounts{present: 2, swapped: 1, exclusive: 1}); !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch, got=%+v, want=%+v", got, want)
+	}
+	if _, err := countPages(bytes.NewReader(b), 4, 10); err == nil {
+		t.Error("want an error for reading beyond the end of pagemap")
+	}
+}
+
+func TestConvertPagemap(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	if err := os.MkdirAll(filepath.Join(procRoot, "10"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Pages 1 to 3 are the first region, and the second region at page 4
+	// is beyond the end of pagemap, which is not read as it has neither
+	// Rss nor Swap.
+	if err := os.WriteFile(filepath.Join(procRoot, "10", "pagemap"), testPagemap(-1, -1, 0, 1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pageSize := os.Getpagesize()
+	kB := func(pages int) string { return strconv.Itoa(pages * pageSize / 1024) }
+	addr := func(page int) string { return strconv.FormatInt(int64(page*pageSize), 16) }
+	input := addr(1) + "-" + addr(4) + " rw-p 00000000 00:00 0 \nRss: " + kB(1) + " kB\nSwap: " + kB(2) + " kB\n" +
+		addr(4) + "-" + addr(5) + " rw-p 00000000 00:00 0 \nRss: 0 kB\nSwap: 0 kB\n" +
+		addr(5) + "-" + addr(6) + " rw-p 00000000 00:00 0 \nRss: " + kB(1) + " kB\nSwap: 0 kB\n"
+	pr, err := newPagemapReader(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	a := args{Separator: ",", pagemap: true, pagemapReader: pr, anomalies: &anomalyLog{}}
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input), a); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := records[0][7:10], pagemapColumns; !reflect.DeepEqual(got, want) {
+		t.Errorf("header mismatch, got=%v, want=%v", got, want)
+	}
+	wants := [][]string{{"1", "2", "0"}, {"0", "0", "0"}, {"", "", ""}}
+	for i, want := range wants {
+		if got := records[i+1][7:10]; !reflect.DeepEqual(got, want) {
+			t.Errorf("region %d mismatch, got=%v, want=%v", i, got, want)
+		}
+	}
+
+	if _, err := newPagemapReader(0); err == nil {
+		t.Error("want an error without the pid")
+	}
+}
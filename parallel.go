@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// parallelConversion converts the sources of a batch with a pool of
+// workers ahead of writing their mappings, so that reading and enriching
+// the inputs, e.g. with -pagemap or -numa, overlap. The mappings are
+// written in the order of the sources, so the output is the same as
+// without -jobs.
+type parallelConversion struct {
+	results []*sourceResult
+	// slots limits the sources being converted or waiting to be written
+	// to the number of the workers.
+	slots chan struct{}
+	stop  chan struct{}
+}
+
+// sourceResult is the conversion of a source by a worker, whose stats and
+// anomalies are merged into those of the run when it is written.
+type sourceResult struct {
+	mappings  []*mapping
+	live      *liveProcessReader
+	stats     *runStats
+	anomalies *anomalyLog
+	err       error
+	done      chan struct{}
+}
+
+// startParallelConversion starts converting the sources with jobs
+// workers.
+func startParallelConversion(sources []*inputSource, args args, captureTime time.Time, jobs int) *parallelConversion {
+	pc := &parallelConversion{
+		results: make([]*sourceResult, len(sources)),
+		slots:   make(chan struct{}, jobs),
+		stop:    make(chan struct{}),
+	}
+	for i := range pc.results {
+		pc.results[i] = &sourceResult{done: make(chan struct{})}
+	}
+	go func() {
+		// The slots are taken in the order of the sources, so the
+		// source written next always has one.
+		for i, src := range sources {
+			select {
+			case pc.slots <- struct{}{}:
+			case <-pc.stop:
+				return
+			}
+			go pc.results[i].convert(src, args, captureTime)
+		}
+	}()
+	return pc
+}
+
+// result waits for the conversion of the i-th source.
+func (pc *parallelConversion) result(i int) *sourceResult {
+	r := pc.results[i]
+	<-r.done
+	return r
+}
+
+// release frees the slot of the i-th source after it is written.
+func (pc *parallelConversion) release(i int) {
+	pc.results[i] = nil
+	<-pc.slots
+}
+
+// close stops starting the conversions of the remaining sources.
+func (pc *parallelConversion) close() {
+	close(pc.stop)
+}
+
+// convert converts src into r.mappings.
+func (r *sourceResult) convert(src *inputSource, args args, captureTime time.Time) {
+	defer close(r.done)
+	in := src.args
+	r.stats = &runStats{}
+	r.anomalies = &anomalyLog{file: in.inputFilename, buffered: true}
+	in.stats, in.anomalies, in.captureTime = r.stats, r.anomalies, captureTime
+	// The checkers warn about each field once, which is once for each
+	// source here, since they cannot be shared by the workers.
+	if in.compat != nil {
+		in.compat = newKernelCompatNormalizer()
+	}
+	if in.fieldChecker != nil {
+		in.fieldChecker = newFieldChecker(in.unknownFields, in.skipBadLines)
+	}
+	var input io.Reader = src.file
+	if pid := pidFromInputPath(in.inputFilename); args.batch && pid != 0 && !src.saved {
+		r.live = &liveProcessReader{r: src.file, pid: pid, retry: args.retry}
+		input = r.live
+	}
+	input, err := decompressReader(countingReader{r: input, n: &r.stats.bytesRead})
+	if err != nil {
+		r.err = err
+		return
+	}
+	args.readLimiter.acquire()
+	defer args.readLimiter.release()
+	r.err = convertMappings(input, in, func(m *mapping) error {
+		r.mappings = append(r.mappings, m)
+		return nil
+	})
+}
+
+// validateJobs checks -jobs, whose workers cannot share the reports and
+// the raw inputs written in the order of the mappings.
+func (a *args) validateJobs() error {
+	switch {
+	case a.jobs < 0:
+		return errors.New("-jobs must not be negative")
+	case a.jobs <= 1:
+		return nil
+	case !a.batch:
+		return errors.New("-jobs requires -p or a glob pattern of -i")
+	case a.shmReportPath != "", a.compSwapPath != "", a.lazyFreePath != "", a.numaReportPath != "", a.growthLogPath != "", a.baselinePath != "":
+		return errors.New("-jobs cannot be used with -shm-report, -compressed-swap-report, -lazyfree-report, -numa-report, -growth-log and -baseline")
+	case a.keepRawDir != "", a.checkpointDir != "", a.spread > 0, a.rebaseAddrs:
+		return errors.New("-jobs cannot be used with -keep-raw, -checkpoint, -spread and -rebase-addresses")
+	}
+	return nil
+}
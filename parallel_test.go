@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunBatchJobs(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	for pid := 1; pid <= 9; pid++ {
+		dir := filepath.Join(procRoot, fmt.Sprint(pid))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		smaps := fmt.Sprintf("00400000-00401000 r--p 00000000 08:02 %d /bin/p%d\nRss: %d kB\nPss: %d kB\n", pid, pid, 4*pid, 2*pid)
+		if err := os.WriteFile(filepath.Join(dir, "smaps"), []byte(smaps), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	convert := func(jobs, maxConcurrentReads int) (string, *runStats) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var a args
+		a.registerFlags(fs)
+		if err := fs.Parse([]string{"-source-columns"}); err != nil {
+			t.Fatal(err)
+		}
+		a.jobs = jobs
+		a.maxConcurrentReads = maxConcurrentReads
+		a.inputFilename = filepath.Join(procRoot, "[0-9]*", "smaps")
+		a.outputFilename = filepath.Join(t.TempDir(), "out.csv")
+		if err := a.resolveInputs(); err != nil {
+			t.Fatal(err)
+		}
+		a.stats = &runStats{}
+		if err := run(a); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(a.outputFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(got), a.stats
+	}
+	want, wantStats := convert(1, 0)
+	for _, maxConcurrentReads := range []int{0, 2} {
+		got, gotStats := convert(4, maxConcurrentReads)
+		if got != want {
+			t.Errorf("-max-concurrent-reads %d: result mismatch,\n got=%s,\nwant=%s", maxConcurrentReads, got, want)
+		}
+		if gotStats.bytesRead != wantStats.bytesRead || gotStats.pssKB != wantStats.pssKB || gotStats.rows != wantStats.rows {
+			t.Errorf("-max-concurrent-reads %d: stats mismatch, got=%+v, want=%+v", maxConcurrentReads, *gotStats, *wantStats)
+		}
+	}
+}
+
+func TestAnomalyLogReplay(t *testing.T) {
+	to := &anomalyLog{file: "b"}
+	l := &anomalyLog{file: "a", buffered: true}
+	l.report(1, "bad", "x")
+	l.report(3, "worse", "y")
+	if to.count != 0 || l.count != 2 {
+		t.Fatalf("counts before replay = %d, %d, want 0, 2", to.count, l.count)
+	}
+	want := []anomaly{{File: "a", Line: 1, Reason: "bad", Raw: "x"}, {File: "a", Line: 3, Reason: "worse", Raw: "y"}}
+	if !reflect.DeepEqual(l.pending, want) {
+		t.Errorf("pending mismatch, got=%+v, want=%+v", l.pending, want)
+	}
+	l.replay(to)
+	if to.count != 2 || l.pending != nil {
+		t.Errorf("count after replay = %d, pending=%+v, want 2 and none", to.count, l.pending)
+	}
+}
+
+func TestRunStatsMerge(t *testing.T) {
+	s := &runStats{bytesRead: 10, pssKB: 1, sources: []sourceStats{{Source: "a", Failures: 1}}}
+	s.merge(&runStats{bytesRead: 5, pssKB: 2, guardRegions: 1, sources: []sourceStats{{Source: "a", Failures: 2, Error: "gone"}}})
+	want := &runStats{bytesRead: 15, pssKB: 3, guardRegions: 1, sources: []sourceStats{{Source: "a", Failures: 3, Error: "gone"}}}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("result mismatch, got=%+v, want=%+v", *s, *want)
+	}
+}
+
+func TestValidateJobs(t *testing.T) {
+	for _, a := range []args{
+		{jobs: -1},
+		{jobs: 2},
+		{jobs: 2, batch: true, shmReportPath: "shm.csv"},
+		{jobs: 2, batch: true, checkpointDir: "ckpt"},
+	} {
+		if err := a.validateJobs(); err == nil {
+			t.Errorf("args=%+v: got no error", a)
+		}
+	}
+	if err := (&args{jobs: 4, batch: true}).validateJobs(); err != nil {
+		t.Errorf("got error: %v", err)
+	}
+}
@@ -0,0 +1,597 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Parquet physical types, encodings and other enum values of the file
+// metadata.
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetOptional = 1
+	parquetUTF8     = 0
+
+	parquetPlain         = 0
+	parquetRLE           = 3
+	parquetRLEDictionary = 8
+
+	parquetUncompressed = 0
+	parquetGzip         = 2
+	parquetZstd         = 6
+
+	parquetPageTypeData       = 0
+	parquetPageTypeDictionary = 2
+)
+
+// parquetOptions are the encodings and the compression of the Parquet
+// output given by -parquet-dictionary, -parquet-compression and
+// -parquet-column-compression. The zero value writes uncompressed PLAIN
+// pages.
+type parquetOptions struct {
+	// dictionary are the columns written with the dictionary encoding,
+	// which makes columns of few distinct values such as Pathname and
+	// Perms much smaller.
+	dictionary []string
+	codec      int
+	// level is the compression level of gzip or zstd.
+	level int
+	// columnCompressions override codec and level for some columns.
+	columnCompressions map[string]columnCompression
+}
+
+// columnCompression is the compression of a column of the columnar
+// outputs: the Parquet codec, which Arrow outputs use too, and its level.
+type columnCompression struct {
+	codec int
+	level int
+}
+
+// validateParquet checks that -parquet-dictionary, -parquet-compression
+// and -parquet-column-compression are used with -format parquet and sets
+// parquetOptions from them.
+func (a *args) validateParquet() error {
+	if a.parquetDictionary == "" && (a.parquetCompress == "" || a.parquetCompress == "none") && a.parquetColumnCompress == "" {
+		return nil
+	}
+	if a.format != outputFormatParquet {
+		return errors.New("-parquet-dictionary, -parquet-compression and -parquet-column-compression require -format parquet")
+	}
+	codec, level, err := parseParquetCompression(a.parquetCompress)
+	if err != nil {
+		return err
+	}
+	a.parquetOptions = parquetOptions{codec: codec, level: level}
+	if a.parquetDictionary != "" {
+		a.parquetOptions.dictionary = strings.Split(a.parquetDictionary, ",")
+	}
+	columns, err := parseColumnCompressions("-parquet-column-compression", a.parquetColumnCompress, true)
+	if err != nil {
+		return err
+	}
+	a.parquetOptions.columnCompressions = columns
+	return nil
+}
+
+// parseParquetCompression parses -parquet-compression, which is "none",
+// or "gzip" or "zstd" optionally followed by ":" and the level, e.g.
+// gzip:9 or zstd:19.
+func parseParquetCompression(s string) (codec, level int, err error) {
+	return parseColumnarCompression("-parquet-compression", s, true)
+}
+
+// parseColumnarCompression parses the compression of the option of a
+// columnar output, which is "none", or "zstd", or "gzip" if gzip is true,
+// optionally followed by ":" and the level.
+func parseColumnarCompression(option, s string, gzipAllowed bool) (codec, level int, err error) {
+	name, levelStr, hasLevel := strings.Cut(s, ":")
+	minLevel, maxLevel := 0, 0
+	switch {
+	case name == "" || name == "none":
+		if hasLevel {
+			return 0, 0, fmt.Errorf("%s %s has no level", option, name)
+		}
+		return parquetUncompressed, 0, nil
+	case name == compressGzip && gzipAllowed:
+		codec, level, minLevel, maxLevel = parquetGzip, gzip.DefaultCompression, gzip.BestSpeed, gzip.BestCompression
+	case name == compressZstd:
+		// The levels are those of the zstd command, which are mapped to
+		// the nearest of the four levels of the encoder.
+		codec, level, minLevel, maxLevel = parquetZstd, 3, 1, 22
+	default:
+		return 0, 0, fmt.Errorf("unsupported %s: %q", option, s)
+	}
+	if hasLevel {
+		level, err = strconv.Atoi(levelStr)
+		if err != nil || level < minLevel || level > maxLevel {
+			return 0, 0, fmt.Errorf("invalid %s level of %s: %q", name, option, levelStr)
+		}
+	}
+	return codec, level, nil
+}
+
+// parseColumnCompressions parses the option of comma separated
+// <column>=<compression> overriding the compression of the columns, e.g.
+// Pathname=zstd:19,Rss=none.
+func parseColumnCompressions(option, s string, gzipAllowed bool) (map[string]columnCompression, error) {
+	if s == "" {
+		return nil, nil
+	}
+	columns := make(map[string]columnCompression)
+	for _, spec := range strings.Split(s, ",") {
+		name, compression, ok := strings.Cut(spec, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s must be comma separated <column>=<compression>: %q", option, spec)
+		}
+		codec, level, err := parseColumnarCompression(option, compression, gzipAllowed)
+		if err != nil {
+			return nil, err
+		}
+		columns[name] = columnCompression{codec: codec, level: level}
+	}
+	return columns, nil
+}
+
+// checkColumnCompressions checks that the columns of the option are in
+// the output.
+func checkColumnCompressions(option string, compressions map[string]columnCompression, columns []string) error {
+	for name := range compressions {
+		if indexOf(columns, name) == -1 {
+			return fmt.Errorf("column %s of %s is not in the output", name, option)
+		}
+	}
+	return nil
+}
+
+// compressColumnar returns data compressed with c.
+func compressColumnar(c columnCompression, data []byte) ([]byte, error) {
+	switch c.codec {
+	case parquetGzip:
+		var buf bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&buf, c.level)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case parquetZstd:
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.level)), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer enc.Close()
+		return enc.EncodeAll(data, nil), nil
+	}
+	return data, nil
+}
+
+// parquetMagic is at the start and the end of a Parquet file.
+const parquetMagic = "PAR1"
+
+// parquetColumnType returns the physical type of the column name with the
+// values in the column index i of rows. The columns in stringColumns are
+// UTF8 strings and the others are INT64 if all their values are integers,
+// DOUBLE if they are numbers, and UTF8 strings otherwise, e.g. the Group
+// column. Empty values are null.
+func parquetColumnType(name string, rows [][]string, i int) int {
+	if stringColumns[name] {
+		return parquetByteArray
+	}
+	typ := parquetInt64
+	for _, row := range rows {
+		if i >= len(row) || row[i] == "" {
+			continue
+		}
+		if !isJSONNumber(row[i]) {
+			return parquetByteArray
+		}
+		if _, err := parseInt64Value(row[i]); err != nil {
+			typ = parquetDouble
+		}
+	}
+	return typ
+}
+
+// parquetColumn is a column chunk of a Parquet file with a single data
+// page, which follows the dictionary page if the column is dictionary
+// encoded.
+type parquetColumn struct {
+	name             string
+	typ              int
+	offset           int64
+	dataOffset       int64
+	dictionary       bool
+	compression      columnCompression
+	size             int64
+	uncompressedSize int64
+}
+
+// buildParquetFile returns a Parquet file with a row group of the rows,
+// whose schema of optional columns is created from the columns. The data
+// is written uncompressed with the PLAIN encoding.
+func buildParquetFile(columns []string, rows [][]string) ([]byte, error) {
+	return parquetOptions{}.build(columns, rows)
+}
+
+// build returns a Parquet file like buildParquetFile with the encodings
+// and the compression of o.
+func (o parquetOptions) build(columns []string, rows [][]string) ([]byte, error) {
+	for _, name := range o.dictionary {
+		if indexOf(columns, name) == -1 {
+			return nil, fmt.Errorf("column %s of -parquet-dictionary is not in the output", name)
+		}
+	}
+	if err := checkColumnCompressions("-parquet-column-compression", o.columnCompressions, columns); err != nil {
+		return nil, err
+	}
+	data := []byte(parquetMagic)
+	chunks := make([]parquetColumn, len(columns))
+	for i, name := range columns {
+		c := parquetColumn{name: name, typ: parquetColumnType(name, rows, i), offset: int64(len(data))}
+		c.dictionary = indexOf(o.dictionary, name) != -1
+		c.compression = columnCompression{codec: o.codec, level: o.level}
+		if cc, ok := o.columnCompressions[name]; ok {
+			c.compression = cc
+		}
+		var page []byte
+		if c.dictionary {
+			dict, numDict, indexes := parquetDictionary(c.typ, rows, i)
+			var err error
+			if data, err = o.appendPage(data, &c, parquetPageTypeDictionary, numDict, parquetPlain, dict); err != nil {
+				return nil, err
+			}
+			page = append(parquetDefinitionLevels(rows, i), indexes...)
+		} else {
+			page = parquetDataPage(c.typ, rows, i)
+		}
+		c.dataOffset = int64(len(data))
+		encoding := parquetPlain
+		if c.dictionary {
+			encoding = parquetRLEDictionary
+		}
+		var err error
+		if data, err = o.appendPage(data, &c, parquetPageTypeData, len(rows), encoding, page); err != nil {
+			return nil, err
+		}
+		c.size = int64(len(data)) - c.offset
+		chunks[i] = c
+	}
+	footer := appendParquetFileMetaData(nil, chunks, len(rows))
+	data = append(data, footer...)
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(footer)))
+	data = append(data, size[:]...)
+	return append(data, parquetMagic...), nil
+}
+
+// appendPage appends a page of the type with the body to data, which is
+// compressed with the compression of c, and adds its sizes to c.
+func (o parquetOptions) appendPage(data []byte, c *parquetColumn, pageType, numValues, encoding int, body []byte) ([]byte, error) {
+	compressed, err := compressColumnar(c.compression, body)
+	if err != nil {
+		return nil, err
+	}
+	header := appendParquetPageHeader(nil, pageType, numValues, encoding, len(body), len(compressed))
+	c.uncompressedSize += int64(len(header) + len(body))
+	data = append(data, header...)
+	return append(data, compressed...), nil
+}
+
+// parquetValue returns the value in the column index i of row, or empty
+// if the row is short.
+func parquetValue(row []string, i int) string {
+	if i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// parquetDataPage returns the body of a data page of the values in the
+// column index i of rows, the definition levels followed by the non-null
+// values.
+func parquetDataPage(typ int, rows [][]string, i int) []byte {
+	page := parquetDefinitionLevels(rows, i)
+	for _, row := range rows {
+		if value := parquetValue(row, i); value != "" {
+			page = appendParquetPlain(page, typ, value)
+		}
+	}
+	return page
+}
+
+// parquetDefinitionLevels returns the definition levels of the values in
+// the column index i of rows, 0 for null and 1 otherwise, prefixed by
+// their size. They are encoded as runs of the RLE/bit-packing hybrid
+// encoding of bit width 1.
+func parquetDefinitionLevels(rows [][]string, i int) []byte {
+	var levels []byte
+	run, level := 0, byte(0)
+	for j, row := range rows {
+		l := byte(0)
+		if parquetValue(row, i) != "" {
+			l = 1
+		}
+		if j > 0 && l != level {
+			levels = appendUvarint(levels, uint64(run)<<1)
+			levels = append(levels, level)
+			run = 0
+		}
+		run, level = run+1, l
+	}
+	if run > 0 {
+		levels = appendUvarint(levels, uint64(run)<<1)
+		levels = append(levels, level)
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(levels)))
+	return append(size[:], levels...)
+}
+
+// appendParquetPlain appends value in the PLAIN encoding of typ.
+func appendParquetPlain(b []byte, typ int, value string) []byte {
+	var buf [8]byte
+	switch typ {
+	case parquetInt64:
+		v, _ := parseInt64Value(value)
+		binary.LittleEndian.PutUint64(buf[:], uint64(v))
+		return append(b, buf[:]...)
+	case parquetDouble:
+		v, _ := parseFloatValue(value)
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+		return append(b, buf[:]...)
+	default:
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(value)))
+		b = append(b, buf[:4]...)
+		return append(b, value...)
+	}
+}
+
+// parquetDictionary returns the body of the dictionary page of the
+// distinct non-null values in the column index i of rows in sorted
+// order, the number of them, and the indexes of the values in the
+// dictionary encoded as the values of a data page: the bit width
+// followed by runs of the RLE/bit-packing hybrid encoding.
+func parquetDictionary(typ int, rows [][]string, i int) (dict []byte, n int, indexes []byte) {
+	ids := make(map[string]int)
+	var values []string
+	for _, row := range rows {
+		if value := parquetValue(row, i); value != "" {
+			if _, ok := ids[value]; !ok {
+				ids[value] = 0
+				values = append(values, value)
+			}
+		}
+	}
+	sort.Strings(values)
+	for id, value := range values {
+		ids[value] = id
+		dict = appendParquetPlain(dict, typ, value)
+	}
+
+	width := bits.Len(uint(len(values) - 1))
+	if width == 0 {
+		width = 1
+	}
+	indexes = []byte{byte(width)}
+	run, id := 0, -1
+	flush := func() {
+		if run == 0 {
+			return
+		}
+		indexes = appendUvarint(indexes, uint64(run)<<1)
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(id))
+		indexes = append(indexes, buf[:(width+7)/8]...)
+	}
+	for _, row := range rows {
+		value := parquetValue(row, i)
+		if value == "" {
+			continue
+		}
+		if ids[value] != id {
+			flush()
+			run, id = 0, ids[value]
+		}
+		run++
+	}
+	flush()
+	return dict, len(values), indexes
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendParquetPageHeader(b []byte, pageType, numValues, encoding, size, compressedSize int) []byte {
+	t := thriftWriter{b: b}
+	t.i32(1, int32(pageType))
+	t.i32(2, int32(size))
+	t.i32(3, int32(compressedSize))
+	if pageType == parquetPageTypeDictionary {
+		t.beginStruct(7)
+		t.i32(1, int32(numValues))
+		t.i32(2, int32(encoding))
+	} else {
+		t.beginStruct(5)
+		t.i32(1, int32(numValues))
+		t.i32(2, int32(encoding))
+		t.i32(3, parquetRLE)
+		t.i32(4, parquetRLE)
+	}
+	t.endStruct()
+	t.endStruct()
+	return t.b
+}
+
+func appendParquetFileMetaData(b []byte, chunks []parquetColumn, numRows int) []byte {
+	t := thriftWriter{b: b}
+	t.i32(1, 1)
+	t.beginList(2, thriftStruct, len(chunks)+1)
+	t.beginElem()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(chunks)))
+	t.endStruct()
+	for _, c := range chunks {
+		t.beginElem()
+		t.i32(1, int32(c.typ))
+		t.i32(3, parquetOptional)
+		t.binary(4, c.name)
+		if c.typ == parquetByteArray {
+			t.i32(6, parquetUTF8)
+		}
+		t.endStruct()
+	}
+	t.i64(3, int64(numRows))
+	t.beginList(4, thriftStruct, 1)
+	t.beginElem()
+	t.beginList(1, thriftStruct, len(chunks))
+	var total int64
+	for _, c := range chunks {
+		total += c.size
+		t.beginElem()
+		t.i64(2, c.offset)
+		t.beginStruct(3)
+		t.i32(1, int32(c.typ))
+		if c.dictionary {
+			t.beginList(2, thriftI32, 3)
+			t.listI32(parquetPlain)
+			t.listI32(parquetRLE)
+			t.listI32(parquetRLEDictionary)
+		} else {
+			t.beginList(2, thriftI32, 2)
+			t.listI32(parquetPlain)
+			t.listI32(parquetRLE)
+		}
+		t.beginList(3, thriftBinary, 1)
+		t.listBinary(c.name)
+		t.i32(4, int32(c.compression.codec))
+		t.i64(5, int64(numRows))
+		t.i64(6, c.uncompressedSize)
+		t.i64(7, c.size)
+		t.i64(9, c.dataOffset)
+		if c.dictionary {
+			t.i64(11, c.offset)
+		}
+		t.endStruct()
+		t.endStruct()
+	}
+	t.i64(2, total)
+	t.i64(3, int64(numRows))
+	t.endStruct()
+	t.binary(6, toolName+" version "+toolVersion())
+	t.endStruct()
+	return t.b
+}
+
+// Types of the Thrift compact protocol.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes structs in the Thrift compact protocol, which is
+// used by the metadata of Parquet files. The fields of a struct must be
+// written in the order of their ids.
+type thriftWriter struct {
+	b []byte
+	// lastID is the id of the last field of the current struct, and
+	// stack has those of the enclosing structs.
+	lastID int
+	stack  []int
+}
+
+func (t *thriftWriter) field(id, typ int) {
+	if delta := id - t.lastID; delta > 0 && delta <= 15 {
+		t.b = append(t.b, byte(delta<<4|typ))
+	} else {
+		t.b = append(t.b, byte(typ))
+		t.b = appendUvarint(t.b, zigzag(int64(id)))
+	}
+	t.lastID = id
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func (t *thriftWriter) i32(id int, v int32) {
+	t.field(id, thriftI32)
+	t.b = appendUvarint(t.b, zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int, v int64) {
+	t.field(id, thriftI64)
+	t.b = appendUvarint(t.b, zigzag(v))
+}
+
+func (t *thriftWriter) binary(id int, s string) {
+	t.field(id, thriftBinary)
+	t.listBinary(s)
+}
+
+func (t *thriftWriter) beginStruct(id int) {
+	t.field(id, thriftStruct)
+	t.stack = append(t.stack, t.lastID)
+	t.lastID = 0
+}
+
+// beginElem begins a struct element of a list.
+func (t *thriftWriter) beginElem() {
+	t.stack = append(t.stack, t.lastID)
+	t.lastID = 0
+}
+
+// endStruct ends a struct begun by beginStruct or beginElem, or the top
+// level struct.
+func (t *thriftWriter) endStruct() {
+	t.b = append(t.b, 0)
+	if n := len(t.stack); n > 0 {
+		t.lastID = t.stack[n-1]
+		t.stack = t.stack[:n-1]
+	}
+}
+
+// beginList begins a list of n elements of the type, which are written
+// with listI32, listBinary or beginElem.
+func (t *thriftWriter) beginList(id, elemType, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.b = append(t.b, byte(n<<4|elemType))
+	} else {
+		t.b = append(t.b, byte(0xf0|elemType))
+		t.b = appendUvarint(t.b, uint64(n))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.b = appendUvarint(t.b, zigzag(int64(v)))
+}
+
+func (t *thriftWriter) listBinary(s string) {
+	t.b = appendUvarint(t.b, uint64(len(s)))
+	t.b = append(t.b, s...)
+}
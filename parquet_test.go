@@ -0,0 +1,428 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"flag"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParquetColumnType(t *testing.T) {
+	rows := [][]string{
+		{"[heap]", "4", "1.5", "rw-p", "", "0012"},
+		{"/usr/bin/cat", "8", "2", "r--p", ""},
+	}
+	testCases := []struct {
+		name string
+		want int
+	}{
+		{name: "Pathname", want: parquetByteArray},
+		{name: "Rss", want: parquetInt64},
+		{name: "Pss", want: parquetDouble},
+		{name: "Group", want: parquetByteArray},
+		{name: "Swap", want: parquetInt64},
+		{name: "Locked", want: parquetByteArray},
+	}
+	for i, tc := range testCases {
+		if got := parquetColumnType(tc.name, rows, i); got != tc.want {
+			t.Errorf("type mismatch of %s, got=%d, want=%d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBuildParquetFile(t *testing.T) {
+	columns := []string{"Pathname", "Rss", "Pss"}
+	rows := [][]string{
+		{"[heap]", "4", "1.5"},
+		{"", "", "2"},
+		{"/usr/bin/cat", "-8", ""},
+	}
+	data, err := buildParquetFile(columns, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := readTestParquetMetaData(t, data)
+	if got := meta[3]; got != int64(len(rows)) {
+		t.Errorf("num_rows mismatch, got=%v", got)
+	}
+	schema := meta[2].([]interface{})
+	if len(schema) != len(columns)+1 || schema[0].(map[int]interface{})[5] != int64(len(columns)) {
+		t.Fatalf("schema mismatch, got=%v", schema)
+	}
+	wantSchema := []map[int]interface{}{
+		{1: int64(parquetByteArray), 3: int64(parquetOptional), 4: "Pathname", 6: int64(parquetUTF8)},
+		{1: int64(parquetInt64), 3: int64(parquetOptional), 4: "Rss"},
+		{1: int64(parquetDouble), 3: int64(parquetOptional), 4: "Pss"},
+	}
+	for i, want := range wantSchema {
+		if got := schema[i+1]; !reflect.DeepEqual(got, want) {
+			t.Errorf("schema element mismatch, got=%v, want=%v", got, want)
+		}
+	}
+
+	rowGroup := meta[4].([]interface{})[0].(map[int]interface{})
+	chunks := rowGroup[1].([]interface{})
+	var got [][]interface{}
+	for i, chunk := range chunks {
+		cm := chunk.(map[int]interface{})[3].(map[int]interface{})
+		if path := cm[3].([]interface{}); !reflect.DeepEqual(path, []interface{}{columns[i]}) {
+			t.Errorf("path_in_schema mismatch, got=%v", path)
+		}
+		got = append(got, readTestParquetColumn(t, data, cm))
+	}
+	want := [][]interface{}{
+		{"[heap]", nil, "/usr/bin/cat"},
+		{int64(4), nil, int64(-8)},
+		{1.5, 2.0, nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("columns mismatch,\n got=%v,\nwant=%v", got, want)
+	}
+}
+
+func TestParquetOptions(t *testing.T) {
+	columns := []string{"Pathname", "Perms", "Rss"}
+	rows := [][]string{
+		{"/usr/bin/cat", "r--p", "4"},
+		{"/usr/bin/cat", "r-xp", "8"},
+		{"", "rw-p", "12"},
+		{"/usr/lib/libc.so.6", "r--p", "16"},
+		{"/usr/lib/libc.so.6", "r--p", "16"},
+		{"[heap]", "rw-p", ""},
+	}
+	want := [][]interface{}{
+		{"/usr/bin/cat", "/usr/bin/cat", nil, "/usr/lib/libc.so.6", "/usr/lib/libc.so.6", "[heap]"},
+		{"r--p", "r-xp", "rw-p", "r--p", "r--p", "rw-p"},
+		{int64(4), int64(8), int64(12), int64(16), int64(16), nil},
+	}
+	testCases := []struct {
+		name       string
+		opts       parquetOptions
+		dictionary []bool
+	}{
+		{name: "dictionary", opts: parquetOptions{dictionary: []string{"Pathname", "Perms"}}, dictionary: []bool{true, true, false}},
+		{name: "gzip", opts: parquetOptions{codec: parquetGzip, level: 9}, dictionary: []bool{false, false, false}},
+		{name: "dictionaryGzip", opts: parquetOptions{dictionary: []string{"Rss"}, codec: parquetGzip, level: 1}, dictionary: []bool{false, false, true}},
+		{name: "zstd", opts: parquetOptions{dictionary: []string{"Pathname"}, codec: parquetZstd, level: 19}, dictionary: []bool{true, false, false}},
+		{name: "columnCompressions", opts: parquetOptions{codec: parquetGzip, level: 6, columnCompressions: map[string]columnCompression{
+			"Pathname": {codec: parquetZstd, level: 3},
+			"Rss":      {codec: parquetUncompressed},
+		}}, dictionary: []bool{false, false, false}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.opts.build(columns, rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			meta := readTestParquetMetaData(t, data)
+			chunks := meta[4].([]interface{})[0].(map[int]interface{})[1].([]interface{})
+			for i, chunk := range chunks {
+				cm := chunk.(map[int]interface{})[3].(map[int]interface{})
+				codec := tc.opts.codec
+				if cc, ok := tc.opts.columnCompressions[columns[i]]; ok {
+					codec = cc.codec
+				}
+				if got := cm[4].(int64); got != int64(codec) {
+					t.Errorf("codec mismatch of %s, got=%d", columns[i], got)
+				}
+				_, hasDictionary := cm[11]
+				encodings := cm[2].([]interface{})
+				if hasDictionary != tc.dictionary[i] || (len(encodings) == 3) != tc.dictionary[i] {
+					t.Errorf("dictionary mismatch of %s, offset=%v, encodings=%v", columns[i], cm[11], encodings)
+				}
+				if got := readTestParquetColumn(t, data, cm); !reflect.DeepEqual(got, want[i]) {
+					t.Errorf("column %s mismatch,\n got=%v,\nwant=%v", columns[i], got, want[i])
+				}
+			}
+		})
+	}
+
+	if _, err := (parquetOptions{dictionary: []string{"Inode"}}).build(columns, rows); err == nil {
+		t.Error("unexpected success with a dictionary column not in the output")
+	}
+	if _, err := (parquetOptions{columnCompressions: map[string]columnCompression{"Inode": {}}}).build(columns, rows); err == nil {
+		t.Error("unexpected success with a compressed column not in the output")
+	}
+}
+
+func TestParseParquetCompression(t *testing.T) {
+	testCases := []struct {
+		input string
+		codec int
+		level int
+		err   bool
+	}{
+		{input: "none", codec: parquetUncompressed},
+		{input: "gzip", codec: parquetGzip, level: gzip.DefaultCompression},
+		{input: "gzip:9", codec: parquetGzip, level: 9},
+		{input: "gzip:10", err: true},
+		{input: "none:1", err: true},
+		{input: "zstd", codec: parquetZstd, level: 3},
+		{input: "zstd:19", codec: parquetZstd, level: 19},
+		{input: "zstd:23", err: true},
+		{input: "lz4", err: true},
+	}
+	for _, tc := range testCases {
+		codec, level, err := parseParquetCompression(tc.input)
+		if (err != nil) != tc.err || codec != tc.codec || level != tc.level {
+			t.Errorf("result mismatch of %q, got=%d,%d,%v", tc.input, codec, level, err)
+		}
+	}
+}
+
+func TestParseColumnCompressions(t *testing.T) {
+	got, err := parseColumnCompressions("-parquet-column-compression", "Pathname=zstd:19,Rss=none,Pss=gzip", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]columnCompression{
+		"Pathname": {codec: parquetZstd, level: 19},
+		"Rss":      {codec: parquetUncompressed},
+		"Pss":      {codec: parquetGzip, level: gzip.DefaultCompression},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch, got=%v, want=%v", got, want)
+	}
+	for _, s := range []string{"Pathname", "=zstd", "Pathname=lz4"} {
+		if _, err := parseColumnCompressions("-parquet-column-compression", s, true); err == nil {
+			t.Errorf("%q: got no error", s)
+		}
+	}
+	// Arrow supports no gzip.
+	if _, err := parseColumnCompressions("-arrow-column-compression", "Pss=gzip", false); err == nil {
+		t.Error("got no error of gzip")
+	}
+}
+
+func TestRunParquet(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-columns", "Pathname,Rss"}); err != nil {
+		t.Fatal(err)
+	}
+	a.format = outputFormatParquet
+	a.inputFilename = writeTestFile(t, testTotalsInput)
+	a.outputFilename = filepath.Join(t.TempDir(), "memory.parquet")
+	if err := a.validate(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(a); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(a.outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := readTestParquetMetaData(t, data)
+	if got := meta[3]; got != int64(3) {
+		t.Errorf("num_rows mismatch, got=%v", got)
+	}
+	if got := meta[6].(string); !strings.HasPrefix(got, toolName+" version ") {
+		t.Errorf("created_by mismatch, got=%q", got)
+	}
+}
+
+// readTestParquetMetaData reads the file metadata in the footer of a
+// Parquet file.
+func readTestParquetMetaData(t *testing.T, data []byte) map[int]interface{} {
+	t.Helper()
+	if !strings.HasPrefix(string(data), parquetMagic) || !strings.HasSuffix(string(data), parquetMagic) {
+		t.Fatal("missing magic")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	r := &testThriftReader{b: data[len(data)-8-size : len(data)-8]}
+	meta := r.readStruct()
+	if len(r.b) != 0 {
+		t.Fatalf("%d bytes left after the metadata", len(r.b))
+	}
+	return meta
+}
+
+// readTestParquetColumn reads the values of a column chunk with a single
+// data page of an optional column, which may follow a dictionary page.
+func readTestParquetColumn(t *testing.T, data []byte, cm map[int]interface{}) []interface{} {
+	t.Helper()
+	typ := cm[1].(int64)
+	var dict []interface{}
+	if offset, ok := cm[11].(int64); ok {
+		header, page := readTestParquetPage(t, data[offset:], cm[4].(int64))
+		dict = readTestParquetPlain(page, typ, int(header[7].(map[int]interface{})[1].(int64)))
+	}
+	header, page := readTestParquetPage(t, data[cm[9].(int64):], cm[4].(int64))
+	numValues := int(header[5].(map[int]interface{})[1].(int64))
+	n := binary.LittleEndian.Uint32(page)
+	levels, values := page[4:4+n], page[4+n:]
+	var nonNull []bool
+	for len(levels) > 0 {
+		run, k := binary.Uvarint(levels)
+		level := levels[k]
+		levels = levels[k+1:]
+		for i := 0; i < int(run>>1); i++ {
+			nonNull = append(nonNull, level == 1)
+		}
+	}
+	count := 0
+	for _, ok := range nonNull {
+		if ok {
+			count++
+		}
+	}
+	var nonNullValues []interface{}
+	if header[5].(map[int]interface{})[2].(int64) == parquetRLEDictionary {
+		width := int(values[0])
+		values = values[1:]
+		for len(values) > 0 {
+			run, k := binary.Uvarint(values)
+			var buf [8]byte
+			copy(buf[:], values[k:k+(width+7)/8])
+			values = values[k+(width+7)/8:]
+			for i := 0; i < int(run>>1); i++ {
+				nonNullValues = append(nonNullValues, dict[binary.LittleEndian.Uint64(buf[:])])
+			}
+		}
+	} else {
+		nonNullValues = readTestParquetPlain(values, typ, count)
+	}
+	if len(nonNull) != numValues || len(nonNullValues) != count {
+		t.Fatalf("invalid page of %d values and %d non-null values", len(nonNull), len(nonNullValues))
+	}
+	var got []interface{}
+	for _, ok := range nonNull {
+		if !ok {
+			got = append(got, nil)
+			continue
+		}
+		got = append(got, nonNullValues[0])
+		nonNullValues = nonNullValues[1:]
+	}
+	return got
+}
+
+// readTestParquetPage reads the header of a page at the start of b and
+// its body, decompressed with the codec.
+func readTestParquetPage(t *testing.T, b []byte, codec int64) (map[int]interface{}, []byte) {
+	t.Helper()
+	r := &testThriftReader{b: b}
+	header := r.readStruct()
+	page := r.b[:header[3].(int64)]
+	switch codec {
+	case parquetGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page, err = io.ReadAll(zr); err != nil {
+			t.Fatal(err)
+		}
+	case parquetZstd:
+		page = testZstdDecode(t, page)
+	}
+	if int64(len(page)) != header[2].(int64) {
+		t.Fatalf("uncompressed_page_size mismatch, got=%d, want=%d", len(page), header[2])
+	}
+	return header, page
+}
+
+// testZstdDecode returns the decompressed data of a zstd frame.
+func testZstdDecode(t *testing.T, data []byte) []byte {
+	t.Helper()
+	zr, err := decompressReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// readTestParquetPlain reads n values of typ in the PLAIN encoding.
+func readTestParquetPlain(values []byte, typ int64, n int) []interface{} {
+	var got []interface{}
+	for i := 0; i < n; i++ {
+		switch typ {
+		case parquetInt64:
+			got = append(got, int64(binary.LittleEndian.Uint64(values)))
+			values = values[8:]
+		case parquetDouble:
+			got = append(got, math.Float64frombits(binary.LittleEndian.Uint64(values)))
+			values = values[8:]
+		default:
+			size := binary.LittleEndian.Uint32(values)
+			got = append(got, string(values[4:4+size]))
+			values = values[4+size:]
+		}
+	}
+	return got
+}
+
+// testThriftReader reads the Thrift compact protocol into maps of field
+// ids for structs and slices for lists.
+type testThriftReader struct {
+	b []byte
+}
+
+func (r *testThriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *testThriftReader) readValue(typ int) interface{} {
+	switch typ {
+	case thriftI32, thriftI64:
+		v := r.uvarint()
+		return int64(v>>1) ^ -int64(v&1)
+	case thriftBinary:
+		n := r.uvarint()
+		s := string(r.b[:n])
+		r.b = r.b[n:]
+		return s
+	case thriftList:
+		header := r.b[0]
+		r.b = r.b[1:]
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.readValue(int(header & 0x0f))
+		}
+		return list
+	case thriftStruct:
+		return r.readStruct()
+	}
+	panic("unsupported thrift type")
+}
+
+func (r *testThriftReader) readStruct() map[int]interface{} {
+	fields := make(map[int]interface{})
+	id := 0
+	for {
+		header := r.b[0]
+		r.b = r.b[1:]
+		if header == 0 {
+			return fields
+		}
+		if delta := int(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			v := r.uvarint()
+			id = int(int64(v>>1) ^ -int64(v&1))
+		}
+		fields[id] = r.readValue(int(header & 0x0f))
+	}
+}
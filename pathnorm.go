@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Rules of -normalize-paths.
+const (
+	pathRuleSoVersion = "so-version"
+	pathRuleOverlayID = "overlay-id"
+	pathRuleProcFd    = "proc-fd"
+	pathRulesAll      = "all"
+)
+
+// pathRule replaces the matches of re in pathnames with replacement, which
+// can refer to the submatches as in regexp.ReplaceAllString.
+type pathRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// pathRuleNames are the names of the built-in rules in the order of
+// -normalize-paths all.
+var pathRuleNames = []string{pathRuleSoVersion, pathRuleOverlayID, pathRuleProcFd}
+
+// builtinPathRules are the rules of -normalize-paths by their names.
+var builtinPathRules = map[string][]pathRule{
+	// libfoo.so.1.2.3 becomes libfoo.so.
+	pathRuleSoVersion: {
+		{re: regexp.MustCompile(`(\.so)(\.[0-9]+)+$`), replacement: "$1"},
+	},
+	// The layers and snapshots of container runtimes, e.g.
+	// /var/lib/docker/overlay2/<64 hex digits>/merged/usr/lib/libc.so.6,
+	// become <id>, so that the files of the containers of an image are
+	// grouped together.
+	pathRuleOverlayID: {
+		{re: regexp.MustCompile(`/[0-9a-f]{64}(-init)?(/|$)`), replacement: "/<id>$2"},
+		{re: regexp.MustCompile(`/snapshots/[0-9]+(/|$)`), replacement: "/snapshots/<id>$1"},
+	},
+	// Files mapped by the paths of their file descriptors, e.g.
+	// /proc/1234/fd/5 or /dev/fd/5, become /proc/self/fd/<fd>.
+	pathRuleProcFd: {
+		{re: regexp.MustCompile(`^/proc/(self|thread-self|[0-9]+)(/task/[0-9]+)?/fd/[0-9]+$`), replacement: "/proc/self/fd/<fd>"},
+		{re: regexp.MustCompile(`^/dev/fd/[0-9]+$`), replacement: "/proc/self/fd/<fd>"},
+	},
+}
+
+// pathNormalizer rewrites the pathnames of regions by the rules of
+// -normalize-paths and -normalize-rule before they are grouped, so that
+// the aggregations are not fragmented by incidental differences of the
+// names of the same files.
+type pathNormalizer struct {
+	rules []pathRule
+}
+
+// newPathNormalizer returns the normalizer of the comma separated names of
+// the built-in rules and the rules of specs, regexp=>replacement, which are
+// applied in this order. It returns nil if there are no rules.
+func newPathNormalizer(names string, specs []string) (*pathNormalizer, error) {
+	n := &pathNormalizer{}
+	if names != "" {
+		for _, name := range strings.Split(names, ",") {
+			if name == pathRulesAll {
+				for _, name := range pathRuleNames {
+					n.rules = append(n.rules, builtinPathRules[name]...)
+				}
+				continue
+			}
+			rules, ok := builtinPathRules[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown rule %q of -normalize-paths, which must be %s or %s", name, strings.Join(pathRuleNames, ", "), pathRulesAll)
+			}
+			n.rules = append(n.rules, rules...)
+		}
+	}
+	for _, spec := range specs {
+		pattern, replacement, ok := strings.Cut(spec, "=>")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("-normalize-rule must be in the form regexp=>replacement: %q", spec)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -normalize-rule %q: %w", spec, err)
+		}
+		n.rules = append(n.rules, pathRule{re: re, replacement: replacement})
+	}
+	if len(n.rules) == 0 {
+		return nil, nil
+	}
+	return n, nil
+}
+
+// normalize returns pathname rewritten by the rules. The " (deleted)"
+// suffix is kept out of the matches, so that the rules anchored at the end
+// apply to deleted files too. Pseudo paths such as "[heap]" are returned
+// unchanged.
+func (n *pathNormalizer) normalize(pathname string) string {
+	if !strings.HasPrefix(pathname, "/") {
+		return pathname
+	}
+	deleted := strings.HasSuffix(pathname, deletedSuffix)
+	path := strings.TrimSuffix(pathname, deletedSuffix)
+	for _, r := range n.rules {
+		path = r.re.ReplaceAllString(path, r.replacement)
+	}
+	if deleted {
+		path += deletedSuffix
+	}
+	return path
+}
+
+// validatePathNormalization parses -normalize-paths and -normalize-rule.
+func (a *args) validatePathNormalization() error {
+	n, err := newPathNormalizer(a.normalizePaths, a.normalizeRuleSpecs)
+	if err != nil {
+		return err
+	}
+	a.pathNormalizer = n
+	return nil
+}
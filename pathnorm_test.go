@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestPathNormalizer(t *testing.T) {
+	n, err := newPathNormalizer(pathRulesAll, []string{`/build-[0-9]+/=>/build-N/`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		pathname string
+		want     string
+	}{
+		{pathname: "/usr/lib/libfoo.so.1.2.3", want: "/usr/lib/libfoo.so"},
+		{pathname: "/usr/lib/libssl.so.3 (deleted)", want: "/usr/lib/libssl.so (deleted)"},
+		{pathname: "/usr/lib/libfoo.so", want: "/usr/lib/libfoo.so"},
+		{pathname: "/usr/lib/libfoo.so.1.so.conf", want: "/usr/lib/libfoo.so.1.so.conf"},
+		{
+			pathname: "/var/lib/docker/overlay2/" + strings.Repeat("0123456789abcdef", 4) + "/merged/usr/lib/libc.so.6",
+			want:     "/var/lib/docker/overlay2/<id>/merged/usr/lib/libc.so",
+		},
+		{
+			pathname: "/var/lib/containerd/io.containerd.snapshotter.v1.overlayfs/snapshots/123/fs/usr/bin/app",
+			want:     "/var/lib/containerd/io.containerd.snapshotter.v1.overlayfs/snapshots/<id>/fs/usr/bin/app",
+		},
+		{pathname: "/proc/1234/fd/5", want: "/proc/self/fd/<fd>"},
+		{pathname: "/proc/self/task/12/fd/7", want: "/proc/self/fd/<fd>"},
+		{pathname: "/dev/fd/3", want: "/proc/self/fd/<fd>"},
+		{pathname: "/proc/1234/maps", want: "/proc/1234/maps"},
+		{pathname: "/tmp/build-42/app", want: "/tmp/build-N/app"},
+		{pathname: "[heap]", want: "[heap]"},
+		{pathname: "", want: ""},
+	} {
+		if got := n.normalize(tc.pathname); got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.pathname, got, tc.want)
+		}
+	}
+
+	if n, err := newPathNormalizer("", nil); n != nil || err != nil {
+		t.Errorf("got %v, %v without rules", n, err)
+	}
+	for _, tc := range []struct {
+		names string
+		specs []string
+	}{
+		{names: "so-version,unknown"},
+		{specs: []string{"/build-[0-9]+/"}},
+		{specs: []string{"=>x"}},
+		{specs: []string{"(=>x"}},
+	} {
+		if _, err := newPathNormalizer(tc.names, tc.specs); err == nil {
+			t.Errorf("%q, %q: got no error", tc.names, tc.specs)
+		}
+	}
+}
+
+func TestConvertNormalizePaths(t *testing.T) {
+	input := "7f0020000000-7f0020001000 r-xp 00000000 fe:00 42 /usr/lib/libssl.so.3.0.2\nRss: 4 kB\n" +
+		"7f0020001000-7f0020002000 r-xp 00000000 fe:00 43 /usr/lib/libssl.so.3.0.8\nRss: 8 kB\n" +
+		"7f0030000000-7f0030001000 rw-p 00000000 00:00 0 [heap]\nRss: 4 kB\n"
+	n, err := newPathNormalizer(pathRuleSoVersion, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", pathNormalizer: n, groupBy: groupByPathname, floatFormat: defaultFloatFormat, columns: []string{"Group", "Regions", "Rss"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "Group,Regions,Rss\n" +
+		"/usr/lib/libssl.so,2,12\n" +
+		"[heap],1,4\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const capSysPtrace = 19
+
+// diagnoseOpenError adds an explanation of the likely cause and a
+// suggested fix to err when opening a file of another process under
+// /proc failed with a permission error. Other errors are returned as is.
+func diagnoseOpenError(filename string, err error) error {
+	pid := pidFromProcPath(filename)
+	if pid == 0 {
+		return err
+	}
+	notExist := errors.Is(err, fs.ErrNotExist)
+	if !errors.Is(err, fs.ErrPermission) && !notExist {
+		return err
+	}
+
+	var hints []string
+	if notExist {
+		if opt := procHidepidOption(); opt != "" {
+			hints = append(hints, fmt.Sprintf("%s is mounted with %s, which hides processes of other users; "+
+				"run as root or as a member of the group given by the gid= mount option", procRoot, opt))
+		} else {
+			return err
+		}
+	} else {
+		if uid, ok := processOwner(pid); ok && uid != os.Geteuid() {
+			hints = append(hints, fmt.Sprintf("process %d is owned by uid %d but this tool runs as uid %d", pid, uid, os.Geteuid()))
+		}
+		if !hasEffectiveCapability(capSysPtrace) {
+			hints = append(hints, "reading smaps of other users' processes requires root or CAP_SYS_PTRACE, "+
+				"e.g. sudo setcap cap_sys_ptrace+ep /path/to/linuxprocsmapstocsv")
+		}
+		switch scope := readPtraceScope(); scope {
+		case 1:
+			hints = append(hints, "kernel.yama.ptrace_scope is 1, so only descendants can be inspected without CAP_SYS_PTRACE")
+		case 2:
+			hints = append(hints, "kernel.yama.ptrace_scope is 2, so only processes with CAP_SYS_PTRACE can inspect others")
+		case 3:
+			hints = append(hints, "kernel.yama.ptrace_scope is 3, so no process can be inspected until reboot")
+		}
+		if opt := procHidepidOption(); opt != "" {
+			hints = append(hints, fmt.Sprintf("%s is mounted with %s, which restricts access to other users' processes", procRoot, opt))
+		}
+	}
+	if len(hints) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w\nhint: %s", err, strings.Join(hints, "\nhint: "))
+}
+
+// readPtraceScope returns the value of kernel.yama.ptrace_scope, or -1
+// if Yama is not enabled.
+func readPtraceScope() int {
+	data, err := os.ReadFile(procSysPath("sys/kernel/yama/ptrace_scope"))
+	if err != nil {
+		return -1
+	}
+	scope, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return -1
+	}
+	return scope
+}
+
+// hasEffectiveCapability reports whether this process has the capability
+// in its effective set.
+func hasEffectiveCapability(capability uint) bool {
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		line := s.Text()
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		if err != nil {
+			return false
+		}
+		return caps&(1<<capability) != 0
+	}
+	return false
+}
+
+// procHidepidOption returns the hidepid option of the procfs mounted on
+// procRoot, e.g. "hidepid=invisible", or an empty string if it is not set.
+func procHidepidOption() string {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		// 22 27 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:13 - proc proc rw,hidepid=2
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 || fields[4] != filepath.Clean(procRoot) {
+			continue
+		}
+		for i := len(fields) - 1; i > 4; i-- {
+			if fields[i-2] == "-" && fields[i-1] == "proc" {
+				for _, opt := range strings.Split(fields[i], ",") {
+					if strings.HasPrefix(opt, "hidepid=") && opt != "hidepid=0" && opt != "hidepid=off" {
+						return opt
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
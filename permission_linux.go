@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// processOwner returns the uid owning the process of pid, or false if it
+// cannot be read.
+func processOwner(pid int) (int, bool) {
+	st, err := os.Stat(procPath(pid, ""))
+	if err != nil {
+		return 0, false
+	}
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(sys.Uid), true
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func processOwner(pid int) (int, bool) {
+	return 0, false
+}
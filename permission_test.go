@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestPidFromProcPath(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want int
+	}{
+		{in: "/proc/1234/smaps", want: 1234},
+		{in: "/proc/1234", want: 1234},
+		{in: "/proc/self/smaps", want: 0},
+		{in: "/tmp/1234/smaps", want: 0},
+	}
+	for _, tc := range testCases {
+		if got := pidFromProcPath(tc.in); got != tc.want {
+			t.Errorf("in=%s: result mismatch, got=%d, want=%d", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestPidFromProcPathAlternateRoot(t *testing.T) {
+	defer func(root string) { procRoot = root }(procRoot)
+	procRoot = "/host/proc/"
+	testCases := []struct {
+		in   string
+		want int
+	}{
+		{in: "/host/proc/1234/smaps", want: 1234},
+		{in: "/proc/1234/smaps", want: 0},
+		{in: "/host/proc/../1234/smaps", want: 0},
+	}
+	for _, tc := range testCases {
+		if got := pidFromProcPath(tc.in); got != tc.want {
+			t.Errorf("in=%s: result mismatch, got=%d, want=%d", tc.in, got, tc.want)
+		}
+	}
+	if got, want := pidFromSmapsPath("/host/proc/1234/smaps"), 1234; got != want {
+		t.Errorf("pid from smaps path mismatch, got=%d, want=%d", got, want)
+	}
+}
+
+func TestDiagnoseOpenErrorKeepsOtherErrors(t *testing.T) {
+	err := &fs.PathError{Op: "open", Path: "/tmp/smaps", Err: fs.ErrPermission}
+	if got := diagnoseOpenError("/tmp/smaps", err); got != error(err) {
+		t.Errorf("error for non-procfs path must be unchanged, got=%v", got)
+	}
+	err = &fs.PathError{Op: "open", Path: "/proc/1/smaps", Err: fs.ErrPermission}
+	if got := diagnoseOpenError("/proc/1/smaps", err); !errors.Is(got, fs.ErrPermission) {
+		t.Errorf("diagnosed error must wrap the original, got=%v", got)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writePlan prints the inputs which a run of args would read and the
+// outputs it would write to w, one per line, for -plan. Neither the
+// inputs are read nor the outputs created.
+func writePlan(args args, w io.Writer) {
+	filenames := args.inputFilenames
+	if !args.batch {
+		filenames = []string{args.inputFilename}
+	}
+	verb := "read"
+	if args.lint {
+		verb = "check"
+	}
+	var cp *checkpoint
+	if args.resume && !args.lint {
+		// An unreadable checkpoint is ignored here, as the run reports it.
+		cp, _ = openCheckpoint(args.checkpointDir, true)
+	}
+	if cp != nil {
+		filenames = cp.inputs(filenames)
+	}
+	for _, filename := range filenames {
+		from := ""
+		if cp != nil && cp.saved[filename] != "" {
+			from = " from the checkpoint"
+		}
+		fmt.Fprintf(w, "%s %s%s%s\n", verb, planInputName(filename), planProcess(filename), from)
+	}
+	if args.lint {
+		return
+	}
+	if args.interval > 0 {
+		count := "until interrupted"
+		if args.count > 0 {
+			count = fmt.Sprintf("%d times", args.count)
+		}
+		fmt.Fprintf(w, "sample every %s %s\n", args.interval, count)
+	}
+
+	output := args.outputFilename
+	switch {
+	case output == stdioName:
+		fmt.Fprintln(w, "write the standard output")
+	case args.appendOutput:
+		fmt.Fprintf(w, "append %s\n", output)
+	case args.splitsOutput():
+		fmt.Fprintf(w, "write %s, %s, ... split by -max-rows or -max-size\n", partFilename(output, 1), partFilename(output, 2))
+	default:
+		fmt.Fprintf(w, "write %s\n", output)
+	}
+	if output != stdioName && (args.writeMeta || args.versionMeta == versionMetadataSidecar) {
+		fmt.Fprintf(w, "write %s\n", metadataFilename(output))
+	}
+	for _, s := range args.sinks {
+		if s.network != "" {
+			fmt.Fprintf(w, "send %s to %s %s\n", s.format, s.network, s.address)
+		} else {
+			fmt.Fprintf(w, "write %s as %s\n", s.address, s.format)
+		}
+	}
+	for _, f := range []struct {
+		path, what string
+	}{
+		{path: args.totalsPath, what: "totals"},
+		{path: args.shmReportPath, what: "shared memory report"},
+		{path: args.compSwapPath, what: "compressed swap report"},
+		{path: args.lazyFreePath, what: "LazyFree report"},
+		{path: args.numaReportPath, what: "NUMA report"},
+		{path: args.summaryPath, what: "run summary"},
+		{path: args.teeRawPath, what: "raw input"},
+	} {
+		if f.path != "" {
+			fmt.Fprintf(w, "write %s (%s)\n", f.path, f.what)
+		}
+	}
+	for _, f := range []struct {
+		path, what string
+	}{
+		{path: args.growthLogPath, what: "growth log"},
+		{path: args.anomalyLogPath, what: "anomaly log"},
+	} {
+		if f.path != "" {
+			fmt.Fprintf(w, "append %s (%s)\n", f.path, f.what)
+		}
+	}
+	if args.checkpointDir != "" {
+		fmt.Fprintf(w, "save the inputs in the checkpoint %s until the run succeeds\n", args.checkpointDir)
+	}
+	if args.keepRawDir != "" {
+		fmt.Fprintf(w, "keep the raw inputs in %s\n", args.keepRawDir)
+	}
+	if args.dumpDir != "" {
+		fmt.Fprintf(w, "dump the memory of the matching regions into %s\n", args.dumpDir)
+	}
+}
+
+// planInputName returns the name of an input in the plan.
+func planInputName(filename string) string {
+	if filename == stdioName {
+		return "the standard input"
+	}
+	return filename
+}
+
+// planProcess returns the pid and the command name of the process of the
+// input filename in /proc as " (pid <pid>, <comm>)", which lacks the
+// command name if it is not readable, or empty if filename is not in
+// /proc.
+func planProcess(filename string) string {
+	pid := pidFromInputPath(filename)
+	if pid == 0 {
+		return ""
+	}
+	comm, err := readComm(pid)
+	if err != nil {
+		return fmt.Sprintf(" (pid %d)", pid)
+	}
+	return fmt.Sprintf(" (pid %d, %s)", pid, comm)
+}
+
+// writeFleetPlan prints the hosts which the fleet subcommand would
+// collect from and the output it would write to w for -plan, without
+// connecting to the hosts.
+func writeFleetPlan(w io.Writer, hosts, sshCommand []string, match, output string) {
+	processes := "all processes"
+	if match != "" {
+		processes = "processes matching " + match
+	}
+	for _, host := range hosts {
+		fmt.Fprintf(w, "collect %s from %s with %s\n", processes, host, strings.Join(sshCommand, " "))
+	}
+	if output == stdioName {
+		fmt.Fprintln(w, "write the standard output")
+	} else {
+		fmt.Fprintf(w, "write %s\n", output)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWritePlan(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	for _, pid := range []string{"10", "9"} {
+		if err := os.MkdirAll(filepath.Join(procRoot, pid), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(procRoot, pid, "smaps"), []byte(testSmapsSorted), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "9", "comm"), []byte("nginx\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	var a args
+	a.inputFilename = filepath.Join(procRoot, "[0-9]*", "smaps")
+	a.outputFilename = filepath.Join(dir, "out.csv")
+	a.maxRows = 100
+	a.writeMeta = true
+	a.shmReportPath = filepath.Join(dir, "shm.csv")
+	a.growthLogPath = filepath.Join(dir, "growth.csv")
+	if err := a.resolveInputs(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	writePlan(a, &buf)
+	want := "read " + filepath.Join(procRoot, "9", "smaps") + " (pid 9, nginx)\n" +
+		"read " + filepath.Join(procRoot, "10", "smaps") + " (pid 10)\n" +
+		"write " + filepath.Join(dir, "out.0001.csv") + ", " + filepath.Join(dir, "out.0002.csv") + ", ... split by -max-rows or -max-size\n" +
+		"write " + filepath.Join(dir, "out.csv.meta.json") + "\n" +
+		"write " + filepath.Join(dir, "shm.csv") + " (shared memory report)\n" +
+		"append " + filepath.Join(dir, "growth.csv") + " (growth log)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("plan mismatch,\n got=%q,\nwant=%q", got, want)
+	}
+	if _, err := os.Stat(a.outputFilename); !os.IsNotExist(err) {
+		t.Errorf("output is created, err=%v", err)
+	}
+
+	buf.Reset()
+	a.lint = true
+	writePlan(a, &buf)
+	want = "check " + filepath.Join(procRoot, "9", "smaps") + " (pid 9, nginx)\n" +
+		"check " + filepath.Join(procRoot, "10", "smaps") + " (pid 10)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("plan of -validate mismatch,\n got=%q,\nwant=%q", got, want)
+	}
+}
+
+func TestWriteFleetPlan(t *testing.T) {
+	var buf bytes.Buffer
+	writeFleetPlan(&buf, []string{"web1", "web2"}, []string{"ssh", "-o", "BatchMode=yes"}, "^nginx$", stdioName)
+	want := "collect processes matching ^nginx$ from web1 with ssh -o BatchMode=yes\n" +
+		"collect processes matching ^nginx$ from web2 with ssh -o BatchMode=yes\n" +
+		"write the standard output\n"
+	if got := buf.String(); got != want {
+		t.Errorf("plan mismatch,\n got=%q,\nwant=%q", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// dropPrivileges switches this process to the user given by name or
+// numeric uid, with the primary group of the user and no supplementary
+// groups. It does nothing unless running as root.
+func dropPrivileges(username string) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	u, err := lookupUser(username)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("unsupported uid %q of user %s", u.Uid, username)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("unsupported gid %q of user %s", u.Gid, username)
+	}
+	if uid == 0 {
+		return fmt.Errorf("user %s to drop privileges to must not be root", username)
+	}
+	return setUser(uid, gid)
+}
+
+// lookupUser looks up a user by name or numeric uid.
+func lookupUser(username string) (*user.User, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		if _, numErr := strconv.Atoi(username); numErr != nil {
+			return nil, err
+		}
+		return user.LookupId(username)
+	}
+	return u, nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// setUser switches this process to uid and gid without supplementary
+// groups.
+func setUser(uid, gid int) error {
+	// The order matters, as changing groups requires root.
+	if err := syscall.Setgroups(nil); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func setUser(uid, gid int) error {
+	return errors.New("-drop-privileges is supported only on Linux")
+}
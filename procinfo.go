@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// procRoot is the mount point of the procfs to read process and system
+// information from. It can be changed with -procfs, e.g. to the host's
+// procfs bind-mounted into a container.
+var procRoot = "/proc"
+
+// procPath returns the path of a file in the /proc/<pid> directory.
+func procPath(pid int, name string) string {
+	return filepath.Join(procRoot, strconv.Itoa(pid), name)
+}
+
+// procSysPath returns the path of a file of system information in procfs,
+// e.g. procSysPath("meminfo").
+func procSysPath(name string) string {
+	return filepath.Join(procRoot, name)
+}
+
+// pidFromProcPath returns the pid in a path like /proc/<pid>/..., or
+// zero if filename is not such a path.
+func pidFromProcPath(filename string) int {
+	rel, err := filepath.Rel(filepath.Clean(procRoot), filepath.Clean(filename))
+	if err != nil || !filepath.IsAbs(filename) {
+		return 0
+	}
+	pidStr, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// readComm returns the command name of the process.
+func readComm(pid int) (string, error) {
+	data, err := os.ReadFile(procPath(pid, "comm"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\n"), nil
+}
+
+// readCmdline returns the command line arguments of the process. It is
+// empty for kernel threads and zombie processes.
+func readCmdline(pid int) ([]string, error) {
+	data, err := os.ReadFile(procPath(pid, "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimRight(data, "\x00")
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return strings.Split(string(data), "\x00"), nil
+}
+
+// readNsPid returns the pid of the process as seen in its innermost pid
+// namespace, from the NSpid line of /proc/<pid>/status.
+func readNsPid(pid int) (int, error) {
+	data, err := os.ReadFile(procPath(pid, "status"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "NSpid:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "NSpid:"))
+		if len(fields) == 0 {
+			break
+		}
+		return strconv.Atoi(fields[len(fields)-1])
+	}
+	return 0, fmt.Errorf("no NSpid in status of process %d", pid)
+}
+
+// readUid returns the real uid of the process from the Uid line of
+// /proc/<pid>/status.
+func readUid(pid int) (int, error) {
+	data, err := os.ReadFile(procPath(pid, "status"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "Uid:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Uid:"))
+		if len(fields) == 0 {
+			break
+		}
+		return strconv.Atoi(fields[0])
+	}
+	return 0, fmt.Errorf("no Uid in status of process %d", pid)
+}
+
+// readCgroupPath returns the cgroup of the process from
+// /proc/<pid>/cgroup. The cgroup v2 path is preferred on hosts which also
+// mount cgroup v1 hierarchies, where the path of the first hierarchy is
+// returned otherwise.
+func readCgroupPath(pid int) (string, error) {
+	data, err := os.ReadFile(procPath(pid, "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	var path string
+	for _, line := range strings.Split(string(data), "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			return parts[2], nil
+		}
+		if path == "" {
+			path = parts[2]
+		}
+	}
+	if path == "" {
+		return "", fmt.Errorf("no cgroup of process %d", pid)
+	}
+	return path, nil
+}
+
+// liveProcessReader reads the smaps of a live process, which may exit
+// during the read. The kernel then ends the file early or fails the read
+// with ESRCH, which is turned into the end of the input.
+type liveProcessReader struct {
+	r   io.Reader
+	pid int
+	// exited is true if the process exited before the end of the input
+	// was read.
+	exited bool
+	// retry is the policy of reading again after a transient failure
+	// which returned no data, and failures counts the failed reads which
+	// were retried.
+	retry    retryPolicy
+	failures int
+}
+
+func (r *liveProcessReader) Read(p []byte) (int, error) {
+	var n int
+	var err error
+	failures, _ := r.retry.do(func(err error) bool {
+		return n == 0 && isTransientProcessError(err)
+	}, func() error {
+		n, err = r.r.Read(p)
+		return err
+	})
+	if err != nil {
+		// The last read is not retried, e.g. at the end of the input.
+		failures--
+	}
+	r.failures += failures
+	if errors.Is(err, syscall.ESRCH) {
+		r.exited = true
+		return n, io.EOF
+	}
+	if err == io.EOF {
+		if _, statErr := os.Stat(procPath(r.pid, "")); errors.Is(statErr, os.ErrNotExist) {
+			r.exited = true
+		}
+	}
+	return n, err
+}
+
+// Names of the columns of processInfo.
+const (
+	columnPid        = "Pid"
+	columnComm       = "Comm"
+	columnCmdline    = "Cmdline"
+	columnUid        = "Uid"
+	columnNsPid      = "NsPid"
+	columnCgroupPath = "CgroupPath"
+)
+
+// processInfo is information about the process of mappings written in
+// optional columns.
+type processInfo struct {
+	Pid        int
+	Comm       string
+	Cmdline    string
+	Uid        int
+	NsPid      int
+	CgroupPath string
+}
+
+// column returns the value of the column name.
+func (p *processInfo) column(name string) string {
+	if p == nil {
+		return ""
+	}
+	switch name {
+	case columnPid:
+		return strconv.Itoa(p.Pid)
+	case columnComm:
+		return p.Comm
+	case columnCmdline:
+		return p.Cmdline
+	case columnUid:
+		return strconv.Itoa(p.Uid)
+	case columnNsPid:
+		return strconv.Itoa(p.NsPid)
+	case columnCgroupPath:
+		return p.CgroupPath
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadNsPid(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("procfs is supported only on Linux")
+	}
+	nsPid, err := readNsPid(os.Getpid())
+	if err != nil {
+		t.Skip(err)
+	}
+	if nsPid <= 0 {
+		t.Errorf("pid in namespace must be positive, got=%d", nsPid)
+	}
+}
+
+func TestReadCgroupPath(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("procfs is supported only on Linux")
+	}
+	path, err := readCgroupPath(os.Getpid())
+	if err != nil {
+		t.Skip(err)
+	}
+	if !strings.HasPrefix(path, "/") {
+		t.Errorf("cgroup path must be absolute, got=%q", path)
+	}
+}
+
+func TestPrepareInputWithProcInfo(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	dir := filepath.Join(procRoot, "1234")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"comm":    "nginx\n",
+		"cmdline": "nginx: worker process\x00-g\x00daemon off;\x00",
+		"status":  "Name:\tnginx\nUid:\t33\t33\t33\t33\nGid:\t33\t33\t33\t33\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := args{withProcInfo: true, inputFilename: filepath.Join(dir, "smaps")}
+	if err := a.prepareInput(); err != nil {
+		t.Fatal(err)
+	}
+	want := &processInfo{Pid: 1234, Comm: "nginx", Cmdline: "nginx: worker process -g daemon off;", Uid: 33}
+	if *a.process != *want {
+		t.Errorf("process mismatch, got=%+v, want=%+v", *a.process, *want)
+	}
+}
+
+func TestMappingWriterProcessColumns(t *testing.T) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	mw := &mappingWriter{w: w, floatFormat: defaultFloatFormat, processColumns: []string{columnPid, columnNsPid, columnCgroupPath}}
+	m := &mapping{
+		Region:      &region{AddressStart: []byte("1000"), AddressEnd: []byte("2000")},
+		FieldNames:  []string{"Size"},
+		FieldValues: []string{"4"},
+		FieldUnits:  []string{"kB"},
+		Process:     &processInfo{Pid: 1234, NsPid: 1, CgroupPath: "/system.slice/a.service"},
+	}
+	if err := mw.write(m); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	want := "Pid,NsPid,CgroupPath,AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Size\n" +
+		"1234,1,/system.slice/a.service,1000,2000,,,,,,4\n"
+	if got := b.String(); got != want {
+		t.Errorf("output mismatch,\n got=%q,\nwant=%q", got, want)
+	}
+}
+
+func TestLiveProcessReader(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	if err := os.Mkdir(filepath.Join(procRoot, "1234"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name         string
+		r            io.Reader
+		pid          int
+		retry        retryPolicy
+		wantExited   bool
+		wantFailures int
+	}{
+		{name: "complete", r: strings.NewReader("data"), pid: 1234},
+		{name: "esrch", r: io.MultiReader(strings.NewReader("data"), iotest.ErrReader(syscall.ESRCH)), pid: 1234, wantExited: true},
+		{name: "gone", r: strings.NewReader("data"), pid: 5678, wantExited: true},
+		{name: "busy", r: &busyReader{r: strings.NewReader("data"), busy: 2}, pid: 1234, retry: retryPolicy{retries: 2}, wantFailures: 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &liveProcessReader{r: tc.r, pid: tc.pid, retry: tc.retry}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "data" {
+				t.Errorf("data mismatch, got=%q, want=%q", got, "data")
+			}
+			if r.exited != tc.wantExited {
+				t.Errorf("exited mismatch, got=%v, want=%v", r.exited, tc.wantExited)
+			}
+			if r.failures != tc.wantFailures {
+				t.Errorf("failures mismatch, got=%d, want=%d", r.failures, tc.wantFailures)
+			}
+		})
+	}
+}
+
+// busyReader fails the first busy reads with EAGAIN before reading r.
+type busyReader struct {
+	r    io.Reader
+	busy int
+}
+
+func (r *busyReader) Read(p []byte) (int, error) {
+	if r.busy > 0 {
+		r.busy--
+		return 0, syscall.EAGAIN
+	}
+	return r.r.Read(p)
+}
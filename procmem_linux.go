@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// readProcessMemory reads the memory of the process pid at addr into buf
+// using process_vm_readv(2). It returns the number of bytes read, which
+// may be less than len(buf) when the end of the readable memory is
+// reached.
+func readProcessMemory(pid int, addr uint64, buf []byte) (int, error) {
+	local := []unix.Iovec{{Base: &buf[0]}}
+	local[0].SetLen(len(buf))
+	remote := []unix.RemoteIovec{{Base: uintptr(addr), Len: len(buf)}}
+	n, err := unix.ProcessVMReadv(pid, local, remote, 0)
+	if err != nil {
+		if errors.Is(err, syscall.EPERM) {
+			return 0, fmt.Errorf("%w (reading another process's memory requires root or CAP_SYS_PTRACE)", err)
+		}
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func readProcessMemory(pid int, addr uint64, buf []byte) (int, error) {
+	return 0, errors.New("reading process memory is supported only on Linux")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pseudonymizer replaces identifying values with keyed hashes. The same
+// value always gets the same pseudonym within a run, so rows can still
+// be joined, while the salt prevents reversing pseudonyms of well-known
+// values by brute force.
+type pseudonymizer struct {
+	salt []byte
+}
+
+// newPseudonymizer returns a pseudonymizer using the hex encoded salt,
+// or a random salt if it is empty.
+func newPseudonymizer(salt string) (*pseudonymizer, error) {
+	if salt == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		return &pseudonymizer{salt: b}, nil
+	}
+	b, err := hex.DecodeString(salt)
+	if err != nil {
+		return nil, fmt.Errorf("salt must be hex encoded: %w", err)
+	}
+	return &pseudonymizer{salt: b}, nil
+}
+
+func (p *pseudonymizer) sum(value string) []byte {
+	mac := hmac.New(sha256.New, p.salt)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+func (p *pseudonymizer) hash(value string) string {
+	return hex.EncodeToString(p.sum(value)[:8])
+}
+
+// pid returns the pseudonym of a pid or a tid. It is a positive number
+// below 2^48, so that it stays exact in the integer columns of every
+// output format and in spreadsheets.
+func (p *pseudonymizer) pid(pid int) int {
+	return int(binary.BigEndian.Uint64(p.sum("pid:"+strconv.Itoa(pid)))>>16) + 1
+}
+
+// process returns a copy of the process information with the pids, the
+// command name, the command line and the cgroup pseudonymized.
+func (p *pseudonymizer) process(info *processInfo) *processInfo {
+	pseudonymized := *info
+	pseudonymized.Pid = p.pid(info.Pid)
+	if info.NsPid != 0 {
+		pseudonymized.NsPid = p.pid(info.NsPid)
+	}
+	if info.Comm != "" {
+		pseudonymized.Comm = p.hash(info.Comm)
+	}
+	if info.Cmdline != "" {
+		pseudonymized.Cmdline = p.hash(info.Cmdline)
+	}
+	pseudonymized.CgroupPath = p.pathname(info.CgroupPath)
+	return &pseudonymized
+}
+
+// pathname returns the pseudonym of a file pathname. Pseudo paths such
+// as "[heap]" are returned unchanged, and the " (deleted)" suffix is
+// kept.
+func (p *pseudonymizer) pathname(pathname string) string {
+	if !strings.HasPrefix(pathname, "/") {
+		return pathname
+	}
+	deleted := strings.HasSuffix(pathname, deletedSuffix)
+	pseudonym := "/" + p.hash(strings.TrimSuffix(pathname, deletedSuffix))
+	if deleted {
+		pseudonym += deletedSuffix
+	}
+	return pseudonym
+}
+
+// addressRebaser rewrites addresses relative to the start address of
+// the first region, hiding the absolute layout randomized by ASLR while
+// keeping region sizes and distances.
+type addressRebaser struct {
+	base    uint64
+	hasBase bool
+}
+
+func (b *addressRebaser) rebase(r *region) error {
+	start, end, err := r.addressRange()
+	if err != nil {
+		return err
+	}
+	if !b.hasBase {
+		b.base = start
+		b.hasBase = true
+	}
+	if start < b.base {
+		return fmt.Errorf("cannot rebase address %x below the start address %x of the first region", start, b.base)
+	}
+	r.AddressStart = []byte(fmt.Sprintf("%08x", start-b.base))
+	r.AddressEnd = []byte(fmt.Sprintf("%08x", end-b.base))
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPseudonymizerPathname(t *testing.T) {
+	p1, err := newPseudonymizer("00112233")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := newPseudonymizer("44556677")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/home/alice/app"
+	if got1, got2 := p1.pathname(path), p1.pathname(path); got1 != got2 {
+		t.Errorf("pseudonyms in a run mismatch, %s != %s", got1, got2)
+	}
+	if got1, got2 := p1.pathname(path), p2.pathname(path); got1 == got2 {
+		t.Errorf("pseudonyms with different salts must differ, got %s", got1)
+	}
+	if got, want := p1.pathname(path+" (deleted)"), p1.pathname(path)+" (deleted)"; got != want {
+		t.Errorf("deleted suffix mismatch, got=%s, want=%s", got, want)
+	}
+	if got, want := p1.pathname("[stack]"), "[stack]"; got != want {
+		t.Errorf("pseudo path mismatch, got=%s, want=%s", got, want)
+	}
+}
+
+func TestPseudonymizerProcess(t *testing.T) {
+	p, err := newPseudonymizer("00112233")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &processInfo{Pid: 1234, Comm: "nginx", Cmdline: "nginx -g daemon off;", Uid: 33, NsPid: 1, CgroupPath: "/system.slice/nginx.service"}
+	got := p.process(info)
+	if got.Pid != p.pid(1234) || got.NsPid != p.pid(1) || got.Pid == 1234 || got.NsPid == got.Pid {
+		t.Errorf("pids mismatch, got=%+v", got)
+	}
+	if got.Pid <= 0 || got.Pid > 1<<48 {
+		t.Errorf("pid pseudonym out of range, got=%d", got.Pid)
+	}
+	if got.Comm != p.hash("nginx") || got.Cmdline != p.hash(info.Cmdline) || got.CgroupPath != p.pathname(info.CgroupPath) {
+		t.Errorf("names mismatch, got=%+v", got)
+	}
+	if got.Uid != 33 || info.Pid != 1234 {
+		t.Errorf("uid must be kept and the original unchanged, got=%+v, original=%+v", got, info)
+	}
+}
+
+func TestPrepareInputPseudonymize(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	dir := filepath.Join(procRoot, "1234")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"comm":    "nginx\n",
+		"cmdline": "nginx\x00-g\x00daemon off;\x00",
+		"status":  "Name:\tnginx\nUid:\t33\t33\t33\t33\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := newPseudonymizer("00112233")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := args{withProcInfo: true, inputFilename: filepath.Join(dir, "smaps"), pseudonymizer: p}
+	if err := a.prepareInput(); err != nil {
+		t.Fatal(err)
+	}
+	want := processInfo{Pid: p.pid(1234), Comm: p.hash("nginx"), Cmdline: p.hash("nginx -g daemon off;"), Uid: 33}
+	if *a.process != want {
+		t.Errorf("process mismatch, got=%+v, want=%+v", *a.process, want)
+	}
+}
+
+func TestAddressRebaserRebase(t *testing.T) {
+	var b addressRebaser
+	r1 := &region{AddressStart: []byte("55d000"), AddressEnd: []byte("55e000")}
+	r2 := &region{AddressStart: []byte("7ffd0000"), AddressEnd: []byte("7ffd1000")}
+	for _, r := range []*region{r1, r2} {
+		if err := b.rebase(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := string(r1.AddressStart)+"-"+string(r1.AddressEnd), "00000000-00001000"; got != want {
+		t.Errorf("first region mismatch, got=%s, want=%s", got, want)
+	}
+	if got, want := string(r2.AddressStart)+"-"+string(r2.AddressEnd), "7fa73000-7fa74000"; got != want {
+		t.Errorf("second region mismatch, got=%s, want=%s", got, want)
+	}
+	if err := b.rebase(&region{AddressStart: []byte("1000"), AddressEnd: []byte("2000")}); err == nil {
+		t.Error("want error for address below base, got nil")
+	}
+}
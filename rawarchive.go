@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const rawManifestFilename = "manifest.json"
+
+// rawManifest lists the raw captures saved in a directory by -keep-raw.
+type rawManifest struct {
+	Captures []rawCapture `json:"captures"`
+}
+
+// rawCapture describes a raw capture saved as a gzip compressed file.
+type rawCapture struct {
+	File        string `json:"file"`
+	Source      string `json:"source"`
+	SHA256      string `json:"sha256"`
+	Size        int64  `json:"size"`
+	CaptureTime string `json:"capture_time,omitempty"`
+	ToolVersion string `json:"tool_version"`
+	Output      string `json:"output,omitempty"`
+}
+
+// rawArchiver saves the exact bytes written to it into a directory, so
+// that conversions can be re-run later.
+type rawArchiver struct {
+	dir    string
+	source string
+	buf    bytes.Buffer
+	gz     *gzip.Writer
+	hash   hash.Hash
+	size   int64
+}
+
+func newRawArchiver(dir, source string) (*rawArchiver, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	a := &rawArchiver{dir: dir, source: source, hash: sha256.New()}
+	a.gz = gzip.NewWriter(&a.buf)
+	return a, nil
+}
+
+func (a *rawArchiver) Write(p []byte) (int, error) {
+	a.hash.Write(p)
+	a.size += int64(len(p))
+	return a.gz.Write(p)
+}
+
+// finish writes the compressed capture, named after its SHA-256 digest,
+// and adds it to the manifest of the directory. The capture time is
+// omitted if it is zero.
+func (a *rawArchiver) finish(captureTime time.Time, output string) error {
+	if err := a.gz.Close(); err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(a.hash.Sum(nil))
+	c := rawCapture{
+		File:        sum[:16] + ".smaps.gz",
+		Source:      a.source,
+		SHA256:      sum,
+		Size:        a.size,
+		ToolVersion: toolVersion(),
+		Output:      output,
+	}
+	if !captureTime.IsZero() {
+		c.CaptureTime = captureTime.UTC().Format(time.RFC3339)
+	}
+	if err := os.WriteFile(filepath.Join(a.dir, c.File), a.buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+
+	m, err := readRawManifest(a.dir)
+	if err != nil {
+		return err
+	}
+	for _, existing := range m.Captures {
+		if existing == c {
+			return nil
+		}
+	}
+	m.Captures = append(m.Captures, c)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(a.dir, rawManifestFilename), append(data, '\n'), 0o644)
+}
+
+// readRawManifest reads the manifest in dir. It returns an empty
+// manifest if it does not exist yet.
+func readRawManifest(dir string) (*rawManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, rawManifestFilename))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &rawManifest{}, nil
+		}
+		return nil, err
+	}
+	var m rawManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
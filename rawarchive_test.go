@@ -0,0 +1,97 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRawArchiver(t *testing.T) {
+	dir := t.TempDir()
+	raw := "55d000-55e000 r--p 00000000 fe:00 1234 /usr/bin/cat\nRss: 4 kB\n"
+	for i := 0; i < 2; i++ {
+		a, err := newRawArchiver(dir, "/proc/1234/smaps")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(a, raw); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.finish(time.Time{}, "out.csv"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := readRawManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(m.Captures), 1; got != want {
+		t.Fatalf("identical captures must be recorded once, got=%d, want=%d", got, want)
+	}
+	c := m.Captures[0]
+	if c.Source != "/proc/1234/smaps" || c.Size != int64(len(raw)) {
+		t.Errorf("capture mismatch, got=%+v", c)
+	}
+
+	file, err := os.Open(filepath.Join(dir, c.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != raw {
+		t.Errorf("raw content mismatch,\n got=%q,\nwant=%q", got, raw)
+	}
+}
+
+func TestRunTeeRaw(t *testing.T) {
+	valid := "55d000-55e000 r--p 00000000 fe:00 1234 /usr/bin/cat\nRss: 4 kB\n"
+	testCases := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "valid", input: valid},
+		// The rest of the input after the error is copied too.
+		{name: "invalid", input: valid + "bad region: x\nRss: 8 kB\n" + valid, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			var a args
+			a.registerFlags(fs)
+			teePath := filepath.Join(dir, "raw.smaps")
+			if err := fs.Parse([]string{"-tee-raw", teePath}); err != nil {
+				t.Fatal(err)
+			}
+			a.inputFilename = writeTestFile(t, tc.input)
+			a.outputFilename = filepath.Join(dir, "out.csv")
+			if err := a.validate(fs); err != nil {
+				t.Fatal(err)
+			}
+			if err := run(a); (err != nil) != tc.wantErr {
+				t.Fatalf("error mismatch, got=%v, wantErr=%v", err, tc.wantErr)
+			}
+			got, err := os.ReadFile(teePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.input {
+				t.Errorf("raw input mismatch,\n got=%s,\nwant=%s", got, tc.input)
+			}
+		})
+	}
+}
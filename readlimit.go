@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// readLimiter limits the reads of the smaps files of the processes of a
+// batch, which hold the locks of their address spaces in the kernel while
+// they are read, so that scanning many processes does not contend with the
+// workloads being measured. At most concurrency files are read at once by
+// the workers of -jobs, and at most rate files are started per second.
+type readLimiter struct {
+	// slots is nil if the concurrency is not limited.
+	slots chan struct{}
+	// interval is zero if the rate is not limited.
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newReadLimiter returns a limiter of concurrency reads at once and rate
+// reads per second, either of which is not limited if zero. It returns nil
+// if neither is limited.
+func newReadLimiter(concurrency int, rate float64) *readLimiter {
+	if concurrency == 0 && rate == 0 {
+		return nil
+	}
+	l := &readLimiter{}
+	if concurrency > 0 {
+		l.slots = make(chan struct{}, concurrency)
+	}
+	if rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return l
+}
+
+// acquire waits until a file can be read, which must be followed by
+// release when it is read. It returns immediately if l is nil.
+func (l *readLimiter) acquire() {
+	if l == nil {
+		return
+	}
+	if l.slots != nil {
+		l.slots <- struct{}{}
+	}
+	if l.interval > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		at := l.next
+		if at.Before(now) {
+			at = now
+		}
+		l.next = at.Add(l.interval)
+		l.mu.Unlock()
+		if d := at.Sub(now); d > 0 {
+			time.Sleep(d)
+		}
+	}
+}
+
+func (l *readLimiter) release() {
+	if l == nil || l.slots == nil {
+		return
+	}
+	<-l.slots
+}
+
+// validateReadLimits checks -max-concurrent-reads and -max-reads-per-sec,
+// which limit the reads of the inputs of a batch.
+func (a *args) validateReadLimits() error {
+	switch {
+	case a.maxConcurrentReads < 0:
+		return errors.New("-max-concurrent-reads must not be negative")
+	case a.maxReadsPerSec < 0:
+		return errors.New("-max-reads-per-sec must not be negative")
+	case (a.maxConcurrentReads > 0 || a.maxReadsPerSec > 0) && !a.batch:
+		return errors.New("-max-concurrent-reads and -max-reads-per-sec require -p, -all-processes or a glob pattern of -i")
+	}
+	return nil
+}
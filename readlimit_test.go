@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadLimiterConcurrency(t *testing.T) {
+	l := newReadLimiter(2, 0)
+	var running, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.acquire()
+			defer l.release()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}()
+	}
+	wg.Wait()
+	if peak > 2 {
+		t.Errorf("got %d concurrent reads, want at most 2", peak)
+	}
+}
+
+func TestReadLimiterRate(t *testing.T) {
+	l := newReadLimiter(0, 100)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		l.acquire()
+		l.release()
+	}
+	// The first read starts immediately and the others 10ms apart.
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Errorf("5 reads at 100 per second took %v, want at least 40ms", d)
+	}
+
+	if l := newReadLimiter(0, 0); l != nil {
+		t.Errorf("got a limiter without limits")
+	}
+	// A nil limiter does not limit.
+	var nilLimiter *readLimiter
+	nilLimiter.acquire()
+	nilLimiter.release()
+}
+
+func TestValidateReadLimits(t *testing.T) {
+	for _, a := range []args{
+		{maxConcurrentReads: -1, batch: true},
+		{maxReadsPerSec: -1, batch: true},
+		{maxReadsPerSec: 10},
+	} {
+		if err := a.validateReadLimits(); err == nil {
+			t.Errorf("args=%+v: got no error", a)
+		}
+	}
+	for _, a := range []args{
+		{},
+		{maxConcurrentReads: 2, batch: true},
+		{maxReadsPerSec: 10, batch: true},
+	} {
+		if err := a.validateReadLimits(); err != nil {
+			t.Errorf("args=%+v: got error: %v", a, err)
+		}
+	}
+}
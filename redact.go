@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+const deletedSuffix = " (deleted)"
+
+// pathRedactor replaces components of file pathnames with hashes so that
+// captures can be shared without revealing the names.
+type pathRedactor struct {
+	// depth is the number of leading components which are kept as they
+	// are unless they match pattern.
+	depth   int
+	pattern *regexp.Regexp
+}
+
+func newPathRedactor(depth int, pattern string) (*pathRedactor, error) {
+	r := &pathRedactor{depth: depth}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.pattern = re
+	}
+	return r, nil
+}
+
+// redact returns pathname with the components beyond the depth or
+// matching the pattern replaced with hashes. Pseudo paths such as
+// "[heap]" are returned unchanged.
+func (r *pathRedactor) redact(pathname string) string {
+	if !strings.HasPrefix(pathname, "/") {
+		return pathname
+	}
+	deleted := strings.HasSuffix(pathname, deletedSuffix)
+	path := strings.TrimSuffix(pathname, deletedSuffix)
+	components := strings.Split(path[1:], "/")
+	for i, c := range components {
+		if i >= r.depth || r.pattern != nil && r.pattern.MatchString(c) {
+			components[i] = hashComponent(c)
+		}
+	}
+	redacted := "/" + strings.Join(components, "/")
+	if deleted {
+		redacted += deletedSuffix
+	}
+	return redacted
+}
+
+// hashComponent returns a short hash of the path component c. The same
+// component always gets the same hash so that redacted paths can still
+// be grouped.
+func hashComponent(c string) string {
+	sum := sha256.Sum256([]byte(c))
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestPathRedactorRedact(t *testing.T) {
+	h := hashComponent
+	testCases := []struct {
+		depth   int
+		pattern string
+		in      string
+		want    string
+	}{
+		{depth: 2, in: "/home/alice/app/data.bin", want: "/home/alice/" + h("app") + "/" + h("data.bin")},
+		{depth: 2, in: "/usr/lib/libc.so.6", want: "/usr/lib/" + h("libc.so.6")},
+		{depth: 1, in: "/tmp/x (deleted)", want: "/tmp/" + h("x") + " (deleted)"},
+		{depth: 3, pattern: "^acme", in: "/srv/acme-corp/bin", want: "/srv/" + h("acme-corp") + "/bin"},
+		{depth: 0, in: "[heap]", want: "[heap]"},
+		{depth: 0, in: "", want: ""},
+	}
+	for _, tc := range testCases {
+		r := &pathRedactor{depth: tc.depth}
+		if tc.pattern != "" {
+			r.pattern = regexp.MustCompile(tc.pattern)
+		}
+		if got := r.redact(tc.in); got != tc.want {
+			t.Errorf("in=%q: result mismatch,\n got=%q,\nwant=%q", tc.in, got, tc.want)
+		}
+	}
+}
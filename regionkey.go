@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Components of the RegionKey column given by -region-key-components.
+// Addresses are not components, since ASLR moves them in each run.
+const (
+	regionKeyPathname = "pathname"
+	regionKeyPerms    = "perms"
+	regionKeyOffset   = "offset"
+	regionKeySize     = "size"
+	regionKeyDev      = "dev"
+	regionKeyInode    = "inode"
+)
+
+const defaultRegionKeyComponents = "pathname,perms,offset,size"
+
+// parseRegionKeyComponents parses a comma separated list of components.
+func parseRegionKeyComponents(s string) ([]string, error) {
+	var components []string
+	for _, c := range strings.Split(s, ",") {
+		switch c = strings.TrimSpace(c); c {
+		case regionKeyPathname, regionKeyPerms, regionKeyOffset, regionKeySize, regionKeyDev, regionKeyInode:
+			components = append(components, c)
+		default:
+			return nil, fmt.Errorf("unsupported -region-key-components: %q", c)
+		}
+	}
+	return components, nil
+}
+
+// regionKeyer computes the RegionKey of the regions of an input, which is
+// a hash of the components of each region, so that a region has the same
+// key in the snapshots of a process as long as its components stay the
+// same.
+type regionKeyer struct {
+	components []string
+	// seen counts the regions of each hash so far. Regions with the same
+	// components, e.g. anonymous regions of the same size, are told apart
+	// by their order, the n-th of them having n hashed too.
+	seen map[uint64]int
+}
+
+func newRegionKeyer(components []string) *regionKeyer {
+	return &regionKeyer{components: components, seen: make(map[uint64]int)}
+}
+
+// key returns the key of r, whose pathname is that of the output, e.g.
+// anonymized by -pseudonymize, so that the key does not reveal it.
+func (k *regionKeyer) key(r *region, pathname string) string {
+	h := fnv.New64a()
+	for _, c := range k.components {
+		switch c {
+		case regionKeyPathname:
+			h.Write([]byte(pathname))
+		case regionKeyPerms:
+			h.Write(r.Perms)
+		case regionKeyOffset:
+			h.Write(r.Offset)
+		case regionKeySize:
+			h.Write([]byte(regionSize(r, false)))
+		case regionKeyDev:
+			h.Write(r.Dev)
+		case regionKeyInode:
+			h.Write(r.Inode)
+		}
+		// The separator tells apart e.g. "ab"+"c" and "a"+"bc".
+		h.Write([]byte{0})
+	}
+	sum := h.Sum64()
+	n := k.seen[sum]
+	k.seen[sum] = n + 1
+	if n > 0 {
+		h.Write([]byte(strconv.Itoa(n)))
+		sum = h.Sum64()
+	}
+	return fmt.Sprintf("%016x", sum)
+}
+
+// validateRegionKey checks -region-key and -region-key-components, and
+// parses the components.
+func (a *args) validateRegionKey() error {
+	if !a.regionKey {
+		if a.regionKeyComponents != "" {
+			return errors.New("-region-key-components requires -region-key")
+		}
+		return nil
+	}
+	s := a.regionKeyComponents
+	if s == "" {
+		s = defaultRegionKeyComponents
+	}
+	components, err := parseRegionKeyComponents(s)
+	if err != nil {
+		return err
+	}
+	a.regionKeyParts = components
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestConvertRegionKey(t *testing.T) {
+	// The second snapshot has the same regions moved by ASLR.
+	snapshots := []string{
+		"55d000-55e000 r--p 00000000 fe:00 1234 /usr/bin/cat\nRss: 4 kB\n" +
+			"7f0000000000-7f0000001000 rw-p 00000000 00:00 0 \nRss: 4 kB\n" +
+			"7f0000002000-7f0000003000 rw-p 00000000 00:00 0 \nRss: 0 kB\n",
+		"5a1000-5a2000 r--p 00000000 fe:00 1234 /usr/bin/cat\nRss: 4 kB\n" +
+			"7f1000000000-7f1000001000 rw-p 00000000 00:00 0 \nRss: 4 kB\n" +
+			"7f1000004000-7f1000005000 rw-p 00000000 00:00 0 \nRss: 4 kB\n",
+	}
+	var keys [][]string
+	for _, input := range snapshots {
+		var buf bytes.Buffer
+		if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input), args{Separator: ",", regionKey: true, regionKeyParts: []string{regionKeyPathname, regionKeyPerms, regionKeyOffset, regionKeySize}}); err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := strings.Join(records[0], ","), "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,RegionKey,Rss"; got != want {
+			t.Fatalf("header mismatch, got=%s, want=%s", got, want)
+		}
+		var k []string
+		for _, record := range records[1:] {
+			k = append(k, record[7])
+		}
+		keys = append(keys, k)
+	}
+	for i := range keys[0] {
+		if len(keys[0][i]) != 16 || keys[0][i] != keys[1][i] {
+			t.Errorf("keys of region %d = %q and %q, want the same 16 hex digits", i, keys[0][i], keys[1][i])
+		}
+	}
+	if keys[0][1] == keys[0][2] {
+		t.Errorf("regions with the same components have the same key %q", keys[0][1])
+	}
+}
+
+func TestRegionKeyerComponents(t *testing.T) {
+	r1 := &region{AddressStart: []byte("1000"), AddressEnd: []byte("2000"), Perms: []byte("r--p"), Inode: []byte("1")}
+	r2 := &region{AddressStart: []byte("5000"), AddressEnd: []byte("7000"), Perms: []byte("r--p"), Inode: []byte("2")}
+	if k1, k2 := newRegionKeyer([]string{regionKeyPerms}).key(r1, "/a"), newRegionKeyer([]string{regionKeyPerms}).key(r2, "/a"); k1 != k2 {
+		t.Errorf("keys by perms differ, got %q and %q", k1, k2)
+	}
+	if k1, k2 := newRegionKeyer([]string{regionKeyPerms, regionKeySize}).key(r1, "/a"), newRegionKeyer([]string{regionKeyPerms, regionKeySize}).key(r2, "/a"); k1 == k2 {
+		t.Errorf("keys of regions of different sizes are the same %q", k1)
+	}
+	if k1, k2 := newRegionKeyer([]string{regionKeyPathname}).key(r1, "/a"), newRegionKeyer([]string{regionKeyPathname}).key(r1, "/b"); k1 == k2 {
+		t.Errorf("keys of different pathnames are the same %q", k1)
+	}
+}
+
+func TestValidateRegionKey(t *testing.T) {
+	a := args{regionKey: true}
+	if err := a.validateRegionKey(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(a.regionKeyParts, ","), defaultRegionKeyComponents; got != want {
+		t.Errorf("default components = %s, want %s", got, want)
+	}
+	for _, a := range []args{
+		{regionKeyComponents: "pathname"},
+		{regionKey: true, regionKeyComponents: "pathname,address"},
+	} {
+		if err := a.validateRegionKey(); err == nil {
+			t.Errorf("args=%+v: got no error", a)
+		}
+	}
+}
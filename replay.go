@@ -0,0 +1,141 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runReplay runs the replay subcommand, which converts the raw captures
+// saved by -keep-raw again with the given conversion options.
+func runReplay(arguments []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s replay -raw <dir> -o <dir> [conversion options]\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	var args args
+	rawDir := fs.String("raw", "", "directory of raw captures saved by -keep-raw")
+	outputDir := fs.String("o", "", "directory to write the converted CSV files to")
+	args.registerFlags(fs)
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if *rawDir == "" || *outputDir == "" {
+		fs.Usage()
+		return errors.New("both flags -raw and -o must be set")
+	}
+	if err := args.validate(fs); err != nil {
+		return err
+	}
+	if len(args.sinks) > 0 {
+		return errors.New("-sink is not supported by replay")
+	}
+	if args.lockFilename != "" {
+		lock, err := acquireLock(args.lockFilename)
+		if err != nil {
+			return err
+		}
+		defer lock.release()
+	}
+	if err := args.prepare(); err != nil {
+		return err
+	}
+
+	startTime := time.Now()
+	args.stats = &runStats{}
+	err := replayAll(args, *rawDir, *outputDir)
+	if args.summaryPath != "" {
+		s := newRunSummary(args.stats, time.Since(startTime), err)
+		if err := writeSummary(args.summaryPath, s, args.outputFileOptions); err != nil {
+			log.Printf("warning: write summary: %v", err)
+		}
+	}
+	if err == nil && args.printStats {
+		fmt.Fprintln(os.Stderr, args.stats.humanSummary(time.Since(startTime)))
+	}
+	return err
+}
+
+// replayAll converts all raw captures in rawDir to CSV files in outputDir.
+func replayAll(args args, rawDir, outputDir string) error {
+	m, err := readRawManifest(rawDir)
+	if err != nil {
+		return err
+	}
+	if len(m.Captures) == 0 {
+		return fmt.Errorf("no raw captures in %s", rawDir)
+	}
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return err
+	}
+	for _, c := range m.Captures {
+		outputFilename := filepath.Join(outputDir, strings.TrimSuffix(c.File, ".smaps.gz")+".csv")
+		if err := replayCapture(args, rawDir, c, outputFilename); err != nil {
+			return fmt.Errorf("replay %s: %w", c.File, err)
+		}
+		log.Printf("converted %s (%s) to %s", c.File, c.Source, outputFilename)
+	}
+	return nil
+}
+
+func replayCapture(args args, rawDir string, c rawCapture, outputFilename string) error {
+	if args.stats == nil {
+		args.stats = &runStats{}
+	}
+	file, err := os.Open(filepath.Join(rawDir, c.File))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+
+	w, err := createOutput(args, outputFilename)
+	if err != nil {
+		return err
+	}
+	defer w.Abort()
+
+	if args.anomalyLogPath != "" {
+		args.anomalies, err = openAnomalyLog(args.anomalyLogPath, c.File, !args.reproducible)
+		if err != nil {
+			return err
+		}
+		defer args.anomalies.Close()
+	} else {
+		args.anomalies = &anomalyLog{file: c.File}
+	}
+	defer func() { args.stats.warnings += args.anomalies.count }()
+
+	args.stats.inputFiles = append(args.stats.inputFiles, filepath.Join(rawDir, c.File))
+	// The capture time comes from the manifest, while the host running
+	// the replay is unrelated to the capture.
+	args.captureTime, _ = time.Parse(time.RFC3339, c.CaptureTime)
+	if err := convertSmapsToCsv(w, countingReader{r: gz, n: &args.stats.bytesRead}, args); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	args.stats.outputFiles = append(args.stats.outputFiles, w.Files()...)
+
+	if args.writeMeta || args.versionMeta == versionMetadataSidecar {
+		md := newCaptureMetadata(args.captureTime, nil)
+		md.Hostname = ""
+		md.KernelVersion = ""
+		if err := writeMetadataFile(metadataFilename(outputFilename), md, args.outputFileOptions); err != nil {
+			return err
+		}
+		args.stats.outputFiles = append(args.stats.outputFiles, metadataFilename(outputFilename))
+	}
+	return nil
+}
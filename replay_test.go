@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunReplay(t *testing.T) {
+	rawDir := t.TempDir()
+	a, err := newRawArchiver(rawDir, "/proc/1234/smaps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nSize: 8 kB\nRss: 4 kB\n"
+	if _, err := io.WriteString(a, raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.finish(time.Time{}, "out.csv"); err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := t.TempDir()
+	if err := runReplay([]string{"-raw", rawDir, "-o", outputDir, "-fields-file", writeTestFile(t, "Rss\n")}); err != nil {
+		t.Fatal(err)
+	}
+	matches, err := filepath.Glob(filepath.Join(outputDir, "*.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("output file count mismatch, got=%d, want=1", len(matches))
+	}
+	got, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Rss\n" +
+		"55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func writeTestFile(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
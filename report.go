@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// config is the configuration file of the tool in JSON.
+type config struct {
+	// Reports are the named report presets run by the report subcommand.
+	Reports map[string]reportPreset `json:"reports"`
+}
+
+// reportPreset is a named set of options of a report. Empty options are
+// not set, and Args are added after the others, e.g. ["-true-cost"].
+type reportPreset struct {
+	Description string   `json:"description,omitempty"`
+	FilterPerms string   `json:"filter_perms,omitempty"`
+	FilterPath  string   `json:"filter_path,omitempty"`
+	MinRss      float64  `json:"min_rss,omitempty"`
+	GroupBy     string   `json:"group_by,omitempty"`
+	Subtotals   string   `json:"subtotals,omitempty"`
+	Columns     string   `json:"columns,omitempty"`
+	Sort        string   `json:"sort,omitempty"`
+	SortBy      string   `json:"sort_by,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	Args        []string `json:"args,omitempty"`
+}
+
+// builtinReports are the report presets available without a
+// configuration file, for the most common investigations. A preset of the
+// same name in the configuration file overrides them.
+var builtinReports = map[string]reportPreset{
+	"swap": {
+		Description: "swapped out memory by pathname, sorted by Swap",
+		GroupBy:     groupByPathname,
+		Columns:     "Group,Regions,Swap,SwapPss",
+		SortBy:      "Swap:desc",
+	},
+	"hugepages": {
+		Description: "memory mapped with transparent huge pages by pathname, sorted by their sum",
+		GroupBy:     groupByPathname,
+		Columns:     "Group,Regions,AnonHugePages,ShmemPmdMapped,FilePmdMapped,HugePages",
+		SortBy:      "HugePages:desc",
+		Args:        []string{"-derive", "HugePages=AnonHugePages+ShmemPmdMapped+FilePmdMapped"},
+	},
+}
+
+// arguments returns the command line flags of the preset.
+func (p reportPreset) arguments() []string {
+	var arguments []string
+	add := func(name, value string) {
+		if value != "" {
+			arguments = append(arguments, "-"+name, value)
+		}
+	}
+	add("filter-perms", p.FilterPerms)
+	add("filter-path", p.FilterPath)
+	if p.MinRss != 0 {
+		add("min-rss", strconv.FormatFloat(p.MinRss, 'f', -1, 64))
+	}
+	add("group-by", p.GroupBy)
+	add("subtotals", p.Subtotals)
+	add("columns", p.Columns)
+	add("sort", p.Sort)
+	add("sort-by", p.SortBy)
+	add("format", p.Format)
+	return append(arguments, p.Args...)
+}
+
+// defaultConfigPath returns the default path of the configuration file,
+// e.g. ~/.config/linuxprocsmapstocsv/config.json.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, toolName, "config.json")
+}
+
+func readConfig(filename string) (*config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	// Unknown keys are rejected as they are likely misspelled options.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var c config
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", filename, err)
+	}
+	return &c, nil
+}
+
+// reportArguments parses the arguments of the report subcommand and
+// returns the command line of the conversion with the flags of the
+// preset followed by the remaining arguments, which override them.
+func reportArguments(arguments []string) ([]string, error) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s report [-config <file>] <name> [flags of the conversion]\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", defaultConfigPath(), "configuration file in JSON with report presets in \"reports\", which may be omitted for the built-in reports \"swap\" and \"hugepages\"")
+	if err := fs.Parse(arguments); err != nil {
+		return nil, err
+	}
+	configSet := false
+	fs.Visit(func(f *flag.Flag) {
+		configSet = configSet || f.Name == "config"
+	})
+	// Without a configuration file, only the built-in reports are
+	// available, unless -config is set to a missing file by mistake.
+	c := &config{}
+	if *configPath != "" {
+		var err error
+		c, err = readConfig(*configPath)
+		if errors.Is(err, os.ErrNotExist) && !configSet {
+			c = &config{}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return nil, fmt.Errorf("report name must be given, one of: %s", strings.Join(c.reportNames(), ", "))
+	}
+	name := fs.Arg(0)
+	p, ok := c.Reports[name]
+	if !ok {
+		p, ok = builtinReports[name]
+	}
+	if !ok {
+		return nil, fmt.Errorf("report %q is neither built in nor defined in %s", name, *configPath)
+	}
+	return append(p.arguments(), fs.Args()[1:]...), nil
+}
+
+// reportNames returns the sorted names of the report presets, including
+// the built-in ones.
+func (c *config) reportNames() []string {
+	names := make([]string, 0, len(c.Reports)+len(builtinReports))
+	for name := range c.Reports {
+		names = append(names, name)
+	}
+	for name := range builtinReports {
+		if _, ok := c.Reports[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
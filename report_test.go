@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfig = `{
+  "reports": {
+    "libs": {
+      "description": "shared libraries by Pss",
+      "filter_path": "\\.so",
+      "min_rss": 4,
+      "group_by": "basename",
+      "columns": "Group,Regions,Pss",
+      "sort": "truecost",
+      "format": "ndjson",
+      "args": ["-true-cost"]
+    },
+    "heap": {"filter_path": "^\\[heap\\]$"}
+  }
+}`
+
+func TestReportArguments(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(testConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := reportArguments([]string{"-config", configPath, "libs", "-p", "1", "-format", "csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"-filter-path", `\.so`, "-min-rss", "4", "-group-by", "basename", "-columns", "Group,Regions,Pss",
+		"-sort", "truecost", "-format", "ndjson", "-true-cost", "-p", "1", "-format", "csv",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch,\n got=%q,\nwant=%q", got, want)
+	}
+
+	if _, err := reportArguments([]string{"-config", configPath}); err == nil || !strings.Contains(err.Error(), "heap, hugepages, libs, swap") {
+		t.Errorf("want an error listing the reports, got=%v", err)
+	}
+	if _, err := reportArguments([]string{"-config", configPath, "stack"}); err == nil {
+		t.Error("want an error for an undefined report")
+	}
+}
+
+func TestReadConfigUnknownKey(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"reports": {"libs": {"group-by": "basename"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readConfig(configPath); err == nil {
+		t.Error("want an error for an unknown key")
+	}
+}
+
+func TestReportArgumentsBuiltin(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	got, err := reportArguments([]string{"swap", "-p", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-group-by", "pathname", "-columns", "Group,Regions,Swap,SwapPss", "-sort-by", "Swap:desc", "-p", "1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch,\n got=%q,\nwant=%q", got, want)
+	}
+
+	// A preset of the configuration file overrides the built-in one.
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"reports": {"swap": {"columns": "Pathname,Swap"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = reportArguments([]string{"-config", configPath, "swap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"-columns", "Pathname,Swap"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch,\n got=%q,\nwant=%q", got, want)
+	}
+
+	if _, err := reportArguments([]string{"-config", filepath.Join(t.TempDir(), "missing.json"), "swap"}); err == nil {
+		t.Error("want an error for a missing file of -config")
+	}
+}
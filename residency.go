@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// mincoreColumns are the columns added by -mincore.
+var mincoreColumns = []string{"CachedPages"}
+
+// cachedPagesValue returns the value of the CachedPages column, which is
+// empty if the residency is unknown, e.g. of anonymous regions.
+func cachedPagesValue(pages *int64) string {
+	if pages == nil {
+		return ""
+	}
+	return strconv.FormatInt(*pages, 10)
+}
+
+// isFileBacked reports whether r maps a file which may still be opened by
+// its pathname, i.e. not an anonymous region, a pseudo-path like [heap]
+// or a deleted file.
+func isFileBacked(r *region) bool {
+	pathname := string(r.Pathname)
+	return strings.HasPrefix(pathname, "/") && string(r.Inode) != "0" && !strings.HasSuffix(pathname, " (deleted)")
+}
+
+// regionCachedPages returns the number of the pages of the file mapped by
+// the file-backed region r which are in the page cache, or nil for other
+// regions. The file is opened by the host path of -host-paths if there
+// is one, so that the files of a container are found.
+//
+// Unlike -pagemap, it needs no access to the process, only to read the
+// file, and counts the pages cached for any process rather than mapped
+// by this one.
+func regionCachedPages(r *region) (*int64, error) {
+	if !isFileBacked(r) {
+		return nil, nil
+	}
+	start, end, err := r.addressRange()
+	if err != nil {
+		return nil, err
+	}
+	offset, err := strconv.ParseInt(string(r.Offset), 16, 64)
+	if err != nil {
+		return nil, err
+	}
+	name := string(r.Pathname)
+	if len(r.HostPath) > 0 {
+		name = string(r.HostPath)
+	}
+	pages, err := cachedFilePages(name, offset, int64(end-start))
+	if err != nil {
+		return nil, err
+	}
+	return &pages, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestRegionCachedPages(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("mincore is supported only on Linux")
+	}
+	pageSize := os.Getpagesize()
+	name := filepath.Join(t.TempDir(), "lib.so")
+	// The pages just written are in the page cache.
+	if err := os.WriteFile(name, make([]byte, 3*pageSize), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hex := func(n int) string { return strconv.FormatInt(int64(n), 16) }
+	testCases := []struct {
+		name string
+		r    *region
+		want string
+	}{
+		{
+			name: "file",
+			r:    &region{AddressStart: []byte("10000"), AddressEnd: []byte(hex(0x10000 + 2*pageSize)), Offset: []byte(hex(pageSize)), Inode: []byte("12"), Pathname: []byte(name)},
+			want: "2",
+		},
+		{
+			name: "beyond the end of the file",
+			r:    &region{AddressStart: []byte("10000"), AddressEnd: []byte(hex(0x10000 + pageSize)), Offset: []byte(hex(4 * pageSize)), Inode: []byte("12"), Pathname: []byte(name)},
+			want: "0",
+		},
+		{
+			name: "host path",
+			r:    &region{AddressStart: []byte("10000"), AddressEnd: []byte(hex(0x10000 + 4*pageSize)), Offset: []byte("0"), Inode: []byte("12"), Pathname: []byte("/lib.so"), HostPath: []byte(name)},
+			want: "3",
+		},
+		{
+			name: "anonymous",
+			r:    &region{AddressStart: []byte("10000"), AddressEnd: []byte("11000"), Offset: []byte("0"), Inode: []byte("0"), Pathname: []byte("[heap]")},
+			want: "",
+		},
+		{
+			name: "deleted",
+			r:    &region{AddressStart: []byte("10000"), AddressEnd: []byte("11000"), Offset: []byte("0"), Inode: []byte("12"), Pathname: []byte(name + " (deleted)")},
+			want: "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pages, err := regionCachedPages(tc.r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cachedPagesValue(pages); got != tc.want {
+				t.Errorf("result mismatch, got=%q, want=%q", got, tc.want)
+			}
+		})
+	}
+
+	r := &region{AddressStart: []byte("10000"), AddressEnd: []byte("11000"), Offset: []byte("0"), Inode: []byte("12"), Pathname: []byte(name + ".missing")}
+	if _, err := regionCachedPages(r); err == nil {
+		t.Error("want an error of a missing file")
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validateRetention checks -compact-after, -compact-to and -retain of
+// watch mode, whose output is rewritten at each sample with the old
+// samples downsampled or dropped.
+func (a *args) validateRetention() error {
+	if a.compactAfter == 0 && a.compactTo == 0 && a.retain == 0 {
+		return nil
+	}
+	switch {
+	case a.compactAfter < 0, a.compactTo < 0, a.retain < 0:
+		return errors.New("-compact-after, -compact-to and -retain must not be negative")
+	case (a.compactAfter > 0) != (a.compactTo > 0):
+		return errors.New("-compact-after and -compact-to must be used together")
+	case a.interval == 0:
+		return errors.New("-compact-after and -retain require -interval")
+	case a.compactTo > 0 && a.compactTo <= a.interval:
+		return fmt.Errorf("-compact-to %v must be longer than -interval %v", a.compactTo, a.interval)
+	case a.retain > 0 && a.retain <= a.compactAfter:
+		return fmt.Errorf("-retain %v must be longer than -compact-after %v", a.retain, a.compactAfter)
+	case a.outputFilename == stdioName:
+		return errors.New("-compact-after and -retain require an output file given by -o, which is rewritten")
+	}
+	switch a.format {
+	case "", outputFormatCSV, outputFormatSQLite, outputFormatParquet, outputFormatXLSX:
+	default:
+		return fmt.Errorf("-compact-after and -retain cannot be used with -format %s", a.format)
+	}
+	switch {
+	case a.compress != "" && a.compress != compressNone, a.appendOutput, a.splitsOutput(), len(a.sinks) > 0:
+		return errors.New("-compact-after and -retain cannot be used with -compress, -append, -max-rows, -max-size and -sink")
+	case a.noHeader, a.versionMeta == versionMetadataComment:
+		return errors.New("-compact-after and -retain cannot be used with -no-header and -version-metadata comment, as the rows are read back by the header")
+	case a.decimalSep != "." || a.thousandsSep != "":
+		return errors.New("-compact-after requires numbers with a '.' decimal separator and no thousands separator")
+	}
+	return nil
+}
+
+// watchRetention compacts the rows of the samples of watch mode kept by a
+// tableFileWriter: the samples older than compactAfter are downsampled to
+// one per compactTo, and those older than retain are dropped, so that a
+// watch of several days produces a manageable file.
+type watchRetention struct {
+	compactAfter time.Duration
+	compactTo    time.Duration
+	retain       time.Duration
+	timestamps   *timestampFormat
+	floatFormat  floatFormat
+	// now is time.Now, replaced in tests.
+	now func() time.Time
+}
+
+func newWatchRetention(args args) *watchRetention {
+	if args.compactAfter == 0 && args.retain == 0 {
+		return nil
+	}
+	return &watchRetention{
+		compactAfter: args.compactAfter,
+		compactTo:    args.compactTo,
+		retain:       args.retain,
+		timestamps:   args.timestampFormat,
+		floatFormat:  args.floatFormat,
+		now:          time.Now,
+	}
+}
+
+// retentionKeyColumns are the columns identifying a row across the samples
+// in addition to stringColumns, whose rows are averaged together.
+var retentionKeyColumns = map[string]bool{
+	columnHost:  true,
+	columnPid:   true,
+	"Group":     true,
+	"FieldName": true,
+}
+
+// retainedBucket is the rows of the samples in a period of compactTo.
+type retainedBucket struct {
+	start time.Time
+	keys  []string
+	rows  map[string]*retainedRow
+}
+
+// retainedRow is the sums of the values of the rows of a key in a bucket.
+type retainedRow struct {
+	// last is the last row, whose values are written for the columns
+	// which are not numbers.
+	last    []string
+	sums    []float64
+	counts  []int
+	numbers []bool
+}
+
+// compact returns the rows with the old samples compacted, and whether
+// they are changed. Rows without timestamps are kept as they are.
+func (r *watchRetention) compact(header []string, rows [][]string) ([][]string, bool, error) {
+	ti := indexOf(header, "Timestamp")
+	if ti == -1 {
+		return rows, false, nil
+	}
+	isKey := make([]bool, len(header))
+	var keyIndexes []int
+	for i, name := range header {
+		isKey[i] = i != ti && (stringColumns[name] || retentionKeyColumns[name])
+		if isKey[i] {
+			keyIndexes = append(keyIndexes, i)
+		}
+	}
+	now := r.now()
+	var compactBefore, retainAfter time.Time
+	if r.compactTo > 0 {
+		compactBefore = now.Add(-r.compactAfter).Truncate(r.compactTo)
+	}
+	if r.retain > 0 {
+		retainAfter = now.Add(-r.retain)
+	}
+
+	var kept [][]string
+	var buckets []*retainedBucket
+	changed := false
+	for _, row := range rows {
+		if ti >= len(row) || row[ti] == "" {
+			kept = append(kept, row)
+			continue
+		}
+		t, err := r.timestamps.parseTime(row[ti])
+		if err != nil {
+			return nil, false, err
+		}
+		if !retainAfter.IsZero() && t.Before(retainAfter) {
+			changed = true
+			continue
+		}
+		if compactBefore.IsZero() || !t.Before(compactBefore) {
+			kept = append(kept, row)
+			continue
+		}
+		start := t.Truncate(r.compactTo)
+		if len(buckets) == 0 || !buckets[len(buckets)-1].start.Equal(start) {
+			buckets = append(buckets, &retainedBucket{start: start, rows: make(map[string]*retainedRow)})
+		}
+		b := buckets[len(buckets)-1]
+		// A bucket is unchanged if it is compacted, i.e. of a sample at
+		// its start without repeated keys.
+		if !t.Equal(start) {
+			changed = true
+		}
+		key := strings.Join(selectColumns(row, keyIndexes), "\x00")
+		rr, ok := b.rows[key]
+		if !ok {
+			rr = &retainedRow{sums: make([]float64, len(row)), counts: make([]int, len(row)), numbers: make([]bool, len(row))}
+			for i := range rr.numbers {
+				rr.numbers[i] = i != ti && !isKey[i]
+			}
+			b.keys = append(b.keys, key)
+			b.rows[key] = rr
+		} else {
+			changed = true
+		}
+		rr.last = row
+		for i, v := range row {
+			if !rr.numbers[i] || v == "" {
+				continue
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				rr.numbers[i] = false
+				continue
+			}
+			rr.sums[i] += f
+			rr.counts[i]++
+		}
+	}
+	if !changed {
+		return rows, false, nil
+	}
+
+	compacted := make([][]string, 0, len(kept))
+	for _, b := range buckets {
+		timestamp := r.timestamps.formatTime(b.start)
+		for _, key := range b.keys {
+			rr := b.rows[key]
+			row := append([]string(nil), rr.last...)
+			row[ti] = timestamp
+			for i := range row {
+				if rr.numbers[i] && rr.counts[i] > 0 {
+					row[i] = r.floatFormat.format(rr.sums[i] / float64(rr.counts[i]))
+				}
+			}
+			compacted = append(compacted, row)
+		}
+	}
+	return append(compacted, kept...), true, nil
+}
+
+// buildCSVFile returns the build function of a tableFileWriter writing CSV
+// in the dialect, for the outputs rewritten by -compact-after and -retain.
+func buildCSVFile(dialect csvDialect) func(columns []string, rows [][]string) ([]byte, error) {
+	return func(columns []string, rows [][]string) ([]byte, error) {
+		var buf bytes.Buffer
+		w := dialect.newWriter(&buf)
+		if err := w.Write(columns); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if err := w.Write(row); err != nil {
+				return nil, err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidateRetention(t *testing.T) {
+	valid := args{interval: time.Minute, outputFilename: "out.csv", decimalSep: ".", compactAfter: time.Hour, compactTo: 5 * time.Minute, retain: 168 * time.Hour}
+	if err := valid.validateRetention(); err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if err := (&args{}).validateRetention(); err != nil {
+		t.Errorf("got error without retention: %v", err)
+	}
+	for name, modify := range map[string]func(a *args){
+		"negative":           func(a *args) { a.retain = -time.Hour },
+		"without compact-to": func(a *args) { a.compactTo = 0 },
+		"without interval":   func(a *args) { a.interval = 0 },
+		"short compact-to":   func(a *args) { a.compactTo = time.Minute },
+		"short retain":       func(a *args) { a.retain = time.Hour },
+		"stdout":             func(a *args) { a.outputFilename = stdioName },
+		"ndjson":             func(a *args) { a.format = outputFormatNDJSON },
+		"compress":           func(a *args) { a.compress = compressGzip },
+		"no-header":          func(a *args) { a.noHeader = true },
+		"decimal separator":  func(a *args) { a.decimalSep = "," },
+	} {
+		a := valid
+		modify(&a)
+		if err := a.validateRetention(); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestWatchRetentionCompact(t *testing.T) {
+	tf, err := newTimestampFormat(timeFormatRFC3339, "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	r := &watchRetention{
+		compactAfter: time.Hour,
+		compactTo:    5 * time.Minute,
+		retain:       3 * time.Hour,
+		timestamps:   tf,
+		floatFormat:  defaultFloatFormat,
+		now:          func() time.Time { return now },
+	}
+	header := []string{"Timestamp", "Pid", "Pathname", "Rss", "VmFlags"}
+	rows := [][]string{
+		// Dropped by -retain.
+		{"2024-01-02T08:59:00Z", "1", "/a", "1", "rd"},
+		// Compacted into 10:00.
+		{"2024-01-02T10:00:00Z", "1", "/a", "4", "rd"},
+		{"2024-01-02T10:00:00Z", "1", "/b", "8", "rd"},
+		{"2024-01-02T10:01:00Z", "1", "/a", "6", "rd"},
+		{"2024-01-02T10:02:00Z", "1", "/a", "", "rd"},
+		// Compacted into 10:55, a period ending an hour ago.
+		{"2024-01-02T10:56:00Z", "2", "/a", "3", "rd"},
+		// Kept, as its period ends in the last hour.
+		{"2024-01-02T11:00:00Z", "1", "/a", "2", "rd"},
+	}
+	got, changed, err := r.compact(header, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"2024-01-02T10:00:00Z", "1", "/a", "5", "rd"},
+		{"2024-01-02T10:00:00Z", "1", "/b", "8", "rd"},
+		{"2024-01-02T10:55:00Z", "2", "/a", "3", "rd"},
+		{"2024-01-02T11:00:00Z", "1", "/a", "2", "rd"},
+	}
+	if !changed || !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch, changed=%v,\n got=%q,\nwant=%q", changed, got, want)
+	}
+
+	// The compacted rows are unchanged.
+	if again, changed, err := r.compact(header, got); err != nil || changed || !reflect.DeepEqual(again, want) {
+		t.Errorf("compacting again: changed=%v, err=%v, got=%q", changed, err, again)
+	}
+}
+
+func TestRunWatchRetain(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-fields-file", writeTestFile(t, "Rss\n"), "-time-format", timeFormatUnixMilli}); err != nil {
+		t.Fatal(err)
+	}
+	a.inputFilename = writeTestFile(t, testSmapsSorted)
+	a.outputFilename = filepath.Join(t.TempDir(), "out.csv")
+	a.interval, a.count, a.retain = 2*time.Millisecond, 3, time.Hour
+	if err := a.validateWatch(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.validate(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.validateRetention(); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(a); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(a.outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file rewritten at each sample has all of them.
+	if got, want := len(records), 1+3*2; got != want {
+		t.Fatalf("record count mismatch, got=%d, want=%d", got, want)
+	}
+	if records[0][0] != "Timestamp" {
+		t.Errorf("header mismatch, got=%v", records[0])
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// sshConnectionFailure is the exit status of ssh when it fails to connect
+// or authenticate, as opposed to the exit status of the remote command.
+const sshConnectionFailure = 255
+
+// retrySleep waits between attempts, which tests replace to run fast.
+var retrySleep = time.Sleep
+
+// retryPolicy is how many times a source is read again after a transient
+// failure, and how long to wait before the first retry, doubled before
+// each of the following ones.
+type retryPolicy struct {
+	retries int
+	backoff time.Duration
+}
+
+// do calls f until it succeeds, it fails with an error for which
+// transient returns false, or the retries are exhausted. It returns the
+// number of the failed attempts and the error of the last one.
+func (p retryPolicy) do(transient func(error) bool, f func() error) (int, error) {
+	backoff := p.backoff
+	for failures := 0; ; failures++ {
+		err := f()
+		if err == nil {
+			return failures, nil
+		}
+		if failures >= p.retries || !transient(err) {
+			return failures + 1, err
+		}
+		retrySleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isTransientProcessError reports whether err of reading a file of a
+// process in /proc may go away by itself, e.g. when the process is
+// stopped by a tracer or in the middle of an execve, as opposed to the
+// process having exited.
+func isTransientProcessError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EAGAIN, syscall.EINTR, syscall.EBUSY, syscall.EIO} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTransientSSHError reports whether err of running the collection
+// script over SSH is a failure of the connection, which may succeed on
+// another attempt, rather than of the script.
+func isTransientSSHError(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == sshConnectionFailure
+}
+
+// validateRetry checks -retries and -retry-backoff.
+func (a *args) validateRetry() error {
+	switch {
+	case a.retry.retries < 0:
+		return errors.New("-retries must not be negative")
+	case a.retry.backoff < 0:
+		return errors.New("-retry-backoff must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDo(t *testing.T) {
+	orig := retrySleep
+	var waits []time.Duration
+	retrySleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { retrySleep = orig }()
+
+	p := retryPolicy{retries: 3, backoff: time.Second}
+	testCases := []struct {
+		errs         []error
+		wantFailures int
+		wantErr      bool
+		wantWaits    []time.Duration
+	}{
+		{errs: []error{nil}},
+		{errs: []error{syscall.EAGAIN, syscall.EBUSY, nil}, wantFailures: 2, wantWaits: []time.Duration{time.Second, 2 * time.Second}},
+		{errs: []error{syscall.EAGAIN, os.ErrNotExist}, wantFailures: 2, wantErr: true, wantWaits: []time.Duration{time.Second}},
+		{errs: []error{syscall.EIO, syscall.EIO, syscall.EIO, syscall.EIO, nil}, wantFailures: 4, wantErr: true,
+			wantWaits: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+	}
+	for i, tc := range testCases {
+		waits = nil
+		calls := 0
+		failures, err := p.do(isTransientProcessError, func() error {
+			calls++
+			return tc.errs[calls-1]
+		})
+		if failures != tc.wantFailures || (err != nil) != tc.wantErr {
+			t.Errorf("case %d: got failures=%d, err=%v, want failures=%d, wantErr=%v", i, failures, err, tc.wantFailures, tc.wantErr)
+		}
+		if !reflect.DeepEqual(waits, tc.wantWaits) {
+			t.Errorf("case %d: waits mismatch, got=%v, want=%v", i, waits, tc.wantWaits)
+		}
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	if !isTransientProcessError(fmt.Errorf("read: %w", syscall.EAGAIN)) {
+		t.Error("EAGAIN must be transient")
+	}
+	if isTransientProcessError(syscall.ESRCH) || isTransientProcessError(os.ErrNotExist) {
+		t.Error("an exited process must not be transient")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	if err := exec.Command("sh", "-c", "exit 255").Run(); !isTransientSSHError(fmt.Errorf("%w: unreachable", err)) {
+		t.Errorf("a connection failure must be transient, err=%v", err)
+	}
+	if err := exec.Command("sh", "-c", "exit 1").Run(); isTransientSSHError(err) {
+		t.Error("a failure of the script must not be transient")
+	}
+	if isTransientSSHError(errors.New("other")) {
+		t.Error("an error other than the exit status must not be transient")
+	}
+}
+
+func TestRunFleetRetries(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	// The fake ssh fails to connect to web2 on the first attempt, and
+	// always to web3.
+	output := filepath.Join(dir, "smaps.out")
+	if err := os.WriteFile(output, []byte(fleetMarker+"10 cat\n"+testSmapsSorted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ssh := filepath.Join(dir, "ssh")
+	script := "#!/bin/sh\ncd " + dir + "\n" +
+		"[ \"$1\" = web3 ] && { echo unreachable >&2; exit 255; }\n" +
+		"[ \"$1\" = web2 ] && [ ! -e web2.tried ] && { touch web2.tried; exit 255; }\n" +
+		"cat " + output + "\n"
+	if err := os.WriteFile(ssh, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	hosts := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(hosts, []byte("web1\nweb2\nweb3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	summaryPath := filepath.Join(dir, "summary.json")
+	arguments := []string{"-hosts", hosts, "-ssh", ssh, "-o", filepath.Join(dir, "out.csv"),
+		"-retries", "2", "-retry-backoff", "0", "-summary", summaryPath}
+	if err := runFleet(arguments); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s runSummary
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"web1", "web2"}; !reflect.DeepEqual(s.InputFiles, want) {
+		t.Errorf("input files mismatch, got=%v, want=%v", s.InputFiles, want)
+	}
+	want := []sourceStats{
+		{Source: "web2", Failures: 1},
+		{Source: "web3", Failures: 3, Error: "exit status 255: unreachable"},
+	}
+	if !reflect.DeepEqual(s.Sources, want) {
+		t.Errorf("sources mismatch, got=%+v, want=%+v", s.Sources, want)
+	}
+}
+
+func TestValidateRetry(t *testing.T) {
+	testCases := []struct {
+		retry   retryPolicy
+		wantErr bool
+	}{
+		{retry: retryPolicy{retries: 3, backoff: time.Second}},
+		{retry: retryPolicy{retries: -1}, wantErr: true},
+		{retry: retryPolicy{backoff: -time.Second}, wantErr: true},
+	}
+	for i, tc := range testCases {
+		a := args{retry: tc.retry}
+		if err := a.validateRetry(); (err != nil) != tc.wantErr {
+			t.Errorf("case %d: err=%v, wantErr=%v", i, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Kinds of input given by -kind.
+const (
+	smapsKindSmaps  = "smaps"
+	smapsKindRollup = "smaps_rollup"
+)
+
+// validateKind checks the kind of input and the options depending on it.
+// smaps_rollup has a single pseudo-region spanning all mappings with the
+// sums of their fields, so options about each region are rejected.
+func (a *args) validateKind() error {
+	switch a.kind {
+	case "", smapsKindSmaps:
+	case smapsKindRollup:
+		if a.groupBy != "" || a.categoryColumn || a.backingColumns || a.regionKey || a.threadStacks || a.resolveInodes || a.swapDevices || a.pagemap || a.pageContent > 0 || a.mincore || a.dumpDir != "" {
+			return fmt.Errorf("-group-by, -category, -backing, -region-key, -thread-stacks, -resolve-inodes, -swap-devices, -pagemap, -page-content, -mincore and -dump-dir cannot be used with -kind %s", a.kind)
+		}
+	default:
+		return fmt.Errorf("unsupported -kind: %q", a.kind)
+	}
+	return nil
+}
+
+// procKindName returns the name of the file in /proc/<pid> to read.
+func (a *args) procKindName() string {
+	if a.kind == "" {
+		return smapsKindSmaps
+	}
+	return a.kind
+}
+
+// pidFromInputPath returns the pid in a path like /proc/<pid>/smaps or
+// /proc/<pid>/smaps_rollup, or zero if filename is not such a path.
+func pidFromInputPath(filename string) int {
+	if filepath.Base(filename) == smapsKindRollup {
+		return pidFromSmapsPath(filepath.Join(filepath.Dir(filename), smapsKindSmaps))
+	}
+	return pidFromSmapsPath(filename)
+}
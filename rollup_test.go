@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+const testSmapsRollup = `00400000-7ffc5a7fd000 ---p 00000000 00:00 0                              [rollup]
+Rss:                9520 kB
+Pss:                3361 kB
+Pss_Dirty:          1800 kB
+Pss_Anon:           1700 kB
+Pss_File:           1661 kB
+Pss_Shmem:             0 kB
+Swap:                  0 kB
+`
+
+func TestConvertSmapsRollup(t *testing.T) {
+	stats := &runStats{}
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(testSmapsRollup),
+		args{Separator: ",", kind: smapsKindRollup, stats: stats}); err != nil {
+		t.Fatal(err)
+	}
+	want := "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Rss,Pss,Pss_Dirty,Pss_Anon,Pss_File,Pss_Shmem,Swap\n" +
+		"00400000,7ffc5a7fd000,---p,00000000,00:00,0,[rollup],9520,3361,1800,1700,1661,0,0\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+	if stats.guardRegions != 0 {
+		t.Errorf("the rollup region is counted as a guard region")
+	}
+
+	input := testSmapsRollup + "7ffc5a7fd000-7ffc5a7fe000 r--p 00000000 00:00 0                          [vvar]\nRss: 4 kB\n"
+	err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input), args{Separator: ",", kind: smapsKindRollup})
+	if err == nil || !strings.Contains(err.Error(), "more than one region") {
+		t.Errorf("got error %v for smaps with -kind smaps_rollup", err)
+	}
+}
+
+func TestValidateKind(t *testing.T) {
+	testCases := []struct {
+		args    args
+		wantErr bool
+	}{
+		{args: args{kind: smapsKindSmaps, groupBy: groupByTopDir}},
+		{args: args{kind: smapsKindRollup}},
+		{args: args{kind: smapsKindRollup, groupBy: groupByTopDir}, wantErr: true},
+		{args: args{kind: smapsKindRollup, categoryColumn: true}, wantErr: true},
+		{args: args{kind: "status"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		if err := tc.args.validateKind(); (err != nil) != tc.wantErr {
+			t.Errorf("validateKind(kind=%q) = %v, wantErr=%v", tc.args.kind, err, tc.wantErr)
+		}
+	}
+}
+
+func TestPidFromInputPath(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want int
+	}{
+		{in: "/proc/1234/smaps", want: 1234},
+		{in: "/proc/1234/smaps_rollup", want: 1234},
+		{in: "/tmp/1234/smaps_rollup", want: 0},
+		{in: "smaps_rollup", want: 0},
+	}
+	for _, tc := range testCases {
+		if got := pidFromInputPath(tc.in); got != tc.want {
+			t.Errorf("in=%s: result mismatch, got=%d, want=%d", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"strconv"
+)
+
+// columnSampleWeight is the column of -sample with the number of regions
+// which each sampled region stands for.
+const columnSampleWeight = "SampleWeight"
+
+// regionSampler selects a deterministic sample of regions for -sample.
+// Whether a region is sampled depends only on the seed and the region,
+// not on the order of the input, so the same regions are sampled from
+// captures of the same processes.
+type regionSampler struct {
+	// threshold is the fraction scaled to the range of the hash.
+	threshold uint64
+	seed      uint64
+	weight    string
+}
+
+func newRegionSampler(fraction float64, seed uint64) *regionSampler {
+	s := &regionSampler{seed: seed, weight: strconv.FormatFloat(1/fraction, 'f', -1, 64)}
+	if fraction >= 1 {
+		s.threshold = ^uint64(0)
+	} else {
+		s.threshold = uint64(fraction * (1 << 64))
+	}
+	return s
+}
+
+// validateSample checks -sample, whose sums would be those of the
+// sample instead of the regions.
+func (a *args) validateSample() error {
+	if a.sample == 0 {
+		return nil
+	}
+	if a.sample < 0 || a.sample > 1 {
+		return errors.New("-sample must be greater than 0 and at most 1")
+	}
+	if a.groupBy != "" || a.subtotals != "" || a.totals || a.totalsPath != "" {
+		return errors.New("-sample cannot be used with -group-by, -subtotals, -totals or -totals-out")
+	}
+	return nil
+}
+
+// keep reports whether the region of m of the process pid is in the
+// sample.
+func (s *regionSampler) keep(pid int, m *mapping) bool {
+	h := fnv.New64a()
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], s.seed)
+	h.Write(b[:])
+	binary.LittleEndian.PutUint64(b[:], uint64(pid))
+	h.Write(b[:])
+	for _, v := range [][]byte{m.Region.AddressStart, m.Region.AddressEnd, m.Region.Inode, m.Region.Pathname} {
+		h.Write(v)
+		h.Write([]byte{0})
+	}
+	return mix64(h.Sum64()) < s.threshold
+}
+
+// mix64 is the finalizer of SplitMix64, which spreads the bits of FNV
+// hashes of similar inputs uniformly.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// sampleWeight returns the value of the SampleWeight column of s, or
+// empty if s is nil.
+func sampleWeight(s *regionSampler) string {
+	if s == nil {
+		return ""
+	}
+	return s.weight
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRegionSampler(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&input, "%x-%x rw-p 00000000 00:00 0 \nRss: 4 kB\n", 0x10000+i*0x1000, 0x11000+i*0x1000)
+	}
+	convert := func(seed uint64) []string {
+		t.Helper()
+		a := args{sampler: newRegionSampler(0.1, seed), columns: []string{"AddressStart", columnSampleWeight}}
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := convertSmapsToCsv(w, strings.NewReader(input.String()), a); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	}
+
+	got := convert(1)
+	if got[0] != "AddressStart,SampleWeight" {
+		t.Errorf("header mismatch, got=%s", got[0])
+	}
+	if n := len(got) - 1; n < 70 || n > 130 {
+		t.Errorf("sample size %d is far from 100", n)
+	}
+	if !strings.HasSuffix(got[1], ",10") {
+		t.Errorf("weight mismatch, got=%s", got[1])
+	}
+	if again := convert(1); strings.Join(again, "\n") != strings.Join(got, "\n") {
+		t.Error("sample of the same seed differs")
+	}
+	if other := convert(2); strings.Join(other, "\n") == strings.Join(got, "\n") {
+		t.Error("sample of another seed is the same")
+	}
+}
+
+func TestValidateSample(t *testing.T) {
+	for _, a := range []args{{sample: 1.5}, {sample: -0.1}, {sample: 0.1, totals: true}, {sample: 0.1, groupBy: "pathname"}} {
+		if err := a.validateSample(); err == nil {
+			t.Errorf("expected an error for %+v", a)
+		}
+	}
+	a := args{sample: 1}
+	if err := a.validateSample(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
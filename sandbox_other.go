@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func enterSandbox(procRoot string, writableDirs []string) error {
+	return errors.New("sandbox is supported only on Linux")
+}
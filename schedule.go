@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runSchedule runs the schedule subcommand, a daemon which converts the
+// inputs of targets at the times of their cron expressions, instead of a
+// crontab entry for each of them. Each line of the schedule file is a
+// target, a cron expression followed by the flags of a conversion:
+//
+//	# full smaps hourly, and smaps_rollup every 15 seconds
+//	0 * * * * -p 1234 -o /var/lib/smaps/full.csv -sink ndjson:unix:/run/collector.sock
+//	*/15 * * * * * -p 1234 -kind smaps_rollup -o /var/lib/smaps/rollup.csv -append -timestamp
+//
+// The expression has the five fields of crontab, minute, hour, day of
+// month, month and day of week, optionally preceded by a sixth field of
+// the second, or is one of @every <duration>, @hourly and @daily.
+func runSchedule(arguments []string) error {
+	fs := flag.NewFlagSet("schedule", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s schedule -f <schedule file>\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	filename := fs.String("f", "", "schedule file with a target on each line, a cron expression followed by the flags of the conversion, which are -p, -i, -all-processes, -o, -append, -alert-rules and the conversion options, e.g. \"*/15 * * * * * -p 1234 -kind smaps_rollup -o rollup.csv -append -timestamp\"")
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if *filename == "" {
+		fs.Usage()
+		return errors.New("flag -f must be set")
+	}
+	file, err := os.Open(*filename)
+	if err != nil {
+		return err
+	}
+	targets, err := parseScheduleFile(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", *filename, err)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("%s: no targets", *filename)
+	}
+
+	log.Printf("scheduled %d targets of %s", len(targets), *filename)
+	for _, t := range targets {
+		go t.loop()
+	}
+	select {}
+}
+
+// scheduleTarget is a conversion run at the times of its schedule.
+type scheduleTarget struct {
+	line      int
+	schedule  *cronSchedule
+	arguments []string
+	// alerts evaluates the rules of -alert-rules of the target for each
+	// run, or is nil.
+	alerts *alertEngine
+}
+
+// parseScheduleFile parses the targets of a schedule file, whose flags
+// are checked so that mistakes are found at the start. Empty lines and
+// lines starting with '#' are skipped.
+func parseScheduleFile(r io.Reader) ([]*scheduleTarget, error) {
+	var targets []*scheduleTarget
+	s := bufio.NewScanner(r)
+	lineNo := 0
+	for s.Scan() {
+		lineNo++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words, err := splitArguments(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		// The expression ends at the first flag.
+		n := 0
+		for n < len(words) && !strings.HasPrefix(words[n], "-") {
+			n++
+		}
+		schedule, err := parseCronSchedule(words[:n])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		t := &scheduleTarget{line: lineNo, schedule: schedule, arguments: words[n:]}
+		if schedule.next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("line %d: schedule %q never runs", lineNo, strings.Join(words[:n], " "))
+		}
+		if _, err := t.args(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		targets = append(targets, t)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// args parses the flags of the conversion of t. They are parsed for each
+// run, so that runs share nothing but the state of the alert rules, which
+// are read at the first parse, and the inputs of glob patterns and
+// -all-processes are those of the time of the run.
+func (t *scheduleTarget) args() (args, error) {
+	fs := flag.NewFlagSet("schedule target", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var a args
+	pidList := fs.String("p", "", "")
+	fs.StringVar(&a.inputFilename, "i", "", "")
+	fs.BoolVar(&a.allProcesses, "all-processes", false, "")
+	fs.StringVar(&a.outputFilename, "o", "", "")
+	fs.BoolVar(&a.appendOutput, "append", false, "")
+	alertRulesPath := fs.String("alert-rules", "", "")
+	a.registerFlags(fs)
+	if err := fs.Parse(t.arguments); err != nil {
+		return args{}, err
+	}
+	inputs := 0
+	for _, set := range []bool{*pidList != "", a.inputFilename != "", a.allProcesses} {
+		if set {
+			inputs++
+		}
+	}
+	switch {
+	case fs.NArg() > 0:
+		return args{}, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	case a.outputFilename == "" || a.outputFilename == stdioName:
+		return args{}, errors.New("-o must be set to an output file")
+	case inputs != 1:
+		return args{}, errors.New("just one of -p, -i and -all-processes must be set")
+	case a.dropUser != "", a.sandbox:
+		return args{}, errors.New("-drop-privileges and -sandbox cannot be used in a schedule, which keeps running")
+	}
+	if *pidList != "" {
+		pids, err := parsePidList(*pidList)
+		if err != nil {
+			return args{}, err
+		}
+		a.pids = pids
+	}
+	if err := a.validate(fs); err != nil {
+		return args{}, err
+	}
+	if err := a.validateAppend(); err != nil {
+		return args{}, err
+	}
+	if *alertRulesPath != "" {
+		if t.alerts == nil {
+			rules, err := readAlertRules(*alertRulesPath)
+			if err != nil {
+				return args{}, err
+			}
+			t.alerts = newAlertEngine(rules)
+		}
+		a.alerts = t.alerts
+	}
+	return a, nil
+}
+
+// loop runs t at the times of its schedule. A run which takes longer than
+// the interval of the schedule skips the times passed meanwhile.
+func (t *scheduleTarget) loop() {
+	for {
+		next := t.schedule.next(time.Now())
+		if next.IsZero() {
+			log.Printf("warning: schedule of line %d no longer runs", t.line)
+			return
+		}
+		time.Sleep(time.Until(next))
+		if err := t.run(); err != nil {
+			log.Printf("warning: run of line %d: %v", t.line, err)
+		}
+	}
+}
+
+// run converts the inputs of t once.
+func (t *scheduleTarget) run() error {
+	a, err := t.args()
+	if err != nil {
+		return err
+	}
+	if err := a.resolveInputs(); err != nil {
+		return err
+	}
+	a.stats = &runStats{}
+	return run(a)
+}
+
+// splitArguments splits s into words at spaces, where a word may be
+// quoted with single or double quotes to have spaces, e.g. the
+// expression of -filter.
+func splitArguments(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote %c", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// cronSchedule is the times given by a cron expression, whose fields are
+// sets of the values matching them.
+type cronSchedule struct {
+	seconds, minutes, hours, days, months, weekdays uint64
+	// daysAny and weekdaysAny are true if the fields are "*". Otherwise
+	// a day matches either of them as in crontab.
+	daysAny, weekdaysAny bool
+	// every is the interval of @every, which replaces the fields.
+	every time.Duration
+}
+
+// cronFields are the fields of a cron expression with their ranges.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"second", 0, 59},
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// parseCronSchedule parses the fields of a cron expression.
+func parseCronSchedule(fields []string) (*cronSchedule, error) {
+	switch {
+	case len(fields) == 2 && fields[0] == "@every":
+		d, err := time.ParseDuration(fields[1])
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("@every needs a duration of at least 1s: %q", fields[1])
+		}
+		return &cronSchedule{every: d}, nil
+	case len(fields) == 1 && fields[0] == "@hourly":
+		fields = []string{"0", "0", "*", "*", "*", "*"}
+	case len(fields) == 1 && fields[0] == "@daily":
+		fields = []string{"0", "0", "0", "*", "*", "*"}
+	case len(fields) == 5:
+		fields = append([]string{"0"}, fields...)
+	case len(fields) == 6:
+	default:
+		return nil, fmt.Errorf("cron expression must have 5 or 6 fields, or be @every <duration>, @hourly or @daily: %q", strings.Join(fields, " "))
+	}
+	var sets [6]uint64
+	for i, f := range cronFields {
+		set, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", f.name, fields[i], err)
+		}
+		sets[i] = set
+	}
+	// Sunday is either 0 or 7.
+	if sets[5]&(1<<7) != 0 {
+		sets[5] |= 1
+	}
+	return &cronSchedule{
+		seconds:     sets[0],
+		minutes:     sets[1],
+		hours:       sets[2],
+		days:        sets[3],
+		months:      sets[4],
+		weekdays:    sets[5],
+		daysAny:     fields[3] == "*",
+		weekdaysAny: fields[5] == "*",
+	}, nil
+}
+
+// parseCronField parses a comma separated list of "*", a value or a
+// range "a-b", each optionally followed by a step "/n", into the set of
+// the values.
+func parseCronField(s string, min, max int) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("invalid value %q", first)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("invalid value %q", last)
+				}
+			} else if hasStep {
+				// "a/n" is from a to the maximum.
+				hi = max
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("%q is out of range %d-%d", rangePart, min, max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// next returns the first time after t of the schedule, or the zero time
+// if there is none within 5 years, e.g. of February 30.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.Truncate(time.Second).Add(time.Second)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, t.Location())
+		case s.seconds&(1<<uint(t.Second())) == 0:
+			t = t.Add(time.Second)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay reports whether the day of t matches the day of month and
+// the day of week. If neither is "*", either of them is enough.
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	if s.daysAny || s.weekdaysAny {
+		return day && weekday
+	}
+	return day || weekday
+}
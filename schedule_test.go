@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2024-01-01 is a Monday.
+	base := time.Date(2024, 1, 1, 10, 20, 30, 0, time.UTC)
+	for _, tc := range []struct {
+		expr string
+		want time.Time
+	}{
+		{expr: "* * * * *", want: time.Date(2024, 1, 1, 10, 21, 0, 0, time.UTC)},
+		{expr: "*/15 * * * * *", want: time.Date(2024, 1, 1, 10, 20, 45, 0, time.UTC)},
+		{expr: "0 * * * *", want: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{expr: "@hourly", want: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{expr: "@daily", want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{expr: "30 2 * * 0", want: time.Date(2024, 1, 7, 2, 30, 0, 0, time.UTC)},
+		{expr: "30 2 * * 7", want: time.Date(2024, 1, 7, 2, 30, 0, 0, time.UTC)},
+		{expr: "0 0 15 * 3", want: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 9-17/4 * 2 *", want: time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{expr: "5,25 10 1 1 *", want: time.Date(2024, 1, 1, 10, 25, 0, 0, time.UTC)},
+		{expr: "@every 90s", want: base.Add(90 * time.Second)},
+		{expr: "0 0 30 2 *", want: time.Time{}},
+	} {
+		s, err := parseCronSchedule(strings.Fields(tc.expr))
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		if got := s.next(base); !got.Equal(tc.want) {
+			t.Errorf("%s: next = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestParseCronScheduleErrors(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"x * * * *",
+		"@every 1ms",
+		"@weekly",
+	} {
+		if _, err := parseCronSchedule(strings.Fields(expr)); err == nil {
+			t.Errorf("%s: got no error", expr)
+		}
+	}
+}
+
+func TestSplitArguments(t *testing.T) {
+	got, err := splitArguments(`-p 1 -filter 'Rss > 4' -o "a b.csv"  -x""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"-p", "1", "-filter", "Rss > 4", "-o", "a b.csv", "-x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch, got=%q, want=%q", got, want)
+	}
+	if _, err := splitArguments(`-filter 'Rss`); err == nil {
+		t.Error("want an error for an unterminated quote")
+	}
+}
+
+func TestParseScheduleFile(t *testing.T) {
+	input := "# comment\n\n0 * * * * -p 1 -o full.csv\n*/15 * * * * * -p 1,2 -kind smaps_rollup -o rollup.csv -append\n@every 1m -i 'a b.smaps' -o c.csv\n"
+	targets, err := parseScheduleFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 3 {
+		t.Fatalf("got %d targets, want 3", len(targets))
+	}
+	if got, want := targets[2].arguments, []string{"-i", "a b.smaps", "-o", "c.csv"}; targets[2].line != 5 || !reflect.DeepEqual(got, want) {
+		t.Errorf("target of line %d has arguments %q, want line 5 with %q", targets[2].line, got, want)
+	}
+
+	for _, line := range []string{
+		"* * * * -p 1 -o a.csv",
+		"0 0 30 2 * -p 1 -o a.csv",
+		"* * * * * -p 1",
+		"* * * * * -o a.csv",
+		"* * * * * -p 1 -i a.smaps -o a.csv",
+		"* * * * * -p 1 -o a.csv -drop-privileges nobody",
+		"* * * * * -p 1 -o a.csv -no-such-flag",
+		"* * * * * -p 1 -o a.csv extra",
+	} {
+		if _, err := parseScheduleFile(strings.NewReader(line)); err == nil || !strings.HasPrefix(err.Error(), "line 1: ") {
+			t.Errorf("%s: got error %v, want one of line 1", line, err)
+		}
+	}
+}
+
+func TestScheduleTargetRun(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	if err := os.MkdirAll(filepath.Join(procRoot, "9"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "9", "smaps"), []byte(testSmapsSorted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(t.TempDir(), "out.csv")
+	targets, err := parseScheduleFile(strings.NewReader("@every 1m -p 9 -columns Pid,Pathname,Rss -append -o " + output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := targets[0].run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Pid,Pathname,Rss\n9,/usr/bin/cat,4\n9,/usr/bin/cat,0\n9,/usr/bin/cat,4\n9,/usr/bin/cat,0\n"; string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestScheduleTargetAlertRules(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	if err := os.MkdirAll(filepath.Join(procRoot, "9"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "9", "smaps"), []byte(testSmapsSorted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	rules := writeTestFile(t, `{"rules": [{"name": "rss", "kind": "threshold", "condition": "total_rss >= 4", "for": 2}]}`)
+	output := filepath.Join(t.TempDir(), "out.csv")
+	targets, err := parseScheduleFile(strings.NewReader("@every 1m -p 9 -columns Pathname,Rss -alert-rules " + rules + " -o " + output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The rule holds in consecutive runs, as its state is kept.
+	for i := 0; i < 2; i++ {
+		if err := targets[0].run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "alert rss firing: total_rss >= 4 holds: 4 >= 4\n"; buf.String() != want {
+		t.Errorf("alerts mismatch,\n got=%s,\nwant=%s", buf.String(), want)
+	}
+}
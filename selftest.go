@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// selftestFiles are the samples of the selftest subcommand, smaps files
+// named <sample>.smaps, and their golden outputs of the text formats,
+// <sample>.<format>, or <sample>.<format>.err with the error of a
+// conversion which must fail.
+//
+//go:embed selftest
+var selftestFiles embed.FS
+
+const selftestDir = "selftest"
+
+// selftestFormats are the formats the samples are converted to, in the
+// order of the results.
+var selftestFormats = []string{
+	outputFormatCSV,
+	outputFormatJSON,
+	outputFormatNDJSON,
+	outputFormatFolded,
+	outputFormatSQLite,
+	outputFormatParquet,
+	outputFormatArrow,
+	outputFormatXLSX,
+}
+
+// selftestColumn is the column of the outputs of the binary formats
+// compared with the golden CSV output of the sample, whose bytes depend
+// on the versions of the tool and of Go, e.g. the version in the metadata
+// of parquet and the deflate streams of xlsx, so that they have no golden
+// outputs. Their conversions are also checked to be reproducible.
+const selftestColumn = "Rss"
+
+// checkSelftestDecoded decodes selftestColumn of the output data of the
+// conversion of the sample name with decode and compares its rows with
+// those of the golden CSV output of the sample.
+func checkSelftestDecoded(name string, decode func(data []byte, column string) ([]string, error), data []byte) (err error) {
+	golden := path.Join(selftestDir, name+"."+outputFormatCSV)
+	b, err := selftestFiles.ReadFile(golden)
+	if err != nil {
+		return fmt.Errorf("no golden output: %w", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("%s: %w", golden, err)
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("%s has no header", golden)
+	}
+	i := indexOf(records[0], selftestColumn)
+	if i == -1 {
+		return fmt.Errorf("%s has no column %s", golden, selftestColumn)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed output: %v", r)
+		}
+	}()
+	values, err := decode(data, selftestColumn)
+	if err != nil {
+		return fmt.Errorf("decoding column %s: %w", selftestColumn, err)
+	}
+	if len(values) != len(records)-1 {
+		return fmt.Errorf("output has %d rows, want %d of %s", len(values), len(records)-1, golden)
+	}
+	for j, v := range values {
+		if want := records[j+1][i]; canonicalSelftestNumber(v) != canonicalSelftestNumber(want) {
+			return fmt.Errorf("row %d of column %s is %q, want %q of %s", j+1, selftestColumn, v, want, golden)
+		}
+	}
+	return nil
+}
+
+// canonicalSelftestNumber formats s in the shortest decimal form if it is
+// a number, so that e.g. an integer decoded from a double equals it.
+func canonicalSelftestNumber(s string) string {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return s
+}
+
+// runSelftest runs the selftest subcommand, which converts the embedded
+// samples to each output format of the build and verifies the outputs,
+// to validate a deployed binary without any files or network access.
+func runSelftest(arguments []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s selftest [-write-golden <directory>]\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	goldenDir := fs.String("write-golden", "", "directory to write the outputs of the text formats to instead of verifying them, to update the golden files of selftest/ after changing an output format")
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return selftest(os.Stdout, *goldenDir)
+}
+
+// selftest converts the samples and writes a line of the result of each
+// conversion to w, returning an error if any fails. The outputs of the
+// text formats are written to goldenDir instead of being verified if it
+// is not empty.
+func selftest(w io.Writer, goldenDir string) error {
+	samples, err := fs.Glob(selftestFiles, selftestDir+"/*.smaps")
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", toolName+"-selftest")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	checks, failed := 0, 0
+	for _, sample := range samples {
+		name := strings.TrimSuffix(path.Base(sample), ".smaps")
+		input, err := selftestFiles.ReadFile(sample)
+		if err != nil {
+			return err
+		}
+		inputFilename := filepath.Join(dir, name+".smaps")
+		if err := os.WriteFile(inputFilename, input, 0o600); err != nil {
+			return err
+		}
+		for _, format := range selftestFormats {
+			outputFilename := filepath.Join(dir, name+"."+format)
+			data, skip, convErr := selftestConvert(inputFilename, outputFilename, format)
+			if skip {
+				fmt.Fprintf(w, "skip %s %s: %v\n", name, format, convErr)
+				continue
+			}
+			checks++
+			var err error
+			if goldenDir != "" {
+				err = writeSelftestGolden(goldenDir, name, format, data, convErr)
+			} else {
+				err = verifySelftest(name, format, data, convErr, func() ([]byte, error) {
+					data, _, err := selftestConvert(inputFilename, outputFilename, format)
+					return data, err
+				})
+			}
+			if err != nil {
+				failed++
+				fmt.Fprintf(w, "FAIL %s %s: %v\n", name, format, err)
+				continue
+			}
+			fmt.Fprintf(w, "ok   %s %s\n", name, format)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d selftest checks failed", failed, checks)
+	}
+	return nil
+}
+
+// selftestConvert converts inputFilename to outputFilename in format with
+// -reproducible and returns the output. skip is true if format is left
+// out of the build.
+func selftestConvert(inputFilename, outputFilename, format string) (data []byte, skip bool, err error) {
+	fs := flag.NewFlagSet("selftest conversion", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-reproducible"}); err != nil {
+		return nil, false, err
+	}
+	a.format = format
+	a.inputFilename = inputFilename
+	a.outputFilename = outputFilename
+	if err := a.validateParquet(); err != nil {
+		return nil, true, err
+	}
+	if err := a.validate(fs); err != nil {
+		return nil, false, err
+	}
+	a.stats = &runStats{}
+	if err := run(a); err != nil {
+		return nil, false, err
+	}
+	data, err = os.ReadFile(outputFilename)
+	return data, false, err
+}
+
+// verifySelftest verifies the output data, or the error convErr, of the
+// conversion of the sample name to format. The outputs of the binary
+// formats are decoded and compared with the golden CSV output, and
+// checked to be equal to those of a second conversion by convertAgain.
+func verifySelftest(name, format string, data []byte, convErr error, convertAgain func() ([]byte, error)) error {
+	if decode := selftestDecoders[format]; decode != nil {
+		if convErr != nil {
+			return convErr
+		}
+		if err := checkSelftestDecoded(name, decode, data); err != nil {
+			return err
+		}
+		again, err := convertAgain()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(again, data) {
+			return errors.New("output differs between two conversions")
+		}
+		return nil
+	}
+
+	golden := path.Join(selftestDir, name+"."+format)
+	if want, err := selftestFiles.ReadFile(golden + ".err"); err == nil {
+		if convErr == nil {
+			return fmt.Errorf("conversion succeeded, want error %q", strings.TrimSpace(string(want)))
+		}
+		if got := convErr.Error(); got != strings.TrimSpace(string(want)) {
+			return fmt.Errorf("got error %q, want %q", got, strings.TrimSpace(string(want)))
+		}
+		return nil
+	}
+	if convErr != nil {
+		return convErr
+	}
+	want, err := selftestFiles.ReadFile(golden)
+	if err != nil {
+		return fmt.Errorf("no golden output: %w", err)
+	}
+	if !bytes.Equal(data, want) {
+		return fmt.Errorf("output differs from %s at line %d", golden, firstDifferentLine(data, want))
+	}
+	return nil
+}
+
+// firstDifferentLine returns the number of the first line which differs
+// between a and b, starting at 1.
+func firstDifferentLine(a, b []byte) int {
+	line := 1
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '\n' {
+			line++
+		}
+	}
+	return line
+}
+
+// writeSelftestGolden writes the output data, or the error convErr, of
+// the conversion of the sample name to format as its golden file in dir.
+// The binary formats have no golden files.
+func writeSelftestGolden(dir, name, format string, data []byte, convErr error) error {
+	if selftestDecoders[format] != nil {
+		return convErr
+	}
+	filename := filepath.Join(dir, name+"."+format)
+	if convErr != nil {
+		filename += ".err"
+		data = []byte(convErr.Error() + "\n")
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
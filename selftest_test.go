@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelftest(t *testing.T) {
+	var buf bytes.Buffer
+	if err := selftest(&buf, ""); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	for _, want := range []string{"ok   kernel-6 csv\n", "ok   android json\n", "ok   kernel-2.6 folded\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output must contain %q, got=%s", want, buf.String())
+		}
+	}
+}
+
+func TestSelftestWriteGolden(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	if err := selftest(&buf, dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"kernel-6.csv", "long-pathnames.ndjson", "kernel-2.6.folded.err"} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := selftestFiles.ReadFile(selftestDir + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs from the embedded golden file", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "kernel-6.parquet")); err == nil {
+		t.Error("binary formats must have no golden files")
+	}
+}
+
+func TestVerifySelftest(t *testing.T) {
+	golden, err := selftestFiles.ReadFile(selftestDir + "/kernel-6.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := bytes.Replace(golden, []byte("[heap]"), []byte("[stack]"), 1)
+	if err := verifySelftest("kernel-6", outputFormatCSV, changed, nil, nil); err == nil || !strings.Contains(err.Error(), "at line 5") {
+		t.Errorf("got error %v", err)
+	}
+	if err := verifySelftest("kernel-2.6", outputFormatFolded, []byte("[heap] 4\n"), nil, nil); err == nil {
+		t.Error("want an error for a conversion which must fail")
+	}
+	if err := verifySelftest("kernel-2.6", outputFormatFolded, nil, errors.New("other"), nil); err == nil {
+		t.Error("want an error for a different error")
+	}
+
+	again := func() ([]byte, error) { return []byte("PAR1 other PAR1"), nil }
+	if err := verifySelftest("kernel-6", outputFormatParquet, []byte("PAR1 data PAR1"), nil, again); err == nil {
+		t.Error("want an error for an output which is not reproducible")
+	}
+	if err := verifySelftest("kernel-6", outputFormatSQLite, []byte("not a database"), nil, again); err == nil {
+		t.Error("want an error for an output without the magic")
+	}
+}
+
+func TestVerifySelftestDecoded(t *testing.T) {
+	dir := t.TempDir()
+	input, err := selftestFiles.ReadFile(selftestDir + "/kernel-6.smaps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputFilename := filepath.Join(dir, "kernel-6.smaps")
+	if err := os.WriteFile(inputFilename, input, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{outputFormatSQLite, outputFormatParquet, outputFormatArrow, outputFormatXLSX} {
+		data, skip, err := selftestConvert(inputFilename, filepath.Join(dir, "kernel-6."+format), format)
+		if skip {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		again := func() ([]byte, error) { return data, nil }
+		if err := verifySelftest("kernel-6", format, data, nil, again); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+		// The output of another sample differs in the rows of the golden CSV.
+		if err := verifySelftest("android", format, data, nil, again); err == nil || !strings.Contains(err.Error(), "rows") {
+			t.Errorf("%s: got error %v for the golden output of another sample", format, err)
+		}
+		if err := verifySelftest("kernel-6", format, data[:len(data)/2], nil, again); err == nil {
+			t.Errorf("%s: want an error for a truncated output", format)
+		}
+	}
+}
@@ -0,0 +1,693 @@
+//go:build !minimal
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// selftestDecoders decode the outputs of the binary formats into the
+// values of a column, "" for null, so that selftest compares them with the
+// golden CSV output of the sample. They read the layouts the writers of
+// this tool write, e.g. a row group of a page per column of Parquet, and
+// may panic on malformed data, which selftest recovers from.
+var selftestDecoders = map[string]func(data []byte, column string) ([]string, error){
+	outputFormatSQLite:  decodeSelftestSQLite,
+	outputFormatParquet: decodeSelftestParquet,
+	outputFormatArrow:   decodeSelftestArrow,
+	outputFormatXLSX:    decodeSelftestXLSX,
+}
+
+// errSelftestNoColumn is the error of decoding a column not in the output.
+var errSelftestNoColumn = errors.New("column is not in the output")
+
+// decodeSelftestSQLite decodes the column of the table sqliteTable.
+func decodeSelftestSQLite(data []byte, column string) ([]string, error) {
+	if !bytes.HasPrefix(data, []byte("SQLite format 3\x00")) {
+		return nil, errors.New("missing SQLite header")
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	r := sqliteReader{data: data, pageSize: pageSize}
+	schema, err := r.table(1)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range schema {
+		if len(record) < 5 || record[0] != "table" || record[1] != sqliteTable {
+			continue
+		}
+		root, ok := record[3].(int64)
+		sql, _ := record[4].(string)
+		if !ok {
+			return nil, errors.New("invalid root page of the table")
+		}
+		i := indexOf(sqliteColumnNames(sql), column)
+		if i == -1 {
+			return nil, errSelftestNoColumn
+		}
+		rows, err := r.table(uint32(root))
+		if err != nil {
+			return nil, err
+		}
+		values := make([]string, len(rows))
+		for j, row := range rows {
+			if i < len(row) {
+				values[j] = selftestValue(row[i])
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("no table %s", sqliteTable)
+}
+
+// sqliteColumnNames returns the quoted column names of a CREATE TABLE
+// statement written by sqliteCreateTable.
+func sqliteColumnNames(sql string) []string {
+	_, defs, _ := strings.Cut(sql, "(")
+	var names []string
+	for len(defs) > 0 && defs[0] == '"' {
+		var name strings.Builder
+		i := 1
+		for i < len(defs) {
+			if defs[i] == '"' {
+				if i+1 < len(defs) && defs[i+1] == '"' {
+					name.WriteByte('"')
+					i += 2
+					continue
+				}
+				break
+			}
+			name.WriteByte(defs[i])
+			i++
+		}
+		names = append(names, name.String())
+		_, defs, _ = strings.Cut(defs[i:], ", ")
+	}
+	return names
+}
+
+// sqliteReader reads the table b-trees of a SQLite database without
+// reserved space in the pages.
+type sqliteReader struct {
+	data     []byte
+	pageSize int
+}
+
+func (r sqliteReader) page(n uint32) ([]byte, error) {
+	if n == 0 || int(n)*r.pageSize > len(r.data) {
+		return nil, fmt.Errorf("page %d is out of the database", n)
+	}
+	return r.data[int(n-1)*r.pageSize : int(n)*r.pageSize], nil
+}
+
+// table returns the records of the table b-tree at the page root in
+// order of rowid.
+func (r sqliteReader) table(root uint32) ([][]interface{}, error) {
+	page, err := r.page(root)
+	if err != nil {
+		return nil, err
+	}
+	offset := 0
+	if root == 1 {
+		offset = sqliteHeaderSize
+	}
+	n := int(binary.BigEndian.Uint16(page[offset+3:]))
+	var records [][]interface{}
+	switch page[offset] {
+	case sqliteInteriorTable:
+		children := make([]uint32, 0, n+1)
+		for i := 0; i < n; i++ {
+			cell := binary.BigEndian.Uint16(page[offset+12+2*i:])
+			children = append(children, binary.BigEndian.Uint32(page[cell:]))
+		}
+		children = append(children, binary.BigEndian.Uint32(page[offset+8:]))
+		for _, child := range children {
+			rs, err := r.table(child)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rs...)
+		}
+	case sqliteLeafTable:
+		for i := 0; i < n; i++ {
+			payload, err := r.payload(page[binary.BigEndian.Uint16(page[offset+8+2*i:]):])
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, decodeSQLiteRecord(payload))
+		}
+	default:
+		return nil, fmt.Errorf("invalid type %#x of page %d", page[offset], root)
+	}
+	return records, nil
+}
+
+// payload returns the payload of a cell of a table leaf page, following
+// its overflow pages.
+func (r sqliteReader) payload(cell []byte) ([]byte, error) {
+	size, k := readSQLiteVarint(cell)
+	_, m := readSQLiteVarint(cell[k:])
+	cell = cell[k+m:]
+	maxLocal := r.pageSize - 35
+	if int(size) <= maxLocal {
+		return cell[:size], nil
+	}
+	minLocal := (r.pageSize-12)*32/255 - 23
+	local := minLocal + (int(size)-minLocal)%(r.pageSize-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	payload := append([]byte(nil), cell[:local]...)
+	for next := binary.BigEndian.Uint32(cell[local:]); len(payload) < int(size); {
+		p, err := r.page(next)
+		if err != nil {
+			return nil, err
+		}
+		rest := int(size) - len(payload)
+		if rest > r.pageSize-4 {
+			rest = r.pageSize - 4
+		}
+		payload = append(payload, p[4:4+rest]...)
+		next = binary.BigEndian.Uint32(p)
+	}
+	return payload, nil
+}
+
+func readSQLiteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return v<<8 | uint64(b[8]), 9
+}
+
+// decodeSQLiteRecord decodes the values of a record: nil, int64, float64
+// or string.
+func decodeSQLiteRecord(payload []byte) []interface{} {
+	headerSize, k := readSQLiteVarint(payload)
+	header, body := payload[k:headerSize], payload[headerSize:]
+	var values []interface{}
+	for len(header) > 0 {
+		typ, n := readSQLiteVarint(header)
+		header = header[n:]
+		switch {
+		case typ == 0:
+			values = append(values, nil)
+		case typ == 8, typ == 9:
+			values = append(values, int64(typ-8))
+		case typ == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(body)))
+			body = body[8:]
+		case typ >= 12:
+			size := int(typ-12) / 2
+			values = append(values, string(body[:size]))
+			body = body[size:]
+		default:
+			size := []int{0, 1, 2, 3, 4, 6, 8}[typ]
+			v := int64(int8(body[0]))
+			for _, b := range body[1:size] {
+				v = v<<8 | int64(b)
+			}
+			values = append(values, v)
+			body = body[size:]
+		}
+	}
+	return values
+}
+
+// decodeSelftestParquet decodes the column of the first row group of a
+// Parquet file with a data page per column chunk, which may follow a
+// dictionary page.
+func decodeSelftestParquet(data []byte, column string) ([]string, error) {
+	if len(data) < 12 || !bytes.HasPrefix(data, []byte(parquetMagic)) || !bytes.HasSuffix(data, []byte(parquetMagic)) {
+		return nil, errors.New("missing Parquet magic")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta, err := (&thriftReader{b: data[len(data)-8-size : len(data)-8]}).readStruct()
+	if err != nil {
+		return nil, err
+	}
+	schema, _ := meta[2].([]interface{})
+	i := -1
+	// The first element is the root of the schema.
+	for j, elem := range schema[1:] {
+		if elem.(map[int]interface{})[4] == column {
+			i = j
+		}
+	}
+	if i == -1 {
+		return nil, errSelftestNoColumn
+	}
+	groups, _ := meta[4].([]interface{})
+	if len(groups) != 1 {
+		return nil, fmt.Errorf("%d row groups, want 1", len(groups))
+	}
+	cm := groups[0].(map[int]interface{})[1].([]interface{})[i].(map[int]interface{})[3].(map[int]interface{})
+	typ, codec := cm[1].(int64), cm[4].(int64)
+	var dict []string
+	if offset, ok := cm[11].(int64); ok {
+		header, page, err := readParquetPage(data[offset:], codec)
+		if err != nil {
+			return nil, err
+		}
+		dict, _, err = readParquetPlain(page, typ, int(header[7].(map[int]interface{})[1].(int64)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	header, page, err := readParquetPage(data[cm[9].(int64):], codec)
+	if err != nil {
+		return nil, err
+	}
+	dataHeader := header[5].(map[int]interface{})
+	numValues := int(dataHeader[1].(int64))
+	n := binary.LittleEndian.Uint32(page)
+	levels, body := page[4:4+n], page[4+n:]
+	var defined []bool
+	for len(levels) > 0 {
+		run, k := binary.Uvarint(levels)
+		if run&1 != 0 {
+			return nil, errors.New("bit-packed definition levels are not supported")
+		}
+		for j := 0; j < int(run>>1); j++ {
+			defined = append(defined, levels[k] == 1)
+		}
+		levels = levels[k+1:]
+	}
+	if len(defined) != numValues {
+		return nil, fmt.Errorf("%d definition levels of %d values", len(defined), numValues)
+	}
+	count := 0
+	for _, ok := range defined {
+		if ok {
+			count++
+		}
+	}
+	var nonNull []string
+	switch dataHeader[2].(int64) {
+	case parquetPlain:
+		if nonNull, _, err = readParquetPlain(body, typ, count); err != nil {
+			return nil, err
+		}
+	case parquetRLEDictionary:
+		width := int(body[0])
+		for body = body[1:]; len(body) > 0; {
+			run, k := binary.Uvarint(body)
+			if run&1 != 0 {
+				return nil, errors.New("bit-packed dictionary indexes are not supported")
+			}
+			var buf [8]byte
+			copy(buf[:], body[k:k+(width+7)/8])
+			body = body[k+(width+7)/8:]
+			for j := 0; j < int(run>>1); j++ {
+				nonNull = append(nonNull, dict[binary.LittleEndian.Uint64(buf[:])])
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encoding %d", dataHeader[2])
+	}
+	if len(nonNull) != count {
+		return nil, fmt.Errorf("%d values of %d non-null values", len(nonNull), count)
+	}
+	values := make([]string, len(defined))
+	for j, ok := range defined {
+		if ok {
+			values[j], nonNull = nonNull[0], nonNull[1:]
+		}
+	}
+	return values, nil
+}
+
+// readParquetPage reads the header of the page at the start of b and its
+// body decompressed with the codec.
+func readParquetPage(b []byte, codec int64) (map[int]interface{}, []byte, error) {
+	r := &thriftReader{b: b}
+	header, err := r.readStruct()
+	if err != nil {
+		return nil, nil, err
+	}
+	page := r.b[:header[3].(int64)]
+	if codec != parquetUncompressed {
+		if page, err = decompressSelftest(page); err != nil {
+			return nil, nil, err
+		}
+	}
+	if int64(len(page)) != header[2].(int64) {
+		return nil, nil, fmt.Errorf("page of %d bytes, want %d", len(page), header[2])
+	}
+	return header, page, nil
+}
+
+// readParquetPlain reads n values of typ in the PLAIN encoding and
+// returns them with the rest of b.
+func readParquetPlain(b []byte, typ int64, n int) ([]string, []byte, error) {
+	values := make([]string, n)
+	for i := range values {
+		switch typ {
+		case parquetInt64:
+			values[i] = selftestValue(int64(binary.LittleEndian.Uint64(b)))
+			b = b[8:]
+		case parquetDouble:
+			values[i] = selftestValue(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			b = b[8:]
+		case parquetByteArray:
+			size := binary.LittleEndian.Uint32(b)
+			values[i] = string(b[4 : 4+size])
+			b = b[4+size:]
+		default:
+			return nil, nil, fmt.Errorf("unsupported type %d", typ)
+		}
+	}
+	return values, b, nil
+}
+
+// thriftReader reads the Thrift compact protocol written by thriftWriter
+// into maps of field ids for structs and slices for lists.
+type thriftReader struct {
+	b []byte
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) readValue(typ int) (interface{}, error) {
+	switch typ {
+	case thriftI32, thriftI64:
+		v := r.uvarint()
+		return int64(v>>1) ^ -int64(v&1), nil
+	case thriftBinary:
+		n := r.uvarint()
+		s := string(r.b[:n])
+		r.b = r.b[n:]
+		return s, nil
+	case thriftList:
+		header := r.b[0]
+		r.b = r.b[1:]
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			v, err := r.readValue(int(header & 0x0f))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+	case thriftStruct:
+		return r.readStruct()
+	}
+	return nil, fmt.Errorf("unsupported thrift type %d", typ)
+}
+
+func (r *thriftReader) readStruct() (map[int]interface{}, error) {
+	fields := make(map[int]interface{})
+	id := 0
+	for {
+		header := r.b[0]
+		r.b = r.b[1:]
+		if header == 0 {
+			return fields, nil
+		}
+		if delta := int(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			v := r.uvarint()
+			id = int(int64(v>>1) ^ -int64(v&1))
+		}
+		v, err := r.readValue(int(header & 0x0f))
+		if err != nil {
+			return nil, err
+		}
+		fields[id] = v
+	}
+}
+
+// decodeSelftestArrow decodes the column of the record batches of an
+// Arrow IPC stream.
+func decodeSelftestArrow(data []byte, column string) ([]string, error) {
+	var fields []flatReader
+	i := -1
+	var values []string
+	for {
+		if len(data) < 8 || binary.LittleEndian.Uint32(data) != arrowContinuation {
+			return nil, errors.New("missing continuation marker")
+		}
+		size := int(binary.LittleEndian.Uint32(data[4:]))
+		if size == 0 {
+			if fields == nil {
+				return nil, errors.New("no schema")
+			}
+			return values, nil
+		}
+		msg := readFlatRoot(data[8 : 8+size])
+		bodyLength := int(msg.i64(3))
+		body := data[8+size : 8+size+bodyLength]
+		data = data[8+size+bodyLength:]
+		header := msg.table(2)
+		switch msg.u8(1) {
+		case arrowHeaderSchema:
+			fields = header.tables(1)
+			for j, f := range fields {
+				if f.str(0) == column {
+					i = j
+				}
+			}
+			if i == -1 {
+				return nil, errSelftestNoColumn
+			}
+		case arrowHeaderRecordBatch:
+			if fields == nil {
+				return nil, errors.New("record batch before the schema")
+			}
+			length := int(header.i64(0))
+			_, compressed := header.field(3)
+			buffers := header.structs(2)
+			// Each column has the buffers of the validity bitmap, the
+			// offsets of Utf8 and the values.
+			for _, f := range fields[:i] {
+				buffers = buffers[2:]
+				if f.u8(2) == arrowTypeUtf8 {
+					buffers = buffers[1:]
+				}
+			}
+			buffer := func() ([]byte, error) {
+				b := buffers[0]
+				buffers = buffers[1:]
+				data := body[b[0] : b[0]+b[1]]
+				if !compressed || len(data) == 0 {
+					return data, nil
+				}
+				if n := int64(binary.LittleEndian.Uint64(data)); n != -1 {
+					return decompressSelftest(data[8:])
+				}
+				return data[8:], nil
+			}
+			validity, err := buffer()
+			if err != nil {
+				return nil, err
+			}
+			typ := fields[i].u8(2)
+			var offsets []byte
+			if typ == arrowTypeUtf8 {
+				if offsets, err = buffer(); err != nil {
+					return nil, err
+				}
+			}
+			vals, err := buffer()
+			if err != nil {
+				return nil, err
+			}
+			for j := 0; j < length; j++ {
+				if len(validity) > 0 && validity[j/8]&(1<<(j%8)) == 0 {
+					values = append(values, "")
+					continue
+				}
+				switch typ {
+				case arrowTypeInt:
+					values = append(values, selftestValue(int64(binary.LittleEndian.Uint64(vals[8*j:]))))
+				case arrowTypeFloatingPoint:
+					values = append(values, selftestValue(math.Float64frombits(binary.LittleEndian.Uint64(vals[8*j:]))))
+				case arrowTypeUtf8:
+					values = append(values, string(vals[binary.LittleEndian.Uint32(offsets[4*j:]):binary.LittleEndian.Uint32(offsets[4*j+4:])]))
+				default:
+					return nil, fmt.Errorf("unsupported type %d", typ)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unsupported message type %d", msg.u8(1))
+		}
+	}
+}
+
+// flatReader reads a table of a FlatBuffer written by buildFlatBuffer.
+type flatReader struct {
+	b   []byte
+	pos int
+}
+
+func readFlatRoot(b []byte) flatReader {
+	return flatReader{b: b, pos: int(binary.LittleEndian.Uint32(b))}
+}
+
+// field returns the position of the field id, or false if it is absent.
+func (t flatReader) field(id int) (int, bool) {
+	vtable := t.pos - int(int32(binary.LittleEndian.Uint32(t.b[t.pos:])))
+	if 4+2*id >= int(binary.LittleEndian.Uint16(t.b[vtable:])) {
+		return 0, false
+	}
+	offset := int(binary.LittleEndian.Uint16(t.b[vtable+4+2*id:]))
+	return t.pos + offset, offset != 0
+}
+
+func (t flatReader) u8(id int) byte {
+	if p, ok := t.field(id); ok {
+		return t.b[p]
+	}
+	return 0
+}
+
+func (t flatReader) i64(id int) int64 {
+	if p, ok := t.field(id); ok {
+		return int64(binary.LittleEndian.Uint64(t.b[p:]))
+	}
+	return 0
+}
+
+// deref returns the position of the object the offset at p refers to.
+func (t flatReader) deref(p int) int {
+	return p + int(binary.LittleEndian.Uint32(t.b[p:]))
+}
+
+func (t flatReader) table(id int) flatReader {
+	p, _ := t.field(id)
+	return flatReader{b: t.b, pos: t.deref(p)}
+}
+
+func (t flatReader) str(id int) string {
+	p, ok := t.field(id)
+	if !ok {
+		return ""
+	}
+	p = t.deref(p)
+	return string(t.b[p+4 : p+4+int(binary.LittleEndian.Uint32(t.b[p:]))])
+}
+
+func (t flatReader) tables(id int) []flatReader {
+	p, ok := t.field(id)
+	if !ok {
+		return nil
+	}
+	p = t.deref(p)
+	tables := make([]flatReader, binary.LittleEndian.Uint32(t.b[p:]))
+	for i := range tables {
+		tables[i] = flatReader{b: t.b, pos: t.deref(p + 4 + 4*i)}
+	}
+	return tables
+}
+
+// structs returns the elements of a vector of structs of two 64-bit
+// integers, such as FieldNode and Buffer of Arrow.
+func (t flatReader) structs(id int) [][2]uint64 {
+	p, ok := t.field(id)
+	if !ok {
+		return nil
+	}
+	p = t.deref(p)
+	elems := make([][2]uint64, binary.LittleEndian.Uint32(t.b[p:]))
+	for i := range elems {
+		e := t.b[p+4+16*i:]
+		elems[i] = [2]uint64{binary.LittleEndian.Uint64(e), binary.LittleEndian.Uint64(e[8:])}
+	}
+	return elems
+}
+
+// decodeSelftestXLSX decodes the column of the worksheet of a workbook
+// whose first row is the header.
+func decodeSelftestXLSX(data []byte, column string) ([]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref   string `xml:"r,attr"`
+				Value string `xml:"v"`
+				Text  string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	f, err := zr.Open("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := xml.NewDecoder(f).Decode(&sheet); err != nil {
+		return nil, err
+	}
+	if len(sheet.Rows) == 0 {
+		return nil, errors.New("worksheet has no header row")
+	}
+	name := ""
+	for _, c := range sheet.Rows[0].Cells {
+		if c.Text == column {
+			name = strings.TrimRight(c.Ref, "0123456789")
+		}
+	}
+	if name == "" {
+		return nil, errSelftestNoColumn
+	}
+	values := make([]string, len(sheet.Rows)-1)
+	for j, row := range sheet.Rows[1:] {
+		ref := name + strconv.Itoa(j+2)
+		for _, c := range row.Cells {
+			if c.Ref == ref {
+				values[j] = c.Value + c.Text
+			}
+		}
+	}
+	return values, nil
+}
+
+// decompressSelftest decompresses a gzip or zstd frame.
+func decompressSelftest(data []byte) ([]byte, error) {
+	r, err := decompressReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// selftestValue formats a decoded value like the CSV output.
+func selftestValue(v interface{}) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return ""
+}
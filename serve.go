@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Formats of the response of the convert endpoint.
+const (
+	convertFormatCSV    = "csv"
+	convertFormatNDJSON = "ndjson"
+	convertFormatJSON   = "json"
+)
+
+// runServe runs the serve subcommand, an HTTP server which converts smaps
+// on behalf of other services.
+func runServe(arguments []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s serve [-listen <address>] [-grpc-listen <address>] [-tls-cert <file> -tls-key <file>] [-pprof] [conversion options]\n\n"+
+			"The HTTP address serves POST /convert, GET /pids/<pid>/smaps.csv, smaps.json and smaps.ndjson\n"+
+			"with -proc, and GET /healthz and /readyz for probes.\n"+
+			"Certificates are not obtained with ACME, but those renewed by an ACME client, e.g. certbot,\n"+
+			"are loaded again when -tls-cert is modified.\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	var args args
+	listen := fs.String("listen", "", "address to serve HTTP on, e.g. :8080")
+	grpcListen := fs.String("grpc-listen", "", "address to serve gRPC on, e.g. :9090")
+	maxBody := fs.String("max-body", "64M", "maximum size of a request body or gRPC request")
+	tlsCert := fs.String("tls-cert", "", "PEM certificate file to serve HTTPS and gRPC over TLS with, used with -tls-key")
+	tlsKey := fs.String("tls-key", "", "PEM private key file of -tls-cert")
+	tlsClientCA := fs.String("tls-client-ca", "", "PEM file of the CA certificates to verify client certificates with, requiring mutual TLS")
+	tokenFile := fs.String("auth-token-file", "", "file of the bearer tokens accepted in the Authorization header, one per line, required on all HTTP paths except /healthz and /readyz and on gRPC")
+	enablePprof := fs.Bool("pprof", false, "serve the profiles of net/http/pprof under /debug/pprof/ on the HTTP address")
+	enableProc := fs.Bool("proc", false, "serve GET /pids/<pid>/smaps.csv, smaps.json and smaps.ndjson converting /proc/<pid>/smaps of the processes on this host, which the user running the server can read; requires -auth-token-file or -tls-client-ca unless -listen is a loopback address")
+	cacheTTL := fs.Duration("cache-ttl", 0, "serve the responses of -proc from a cache for this duration, e.g. 5s, instead of reading the smaps of the process again, so that dashboards polling the endpoints do not read large processes repeatedly; the responses have an ETag for conditional requests regardless")
+	args.registerFlags(fs)
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if *listen == "" && *grpcListen == "" {
+		fs.Usage()
+		return errors.New("flag -listen or -grpc-listen must be set")
+	}
+	if err := args.validate(fs); err != nil {
+		return err
+	}
+	if err := args.validateServe(); err != nil {
+		return err
+	}
+	if *cacheTTL < 0 || *cacheTTL > 0 && !*enableProc {
+		return errors.New("-cache-ttl must be positive and requires -proc")
+	}
+	maxBodySize, err := parseByteSize(*maxBody)
+	if err != nil {
+		return fmt.Errorf("invalid -max-body: %w", err)
+	}
+	if err := args.prepare(); err != nil {
+		return err
+	}
+	sec, err := newServeSecurity(*tlsCert, *tlsKey, *tlsClientCA, *tokenFile)
+	if err != nil {
+		return err
+	}
+	if *enableProc {
+		if err := sec.checkProc(*listen); err != nil {
+			return err
+		}
+	}
+	if sec.tokens != nil && sec.tlsConfig == nil {
+		log.Print("warning: bearer tokens of -auth-token-file are sent in plain text without -tls-cert")
+	}
+
+	errc := make(chan error, 2)
+	s := &server{args: args, maxBodySize: maxBodySize, pprof: *enablePprof, proc: *enableProc}
+	if *cacheTTL > 0 {
+		s.cache = newResponseCache(*cacheTTL)
+	}
+	if *listen != "" {
+		ln, err := net.Listen("tcp", *listen)
+		if err != nil {
+			return err
+		}
+		hs := &http.Server{Handler: sec.handler(s.handler()), TLSConfig: sec.tlsConfig}
+		if sec.tlsConfig != nil {
+			log.Printf("serving HTTPS on %s", *listen)
+			go func() { errc <- hs.ServeTLS(ln, "", "") }()
+		} else {
+			log.Printf("serving HTTP on %s", *listen)
+			go func() { errc <- hs.Serve(ln) }()
+		}
+	}
+	if *grpcListen != "" {
+		ln, err := net.Listen("tcp", *grpcListen)
+		if err != nil {
+			return err
+		}
+		log.Printf("serving gRPC on %s", *grpcListen)
+		go func() { errc <- serveGRPC(ln, args, maxBodySize, sec) }()
+	}
+	// The server is ready once all its addresses are listened on.
+	s.setReady(true)
+	return <-errc
+}
+
+// validateServe rejects the options which need a live process or write
+// files, as the server converts request bodies.
+func (a *args) validateServe() error {
+	switch {
+	case a.dumpDir != "", a.hostPaths, a.resolveInodes, a.mountColumns, a.swapDevices, a.pagemap, a.pageContent > 0, a.mincore, a.threadStacks, a.numa, a.nsPid, a.cgroupPath, a.withProcInfo:
+		return errors.New("-dump-dir, -host-paths, -resolve-inodes, -mounts, -swap-devices, -pagemap, -page-content, -mincore, -thread-stacks, -numa, -ns-pid, -cgroup-path and -with-proc-info are not supported by serve")
+	case a.keepRawDir != "", a.teeRawPath != "", len(a.sinks) > 0, a.splitsOutput(), a.writeMeta, a.versionMeta == versionMetadataSidecar:
+		return errors.New("-keep-raw, -tee-raw, -sink, -max-rows, -max-size, -meta and -version-metadata sidecar are not supported by serve")
+	}
+	return nil
+}
+
+// server is the HTTP server of the serve subcommand.
+type server struct {
+	args        args
+	maxBodySize int64
+	// pprof enables the endpoints of net/http/pprof.
+	pprof bool
+	// proc enables the endpoints of the smaps of live processes.
+	proc bool
+	// cache is the cache of the responses of the smaps of live processes
+	// of -cache-ttl, or nil.
+	cache *responseCache
+	// ready is 1 while the server accepts conversions, accessed
+	// atomically.
+	ready int32
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/convert", s.handleConvert)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	if s.proc {
+		mux.HandleFunc("/pids/", s.handlePid)
+	}
+	if s.pprof {
+		// The handlers are registered on the server's own mux, as
+		// importing net/http/pprof registers them only on the default one.
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
+
+func (s *server) setReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&s.ready, v)
+}
+
+// handleHealthz responds with 200 as long as the process serves HTTP,
+// for liveness probes.
+func (s *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "ok\n")
+}
+
+// handleReadyz responds with 200 if the server accepts conversions and
+// 503 otherwise, for readiness probes of load balancers.
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&s.ready) == 0 {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "ok\n")
+}
+
+// handleConvert converts the smaps in the request body and responds with
+// CSV, or NDJSON if the format query parameter is "ndjson" or the Accept
+// header is application/x-ndjson, or a JSON array if it is "json".
+func (s *server) handleConvert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = convertFormatCSV
+		if strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+			format = convertFormatNDJSON
+		}
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, s.maxBodySize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > s.maxBodySize {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	resp, status, err := s.convert(format, body)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	resp.write(w)
+}
+
+// handlePid converts /proc/<pid>/smaps of a live process for GET
+// /pids/<pid>/smaps.<format>, where format is csv, json or ndjson.
+func (s *server) handlePid(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	pidStr, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/pids/"), "/")
+	pid, err := strconv.Atoi(pidStr)
+	base, format, _ := strings.Cut(name, ".")
+	if err != nil || pid <= 0 || base != smapsKindSmaps {
+		http.NotFound(w, r)
+		return
+	}
+	switch format {
+	case convertFormatCSV, convertFormatJSON, convertFormatNDJSON:
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	key := responseCacheKey{pid: pid, format: format}
+	if resp := s.cache.get(key); resp != nil {
+		resp.writeConditional(w, r)
+		return
+	}
+
+	file, err := os.Open(procPath(pid, smapsKindSmaps))
+	if err != nil {
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			http.Error(w, fmt.Sprintf("no process of pid %d", pid), http.StatusNotFound)
+		case errors.Is(err, os.ErrPermission):
+			http.Error(w, fmt.Sprintf("smaps of pid %d is not readable by the server", pid), http.StatusForbidden)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	defer file.Close()
+	// The smaps is read at once before converting it, so that it is a
+	// snapshot of the process as close as possible.
+	data, err := io.ReadAll(io.LimitReader(file, s.maxBodySize+1))
+	if err != nil {
+		// The process exited while being read.
+		http.Error(w, fmt.Sprintf("read smaps of pid %d: %v", pid, err), http.StatusNotFound)
+		return
+	}
+	if int64(len(data)) > s.maxBodySize {
+		http.Error(w, fmt.Sprintf("smaps of pid %d is larger than -max-body", pid), http.StatusInternalServerError)
+		return
+	}
+	resp, status, err := s.convert(format, data)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	resp.etag = responseETag(resp.body)
+	s.cache.put(key, resp)
+	resp.writeConditional(w, r)
+}
+
+// convertedResponse is the response of a conversion.
+type convertedResponse struct {
+	contentType string
+	body        []byte
+	// etag is the ETag of the body, or empty if it is not sent.
+	etag string
+}
+
+// write responds with r.
+func (r *convertedResponse) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", r.contentType)
+	if r.etag != "" {
+		w.Header().Set("ETag", r.etag)
+	}
+	if _, err := w.Write(r.body); err != nil {
+		log.Printf("warning: write response: %v", err)
+	}
+}
+
+// writeConditional responds with r, or with 304 without the body if the
+// If-None-Match header of req matches the ETag of r.
+func (r *convertedResponse) writeConditional(w http.ResponseWriter, req *http.Request) {
+	if etagMatches(req.Header.Get("If-None-Match"), r.etag) {
+		w.Header().Set("ETag", r.etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	r.write(w)
+}
+
+// convert converts the smaps in data to the format. The status is that
+// of the response of the error.
+func (s *server) convert(format string, data []byte) (resp *convertedResponse, status int, err error) {
+	var buf bytes.Buffer
+	var out recordWriter
+	var contentType string
+	switch format {
+	case convertFormatCSV:
+		out = s.args.csvDialect().newWriter(&buf)
+		contentType = "text/csv; charset=utf-8"
+	case convertFormatNDJSON, convertFormatJSON:
+		if s.args.numberFormat != nil {
+			return nil, http.StatusBadRequest, errors.New(format + " requires numbers with a '.' decimal separator and no thousands separator")
+		}
+		headerLines := 1
+		if s.args.versionMeta == versionMetadataComment {
+			headerLines++
+		}
+		nw := newNDJSONWriter(nopWriteCloser{&buf}, nil, headerLines)
+		nw.array = format == convertFormatJSON
+		out = nw
+		contentType = "application/x-ndjson"
+		if nw.array {
+			contentType = "application/json"
+		}
+	default:
+		return nil, http.StatusBadRequest, fmt.Errorf("unsupported format: %q", format)
+	}
+
+	if err := convertSmapsToCsv(out, bytes.NewReader(data), s.args.forRequest()); err != nil {
+		return nil, http.StatusUnprocessableEntity, err
+	}
+	if nw, ok := out.(*ndjsonWriter); ok {
+		// Close ends the array of json.
+		if err := nw.Close(); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+	return &convertedResponse{contentType: contentType, body: buf.Bytes()}, 0, nil
+}
+
+// forRequest returns a copy of the prepared options for converting one
+// request, with fresh state for the options which keep state during a
+// conversion.
+func (a args) forRequest() args {
+	if a.addressRebaser != nil {
+		a.addressRebaser = &addressRebaser{}
+	}
+	if a.compat != nil {
+		a.compat = newKernelCompatNormalizer()
+	}
+	if a.fieldChecker != nil {
+		a.fieldChecker = newFieldChecker(a.unknownFields, a.skipBadLines)
+	}
+	return a
+}
+
+// nopWriteCloser is an io.WriteCloser whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testSmapsSorted = `55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat
+Size:                  4 kB
+Rss:                   4 kB
+VmFlags: rd mr mw me
+55e000-55f000 r-xp 00001000 fe:00 1234                       /usr/bin/cat
+Size:                  4 kB
+Rss:                   0 kB
+VmFlags: rd ex mr mw me
+`
+
+func newTestServer(t *testing.T, flags ...string) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(newTestServerHandler(t, flags...).handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// newTestServerHandler returns a server with the conversion options of
+// flags.
+func newTestServerHandler(t *testing.T, flags ...string) *server {
+	t.Helper()
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse(flags); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.validate(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	return &server{args: a, maxBodySize: 1 << 20}
+}
+
+func TestServerConvert(t *testing.T) {
+	ts := newTestServer(t, "-rebase-addresses")
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Post(ts.URL+"/convert", "text/plain", strings.NewReader(testSmapsSorted))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		_, err = io.Copy(&b, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status mismatch, got=%d, body=%s", resp.StatusCode, b.String())
+		}
+		// Addresses are rebased on the first region of each request.
+		lines := strings.Split(b.String(), "\n")
+		if got, want := lines[2], "00001000,00002000,r-xp,00001000,fe:00,1234,/usr/bin/cat,4,0,rd ex mr mw me"; got != want {
+			t.Errorf("request %d: second record mismatch,\n got=%s,\nwant=%s", i, got, want)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/convert", strings.NewReader(testSmapsSorted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/x-ndjson")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got, want := resp.Header.Get("Content-Type"), "application/x-ndjson"; got != want {
+		t.Errorf("content type mismatch, got=%s, want=%s", got, want)
+	}
+}
+
+func TestServerConvertUnknownFieldsConcurrently(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	ts := newTestServer(t, "-unknown-fields", "drop")
+	body := strings.Replace(testSmapsSorted, "VmFlags: rd mr mw me\n", "FutureField:           4 kB\nVmFlags: rd mr mw me\n", 1)
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Post(ts.URL+"/convert", "text/plain", strings.NewReader(body))
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				b, _ := io.ReadAll(resp.Body)
+				errs <- fmt.Errorf("status mismatch, got=%d, body=%s", resp.StatusCode, b)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	// Each request warns about the dropped field.
+	if got := strings.Count(buf.String(), "dropped field FutureField"); got != n {
+		t.Errorf("warning count mismatch, got=%d, want=%d, log=%s", got, n, buf.String())
+	}
+}
+
+func TestServerConvertErrors(t *testing.T) {
+	ts := newTestServer(t)
+	testCases := []struct {
+		method string
+		query  string
+		body   string
+		want   int
+	}{
+		{method: http.MethodGet, want: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, query: "?format=xml", body: testSmapsUnsorted, want: http.StatusBadRequest},
+		{method: http.MethodPost, body: "Size: 4 kB\n", want: http.StatusUnprocessableEntity},
+	}
+	for _, tc := range testCases {
+		req, err := http.NewRequest(tc.method, ts.URL+"/convert"+tc.query, strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s %s: status mismatch, got=%d, want=%d", tc.method, tc.query, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+func TestServerPid(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	if err := os.MkdirAll(filepath.Join(procRoot, "9"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "9", "smaps"), []byte(testSmapsSorted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServerHandler(t)
+	s.proc = true
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	get := func(path string) (int, string, string) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	status, contentType, body := get("/pids/9/smaps.csv")
+	if status != http.StatusOK || contentType != "text/csv; charset=utf-8" {
+		t.Fatalf("csv: status=%d, content type=%s, body=%s", status, contentType, body)
+	}
+	if lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n"); len(lines) != 3 || !strings.HasSuffix(lines[2], "/usr/bin/cat,4,0,rd ex mr mw me") {
+		t.Errorf("csv mismatch, got=%s", body)
+	}
+
+	status, contentType, body = get("/pids/9/smaps.json")
+	if status != http.StatusOK || contentType != "application/json" {
+		t.Fatalf("json: status=%d, content type=%s, body=%s", status, contentType, body)
+	}
+	var objects []map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &objects); err != nil || len(objects) != 2 {
+		t.Errorf("json mismatch, err=%v, got=%s", err, body)
+	}
+
+	status, contentType, body = get("/pids/9/smaps.ndjson")
+	if status != http.StatusOK || contentType != "application/x-ndjson" || strings.Count(body, "\n") != 2 {
+		t.Errorf("ndjson: status=%d, content type=%s, body=%s", status, contentType, body)
+	}
+
+	for _, path := range []string{"/pids/10/smaps.csv", "/pids/x/smaps.csv", "/pids/9/smaps.xml", "/pids/9/maps.csv", "/pids/9"} {
+		if status, _, _ := get(path); status != http.StatusNotFound {
+			t.Errorf("%s: status mismatch, got=%d", path, status)
+		}
+	}
+
+	resp, err := http.Post(ts.URL+"/pids/9/smaps.csv", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status mismatch, got=%d", resp.StatusCode)
+	}
+
+	// The endpoints are disabled without -proc.
+	ts2 := newTestServer(t)
+	resp, err = http.Get(ts2.URL + "/pids/9/smaps.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("without -proc: status mismatch, got=%d", resp.StatusCode)
+	}
+}
+
+func TestServerProbes(t *testing.T) {
+	s := &server{maxBodySize: 1 << 20}
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+	get := func(path string) int {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := get("/healthz"); got != http.StatusOK {
+		t.Errorf("healthz status mismatch, got=%d, want=%d", got, http.StatusOK)
+	}
+	if got := get("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("readyz status before ready mismatch, got=%d, want=%d", got, http.StatusServiceUnavailable)
+	}
+	s.setReady(true)
+	if got := get("/readyz"); got != http.StatusOK {
+		t.Errorf("readyz status mismatch, got=%d, want=%d", got, http.StatusOK)
+	}
+	if got := get("/debug/pprof/"); got != http.StatusNotFound {
+		t.Errorf("pprof status without -pprof mismatch, got=%d, want=%d", got, http.StatusNotFound)
+	}
+
+	s.pprof = true
+	ts2 := httptest.NewServer(s.handler())
+	defer ts2.Close()
+	resp, err := http.Get(ts2.URL + "/debug/pprof/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("pprof status mismatch, got=%d, want=%d", resp.StatusCode, http.StatusOK)
+	}
+}
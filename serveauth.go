@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serveSecurity is the TLS and the authentication of the serve
+// subcommand. The zero value serves plain HTTP and gRPC without
+// authentication.
+type serveSecurity struct {
+	// tlsConfig is nil without TLS.
+	tlsConfig *tls.Config
+	// tokens are the bearer tokens accepted, or nil to accept requests
+	// without a token.
+	tokens []string
+}
+
+// newServeSecurity loads the certificate and key, the CA certificates of
+// the clients to verify with mutual TLS and the bearer tokens, each of
+// which is optional and given by an empty filename if not used.
+func newServeSecurity(certFile, keyFile, clientCAFile, tokenFile string) (*serveSecurity, error) {
+	s := &serveSecurity{}
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("-tls-cert and -tls-key must be used together")
+	}
+	if certFile != "" {
+		r := &certReloader{certFile: certFile, keyFile: keyFile}
+		if _, err := r.getCertificate(nil); err != nil {
+			return nil, err
+		}
+		s.tlsConfig = &tls.Config{GetCertificate: r.getCertificate, MinVersion: tls.VersionTLS12}
+	}
+	if clientCAFile != "" {
+		if s.tlsConfig == nil {
+			return nil, errors.New("-tls-client-ca requires -tls-cert and -tls-key")
+		}
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", clientCAFile)
+		}
+		s.tlsConfig.ClientCAs = pool
+		s.tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if tokenFile != "" {
+		tokens, err := readTokens(tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		s.tokens = tokens
+	}
+	return s, nil
+}
+
+// authenticates reports whether the clients are authenticated, by bearer
+// tokens or by client certificates of mutual TLS.
+func (s *serveSecurity) authenticates() bool {
+	return s.tokens != nil || s.tlsConfig != nil && s.tlsConfig.ClientCAs != nil
+}
+
+// checkProc rejects serving the smaps of the processes on this host with
+// -proc to anyone who can connect to listen, i.e. without authentication
+// unless listen is a loopback address.
+func (s *serveSecurity) checkProc(listen string) error {
+	if s.authenticates() || isLoopbackAddress(listen) {
+		return nil
+	}
+	return errors.New("-proc requires -auth-token-file or -tls-client-ca unless -listen is a loopback address, e.g. 127.0.0.1:8080")
+}
+
+// isLoopbackAddress reports whether the host of address is localhost or
+// a loopback IP address.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// certReloader loads the certificate and key again when the certificate
+// file is modified, e.g. renewed by an ACME client, without a restart.
+type certReloader struct {
+	certFile, keyFile string
+	mu                sync.Mutex
+	cert              *tls.Certificate
+	modTime           time.Time
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, err := os.Stat(r.certFile)
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, err
+	}
+	if r.cert != nil && info.ModTime().Equal(r.modTime) {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// The key may not be written yet while renewed.
+			log.Printf("warning: keep the TLS certificate: %v", err)
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	r.cert, r.modTime = &cert, info.ModTime()
+	return r.cert, nil
+}
+
+// readTokens reads the tokens in filename, one per line. Empty lines and
+// lines starting with # are ignored.
+func readTokens(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var tokens []string
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no tokens in %s", filename)
+	}
+	return tokens, nil
+}
+
+// authorized reports whether the value of an Authorization header is a
+// bearer token accepted by s, comparing the tokens in constant time.
+func (s *serveSecurity) authorized(authorization string) bool {
+	if s.tokens == nil {
+		return true
+	}
+	const prefix = "Bearer "
+	if len(authorization) < len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return false
+	}
+	token := []byte(authorization[len(prefix):])
+	ok := false
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// handler returns h requiring a bearer token on all paths except the
+// probes, which load balancers call without credentials.
+func (s *serveSecurity) handler(h http.Handler) http.Handler {
+	if s.tokens == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" && r.URL.Path != "/readyz" && !s.authorized(r.Header.Get("Authorization")) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+toolName+`"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its
+// key to dir and returns their filenames.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewServeSecurityErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _ := writeTestCert(t, dir)
+	emptyTokens := filepath.Join(dir, "tokens")
+	if err := os.WriteFile(emptyTokens, []byte("# none\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		certFile, keyFile, clientCAFile, tokenFile string
+		wantErr                                    string
+	}{
+		{certFile: certFile, wantErr: "-tls-cert and -tls-key must be used together"},
+		{clientCAFile: certFile, wantErr: "-tls-client-ca requires -tls-cert and -tls-key"},
+		{tokenFile: emptyTokens, wantErr: "no tokens in"},
+	}
+	for _, tc := range testCases {
+		_, err := newServeSecurity(tc.certFile, tc.keyFile, tc.clientCAFile, tc.tokenFile)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("error mismatch, got=%v, want=%s", err, tc.wantErr)
+		}
+	}
+}
+
+func TestServeSecurityCheckProc(t *testing.T) {
+	open := &serveSecurity{}
+	for _, listen := range []string{"127.0.0.1:8080", "[::1]:8080", "localhost:8080"} {
+		if err := open.checkProc(listen); err != nil {
+			t.Errorf("%s: got error: %v", listen, err)
+		}
+	}
+	for _, listen := range []string{":8080", "0.0.0.0:8080", "192.0.2.1:8080", ""} {
+		if err := open.checkProc(listen); err == nil {
+			t.Errorf("%s: got no error without authentication", listen)
+		}
+	}
+	tokens := &serveSecurity{tokens: []string{"secret"}}
+	mtls := &serveSecurity{tlsConfig: &tls.Config{ClientCAs: x509.NewCertPool()}}
+	for _, sec := range []*serveSecurity{tokens, mtls} {
+		if err := sec.checkProc(":8080"); err != nil {
+			t.Errorf("got error with authentication: %v", err)
+		}
+	}
+}
+
+func TestServeSecurityHTTPS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir)
+	tokenFile := filepath.Join(dir, "tokens")
+	if err := os.WriteFile(tokenFile, []byte("# tokens\nsecret1\nsecret2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sec, err := newServeSecurity(certFile, keyFile, certFile, tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServerHandler(t)
+	// httptest.Server is not used, as it sets its own certificate.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := &http.Server{Handler: sec.handler(s.handler()), TLSConfig: sec.tlsConfig, ErrorLog: log.New(io.Discard, "", 0)}
+	go hs.ServeTLS(ln, "", "")
+	defer hs.Close()
+	url := "https://" + ln.Addr().String()
+
+	pemData, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(pemData)
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(cert *tls.Certificate, path, token string) (int, error) {
+		t.Helper()
+		cfg := &tls.Config{RootCAs: pool}
+		if cert != nil {
+			cfg.Certificates = []tls.Certificate{*cert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		req, err := http.NewRequest(http.MethodPost, url+path, strings.NewReader(testSmapsSorted))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	if _, err := do(nil, "/convert", "secret1"); err == nil {
+		t.Error("expected an error without a client certificate")
+	}
+	testCases := []struct {
+		path, token string
+		want        int
+	}{
+		{path: "/convert", token: "secret2", want: http.StatusOK},
+		{path: "/convert", token: "wrong", want: http.StatusUnauthorized},
+		{path: "/convert", want: http.StatusUnauthorized},
+		{path: "/healthz", want: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		got, err := do(&clientCert, tc.path, tc.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("status mismatch for %s with %q, got=%d, want=%d", tc.path, tc.token, got, tc.want)
+		}
+	}
+}
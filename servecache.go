@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// responseCacheKey identifies a cached response of the smaps of a live
+// process.
+type responseCacheKey struct {
+	pid    int
+	format string
+}
+
+// responseCache caches the responses of the smaps of live processes for
+// -cache-ttl of serve, so that the smaps of a large process polled by
+// several dashboards is read once in the period. A pid reused by a new
+// process within the period gets the response of the old one, which is
+// why the period should be short.
+type responseCache struct {
+	ttl time.Duration
+	// now is time.Now, replaced in tests.
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[responseCacheKey]*cachedResponse
+}
+
+type cachedResponse struct {
+	resp    *convertedResponse
+	expires time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{ttl: ttl, now: time.Now, entries: make(map[responseCacheKey]*cachedResponse)}
+}
+
+// get returns the response of key cached within the period, or nil. It
+// returns nil if c is nil.
+func (c *responseCache) get(key responseCacheKey) *convertedResponse {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || !c.now().Before(e.expires) {
+		return nil
+	}
+	return e.resp
+}
+
+// put caches the response of key, removing the expired ones. It does
+// nothing if c is nil.
+func (c *responseCache) put(key responseCacheKey, resp *convertedResponse) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = &cachedResponse{resp: resp, expires: now.Add(c.ttl)}
+}
+
+// responseETag returns the strong ETag of a response body, which is the
+// same for the same conversion, so that a client polling a process whose
+// mappings are unchanged gets 304 Not Modified even after the cache
+// expires.
+func responseETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header matches etag, which
+// is compared weakly as RFC 9110 requires for If-None-Match.
+func etagMatches(header, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
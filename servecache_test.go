@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := newResponseCache(5 * time.Second)
+	c.now = func() time.Time { return now }
+	key := responseCacheKey{pid: 9, format: convertFormatCSV}
+	if got := c.get(key); got != nil {
+		t.Errorf("got %+v before put", got)
+	}
+	resp := &convertedResponse{body: []byte("a\n")}
+	c.put(key, resp)
+	now = now.Add(4 * time.Second)
+	if got := c.get(key); got != resp {
+		t.Errorf("got %+v within the period", got)
+	}
+	if got := c.get(responseCacheKey{pid: 9, format: convertFormatJSON}); got != nil {
+		t.Errorf("got %+v of another format", got)
+	}
+	now = now.Add(time.Second)
+	if got := c.get(key); got != nil {
+		t.Errorf("got %+v after the period", got)
+	}
+	c.put(responseCacheKey{pid: 10, format: convertFormatCSV}, resp)
+	if len(c.entries) != 1 {
+		t.Errorf("got %d entries, want the expired one removed", len(c.entries))
+	}
+
+	var nilCache *responseCache
+	nilCache.put(key, resp)
+	if got := nilCache.get(key); got != nil {
+		t.Errorf("got %+v from a nil cache", got)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := responseETag([]byte("a\n"))
+	if etag != responseETag([]byte("a\n")) || etag == responseETag([]byte("b\n")) {
+		t.Errorf("ETag must be determined by the body")
+	}
+	for _, tc := range []struct {
+		header string
+		want   bool
+	}{
+		{header: etag, want: true},
+		{header: "W/" + etag, want: true},
+		{header: `"x", ` + etag, want: true},
+		{header: "*", want: true},
+		{header: `"x"`, want: false},
+		{header: "", want: false},
+	} {
+		if got := etagMatches(tc.header, etag); got != tc.want {
+			t.Errorf("%q: got %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestServerPidCache(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	smapsPath := filepath.Join(procRoot, "9", "smaps")
+	if err := os.MkdirAll(filepath.Dir(smapsPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(smapsPath, []byte(testSmapsSorted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServerHandler(t)
+	s.proc = true
+	s.cache = newResponseCache(time.Hour)
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	get := func(ifNoneMatch string) (int, string, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/pids/9/smaps.csv", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, resp.Header.Get("ETag"), string(body)
+	}
+
+	status, etag, want := get("")
+	if status != http.StatusOK || etag == "" {
+		t.Fatalf("status=%d, ETag=%q, body=%s", status, etag, want)
+	}
+	// The cached response is served without reading the smaps.
+	if err := os.Remove(smapsPath); err != nil {
+		t.Fatal(err)
+	}
+	if status, gotETag, body := get(""); status != http.StatusOK || gotETag != etag || body != want {
+		t.Errorf("cached: status=%d, ETag=%q, body=%s", status, gotETag, body)
+	}
+	if status, gotETag, body := get(etag); status != http.StatusNotModified || gotETag != etag || body != "" {
+		t.Errorf("conditional: status=%d, ETag=%q, body=%s", status, gotETag, body)
+	}
+	if status, _, _ := get(`"other"`); status != http.StatusOK {
+		t.Errorf("conditional with another ETag: status=%d", status)
+	}
+}
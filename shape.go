@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Shapes of the output given by -shape.
+const (
+	shapeWide = "wide"
+	shapeLong = "long"
+)
+
+// validateShape checks the options of -shape long, whose value column
+// is in kB and whose columns are fixed.
+func (a *args) validateShape() error {
+	switch a.shape {
+	case "", shapeWide:
+		return nil
+	case shapeLong:
+	default:
+		return fmt.Errorf("unsupported -shape: %q", a.shape)
+	}
+	switch {
+	case a.units != unitsKB:
+		return errors.New("-shape long requires -units kB")
+	case a.columnList != "":
+		return errors.New("-columns cannot be used with -shape long")
+	}
+	return nil
+}
+
+// longShaper converts the wide records of mappings into long records, one
+// for each kB field with the FieldName and ValueKB columns, keyed by the
+// Timestamp, process, AddressStart and Pathname columns, or the Group
+// column of groups.
+type longShaper struct {
+	header []string
+	keys   []int
+	fields []int
+	names  []string
+}
+
+// newLongShaper returns the shaper of records with the wide header of m,
+// which starts with prefix columns such as Timestamp and Pid and whose kB
+// fields start at fieldStart.
+func newLongShaper(wide []string, m *mapping, prefix, fieldStart int) *longShaper {
+	s := &longShaper{}
+	for i, name := range wide[:fieldStart] {
+		if i < prefix || name == "AddressStart" || name == "Pathname" || name == "Group" {
+			s.keys = append(s.keys, i)
+			s.header = append(s.header, name)
+		}
+	}
+	s.header = append(s.header, "FieldName", "ValueKB")
+	for i, unit := range m.FieldUnits {
+		if unit == unitsKB {
+			s.fields = append(s.fields, fieldStart+i)
+			s.names = append(s.names, m.FieldNames[i])
+		}
+	}
+	return s
+}
+
+// records returns the long records of a wide record.
+func (s *longShaper) records(wide []string) [][]string {
+	records := make([][]string, 0, len(s.fields))
+	for j, i := range s.fields {
+		if i >= len(wide) {
+			break
+		}
+		record := make([]string, 0, len(s.header))
+		for _, k := range s.keys {
+			record = append(record, wide[k])
+		}
+		records = append(records, append(record, s.names[j], wide[i]))
+	}
+	return records
+}
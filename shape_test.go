@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestConvertLongShape(t *testing.T) {
+	testCases := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "regions",
+			args: args{shape: shapeLong},
+			want: "AddressStart,Pathname,FieldName,ValueKB\n" +
+				"55d000,/usr/bin/cat,KernelPageSize,4\n" +
+				"55d000,/usr/bin/cat,Rss,4\n" +
+				"55e000,[heap],KernelPageSize,4\n" +
+				"55e000,[heap],Rss,12\n" +
+				"7f0000000000,/usr/lib/libc.so.6,KernelPageSize,4\n" +
+				"7f0000000000,/usr/lib/libc.so.6,Rss,32\n",
+		},
+		{
+			name: "groups",
+			args: args{shape: shapeLong, groupBy: groupByPerms, totals: true},
+			want: "Group,FieldName,ValueKB\n" +
+				"r--p,Rss,36\n" +
+				"rw-p,Rss,12\n" +
+				"[total],Rss,48\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := tc.args
+			a.Separator, a.floatFormat = ",", defaultFloatFormat
+			var buf bytes.Buffer
+			if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(testTotalsInput), a); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateShape(t *testing.T) {
+	for _, arguments := range [][]string{
+		{"-shape", "tall"},
+		{"-shape", "long", "-units", "bytes"},
+		{"-shape", "long", "-columns", "Pathname,Rss"},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var a args
+		a.registerFlags(fs)
+		if err := fs.Parse(arguments); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.validate(fs); err == nil {
+			t.Errorf("want an error for %v", arguments)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of shared memory mappings in the shared memory report.
+const (
+	shmKindMemfd = "memfd"
+	shmKindPOSIX = "posix"
+	shmKindSysV  = "sysv"
+)
+
+// classifyShm returns the kind and name of the shared memory object of a
+// mapping pathname, or empty strings if it is not shared memory. The name
+// is the memfd name, the path under /dev/shm or the SysV IPC key.
+func classifyShm(pathname string) (kind, name string) {
+	pathname = strings.TrimSuffix(pathname, " (deleted)")
+	switch {
+	case strings.HasPrefix(pathname, "/memfd:"):
+		return shmKindMemfd, strings.TrimPrefix(pathname, "/memfd:")
+	case strings.HasPrefix(pathname, "/dev/shm/"):
+		return shmKindPOSIX, pathname
+	case strings.HasPrefix(pathname, "/SYSV"):
+		return shmKindSysV, "0x" + strings.TrimPrefix(pathname, "/SYSV")
+	}
+	return "", ""
+}
+
+// shmReportFields are the counters in the shared memory report, in kB.
+var shmReportFields = []string{
+	"Size", "Rss", "Pss", "Shared_Clean", "Shared_Dirty", "Private_Clean", "Private_Dirty", "Swap",
+}
+
+type shmMapping struct {
+	kind, name string
+	pid        int
+	region     []string
+	counters   []string
+}
+
+// shmReport collects memfd, POSIX and SysV shared memory mappings across
+// the inputs of a run, to slice out shared memory leaks.
+type shmReport struct {
+	mappings []shmMapping
+}
+
+// add adds m, which maps the shared memory object of the kind and name,
+// to the report. It must be called with the counters of the input, before
+// fields are selected.
+func (r *shmReport) add(kind, name string, pid int, m *mapping) {
+	sm := shmMapping{
+		kind: kind,
+		name: name,
+		pid:  pid,
+		region: []string{
+			string(m.Region.AddressStart),
+			string(m.Region.AddressEnd),
+			string(m.Region.Perms),
+		},
+	}
+	for _, field := range shmReportFields {
+		v, _ := m.fieldValue(field)
+		sm.counters = append(sm.counters, v)
+	}
+	r.mappings = append(r.mappings, sm)
+}
+
+// csv returns the report as CSV ordered by the kind and name of the
+// objects, so the mappings of an object by all processes are adjacent.
+func (r *shmReport) csv() ([]byte, error) {
+	sort.SliceStable(r.mappings, func(i, j int) bool {
+		a, b := r.mappings[i], r.mappings[j]
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		return a.pid < b.pid
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := append([]string{"Kind", "Name", "Pid", "AddressStart", "AddressEnd", "Perms"}, shmReportFields...)
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, sm := range r.mappings {
+		pid := ""
+		if sm.pid != 0 {
+			pid = strconv.Itoa(sm.pid)
+		}
+		record := append(append([]string{sm.kind, sm.name, pid}, sm.region...), sm.counters...)
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
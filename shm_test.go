@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestClassifyShm(t *testing.T) {
+	testCases := []struct {
+		pathname, kind, name string
+	}{
+		{pathname: "/memfd:wayland-shm (deleted)", kind: shmKindMemfd, name: "wayland-shm"},
+		{pathname: "/dev/shm/pulse-shm-1234", kind: shmKindPOSIX, name: "/dev/shm/pulse-shm-1234"},
+		{pathname: "/SYSV0000162e (deleted)", kind: shmKindSysV, name: "0x0000162e"},
+		{pathname: "/usr/lib/libc.so.6"},
+		{pathname: "[heap]"},
+	}
+	for _, tc := range testCases {
+		kind, name := classifyShm(tc.pathname)
+		if kind != tc.kind || name != tc.name {
+			t.Errorf("pathname=%q: result mismatch, got=(%q, %q), want=(%q, %q)", tc.pathname, kind, name, tc.kind, tc.name)
+		}
+	}
+}
+
+func TestShmReport(t *testing.T) {
+	input := `7f0000000000-7f0000100000 rw-s 00000000 00:01 2049                       /SYSV0000162e (deleted)
+Size:               1024 kB
+Rss:                 512 kB
+Pss:                 256 kB
+7f0000200000-7f0000201000 rw-s 00000000 00:01 4                          /memfd:wayland-shm (deleted)
+Size:                  4 kB
+Rss:                   4 kB
+Pss:                   4 kB
+7f0000300000-7f0000301000 r--p 00000000 fe:00 1234                       /usr/lib/libc.so.6
+Size:                  4 kB
+Rss:                   4 kB
+Pss:                   1 kB
+`
+	r := &shmReport{}
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", fieldNames: []string{"Rss"}, shmReport: r, inputFilename: "/proc/1234/smaps"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.csv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Kind,Name,Pid,AddressStart,AddressEnd,Perms,Size,Rss,Pss,Shared_Clean,Shared_Dirty,Private_Clean,Private_Dirty,Swap\n" +
+		"memfd,wayland-shm,1234,7f0000200000,7f0000201000,rw-s,4,4,4,,,,,\n" +
+		"sysv,0x0000162e,1234,7f0000000000,7f0000100000,rw-s,1024,512,256,,,,,\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
@@ -0,0 +1,611 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Formats of additional outputs given by -sink.
+const (
+	sinkFormatCSV    = "csv"
+	sinkFormatNDJSON = "ndjson"
+	sinkFormatProm   = "prom"
+)
+
+// sinkSpec is an additional output in the form format:destination, e.g.
+// "ndjson:unix:/run/collector.sock" or "prom:/var/lib/node_exporter/smaps.prom".
+type sinkSpec struct {
+	format string
+	// network is "unix" or "tcp" for a socket destination, or empty for
+	// a file.
+	network string
+	address string
+}
+
+func parseSinkSpec(s string) (sinkSpec, error) {
+	format, dest, ok := strings.Cut(s, ":")
+	if !ok || dest == "" {
+		return sinkSpec{}, fmt.Errorf("sink must be in the form format:destination: %q", s)
+	}
+	spec := sinkSpec{format: format, address: dest}
+	switch format {
+	case sinkFormatCSV, sinkFormatNDJSON, sinkFormatProm:
+	default:
+		return sinkSpec{}, fmt.Errorf("unsupported sink format: %q", format)
+	}
+	if network, address, ok := strings.Cut(dest, ":"); ok && (network == "unix" || network == "tcp") {
+		if format != sinkFormatNDJSON {
+			return sinkSpec{}, fmt.Errorf("only ndjson sinks can write to sockets: %q", s)
+		}
+		spec.network, spec.address = network, address
+	}
+	return spec, nil
+}
+
+// dir returns the directory of a file destination, or an empty string
+// for a socket.
+func (s sinkSpec) dir() string {
+	if s.network != "" {
+		return ""
+	}
+	return filepath.Dir(s.address)
+}
+
+// createSink creates the writer of the sink. headerLines is the number
+// of records before and including the header.
+func createSink(args args, spec sinkSpec, headerLines int) (outputWriter, error) {
+	if spec.format == sinkFormatCSV {
+		args.format = outputFormatCSV
+		args.compress = compressionOf(spec.address)
+		return createOutput(args, spec.address)
+	}
+
+	var out io.WriteCloser
+	var file *outputFile
+	if spec.network != "" {
+		conn, err := net.Dial(spec.network, spec.address)
+		if err != nil {
+			return nil, err
+		}
+		out = conn
+	} else {
+		opts := args.outputFileOptions
+		if spec.format == sinkFormatProm {
+			// The node_exporter textfile collector must not read
+			// partially written files.
+			opts.atomic = true
+		}
+		f, err := createOutputFile(spec.address, opts)
+		if err != nil {
+			return nil, err
+		}
+		file = f
+	}
+	if spec.format == sinkFormatNDJSON {
+		return newNDJSONWriter(out, file, headerLines), nil
+	}
+	return newPromWriter(file, headerLines), nil
+}
+
+// sinkOutput is the destination of a sink, which is either a connection
+// or an output file.
+type sinkOutput struct {
+	conn io.WriteCloser
+	file *outputFile
+}
+
+func (o sinkOutput) writer() io.Writer {
+	if o.conn != nil {
+		return o.conn
+	}
+	return o.file
+}
+
+func (o sinkOutput) files() []string {
+	if o.file == nil {
+		return nil
+	}
+	return []string{o.file.name}
+}
+
+func (o sinkOutput) commit() error {
+	if o.conn != nil {
+		return o.conn.Close()
+	}
+	return o.file.commit()
+}
+
+func (o sinkOutput) abort() {
+	if o.conn != nil {
+		o.conn.Close()
+		return
+	}
+	o.file.abort()
+}
+
+// headerRecords keeps the header of records written to a sink which
+// needs the column names.
+type headerRecords struct {
+	headerLines int
+	seen        int
+	header      []string
+}
+
+// take consumes record if it is a header record, reporting whether it
+// did.
+func (h *headerRecords) take(record []string) bool {
+	if h.seen >= h.headerLines {
+		return false
+	}
+	h.seen++
+	if h.seen == h.headerLines {
+		h.header = append([]string(nil), record...)
+	}
+	return true
+}
+
+// stringColumns are the columns written as JSON strings even if their
+// values look like numbers.
+var stringColumns = map[string]bool{
+	"Timestamp":    true,
+	"CgroupPath":   true,
+	"Comm":         true,
+	"Cmdline":      true,
+	"AddressStart": true,
+	"AddressEnd":   true,
+	"Perms":        true,
+	"Offset":       true,
+	"Dev":          true,
+	"Inode":        true,
+	"Pathname":     true,
+	"HostPath":     true,
+	"ResolvedPath": true,
+	"SourceFile":   true,
+	"MountPoint":   true,
+	"VmFlags":      true,
+	"ToolVersion":  true,
+}
+
+// ndjsonWriter writes records as JSON objects keyed by the column names,
+// one per line.
+type ndjsonWriter struct {
+	out     sinkOutput
+	bw      *bufio.Writer
+	headers headerRecords
+	// fieldColumns are the columns of kB fields, which are nested in a
+	// "Fields" object if nested is true.
+	nested       bool
+	fieldColumns map[string]bool
+	// typed writes the region columns in a "Region" object, the kB
+	// fields in a "Counters" object and VmFlags as an array of strings,
+	// instead of nesting the fields in "Fields".
+	typed bool
+	// emptyFields writes empty kB fields as empty strings instead of
+	// null, for -null-as empty.
+	emptyFields bool
+	// array writes the objects as elements of a JSON array instead of
+	// one per line.
+	array   bool
+	objects int
+	err     error
+}
+
+func newNDJSONWriter(conn io.WriteCloser, file *outputFile, headerLines int) *ndjsonWriter {
+	w := &ndjsonWriter{out: sinkOutput{conn: conn, file: file}, headers: headerRecords{headerLines: headerLines}}
+	w.bw = bufio.NewWriter(w.out.writer())
+	return w
+}
+
+func (w *ndjsonWriter) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.headers.take(record) {
+		return nil
+	}
+	if w.typed {
+		return w.writeObject(w.typedObject(record))
+	}
+	var members, fields [][]byte
+	fieldsIndex := -1
+	for i, value := range record {
+		name := ""
+		if i < len(w.headers.header) {
+			name = w.headers.header[i]
+		}
+		if w.nested && w.fieldColumns[name] {
+			if fieldsIndex == -1 {
+				fieldsIndex = len(members)
+				members = append(members, nil)
+			}
+			fields = append(fields, w.appendFieldMember(nil, name, value))
+			continue
+		}
+		members = append(members, appendJSONMember(nil, name, value))
+	}
+	if fieldsIndex != -1 {
+		m := appendJSONString(nil, "Fields")
+		m = append(m, ":{"...)
+		m = append(m, bytes.Join(fields, []byte{','})...)
+		members[fieldsIndex] = append(m, '}')
+	}
+	b := append([]byte{'{'}, bytes.Join(members, []byte{','})...)
+	return w.writeObject(append(b, '}'))
+}
+
+// writeObject writes an encoded object as an element of the array or a
+// line.
+func (w *ndjsonWriter) writeObject(b []byte) error {
+	if w.array {
+		sep := ",\n"
+		if w.objects == 0 {
+			sep = "[\n"
+		}
+		b = append([]byte(sep), b...)
+	} else {
+		b = append(b, '\n')
+	}
+	w.objects++
+	if _, err := w.bw.Write(b); err != nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// typedRegionColumns are the columns in the "Region" object of the
+// typed JSON layout.
+var typedRegionColumns = map[string]bool{
+	"AddressStart": true,
+	"AddressEnd":   true,
+	"Perms":        true,
+	"Offset":       true,
+	"Dev":          true,
+	"Inode":        true,
+	"Pathname":     true,
+	"HostPath":     true,
+	"ResolvedPath": true,
+	"MountPoint":   true,
+	"FsType":       true,
+	"StackThread":  true,
+	"Category":     true,
+	"AnonName":     true,
+	"IsDeleted":    true,
+	"BackingType":  true,
+	"RegionSize":   true,
+	"RegionKey":    true,
+}
+
+// typedObject returns the object of record in the typed layout, with the
+// other columns as members before the Region and Counters objects.
+func (w *ndjsonWriter) typedObject(record []string) []byte {
+	var members, region, counters [][]byte
+	for i, value := range record {
+		name := ""
+		if i < len(w.headers.header) {
+			name = w.headers.header[i]
+		}
+		switch {
+		case typedRegionColumns[name]:
+			region = append(region, appendJSONMember(nil, name, value))
+		case w.fieldColumns[name]:
+			counters = append(counters, w.appendFieldMember(nil, name, value))
+		case name == "VmFlags":
+			flags := strings.Fields(value)
+			if flags == nil {
+				flags = []string{}
+			}
+			m := appendJSONString(nil, name)
+			data, _ := json.Marshal(flags)
+			members = append(members, append(append(m, ':'), data...))
+		default:
+			members = append(members, appendJSONMember(nil, name, value))
+		}
+	}
+	for _, o := range []struct {
+		name    string
+		members [][]byte
+	}{{"Region", region}, {"Counters", counters}} {
+		if o.members == nil {
+			continue
+		}
+		m := appendJSONString(nil, o.name)
+		m = append(m, ":{"...)
+		m = append(m, bytes.Join(o.members, []byte{','})...)
+		members = append(members, append(m, '}'))
+	}
+	b := append([]byte{'{'}, bytes.Join(members, []byte{','})...)
+	return append(b, '}')
+}
+
+// appendJSONMember appends a member of a JSON object.
+func appendJSONMember(b []byte, name, value string) []byte {
+	b = appendJSONString(b, name)
+	b = append(b, ':')
+	switch {
+	case value == "":
+		b = append(b, "null"...)
+	case !stringColumns[name] && isJSONNumber(value):
+		b = append(b, value...)
+	default:
+		b = appendJSONString(b, value)
+	}
+	return b
+}
+
+// appendFieldMember appends a member of a kB field.
+func (w *ndjsonWriter) appendFieldMember(b []byte, name, value string) []byte {
+	if value == "" && w.emptyFields {
+		b = appendJSONString(b, name)
+		return append(b, `:""`...)
+	}
+	return appendJSONMember(b, name, value)
+}
+
+func (w *ndjsonWriter) setFieldColumns(names []string) {
+	w.fieldColumns = make(map[string]bool, len(names))
+	for _, name := range names {
+		w.fieldColumns[name] = true
+	}
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	data, _ := json.Marshal(s)
+	return append(b, data...)
+}
+
+// isJSONNumber reports whether s is a decimal number which is also valid
+// as a JSON number, i.e. without redundant leading zeros.
+func isJSONNumber(s string) bool {
+	if !isDecimalNumber(s) || strings.HasSuffix(s, ".") {
+		return false
+	}
+	digits := strings.TrimPrefix(s, "-")
+	return !(len(digits) > 1 && digits[0] == '0' && digits[1] != '.') && digits[0] != '.'
+}
+
+func (w *ndjsonWriter) Flush() {
+	if err := w.bw.Flush(); err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *ndjsonWriter) Error() error {
+	return w.err
+}
+
+func (w *ndjsonWriter) Close() error {
+	if w.array && w.err == nil {
+		end := "\n]\n"
+		if w.objects == 0 {
+			end = "[]\n"
+		}
+		if _, err := w.bw.WriteString(end); err != nil {
+			w.err = err
+		}
+	}
+	w.Flush()
+	if w.err != nil {
+		w.out.abort()
+		return w.err
+	}
+	return w.out.commit()
+}
+
+func (w *ndjsonWriter) Abort() {
+	w.out.abort()
+}
+
+func (w *ndjsonWriter) Files() []string {
+	return w.out.files()
+}
+
+// promMetrics are the columns aggregated per pathname by promWriter and
+// the names of their metrics.
+var promMetrics = []struct {
+	column string
+	name   string
+}{
+	{column: "Rss", name: "smaps_rss_bytes"},
+	{column: "Pss", name: "smaps_pss_bytes"},
+	{column: "Swap", name: "smaps_swap_bytes"},
+}
+
+// promWriter aggregates the Rss, Pss and Swap columns per pathname and
+// writes them as Prometheus metrics in the text format, e.g. for the
+// node_exporter textfile collector.
+type promWriter struct {
+	file    *outputFile
+	headers headerRecords
+	// sums are the sums of promMetrics per pathname in kB.
+	sums map[string][]float64
+	err  error
+}
+
+func newPromWriter(file *outputFile, headerLines int) *promWriter {
+	return &promWriter{
+		file:    file,
+		headers: headerRecords{headerLines: headerLines},
+		sums:    make(map[string][]float64),
+	}
+}
+
+func (w *promWriter) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.headers.take(record) {
+		return nil
+	}
+	header := w.headers.header
+	pathIndex := indexOf(header, "Pathname")
+	if pathIndex == -1 || pathIndex >= len(record) {
+		w.err = errors.New("prom sink requires the Pathname column")
+		return w.err
+	}
+	pathname := record[pathIndex]
+	sums, ok := w.sums[pathname]
+	if !ok {
+		sums = make([]float64, len(promMetrics))
+		w.sums[pathname] = sums
+	}
+	for i, metric := range promMetrics {
+		j := indexOf(header, metric.column)
+		if j == -1 || j >= len(record) {
+			continue
+		}
+		v, err := strconv.ParseFloat(record[j], 64)
+		if err != nil {
+			continue
+		}
+		sums[i] += v
+	}
+	return nil
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (w *promWriter) Flush() {}
+
+func (w *promWriter) Error() error {
+	return w.err
+}
+
+// Close writes the metrics and commits the file.
+func (w *promWriter) Close() error {
+	if w.err != nil {
+		w.file.abort()
+		return w.err
+	}
+	pathnames := make([]string, 0, len(w.sums))
+	for pathname := range w.sums {
+		pathnames = append(pathnames, pathname)
+	}
+	sort.Strings(pathnames)
+
+	bw := bufio.NewWriter(w.file)
+	for i, metric := range promMetrics {
+		fmt.Fprintf(bw, "# HELP %s Sum of %s of the regions per pathname.\n", metric.name, metric.column)
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", metric.name)
+		for _, pathname := range pathnames {
+			fmt.Fprintf(bw, "%s{pathname=%s} %s\n", metric.name, strconv.Quote(pathname),
+				strconv.FormatFloat(w.sums[pathname][i]*1024, 'f', -1, 64))
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		w.file.abort()
+		return err
+	}
+	return w.file.commit()
+}
+
+func (w *promWriter) Abort() {
+	w.file.abort()
+}
+
+func (w *promWriter) Files() []string {
+	return []string{w.file.name}
+}
+
+// multiWriter writes records to all of its writers.
+type multiWriter []outputWriter
+
+func (mw multiWriter) Write(record []string) error {
+	for _, w := range mw {
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mw multiWriter) setFieldColumns(names []string) {
+	for _, w := range mw {
+		if s, ok := w.(fieldColumnsSetter); ok {
+			s.setFieldColumns(names)
+		}
+	}
+}
+
+func (mw multiWriter) Flush() {
+	for _, w := range mw {
+		w.Flush()
+	}
+}
+
+func (mw multiWriter) Error() error {
+	for _, w := range mw {
+		if err := w.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all writers. Writers after a failing one are aborted.
+func (mw multiWriter) Close() error {
+	for i, w := range mw {
+		if err := w.Close(); err != nil {
+			for _, w := range mw[i+1:] {
+				w.Abort()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (mw multiWriter) Abort() {
+	for _, w := range mw {
+		w.Abort()
+	}
+}
+
+func (mw multiWriter) Files() []string {
+	var names []string
+	for _, w := range mw {
+		names = append(names, w.Files()...)
+	}
+	return names
+}
+
+// createOutputs creates the output file and the additional sinks, which
+// are written at once.
+func createOutputs(args args, filename string) (outputWriter, error) {
+	w, err := createOutput(args, filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(args.sinks) == 0 {
+		return w, nil
+	}
+	headerLines := 1
+	if args.versionMeta == versionMetadataComment {
+		headerLines++
+	}
+	writers := multiWriter{w}
+	for _, spec := range args.sinks {
+		sw, err := createSink(args, spec, headerLines)
+		if err != nil {
+			writers.Abort()
+			return nil, fmt.Errorf("create sink %s:%s: %w", spec.format, spec.address, err)
+		}
+		writers = append(writers, sw)
+	}
+	return writers, nil
+}
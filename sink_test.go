@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSinkSpec(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want sinkSpec
+	}{
+		{in: "csv:out.csv", want: sinkSpec{format: sinkFormatCSV, address: "out.csv"}},
+		{in: "ndjson:unix:/run/c.sock", want: sinkSpec{format: sinkFormatNDJSON, network: "unix", address: "/run/c.sock"}},
+		{in: "ndjson:tcp:localhost:9000", want: sinkSpec{format: sinkFormatNDJSON, network: "tcp", address: "localhost:9000"}},
+		{in: "prom:/var/lib/smaps.prom", want: sinkSpec{format: sinkFormatProm, address: "/var/lib/smaps.prom"}},
+	}
+	for _, tc := range testCases {
+		got, err := parseSinkSpec(tc.in)
+		if err != nil {
+			t.Errorf("in=%s: %v", tc.in, err)
+		} else if got != tc.want {
+			t.Errorf("in=%s: result mismatch, got=%+v, want=%+v", tc.in, got, tc.want)
+		}
+	}
+	for _, in := range []string{"out.csv", "xml:out.xml", "prom:tcp:localhost:9000", "csv:"} {
+		if _, err := parseSinkSpec(in); err == nil {
+			t.Errorf("in=%s: expected error", in)
+		}
+	}
+}
+
+func TestConvertSmapsToCsvSinks(t *testing.T) {
+	dir := t.TempDir()
+	a := args{
+		floatFormat:       defaultFloatFormat,
+		Separator:         ",",
+		units:             unitsKB,
+		decimalSep:        ".",
+		outputFileOptions: outputFileOptions{atomic: true},
+		sinks: []sinkSpec{
+			{format: sinkFormatNDJSON, address: filepath.Join(dir, "out.ndjson")},
+			{format: sinkFormatProm, address: filepath.Join(dir, "out.prom")},
+		},
+	}
+	w, err := createOutputs(a, filepath.Join(dir, "out.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Abort()
+	if err := convertSmapsToCsv(w, strings.NewReader(testSmapsUnsorted), a); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "out.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if got, want := len(lines), 3; got != want {
+		t.Fatalf("line count mismatch, got=%d, want=%d", got, want)
+	}
+	want := `{"AddressStart":"7ffd0000","AddressEnd":"7ffd1000","Perms":"rw-p","Offset":"00000000","Dev":"00:00","Inode":"0","Pathname":"[stack]","Size":4,"Rss":4,"VmFlags":"rd wr mr mw me gd ac"}`
+	if lines[0] != want {
+		t.Errorf("first line mismatch,\n got=%s,\nwant=%s", lines[0], want)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "out.prom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`smaps_rss_bytes{pathname="/usr/bin/cat"} 4096` + "\n",
+		`smaps_rss_bytes{pathname="[stack]"} 4096` + "\n",
+		"# TYPE smaps_pss_bytes gauge\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("prom output must contain %q, got=%s", want, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.csv")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIsJSONNumber(t *testing.T) {
+	for in, want := range map[string]bool{"0": true, "12": true, "-1.5": true, "0.5": true, "007": false, "1.": false, ".5": false, "": false, "1e3": false} {
+		if got := isJSONNumber(in); got != want {
+			t.Errorf("in=%q: result mismatch, got=%v, want=%v", in, got, want)
+		}
+	}
+}
+
+func TestCreateOutputFormat(t *testing.T) {
+	first := `{"AddressStart":"55d000","AddressEnd":"55e000","Perms":"r--p","Offset":"00000000","Dev":"fe:00","Inode":"1234","Pathname":"/usr/bin/cat","Fields":{"Size":4,"Rss":4},"VmFlags":"rd mr mw me"}`
+	second := `{"AddressStart":"55e000","AddressEnd":"55f000","Perms":"r-xp","Offset":"00001000","Dev":"fe:00","Inode":"1234","Pathname":"/usr/bin/cat","Fields":{"Size":4,"Rss":0},"VmFlags":"rd ex mr mw me"}`
+	typed := `{"VmFlags":["rd","mr","mw","me"],"Region":{"AddressStart":"55d000","AddressEnd":"55e000","Perms":"r--p","Offset":"00000000","Dev":"fe:00","Inode":"1234","Pathname":"/usr/bin/cat"},"Counters":{"Size":4,"Rss":4}}`
+	testCases := []struct {
+		format     string
+		jsonLayout string
+		input      string
+		want       string
+	}{
+		{format: outputFormatNDJSON, input: testSmapsSorted, want: first + "\n" + second + "\n"},
+		{format: outputFormatJSON, input: testSmapsSorted, want: "[\n" + first + ",\n" + second + "\n]\n"},
+		{format: outputFormatJSON, want: "[]\n"},
+		{format: outputFormatNDJSON, jsonLayout: jsonLayoutTyped, input: testSmapsSorted, want: typed + "\n"},
+	}
+	for _, tc := range testCases {
+		filename := filepath.Join(t.TempDir(), "out")
+		a := args{floatFormat: defaultFloatFormat, Separator: ",", format: tc.format, jsonLayout: tc.jsonLayout}
+		w, err := createOutput(a, filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := convertSmapsToCsv(w, strings.NewReader(tc.input), a); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.jsonLayout == jsonLayoutTyped {
+			got, _, _ = bytes.Cut(got, []byte("\n"))
+			got = append(got, '\n')
+		}
+		if string(got) != tc.want {
+			t.Errorf("format=%s: result mismatch,\n got=%s,\nwant=%s", tc.format, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package smaps
+
+import "errors"
+
+// ErrKBSyntax is the error of ParseKB for values which are not sizes in kB.
+var ErrKBSyntax = errors.New("not a size in kB")
+
+// ErrKBRange is the error of ParseKB for sizes which overflow a uint64.
+var ErrKBRange = errors.New("size in kB out of range")
+
+// ParseKB parses a size in kB of a field, either its value, e.g. "1234",
+// or the value with the unit as in the field lines, e.g. "1234 kB", with
+// any spaces around them. Unlike strconv, it accepts only the decimal
+// digits the kernel writes, without signs, separators or exponents, so
+// that it does not depend on the locale of whoever wrote the input, and it
+// does not allocate, so that it can be called for every field of every
+// mapping.
+func ParseKB(s string) (uint64, error) {
+	i := 0
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	start := i
+	var n uint64
+	for ; i < len(s) && '0' <= s[i] && s[i] <= '9'; i++ {
+		d := uint64(s[i] - '0')
+		if n > (1<<64-1-d)/10 {
+			return 0, ErrKBRange
+		}
+		n = n*10 + d
+	}
+	if i == start {
+		return 0, ErrKBSyntax
+	}
+	j := i
+	for j < len(s) && s[j] == ' ' {
+		j++
+	}
+	if j > i && len(s)-j >= len(unitKB) && s[j:j+len(unitKB)] == unitKB {
+		j += len(unitKB)
+		for j < len(s) && s[j] == ' ' {
+			j++
+		}
+	}
+	if j != len(s) {
+		return 0, ErrKBSyntax
+	}
+	return n, nil
+}
+
+const unitKB = "kB"
+
+// KB returns the size of f in kB, and whether f is a valid size in kB.
+func (f Field) KB() (uint64, bool) {
+	if f.Unit != unitKB {
+		return 0, false
+	}
+	n, err := ParseKB(f.Value)
+	return n, err == nil
+}
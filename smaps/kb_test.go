@@ -0,0 +1,69 @@
+package smaps
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseKB(t *testing.T) {
+	for _, tc := range []struct {
+		s       string
+		want    uint64
+		wantErr error
+	}{
+		{s: "0", want: 0},
+		{s: "1234", want: 1234},
+		{s: "1234 kB", want: 1234},
+		{s: "   1234 kB ", want: 1234},
+		{s: "18446744073709551615", want: 1<<64 - 1},
+		{s: "18446744073709551616", wantErr: ErrKBRange},
+		{s: "", wantErr: ErrKBSyntax},
+		{s: " kB", wantErr: ErrKBSyntax},
+		{s: "-4", wantErr: ErrKBSyntax},
+		{s: "+4", wantErr: ErrKBSyntax},
+		{s: "4.5", wantErr: ErrKBSyntax},
+		{s: "1,234", wantErr: ErrKBSyntax},
+		{s: "1e3", wantErr: ErrKBSyntax},
+		{s: "4kB", wantErr: ErrKBSyntax},
+		{s: "4 MB", wantErr: ErrKBSyntax},
+		{s: "4 kB kB", wantErr: ErrKBSyntax},
+	} {
+		got, err := ParseKB(tc.s)
+		if !errors.Is(err, tc.wantErr) || got != tc.want {
+			t.Errorf("%q: got %d, %v, want %d, %v", tc.s, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestParseKBAllocs(t *testing.T) {
+	if n := testing.AllocsPerRun(100, func() {
+		ParseKB("1234 kB")
+		ParseKB("x")
+	}); n != 0 {
+		t.Errorf("got %v allocations, want none", n)
+	}
+}
+
+func TestFieldKB(t *testing.T) {
+	if got, ok := (Field{Name: "Rss", Value: "8", Unit: "kB"}).KB(); !ok || got != 8 {
+		t.Errorf("got %d, %v", got, ok)
+	}
+	for _, f := range []Field{
+		{Name: "VmFlags", Value: "rd mr"},
+		{Name: "THPeligible", Value: "0"},
+		{Name: "Rss", Value: "", Unit: "kB"},
+	} {
+		if _, ok := f.KB(); ok {
+			t.Errorf("%+v: got a size", f)
+		}
+	}
+}
+
+func BenchmarkParseKB(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseKB("123456"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+// Package smaps parses the /proc/<pid>/smaps file format of Linux.
+//
+// A smaps file is a sequence of mappings, each of which consists of a
+// region line like the lines of /proc/<pid>/maps followed by field lines
+// of the memory counters of the region:
+//
+//	55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat
+//	Size:                  4 kB
+//	Rss:                   4 kB
+//	VmFlags: rd mr mw me
+//
+// See https://docs.kernel.org/filesystems/proc.html for the fields.
+//
+// Inputs are listed and read from a Source, e.g. the live processes in
+// ProcSource, the hosts of SSHSource or an archive of TarSource.
+package smaps
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ErrBadFormat is the error for malformed lines, which is wrapped by the
+// Err of a ParseError with a description of what is malformed.
+var ErrBadFormat = errors.New("bad format")
+
+// ErrLineTooLong is the error for lines longer than MaxLineBytes.
+var ErrLineTooLong = errors.New("line too long")
+
+// MaxLineBytes is the upper limit of the length of a line. It bounds the
+// memory used for malformed input without newlines.
+const MaxLineBytes = 1 << 20
+
+// Steps of parsing in a ParseError.
+const (
+	// StepRegion is parsing a region line.
+	StepRegion = "region"
+	// StepField is parsing a field line.
+	StepField = "field"
+)
+
+// ParseError is the error for a malformed line.
+type ParseError struct {
+	// Line is the 1-based line number.
+	Line int
+	// Column is the 1-based byte offset in the line where the malformed
+	// part starts, or zero if it is unknown.
+	Column int
+	// Text is the content of the line, truncated to maxErrorText bytes,
+	// or empty if the line could not be read.
+	Text string
+	// Step is the step which failed, StepRegion or StepField, or empty if
+	// the line could not be read or is neither a region line nor a field
+	// line.
+	Step string
+	// Part is the malformed part of the line, e.g. "Perms" of a region
+	// line or the name of a field, or empty if it is unknown.
+	Part string
+	Err  error
+}
+
+// maxErrorText is the maximum length of the line content in a ParseError.
+const maxErrorText = 120
+
+func newParseError(lineNo int, line []byte, step string, err error) *ParseError {
+	if len(line) > maxErrorText {
+		line = line[:maxErrorText]
+	}
+	e := &ParseError{Line: lineNo, Text: string(line), Step: step, Err: err}
+	var ferr *formatError
+	if errors.As(err, &ferr) {
+		e.Part, e.Column, e.Err = ferr.part, ferr.column, ferr.err
+	}
+	return e
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("line %d", e.Line)
+	if e.Column > 0 {
+		msg += fmt.Sprintf(", column %d", e.Column)
+	}
+	msg += ": " + e.Reason()
+	if e.Text != "" {
+		msg += fmt.Sprintf(": %q", e.Text)
+	}
+	return msg
+}
+
+// Reason returns the message of e without the position and the content
+// of the line, e.g. "region Perms: missing: bad format".
+func (e *ParseError) Reason() string {
+	if e.Step == "" {
+		return e.Err.Error()
+	}
+	if e.Part == "" {
+		return fmt.Sprintf("%s: %v", e.Step, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Step, e.Part, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// formatError is a malformed part of a line, which gives the Part and
+// the Column of a ParseError.
+type formatError struct {
+	part   string
+	column int
+	err    error
+}
+
+func newFormatError(part string, column int, msg string) *formatError {
+	return &formatError{part: part, column: column, err: fmt.Errorf("%s: %w", msg, ErrBadFormat)}
+}
+
+func (e *formatError) Error() string {
+	return fmt.Sprintf("%s at column %d: %v", e.part, e.column, e.err)
+}
+
+func (e *formatError) Unwrap() error {
+	return e.err
+}
+
+// Region is the region line of a mapping.
+type Region struct {
+	AddressStart string
+	AddressEnd   string
+	Perms        string
+	Offset       string
+	Dev          string
+	Inode        string
+	// Pathname is the file of the mapping, a pseudo-path like "[heap]",
+	// or empty for anonymous mappings.
+	Pathname string
+}
+
+// AddressRange returns the start and end addresses of r.
+func (r *Region) AddressRange() (start, end uint64, err error) {
+	start, err = strconv.ParseUint(r.AddressStart, 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err = strconv.ParseUint(r.AddressEnd, 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// Field is a field line of a mapping.
+type Field struct {
+	Name  string
+	Value string
+	// Unit is "kB" for memory sizes and empty for others, e.g. VmFlags.
+	Unit string
+}
+
+// Mapping is a region with its fields.
+type Mapping struct {
+	Region Region
+	Fields []Field
+	// LineNo is the line number of the region line.
+	LineNo int
+}
+
+// Field returns the field of m with the name, and whether there is one.
+func (m *Mapping) Field(name string) (Field, bool) {
+	for _, f := range m.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// readBufferSize is the size of the read buffer, which holds a region
+// line with a pathname of PATH_MAX bytes, e.g. a deep overlayfs path in a
+// container, so that lines are usually returned without copying. Longer
+// lines, e.g. with escaped or deleted pathnames, are read up to
+// MaxLineBytes.
+const readBufferSize = 4096 + 256
+
+// Parser reads mappings from smaps formatted text.
+type Parser struct {
+	r      *bufio.Reader
+	lineNo int
+	// m is the mapping being read, which is returned when the next
+	// region line or the end of the input is read.
+	m   *Mapping
+	err error
+	// skipBadLine is called for malformed lines, which are skipped, if it
+	// is not nil.
+	skipBadLine func(*ParseError)
+	// skipping is true after a malformed region line, whose field lines
+	// are skipped.
+	skipping bool
+	// names interns the names and units of fields, and fields is the
+	// number of the fields of the last mapping, which the next one likely
+	// has too.
+	names  interner
+	fields int
+}
+
+// SkipBadLines makes the parser skip malformed lines instead of returning
+// an error, calling fn for each of them. The field lines following a
+// malformed region line are skipped without calling fn. Lines longer than
+// MaxLineBytes are still errors.
+func (p *Parser) SkipBadLines(fn func(*ParseError)) {
+	p.skipBadLine = fn
+}
+
+// badLine returns the error of a malformed line, or nil if it is skipped.
+func (p *Parser) badLine(err *ParseError) error {
+	if p.skipBadLine == nil {
+		p.err = err
+		return err
+	}
+	p.skipBadLine(err)
+	return nil
+}
+
+// NewParser returns a parser reading from r.
+func NewParser(r io.Reader) *Parser {
+	return &Parser{r: bufio.NewReaderSize(r, readBufferSize), names: make(interner)}
+}
+
+// Next returns the next mapping in input order. It returns io.EOF after
+// the last mapping, and a *ParseError for malformed input. The parser
+// returns the same error on following calls.
+func (p *Parser) Next() (*Mapping, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	for {
+		line, err := readLine(p.r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				p.err = io.EOF
+				return p.take()
+			}
+			p.err = &ParseError{Line: p.lineNo + 1, Err: err}
+			return nil, p.err
+		}
+		p.lineNo++
+
+		isRegion, err := isRegionLine(line)
+		if err != nil {
+			if err := p.badLine(newParseError(p.lineNo, line, "", err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if isRegion {
+			m := p.m
+			r, err := parseRegion(line)
+			p.m, p.skipping = nil, false
+			if err != nil {
+				// The error is returned after the pending mapping
+				// unless the line is skipped.
+				p.skipping = p.badLine(newParseError(p.lineNo, line, StepRegion, err)) == nil
+			} else {
+				p.m = &Mapping{Region: r, Fields: make([]Field, 0, p.fields), LineNo: p.lineNo}
+			}
+			if m != nil {
+				p.fields = len(m.Fields)
+				return m, nil
+			}
+			if p.err != nil {
+				return nil, p.err
+			}
+			continue
+		}
+
+		if p.skipping {
+			continue
+		}
+		if p.m == nil {
+			name, _, _ := bytes.Cut(line, []byte{':'})
+			if err := p.badLine(newParseError(p.lineNo, line, StepField, newFormatError(string(name), 1, "field before the first region"))); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		f, err := parseField(line, p.names)
+		if err != nil {
+			if err := p.badLine(newParseError(p.lineNo, line, StepField, err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		p.m.Fields = append(p.m.Fields, f)
+	}
+}
+
+// take returns the mapping being read at the end of the input.
+func (p *Parser) take() (*Mapping, error) {
+	m := p.m
+	p.m = nil
+	if m == nil {
+		return nil, p.err
+	}
+	return m, nil
+}
+
+// interner returns the same string for the same bytes, so that the names
+// and units of fields, which repeat in every mapping, are allocated once.
+type interner map[string]string
+
+// maxInterned bounds the strings kept by an interner for inputs with
+// many distinct names, e.g. malformed ones.
+const maxInterned = 256
+
+// maxInternedValue is the length of the longest value interned, which
+// are mostly small sizes in kB repeated in many mappings, e.g. 0 or 4.
+const maxInternedValue = 4
+
+func (in interner) intern(b []byte) string {
+	if s, ok := in[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	if len(in) < maxInterned {
+		in[s] = s
+	}
+	return s
+}
+
+const lf = '\n'
+
+// readLine returns the next line without the trailing newline. The last
+// line is returned even if it does not end with a newline.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	frag, err := r.ReadSlice(lf)
+	if err == nil {
+		// The line is in the buffer, which is valid until the next
+		// read, and parsed values are copied into strings.
+		return frag[:len(frag)-1], nil
+	}
+	var line []byte
+	for {
+		line = append(line, frag...)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			if len(line) > MaxLineBytes {
+				return nil, ErrLineTooLong
+			}
+			frag, err = r.ReadSlice(lf)
+			continue
+		}
+		if errors.Is(err, io.EOF) && len(line) > 0 {
+			break
+		}
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\n"), nil
+}
+
+func isRegionLine(line []byte) (bool, error) {
+	// Region line contains ASCII space before colon
+	// fcf0001000-fcf0002000 rw-p 00000000 00:00 0
+	i := bytes.IndexByte(line, ':')
+	if i == -1 {
+		return false, fmt.Errorf("neither a region line nor a field line: %w", ErrBadFormat)
+	}
+	return bytes.IndexByte(line[:i], ' ') != -1, nil
+}
+
+// ParseRegion parses a region line, which is also the format of the lines
+// of /proc/<pid>/maps. The error of a malformed line wraps ErrBadFormat
+// and names the malformed part.
+func ParseRegion(line string) (*Region, error) {
+	r, err := parseRegion([]byte(line))
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// regionParts are the parts of a region line before the pathname, with
+// the separator following each of them.
+var regionParts = []struct {
+	name string
+	sep  byte
+}{
+	{"AddressStart", '-'},
+	{"AddressEnd", ' '},
+	{"Perms", ' '},
+	{"Offset", ' '},
+	{"Dev", ' '},
+	{"Inode", ' '},
+}
+
+func parseRegion(line []byte) (Region, error) {
+	// The parts are offsets in the line, which is converted into one
+	// string instead of a string for each part.
+	var parts [6][2]int
+	rest := line
+	for i, part := range regionParts {
+		column := len(line) - len(rest) + 1
+		value, after, ok := bytes.Cut(rest, []byte{part.sep})
+		parts[i] = [2]int{column - 1, column - 1 + len(value)}
+		rest = after
+		// A space in the start address is a '-' of a later part, e.g.
+		// the perms.
+		if i == 0 && bytes.IndexByte(value, ' ') != -1 {
+			ok = false
+		}
+		if ok {
+			continue
+		}
+		if i == 0 || i == len(regionParts)-1 {
+			return Region{}, newFormatError(part.name, column, fmt.Sprintf("no %q after the value", part.sep))
+		}
+		// The line ends in the value of the part.
+		return Region{}, newFormatError(regionParts[i+1].name, len(line)+1, "missing")
+	}
+	var pathStart, pathEnd int
+	if pathname := bytes.TrimSpace(rest); len(pathname) > 0 {
+		pathStart = cap(line) - cap(pathname)
+		pathEnd = pathStart + len(pathname)
+	}
+	s := string(line)
+	return Region{
+		AddressStart: s[parts[0][0]:parts[0][1]],
+		AddressEnd:   s[parts[1][0]:parts[1][1]],
+		Perms:        s[parts[2][0]:parts[2][1]],
+		Offset:       s[parts[3][0]:parts[3][1]],
+		Dev:          s[parts[4][0]:parts[4][1]],
+		Inode:        s[parts[5][0]:parts[5][1]],
+		Pathname:     s[pathStart:pathEnd],
+	}, nil
+}
+
+// parseField parses a field line, interning the name, the unit and short
+// values with names.
+func parseField(line []byte, names interner) (Field, error) {
+	name, rest, ok := bytes.Cut(line, []byte{':'})
+	if !ok {
+		return Field{}, newFormatError("", len(line)+1, "no ':' after the name")
+	}
+	if len(name) == 0 {
+		return Field{}, newFormatError("", 1, "empty name")
+	}
+
+	value := bytes.TrimLeft(rest, " ")
+	var unit []byte
+	if !bytes.Equal(name, []byte("VmFlags")) {
+		value, unit, _ = bytes.Cut(value, []byte{' '})
+	}
+	f := Field{Name: names.intern(name), Unit: names.intern(unit)}
+	if len(value) <= maxInternedValue {
+		f.Value = names.intern(value)
+	} else {
+		f.Value = string(value)
+	}
+	return f, nil
+}
@@ -0,0 +1,245 @@
+package smaps
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRegion(t *testing.T) {
+	r, err := ParseRegion("4d400283000-4d400284000 ---p 00000000 00:00 0                            [anon:partition_alloc]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Region{
+		AddressStart: "4d400283000",
+		AddressEnd:   "4d400284000",
+		Perms:        "---p",
+		Offset:       "00000000",
+		Dev:          "00:00",
+		Inode:        "0",
+		Pathname:     "[anon:partition_alloc]",
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("result mismatch,\n got=%+v,\nwant=%+v", r, want)
+	}
+}
+
+func TestParserNext(t *testing.T) {
+	input := `55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat
+Size:                  4 kB
+VmFlags: rd mr mw me
+7ffd0000-7ffd1000 rw-p 00000000 00:00 0                          [stack]
+Rss:                   4 kB`
+	p := NewParser(strings.NewReader(input))
+	want := []*Mapping{
+		{
+			Region: Region{AddressStart: "55d000", AddressEnd: "55e000", Perms: "r--p", Offset: "00000000", Dev: "fe:00", Inode: "1234", Pathname: "/usr/bin/cat"},
+			Fields: []Field{{Name: "Size", Value: "4", Unit: "kB"}, {Name: "VmFlags", Value: "rd mr mw me"}},
+			LineNo: 1,
+		},
+		{
+			Region: Region{AddressStart: "7ffd0000", AddressEnd: "7ffd1000", Perms: "rw-p", Offset: "00000000", Dev: "00:00", Inode: "0", Pathname: "[stack]"},
+			Fields: []Field{{Name: "Rss", Value: "4", Unit: "kB"}},
+			LineNo: 4,
+		},
+	}
+	for i, w := range want {
+		m, err := p.Next()
+		if err != nil {
+			t.Fatalf("mapping %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(m, w) {
+			t.Errorf("mapping %d: result mismatch,\n got=%+v,\nwant=%+v", i, m, w)
+		}
+	}
+	if _, err := p.Next(); err != io.EOF {
+		t.Errorf("error mismatch, got=%v, want=%v", err, io.EOF)
+	}
+}
+
+func TestParserNextLongPathname(t *testing.T) {
+	// Pathnames of PATH_MAX bytes and longer ones, which do not fit in the
+	// read buffer, followed by fields which must not be split.
+	pathnames := []string{
+		"/var/lib/docker/overlay2/" + strings.Repeat("d", 4096-len("/var/lib/docker/overlay2/")),
+		"/memfd:" + strings.Repeat("m", 8000) + " (deleted)",
+		"/a b/" + strings.Repeat("x", readBufferSize),
+	}
+	var input strings.Builder
+	for i, pathname := range pathnames {
+		fmt.Fprintf(&input, "%x-%x rw-s 00000000 00:01 %d                          %s\nRss:                   4 kB\n", i*4096, (i+1)*4096, i+1, pathname)
+	}
+	p := NewParser(strings.NewReader(input.String()))
+	for i, pathname := range pathnames {
+		m, err := p.Next()
+		if err != nil {
+			t.Fatalf("mapping %d: %v", i, err)
+		}
+		if m.Region.Pathname != pathname {
+			t.Errorf("mapping %d: pathname mismatch, got=%.40q... (%d bytes), want %d bytes", i, m.Region.Pathname, len(m.Region.Pathname), len(pathname))
+		}
+		if want := []Field{{Name: "Rss", Value: "4", Unit: "kB"}}; !reflect.DeepEqual(m.Fields, want) {
+			t.Errorf("mapping %d: fields mismatch, got=%+v, want=%+v", i, m.Fields, want)
+		}
+		if m.LineNo != 2*i+1 {
+			t.Errorf("mapping %d: line mismatch, got=%d, want=%d", i, m.LineNo, 2*i+1)
+		}
+	}
+	if _, err := p.Next(); err != io.EOF {
+		t.Errorf("error mismatch, got=%v, want=%v", err, io.EOF)
+	}
+}
+
+func TestParserNextError(t *testing.T) {
+	testCases := []struct {
+		input    string
+		wantLine int
+	}{
+		{input: "Rss: 4 kB\n", wantLine: 1},
+		{input: "55d000-55e000 r--p 00000000 fe:00 1234 /a\nno colon\n", wantLine: 2},
+		{input: "55d000-55e000 r--p 00000000 fe:00 1234 /a\n" + strings.Repeat("x", MaxLineBytes+1), wantLine: 2},
+	}
+	for _, tc := range testCases {
+		p := NewParser(strings.NewReader(tc.input))
+		var err error
+		for err == nil {
+			_, err = p.Next()
+		}
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("input=%.40q: error mismatch, got=%v, want a *ParseError", tc.input, err)
+			continue
+		}
+		if perr.Line != tc.wantLine {
+			t.Errorf("input=%.40q: line mismatch, got=%d, want=%d", tc.input, perr.Line, tc.wantLine)
+		}
+	}
+}
+
+func TestParseErrorText(t *testing.T) {
+	p := NewParser(strings.NewReader("55d000-55e000 r--p 00000000 fe:00 1234 /a\n[vsyscall]\n"))
+	var err error
+	for err == nil {
+		_, err = p.Next()
+	}
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Text != "[vsyscall]" {
+		t.Fatalf("error mismatch, got=%v, want a *ParseError with the line", err)
+	}
+	if want := `line 2: neither a region line nor a field line: bad format: "[vsyscall]"`; err.Error() != want {
+		t.Errorf("message mismatch, got=%q, want=%q", err.Error(), want)
+	}
+}
+
+func TestParseErrorContext(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  ParseError
+		msg   string
+	}{
+		{
+			input: "55d000-55e000 r--p 00000000 fe:00\n",
+			want:  ParseError{Line: 1, Column: 34, Step: StepRegion, Part: "Inode"},
+			msg:   `line 1, column 34: region Inode: missing: bad format: "55d000-55e000 r--p 00000000 fe:00"`,
+		},
+		{
+			input: "55d000 r--p 00000000 fe:00 1234 /a\n",
+			want:  ParseError{Line: 1, Column: 1, Step: StepRegion, Part: "AddressStart"},
+			msg:   `line 1, column 1: region AddressStart: no '-' after the value: bad format: "55d000 r--p 00000000 fe:00 1234 /a"`,
+		},
+		{
+			input: "Rss: 4 kB\n",
+			want:  ParseError{Line: 1, Column: 1, Step: StepField, Part: "Rss"},
+			msg:   `line 1, column 1: field Rss: field before the first region: bad format: "Rss: 4 kB"`,
+		},
+		{
+			input: "55d000-55e000 r--p 00000000 fe:00 1234 /a\n: 4 kB\n",
+			want:  ParseError{Line: 2, Column: 1, Step: StepField},
+			msg:   `line 2, column 1: field: empty name: bad format: ": 4 kB"`,
+		},
+	}
+	for _, tc := range testCases {
+		p := NewParser(strings.NewReader(tc.input))
+		var err error
+		for err == nil {
+			_, err = p.Next()
+		}
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("input=%q: error mismatch, got=%v, want a *ParseError", tc.input, err)
+			continue
+		}
+		if perr.Line != tc.want.Line || perr.Column != tc.want.Column || perr.Step != tc.want.Step || perr.Part != tc.want.Part {
+			t.Errorf("input=%q: context mismatch, got=%+v, want=%+v", tc.input, *perr, tc.want)
+		}
+		if !errors.Is(err, ErrBadFormat) {
+			t.Errorf("input=%q: error %v does not wrap ErrBadFormat", tc.input, err)
+		}
+		if err.Error() != tc.msg {
+			t.Errorf("input=%q: message mismatch,\n got=%s,\nwant=%s", tc.input, err.Error(), tc.msg)
+		}
+	}
+}
+
+func TestParserSkipBadLines(t *testing.T) {
+	input := `Rss: 1 kB
+55d000-55e000 r--p 00000000 fe:00 1234 /a
+Rss: 4 kB
+no colon
+bad region: x
+Rss: 8 kB
+7ffd0000-7ffd1000 rw-p 00000000 00:00 0 [stack]
+Rss: 12 kB`
+	p := NewParser(strings.NewReader(input))
+	var skipped []int
+	p.SkipBadLines(func(err *ParseError) {
+		skipped = append(skipped, err.Line)
+	})
+	var got []string
+	for {
+		m, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range m.Fields {
+			got = append(got, m.Region.Pathname+" "+f.Name+" "+f.Value)
+		}
+	}
+	if want := []string{"/a Rss 4", "[stack] Rss 12"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch, got=%q, want=%q", got, want)
+	}
+	if want := []int{1, 4, 5}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped lines mismatch, got=%v, want=%v", skipped, want)
+	}
+}
+
+func TestMappingField(t *testing.T) {
+	m := &Mapping{Fields: []Field{{Name: "Size", Value: "8", Unit: "kB"}, {Name: "Rss", Value: "4", Unit: "kB"}}}
+	if f, ok := m.Field("Rss"); !ok || f.Value != "4" {
+		t.Errorf("result mismatch, got=(%+v, %v)", f, ok)
+	}
+	if _, ok := m.Field("Pss"); ok {
+		t.Error("Pss must not be found")
+	}
+}
+
+func TestInterner(t *testing.T) {
+	in := make(interner)
+	a := in.intern([]byte("Rss"))
+	if b := in.intern([]byte("Rss")); b != a || len(in) != 1 {
+		t.Errorf("intern again = %q with %d strings, want %q with 1", b, len(in), a)
+	}
+	for i := 0; i < 2*maxInterned; i++ {
+		in.intern([]byte(fmt.Sprint(i)))
+	}
+	if len(in) != maxInterned {
+		t.Errorf("interned %d strings, want at most %d", len(in), maxInterned)
+	}
+}
@@ -0,0 +1,303 @@
+package smaps
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source is a collection of smaps inputs, e.g. the processes of a host
+// or the files of an archive. Embedders can implement it to read inputs
+// from their own services.
+type Source interface {
+	// List returns the names of the inputs in the source in the order to
+	// read them.
+	List() ([]string, error)
+	// Open opens the input of a name returned by List.
+	Open(name string) (io.ReadCloser, error)
+}
+
+// Read reads all the mappings of the input of name in src.
+func Read(src Source, name string) ([]*Mapping, error) {
+	r, err := src.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var mappings []*Mapping
+	p := NewParser(r)
+	for {
+		m, err := p.Next()
+		if err == io.EOF {
+			return mappings, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		mappings = append(mappings, m)
+	}
+}
+
+// FileSource is the local files matching a pattern of filepath.Match,
+// e.g. captures/*.smaps.
+type FileSource struct {
+	Pattern string
+}
+
+// List returns the matching files in lexical order.
+func (s FileSource) List() ([]string, error) {
+	return filepath.Glob(s.Pattern)
+}
+
+// Open opens the file of name.
+func (s FileSource) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// ProcSource is the smaps of the live processes in a proc filesystem.
+type ProcSource struct {
+	// Root is the mount point of the proc filesystem, "/proc" if empty.
+	Root string
+	// File is the file of each process to read, "smaps" if empty, e.g.
+	// "smaps_rollup".
+	File string
+}
+
+func (s ProcSource) root() string {
+	if s.Root == "" {
+		return "/proc"
+	}
+	return s.Root
+}
+
+func (s ProcSource) file() string {
+	if s.File == "" {
+		return "smaps"
+	}
+	return s.File
+}
+
+// List returns the paths of /proc/<pid>/smaps in the order of the pids.
+// Processes may exit before their inputs are opened.
+func (s ProcSource) List() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(s.root(), "[0-9]*", s.file()))
+	if err != nil {
+		return nil, err
+	}
+	sortByPid(names)
+	return names, nil
+}
+
+// Open opens the smaps of name.
+func (s ProcSource) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// sortByPid sorts the paths of /proc/<pid>/smaps by the pids.
+func sortByPid(names []string) {
+	pid := func(name string) int {
+		n, _ := strconv.Atoi(path.Base(path.Dir(filepath.ToSlash(name))))
+		return n
+	}
+	sort.SliceStable(names, func(i, j int) bool { return pid(names[i]) < pid(names[j]) })
+}
+
+// SSHSource is the smaps of the processes on a remote host, read by
+// running cat and ls over SSH. Only a POSIX shell is needed on the host.
+type SSHSource struct {
+	Host string
+	// Root is the mount point of the proc filesystem on Host, "/proc" if
+	// empty, e.g. /host/proc in a container.
+	Root string
+	// Command is the command to run a shell command on Host, which is
+	// given Host and the shell command as arguments, ssh -o BatchMode=yes
+	// if empty.
+	Command []string
+}
+
+// List returns the paths of /proc/<pid>/smaps on the host in the order
+// of the pids.
+func (s SSHSource) List() ([]string, error) {
+	out, err := s.run("ls -d " + shellQuote(path.Clean(ProcSource{Root: s.Root}.root())) + "/[0-9]*/smaps")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if name := strings.TrimSpace(sc.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+	sortByPid(names)
+	return names, nil
+}
+
+// Open reads the file of name on the host. The whole file is read before
+// Open returns, so that the read is not slowed down by the caller.
+func (s SSHSource) Open(name string) (io.ReadCloser, error) {
+	out, err := s.run("cat -- " + shellQuote(name))
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(out)), nil
+}
+
+// run runs the shell command on the host like Run, with the host and the
+// command in the error.
+func (s SSHSource) run(command string) ([]byte, error) {
+	out, err := s.Run(command)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", s.Host, command, err)
+	}
+	return out, nil
+}
+
+// Run runs the shell command on the host and returns its output, e.g. a
+// script collecting the inputs of all the processes over one connection.
+// The error of a failed command has its standard error output.
+func (s SSHSource) Run(command string) ([]byte, error) {
+	args := s.Command
+	if len(args) == 0 {
+		args = []string{"ssh", "-o", "BatchMode=yes"}
+	}
+	cmd := exec.Command(args[0], append(args[1:], s.Host, command)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// shellQuote quotes s as a single word of a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// HTTPSource is the smaps served at URLs, e.g. by an agent on each host.
+type HTTPSource struct {
+	URLs []string
+	// Client is the client to get the URLs with, http.DefaultClient if
+	// nil.
+	Client *http.Client
+}
+
+// List returns the URLs.
+func (s HTTPSource) List() ([]string, error) {
+	return append([]string(nil), s.URLs...), nil
+}
+
+// Open gets the URL of name. A response with a status other than 200 is
+// an error.
+func (s HTTPSource) Open(name string) (io.ReadCloser, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", name, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// TarSource is the regular files in a tar archive, which may be
+// compressed with gzip, e.g. a collection of /proc/<pid>/smaps.
+type TarSource struct {
+	Path string
+}
+
+// errTarEntryNotFound is the error of opening a name not in the archive.
+var errTarEntryNotFound = errors.New("not found in the archive")
+
+// List returns the names of the regular files in the archive in the
+// order of the archive.
+func (s TarSource) List() ([]string, error) {
+	var names []string
+	err := s.walk(func(h *tar.Header, _ io.Reader) (bool, error) {
+		names = append(names, h.Name)
+		return false, nil
+	})
+	return names, err
+}
+
+// Open reads the file of name in the archive. The whole file is read
+// before Open returns.
+func (s TarSource) Open(name string) (io.ReadCloser, error) {
+	var data []byte
+	found := false
+	err := s.walk(func(h *tar.Header, r io.Reader) (bool, error) {
+		if h.Name != name {
+			return false, nil
+		}
+		var err error
+		data, err = io.ReadAll(r)
+		found = true
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: %s: %w", s.Path, name, errTarEntryNotFound)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// walk calls fn for each regular file in the archive until fn returns
+// true or an error.
+func (s TarSource) walk(fn func(*tar.Header, io.Reader) (bool, error)) error {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	br := bufio.NewReader(file)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Path, err)
+		}
+		defer gr.Close()
+		r = gr
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Path, err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		done, err := fn(h, tr)
+		if done || err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package smaps
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSourceInput = "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nRss:                   4 kB\n"
+
+// testReadSource reads all the inputs of src and checks that each of them
+// has the mapping of testSourceInput.
+func testReadSource(t *testing.T, src Source, wantNames []string) {
+	t.Helper()
+	names, err := src.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("names mismatch, got=%v, want=%v", names, wantNames)
+	}
+	for _, name := range names {
+		mappings, err := Read(src, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mappings) != 1 || mappings[0].Region.Pathname != "/usr/bin/cat" {
+			t.Errorf("%s: mappings mismatch, got=%+v", name, mappings)
+		}
+	}
+}
+
+func writeTestSmaps(t *testing.T, name string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(testSourceInput), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.smaps"), filepath.Join(dir, "b.smaps")
+	writeTestSmaps(t, b)
+	writeTestSmaps(t, a)
+	testReadSource(t, FileSource{Pattern: filepath.Join(dir, "*.smaps")}, []string{a, b})
+}
+
+func TestProcSource(t *testing.T) {
+	root := t.TempDir()
+	var want []string
+	for _, pid := range []string{"9", "10"} {
+		name := filepath.Join(root, pid, "smaps")
+		writeTestSmaps(t, name)
+		want = append(want, name)
+	}
+	rollup := filepath.Join(root, "10", "smaps_rollup")
+	writeTestSmaps(t, rollup)
+	if err := os.MkdirAll(filepath.Join(root, "self"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	testReadSource(t, ProcSource{Root: root}, want)
+	testReadSource(t, ProcSource{Root: root, File: "smaps_rollup"}, []string{rollup})
+}
+
+func TestSSHSource(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	root := t.TempDir()
+	var want []string
+	for _, pid := range []string{"9", "10"} {
+		name := filepath.Join(root, "proc", pid, "smaps")
+		writeTestSmaps(t, name)
+		want = append(want, name)
+	}
+	// The fake ssh runs the command locally, ignoring the host.
+	ssh := filepath.Join(root, "ssh")
+	if err := os.WriteFile(ssh, []byte("#!/bin/sh\nexec sh -c \"$2\"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	src := SSHSource{Host: "web1", Root: filepath.Join(root, "proc"), Command: []string{ssh}}
+	names, err := src.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("names mismatch, got=%v, want=%v", names, want)
+	}
+	testReadSource(t, src, names)
+
+	if _, err := src.Open(filepath.Join(root, "proc", "11", "smaps")); err == nil || !strings.Contains(err.Error(), "web1") {
+		t.Errorf("unexpected result of a missing file, err=%v", err)
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/10/smaps" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, testSourceInput)
+	}))
+	defer ts.Close()
+	src := HTTPSource{URLs: []string{ts.URL + "/10/smaps"}, Client: ts.Client()}
+	testReadSource(t, src, src.URLs)
+
+	if _, err := src.Open(ts.URL + "/11/smaps"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("unexpected result of a missing URL, err=%v", err)
+	}
+}
+
+func TestTarSource(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		name := filepath.Join(t.TempDir(), "smaps.tar")
+		file, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var w io.Writer = file
+		var gw *gzip.Writer
+		if compressed {
+			gw = gzip.NewWriter(file)
+			w = gw
+		}
+		tw := tar.NewWriter(w)
+		if err := tw.WriteHeader(&tar.Header{Name: "proc/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range []string{"proc/10/smaps", "proc/9/smaps"} {
+			if err := tw.WriteHeader(&tar.Header{Name: entry, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(testSourceInput))}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(tw, testSourceInput); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if gw != nil {
+			if err := gw.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := file.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		src := TarSource{Path: name}
+		testReadSource(t, src, []string{"proc/10/smaps", "proc/9/smaps"})
+		if _, err := src.Open("proc/11/smaps"); err == nil {
+			t.Error("want an error for a name not in the archive")
+		}
+	}
+}
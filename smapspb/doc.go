@@ -0,0 +1,5 @@
+// Package smapspb contains the protocol buffer messages and the gRPC
+// service of the serve subcommand.
+package smapspb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative smaps.proto
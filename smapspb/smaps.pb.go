@@ -0,0 +1,382 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.30.0
+// 	protoc        v23.4.0
+// source: smaps.proto
+
+package smapspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ConvertSmapsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// smaps is the raw contents of /proc/<pid>/smaps.
+	Smaps []byte `protobuf:"bytes,1,opt,name=smaps,proto3" json:"smaps,omitempty"`
+}
+
+func (x *ConvertSmapsRequest) Reset() {
+	*x = ConvertSmapsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_smaps_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ConvertSmapsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConvertSmapsRequest) ProtoMessage() {}
+
+func (x *ConvertSmapsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_smaps_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConvertSmapsRequest.ProtoReflect.Descriptor instead.
+func (*ConvertSmapsRequest) Descriptor() ([]byte, []int) {
+	return file_smaps_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ConvertSmapsRequest) GetSmaps() []byte {
+	if x != nil {
+		return x.Smaps
+	}
+	return nil
+}
+
+// Mapping is a memory region and its fields.
+type Mapping struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	AddressStart string   `protobuf:"bytes,1,opt,name=address_start,json=addressStart,proto3" json:"address_start,omitempty"`
+	AddressEnd   string   `protobuf:"bytes,2,opt,name=address_end,json=addressEnd,proto3" json:"address_end,omitempty"`
+	Perms        string   `protobuf:"bytes,3,opt,name=perms,proto3" json:"perms,omitempty"`
+	Offset       string   `protobuf:"bytes,4,opt,name=offset,proto3" json:"offset,omitempty"`
+	Dev          string   `protobuf:"bytes,5,opt,name=dev,proto3" json:"dev,omitempty"`
+	Inode        string   `protobuf:"bytes,6,opt,name=inode,proto3" json:"inode,omitempty"`
+	Pathname     string   `protobuf:"bytes,7,opt,name=pathname,proto3" json:"pathname,omitempty"`
+	Fields       []*Field `protobuf:"bytes,8,rep,name=fields,proto3" json:"fields,omitempty"`
+	// line_no is the line number of the region in the request.
+	LineNo int64 `protobuf:"varint,9,opt,name=line_no,json=lineNo,proto3" json:"line_no,omitempty"`
+}
+
+func (x *Mapping) Reset() {
+	*x = Mapping{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_smaps_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Mapping) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Mapping) ProtoMessage() {}
+
+func (x *Mapping) ProtoReflect() protoreflect.Message {
+	mi := &file_smaps_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Mapping.ProtoReflect.Descriptor instead.
+func (*Mapping) Descriptor() ([]byte, []int) {
+	return file_smaps_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Mapping) GetAddressStart() string {
+	if x != nil {
+		return x.AddressStart
+	}
+	return ""
+}
+
+func (x *Mapping) GetAddressEnd() string {
+	if x != nil {
+		return x.AddressEnd
+	}
+	return ""
+}
+
+func (x *Mapping) GetPerms() string {
+	if x != nil {
+		return x.Perms
+	}
+	return ""
+}
+
+func (x *Mapping) GetOffset() string {
+	if x != nil {
+		return x.Offset
+	}
+	return ""
+}
+
+func (x *Mapping) GetDev() string {
+	if x != nil {
+		return x.Dev
+	}
+	return ""
+}
+
+func (x *Mapping) GetInode() string {
+	if x != nil {
+		return x.Inode
+	}
+	return ""
+}
+
+func (x *Mapping) GetPathname() string {
+	if x != nil {
+		return x.Pathname
+	}
+	return ""
+}
+
+func (x *Mapping) GetFields() []*Field {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *Mapping) GetLineNo() int64 {
+	if x != nil {
+		return x.LineNo
+	}
+	return 0
+}
+
+// Field is a field of a mapping such as "Rss: 4 kB".
+type Field struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	// unit is "kB", or empty for fields without a unit such as VmFlags.
+	Unit string `protobuf:"bytes,3,opt,name=unit,proto3" json:"unit,omitempty"`
+}
+
+func (x *Field) Reset() {
+	*x = Field{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_smaps_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Field) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Field) ProtoMessage() {}
+
+func (x *Field) ProtoReflect() protoreflect.Message {
+	mi := &file_smaps_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Field.ProtoReflect.Descriptor instead.
+func (*Field) Descriptor() ([]byte, []int) {
+	return file_smaps_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Field) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Field) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *Field) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+var File_smaps_proto protoreflect.FileDescriptor
+
+var file_smaps_proto_rawDesc = []byte{
+	0x0a, 0x0b, 0x73, 0x6d, 0x61, 0x70, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x16, 0x6c,
+	0x69, 0x6e, 0x75, 0x78, 0x70, 0x72, 0x6f, 0x63, 0x73, 0x6d, 0x61, 0x70, 0x73, 0x74, 0x6f, 0x63,
+	0x73, 0x76, 0x2e, 0x76, 0x31, 0x22, 0x2b, 0x0a, 0x13, 0x43, 0x6f, 0x6e, 0x76, 0x65, 0x72, 0x74,
+	0x53, 0x6d, 0x61, 0x70, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05,
+	0x73, 0x6d, 0x61, 0x70, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x73, 0x6d, 0x61,
+	0x70, 0x73, 0x22, 0x91, 0x02, 0x0a, 0x07, 0x4d, 0x61, 0x70, 0x70, 0x69, 0x6e, 0x67, 0x12, 0x23,
+	0x0a, 0x0d, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x5f, 0x73, 0x74, 0x61, 0x72, 0x74, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x53, 0x74,
+	0x61, 0x72, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x5f, 0x65,
+	0x6e, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73,
+	0x73, 0x45, 0x6e, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x65, 0x72, 0x6d, 0x73, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x70, 0x65, 0x72, 0x6d, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x6f, 0x66,
+	0x66, 0x73, 0x65, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6f, 0x66, 0x66, 0x73,
+	0x65, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x64, 0x65, 0x76, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x03, 0x64, 0x65, 0x76, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6e, 0x6f, 0x64, 0x65, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x69, 0x6e, 0x6f, 0x64, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x61,
+	0x74, 0x68, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x70, 0x61,
+	0x74, 0x68, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x35, 0x0a, 0x06, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x73,
+	0x18, 0x08, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x6c, 0x69, 0x6e, 0x75, 0x78, 0x70, 0x72,
+	0x6f, 0x63, 0x73, 0x6d, 0x61, 0x70, 0x73, 0x74, 0x6f, 0x63, 0x73, 0x76, 0x2e, 0x76, 0x31, 0x2e,
+	0x46, 0x69, 0x65, 0x6c, 0x64, 0x52, 0x06, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x12, 0x17, 0x0a,
+	0x07, 0x6c, 0x69, 0x6e, 0x65, 0x5f, 0x6e, 0x6f, 0x18, 0x09, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06,
+	0x6c, 0x69, 0x6e, 0x65, 0x4e, 0x6f, 0x22, 0x45, 0x0a, 0x05, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12,
+	0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e,
+	0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x75, 0x6e, 0x69,
+	0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x75, 0x6e, 0x69, 0x74, 0x32, 0x70, 0x0a,
+	0x0e, 0x53, 0x6d, 0x61, 0x70, 0x73, 0x43, 0x6f, 0x6e, 0x76, 0x65, 0x72, 0x74, 0x65, 0x72, 0x12,
+	0x5e, 0x0a, 0x0c, 0x43, 0x6f, 0x6e, 0x76, 0x65, 0x72, 0x74, 0x53, 0x6d, 0x61, 0x70, 0x73, 0x12,
+	0x2b, 0x2e, 0x6c, 0x69, 0x6e, 0x75, 0x78, 0x70, 0x72, 0x6f, 0x63, 0x73, 0x6d, 0x61, 0x70, 0x73,
+	0x74, 0x6f, 0x63, 0x73, 0x76, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6e, 0x76, 0x65, 0x72, 0x74,
+	0x53, 0x6d, 0x61, 0x70, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1f, 0x2e, 0x6c,
+	0x69, 0x6e, 0x75, 0x78, 0x70, 0x72, 0x6f, 0x63, 0x73, 0x6d, 0x61, 0x70, 0x73, 0x74, 0x6f, 0x63,
+	0x73, 0x76, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x61, 0x70, 0x70, 0x69, 0x6e, 0x67, 0x30, 0x01, 0x42,
+	0x31, 0x5a, 0x2f, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x68, 0x6e,
+	0x61, 0x6b, 0x61, 0x6d, 0x75, 0x72, 0x2f, 0x6c, 0x69, 0x6e, 0x75, 0x78, 0x70, 0x72, 0x6f, 0x63,
+	0x73, 0x6d, 0x61, 0x70, 0x73, 0x74, 0x6f, 0x63, 0x73, 0x76, 0x2f, 0x73, 0x6d, 0x61, 0x70, 0x73,
+	0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_smaps_proto_rawDescOnce sync.Once
+	file_smaps_proto_rawDescData = file_smaps_proto_rawDesc
+)
+
+func file_smaps_proto_rawDescGZIP() []byte {
+	file_smaps_proto_rawDescOnce.Do(func() {
+		file_smaps_proto_rawDescData = protoimpl.X.CompressGZIP(file_smaps_proto_rawDescData)
+	})
+	return file_smaps_proto_rawDescData
+}
+
+var file_smaps_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_smaps_proto_goTypes = []interface{}{
+	(*ConvertSmapsRequest)(nil), // 0: linuxprocsmapstocsv.v1.ConvertSmapsRequest
+	(*Mapping)(nil),             // 1: linuxprocsmapstocsv.v1.Mapping
+	(*Field)(nil),               // 2: linuxprocsmapstocsv.v1.Field
+}
+var file_smaps_proto_depIdxs = []int32{
+	2, // 0: linuxprocsmapstocsv.v1.Mapping.fields:type_name -> linuxprocsmapstocsv.v1.Field
+	0, // 1: linuxprocsmapstocsv.v1.SmapsConverter.ConvertSmaps:input_type -> linuxprocsmapstocsv.v1.ConvertSmapsRequest
+	1, // 2: linuxprocsmapstocsv.v1.SmapsConverter.ConvertSmaps:output_type -> linuxprocsmapstocsv.v1.Mapping
+	2, // [2:3] is the sub-list for method output_type
+	1, // [1:2] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_smaps_proto_init() }
+func file_smaps_proto_init() {
+	if File_smaps_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_smaps_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ConvertSmapsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_smaps_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Mapping); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_smaps_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Field); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_smaps_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_smaps_proto_goTypes,
+		DependencyIndexes: file_smaps_proto_depIdxs,
+		MessageInfos:      file_smaps_proto_msgTypes,
+	}.Build()
+	File_smaps_proto = out.File
+	file_smaps_proto_rawDesc = nil
+	file_smaps_proto_goTypes = nil
+	file_smaps_proto_depIdxs = nil
+}
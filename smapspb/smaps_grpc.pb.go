@@ -0,0 +1,144 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v23.4.0
+// source: smaps.proto
+
+package smapspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	SmapsConverter_ConvertSmaps_FullMethodName = "/linuxprocsmapstocsv.v1.SmapsConverter/ConvertSmaps"
+)
+
+// SmapsConverterClient is the client API for SmapsConverter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SmapsConverterClient interface {
+	// ConvertSmaps parses the raw smaps in the request and streams the
+	// mappings. The options of the server which change regions and fields,
+	// e.g. redaction, field selection and sorting, are applied, while the
+	// ones which format CSV values, e.g. units and derived columns, are not.
+	ConvertSmaps(ctx context.Context, in *ConvertSmapsRequest, opts ...grpc.CallOption) (SmapsConverter_ConvertSmapsClient, error)
+}
+
+type smapsConverterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSmapsConverterClient(cc grpc.ClientConnInterface) SmapsConverterClient {
+	return &smapsConverterClient{cc}
+}
+
+func (c *smapsConverterClient) ConvertSmaps(ctx context.Context, in *ConvertSmapsRequest, opts ...grpc.CallOption) (SmapsConverter_ConvertSmapsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &SmapsConverter_ServiceDesc.Streams[0], SmapsConverter_ConvertSmaps_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &smapsConverterConvertSmapsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SmapsConverter_ConvertSmapsClient interface {
+	Recv() (*Mapping, error)
+	grpc.ClientStream
+}
+
+type smapsConverterConvertSmapsClient struct {
+	grpc.ClientStream
+}
+
+func (x *smapsConverterConvertSmapsClient) Recv() (*Mapping, error) {
+	m := new(Mapping)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SmapsConverterServer is the server API for SmapsConverter service.
+// All implementations must embed UnimplementedSmapsConverterServer
+// for forward compatibility
+type SmapsConverterServer interface {
+	// ConvertSmaps parses the raw smaps in the request and streams the
+	// mappings. The options of the server which change regions and fields,
+	// e.g. redaction, field selection and sorting, are applied, while the
+	// ones which format CSV values, e.g. units and derived columns, are not.
+	ConvertSmaps(*ConvertSmapsRequest, SmapsConverter_ConvertSmapsServer) error
+	mustEmbedUnimplementedSmapsConverterServer()
+}
+
+// UnimplementedSmapsConverterServer must be embedded to have forward compatible implementations.
+type UnimplementedSmapsConverterServer struct {
+}
+
+func (UnimplementedSmapsConverterServer) ConvertSmaps(*ConvertSmapsRequest, SmapsConverter_ConvertSmapsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ConvertSmaps not implemented")
+}
+func (UnimplementedSmapsConverterServer) mustEmbedUnimplementedSmapsConverterServer() {}
+
+// UnsafeSmapsConverterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SmapsConverterServer will
+// result in compilation errors.
+type UnsafeSmapsConverterServer interface {
+	mustEmbedUnimplementedSmapsConverterServer()
+}
+
+func RegisterSmapsConverterServer(s grpc.ServiceRegistrar, srv SmapsConverterServer) {
+	s.RegisterService(&SmapsConverter_ServiceDesc, srv)
+}
+
+func _SmapsConverter_ConvertSmaps_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ConvertSmapsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SmapsConverterServer).ConvertSmaps(m, &smapsConverterConvertSmapsServer{stream})
+}
+
+type SmapsConverter_ConvertSmapsServer interface {
+	Send(*Mapping) error
+	grpc.ServerStream
+}
+
+type smapsConverterConvertSmapsServer struct {
+	grpc.ServerStream
+}
+
+func (x *smapsConverterConvertSmapsServer) Send(m *Mapping) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// SmapsConverter_ServiceDesc is the grpc.ServiceDesc for SmapsConverter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SmapsConverter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "linuxprocsmapstocsv.v1.SmapsConverter",
+	HandlerType: (*SmapsConverterServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ConvertSmaps",
+			Handler:       _SmapsConverter_ConvertSmaps_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "smaps.proto",
+}
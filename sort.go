@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const sortByAddresses = "addresses"
+
+// sortMappings sorts mappings in place. The sort is stable so mappings
+// with equal keys keep their input order, which makes the output
+// deterministic for identical input. The mappings are of one input, i.e.
+// one PID; the inputs of a batch are sorted by PID by run.
+func sortMappings(mappings []*mapping, order string) error {
+	switch order {
+	case sortByAddresses:
+		starts := make(map[*mapping]uint64, len(mappings))
+		for _, m := range mappings {
+			start, err := strconv.ParseUint(string(m.Region.AddressStart), 16, 64)
+			if err != nil {
+				return fmt.Errorf("invalid start address at line %d: %w", m.LineNo, err)
+			}
+			starts[m] = start
+		}
+		sort.SliceStable(mappings, func(i, j int) bool {
+			return starts[mappings[i]] < starts[mappings[j]]
+		})
+		return nil
+	default:
+		return fmt.Errorf("unsupported sort order: %q", order)
+	}
+}
+
+// sortKey is the column and direction given by -sort-by, e.g. Rss:desc.
+type sortKey struct {
+	column string
+	desc   bool
+	// expr is the expression of the column if it is a derived column,
+	// e.g. of -derive, which is set by prepare.
+	expr expr
+}
+
+// parseSortKey parses a column optionally followed by ":asc" or ":desc".
+// The direction is ascending if omitted.
+func parseSortKey(s string) (*sortKey, error) {
+	column, dir, _ := strings.Cut(s, ":")
+	if column == "" {
+		return nil, fmt.Errorf("invalid sort key (-sort-by): %q", s)
+	}
+	key := &sortKey{column: column}
+	switch dir {
+	case "", "asc":
+	case "desc":
+		key.desc = true
+	default:
+		return nil, fmt.Errorf("invalid sort direction (-sort-by): %q, must be asc or desc", dir)
+	}
+	return key, nil
+}
+
+// regionSortValue returns the value of a region column of m for sorting:
+// a number for the addresses, offset and inode, and the text otherwise.
+// ok is false if column is not a region column.
+func regionSortValue(m *mapping, column string) (num float64, text string, ok bool) {
+	parse := func(b []byte, base int) float64 {
+		v, _ := strconv.ParseUint(string(b), base, 64)
+		return float64(v)
+	}
+	switch column {
+	case "AddressStart":
+		return parse(m.Region.AddressStart, 16), "", true
+	case "AddressEnd":
+		return parse(m.Region.AddressEnd, 16), "", true
+	case "Offset":
+		return parse(m.Region.Offset, 16), "", true
+	case "Inode":
+		return parse(m.Region.Inode, 10), "", true
+	case "Perms":
+		return 0, string(m.Region.Perms), true
+	case "Dev":
+		return 0, string(m.Region.Dev), true
+	case "Pathname":
+		return 0, string(m.Region.Pathname), true
+	}
+	return 0, "", false
+}
+
+// sortMappingsByKey sorts mappings in place by the column of key, which
+// is a region column or a numeric field. Mappings without the field are
+// placed last in both directions. An error is returned if no mapping
+// has the field, which is likely a typo.
+func sortMappingsByKey(mappings []*mapping, key *sortKey) error {
+	type value struct {
+		num     float64
+		text    string
+		missing bool
+	}
+	values := make(map[*mapping]value, len(mappings))
+	found := false
+	for _, m := range mappings {
+		if key.expr != nil {
+			num, ok := key.expr.eval(m.numericFieldValue)
+			ok = ok && !math.IsNaN(num)
+			values[m] = value{num: num, missing: !ok}
+			found = found || ok
+			continue
+		}
+		if num, text, ok := regionSortValue(m, key.column); ok {
+			values[m] = value{num: num, text: text}
+			found = true
+			continue
+		}
+		num, ok := m.numericFieldValue(key.column)
+		values[m] = value{num: num, missing: !ok}
+		found = found || ok
+	}
+	if len(mappings) > 0 && !found {
+		return fmt.Errorf("column %q of -sort-by is not in the input", key.column)
+	}
+	sort.SliceStable(mappings, func(i, j int) bool {
+		a, b := values[mappings[i]], values[mappings[j]]
+		if a.missing || b.missing {
+			return !a.missing && b.missing
+		}
+		if key.desc {
+			a, b = b, a
+		}
+		if a.text != b.text {
+			return a.text < b.text
+		}
+		return a.num < b.num
+	})
+	return nil
+}
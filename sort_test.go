@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSmapsUnsorted = `7ffd0000-7ffd1000 rw-p 00000000 00:00 0                          [stack]
+Size:                  4 kB
+Rss:                   4 kB
+VmFlags: rd wr mr mw me gd ac
+55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat
+Size:                  4 kB
+Rss:                   4 kB
+VmFlags: rd mr mw me
+55e000-55f000 r-xp 00001000 fe:00 1234                       /usr/bin/cat
+Size:                  4 kB
+Rss:                   0 kB
+VmFlags: rd ex mr mw me
+`
+
+func TestConvertSortAddresses(t *testing.T) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := convertSmapsToCsv(w, strings.NewReader(testSmapsUnsorted), args{sortOrder: sortByAddresses}); err != nil {
+		t.Fatal(err)
+	}
+	want := "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Size,Rss,VmFlags\n" +
+		"55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4,4,rd mr mw me\n" +
+		"55e000,55f000,r-xp,00001000,fe:00,1234,/usr/bin/cat,4,0,rd ex mr mw me\n" +
+		"7ffd0000,7ffd1000,rw-p,00000000,00:00,0,[stack],4,4,rd wr mr mw me gd ac\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestConvertSortBy(t *testing.T) {
+	testCases := []struct {
+		sortBy string
+		want   []string
+	}{
+		{sortBy: "Rss:desc", want: []string{"7ffd0000", "55d000", "55e000"}},
+		{sortBy: "Rss", want: []string{"55e000", "7ffd0000", "55d000"}},
+		{sortBy: "AddressStart:asc", want: []string{"55d000", "55e000", "7ffd0000"}},
+		{sortBy: "Pathname:desc", want: []string{"7ffd0000", "55d000", "55e000"}},
+	}
+	for _, tc := range testCases {
+		key, err := parseSortKey(tc.sortBy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := convertSmapsToCsv(w, strings.NewReader(testSmapsUnsorted), args{sortBy: key, columns: []string{"AddressStart"}}); err != nil {
+			t.Fatal(err)
+		}
+		want := "AddressStart\n" + strings.Join(tc.want, "\n") + "\n"
+		if got := buf.String(); got != want {
+			t.Errorf("result mismatch for %s,\n got=%s,\nwant=%s", tc.sortBy, got, want)
+		}
+	}
+}
+
+func TestSortMappingsByKeyMissing(t *testing.T) {
+	mappings := []*mapping{
+		{FieldNames: []string{"Size"}, FieldValues: []string{"8"}},
+		{FieldNames: []string{"Size", "Swap"}, FieldValues: []string{"4", "1"}},
+		{FieldNames: []string{"Size", "Swap"}, FieldValues: []string{"4", "2"}},
+	}
+	for _, desc := range []bool{false, true} {
+		sorted := append([]*mapping(nil), mappings...)
+		if err := sortMappingsByKey(sorted, &sortKey{column: "Swap", desc: desc}); err != nil {
+			t.Fatal(err)
+		}
+		if sorted[2] != mappings[0] {
+			t.Errorf("mapping without the field is not last with desc=%v", desc)
+		}
+	}
+	if err := sortMappingsByKey(mappings, &sortKey{column: "Rss"}); err == nil {
+		t.Error("expected an error for a column not in the input")
+	}
+	if _, err := parseSortKey("Rss:down"); err == nil {
+		t.Error("expected an error for an invalid direction")
+	}
+}
+
+func TestRunSortGroupsByKey(t *testing.T) {
+	input := "55d000-55e000 r--p 00000000 fe:00 1234 /usr/bin/cat\nAnonHugePages: 0 kB\nFilePmdMapped: 2048 kB\n" +
+		"7f0000000000-7f0000400000 rw-p 00000000 00:00 0 \nAnonHugePages: 2048 kB\nFilePmdMapped: 0 kB\n" +
+		"7f0000400000-7f0000800000 rw-p 00000000 00:00 0 \nAnonHugePages: 2048 kB\nFilePmdMapped: 0 kB\n" +
+		"7ffd0000-7ffd1000 rw-p 00000000 00:00 0 [stack]\nAnonHugePages: 0 kB\nFilePmdMapped: 0 kB\n"
+	for _, tc := range []struct {
+		sortBy string
+		want   string
+	}{
+		{sortBy: "HugePages:desc", want: "Group,HugePages\n[anon],4096\n/usr/bin/cat,2048\n[stack],0\n"},
+		{sortBy: "FilePmdMapped", want: "Group,HugePages\n[anon],4096\n[stack],0\n/usr/bin/cat,2048\n"},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var a args
+		a.registerFlags(fs)
+		if err := fs.Parse([]string{"-group-by", "pathname", "-derive", "HugePages=AnonHugePages+FilePmdMapped",
+			"-sort-by", tc.sortBy, "-columns", "Group,HugePages"}); err != nil {
+			t.Fatal(err)
+		}
+		a.inputFilename = writeTestFile(t, input)
+		a.outputFilename = filepath.Join(t.TempDir(), "out.csv")
+		if err := a.validate(fs); err != nil {
+			t.Fatal(err)
+		}
+		a.stats = &runStats{}
+		if err := run(a); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(a.outputFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: result mismatch,\n got=%s,\nwant=%s", tc.sortBy, got, tc.want)
+		}
+	}
+}
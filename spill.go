@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// validateMaxMemory parses -max-memory, which bounds the memory of the
+// mappings buffered for -union-fields and of the groups of -group-by,
+// -subtotals and -totals by spilling them to temporary files.
+func (a *args) validateMaxMemory() error {
+	if a.maxMemoryStr == "" {
+		return nil
+	}
+	size, err := parseByteSize(a.maxMemoryStr)
+	if err != nil {
+		return fmt.Errorf("invalid -max-memory: %w", err)
+	}
+	if size <= 0 {
+		return errors.New("-max-memory must be positive")
+	}
+	a.maxMemory = size
+	// The sorts need all rows in memory.
+	if a.sortOrder != "" || a.sortBy != nil {
+		return errors.New("-max-memory cannot be used with -sort, -sort-by, -reproducible or -true-cost with -group-by, which sort all rows in memory")
+	}
+	return nil
+}
+
+// spillFile is a temporary file of runs of gob encoded values, which are
+// written when buffered data exceeds -max-memory and read back at the end
+// of the conversion. The file is removed when it is created, so that it
+// is freed even if the process is killed.
+type spillFile struct {
+	file *os.File
+	w    *bufio.Writer
+	// runs are the offsets of the start and the end of the runs.
+	runs [][2]int64
+	end  int64
+}
+
+func newSpillFile() (*spillFile, error) {
+	file, err := os.CreateTemp("", toolName+"-spill-*")
+	if err != nil {
+		return nil, fmt.Errorf("create spill file: %w", err)
+	}
+	if err := os.Remove(file.Name()); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &spillFile{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// writeRun writes a run of the values encoded by fn.
+func (s *spillFile) writeRun(fn func(enc *gob.Encoder) error) error {
+	start := s.end
+	if err := fn(gob.NewEncoder(s.w)); err != nil {
+		return fmt.Errorf("write spill file: %w", err)
+	}
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("write spill file: %w", err)
+	}
+	end, err := s.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	s.end = end
+	s.runs = append(s.runs, [2]int64{start, end})
+	return nil
+}
+
+// run returns the decoder of the values of the i-th run.
+func (s *spillFile) run(i int) *gob.Decoder {
+	r := s.runs[i]
+	return gob.NewDecoder(bufio.NewReader(io.NewSectionReader(s.file, r[0], r[1]-r[0])))
+}
+
+func (s *spillFile) Close() error {
+	return s.file.Close()
+}
+
+// GobEncode encodes c, whose fields are unexported, for spilled mappings.
+func (c *pageCounts) GobEncode() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d %d %d", c.present, c.swapped, c.exclusive)), nil
+}
+
+func (c *pageCounts) GobDecode(data []byte) error {
+	_, err := fmt.Sscan(string(data), &c.present, &c.swapped, &c.exclusive)
+	return err
+}
+
+// GobEncode encodes c, whose fields are unexported, for spilled mappings.
+func (c *pageContent) GobEncode() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d %d %g", c.sampled, c.zero, c.entropy)), nil
+}
+
+func (c *pageContent) GobDecode(data []byte) error {
+	_, err := fmt.Sscan(string(data), &c.sampled, &c.zero, &c.entropy)
+	return err
+}
+
+// mappingSize estimates the memory of m in bytes.
+func mappingSize(m *mapping) int64 {
+	size := int64(256)
+	if r := m.Region; r != nil {
+		size += int64(len(r.AddressStart) + len(r.AddressEnd) + len(r.Perms) + len(r.Offset) + len(r.Dev) + len(r.Inode) +
+			len(r.Pathname) + len(r.HostPath) + len(r.ResolvedPath) + len(r.MountPoint) + len(r.StackThread) + len(r.Key))
+		size += int64(32 * (len(r.NumaPages) + len(r.SwapPages)))
+	}
+	for i := range m.FieldValues {
+		size += int64(48 + len(m.FieldValues[i]))
+	}
+	return size
+}
+
+// mappingSpill buffers mappings in their order, spilling them to a
+// temporary file when their size exceeds maxMemory.
+type mappingSpill struct {
+	maxMemory int64
+	pending   []*mapping
+	size      int64
+	file      *spillFile
+}
+
+func (s *mappingSpill) add(m *mapping) error {
+	s.pending = append(s.pending, m)
+	s.size += mappingSize(m)
+	if s.maxMemory == 0 || s.size <= s.maxMemory {
+		return nil
+	}
+	if s.file == nil {
+		file, err := newSpillFile()
+		if err != nil {
+			return err
+		}
+		s.file = file
+	}
+	if err := s.file.writeRun(func(enc *gob.Encoder) error {
+		for _, m := range s.pending {
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	s.pending, s.size = nil, 0
+	return nil
+}
+
+// each calls fn with the mappings in the order they are added, and
+// removes them.
+func (s *mappingSpill) each(fn func(m *mapping) error) error {
+	if s.file != nil {
+		defer func() {
+			s.file.Close()
+			s.file = nil
+		}()
+		for i := range s.file.runs {
+			dec := s.file.run(i)
+			for {
+				m := &mapping{}
+				if err := dec.Decode(m); err == io.EOF {
+					break
+				} else if err != nil {
+					return fmt.Errorf("read spill file: %w", err)
+				}
+				if m.Region == nil {
+					m.Region = &region{}
+				}
+				if err := fn(m); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, m := range s.pending {
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	s.pending, s.size = nil, 0
+	return nil
+}
+
+// spilledGroup is a group in a sorted run of a spill file.
+type spilledGroup struct {
+	Key     string
+	Name    string
+	Process *processInfo
+	Regions int
+	Sums    []float64
+}
+
+// groupSize estimates the memory of a group with the key in bytes,
+// without its sums.
+func groupSize(key string) int64 {
+	return int64(160 + 2*len(key))
+}
+
+// spill writes the groups in a run sorted by their keys and removes them.
+func (gs *mappingGroups) spill() error {
+	if gs.file == nil {
+		file, err := newSpillFile()
+		if err != nil {
+			return err
+		}
+		gs.file = file
+	}
+	sort.Slice(gs.groups, func(i, j int) bool {
+		return gs.groups[i].key < gs.groups[j].key
+	})
+	if err := gs.file.writeRun(func(enc *gob.Encoder) error {
+		for _, g := range gs.groups {
+			if err := enc.Encode(&spilledGroup{Key: g.key, Name: g.name, Process: g.process, Regions: g.regions, Sums: g.sums}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	gs.groups, gs.byKey, gs.size = nil, make(map[string]*mappingGroup), 0
+	return nil
+}
+
+// eachMerged calls fn with the groups merged from the runs of the spill
+// file in the order of their keys, removing the file.
+func (gs *mappingGroups) eachMerged(fn func(g *mappingGroup) error) error {
+	if len(gs.groups) > 0 {
+		if err := gs.spill(); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		gs.file.Close()
+		gs.file = nil
+	}()
+	decoders := make([]*gob.Decoder, len(gs.file.runs))
+	heads := make([]*spilledGroup, len(gs.file.runs))
+	next := func(i int) error {
+		g := &spilledGroup{}
+		if err := decoders[i].Decode(g); err == io.EOF {
+			heads[i] = nil
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read spill file: %w", err)
+		}
+		heads[i] = g
+		return nil
+	}
+	for i := range decoders {
+		decoders[i] = gs.file.run(i)
+		if err := next(i); err != nil {
+			return err
+		}
+	}
+	for {
+		var first *spilledGroup
+		for _, h := range heads {
+			if h != nil && (first == nil || h.Key < first.Key) {
+				first = h
+			}
+		}
+		if first == nil {
+			return nil
+		}
+		g := &mappingGroup{key: first.Key, name: first.Name, process: first.Process}
+		for i, h := range heads {
+			if h == nil || h.Key != first.Key {
+				continue
+			}
+			g.regions += h.Regions
+			for len(g.sums) < len(h.Sums) {
+				g.sums = append(g.sums, 0)
+			}
+			for j, v := range h.Sums {
+				g.sums[j] += v
+			}
+			if err := next(i); err != nil {
+				return err
+			}
+		}
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+}
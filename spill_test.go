@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMappingSpill(t *testing.T) {
+	cached := int64(3)
+	var want []*mapping
+	for i := 0; i < 10; i++ {
+		want = append(want, &mapping{
+			Region: &region{
+				AddressStart: []byte("1000"),
+				Pathname:     []byte("/usr/lib/libc.so.6"),
+				NumaPages:    map[int]int64{0: int64(i)},
+				PageCounts:   &pageCounts{present: 1, swapped: 2, exclusive: int64(i)},
+				PageContent:  &pageContent{sampled: 4, zero: 1, entropy: 2.5},
+				CachedPages:  &cached,
+			},
+			FieldNames:  []string{"Rss", "Pss"},
+			FieldValues: []string{"4", ""},
+			FieldUnits:  []string{"kB", "kB"},
+			LineNo:      i,
+			Process:     &processInfo{Pid: 10, Comm: "cat"},
+		})
+	}
+	s := mappingSpill{maxMemory: 1000}
+	for _, m := range want {
+		if err := s.add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.file == nil || len(s.file.runs) < 2 {
+		t.Fatal("mappings are not spilled")
+	}
+	var got []*mapping
+	if err := s.each(func(m *mapping) error {
+		got = append(got, m)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch,\n got=%+v,\nwant=%+v", got, want)
+	}
+	if s.file != nil || len(s.pending) != 0 {
+		t.Error("mappings are not removed")
+	}
+}
+
+func TestMappingGroupsSpill(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 50; i++ {
+		for _, pathname := range []string{"/usr/lib/libc.so.6", "", "/usr/bin/cat", "[heap]"} {
+			input.WriteString("1000-2000 r--p 00000000 00:00 0 " + pathname + "\nRss: 4 kB\nPss: 1 kB\n")
+		}
+	}
+	groups := func(maxMemory int64) []*mapping {
+		gs, err := newMappingGroups(groupByPathname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gs.maxMemory = maxMemory
+		if err := readMappings(strings.NewReader(input.String()), func(m *mapping) error {
+			gs.add(m)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if maxMemory > 0 && gs.file == nil {
+			t.Fatal("groups are not spilled")
+		}
+		var ms []*mapping
+		if err := gs.each(func(m *mapping) error {
+			ms = append(ms, m)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return ms
+	}
+	inMemory, spilled := groups(0), groups(400)
+	// Spilled groups are in the order of their keys.
+	sort.Slice(inMemory, func(i, j int) bool { return inMemory[i].Group < inMemory[j].Group })
+	if len(spilled) != 4 {
+		t.Fatalf("got %d groups, want 4", len(spilled))
+	}
+	for i := range spilled {
+		if spilled[i].Group != inMemory[i].Group || spilled[i].Regions != 50 ||
+			!reflect.DeepEqual(spilled[i].FieldValues, []string{"200", "50"}) {
+			t.Errorf("group %d: got %s %d %q, want %s 50 [200 50]", i, spilled[i].Group, spilled[i].Regions, spilled[i].FieldValues, inMemory[i].Group)
+		}
+	}
+}
+
+func TestConvertMaxMemory(t *testing.T) {
+	input := "55d000-55e000 r--p 00000000 fe:00 1234 /usr/bin/cat\nRss: 4 kB\n" +
+		"55e000-55f000 r-xp 00001000 fe:00 1234 /usr/bin/cat\nRss: 4 kB\nTHPeligible: 0\n" +
+		"7ffd0000-7ffd1000 rw-p 00000000 00:00 0 [stack]\nRss: 8 kB\n"
+	for _, flags := range [][]string{
+		{"-union-fields", "-columns", "Pathname,Rss,THPeligible"},
+		{"-subtotals", "pathname", "-union-fields", "-columns", "Pathname,Rss"},
+	} {
+		convert := func(maxMemory string) string {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			var a args
+			a.registerFlags(fs)
+			if err := fs.Parse(append(flags, "-max-memory", maxMemory)); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.validate(fs); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input), a); err != nil {
+				t.Fatal(err)
+			}
+			return buf.String()
+		}
+		if got, want := convert("1"), convert("1G"); got != want {
+			t.Errorf("%q: result mismatch,\n got=%s,\nwant=%s", flags, got, want)
+		}
+	}
+}
+
+func TestValidateMaxMemory(t *testing.T) {
+	for _, a := range []args{
+		{maxMemoryStr: "0"},
+		{maxMemoryStr: "64X"},
+		{maxMemoryStr: "64M", sortOrder: sortByAddresses},
+		{maxMemoryStr: "64M", sortBy: &sortKey{column: "Rss"}},
+	} {
+		if err := a.validateMaxMemory(); err == nil {
+			t.Errorf("%+v: got no error", a)
+		}
+	}
+	a := args{maxMemoryStr: "64M"}
+	if err := a.validateMaxMemory(); err != nil || a.maxMemory != 64<<20 {
+		t.Errorf("got %d, %v", a.maxMemory, err)
+	}
+}
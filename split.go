@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// recordWriter is the subset of *csv.Writer used to write records.
+type recordWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+// splitWriter writes CSV records into numbered files, starting a new
+// file when the current one would exceed the row or size limit. The
+// header records are repeated at the top of every file.
+type splitWriter struct {
+	filename    string
+	comma       rune
+	headerLines int
+	maxRows     int
+	maxSize     int64
+	// fileOptions are the options of creating parts. Atomic parts
+	// appear only when the writer is closed.
+	fileOptions outputFileOptions
+
+	headers [][]byte
+	scratch bytes.Buffer
+	enc     recordWriter
+
+	part  int
+	file  *outputFile
+	bw    *bufio.Writer
+	rows  int
+	size  int64
+	files []*outputFile
+	err   error
+}
+
+// newSplitWriter returns a splitWriter writing files named after
+// filename. The first headerLines records written are treated as the
+// header. Zero maxRows or maxSize means no limit.
+func newSplitWriter(filename string, comma rune, headerLines, maxRows int, maxSize int64) *splitWriter {
+	w := &splitWriter{
+		filename:    filename,
+		comma:       comma,
+		headerLines: headerLines,
+		maxRows:     maxRows,
+		maxSize:     maxSize,
+	}
+	w.enc = csvDialect{comma: comma}.newWriter(&w.scratch)
+	return w
+}
+
+// partFilename returns the name of the n-th part of filename, e.g.
+// "out.0001.csv" for "out.csv".
+func partFilename(filename string, n int) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s.%04d%s", strings.TrimSuffix(filename, ext), n, ext)
+}
+
+func (w *splitWriter) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.scratch.Reset()
+	if err := w.enc.Write(record); err != nil {
+		return err
+	}
+	w.enc.Flush()
+	if err := w.enc.Error(); err != nil {
+		return err
+	}
+	encoded := w.scratch.Bytes()
+
+	if len(w.headers) < w.headerLines {
+		w.headers = append(w.headers, append([]byte(nil), encoded...))
+		if w.file == nil {
+			if err := w.nextPart(); err != nil {
+				return err
+			}
+			return nil
+		}
+		return w.writeBytes(encoded)
+	}
+	if w.file == nil || w.rows > 0 && w.isFull(int64(len(encoded))) {
+		if err := w.nextPart(); err != nil {
+			return err
+		}
+	}
+	if err := w.writeBytes(encoded); err != nil {
+		return err
+	}
+	w.rows++
+	return nil
+}
+
+func (w *splitWriter) isFull(nextSize int64) bool {
+	return w.maxRows > 0 && w.rows >= w.maxRows ||
+		w.maxSize > 0 && w.size+nextSize > w.maxSize
+}
+
+// nextPart closes the current file and creates the next one starting
+// with the header records.
+func (w *splitWriter) nextPart() error {
+	if err := w.closePart(); err != nil {
+		return err
+	}
+	w.part++
+	file, err := createOutputFile(partFilename(w.filename, w.part), w.fileOptions)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.file = file
+	w.bw = bufio.NewWriter(file)
+	w.rows = 0
+	w.size = 0
+	w.files = append(w.files, file)
+	for _, h := range w.headers {
+		if err := w.writeBytes(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *splitWriter) writeBytes(b []byte) error {
+	n, err := w.bw.Write(b)
+	w.size += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+func (w *splitWriter) closePart() error {
+	if w.file == nil {
+		return nil
+	}
+	if err := w.bw.Flush(); err != nil && w.err == nil {
+		w.err = err
+	}
+	if err := w.file.close(); err != nil && w.err == nil {
+		w.err = err
+	}
+	w.file = nil
+	return w.err
+}
+
+// Flush writes buffered data of the current file.
+func (w *splitWriter) Flush() {
+	if w.bw != nil {
+		if err := w.bw.Flush(); err != nil && w.err == nil {
+			w.err = err
+		}
+	}
+}
+
+func (w *splitWriter) Error() error {
+	return w.err
+}
+
+// Close closes the current file and commits all files.
+func (w *splitWriter) Close() error {
+	if err := w.closePart(); err != nil {
+		w.Abort()
+		return err
+	}
+	for _, f := range w.files {
+		if err := f.commit(); err != nil {
+			w.Abort()
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *splitWriter) Files() []string {
+	names := make([]string, len(w.files))
+	for i, f := range w.files {
+		names[i] = f.name
+	}
+	return names
+}
+
+// Abort closes the current file and removes uncommitted atomic files.
+func (w *splitWriter) Abort() {
+	for _, f := range w.files {
+		f.abort()
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitWriter(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "out.csv")
+	w := newSplitWriter(filename, ',', 1, 2, 0)
+	records := [][]string{{"A", "B"}, {"1", "2"}, {"3", "4"}, {"5", "6"}}
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Flush()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"out.0001.csv": "A,B\n1,2\n3,4\n",
+		"out.0002.csv": "A,B\n5,6\n",
+	}
+	for name, wantContent := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != wantContent {
+			t.Errorf("%s: content mismatch,\n got=%q,\nwant=%q", name, got, wantContent)
+		}
+	}
+}
+
+func TestSplitWriterMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "out.csv")
+	// The header takes 4 bytes and each row 4 bytes, so two rows fit
+	// into 12 bytes.
+	w := newSplitWriter(filename, ',', 1, 0, 12)
+	for _, r := range [][]string{{"A", "B"}, {"1", "2"}, {"3", "4"}, {"5", "6"}} {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(w.files), 2; got != want {
+		t.Errorf("file count mismatch, got=%d, want=%d", got, want)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// readSchedule spreads the reads of the inputs of a batch evenly over a
+// period with jitter, instead of reading all of them in a burst, which
+// flattens the CPU and I/O load of scanning many processes on a busy
+// host. Each input gets a slot of the period and is read at a random
+// time in its slot.
+type readSchedule struct {
+	start time.Time
+	slot  time.Duration
+	rand  *rand.Rand
+}
+
+// newReadSchedule returns a schedule of n inputs over period from start.
+func newReadSchedule(start time.Time, period time.Duration, n int, rnd *rand.Rand) *readSchedule {
+	if n < 1 {
+		n = 1
+	}
+	return &readSchedule{start: start, slot: period / time.Duration(n), rand: rnd}
+}
+
+// at returns the time to read the i-th input at.
+func (s *readSchedule) at(i int) time.Time {
+	t := s.start.Add(time.Duration(i) * s.slot)
+	if s.slot > 0 {
+		t = t.Add(time.Duration(s.rand.Int63n(int64(s.slot))))
+	}
+	return t
+}
+
+// wait sleeps until the time to read the i-th input. It returns
+// immediately if the previous reads took longer than their slots.
+func (s *readSchedule) wait(i int) {
+	if d := time.Until(s.at(i)); d > 0 {
+		time.Sleep(d)
+	}
+}
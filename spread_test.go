@@ -0,0 +1,24 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestReadSchedule(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+	s := newReadSchedule(start, time.Minute, 4, rand.New(rand.NewSource(1)))
+	for i := 0; i < 4; i++ {
+		slotStart := start.Add(time.Duration(i) * 15 * time.Second)
+		got := s.at(i)
+		if got.Before(slotStart) || !got.Before(slotStart.Add(15*time.Second)) {
+			t.Errorf("input %d: time %v out of its slot starting at %v", i, got, slotStart)
+		}
+	}
+
+	s = newReadSchedule(start, 0, 4, rand.New(rand.NewSource(1)))
+	if got := s.at(3); !got.Equal(start) {
+		t.Errorf("time without a period mismatch, got=%v, want=%v", got, start)
+	}
+}
@@ -0,0 +1,336 @@
+//go:build !minimal
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+)
+
+// sqliteTable is the name of the table of the mappings in the SQLite
+// output.
+const sqliteTable = "mappings"
+
+// SQLite file format constants. Pages have no reserved space, so the
+// usable size equals the page size.
+const (
+	sqlitePageSize       = 4096
+	sqliteHeaderSize     = 100
+	sqliteLeafTable      = 0x0d
+	sqliteInteriorTable  = 0x05
+	sqliteVersionNumber  = 3040000
+	sqliteSchemaFormat   = 4
+	sqliteTextEncodingU8 = 1
+)
+
+// errSQLiteSchemaTooLarge is returned if the CREATE TABLE statement does
+// not fit in the first page, which has no overflow in this writer.
+var errSQLiteSchemaTooLarge = errors.New("too many columns for the SQLite output")
+
+// sqliteCreateTable returns the CREATE TABLE statement of the table with
+// the columns. The columns in stringColumns are TEXT and the others have
+// NUMERIC affinity.
+func sqliteCreateTable(table string, columns []string) string {
+	var b strings.Builder
+	b.WriteString("CREATE TABLE ")
+	b.WriteString(sqliteQuote(table))
+	b.WriteString(" (")
+	for i, name := range columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(sqliteQuote(name))
+		if stringColumns[name] {
+			b.WriteString(" TEXT")
+		} else {
+			b.WriteString(" NUMERIC")
+		}
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+func sqliteQuote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqliteValue converts a value of the column name to a SQLite value: nil
+// for an empty value, int64 or float64 for a number outside
+// stringColumns and string otherwise.
+func sqliteValue(name, value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	if stringColumns[name] || !isJSONNumber(value) {
+		return value
+	}
+	if v, err := parseInt64Value(value); err == nil {
+		return v
+	}
+	if v, err := parseFloatValue(value); err == nil {
+		return v
+	}
+	return value
+}
+
+// appendSQLiteRecord appends values in the SQLite record format, a header
+// of the serial types followed by the values.
+func appendSQLiteRecord(b []byte, values []interface{}) []byte {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			types = appendSQLiteVarint(types, 0)
+		case int64:
+			typ, size := sqliteIntSerialType(v)
+			types = appendSQLiteVarint(types, typ)
+			for i := size - 1; i >= 0; i-- {
+				body = append(body, byte(v>>(8*i)))
+			}
+		case float64:
+			types = appendSQLiteVarint(types, 7)
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+			body = append(body, buf[:]...)
+		case string:
+			types = appendSQLiteVarint(types, uint64(13+2*len(v)))
+			body = append(body, v...)
+		}
+	}
+	// The header size includes its own varint, which is at most two
+	// bytes for the number of columns of a mapping.
+	headerSize := uint64(len(types) + 1)
+	if headerSize > 127 {
+		headerSize++
+	}
+	b = appendSQLiteVarint(b, headerSize)
+	b = append(b, types...)
+	return append(b, body...)
+}
+
+// sqliteIntSerialType returns the serial type of v and its size in
+// bytes.
+func sqliteIntSerialType(v int64) (uint64, int) {
+	switch {
+	case v == 0:
+		return 8, 0
+	case v == 1:
+		return 9, 0
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return 1, 1
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return 2, 2
+	case v >= -1<<23 && v < 1<<23:
+		return 3, 3
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return 4, 4
+	case v >= -1<<47 && v < 1<<47:
+		return 5, 6
+	}
+	return 6, 8
+}
+
+// appendSQLiteVarint appends v as a SQLite varint, a big-endian variable
+// length integer of 7 bits per byte, except the ninth byte with 8 bits.
+func appendSQLiteVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [8]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		buf[i] = byte(v&0x7f) | 0x80
+	}
+	return append(b, buf[i:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// sqliteBuilder lays out the pages of a SQLite database, numbered from 1.
+type sqliteBuilder struct {
+	pages [][]byte
+}
+
+// allocate returns the number of a new page.
+func (s *sqliteBuilder) allocate() uint32 {
+	s.pages = append(s.pages, make([]byte, sqlitePageSize))
+	return uint32(len(s.pages))
+}
+
+func (s *sqliteBuilder) page(n uint32) []byte {
+	return s.pages[n-1]
+}
+
+// leafCell returns a cell of a table leaf page with the payload, whose
+// part which does not fit in the page is stored in overflow pages.
+func (s *sqliteBuilder) leafCell(rowid int64, payload []byte) []byte {
+	cell := appendSQLiteVarint(nil, uint64(len(payload)))
+	cell = appendSQLiteVarint(cell, uint64(rowid))
+	const usable = sqlitePageSize
+	maxLocal := usable - 35
+	if len(payload) <= maxLocal {
+		return append(cell, payload...)
+	}
+	minLocal := (usable-12)*32/255 - 23
+	local := minLocal + (len(payload)-minLocal)%(usable-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	cell = append(cell, payload[:local]...)
+	rest := payload[local:]
+	first := s.allocate()
+	cell = appendUint32(cell, first)
+	for n := first; ; {
+		p := s.page(n)
+		size := copy(p[4:], rest)
+		rest = rest[size:]
+		if len(rest) == 0 {
+			break
+		}
+		next := s.allocate()
+		binary.BigEndian.PutUint32(p, next)
+		n = next
+	}
+	return cell
+}
+
+// writeBTreePage writes a b-tree page of the type with the cells at the
+// offset of its header, which is 100 on the first page. rightmost is the
+// right-most child of an interior page.
+func writeBTreePage(p []byte, offset int, typ byte, cells [][]byte, rightmost uint32) {
+	headerSize := 8
+	if typ == sqliteInteriorTable {
+		headerSize = 12
+		binary.BigEndian.PutUint32(p[offset+8:], rightmost)
+	}
+	p[offset] = typ
+	binary.BigEndian.PutUint16(p[offset+3:], uint16(len(cells)))
+	end := len(p)
+	for i, cell := range cells {
+		end -= len(cell)
+		copy(p[end:], cell)
+		binary.BigEndian.PutUint16(p[offset+headerSize+2*i:], uint16(end))
+	}
+	// A content start of zero means 65536, which is not used with
+	// 4096-byte pages.
+	binary.BigEndian.PutUint16(p[offset+5:], uint16(end))
+}
+
+// sqliteNode is a page of a table b-tree with the largest rowid in it.
+type sqliteNode struct {
+	page   uint32
+	maxKey int64
+}
+
+// tableBTree writes the rows as a table b-tree with rowids from 1 and
+// returns its root page.
+func (s *sqliteBuilder) tableBTree(columns []string, rows [][]string) uint32 {
+	var nodes []sqliteNode
+	var cells [][]byte
+	used := 0
+	flushLeaf := func(maxKey int64) {
+		n := s.allocate()
+		writeBTreePage(s.page(n), 0, sqliteLeafTable, cells, 0)
+		nodes = append(nodes, sqliteNode{page: n, maxKey: maxKey})
+		cells, used = nil, 0
+	}
+	values := make([]interface{}, len(columns))
+	for i, row := range rows {
+		for j, name := range columns {
+			values[j] = nil
+			if j < len(row) {
+				values[j] = sqliteValue(name, row[j])
+			}
+		}
+		cell := s.leafCell(int64(i+1), appendSQLiteRecord(nil, values))
+		if len(cells) > 0 && 8+used+len(cell)+2 > sqlitePageSize {
+			flushLeaf(int64(i))
+		}
+		cells = append(cells, cell)
+		used += len(cell) + 2
+	}
+	if len(cells) > 0 || len(nodes) == 0 {
+		flushLeaf(int64(len(rows)))
+	}
+
+	for len(nodes) > 1 {
+		var parents []sqliteNode
+		var children []sqliteNode
+		used := 0
+		flushInterior := func() {
+			n := s.allocate()
+			cells := make([][]byte, 0, len(children)-1)
+			for _, c := range children[:len(children)-1] {
+				cell := appendUint32(nil, c.page)
+				cells = append(cells, appendSQLiteVarint(cell, uint64(c.maxKey)))
+			}
+			last := children[len(children)-1]
+			writeBTreePage(s.page(n), 0, sqliteInteriorTable, cells, last.page)
+			parents = append(parents, sqliteNode{page: n, maxKey: last.maxKey})
+			children, used = nil, 0
+		}
+		for _, c := range nodes {
+			size := 4 + len(appendSQLiteVarint(nil, uint64(c.maxKey))) + 2
+			if len(children) > 1 && 12+used+size > sqlitePageSize {
+				flushInterior()
+			}
+			children = append(children, c)
+			used += size
+		}
+		flushInterior()
+		nodes = parents
+	}
+	return nodes[0].page
+}
+
+// buildSQLiteDatabase returns a SQLite database file with a table of the
+// rows, whose schema is created from the columns. The schema must fit in
+// the first page.
+func buildSQLiteDatabase(table string, columns []string, rows [][]string) ([]byte, error) {
+	s := &sqliteBuilder{}
+	s.allocate()
+	root := s.tableBTree(columns, rows)
+
+	schema := appendSQLiteRecord(nil, []interface{}{
+		"table", table, table, int64(root), sqliteCreateTable(table, columns),
+	})
+	cell := s.leafCell(1, schema)
+	if sqliteHeaderSize+8+len(cell)+2 > sqlitePageSize {
+		return nil, errSQLiteSchemaTooLarge
+	}
+	p := s.page(1)
+	writeBTreePage(p, sqliteHeaderSize, sqliteLeafTable, [][]byte{cell}, 0)
+
+	copy(p, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(p[16:], sqlitePageSize)
+	p[18], p[19] = 1, 1
+	p[21], p[22], p[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(p[24:], 1)
+	binary.BigEndian.PutUint32(p[28:], uint32(len(s.pages)))
+	binary.BigEndian.PutUint32(p[40:], 1)
+	binary.BigEndian.PutUint32(p[44:], sqliteSchemaFormat)
+	binary.BigEndian.PutUint32(p[56:], sqliteTextEncodingU8)
+	binary.BigEndian.PutUint32(p[92:], 1)
+	binary.BigEndian.PutUint32(p[96:], sqliteVersionNumber)
+
+	data := make([]byte, 0, len(s.pages)*sqlitePageSize)
+	for _, page := range s.pages {
+		data = append(data, page...)
+	}
+	return data, nil
+}
@@ -0,0 +1,235 @@
+//go:build !minimal
+
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAppendSQLiteVarint(t *testing.T) {
+	testCases := []struct {
+		v    uint64
+		want []byte
+	}{
+		{v: 0, want: []byte{0x00}},
+		{v: 127, want: []byte{0x7f}},
+		{v: 128, want: []byte{0x81, 0x00}},
+		{v: 300, want: []byte{0x82, 0x2c}},
+		{v: math.MaxUint64, want: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, tc := range testCases {
+		got := appendSQLiteVarint(nil, tc.v)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("varint mismatch for %d, got=%x, want=%x", tc.v, got, tc.want)
+		}
+		if v, n := readTestSQLiteVarint(got); v != tc.v || n != len(got) {
+			t.Errorf("varint round trip mismatch for %d, got=%d (%d bytes)", tc.v, v, n)
+		}
+	}
+}
+
+func TestSQLiteValue(t *testing.T) {
+	testCases := []struct {
+		name, value string
+		want        interface{}
+	}{
+		{name: "Rss", value: "", want: nil},
+		{name: "Rss", value: "1024", want: int64(1024)},
+		{name: "Pss", value: "1.5", want: 1.5},
+		{name: "Inode", value: "1234", want: "1234"},
+		{name: "Group", value: "rw-p", want: "rw-p"},
+		{name: "Rss", value: "007", want: "007"},
+	}
+	for _, tc := range testCases {
+		if got := sqliteValue(tc.name, tc.value); got != tc.want {
+			t.Errorf("value mismatch for %s=%q, got=%#v, want=%#v", tc.name, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestBuildSQLiteDatabase(t *testing.T) {
+	columns := []string{"Pathname", "Rss", "Pss"}
+	var rows [][]string
+	for i := 1; i <= 2000; i++ {
+		rows = append(rows, []string{fmt.Sprintf("/usr/lib/lib%d.so", i), fmt.Sprint(i * 4), "0.5"})
+	}
+	// A pathname longer than a page is stored in overflow pages.
+	rows = append(rows, []string{strings.Repeat("/x", 5000), "", "-1"})
+
+	data, err := buildSQLiteDatabase("mappings", columns, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data)%sqlitePageSize != 0 || !strings.HasPrefix(string(data), "SQLite format 3\x00") {
+		t.Fatalf("invalid database file of %d bytes", len(data))
+	}
+	if got := binary.BigEndian.Uint32(data[28:]); int(got) != len(data)/sqlitePageSize {
+		t.Errorf("database size mismatch, got=%d, want=%d", got, len(data)/sqlitePageSize)
+	}
+
+	schema := readTestSQLiteTable(t, data, 1)
+	wantSchema := []interface{}{"table", "mappings", "mappings", nil,
+		`CREATE TABLE "mappings" ("Pathname" TEXT, "Rss" NUMERIC, "Pss" NUMERIC)`}
+	if len(schema) != 1 || len(schema[0]) != len(wantSchema) {
+		t.Fatalf("schema mismatch, got=%v", schema)
+	}
+	root, ok := schema[0][3].(int64)
+	if !ok {
+		t.Fatalf("invalid root page %v", schema[0][3])
+	}
+	schema[0][3] = nil
+	if !reflect.DeepEqual(schema[0], wantSchema) {
+		t.Errorf("schema mismatch,\n got=%v,\nwant=%v", schema[0], wantSchema)
+	}
+
+	got := readTestSQLiteTable(t, data, uint32(root))
+	if len(got) != len(rows) {
+		t.Fatalf("row count mismatch, got=%d, want=%d", len(got), len(rows))
+	}
+	if want := []interface{}{"/usr/lib/lib1000.so", int64(4000), 0.5}; !reflect.DeepEqual(got[999], want) {
+		t.Errorf("row mismatch, got=%v, want=%v", got[999], want)
+	}
+	if want := []interface{}{strings.Repeat("/x", 5000), nil, int64(-1)}; !reflect.DeepEqual(got[2000], want) {
+		t.Errorf("overflow row mismatch, got=%.40v, want=%.40v", got[2000], want)
+	}
+}
+
+func TestRunSQLite(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-columns", "Pathname,Rss"}); err != nil {
+		t.Fatal(err)
+	}
+	a.format = outputFormatSQLite
+	a.inputFilename = writeTestFile(t, testTotalsInput)
+	a.outputFilename = stdioName
+	if err := a.validate(fs); err == nil || err.Error() != errTableFileStdout(outputFormatSQLite).Error() {
+		t.Fatalf("want an error for the standard output, got=%v", err)
+	}
+	a.outputFilename = filepath.Join(t.TempDir(), "memory.db")
+	if err := a.validate(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(a); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(a.outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := readTestSQLiteTable(t, data, 1)
+	got := readTestSQLiteTable(t, data, uint32(schema[0][3].(int64)))
+	want := [][]interface{}{
+		{"/usr/bin/cat", int64(4)},
+		{"[heap]", int64(12)},
+		{"/usr/lib/libc.so.6", int64(32)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows mismatch,\n got=%v,\nwant=%v", got, want)
+	}
+}
+
+func readTestSQLiteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8 && i < len(b); i++ {
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return v<<8 | uint64(b[8]), 9
+}
+
+// readTestSQLiteTable reads the rows of the table b-tree at the page root
+// in order of rowid.
+func readTestSQLiteTable(t *testing.T, data []byte, root uint32) [][]interface{} {
+	t.Helper()
+	page := data[(root-1)*sqlitePageSize : root*sqlitePageSize]
+	offset := 0
+	if root == 1 {
+		offset = sqliteHeaderSize
+	}
+	n := int(binary.BigEndian.Uint16(page[offset+3:]))
+	switch page[offset] {
+	case sqliteInteriorTable:
+		var rows [][]interface{}
+		for i := 0; i < n; i++ {
+			cell := binary.BigEndian.Uint16(page[offset+12+2*i:])
+			rows = append(rows, readTestSQLiteTable(t, data, binary.BigEndian.Uint32(page[cell:]))...)
+		}
+		return append(rows, readTestSQLiteTable(t, data, binary.BigEndian.Uint32(page[offset+8:]))...)
+	case sqliteLeafTable:
+	default:
+		t.Fatalf("invalid page type %#x of page %d", page[offset], root)
+	}
+	var rows [][]interface{}
+	for i := 0; i < n; i++ {
+		cell := page[binary.BigEndian.Uint16(page[offset+8+2*i:]):]
+		size, k := readTestSQLiteVarint(cell)
+		_, m := readTestSQLiteVarint(cell[k:])
+		cell = cell[k+m:]
+		var payload []byte
+		if size <= sqlitePageSize-35 {
+			payload = cell[:size]
+		} else {
+			minLocal := (sqlitePageSize-12)*32/255 - 23
+			local := minLocal + (int(size)-minLocal)%(sqlitePageSize-4)
+			if local > sqlitePageSize-35 {
+				local = minLocal
+			}
+			payload = append(payload, cell[:local]...)
+			for next := binary.BigEndian.Uint32(cell[local:]); next != 0; {
+				p := data[(next-1)*sqlitePageSize : next*sqlitePageSize]
+				rest := int(size) - len(payload)
+				if rest > sqlitePageSize-4 {
+					rest = sqlitePageSize - 4
+				}
+				payload = append(payload, p[4:4+rest]...)
+				next = binary.BigEndian.Uint32(p)
+			}
+		}
+		rows = append(rows, readTestSQLiteRecord(payload))
+	}
+	return rows
+}
+
+func readTestSQLiteRecord(payload []byte) []interface{} {
+	headerSize, k := readTestSQLiteVarint(payload)
+	header, body := payload[k:headerSize], payload[headerSize:]
+	var values []interface{}
+	for len(header) > 0 {
+		typ, n := readTestSQLiteVarint(header)
+		header = header[n:]
+		switch {
+		case typ == 0:
+			values = append(values, nil)
+		case typ == 8, typ == 9:
+			values = append(values, int64(typ-8))
+		case typ == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(body)))
+			body = body[8:]
+		case typ >= 13:
+			size := int(typ-13) / 2
+			values = append(values, string(body[:size]))
+			body = body[size:]
+		default:
+			size := []int{0, 1, 2, 3, 4, 6, 8}[typ]
+			v := int64(int8(body[0]))
+			for _, b := range body[1:size] {
+				v = v<<8 | int64(b)
+			}
+			values = append(values, v)
+			body = body[size:]
+		}
+	}
+	return values
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// runStats counts what a run has converted.
+type runStats struct {
+	inputFiles  []string
+	outputFiles []string
+	rows        int
+	warnings    int
+	bytesRead   int64
+	// pssKB is the sum of Pss of the read regions.
+	pssKB float64
+	// lazyFreeKB is the sum of LazyFree of the read regions, which is
+	// counted in Rss but reclaimable without swapping.
+	lazyFreeKB float64
+	// guardRegions is the number of guard regions, which reserve address
+	// space without using memory.
+	guardRegions int
+	// kernelThreads is the number of processes without mappings in a
+	// batch, which are kernel threads.
+	kernelThreads int
+	// sources are the sources which failed to be read at least once.
+	sources []sourceStats
+}
+
+// sourceStats counts the failures of reading a source, i.e. an input file
+// or a host of fleet.
+type sourceStats struct {
+	Source   string `json:"source"`
+	Failures int    `json:"failures"`
+	// Error is the error of the last failure if the source could not be
+	// read in the end.
+	Error string `json:"error,omitempty"`
+}
+
+// addSource counts failures of reading source, which could not be read
+// in the end if err is not nil.
+func (s *runStats) addSource(source string, failures int, err error) {
+	if failures == 0 && err == nil {
+		return
+	}
+	i := 0
+	for i < len(s.sources) && s.sources[i].Source != source {
+		i++
+	}
+	if i == len(s.sources) {
+		s.sources = append(s.sources, sourceStats{Source: source})
+	}
+	s.sources[i].Failures += failures
+	if err != nil {
+		s.sources[i].Error = err.Error()
+	}
+}
+
+// merge adds the counts of o, which are those of a source converted
+// apart, e.g. by a worker of -jobs, to s.
+func (s *runStats) merge(o *runStats) {
+	s.bytesRead += o.bytesRead
+	s.pssKB += o.pssKB
+	s.lazyFreeKB += o.lazyFreeKB
+	s.guardRegions += o.guardRegions
+	for _, src := range o.sources {
+		var err error
+		if src.Error != "" {
+			err = errors.New(src.Error)
+		}
+		s.addSource(src.Source, src.Failures, err)
+	}
+}
+
+// add counts m as read before the conversion options are applied.
+func (s *runStats) add(m *mapping) {
+	if pss, ok := m.numericFieldValue("Pss"); ok {
+		s.pssKB += pss
+	}
+	if lazyFree, ok := m.numericFieldValue("LazyFree"); ok {
+		s.lazyFreeKB += lazyFree
+	}
+	if isGuardCategory(m.Category) {
+		s.guardRegions++
+	}
+}
+
+// humanSummary returns a one-line summary of a run which took duration.
+func (s *runStats) humanSummary(duration time.Duration) string {
+	processes := "processes"
+	if len(s.inputFiles) == 1 {
+		processes = "process"
+	}
+	regions := fmt.Sprintf("%d regions", s.rows)
+	if s.guardRegions > 0 {
+		regions += fmt.Sprintf(" (%d guard)", s.guardRegions)
+	}
+	pss := fmt.Sprintf("total Pss %.0f kB (%s)", s.pssKB, formatByteSize(int64(s.pssKB*1024)))
+	if s.lazyFreeKB > 0 {
+		pss += fmt.Sprintf(", LazyFree %.0f kB (%s)", s.lazyFreeKB, formatByteSize(int64(s.lazyFreeKB*1024)))
+	}
+	return fmt.Sprintf("%s from %d %s, %s, %d warnings, in %v",
+		regions, len(s.inputFiles), processes, pss, s.warnings, duration.Round(time.Millisecond))
+}
+
+// formatByteSize formats n bytes with a binary unit, e.g. "1.5 MiB".
+func formatByteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// runSummary is the machine-readable summary of a run written by
+// -summary.
+type runSummary struct {
+	Success         bool     `json:"success"`
+	Error           string   `json:"error,omitempty"`
+	InputFiles      []string `json:"input_files"`
+	OutputFiles     []string `json:"output_files"`
+	Regions         int      `json:"regions"`
+	GuardRegions    int      `json:"guard_regions"`
+	KernelThreads   int      `json:"kernel_threads"`
+	LazyFreeKB      float64  `json:"lazy_free_kb"`
+	Warnings        int      `json:"warnings"`
+	BytesRead       int64    `json:"bytes_read"`
+	BytesWritten    int64    `json:"bytes_written"`
+	DurationSeconds float64  `json:"duration_seconds"`
+	// Sources are the sources which failed to be read at least once,
+	// including those read by retries.
+	Sources []sourceStats `json:"sources,omitempty"`
+}
+
+// newRunSummary returns the summary of a run which took duration and
+// ended with err.
+func newRunSummary(stats *runStats, duration time.Duration, err error) *runSummary {
+	s := &runSummary{
+		Success:         err == nil,
+		InputFiles:      append([]string{}, stats.inputFiles...),
+		OutputFiles:     append([]string{}, stats.outputFiles...),
+		Regions:         stats.rows,
+		GuardRegions:    stats.guardRegions,
+		KernelThreads:   stats.kernelThreads,
+		LazyFreeKB:      stats.lazyFreeKB,
+		Warnings:        stats.warnings,
+		BytesRead:       stats.bytesRead,
+		DurationSeconds: duration.Seconds(),
+		Sources:         append([]sourceStats(nil), stats.sources...),
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	for _, name := range stats.outputFiles {
+		if st, err := os.Stat(name); err == nil {
+			s.BytesWritten += st.Size()
+		}
+	}
+	return s
+}
+
+// writeSummary writes s as JSON to the file at path, or to the standard
+// error if path is "-".
+func writeSummary(path string, s *runSummary, opts outputFileOptions) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err := os.Stderr.Write(data)
+		return err
+	}
+	return writeOutputFile(path, data, opts)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunReplaySummary(t *testing.T) {
+	rawDir := t.TempDir()
+	a, err := newRawArchiver(rawDir, "/proc/1234/smaps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nSize: 8 kB\nRss: 4 kB\n" +
+		"55e000-55f000 r-xp 00001000 fe:00 1234                       /usr/bin/cat\nSize: 8 kB\nRss: 4 kB\n"
+	if _, err := io.WriteString(a, raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.finish(time.Time{}, "out.csv"); err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := t.TempDir()
+	summaryPath := filepath.Join(t.TempDir(), "summary.json")
+	if err := runReplay([]string{"-raw", rawDir, "-o", outputDir, "-summary", summaryPath}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s runSummary
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Success || s.Error != "" {
+		t.Errorf("run must succeed, got success=%v, error=%q", s.Success, s.Error)
+	}
+	if got, want := s.Regions, 2; got != want {
+		t.Errorf("regions mismatch, got=%d, want=%d", got, want)
+	}
+	if got, want := s.BytesRead, int64(len(raw)); got != want {
+		t.Errorf("bytes read mismatch, got=%d, want=%d", got, want)
+	}
+	if len(s.InputFiles) != 1 || len(s.OutputFiles) != 1 {
+		t.Fatalf("file count mismatch, got input=%v, output=%v", s.InputFiles, s.OutputFiles)
+	}
+	st, err := os.Stat(s.OutputFiles[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.BytesWritten, st.Size(); got != want {
+		t.Errorf("bytes written mismatch, got=%d, want=%d", got, want)
+	}
+}
+
+func TestNewRunSummaryError(t *testing.T) {
+	s := newRunSummary(&runStats{}, time.Second, os.ErrNotExist)
+	if s.Success || s.Error == "" {
+		t.Errorf("summary must record the error, got=%+v", s)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["input_files"].([]interface{}); !ok {
+		t.Errorf("input_files must be an array even if empty, got=%s", data)
+	}
+}
+
+func TestRunStatsHumanSummary(t *testing.T) {
+	s := &runStats{inputFiles: []string{"/proc/1/smaps"}, rows: 3, pssKB: 1536}
+	got := s.humanSummary(1234567 * time.Microsecond)
+	want := "3 regions from 1 process, total Pss 1536 kB (1.5 MiB), 0 warnings, in 1.235s"
+	if got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	for in, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1024: "1.0 KiB", 3 << 30: "3.0 GiB"} {
+		if got := formatByteSize(in); got != want {
+			t.Errorf("in=%d: result mismatch, got=%s, want=%s", in, got, want)
+		}
+	}
+}
+
+func TestRunStatsAddSource(t *testing.T) {
+	var s runStats
+	s.addSource("/proc/1/smaps", 0, nil)
+	s.addSource("/proc/2/smaps", 1, nil)
+	s.addSource("/proc/3/smaps", 2, os.ErrNotExist)
+	s.addSource("/proc/2/smaps", 2, nil)
+	want := []sourceStats{
+		{Source: "/proc/2/smaps", Failures: 3},
+		{Source: "/proc/3/smaps", Failures: 2, Error: os.ErrNotExist.Error()},
+	}
+	if !reflect.DeepEqual(s.sources, want) {
+		t.Errorf("sources mismatch, got=%+v, want=%+v", s.sources, want)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Bits of an entry of /proc/<pid>/pagemap. A swapped page has the swap
+// type, i.e. the index of the swap device, in the lowest 5 bits.
+const (
+	pagemapSwapped  = 1 << 62
+	pagemapSwapType = 1<<5 - 1
+	pagemapEntry    = 8
+)
+
+// pagemapChunk is the maximum number of pagemap entries read at once.
+const pagemapChunk = 1 << 16
+
+// readSwapDevices reads the swap devices in /proc/swaps, which are in the
+// order of their swap types.
+func readSwapDevices() ([]string, error) {
+	file, err := os.Open(procSysPath("swaps"))
+	if err != nil {
+		return nil, diagnoseOpenError(procSysPath("swaps"), err)
+	}
+	defer file.Close()
+	return parseSwaps(file)
+}
+
+// parseSwaps parses /proc/swaps like
+//
+//	Filename     Type       Size     Used  Priority
+//	/dev/zram0   partition  4194300  1024  100
+//	/swapfile    file       2097148  0     -2
+//
+// and returns the filenames.
+func parseSwaps(r io.Reader) ([]string, error) {
+	var devices []string
+	s := bufio.NewScanner(r)
+	lineNo := 0
+	for s.Scan() {
+		lineNo++
+		fields := strings.Fields(s.Text())
+		if lineNo == 1 || len(fields) == 0 {
+			continue
+		}
+		devices = append(devices, unescapeMountPath(fields[0]))
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// swapColumn returns the name of the column of swap on device, e.g.
+// Swap_zram0 for /dev/zram0.
+func swapColumn(device string) string {
+	return "Swap_" + filepath.Base(device)
+}
+
+// swapValue returns the swap in kB on the device of type typ, which is
+// empty if the region could not be read.
+func swapValue(pages map[int]int64, typ int) string {
+	if pages == nil {
+		return ""
+	}
+	return strconv.FormatInt(pages[typ]*int64(os.Getpagesize())/1024, 10)
+}
+
+// swapAttributor counts the swapped pages of regions on each swap device
+// from /proc/<pid>/pagemap, which has swap types only for root or
+// CAP_SYS_ADMIN.
+type swapAttributor struct {
+	pid      int
+	pageSize int64
+}
+
+func newSwapAttributor(pid int) (*swapAttributor, error) {
+	if pid <= 0 {
+		return nil, errors.New("pid of the target process is unknown; use /proc/<pid>/smaps as input")
+	}
+	return &swapAttributor{pid: pid, pageSize: int64(os.Getpagesize())}, nil
+}
+
+// regionPages returns the number of swapped pages of the region r on each
+// swap type.
+func (a *swapAttributor) regionPages(r *region) (map[int]int64, error) {
+	start, end, err := r.addressRange()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(procPath(a.pid, "pagemap"))
+	if err != nil {
+		return nil, diagnoseOpenError(procPath(a.pid, "pagemap"), err)
+	}
+	defer file.Close()
+	return countSwapPages(file, start/uint64(a.pageSize), end/uint64(a.pageSize))
+}
+
+// countSwapPages counts the swapped pages of each swap type in the
+// entries of the pages from first to before last in pagemap.
+func countSwapPages(pagemap io.ReaderAt, first, last uint64) (map[int]int64, error) {
+	pages := make(map[int]int64)
+	buf := make([]byte, pagemapChunk*pagemapEntry)
+	for page := first; page < last; {
+		n := last - page
+		if n > pagemapChunk {
+			n = pagemapChunk
+		}
+		b := buf[:n*pagemapEntry]
+		if _, err := pagemap.ReadAt(b, int64(page*pagemapEntry)); err != nil {
+			return nil, fmt.Errorf("read pagemap: %w", err)
+		}
+		for i := 0; i < len(b); i += pagemapEntry {
+			// Entries are in the host byte order, which is little
+			// endian on the usual hosts such as amd64 and arm64.
+			entry := binary.LittleEndian.Uint64(b[i:])
+			if entry&pagemapSwapped != 0 {
+				pages[int(entry&pagemapSwapType)]++
+			}
+		}
+		page += n
+	}
+	return pages, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseSwaps(t *testing.T) {
+	input := "Filename\t\t\t\tType\t\tSize\t\tUsed\t\tPriority\n" +
+		"/dev/zram0                              partition\t4194300\t\t1024\t\t100\n" +
+		"/swap\\040file                           file\t\t2097148\t\t0\t\t-2\n"
+	got, err := parseSwaps(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/dev/zram0", "/swap file"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch, got=%v, want=%v", got, want)
+	}
+}
+
+// testPagemap returns pagemap entries of pages, where a negative value is
+// a page not swapped and others are the swap types of swapped pages.
+func testPagemap(pages ...int) []byte {
+	b := make([]byte, len(pages)*pagemapEntry)
+	for i, typ := range pages {
+		entry := uint64(1) << 63 // present
+		if typ >= 0 {
+			entry = pagemapSwapped | uint64(typ) | 1234<<5
+		}
+		binary.LittleEndian.PutUint64(b[i*pagemapEntry:], entry)
+	}
+	return b
+}
+
+func TestCountSwapPages(t *testing.T) {
+	pagemap := bytes.NewReader(testPagemap(0, -1, 1, 1, 0, -1))
+	got, err := countSwapPages(pagemap, 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int]int64{0: 1, 1: 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch, got=%v, want=%v", got, want)
+	}
+	if _, err := countSwapPages(pagemap, 4, 10); err == nil {
+		t.Error("want an error for reading beyond the end of pagemap")
+	}
+}
+
+func TestConvertSwapDevices(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	if err := os.MkdirAll(filepath.Join(procRoot, "10"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "10", "pagemap"), testPagemap(-1, 0, 1, 1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pageSize := os.Getpagesize()
+	kB := func(pages int) string { return strconv.Itoa(pages * pageSize / 1024) }
+	input := strconv.FormatInt(int64(pageSize), 16) + "-" + strconv.FormatInt(int64(4*pageSize), 16) + " rw-p 00000000 00:00 0 \nSwap: " + kB(3) + " kB\n" +
+		strconv.FormatInt(int64(4*pageSize), 16) + "-" + strconv.FormatInt(int64(5*pageSize), 16) + " rw-p 00000000 00:00 0 \nSwap: 0 kB\n"
+	sa, err := newSwapAttributor(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", swapDeviceNames: []string{"/dev/zram0", "/swapfile"}, swapAttributor: sa}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := records[0][7:], []string{"Swap_zram0", "Swap_swapfile", "Swap"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("header mismatch, got=%v, want=%v", got, want)
+	}
+	if got, want := records[1][7:9], []string{kB(1), kB(2)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("swapped region mismatch, got=%v, want=%v", got, want)
+	}
+	if got, want := records[2][7:9], []string{"0", "0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("region without swap mismatch, got=%v, want=%v", got, want)
+	}
+}
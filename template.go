@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// templateData is the data of the template of -template.
+type templateData struct {
+	// Columns are the names of the columns in the output order.
+	Columns []string
+	// Mappings are the rows keyed by the column names, e.g.
+	// {{range .Mappings}}{{.Pathname}} {{.Rss}}{{end}}.
+	Mappings []map[string]string
+	// Totals are the sums of the columns of kB fields over the rows
+	// except total and subtotal rows, e.g. {{.Totals.Pss}}.
+	Totals map[string]float64
+}
+
+// templateFuncs are the functions available in templates in addition to
+// the predefined ones.
+var templateFuncs = template.FuncMap{
+	// num converts a value to a number, which is zero if it is empty or
+	// not a number, for comparisons such as {{if gt (num .Rss) 1024.0}}.
+	"num": func(s string) float64 {
+		v, _ := strconv.ParseFloat(s, 64)
+		return v
+	},
+}
+
+// parseTemplateFile parses the template file of -template.
+func parseTemplateFile(filename string) (*template.Template, error) {
+	return template.New(filepath.Base(filename)).Funcs(templateFuncs).ParseFiles(filename)
+}
+
+// templateWriter executes a template with all records, which are kept in
+// memory until Close.
+type templateWriter struct {
+	file         *outputFile
+	tmpl         *template.Template
+	headers      headerRecords
+	fieldColumns []string
+	rows         [][]string
+	err          error
+}
+
+func newTemplateWriter(file *outputFile, headerLines int, tmpl *template.Template) *templateWriter {
+	return &templateWriter{file: file, tmpl: tmpl, headers: headerRecords{headerLines: headerLines}}
+}
+
+func (w *templateWriter) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.headers.take(record) {
+		return nil
+	}
+	w.rows = append(w.rows, append([]string(nil), record...))
+	return nil
+}
+
+func (w *templateWriter) setFieldColumns(names []string) {
+	w.fieldColumns = names
+}
+
+// Flush does nothing, as the template is executed with all records.
+func (w *templateWriter) Flush() {}
+
+func (w *templateWriter) Error() error {
+	return w.err
+}
+
+// data returns the data of the template.
+func (w *templateWriter) data() templateData {
+	d := templateData{Columns: w.headers.header, Totals: make(map[string]float64)}
+	for _, row := range w.rows {
+		m := make(map[string]string, len(d.Columns))
+		for i, name := range d.Columns {
+			if i < len(row) {
+				m[name] = row[i]
+			}
+		}
+		d.Mappings = append(d.Mappings, m)
+	}
+	for _, name := range w.fieldColumns {
+		var sum float64
+		for _, m := range d.Mappings {
+			if isTotalRow(m) {
+				continue
+			}
+			v, err := strconv.ParseFloat(m[name], 64)
+			if err == nil {
+				sum += v
+			}
+		}
+		d.Totals[name] = sum
+	}
+	return d
+}
+
+// isTotalRow reports whether m is a total or subtotal row of -totals or
+// -subtotals.
+func isTotalRow(m map[string]string) bool {
+	name := m["Pathname"]
+	if name == "" {
+		name = m["Group"]
+	}
+	return name == "[total]" || strings.HasPrefix(name, "[subtotal:")
+}
+
+func (w *templateWriter) Close() error {
+	if w.err == nil {
+		bw := bufio.NewWriter(w.file)
+		if err := w.tmpl.Execute(bw, w.data()); err != nil {
+			w.err = err
+		} else if err := bw.Flush(); err != nil {
+			w.err = err
+		}
+	}
+	if w.err != nil {
+		w.file.abort()
+		return w.err
+	}
+	return w.file.commit()
+}
+
+func (w *templateWriter) Abort() {
+	w.file.abort()
+}
+
+func (w *templateWriter) Files() []string {
+	return []string{w.file.name}
+}
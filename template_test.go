@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunTemplate(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "nagios.tmpl")
+	tmpl := `{{if gt .Totals.Rss 40.0}}WARNING{{else}}OK{{end}} - Rss {{.Totals.Rss}} kB | rss={{.Totals.Rss}}KB
+{{range .Mappings}}{{if ge (num .Rss) 12.0}}{{.Pathname}} {{.Rss}}
+{{end}}{{end}}`
+	if err := os.WriteFile(templatePath, []byte(tmpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-totals"}); err != nil {
+		t.Fatal(err)
+	}
+	a.format, a.templatePath = outputFormatTemplate, templatePath
+	a.inputFilename = writeTestFile(t, testTotalsInput)
+	a.outputFilename = filepath.Join(dir, "out.txt")
+	if err := a.validate(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(a); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(a.outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The total row is in .Mappings but not in .Totals.
+	want := "WARNING - Rss 48 kB | rss=48KB\n[heap] 12\n/usr/lib/libc.so.6 32\n[total] 48\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestParseTemplateFileError(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "bad.tmpl")
+	if err := os.WriteFile(templatePath, []byte("{{range .Mappings}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseTemplateFile(templatePath); err == nil {
+		t.Error("want an error for an unterminated range")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// threadStack is the stack pointer of a thread of a live process.
+type threadStack struct {
+	tid  int
+	name string
+	sp   uint64
+}
+
+// threadStackLabeler labels the regions containing the stack pointers of
+// the threads of a process, as kernels before 4.5 did with
+// "[stack:<tid>]" pathnames.
+type threadStackLabeler struct {
+	threads []threadStack
+}
+
+// newThreadStackLabeler reads the stack pointers of the threads of the
+// process from /proc/<pid>/task/<tid>/syscall. Threads which are running,
+// have exited or whose stack pointer is not readable without
+// CAP_SYS_PTRACE are skipped.
+func newThreadStackLabeler(pid int) (*threadStackLabeler, error) {
+	taskDir := procPath(pid, "task")
+	entries, err := os.ReadDir(taskDir)
+	if err != nil {
+		return nil, err
+	}
+	l := &threadStackLabeler{}
+	for _, e := range entries {
+		tid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(taskDir, e.Name(), "syscall"))
+		if err != nil {
+			continue
+		}
+		sp, ok := parseSyscallStackPointer(string(data))
+		if !ok {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(taskDir, e.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		l.threads = append(l.threads, threadStack{tid: tid, name: strings.TrimRight(string(comm), "\n"), sp: sp})
+	}
+	return l, nil
+}
+
+// parseSyscallStackPointer returns the stack pointer in the content of a
+// /proc/<pid>/task/<tid>/syscall file, which is "running" or ends with
+// the stack pointer and the program counter.
+func parseSyscallStackPointer(s string) (uint64, bool) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return 0, false
+	}
+	sp, err := strconv.ParseUint(strings.TrimPrefix(fields[len(fields)-2], "0x"), 16, 64)
+	if err != nil || sp == 0 {
+		return 0, false
+	}
+	return sp, true
+}
+
+// label returns the thread whose stack pointer is in the region r as
+// "<tid>:<name>", or an empty string if there is none.
+func (l *threadStackLabeler) label(r *region) string {
+	start, end, err := r.addressRange()
+	if err != nil {
+		return ""
+	}
+	var labels []string
+	for _, t := range l.threads {
+		if start <= t.sp && t.sp < end {
+			labels = append(labels, fmt.Sprintf("%d:%s", t.tid, t.name))
+		}
+	}
+	return strings.Join(labels, " ")
+}
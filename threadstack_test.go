@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSyscallStackPointer(t *testing.T) {
+	testCases := []struct {
+		input  string
+		wantSP uint64
+		wantOK bool
+	}{
+		{input: "7 0x7f0 0x1 0x0 0x0 0x0 0x0 0x7ffc8a3b1e28 0x7f12345678\n", wantSP: 0x7ffc8a3b1e28, wantOK: true},
+		{input: "-1 0x7f1234000e10 0x7f12345678\n", wantSP: 0x7f1234000e10, wantOK: true},
+		{input: "running\n"},
+	}
+	for _, tc := range testCases {
+		sp, ok := parseSyscallStackPointer(tc.input)
+		if sp != tc.wantSP || ok != tc.wantOK {
+			t.Errorf("input=%q: result mismatch, got=(%x, %v), want=(%x, %v)", tc.input, sp, ok, tc.wantSP, tc.wantOK)
+		}
+	}
+}
+
+func TestThreadStackLabeler(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+
+	threads := []struct {
+		tid, comm, syscall string
+	}{
+		{tid: "1234", comm: "server\n", syscall: "7 0x1 0x2 0x3 0x4 0x5 0x6 0x7ffd0e28 0x7f10\n"},
+		{tid: "1235", comm: "worker-1\n", syscall: "-1 0x7f00a000e10 0x7f10\n"},
+		{tid: "1236", comm: "worker-2\n", syscall: "running\n"},
+	}
+	for _, th := range threads {
+		dir := filepath.Join(procRoot, "1234", "task", th.tid)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "comm"), []byte(th.comm), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "syscall"), []byte(th.syscall), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err := newThreadStackLabeler(1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		start, end string
+		want       string
+	}{
+		{start: "7ffd0000", end: "7ffd1000", want: "1234:server"},
+		{start: "7f00a000000", end: "7f00a001000", want: "1235:worker-1"},
+		{start: "55d000", end: "55e000"},
+	}
+	for _, tc := range testCases {
+		got := l.label(&region{AddressStart: []byte(tc.start), AddressEnd: []byte(tc.end)})
+		if got != tc.want {
+			t.Errorf("region %s-%s: label mismatch, got=%q, want=%q", tc.start, tc.end, got, tc.want)
+		}
+	}
+}
+
+func TestInsertAfterPathname(t *testing.T) {
+	record := []string{"s", "e", "p", "o", "d", "i", "/bin/sh", "4", "8"}
+	got := insertAfterPathname(record, "/host/bin/sh", "1234:sh")
+	want := []string{"s", "e", "p", "o", "d", "i", "/bin/sh", "/host/bin/sh", "1234:sh", "4", "8"}
+	if len(got) != len(want) {
+		t.Fatalf("length mismatch, got=%q, want=%q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("result mismatch, got=%q, want=%q", got, want)
+		}
+	}
+}
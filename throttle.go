@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	ioprioClassBestEffort = 2
+	ioprioClassIdle       = 3
+)
+
+// parseIOPriority parses an I/O scheduling priority in the form "idle"
+// or "best-effort[:level]" where level is 0 (highest) to 7 (lowest).
+func parseIOPriority(s string) (class, level int, err error) {
+	name, levelStr, hasLevel := strings.Cut(s, ":")
+	switch name {
+	case "idle":
+		if hasLevel {
+			return 0, 0, fmt.Errorf("idle I/O priority does not take a level: %q", s)
+		}
+		return ioprioClassIdle, 0, nil
+	case "best-effort":
+		level = 4
+		if hasLevel {
+			level, err = strconv.Atoi(levelStr)
+			if err != nil || level < 0 || level > 7 {
+				return 0, 0, fmt.Errorf("best-effort I/O priority level must be 0 to 7: %q", s)
+			}
+		}
+		return ioprioClassBestEffort, level, nil
+	default:
+		return 0, 0, fmt.Errorf("unsupported I/O priority: %q", s)
+	}
+}
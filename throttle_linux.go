@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+const ioprioWhoProcess = 1
+
+// lowerPriority sets the nice value and, if class is not zero, the I/O
+// scheduling priority of all threads of this process. Linux applies both
+// per thread, and threads created later inherit them from their creator.
+func lowerPriority(nice, ioClass, ioLevel int) error {
+	tids, err := selfThreadIDs()
+	if err != nil {
+		return err
+	}
+	for _, tid := range tids {
+		if nice != 0 {
+			if err := unix.Setpriority(unix.PRIO_PROCESS, tid, nice); err != nil {
+				return err
+			}
+		}
+		if ioClass != 0 {
+			prio := uintptr(ioClass<<13 | ioLevel)
+			if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), prio); errno != 0 {
+				return errno
+			}
+		}
+	}
+	return nil
+}
+
+func selfThreadIDs() ([]int, error) {
+	entries, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(entries))
+	for _, e := range entries {
+		tid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		tids = append(tids, tid)
+	}
+	return tids, nil
+}
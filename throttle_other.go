@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func lowerPriority(nice, ioClass, ioLevel int) error {
+	return errors.New("adjusting priority is supported only on Linux")
+}
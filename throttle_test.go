@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestParseIOPriority(t *testing.T) {
+	testCases := []struct {
+		in        string
+		wantClass int
+		wantLevel int
+		wantErr   bool
+	}{
+		{in: "idle", wantClass: ioprioClassIdle},
+		{in: "best-effort", wantClass: ioprioClassBestEffort, wantLevel: 4},
+		{in: "best-effort:7", wantClass: ioprioClassBestEffort, wantLevel: 7},
+		{in: "best-effort:8", wantErr: true},
+		{in: "idle:1", wantErr: true},
+		{in: "realtime", wantErr: true},
+	}
+	for _, tc := range testCases {
+		class, level, err := parseIOPriority(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("in=%s: want error, got nil", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("in=%s: %v", tc.in, err)
+		}
+		if class != tc.wantClass || level != tc.wantLevel {
+			t.Errorf("in=%s: result mismatch, got=%d:%d, want=%d:%d", tc.in, class, level, tc.wantClass, tc.wantLevel)
+		}
+	}
+}
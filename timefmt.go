@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Formats of timestamp columns.
+const (
+	timeFormatRFC3339   = "rfc3339"
+	timeFormatUnix      = "unix"
+	timeFormatUnixMilli = "unixms"
+)
+
+// timestampFormat formats values of timestamp columns.
+type timestampFormat struct {
+	format string
+	loc    *time.Location
+}
+
+// newTimestampFormat returns the format of timestamps. zone is a time
+// zone name such as "UTC", "Local" or "Asia/Tokyo", which matters only
+// for the RFC 3339 format.
+func newTimestampFormat(format, zone string) (*timestampFormat, error) {
+	switch format {
+	case timeFormatRFC3339, timeFormatUnix, timeFormatUnixMilli:
+	default:
+		return nil, fmt.Errorf("unsupported timestamp format: %q", format)
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, err
+	}
+	return &timestampFormat{format: format, loc: loc}, nil
+}
+
+// formatTime returns t formatted, or an empty string for the zero time.
+func (f *timestampFormat) formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	switch f.format {
+	case timeFormatUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case timeFormatUnixMilli:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	default:
+		return t.In(f.loc).Format(time.RFC3339)
+	}
+}
+
+// parseTime parses a value formatted by formatTime.
+func (f *timestampFormat) parseTime(s string) (time.Time, error) {
+	switch f.format {
+	case timeFormatUnix, timeFormatUnixMilli:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp: %q", s)
+		}
+		if f.format == timeFormatUnix {
+			return time.Unix(n, 0), nil
+		}
+		return time.UnixMilli(n), nil
+	default:
+		return time.Parse(time.RFC3339, s)
+	}
+}
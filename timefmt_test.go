@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimestampFormatFormatTime(t *testing.T) {
+	tm := time.Date(2024, 3, 1, 12, 34, 56, 789000000, time.UTC)
+	testCases := []struct {
+		format string
+		zone   string
+		want   string
+	}{
+		{format: timeFormatRFC3339, zone: "UTC", want: "2024-03-01T12:34:56Z"},
+		{format: timeFormatRFC3339, zone: "Asia/Tokyo", want: "2024-03-01T21:34:56+09:00"},
+		{format: timeFormatUnix, zone: "Asia/Tokyo", want: "1709296496"},
+		{format: timeFormatUnixMilli, zone: "UTC", want: "1709296496789"},
+	}
+	for _, tc := range testCases {
+		f, err := newTimestampFormat(tc.format, tc.zone)
+		if err != nil {
+			t.Skipf("format=%s, zone=%s: %v", tc.format, tc.zone, err)
+		}
+		if got := f.formatTime(tm); got != tc.want {
+			t.Errorf("format=%s, zone=%s: result mismatch, got=%q, want=%q", tc.format, tc.zone, got, tc.want)
+		}
+		if got := f.formatTime(time.Time{}); got != "" {
+			t.Errorf("format=%s: zero time must be empty, got=%q", tc.format, got)
+		}
+	}
+	if _, err := newTimestampFormat("iso", "UTC"); err == nil {
+		t.Error("unsupported format must be an error")
+	}
+}
+
+func TestConvertSmapsToCsvTimestampColumn(t *testing.T) {
+	tf, err := newTimestampFormat(timeFormatUnix, "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	a := args{
+		floatFormat:     defaultFloatFormat,
+		timestampColumn: true,
+		timestampFormat: tf,
+		captureTime:     time.Unix(1709296496, 0),
+	}
+	if err := convertSmapsToCsv(w, strings.NewReader(testSmapsUnsorted), a); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.HasPrefix(lines[0], "Timestamp,AddressStart,") {
+		t.Errorf("header mismatch, got=%q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "1709296496,") {
+		t.Errorf("record mismatch, got=%q", lines[1])
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// runTimeseries runs the timeseries subcommand, which writes a metric of
+// each region in a series of snapshots in the wide layout, one row per
+// region and one column per snapshot, for plotting without a pivot step.
+func runTimeseries(arguments []string) error {
+	fs := flag.NewFlagSet("timeseries", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s timeseries [-metric <field>] [-by-pathname] [-o <file>] (-raw <dir> | <capture file or dir>...)\n\n"+
+			"The files in a directory are snapshots in the order of their names, e.g. timestamps,\n"+
+			"which are the column names.\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	metric := fs.String("metric", "Pss", "field of the regions to write for each snapshot")
+	rawDir := fs.String("raw", "", "directory of raw captures saved by -keep-raw, whose capture times are the column names")
+	outputFilename := fs.String("o", stdioName, "output CSV filename, or \"-\" for the standard output")
+	byPathname := fs.Bool("by-pathname", false, "write a row for each pathname with the sum of the metric of its regions instead of a row for each region")
+	growthReport := fs.String("growth-report", "", "CSV file to write the regions with the largest absolute and relative growth of the metric between the first and the last snapshot to, or \"-\" for the standard error")
+	growthTop := fs.Int("growth-top", 10, "number of regions in each ranking of -growth-report")
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if (*rawDir == "") == (fs.NArg() == 0) {
+		fs.Usage()
+		return errors.New("either -raw or capture files must be given")
+	}
+
+	s := newRegionSeries(*metric)
+	s.byPathname = *byPathname
+	if *rawDir != "" {
+		if err := s.readRawCaptures(*rawDir); err != nil {
+			return err
+		}
+	} else {
+		for _, filename := range fs.Args() {
+			if err := s.readPath(filename); err != nil {
+				return err
+			}
+		}
+	}
+	data, err := s.csv()
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFile(*outputFilename, data, outputFileOptions{}); err != nil {
+		return err
+	}
+	if *growthReport != "" {
+		data, err := s.growthReport(*growthTop)
+		if err != nil {
+			return err
+		}
+		if *growthReport == stdioName {
+			_, err := os.Stderr.Write(data)
+			return err
+		}
+		return writeOutputFile(*growthReport, data, outputFileOptions{})
+	}
+	return nil
+}
+
+// regionKey identifies a region across snapshots.
+type regionKey struct {
+	pid        int
+	start, end uint64
+	pathname   string
+}
+
+// regionSeries collects a metric of each region over snapshots.
+type regionSeries struct {
+	metric string
+	// snapshots are the names of the snapshots, e.g. the capture times.
+	snapshots []string
+	keys      []regionKey
+	values    map[regionKey][]string
+	// addresses are the addresses of the regions as written in smaps.
+	addresses map[regionKey][2]string
+	hasPid    bool
+	// byPathname sums the metric of the regions of each pathname, whose
+	// keys have no addresses.
+	byPathname bool
+}
+
+func newRegionSeries(metric string) *regionSeries {
+	return &regionSeries{metric: metric, values: make(map[regionKey][]string), addresses: make(map[regionKey][2]string)}
+}
+
+// addSnapshot starts a snapshot named name, to which the following
+// mappings are added.
+func (s *regionSeries) addSnapshot(name string) {
+	s.snapshots = append(s.snapshots, name)
+}
+
+// add adds the metric of m of the process pid, or zero if unknown, to
+// the last snapshot.
+func (s *regionSeries) add(pid int, m *mapping) error {
+	start, end, err := m.Region.addressRange()
+	if err != nil {
+		return fmt.Errorf("line %d: %w", m.LineNo, err)
+	}
+	key := regionKey{pid: pid, start: start, end: end, pathname: string(m.Region.Pathname)}
+	if s.byPathname {
+		key.start, key.end = 0, 0
+		if key.pathname == "" {
+			key.pathname = "[anon]"
+		}
+	}
+	values, ok := s.values[key]
+	if !ok {
+		s.keys = append(s.keys, key)
+		s.addresses[key] = [2]string{string(m.Region.AddressStart), string(m.Region.AddressEnd)}
+	}
+	for len(values) < len(s.snapshots) {
+		values = append(values, "")
+	}
+	if v, ok := m.fieldValue(s.metric); ok {
+		last := &values[len(s.snapshots)-1]
+		if s.byPathname && *last != "" {
+			sum, err := addNumericValues(*last, v)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", m.LineNo, err)
+			}
+			v = sum
+		}
+		*last = v
+	}
+	s.values[key] = values
+	if pid != 0 {
+		s.hasPid = true
+	}
+	return nil
+}
+
+// readSnapshot adds the mappings read from r as a snapshot.
+func (s *regionSeries) readSnapshot(name string, pid int, r io.Reader) error {
+	s.addSnapshot(name)
+	return readMappings(r, func(m *mapping) error {
+		return s.add(pid, m)
+	})
+}
+
+// readPath adds the capture file filename as a snapshot, or the files
+// in it in the order of their names if it is a directory.
+func (s *regionSeries) readPath(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return s.readFile(filename, filename)
+	}
+	entries, err := os.ReadDir(filename)
+	if err != nil {
+		return err
+	}
+	n := len(s.snapshots)
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if err := s.readFile(filepath.Join(filename, e.Name()), e.Name()); err != nil {
+			return err
+		}
+	}
+	if len(s.snapshots) == n {
+		return fmt.Errorf("no capture files in %s", filename)
+	}
+	return nil
+}
+
+// readFile adds the capture file filename as a snapshot named name.
+func (s *regionSeries) readFile(filename, name string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := s.readSnapshot(name, pidFromInputPath(filename), file); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// readRawCaptures adds the raw captures in dir as snapshots named by
+// their capture times. Captures of the same time, e.g. of several
+// processes, are in the same snapshot.
+func (s *regionSeries) readRawCaptures(dir string) error {
+	m, err := readRawManifest(dir)
+	if err != nil {
+		return err
+	}
+	if len(m.Captures) == 0 {
+		return fmt.Errorf("no raw captures in %s", dir)
+	}
+	for _, c := range m.Captures {
+		if len(s.snapshots) == 0 || s.snapshots[len(s.snapshots)-1] != c.CaptureTime {
+			s.addSnapshot(c.CaptureTime)
+		}
+		if err := s.readRawCapture(dir, c); err != nil {
+			return fmt.Errorf("%s: %w", c.File, err)
+		}
+	}
+	return nil
+}
+
+func (s *regionSeries) readRawCapture(dir string, c rawCapture) error {
+	file, err := os.Open(filepath.Join(dir, c.File))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	pid := pidFromInputPath(c.Source)
+	return readMappings(gz, func(m *mapping) error {
+		return s.add(pid, m)
+	})
+}
+
+// regionColumns returns the columns identifying the rows.
+func (s *regionSeries) regionColumns() []string {
+	if s.byPathname {
+		return []string{"Pathname"}
+	}
+	return []string{"AddressStart", "AddressEnd", "Pathname"}
+}
+
+// regionValues returns the values of the regionColumns of key.
+func (s *regionSeries) regionValues(key regionKey) []string {
+	if s.byPathname {
+		return []string{key.pathname}
+	}
+	addresses := s.addresses[key]
+	return []string{addresses[0], addresses[1], key.pathname}
+}
+
+// addNumericValues returns the sum of the field values a and b.
+func addNumericValues(a, b string) (string, error) {
+	x, err := strconv.ParseFloat(a, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid value %q: %w", a, err)
+	}
+	y, err := strconv.ParseFloat(b, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid value %q: %w", b, err)
+	}
+	return strconv.FormatFloat(x+y, 'f', -1, 64), nil
+}
+
+// csv returns the series with a row for each region sorted by the pid
+// and the address, or for each pathname with byPathname, and a column for
+// each snapshot. The values of the snapshots not having the region are
+// empty.
+func (s *regionSeries) csv() ([]byte, error) {
+	keys := append([]regionKey(nil), s.keys...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.pid != b.pid {
+			return a.pid < b.pid
+		}
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		if a.end != b.end {
+			return a.end < b.end
+		}
+		return a.pathname < b.pathname
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	var header []string
+	if s.hasPid {
+		header = append(header, "Pid")
+	}
+	header = append(append(header, s.regionColumns()...), s.snapshots...)
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		var record []string
+		if s.hasPid {
+			record = append(record, strconv.Itoa(key.pid))
+		}
+		record = append(record, s.regionValues(key)...)
+		values := s.values[key]
+		for len(values) < len(s.snapshots) {
+			values = append(values, "")
+		}
+		record = append(record, values...)
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunTimeseries(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.smaps")
+	second := filepath.Join(dir, "second.smaps")
+	if err := os.WriteFile(first, []byte(
+		"0055d000-0055e000 r--p 00000000 fe:00 1234                       /usr/bin/app\nRss: 4 kB\nPss: 4 kB\n"+
+			"0055e000-00580000 rw-p 00000000 00:00 0                          [heap]\nRss: 100 kB\nPss: 100 kB\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte(
+		"0055d000-0055e000 r--p 00000000 fe:00 1234                       /usr/bin/app\nRss: 4 kB\nPss: 2 kB\n"+
+			"0055e000-00580000 rw-p 00000000 00:00 0                          [heap]\nRss: 200 kB\nPss: 200 kB\n"+
+			"7f0000000000-7f0000001000 rw-p 00000000 00:00 0 \nRss: 4 kB\nPss: 4 kB\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "series.csv")
+	if err := runTimeseries([]string{"-o", output, first, second}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "AddressStart,AddressEnd,Pathname," + first + "," + second + "\n" +
+		"0055d000,0055e000,/usr/bin/app,4,2\n" +
+		"0055e000,00580000,[heap],100,200\n" +
+		"7f0000000000,7f0000001000,,,4\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestRunTimeseriesRaw(t *testing.T) {
+	rawDir := t.TempDir()
+	for i, rss := range []string{"4", "8"} {
+		a, err := newRawArchiver(rawDir, "/proc/1234/smaps")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(a, "55d000-55e000 rw-p 00000000 00:00 0                          [heap]\nRss: "+rss+" kB\n"); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.finish(time.Date(2024, 1, 2, 3, 4, i, 0, time.UTC), "out.csv"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := filepath.Join(t.TempDir(), "series.csv")
+	if err := runTimeseries([]string{"-metric", "Rss", "-raw", rawDir, "-o", output}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Pid,AddressStart,AddressEnd,Pathname,2024-01-02T03:04:00Z,2024-01-02T03:04:01Z\n" +
+		"1234,55d000,55e000,[heap],4,8\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
+func TestRunTimeseriesByPathnameDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"2024-01-02T03:04:00Z": "0055d000-0055e000 r--p 00000000 fe:00 1234                       /usr/lib/libc.so.6\nPss: 4 kB\n" +
+			"0055e000-0055f000 r-xp 00001000 fe:00 1234                       /usr/lib/libc.so.6\nPss: 8 kB\n" +
+			"0055f000-00560000 rw-p 00000000 00:00 0 \nPss: 1 kB\n",
+		"2024-01-02T03:05:00Z": "0055d000-0055e000 r--p 00000000 fe:00 1234                       /usr/lib/libc.so.6\nPss: 4 kB\n" +
+			"0055e000-0055f000 r-xp 00001000 fe:00 1234                       /usr/lib/libc.so.6\nPss: 16 kB\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := filepath.Join(t.TempDir(), "series.csv")
+	if err := runTimeseries([]string{"-by-pathname", "-o", output, dir}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Pathname,2024-01-02T03:04:00Z,2024-01-02T03:05:00Z\n" +
+		"/usr/lib/libc.so.6,12,20\n" +
+		"[anon],1,\n"
+	if string(got) != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// topColumns are the kB fields shown by the top subcommand, to which the
+// field of -sort-by is added if it is not one of them.
+var topColumns = []string{"Size", "Rss", "Pss"}
+
+// runTop runs the top subcommand, which prints the mappings or pathnames
+// with the largest field as an aligned table like pmap -x.
+func runTop(arguments []string) error {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s top [-n <n>] [-sort-by <field>] [-by-pathname] <pid|capture file>\n\n", toolName)
+		fs.PrintDefaults()
+	}
+	n := fs.Int("n", 10, "number of rows to print, or 0 for all")
+	sortBy := fs.String("sort-by", "Pss", "kB field to sort the rows by in descending order, e.g. Pss, Rss or Swap")
+	byPathname := fs.Bool("by-pathname", false, "print the sums of the mappings of each pathname instead of the mappings")
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a pid or a capture file must be given")
+	}
+	if *n < 0 {
+		return errors.New("-n must not be negative")
+	}
+
+	t := newTopTable(*sortBy, *byPathname)
+	if err := readSource(fs.Arg(0), func(m *mapping) error {
+		t.add(m)
+		return nil
+	}); err != nil {
+		return err
+	}
+	return t.write(os.Stdout, *n)
+}
+
+// topEntry is a row of the top table, a mapping or the sum of the
+// mappings of a pathname.
+type topEntry struct {
+	name    string
+	address string
+	perms   string
+	regions int
+	values  map[string]float64
+}
+
+// topTable collects the rows of the top subcommand.
+type topTable struct {
+	sortBy     string
+	byPathname bool
+	entries    []*topEntry
+	pathnames  map[string]*topEntry
+	total      topEntry
+}
+
+func newTopTable(sortBy string, byPathname bool) *topTable {
+	return &topTable{
+		sortBy:     sortBy,
+		byPathname: byPathname,
+		pathnames:  make(map[string]*topEntry),
+		total:      topEntry{name: "total", values: make(map[string]float64)},
+	}
+}
+
+func (t *topTable) add(m *mapping) {
+	name := string(m.Region.Pathname)
+	if name == "" {
+		name = "[anon]"
+	}
+	e := t.pathnames[name]
+	if !t.byPathname || e == nil {
+		e = &topEntry{name: name, values: make(map[string]float64)}
+		if t.byPathname {
+			t.pathnames[name] = e
+		} else {
+			e.address = string(m.Region.AddressStart)
+			e.perms = string(m.Region.Perms)
+		}
+		t.entries = append(t.entries, e)
+	}
+	for _, entry := range []*topEntry{e, &t.total} {
+		entry.regions++
+		for _, name := range m.FieldNames {
+			if v, ok := m.numericFieldValue(name); ok {
+				entry.values[name] += v
+			}
+		}
+	}
+}
+
+// columns returns the kB fields of the table.
+func (t *topTable) columns() []string {
+	for _, name := range topColumns {
+		if name == t.sortBy {
+			return topColumns
+		}
+	}
+	return append(append([]string(nil), topColumns...), t.sortBy)
+}
+
+// write writes the n rows with the largest field of -sort-by, or all
+// rows if n is zero, followed by the total of all mappings.
+func (t *topTable) write(w io.Writer, n int) error {
+	if len(t.entries) > 0 {
+		if _, ok := t.total.values[t.sortBy]; !ok {
+			return fmt.Errorf("field %q of -sort-by is not in the input", t.sortBy)
+		}
+	}
+	entries := append([]*topEntry(nil), t.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].values[t.sortBy] > entries[j].values[t.sortBy]
+	})
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+
+	columns := t.columns()
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	if t.byPathname {
+		fmt.Fprint(tw, "Regions\t")
+	} else {
+		fmt.Fprint(tw, "Address\tPerms\t")
+	}
+	for _, name := range columns {
+		fmt.Fprintf(tw, "%s kB\t", name)
+	}
+	fmt.Fprintln(tw, "  Mapping")
+	for _, e := range append(entries, &t.total) {
+		switch {
+		case t.byPathname:
+			fmt.Fprintf(tw, "%d\t", e.regions)
+		case e == &t.total:
+			fmt.Fprint(tw, "\t\t")
+		default:
+			fmt.Fprintf(tw, "%s\t%s\t", e.address, e.perms)
+		}
+		for _, name := range columns {
+			fmt.Fprintf(tw, "%s\t", strconv.FormatFloat(e.values[name], 'f', -1, 64))
+		}
+		// The last cell is not aligned, so it is padded by itself.
+		fmt.Fprintln(tw, "  "+e.name)
+	}
+	return tw.Flush()
+}
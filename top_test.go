@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTopTable(t *testing.T) {
+	input := `55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat
+Size:                  4 kB
+Rss:                   4 kB
+Pss:                   2 kB
+Swap:                  0 kB
+55e000-580000 rw-p 00000000 00:00 0                          [heap]
+Size:                136 kB
+Rss:                  12 kB
+Pss:                  12 kB
+Swap:                 24 kB
+7f0000000000-7f0000010000 r-xp 00000000 fe:00 1234                       /usr/bin/cat
+Size:                 64 kB
+Rss:                  32 kB
+Pss:                   8 kB
+Swap:                  0 kB
+`
+	testCases := []struct {
+		sortBy     string
+		byPathname bool
+		n          int
+		want       string
+	}{
+		{sortBy: "Pss", n: 2, want: "" +
+			"       Address  Perms  Size kB  Rss kB  Pss kB  Mapping\n" +
+			"        55e000   rw-p      136      12      12  [heap]\n" +
+			"  7f0000000000   r-xp       64      32       8  /usr/bin/cat\n" +
+			"                           204      48      22  total\n"},
+		{sortBy: "Swap", byPathname: true, want: "" +
+			"  Regions  Size kB  Rss kB  Pss kB  Swap kB  Mapping\n" +
+			"        1      136      12      12       24  [heap]\n" +
+			"        2       68      36      10        0  /usr/bin/cat\n" +
+			"        3      204      48      22       24  total\n"},
+	}
+	for _, tc := range testCases {
+		tt := newTopTable(tc.sortBy, tc.byPathname)
+		if err := readMappings(strings.NewReader(input), func(m *mapping) error {
+			tt.add(m)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tt.write(&buf, tc.n); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("sort-by=%s: result mismatch,\n got=%s,\nwant=%s", tc.sortBy, got, tc.want)
+		}
+	}
+
+	tt := newTopTable("Anonymous", false)
+	if err := readMappings(strings.NewReader(input), func(m *mapping) error {
+		tt.add(m)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tt.write(&bytes.Buffer{}, 0); err == nil {
+		t.Error("got no error for a -sort-by field missing in the input")
+	}
+}
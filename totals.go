@@ -0,0 +1,22 @@
+package main
+
+import "bytes"
+
+// writeTotalsFile writes the header and the total row of mw, which has the
+// same columns as the output, to the CSV file filename for -totals-out.
+func writeTotalsFile(filename string, args args, mw *mappingWriter) error {
+	var buf bytes.Buffer
+	w := args.csvDialect().newWriter(&buf)
+	if m := mw.totalMapping(); m != nil {
+		tw := newMappingWriter(w, args)
+		tw.timestamp = mw.timestamp
+		if err := tw.writeMapping(m); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeOutputFile(filename, buf.Bytes(), args.outputFileOptions)
+}
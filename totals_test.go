@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testTotalsInput = "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nKernelPageSize: 4 kB\nRss: 4 kB\nTHPeligible: 0\n" +
+	"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nKernelPageSize: 4 kB\nRss: 12 kB\nTHPeligible: 0\n" +
+	"7f0000000000-7f0000010000 r--p 00000000 fe:00 42                         /usr/lib/libc.so.6\nKernelPageSize: 4 kB\nRss: 32 kB\nTHPeligible: 0\n"
+
+func TestConvertTotals(t *testing.T) {
+	testCases := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "regions",
+			args: args{totals: true, subtotals: groupByPerms},
+			want: "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,KernelPageSize,Rss,THPeligible\n" +
+				"55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4,4,0\n" +
+				"55e000,580000,rw-p,00000000,00:00,0,[heap],4,12,0\n" +
+				"7f0000000000,7f0000010000,r--p,00000000,fe:00,42,/usr/lib/libc.so.6,4,32,0\n" +
+				",,,,,,[subtotal:r--p],,36,\n" +
+				",,,,,,[subtotal:rw-p],,12,\n" +
+				",,,,,,[total],,48,\n",
+		},
+		{
+			name: "groups",
+			args: args{totals: true, groupBy: groupByPerms},
+			want: "Group,Regions,Rss\n" +
+				"r--p,2,36\n" +
+				"rw-p,1,12\n" +
+				"[total],3,48\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := tc.args
+			a.Separator, a.floatFormat = ",", defaultFloatFormat
+			var buf bytes.Buffer
+			if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(testTotalsInput), a); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRunTotalsOut(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	dir := t.TempDir()
+	totalsPath := filepath.Join(dir, "totals.csv")
+	if err := fs.Parse([]string{"-totals-out", totalsPath, "-columns", "Pathname,Rss"}); err != nil {
+		t.Fatal(err)
+	}
+	a.inputFilename = writeTestFile(t, testTotalsInput)
+	a.outputFilename = filepath.Join(dir, "out.csv")
+	if err := a.validate(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(a); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(totalsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Pathname,Rss\n[total],48\n"; string(got) != want {
+		t.Errorf("totals mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+	output, err := os.ReadFile(a.outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(output), "[total]") {
+		t.Errorf("output must not have the total row without -totals, got=%s", output)
+	}
+}
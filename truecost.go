@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// trueCostName is the name of the column added by -true-cost, the memory
+// attributed to a region or group including its share of swap.
+const trueCostName = "TrueCost"
+
+// defaultTrueCostExpr is the default formula of TrueCost, the proportional
+// share of resident and swapped memory.
+const defaultTrueCostExpr = "Pss+SwapPss"
+
+const sortByTrueCost = "truecost"
+
+// parseTrueCost parses the formula of TrueCost given by -true-cost-expr.
+func parseTrueCost(src string) (derivedColumn, error) {
+	c, err := parseDerivedColumn(trueCostName + "=" + src)
+	if err != nil {
+		return derivedColumn{}, fmt.Errorf("invalid -true-cost-expr: %w", err)
+	}
+	return c, nil
+}
+
+// sortMappingsByCost sorts mappings by cost in descending order. Mappings
+// whose cost cannot be computed are last. The sort is stable like
+// sortMappings.
+func sortMappingsByCost(mappings []*mapping, cost expr) {
+	costs := make(map[*mapping]float64, len(mappings))
+	for _, m := range mappings {
+		v, ok := cost.eval(m.numericFieldValue)
+		if !ok || math.IsNaN(v) {
+			v = math.Inf(-1)
+		}
+		costs[m] = v
+	}
+	sort.SliceStable(mappings, func(i, j int) bool {
+		return costs[mappings[i]] > costs[mappings[j]]
+	})
+}
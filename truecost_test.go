@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"strings"
+	"testing"
+)
+
+const testTrueCostInput = "55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat\nPss: 4 kB\nSwapPss: 0 kB\n" +
+	"55e000-580000 rw-p 00000000 00:00 0                          [heap]\nPss: 12 kB\nSwapPss: 40 kB\n" +
+	"7f0000000000-7f0000010000 r--p 00000000 fe:00 42                         /usr/lib/libc.so.6\nPss: 32 kB\nSwapPss: 0 kB\n"
+
+func TestConvertTrueCost(t *testing.T) {
+	testCases := []struct {
+		name      string
+		arguments []string
+		want      string
+	}{
+		{
+			name:      "regions",
+			arguments: []string{"-true-cost", "-columns", "Pathname,TrueCost"},
+			want:      "Pathname,TrueCost\n/usr/bin/cat,4\n[heap],52\n/usr/lib/libc.so.6,32\n",
+		},
+		{
+			name:      "sortedRegions",
+			arguments: []string{"-true-cost", "-sort", "truecost", "-columns", "Pathname,TrueCost"},
+			want:      "Pathname,TrueCost\n[heap],52\n/usr/lib/libc.so.6,32\n/usr/bin/cat,4\n",
+		},
+		{
+			name:      "groups",
+			arguments: []string{"-true-cost", "-group-by", groupByPerms},
+			want:      "Group,Regions,Pss,SwapPss,TrueCost\nrw-p,1,12,40,52\nr--p,2,36,0,36\n",
+		},
+		{
+			name:      "expr",
+			arguments: []string{"-true-cost", "-true-cost-expr", "Pss+SwapPss/2", "-group-by", groupByPerms},
+			want:      "Group,Regions,Pss,SwapPss,TrueCost\nr--p,2,36,0,36\nrw-p,1,12,40,32\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			var a args
+			a.registerFlags(fs)
+			if err := fs.Parse(tc.arguments); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.validate(fs); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.prepare(); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(testTrueCostInput), a); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateTrueCost(t *testing.T) {
+	for _, arguments := range [][]string{
+		{"-sort", "truecost"},
+		{"-true-cost-expr", "Pss"},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var a args
+		a.registerFlags(fs)
+		if err := fs.Parse(arguments); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.validate(fs); err == nil {
+			t.Errorf("want an error for %v", arguments)
+		}
+	}
+
+	if _, err := parseTrueCost("Pss+"); err == nil {
+		t.Error("want an error for an invalid formula")
+	}
+}
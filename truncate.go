@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// truncationChecker detects a capture which ends in the middle of its last
+// region, e.g. when the copy of a smaps file was interrupted or a process
+// exited while it was read. The fields of the last region are compared to
+// those of the first region, since the kernel writes the same set of fields
+// for every region.
+type truncationChecker struct {
+	fieldNames []string
+	fieldUnits []string
+}
+
+// observe records the fields of the first mapping.
+func (c *truncationChecker) observe(m *mapping) {
+	if c.fieldNames == nil {
+		c.fieldNames = append([]string{}, m.FieldNames...)
+		c.fieldUnits = append([]string{}, m.FieldUnits...)
+	}
+}
+
+// check returns a description of how the last mapping m of the capture is
+// truncated, or an empty string if it is complete.
+func (c *truncationChecker) check(m *mapping) string {
+	n := len(m.FieldNames)
+	if n > len(c.fieldNames) {
+		return ""
+	}
+	for i := 0; i < n; i++ {
+		if m.FieldNames[i] != c.fieldNames[i] {
+			return ""
+		}
+	}
+	if n > 0 && m.FieldUnits[n-1] != c.fieldUnits[n-1] {
+		return fmt.Sprintf("capture ends in the middle of the %s field of the last region", m.FieldNames[n-1])
+	}
+	if n == len(c.fieldNames) {
+		return ""
+	}
+	return fmt.Sprintf("capture ends in the last region with %d of %d fields, missing %s",
+		n, len(c.fieldNames), strings.Join(c.fieldNames[n:], ", "))
+}
+
+// complete fills the fields missing in the truncated mapping m with empty
+// values, so it is written with the same columns as the other mappings.
+func (c *truncationChecker) complete(m *mapping) {
+	n := len(m.FieldNames)
+	if n > 0 && m.FieldUnits[n-1] != c.fieldUnits[n-1] {
+		m.FieldValues[n-1] = ""
+		m.FieldUnits[n-1] = c.fieldUnits[n-1]
+	}
+	for i := n; i < len(c.fieldNames); i++ {
+		m.appendField(c.fieldNames[i], "", c.fieldUnits[i])
+	}
+	m.Truncated = true
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+const testSmapsTruncated = `55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat
+Size:                  8 kB
+Rss:                   4 kB
+VmFlags: rd mr mw me sd
+55e000-562000 r-xp 00001000 fe:00 1234                       /usr/bin/cat
+Size:                 16 kB
+`
+
+func TestTruncationCheckerCheck(t *testing.T) {
+	first := &mapping{}
+	first.appendField("Size", "8", "kB")
+	first.appendField("Rss", "4", "kB")
+	first.appendField("VmFlags", "rd mr", "")
+
+	testCases := []struct {
+		fields [][3]string
+		want   string
+	}{
+		{fields: [][3]string{{"Size", "8", "kB"}, {"Rss", "4", "kB"}, {"VmFlags", "rd", ""}}},
+		{
+			fields: [][3]string{{"Size", "8", "kB"}},
+			want:   "capture ends in the last region with 1 of 3 fields, missing Rss, VmFlags",
+		},
+		{
+			fields: [][3]string{{"Size", "8", "kB"}, {"Rss", "4", ""}},
+			want:   "capture ends in the middle of the Rss field of the last region",
+		},
+		{fields: [][3]string{{"Size", "8", "kB"}, {"Pss", "4", "kB"}}},
+	}
+	for _, tc := range testCases {
+		c := &truncationChecker{}
+		c.observe(first)
+		m := &mapping{}
+		for _, f := range tc.fields {
+			m.appendField(f[0], f[1], f[2])
+		}
+		if got := c.check(m); got != tc.want {
+			t.Errorf("fields %v: result mismatch,\n got=%q,\nwant=%q", tc.fields, got, tc.want)
+		}
+	}
+}
+
+func TestConvertTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(testSmapsTruncated), args{Separator: ",", strict: true})
+	if err == nil || !strings.HasPrefix(err.Error(), "line 5: capture ends in the last region with 1 of 3 fields") {
+		t.Errorf("error mismatch, got=%v", err)
+	}
+
+	l := &anomalyLog{file: "smaps"}
+	buf.Reset()
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(testSmapsTruncated), args{Separator: ",", truncatedColumn: true, anomalies: l}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := l.count, 1; got != want {
+		t.Errorf("anomaly count mismatch, got=%d, want=%d", got, want)
+	}
+	want := "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Size,Rss,VmFlags,Truncated\n" +
+		"55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,8,4,rd mr mw me sd,false\n" +
+		"55e000,562000,r-xp,00001000,fe:00,1234,/usr/bin/cat,16,,,true\n"
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Types of the columns in a type manifest.
+const (
+	columnTypeString = "string"
+	columnTypeUint64 = "uint64"
+	columnTypeInt64  = "int64"
+	columnTypeFloat  = "float64"
+	columnTypeBool   = "bool"
+)
+
+// columnType is the type of a column in a type manifest, with the unit of
+// memory sizes and counts of pages.
+type columnType struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Unit string `json:"unit,omitempty"`
+}
+
+// typeManifest declares the types of the columns of an output, which is
+// written by -types-out and enforced by -types.
+type typeManifest struct {
+	SchemaVersion int          `json:"schema_version"`
+	Columns       []columnType `json:"columns"`
+}
+
+// readTypeManifest reads the type manifest in filename.
+func readTypeManifest(filename string) (*typeManifest, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var m typeManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	for _, c := range m.Columns {
+		switch c.Type {
+		case columnTypeString, columnTypeUint64, columnTypeInt64, columnTypeFloat, columnTypeBool:
+		default:
+			return nil, fmt.Errorf("%s: unsupported type of column %s: %q", filename, c.Name, c.Type)
+		}
+	}
+	return &m, nil
+}
+
+// writeTypeManifest writes m as JSON to filename.
+func writeTypeManifest(filename string, m *typeManifest, opts outputFileOptions) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutputFile(filename, append(data, '\n'), opts)
+}
+
+// columnTypesByName are the types of the columns other than the fields
+// and the derived columns, which are strings unless they are here.
+var columnTypesByName = map[string]columnType{
+	columnPid:          {Type: columnTypeUint64},
+	columnNsPid:        {Type: columnTypeUint64},
+	columnUid:          {Type: columnTypeUint64},
+	"Inode":            {Type: columnTypeUint64},
+	"Regions":          {Type: columnTypeUint64},
+	"PresentPages":     {Type: columnTypeUint64, Unit: unitsPages},
+	"SwappedPages":     {Type: columnTypeUint64, Unit: unitsPages},
+	"ExclusivePages":   {Type: columnTypeUint64, Unit: unitsPages},
+	"CachedPages":      {Type: columnTypeUint64, Unit: unitsPages},
+	"SampledPages":     {Type: columnTypeUint64, Unit: unitsPages},
+	"ZeroPageRatio":    {Type: columnTypeFloat},
+	"Entropy":          {Type: columnTypeFloat},
+	"SourceLine":       {Type: columnTypeUint64},
+	"SchemaVersion":    {Type: columnTypeUint64},
+	"Truncated":        {Type: columnTypeBool},
+	columnSampleWeight: {Type: columnTypeFloat},
+	"ValueKB":          {Type: columnTypeInt64, Unit: unitsKB},
+}
+
+// numaColumnPattern matches the columns of -numa, which are counts of
+// pages.
+var numaColumnPattern = regexp.MustCompile(`^N[0-9]+$`)
+
+// columnTypes returns the types of the columns of the wide header of m,
+// whose fields start at fieldStart.
+func (mw *mappingWriter) columnTypes(header []string, m *mapping, fieldStart int) []columnType {
+	types := make([]columnType, len(header))
+	for i, name := range header {
+		t, ok := columnTypesByName[name]
+		switch j := i - fieldStart; {
+		case j >= 0 && j < len(m.FieldNames):
+			t = mw.fieldType(m.FieldNames[j], m.FieldUnits[j])
+		case j >= len(m.FieldNames) && j < len(m.FieldNames)+len(mw.derivedColumns):
+			t = columnType{Type: columnTypeFloat}
+		case ok:
+		case numaColumnPattern.MatchString(name):
+			t = columnType{Type: columnTypeUint64, Unit: unitsPages}
+		case strings.HasPrefix(name, "Swap_"):
+			t = columnType{Type: columnTypeInt64, Unit: unitsKB}
+		case mw.decAddresses && (name == "AddressStart" || name == "AddressEnd" || name == "Offset"):
+			t = columnType{Type: columnTypeUint64}
+		case name == "RegionSize" && mw.decAddresses:
+			t = columnType{Type: columnTypeUint64, Unit: unitsBytes}
+		default:
+			t = columnType{Type: columnTypeString}
+		}
+		t.Name = name
+		types[i] = t
+	}
+	return types
+}
+
+// fieldType returns the type of the column of the field with the name
+// and the unit.
+func (mw *mappingWriter) fieldType(name, unit string) columnType {
+	switch {
+	case unit == unitsKB && mw.unitConverter != nil && mw.unitConverter.units == unitsMiB:
+		return columnType{Type: columnTypeFloat, Unit: unitsMiB}
+	case unit == unitsKB && mw.unitConverter != nil:
+		return columnType{Type: columnTypeInt64, Unit: mw.unitConverter.units}
+	case unit == unitsKB:
+		return columnType{Type: columnTypeInt64, Unit: unitsKB}
+	case name == "VmFlags" || name == "VmFlags_other":
+		return columnType{Type: columnTypeString}
+	case strings.HasPrefix(name, "VmFlags_"):
+		return columnType{Type: columnTypeBool}
+	}
+	if f, ok := lookupKnownField(name); ok && f.kind == fieldKindInt {
+		return columnType{Type: columnTypeInt64}
+	}
+	// The values of unknown fields are kept as they are.
+	return columnType{Type: columnTypeString}
+}
+
+// columnTypes returns the types of the long header of the wide types,
+// whose ValueKB column is of the type value.
+func (s *longShaper) columnTypes(wide []columnType, value columnType) []columnType {
+	types := make([]columnType, 0, len(s.header))
+	for _, k := range s.keys {
+		types = append(types, wide[k])
+	}
+	value.Name = "ValueKB"
+	return append(types, columnType{Name: "FieldName", Type: columnTypeString}, value)
+}
+
+// selectColumnTypes returns the types of the columns of -columns at
+// indexes.
+func selectColumnTypes(types []columnType, indexes []int) []columnType {
+	selected := make([]columnType, len(indexes))
+	for i, j := range indexes {
+		selected[i] = types[j]
+	}
+	return selected
+}
+
+// checkRecordTypes checks the types of the values of record of m if
+// -types or -types-out is given.
+func (mw *mappingWriter) checkRecordTypes(m *mapping, record []string) error {
+	if mw.types == nil {
+		return nil
+	}
+	if err := mw.types.check(record); err != nil {
+		if m.LineNo > 0 {
+			return fmt.Errorf("line %d: %w", m.LineNo, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// columnTypeChecker checks that the values of records are of the types
+// of their columns.
+type columnTypeChecker struct {
+	types []columnType
+	// nullValue is the value of missing numbers besides an empty value.
+	nullValue string
+}
+
+// newColumnTypeChecker returns the checker of the types, which must be
+// those declared by want if it is not nil.
+func newColumnTypeChecker(types []columnType, want *typeManifest, nullValue string) (*columnTypeChecker, error) {
+	if want != nil {
+		if len(want.Columns) != len(types) {
+			return nil, fmt.Errorf("the output has %d columns, but the type manifest declares %d", len(types), len(want.Columns))
+		}
+		for i, c := range want.Columns {
+			if c.Name != types[i].Name {
+				return nil, fmt.Errorf("column %d is %s, but the type manifest declares %s", i+1, types[i].Name, c.Name)
+			}
+		}
+		types = want.Columns
+	}
+	return &columnTypeChecker{types: types, nullValue: nullValue}, nil
+}
+
+// check returns an error if a value of record is not of the type of its
+// column. Empty values are missing values of any type.
+func (c *columnTypeChecker) check(record []string) error {
+	for i, value := range record {
+		if i >= len(c.types) || value == "" {
+			continue
+		}
+		t := c.types[i]
+		var err error
+		switch t.Type {
+		case columnTypeUint64:
+			_, err = parseUint64Value(value)
+		case columnTypeInt64:
+			_, err = parseInt64Value(value)
+		case columnTypeFloat:
+			_, err = parseFloatValue(value)
+		case columnTypeBool:
+			_, err = strconv.ParseBool(value)
+		}
+		if err != nil && value != c.nullValue {
+			return fmt.Errorf("value %q of column %s is not %s", value, t.Name, t.Type)
+		}
+	}
+	return nil
+}
+
+// manifest returns the type manifest of the checked columns.
+func (c *columnTypeChecker) manifest() *typeManifest {
+	return &typeManifest{SchemaVersion: schemaVersion, Columns: c.types}
+}
+
+// validateTypes checks -types and -types-out, which need the header and
+// numbers without locale separators.
+func (a *args) validateTypes() error {
+	if a.typesPath == "" && a.typesOutPath == "" {
+		return nil
+	}
+	switch {
+	case a.noHeader:
+		return errors.New("-types and -types-out cannot be used with -no-header")
+	case a.decimalSep != "." || a.thousandsSep != "":
+		return errors.New("-types and -types-out require numbers with a '.' decimal separator and no thousands separator")
+	case a.typesOutPath == stdioName:
+		return errors.New("-types-out must be a file")
+	}
+	if a.typesPath != "" {
+		m, err := readTypeManifest(a.typesPath)
+		if err != nil {
+			return fmt.Errorf("read -types: %w", err)
+		}
+		a.typeManifest = m
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunTypes(t *testing.T) {
+	orig := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = orig }()
+	input := writeTestFile(t, "00400000-00452000 r-xp 00000000 08:02 173521 /usr/bin/dbus-daemon\n"+
+		"Size: 328 kB\nRss: 100 kB\nTHPeligible: 0\nVmFlags: rd ex mr mw me dw\n")
+
+	runTypes := func(t *testing.T, arguments ...string) (string, error) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var a args
+		a.registerFlags(fs)
+		if err := fs.Parse(arguments); err != nil {
+			t.Fatal(err)
+		}
+		a.inputFilename = input
+		a.outputFilename = filepath.Join(t.TempDir(), "out.csv")
+		if err := a.validate(fs); err != nil {
+			return "", err
+		}
+		return a.outputFilename, run(a)
+	}
+
+	manifestPath := filepath.Join(t.TempDir(), "types.json")
+	if _, err := runTypes(t, "-types-out", manifestPath, "-columns", "Pathname,Inode,Size,Rss,THPeligible"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := readTypeManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []columnType{
+		{Name: "Pathname", Type: columnTypeString},
+		{Name: "Inode", Type: columnTypeUint64},
+		{Name: "Size", Type: columnTypeInt64, Unit: unitsKB},
+		{Name: "Rss", Type: columnTypeInt64, Unit: unitsKB},
+		{Name: "THPeligible", Type: columnTypeInt64},
+	}
+	if m.SchemaVersion != schemaVersion || !reflect.DeepEqual(m.Columns, want) {
+		t.Errorf("manifest mismatch,\n got=%+v,\nwant=%+v", m.Columns, want)
+	}
+
+	if _, err := runTypes(t, "-types", manifestPath, "-columns", "Pathname,Inode,Size,Rss,THPeligible"); err != nil {
+		t.Errorf("conversion with the written manifest failed: %v", err)
+	}
+	if _, err := runTypes(t, "-types", manifestPath, "-columns", "Pathname,Size"); err == nil || !strings.Contains(err.Error(), "declares 5") {
+		t.Errorf("error of columns other than the manifest = %v", err)
+	}
+
+	m.Columns[0].Type = columnTypeUint64
+	if err := writeTypeManifest(manifestPath, m, outputFileOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runTypes(t, "-types", manifestPath, "-columns", "Pathname,Inode,Size,Rss,THPeligible"); err == nil ||
+		!strings.Contains(err.Error(), `value "/usr/bin/dbus-daemon" of column Pathname is not uint64`) {
+		t.Errorf("error of a malformed value = %v", err)
+	}
+}
+
+func TestColumnTypesUnits(t *testing.T) {
+	testCases := []struct {
+		units string
+		want  columnType
+	}{
+		{units: "", want: columnType{Type: columnTypeInt64, Unit: unitsKB}},
+		{units: unitsBytes, want: columnType{Type: columnTypeInt64, Unit: unitsBytes}},
+		{units: unitsMiB, want: columnType{Type: columnTypeFloat, Unit: unitsMiB}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.units, func(t *testing.T) {
+			uc, err := newUnitConverter(tc.units)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mw := &mappingWriter{unitConverter: uc}
+			if got := mw.fieldType("Rss", unitsKB); got != tc.want {
+				t.Errorf("type mismatch, got=%+v, want=%+v", got, tc.want)
+			}
+		})
+	}
+	mw := &mappingWriter{}
+	if got := mw.fieldType("VmFlags_rd", ""); got.Type != columnTypeBool {
+		t.Errorf("type of an expanded VmFlags = %s, want bool", got.Type)
+	}
+}
+
+func TestColumnTypeChecker(t *testing.T) {
+	types := []columnType{
+		{Name: "Pid", Type: columnTypeUint64},
+		{Name: "Rss", Type: columnTypeInt64},
+		{Name: "Uss", Type: columnTypeFloat},
+		{Name: "Truncated", Type: columnTypeBool},
+	}
+	c, err := newColumnTypeChecker(types, nil, "NULL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		record  []string
+		wantErr string
+	}{
+		{record: []string{"1", "-4", "1.5", "false"}},
+		{record: []string{"", "NULL", "NULL", ""}},
+		{record: []string{"-1", "4", "1.5", "true"}, wantErr: "column Pid is not uint64"},
+		{record: []string{"1", "4 kB", "1.5", "true"}, wantErr: "column Rss is not int64"},
+		{record: []string{"1", "4", "1,5", "true"}, wantErr: "column Uss is not float64"},
+		{record: []string{"1", "4", "1.5", "yes"}, wantErr: "column Truncated is not bool"},
+	}
+	for _, tc := range testCases {
+		err := c.check(tc.record)
+		if tc.wantErr == "" && err != nil || tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("check(%q) = %v, want %q", tc.record, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateTypes(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), "types.json")
+	if err := os.WriteFile(manifestPath, []byte(`{"schema_version":1,"columns":[{"name":"Rss","type":"int32"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name string
+		a    args
+	}{
+		{name: "no-header", a: args{typesOutPath: "types.json", noHeader: true, decimalSep: "."}},
+		{name: "separators", a: args{typesOutPath: "types.json", decimalSep: ","}},
+		{name: "stdout", a: args{typesOutPath: stdioName, decimalSep: "."}},
+		{name: "unsupported type", a: args{typesPath: manifestPath, decimalSep: "."}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.a.validateTypes(); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	unitsKB    = "kB"
+	unitsPages = "pages"
+	unitsBytes = "bytes"
+	unitsMiB   = "MiB"
+)
+
+// canonicalUnits returns the name of units given in any case, e.g. "kB"
+// for "kb", or units itself if it is unknown.
+func canonicalUnits(units string) string {
+	for _, u := range []string{unitsKB, unitsPages, unitsBytes, unitsMiB} {
+		if strings.EqualFold(units, u) {
+			return u
+		}
+	}
+	return units
+}
+
+// unitConverter converts the values of kB fields into another unit.
+type unitConverter struct {
+	units        string
+	pageSize     int64
+	hugePageSize int64
+}
+
+// newUnitConverter returns a converter for units, or nil if values are
+// to be written in kB as they are.
+func newUnitConverter(units string) (*unitConverter, error) {
+	switch units = canonicalUnits(units); units {
+	case "", unitsKB:
+		return nil, nil
+	case unitsBytes, unitsMiB:
+		return &unitConverter{units: units}, nil
+	case unitsPages:
+		return &unitConverter{
+			units:        units,
+			pageSize:     int64(os.Getpagesize()),
+			hugePageSize: detectHugePageSize(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported units: %q", units)
+	}
+}
+
+// detectHugePageSize returns the default huge page size in bytes read
+// from /proc/meminfo, or zero if it is not available.
+func detectHugePageSize() int64 {
+	file, err := os.Open(procSysPath("meminfo"))
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		line := s.Bytes()
+		if !bytes.HasPrefix(line, []byte("Hugepagesize:")) {
+			continue
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) != 3 || fields[2] != "kB" {
+			return 0
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0
+		}
+		return kb * 1024
+	}
+	return 0
+}
+
+// isPageSizeField reports whether the field describes a page size
+// rather than an amount of memory, so it is never converted.
+func isPageSizeField(name string) bool {
+	return name == "KernelPageSize" || name == "MMUPageSize"
+}
+
+func (c *unitConverter) convertsField(name, unit string) bool {
+	return unit == unitsKB && !isPageSizeField(name)
+}
+
+func (c *unitConverter) header(name, unit string) string {
+	if !c.convertsField(name, unit) {
+		return name
+	}
+	return name + "_" + c.units
+}
+
+// value returns the i-th field value of m in the converter's unit.
+func (c *unitConverter) value(m *mapping, i int) string {
+	name, value := m.FieldNames[i], m.FieldValues[i]
+	if !c.convertsField(name, m.FieldUnits[i]) {
+		return value
+	}
+	kb, err := parseInt64Value(value)
+	if err != nil {
+		return value
+	}
+	switch c.units {
+	case unitsBytes:
+		return strconv.FormatInt(kb*1024, 10)
+	case unitsMiB:
+		return strconv.FormatFloat(float64(kb)/1024, 'f', -1, 64)
+	}
+	pageSize := c.pageSize
+	if strings.HasSuffix(name, "_Hugetlb") {
+		pageSize = c.regionHugePageSize(m)
+	}
+	n := kb * 1024
+	if n%pageSize == 0 {
+		return strconv.FormatInt(n/pageSize, 10)
+	}
+	return strconv.FormatFloat(float64(n)/float64(pageSize), 'f', -1, 64)
+}
+
+// regionHugePageSize returns the page size used for hugetlb counters of
+// m. It is the kernel page size of the region for hugetlbfs mappings and
+// falls back to the system default huge page size.
+func (c *unitConverter) regionHugePageSize(m *mapping) int64 {
+	if kb, ok := m.numericFieldValue("KernelPageSize"); ok && int64(kb)*1024 > c.pageSize {
+		return int64(kb) * 1024
+	}
+	if c.hugePageSize > 0 {
+		return c.hugePageSize
+	}
+	return c.pageSize
+}
+
+// parseByteSize parses a size in bytes with an optional binary unit
+// suffix, e.g. "512", "64K", "10MiB" or "2GB". All units are powers of
+// 1024.
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := 0
+	for i < len(s) && (isDigit(s[i]) || s[i] == '.') {
+		i++
+	}
+	num, unit := s[:i], strings.TrimSpace(s[i:])
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	var multiplier float64
+	switch strings.ToUpper(strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "i")) {
+	case "":
+		multiplier = 1
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	case "T":
+		multiplier = 1 << 40
+	default:
+		return 0, fmt.Errorf("invalid size unit: %q", s)
+	}
+	return int64(v * multiplier), nil
+}
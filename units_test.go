@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+func TestUnitConverterPages(t *testing.T) {
+	c := &unitConverter{units: unitsPages, pageSize: 4096, hugePageSize: 2 * 1024 * 1024}
+	m := &mapping{
+		FieldNames:  []string{"Size", "KernelPageSize", "Rss", "Private_Hugetlb", "THPeligible"},
+		FieldValues: []string{"8", "4", "6", "4096", "1"},
+		FieldUnits:  []string{"kB", "kB", "kB", "kB", ""},
+	}
+	want := []string{"2", "4", "1.5", "2", "1"}
+	for i := range m.FieldNames {
+		if got := c.value(m, i); got != want[i] {
+			t.Errorf("field %s: result mismatch, got=%s, want=%s", m.FieldNames[i], got, want[i])
+		}
+	}
+	if got, want := c.header("Rss", "kB"), "Rss_pages"; got != want {
+		t.Errorf("header mismatch, got=%s, want=%s", got, want)
+	}
+
+	m.FieldValues[1] = "1048576"
+	if got, want := c.value(m, 3), "0.00390625"; got != want {
+		t.Errorf("hugetlb with 1GB pages: result mismatch, got=%s, want=%s", got, want)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want int64
+	}{
+		{in: "512", want: 512},
+		{in: "64K", want: 64 << 10},
+		{in: "10MiB", want: 10 << 20},
+		{in: "2GB", want: 2 << 30},
+		{in: "1.5M", want: 3 << 19},
+		{in: "4 kB", want: 4 << 10},
+	}
+	for _, tc := range testCases {
+		got, err := parseByteSize(tc.in)
+		if err != nil {
+			t.Fatalf("in=%s: %v", tc.in, err)
+		}
+		if got != tc.want {
+			t.Errorf("in=%s: result mismatch, got=%d, want=%d", tc.in, got, tc.want)
+		}
+	}
+	for _, in := range []string{"", "M", "10X"} {
+		if _, err := parseByteSize(in); err == nil {
+			t.Errorf("in=%q: want error, got nil", in)
+		}
+	}
+}
+
+func TestUnitConverterBytesAndMiB(t *testing.T) {
+	m := &mapping{
+		FieldNames:  []string{"Size", "KernelPageSize", "Rss", "Private_Hugetlb", "THPeligible"},
+		FieldValues: []string{"8", "4", "1536", "2048", "1"},
+		FieldUnits:  []string{"kB", "kB", "kB", "kB", ""},
+	}
+	testCases := []struct {
+		units      string
+		want       []string
+		wantHeader string
+	}{
+		{units: "bytes", want: []string{"8192", "4", "1572864", "2097152", "1"}, wantHeader: "Rss_bytes"},
+		{units: "mib", want: []string{"0.0078125", "4", "1.5", "2", "1"}, wantHeader: "Rss_MiB"},
+	}
+	for _, tc := range testCases {
+		c, err := newUnitConverter(tc.units)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range m.FieldNames {
+			if got := c.value(m, i); got != tc.want[i] {
+				t.Errorf("units=%s, field %s: result mismatch, got=%s, want=%s", tc.units, m.FieldNames[i], got, tc.want[i])
+			}
+		}
+		if got := c.header("Rss", "kB"); got != tc.wantHeader {
+			t.Errorf("units=%s: header mismatch, got=%s, want=%s", tc.units, got, tc.wantHeader)
+		}
+	}
+	if c, err := newUnitConverter("KB"); err != nil || c != nil {
+		t.Errorf("got converter %v, error %v for KB", c, err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// version is the version of this tool. It can be set at build time with
+// -ldflags "-X main.version=v1.2.3" and defaults to the module version.
+var version string
+
+// schemaVersion is the version of the output layout. It is incremented
+// when the meaning of existing columns changes.
+const schemaVersion = 1
+
+const (
+	versionMetadataNone    = "none"
+	versionMetadataComment = "comment"
+	versionMetadataColumn  = "column"
+	versionMetadataSidecar = "sidecar"
+)
+
+const toolName = "linuxprocsmapstocsv"
+
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// versionComment returns the content of the comment style record
+// written before the header.
+func versionComment() string {
+	return fmt.Sprintf("# %s schema_version=%d tool_version=%s", toolName, schemaVersion, toolVersion())
+}
+
+// captureMetadata describes the context of a capture. It is written to
+// the sidecar metadata file so that the CSV itself stays lean.
+type captureMetadata struct {
+	SchemaVersion int               `json:"schema_version"`
+	ToolVersion   string            `json:"tool_version"`
+	Hostname      string            `json:"hostname,omitempty"`
+	KernelVersion string            `json:"kernel_version,omitempty"`
+	PageSize      int               `json:"page_size"`
+	CaptureTime   string            `json:"capture_time,omitempty"`
+	CommandLine   []string          `json:"command_line"`
+	Processes     []processMetadata `json:"processes,omitempty"`
+}
+
+type processMetadata struct {
+	Pid     int      `json:"pid"`
+	Comm    string   `json:"comm,omitempty"`
+	Cmdline []string `json:"cmdline,omitempty"`
+}
+
+// newCaptureMetadata returns the metadata of a capture at captureTime of
+// the processes pids. The capture time is omitted if it is zero.
+// Information which cannot be read, e.g. for processes which have exited,
+// is omitted.
+func newCaptureMetadata(captureTime time.Time, pids []int) *captureMetadata {
+	md := &captureMetadata{
+		SchemaVersion: schemaVersion,
+		ToolVersion:   toolVersion(),
+		PageSize:      os.Getpagesize(),
+		CommandLine:   redactCommandLine(os.Args),
+	}
+	if !captureTime.IsZero() {
+		md.CaptureTime = captureTime.UTC().Format(time.RFC3339)
+	}
+	md.Hostname, _ = os.Hostname()
+	if release, err := os.ReadFile(procSysPath("sys/kernel/osrelease")); err == nil {
+		md.KernelVersion = strings.TrimSpace(string(release))
+	}
+	for _, pid := range pids {
+		p := processMetadata{Pid: pid}
+		p.Comm, _ = readComm(pid)
+		p.Cmdline, _ = readCmdline(pid)
+		md.Processes = append(md.Processes, p)
+	}
+	return md
+}
+
+// secretFlags are the flags whose values are redacted from the command
+// line in the metadata, as they would let its readers reverse the
+// pseudonyms of -pseudonymize or access the server.
+var secretFlags = map[string]bool{
+	"salt":            true,
+	"auth-token-file": true,
+	"tls-key":         true,
+}
+
+// redactCommandLine returns a copy of the command line with the values of
+// secretFlags replaced with "REDACTED".
+func redactCommandLine(cmdline []string) []string {
+	redacted := make([]string, len(cmdline))
+	copy(redacted, cmdline)
+	for i := 1; i < len(redacted); i++ {
+		arg := redacted[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !secretFlags[name] {
+			continue
+		}
+		if hasValue {
+			redacted[i] = arg[:strings.Index(arg, "=")+1] + "REDACTED"
+		} else if i+1 < len(redacted) {
+			i++
+			redacted[i] = "REDACTED"
+		}
+	}
+	return redacted
+}
+
+// anonymize pseudonymizes the processes with p, or drops their command
+// names and command lines if p is nil, for -pseudonymize and
+// -redact-paths, whose outputs must not be identified by the metadata.
+func (md *captureMetadata) anonymize(p *pseudonymizer) {
+	for i := range md.Processes {
+		proc := &md.Processes[i]
+		if p == nil {
+			proc.Comm, proc.Cmdline = "", nil
+			continue
+		}
+		proc.Pid = p.pid(proc.Pid)
+		if proc.Comm != "" {
+			proc.Comm = p.hash(proc.Comm)
+		}
+		if len(proc.Cmdline) > 0 {
+			proc.Cmdline = []string{p.hash(strings.Join(proc.Cmdline, " "))}
+		}
+	}
+}
+
+// metadataFilename returns the name of the sidecar metadata file for the
+// output file.
+func metadataFilename(outputFilename string) string {
+	return outputFilename + ".meta.json"
+}
+
+func writeMetadataFile(filename string, md *captureMetadata, opts outputFileOptions) error {
+	data, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutputFile(filename, append(data, '\n'), opts)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConvertVersionMetadata(t *testing.T) {
+	input := `55d000-55e000 r--p 00000000 fe:00 1234                       /usr/bin/cat
+Rss:                   4 kB
+`
+	version = "v1.2.3"
+	defer func() { version = "" }()
+
+	testCases := []struct {
+		location string
+		want     string
+	}{
+		{
+			location: versionMetadataComment,
+			want: "# linuxprocsmapstocsv schema_version=1 tool_version=v1.2.3\n" +
+				"AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Rss\n" +
+				"55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4\n",
+		},
+		{
+			location: versionMetadataColumn,
+			want: "AddressStart,AddressEnd,Perms,Offset,Dev,Inode,Pathname,Rss,SchemaVersion,ToolVersion\n" +
+				"55d000,55e000,r--p,00000000,fe:00,1234,/usr/bin/cat,4,1,v1.2.3\n",
+		},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := convertSmapsToCsv(w, strings.NewReader(input), args{versionMeta: tc.location}); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("location=%s: result mismatch,\n got=%s,\nwant=%s", tc.location, got, tc.want)
+		}
+	}
+}
+
+func TestRedactCommandLine(t *testing.T) {
+	got := redactCommandLine([]string{"linuxprocsmapstocsv", "-pseudonymize", "-salt", "0011", "--salt=2233", "-tls-key=key.pem", "-auth-token-file", "tokens", "-i", "smaps"})
+	want := []string{"linuxprocsmapstocsv", "-pseudonymize", "-salt", "REDACTED", "--salt=REDACTED", "-tls-key=REDACTED", "-auth-token-file", "REDACTED", "-i", "smaps"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch,\n got=%q,\nwant=%q", got, want)
+	}
+}
+
+func TestCaptureMetadataAnonymize(t *testing.T) {
+	p, err := newPseudonymizer("00112233")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := &captureMetadata{Processes: []processMetadata{{Pid: 1234, Comm: "nginx", Cmdline: []string{"nginx", "-g", "daemon off;"}}}}
+	md.anonymize(p)
+	want := processMetadata{Pid: p.pid(1234), Comm: p.hash("nginx"), Cmdline: []string{p.hash("nginx -g daemon off;")}}
+	if !reflect.DeepEqual(md.Processes[0], want) {
+		t.Errorf("pseudonymized mismatch, got=%+v, want=%+v", md.Processes[0], want)
+	}
+
+	md = &captureMetadata{Processes: []processMetadata{{Pid: 1234, Comm: "nginx", Cmdline: []string{"nginx"}}}}
+	md.anonymize(nil)
+	if want := (processMetadata{Pid: 1234}); !reflect.DeepEqual(md.Processes[0], want) {
+		t.Errorf("redacted mismatch, got=%+v, want=%+v", md.Processes[0], want)
+	}
+}
+
+func TestNewCaptureMetadata(t *testing.T) {
+	if _, err := os.Stat("/proc/self/comm"); err != nil {
+		t.Skip("procfs is not available")
+	}
+	captureTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("JST", 9*60*60))
+	md := newCaptureMetadata(captureTime, []int{os.Getpid()})
+	if got, want := md.CaptureTime, "2024-01-01T18:04:05Z"; got != want {
+		t.Errorf("capture time mismatch, got=%s, want=%s", got, want)
+	}
+	if len(md.Processes) != 1 || md.Processes[0].Comm == "" || len(md.Processes[0].Cmdline) == 0 {
+		t.Errorf("process metadata must have comm and cmdline, got=%+v", md.Processes)
+	}
+}
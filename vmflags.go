@@ -0,0 +1,56 @@
+package main
+
+import "strings"
+
+// vmFlagNames are the two-letter flags of VmFlags in smaps in the order
+// of the kernel, see show_smap_vma_flags in fs/proc/task_mmu.c.
+var vmFlagNames = []string{
+	"rd", "wr", "ex", "sh", "mr", "mw", "me", "ms", "gd", "pf", "dw", "lo",
+	"io", "sr", "rr", "dc", "de", "ac", "nr", "ht", "sf", "nl", "ar", "wf",
+	"dd", "sd", "mm", "hg", "nh", "mg", "um", "uw", "ss", "sl", "bt", "mt",
+}
+
+// expandVmFlags replaces the VmFlags field of m with a field of 0 or 1
+// for each flag in vmFlagNames, named like VmFlags_rd, followed by
+// VmFlags_other with the flags unknown to this tool. Mappings without
+// VmFlags are left as they are.
+func (m *mapping) expandVmFlags() {
+	i := m.fieldIndex("VmFlags")
+	if i == -1 {
+		return
+	}
+	set := make(map[string]bool)
+	var other []string
+	for _, flag := range strings.Fields(m.FieldValues[i]) {
+		set[flag] = true
+		if !isKnownVmFlag(flag) {
+			other = append(other, flag)
+		}
+	}
+
+	names := append([]string(nil), m.FieldNames[:i]...)
+	values := append([]string(nil), m.FieldValues[:i]...)
+	units := append([]string(nil), m.FieldUnits[:i]...)
+	for _, flag := range vmFlagNames {
+		value := "0"
+		if set[flag] {
+			value = "1"
+		}
+		names = append(names, "VmFlags_"+flag)
+		values = append(values, value)
+		units = append(units, "")
+	}
+	names = append(append(names, "VmFlags_other"), m.FieldNames[i+1:]...)
+	values = append(append(values, strings.Join(other, " ")), m.FieldValues[i+1:]...)
+	units = append(append(units, ""), m.FieldUnits[i+1:]...)
+	m.FieldNames, m.FieldValues, m.FieldUnits = names, values, units
+}
+
+func isKnownVmFlag(flag string) bool {
+	for _, name := range vmFlagNames {
+		if name == flag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestConvertExpandVmFlags(t *testing.T) {
+	input := "55e000-580000 rw-p 00000000 00:00 0                          [heap]\nRss: 12 kB\nVmFlags: rd wr mr mw me ac hg zz\nTHPeligible: 1\n"
+	var buf bytes.Buffer
+	if err := convertSmapsToCsv(csv.NewWriter(&buf), strings.NewReader(input),
+		args{Separator: ",", expandVmFlags: true}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for i, name := range records[0] {
+		got[name] = records[1][i]
+	}
+	want := map[string]string{
+		"Rss": "12", "VmFlags_rd": "1", "VmFlags_wr": "1", "VmFlags_ex": "0", "VmFlags_hg": "1",
+		"VmFlags_nh": "0", "VmFlags_other": "zz", "THPeligible": "1",
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("column %s mismatch, got=%q, want=%q", name, got[name], value)
+		}
+	}
+	if _, ok := got["VmFlags"]; ok {
+		t.Error("VmFlags column is not replaced")
+	}
+	if n := len(records[0]); n != 7+1+len(vmFlagNames)+1+1 {
+		t.Errorf("column count mismatch, got=%d", n)
+	}
+}
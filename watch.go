@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// validateWatch checks the options of watch mode given by -interval and
+// -count, and enables the Timestamp column distinguishing the samples.
+// The output is written directly, as the rows of each sample should be
+// visible while watching.
+func (a *args) validateWatch() error {
+	switch {
+	case a.interval < 0:
+		return errors.New("-interval must not be negative")
+	case a.count < 0:
+		return errors.New("-count must not be negative")
+	case a.count > 0 && a.interval == 0:
+		return errors.New("-count requires -interval")
+	case a.scanBudget < 0:
+		return errors.New("-scan-budget must not be negative")
+	case a.scanBudget > 0 && a.interval == 0:
+		return errors.New("-scan-budget requires -interval")
+	case a.scanBudget > 0 && a.spread > 0:
+		return errors.New("-scan-budget cannot be used with -spread, which lengthens the samples on purpose")
+	case a.interval == 0:
+		return nil
+	case !a.batch && a.inputFilename == stdioName:
+		return errors.New("-interval requires -p or an input file, which is read again at each sample")
+	case a.groupBy != "", a.subtotals != "", a.unionFields:
+		return errors.New("-group-by, -subtotals and -union-fields cannot be used with -interval")
+	case a.reproducible, a.keepRawDir != "", a.teeRawPath != "", a.dropUser != "":
+		return errors.New("-reproducible, -keep-raw, -tee-raw and -drop-privileges cannot be used with -interval")
+	case a.baselinePath != "", len(a.failConditions) > 0, a.shmReportPath != "", a.compSwapPath != "", a.lazyFreePath != "", a.numaReportPath != "", a.totals, a.totalsPath != "":
+		return errors.New("-baseline, -fail-if, -shm-report, -compressed-swap-report, -lazyfree-report, -numa-report, -totals and -totals-out cannot be used with -interval")
+	case a.format == outputFormatTemplate:
+		return errors.New("-format template cannot be used with -interval, as the template is executed with all rows")
+	case a.spread > a.interval:
+		return fmt.Errorf("-spread %v must not exceed -interval %v", a.spread, a.interval)
+	}
+	a.timestampColumn = true
+	a.outputFileOptions.atomic = false
+	return nil
+}
+
+// sampleTime returns the time to take the i-th sample, counted from zero,
+// of watch mode started at start. Samples are taken at fixed times, so a
+// slow sample does not delay the following ones.
+func sampleTime(start time.Time, interval time.Duration, i int) time.Time {
+	return start.Add(time.Duration(i) * interval)
+}
+
+// degradedInterval returns the interval of watch mode after a sample which
+// took d with -scan-budget. A sample longer than the budget lengthens the
+// interval in proportion, so that the share of the time spent reading the
+// inputs stays that of the budget, and a sample within the budget restores
+// the interval.
+func degradedInterval(interval, budget, d time.Duration) time.Duration {
+	if budget == 0 || d <= budget {
+		return interval
+	}
+	return time.Duration(float64(interval) * float64(d) / float64(budget))
+}
+
+// reopenInputs opens the inputs again for a sample of watch mode. In batch
+// mode, inputs which cannot be read, e.g. of processes which have exited,
+// are skipped with warnings.
+func reopenInputs(args args, filenames []string) ([]*inputSource, error) {
+	var sources []*inputSource
+	for _, filename := range filenames {
+		src, err := openInput(args, filename)
+		if err != nil {
+			if !args.batch {
+				return nil, err
+			}
+			args.anomalies.report(0, fmt.Sprintf("skipped input: %v", err), "")
+			continue
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidateWatch(t *testing.T) {
+	testCases := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{name: "disabled", args: args{inputFilename: stdioName}},
+		{name: "file", args: args{inputFilename: "/proc/1/smaps", interval: time.Second, count: 3}},
+		{name: "pids", args: args{batch: true, interval: time.Second}},
+		{name: "count without interval", args: args{inputFilename: "/proc/1/smaps", count: 3}, wantErr: true},
+		{name: "negative interval", args: args{inputFilename: "/proc/1/smaps", interval: -time.Second}, wantErr: true},
+		{name: "stdin", args: args{inputFilename: stdioName, interval: time.Second}, wantErr: true},
+		{name: "group-by", args: args{inputFilename: "/proc/1/smaps", interval: time.Second, groupBy: groupByPathname}, wantErr: true},
+		{name: "spread", args: args{batch: true, interval: time.Second, spread: 2 * time.Second}, wantErr: true},
+		{name: "scan-budget", args: args{batch: true, interval: time.Second, scanBudget: 100 * time.Millisecond}},
+		{name: "scan-budget without interval", args: args{batch: true, scanBudget: time.Second}, wantErr: true},
+		{name: "scan-budget with spread", args: args{batch: true, interval: time.Second, spread: time.Second, scanBudget: time.Second}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := tc.args
+			a.outputFileOptions.atomic = true
+			err := a.validateWatch()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("error mismatch, got=%v, wantErr=%v", err, tc.wantErr)
+			}
+			if err == nil && a.interval > 0 && (!a.timestampColumn || a.outputFileOptions.atomic) {
+				t.Error("watch mode must add the Timestamp column and write the output directly")
+			}
+		})
+	}
+}
+
+func TestSampleTime(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if got, want := sampleTime(start, 5*time.Second, 3), start.Add(15*time.Second); !got.Equal(want) {
+		t.Errorf("result mismatch, got=%v, want=%v", got, want)
+	}
+}
+
+func TestDegradedInterval(t *testing.T) {
+	for _, tc := range []struct {
+		budget, d, want time.Duration
+	}{
+		{budget: 0, d: time.Minute, want: 10 * time.Second},
+		{budget: time.Second, d: 500 * time.Millisecond, want: 10 * time.Second},
+		{budget: time.Second, d: time.Second, want: 10 * time.Second},
+		{budget: time.Second, d: 3 * time.Second, want: 30 * time.Second},
+	} {
+		if got := degradedInterval(10*time.Second, tc.budget, tc.d); got != tc.want {
+			t.Errorf("budget %v, d %v: got %v, want %v", tc.budget, tc.d, got, tc.want)
+		}
+	}
+}
+
+func TestRunWatch(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var a args
+	a.registerFlags(fs)
+	if err := fs.Parse([]string{"-fields-file", writeTestFile(t, "Rss\n"), "-time-format", timeFormatUnixMilli}); err != nil {
+		t.Fatal(err)
+	}
+	a.inputFilename = writeTestFile(t, testSmapsSorted)
+	a.outputFilename = filepath.Join(t.TempDir(), "out.csv")
+	a.interval, a.count = 2*time.Millisecond, 3
+	if err := a.validateWatch(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.validate(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(a); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(a.outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(records), 1+3*2; got != want {
+		t.Fatalf("record count mismatch, got=%d, want=%d", got, want)
+	}
+	if records[0][0] != "Timestamp" {
+		t.Errorf("header mismatch, got=%v", records[0])
+	}
+	for i := 1; i+2 < len(records); i += 2 {
+		if records[i][0] != records[i+1][0] {
+			t.Errorf("rows of a sample must have the same timestamp, got=%q and %q", records[i][0], records[i+1][0])
+		}
+		if records[i][0] >= records[i+2][0] {
+			t.Errorf("timestamps of samples must increase, got=%q and %q", records[i][0], records[i+2][0])
+		}
+	}
+}
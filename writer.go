@@ -0,0 +1,878 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// outputWriter is a recordWriter which owns its output files.
+type outputWriter interface {
+	recordWriter
+	// Close flushes buffered records and closes and commits the files.
+	Close() error
+	// Abort closes the files and removes them if they are atomic. It
+	// does nothing after Close.
+	Abort()
+	// Files returns the names of the written files.
+	Files() []string
+}
+
+// csvFileWriter writes CSV records to a file.
+type csvFileWriter struct {
+	recordWriter
+	file *outputFile
+	// zw compresses the records if -compress is gzip or zstd.
+	zw io.WriteCloser
+}
+
+func (w *csvFileWriter) Close() error {
+	w.Flush()
+	err := w.Error()
+	if err == nil && w.zw != nil {
+		err = w.zw.Close()
+	}
+	if err != nil {
+		w.file.abort()
+		return err
+	}
+	return w.file.commit()
+}
+
+func (w *csvFileWriter) Abort() {
+	w.file.abort()
+}
+
+func (w *csvFileWriter) Files() []string {
+	return []string{w.file.name}
+}
+
+// Formats of the output given by -format.
+const (
+	outputFormatCSV      = "csv"
+	outputFormatJSON     = "json"
+	outputFormatNDJSON   = "ndjson"
+	outputFormatSQLite   = "sqlite"
+	outputFormatParquet  = "parquet"
+	outputFormatArrow    = "arrow"
+	outputFormatTemplate = "template"
+	outputFormatXLSX     = "xlsx"
+)
+
+// Layouts of JSON objects given by -json-layout.
+const (
+	jsonLayoutFields = "fields"
+	jsonLayoutTyped  = "typed"
+)
+
+// tableFileBuilders are the builders of the output formats written by
+// tableFileWriter.
+var tableFileBuilders = map[string]func(columns []string, rows [][]string) ([]byte, error){
+	outputFormatSQLite: func(columns []string, rows [][]string) ([]byte, error) {
+		return buildSQLiteDatabase(sqliteTable, columns, rows)
+	},
+	outputFormatParquet: buildParquetFile,
+	outputFormatXLSX:    buildXLSXWorkbook,
+}
+
+// errTableFileStdout returns the error of the format written by
+// tableFileWriter without an output file, as the file is rewritten in
+// place.
+func errTableFileStdout(format string) error {
+	return fmt.Errorf("-format %s requires an output file given by -o", format)
+}
+
+// tableFileWriter writes records to a file in a format which is built
+// from all records at once, such as a SQLite database, with the columns
+// of the header. The records are kept in memory and the whole file is
+// written again at each flush, so a file written in watch mode has all
+// samples so far.
+type tableFileWriter struct {
+	file    *outputFile
+	headers headerRecords
+	build   func(columns []string, rows [][]string) ([]byte, error)
+	// compact compacts the rows before they are written for
+	// -compact-after and -retain, if it is not nil.
+	compact func(columns []string, rows [][]string) ([][]string, bool, error)
+	rows    [][]string
+	// written is the number of rows in the file.
+	written int
+	err     error
+}
+
+func newTableFileWriter(file *outputFile, headerLines int, build func(columns []string, rows [][]string) ([]byte, error)) *tableFileWriter {
+	return &tableFileWriter{file: file, headers: headerRecords{headerLines: headerLines}, build: build, written: -1}
+}
+
+func (w *tableFileWriter) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.headers.take(record) {
+		return nil
+	}
+	w.rows = append(w.rows, append([]string(nil), record...))
+	return nil
+}
+
+// Flush writes the file if rows were added or compacted since the last
+// flush.
+func (w *tableFileWriter) Flush() {
+	if w.err != nil {
+		return
+	}
+	if w.compact != nil {
+		rows, changed, err := w.compact(w.headers.header, w.rows)
+		if err != nil {
+			w.err = err
+			return
+		}
+		if changed {
+			w.rows, w.written = rows, -1
+		}
+	}
+	if w.written == len(w.rows) {
+		return
+	}
+	data, err := w.build(w.headers.header, w.rows)
+	if err != nil {
+		w.err = err
+		return
+	}
+	if _, err := w.file.WriteAt(data, 0); err != nil {
+		w.err = err
+		return
+	}
+	if err := w.file.Truncate(int64(len(data))); err != nil {
+		w.err = err
+		return
+	}
+	w.written = len(w.rows)
+}
+
+func (w *tableFileWriter) Error() error {
+	return w.err
+}
+
+func (w *tableFileWriter) Close() error {
+	w.Flush()
+	if w.err != nil {
+		w.file.abort()
+		return w.err
+	}
+	return w.file.commit()
+}
+
+func (w *tableFileWriter) Abort() {
+	w.file.abort()
+}
+
+func (w *tableFileWriter) Files() []string {
+	return []string{w.file.name}
+}
+
+// createOutput creates the output file, or the writer of numbered files
+// if the output is split.
+func createOutput(args args, filename string) (outputWriter, error) {
+	sep, _ := utf8.DecodeRuneInString(args.Separator)
+	headerLines := 1
+	if args.versionMeta == versionMetadataComment {
+		headerLines++
+	}
+	if args.format == outputFormatJSON || args.format == outputFormatNDJSON {
+		file, err := createOutputFile(filename, args.outputFileOptions)
+		if err != nil {
+			return nil, err
+		}
+		w := newNDJSONWriter(nil, file, headerLines)
+		w.nested = true
+		w.typed = args.jsonLayout == jsonLayoutTyped
+		w.emptyFields = args.nullAs == nullAsEmpty
+		w.array = args.format == outputFormatJSON
+		return w, nil
+	}
+	if args.format == outputFormatTemplate {
+		file, err := createOutputFile(filename, args.outputFileOptions)
+		if err != nil {
+			return nil, err
+		}
+		return newTemplateWriter(file, headerLines, args.template), nil
+	}
+	if args.format == outputFormatFolded {
+		file, err := createOutputFile(filename, args.outputFileOptions)
+		if err != nil {
+			return nil, err
+		}
+		return newFoldedWriter(file, headerLines), nil
+	}
+	if args.format == outputFormatArrow {
+		file, err := createOutputFile(filename, args.outputFileOptions)
+		if err != nil {
+			return nil, err
+		}
+		return newArrowWriter(file, headerLines, args.arrowOptions), nil
+	}
+	if build := tableFileBuilders[args.format]; build != nil {
+		if args.format == outputFormatParquet {
+			build = args.parquetOptions.build
+		}
+		if filename == stdioName {
+			return nil, errTableFileStdout(args.format)
+		}
+		file, err := createOutputFile(filename, args.outputFileOptions)
+		if err != nil {
+			return nil, err
+		}
+		w := newTableFileWriter(file, headerLines, build)
+		if r := newWatchRetention(args); r != nil {
+			w.compact = r.compact
+		}
+		return w, nil
+	}
+	if args.noHeader {
+		headerLines = 0
+	}
+	if args.appendOutput {
+		return newAppendWriter(filename, args.csvDialect(), args.noHeader, args.outputFileOptions)
+	}
+	if args.splitsOutput() {
+		w := newSplitWriter(filename, sep, headerLines, args.maxRows, args.maxSize)
+		w.enc = args.csvDialect().newWriter(&w.scratch)
+		w.fileOptions = args.outputFileOptions
+		return w, nil
+	}
+
+	file, err := createOutputFile(filename, args.outputFileOptions)
+	if err != nil {
+		return nil, err
+	}
+	if r := newWatchRetention(args); r != nil {
+		// The rows are kept to be rewritten compacted.
+		w := newTableFileWriter(file, headerLines, buildCSVFile(args.csvDialect()))
+		w.compact = r.compact
+		return w, nil
+	}
+	if args.compress == compressGzip || args.compress == compressZstd {
+		zw, err := newCompressWriter(args.compress, file)
+		if err != nil {
+			file.abort()
+			return nil, err
+		}
+		return &csvFileWriter{recordWriter: args.csvDialect().newWriter(zw), file: file, zw: zw}, nil
+	}
+	return &csvFileWriter{recordWriter: args.csvDialect().newWriter(file), file: file}, nil
+}
+
+// fieldColumnsSetter is implemented by record writers which treat the
+// columns of kB fields specially.
+type fieldColumnsSetter interface {
+	// setFieldColumns is called with the names of the columns of kB
+	// fields before the header is written.
+	setFieldColumns(names []string)
+}
+
+// mappingWriter writes mappings as CSV records. The header is written
+// before the first mapping and every following mapping must have the same
+// field names as the first one, unless the mappings are buffered until
+// flush to write the union of their fields.
+type mappingWriter struct {
+	w               recordWriter
+	derivedColumns  []derivedColumn
+	unitConverter   *unitConverter
+	numberFormat    *numberFormat
+	floatFormat     floatFormat
+	nullValue       string
+	versionMetadata string
+	hostPaths       bool
+	resolvedPaths   bool
+	mountColumns    bool
+	stackThreads    bool
+	categoryColumn  bool
+	anonNameColumn  bool
+	backingColumns  bool
+	regionSize      bool
+	regionKey       bool
+	// noHeader omits the header and the version comment of
+	// -no-header.
+	noHeader bool
+	// sourceFile and sourceLine add the input filename and the line
+	// number of the region line of -source-columns.
+	sourceFile bool
+	sourceLine bool
+	// decAddresses is true if addresses, offsets and region sizes are
+	// written in decimal instead of hex.
+	decAddresses bool
+	numaNodes    []int
+	// swapDevices are the swap devices in the order of their types.
+	swapDevices     []string
+	pagemap         bool
+	pageContent     bool
+	mincore         bool
+	processColumns  []string
+	truncatedColumn bool
+	// sampleWeight is the value of the SampleWeight column of -sample,
+	// or empty without the column.
+	sampleWeight string
+	// groups aggregates the mappings, which are written by flush, if
+	// they are grouped.
+	groups *mappingGroups
+	// long converts the records to the long shape of -shape long, which
+	// is given by longShape, after the header is written.
+	longShape bool
+	long      *longShaper
+	// types checks the types of the values of the records if checkTypes
+	// is true, which are those of typeManifest if it is not nil.
+	checkTypes   bool
+	typeManifest *typeManifest
+	types        *columnTypeChecker
+	// groupCost is the cost by which the groups are sorted in
+	// descending order, or nil to write them in order of appearance.
+	groupCost expr
+	// groupSort is the key of -sort-by by which the groups are sorted,
+	// or nil.
+	groupSort *sortKey
+	// subtotals aggregates the written mappings, which are appended as
+	// subtotal rows by flush.
+	subtotals *mappingGroups
+	// totals aggregates all mappings for the total row, which is
+	// appended by flush if totalRow is true.
+	totals   *mappingGroups
+	totalRow bool
+	// failIf aggregates all mappings for -fail-if.
+	failIf *failChecker
+	// alerts aggregates the mappings of each sample for -alert-rules.
+	alerts *alertEngine
+	// union collects the fields of the mappings in pending, which are
+	// written by flush, if regions may have different fields.
+	union   *fieldUnion
+	pending mappingSpill
+	// timestamp is the value of the Timestamp column, which is written
+	// if timestampColumn is true.
+	timestampColumn     bool
+	timestamp           string
+	firstLineFieldNames []string
+	firstLineFieldUnits []string
+	wroteHeader         bool
+	// columns are the names of the columns to write given by -columns,
+	// whose indexes in the full header are columnIndexes.
+	columns       []string
+	columnIndexes []int
+	// columnRules are the rules of -column-rule, which are applied by
+	// columnTransform after the columns are selected.
+	columnRules     []columnRule
+	columnTransform *columnTransform
+	// kernelThreads are the rows of kernel threads waiting for the field
+	// names of the header, which come from the first process with
+	// mappings.
+	kernelThreads []*mapping
+	// rows is the number of written mappings.
+	rows int
+	// recordSize is the number of the values of the last record, with
+	// which the next record is allocated, and values is reused for the
+	// values inserted into records.
+	recordSize int
+	values     []string
+}
+
+func (mw *mappingWriter) write(m *mapping) error {
+	if mw.totals != nil && !m.KernelThread {
+		mw.totals.add(m)
+	}
+	if mw.failIf != nil && !m.KernelThread {
+		mw.failIf.add(m)
+	}
+	if !m.KernelThread {
+		mw.alerts.add(m)
+	}
+	if mw.groups != nil {
+		mw.groups.add(m)
+		return nil
+	}
+	if mw.union != nil {
+		mw.union.add(m)
+		return mw.pending.add(m)
+	}
+	return mw.writeMapping(m)
+}
+
+// writeKernelThread writes a row of the process p without mappings, e.g. a
+// kernel thread, which has empty region columns and zero kB fields.
+func (mw *mappingWriter) writeKernelThread(p *processInfo) error {
+	if mw.groups != nil {
+		return nil
+	}
+	return mw.write(&mapping{Region: &region{}, Process: p, KernelThread: true})
+}
+
+func (mw *mappingWriter) writeMapping(m *mapping) error {
+	if m.KernelThread {
+		if !mw.wroteHeader {
+			mw.kernelThreads = append(mw.kernelThreads, m)
+			return nil
+		}
+		m.FieldNames, m.FieldUnits = mw.firstLineFieldNames, mw.firstLineFieldUnits
+		m.FieldValues = make([]string, len(m.FieldNames))
+		for i, unit := range m.FieldUnits {
+			if unit == unitsKB {
+				m.FieldValues[i] = "0"
+			}
+		}
+	}
+	if !mw.wroteHeader {
+		if mw.versionMetadata == versionMetadataComment && !mw.noHeader {
+			if err := mw.w.Write([]string{versionComment()}); err != nil {
+				return err
+			}
+		}
+		header := mw.header(m)
+		fieldColumns := mw.fieldColumns(m, header)
+		var types []columnType
+		if mw.checkTypes {
+			types = mw.columnTypes(header, m, mw.fieldStart(m, header))
+		}
+		if mw.longShape {
+			prefix := len(mw.processColumns)
+			if mw.timestampColumn {
+				prefix++
+			}
+			mw.long = newLongShaper(header, m, prefix, mw.fieldStart(m, header))
+			header, fieldColumns = mw.long.header, []string{"ValueKB"}
+			if types != nil {
+				types = mw.long.columnTypes(types, mw.fieldType("", unitsKB))
+			}
+		}
+		if mw.columns != nil {
+			indexes, err := columnIndexes(header, mw.columns)
+			if err != nil {
+				return err
+			}
+			mw.columnIndexes = indexes
+			header = selectColumns(header, indexes)
+			if types != nil {
+				types = selectColumnTypes(types, indexes)
+			}
+		}
+		if mw.columnRules != nil {
+			t, err := newColumnTransform(header, mw.columnRules)
+			if err != nil {
+				return err
+			}
+			mw.columnTransform = t
+			header = t.header(header)
+			if types != nil {
+				types = t.columnTypes(types)
+			}
+		}
+		if mw.checkTypes {
+			checker, err := newColumnTypeChecker(types, mw.typeManifest, mw.nullValue)
+			if err != nil {
+				return fmt.Errorf("-types: %w", err)
+			}
+			mw.types = checker
+		}
+		if s, ok := mw.w.(fieldColumnsSetter); ok {
+			s.setFieldColumns(fieldColumns)
+		}
+		if !mw.noHeader {
+			if err := mw.w.Write(header); err != nil {
+				return err
+			}
+		}
+		mw.firstLineFieldNames, mw.firstLineFieldUnits = m.FieldNames, m.FieldUnits
+		mw.wroteHeader = true
+		kernelThreads := mw.kernelThreads
+		mw.kernelThreads = nil
+		for _, kt := range kernelThreads {
+			if err := mw.writeMapping(kt); err != nil {
+				return err
+			}
+		}
+	} else if err := m.checkFieldNames(mw.firstLineFieldNames, m.LineNo); err != nil {
+		return err
+	}
+	record := mw.record(m)
+	if mw.columnIndexes != nil {
+		record = selectColumns(record, mw.columnIndexes)
+	}
+	if mw.long != nil {
+		for _, r := range mw.long.records(record) {
+			if mw.columnTransform != nil {
+				r = mw.columnTransform.apply(r)
+			}
+			if err := mw.checkRecordTypes(m, r); err != nil {
+				return err
+			}
+			if err := mw.w.Write(r); err != nil {
+				return err
+			}
+			mw.rows++
+		}
+	} else {
+		if mw.columnTransform != nil {
+			record = mw.columnTransform.apply(record)
+		}
+		if err := mw.checkRecordTypes(m, record); err != nil {
+			return err
+		}
+		if err := mw.w.Write(record); err != nil {
+			return err
+		}
+		mw.rows++
+	}
+	if mw.subtotals != nil && !m.KernelThread {
+		mw.subtotals.add(m)
+	}
+	return nil
+}
+
+// flush flushes the written records and adds the number of rows to
+// stats if it is not nil.
+func (mw *mappingWriter) flush(stats *runStats) error {
+	if mw.groups != nil && mw.groupCost == nil && mw.groupSort == nil {
+		if err := mw.groups.each(mw.writeMapping); err != nil {
+			return err
+		}
+	} else if mw.groups != nil {
+		ms := mw.groups.mappings()
+		if mw.groupCost != nil {
+			sortMappingsByCost(ms, mw.groupCost)
+		}
+		if mw.groupSort != nil {
+			if err := sortMappingsByKey(ms, mw.groupSort); err != nil {
+				return err
+			}
+		}
+		for _, m := range ms {
+			if err := mw.writeMapping(m); err != nil {
+				return err
+			}
+		}
+	}
+	if mw.union != nil {
+		if err := mw.pending.each(func(m *mapping) error {
+			mw.union.align(m)
+			return mw.writeMapping(m)
+		}); err != nil {
+			return err
+		}
+	}
+	if mw.subtotals != nil {
+		subtotals := mw.subtotals
+		mw.subtotals = nil
+		if err := subtotals.eachSubtotal(mw.firstLineFieldNames, mw.firstLineFieldUnits, mw.writeMapping); err != nil {
+			return err
+		}
+	}
+	if mw.totalRow {
+		if m := mw.totalMapping(); m != nil {
+			if err := mw.writeMapping(m); err != nil {
+				return err
+			}
+		}
+	}
+	// The groups are kept until the total row is written in the same
+	// layout.
+	mw.groups = nil
+	if len(mw.kernelThreads) > 0 {
+		// No process has mappings, so the header has no fields.
+		m := mw.kernelThreads[0]
+		mw.kernelThreads = mw.kernelThreads[1:]
+		m.KernelThread = false
+		if err := mw.writeMapping(m); err != nil {
+			return err
+		}
+	}
+	mw.w.Flush()
+	if err := mw.w.Error(); err != nil {
+		return err
+	}
+	if stats != nil {
+		stats.rows += mw.rows
+	}
+	return nil
+}
+
+// totalMapping returns the total row of all mappings with the fields of
+// the header, or nil if no mappings are written.
+func (mw *mappingWriter) totalMapping() *mapping {
+	if mw.totals == nil || !mw.wroteHeader {
+		return nil
+	}
+	return mw.totals.totalMapping(mw.firstLineFieldNames, mw.firstLineFieldUnits)
+}
+
+func (mw *mappingWriter) header(m *mapping) []string {
+	var header []string
+	if mw.groups != nil {
+		header = append([]string{"Group", "Regions"}, m.FieldNames...)
+	} else {
+		header = m.toCSVHeader()
+	}
+	var regionColumns []string
+	if mw.hostPaths {
+		regionColumns = append(regionColumns, "HostPath")
+	}
+	if mw.resolvedPaths {
+		regionColumns = append(regionColumns, "ResolvedPath")
+	}
+	if mw.mountColumns {
+		regionColumns = append(regionColumns, "MountPoint", "FsType")
+	}
+	if mw.stackThreads {
+		regionColumns = append(regionColumns, "StackThread")
+	}
+	if mw.categoryColumn {
+		regionColumns = append(regionColumns, "Category")
+	}
+	if mw.anonNameColumn {
+		regionColumns = append(regionColumns, "AnonName")
+	}
+	if mw.backingColumns {
+		regionColumns = append(regionColumns, "IsDeleted", "BackingType")
+	}
+	for _, node := range mw.numaNodes {
+		regionColumns = append(regionColumns, numaColumn(node))
+	}
+	for _, device := range mw.swapDevices {
+		regionColumns = append(regionColumns, swapColumn(device))
+	}
+	if mw.pagemap {
+		regionColumns = append(regionColumns, pagemapColumns...)
+	}
+	if mw.pageContent {
+		regionColumns = append(regionColumns, pageContentColumns...)
+	}
+	if mw.mincore {
+		regionColumns = append(regionColumns, mincoreColumns...)
+	}
+	if mw.regionSize {
+		regionColumns = append(regionColumns, "RegionSize")
+	}
+	if mw.regionKey {
+		regionColumns = append(regionColumns, "RegionKey")
+	}
+	if mw.sourceFile {
+		regionColumns = append(regionColumns, "SourceFile")
+	}
+	if mw.sourceLine {
+		regionColumns = append(regionColumns, "SourceLine")
+	}
+	header = insertAfterPathname(header, regionColumns...)
+	if uc := mw.unitConverter; uc != nil {
+		fields := header[len(header)-len(m.FieldNames):]
+		for i := range fields {
+			fields[i] = uc.header(m.FieldNames[i], m.FieldUnits[i])
+		}
+	}
+	for _, c := range mw.derivedColumns {
+		header = append(header, c.Name)
+	}
+	if mw.versionMetadata == versionMetadataColumn {
+		header = append(header, "SchemaVersion", "ToolVersion")
+	}
+	if mw.truncatedColumn {
+		header = append(header, "Truncated")
+	}
+	if mw.sampleWeight != "" {
+		header = append(header, columnSampleWeight)
+	}
+	if len(mw.processColumns) > 0 {
+		header = append(append([]string(nil), mw.processColumns...), header...)
+	}
+	if mw.timestampColumn {
+		header = append([]string{"Timestamp"}, header...)
+	}
+	return header
+}
+
+// fieldStart returns the index of the first field of m in header.
+func (mw *mappingWriter) fieldStart(m *mapping, header []string) int {
+	start := len(header) - len(m.FieldNames) - len(mw.derivedColumns)
+	if mw.versionMetadata == versionMetadataColumn {
+		start -= 2
+	}
+	if mw.truncatedColumn {
+		start--
+	}
+	if mw.sampleWeight != "" {
+		start--
+	}
+	return start
+}
+
+// fieldColumns returns the names of the columns of kB fields in header.
+func (mw *mappingWriter) fieldColumns(m *mapping, header []string) []string {
+	var names []string
+	start := mw.fieldStart(m, header)
+	for i, unit := range m.FieldUnits {
+		if unit == unitsKB {
+			names = append(names, header[start+i])
+		}
+	}
+	return names
+}
+
+func (mw *mappingWriter) record(m *mapping) []string {
+	var record []string
+	if mw.groups != nil {
+		record = append([]string{m.Group, strconv.Itoa(m.Regions)}, m.FieldValues...)
+	} else {
+		record = m.appendCSVRecord(make([]string, 0, mw.recordSize))
+		if mw.decAddresses {
+			for _, i := range []int{0, 1, 3} {
+				record[i] = hexToDec(record[i])
+			}
+		}
+	}
+	regionValues := mw.values[:0]
+	if mw.hostPaths {
+		regionValues = append(regionValues, string(m.Region.HostPath))
+	}
+	if mw.resolvedPaths {
+		regionValues = append(regionValues, string(m.Region.ResolvedPath))
+	}
+	if mw.mountColumns {
+		regionValues = append(regionValues, m.Region.MountPoint, m.Region.FsType)
+	}
+	if mw.stackThreads {
+		regionValues = append(regionValues, m.Region.StackThread)
+	}
+	if mw.categoryColumn {
+		regionValues = append(regionValues, m.Category)
+	}
+	if mw.anonNameColumn {
+		regionValues = append(regionValues, anonName(string(m.Region.Pathname)))
+	}
+	if mw.backingColumns {
+		regionValues = append(regionValues, strconv.FormatBool(m.Region.Deleted), m.Region.Backing)
+	}
+	for _, node := range mw.numaNodes {
+		regionValues = append(regionValues, numaValue(m.Region.NumaPages, node))
+	}
+	for i := range mw.swapDevices {
+		regionValues = append(regionValues, swapValue(m.Region.SwapPages, i))
+	}
+	if mw.pagemap {
+		regionValues = append(regionValues, m.Region.PageCounts.values()...)
+	}
+	if mw.pageContent {
+		regionValues = append(regionValues, m.Region.PageContent.values()...)
+	}
+	if mw.mincore {
+		regionValues = append(regionValues, cachedPagesValue(m.Region.CachedPages))
+	}
+	if mw.regionSize {
+		regionValues = append(regionValues, regionSize(m.Region, mw.decAddresses))
+	}
+	if mw.regionKey {
+		regionValues = append(regionValues, m.Region.Key)
+	}
+	if mw.sourceFile {
+		regionValues = append(regionValues, m.SourceFile)
+	}
+	if mw.sourceLine {
+		// Total and subtotal rows have no line.
+		line := ""
+		if m.LineNo > 0 {
+			line = strconv.Itoa(m.LineNo)
+		}
+		regionValues = append(regionValues, line)
+	}
+	record = insertAfterPathname(record, regionValues...)
+	if uc := mw.unitConverter; uc != nil {
+		fields := record[len(record)-len(m.FieldValues):]
+		for i := range fields {
+			fields[i] = uc.value(m, i)
+		}
+	}
+	for i := range mw.derivedColumns {
+		record = append(record, mw.derivedColumns[i].value(m, mw.floatFormat))
+	}
+	if nf := mw.numberFormat; nf != nil {
+		values := record[len(record)-len(m.FieldValues)-len(mw.derivedColumns):]
+		for i := range values {
+			values[i] = nf.format(values[i])
+		}
+	}
+	if mw.nullValue != "" {
+		end := len(record) - len(mw.derivedColumns)
+		values := record[end-len(m.FieldValues) : end]
+		for i := range values {
+			if values[i] == "" {
+				values[i] = mw.nullValue
+			}
+		}
+	}
+	if mw.versionMetadata == versionMetadataColumn {
+		record = append(record, strconv.Itoa(schemaVersion), toolVersion())
+	}
+	if mw.truncatedColumn {
+		record = append(record, strconv.FormatBool(m.Truncated))
+	}
+	if mw.sampleWeight != "" {
+		record = append(record, mw.sampleWeight)
+	}
+	if len(mw.processColumns) > 0 {
+		values := regionValues[:0]
+		for _, name := range mw.processColumns {
+			values = append(values, m.Process.column(name))
+		}
+		record = insertValues(record, 0, values...)
+		regionValues = values
+	}
+	if mw.timestampColumn {
+		record = insertValues(record, 0, mw.timestamp)
+	}
+	mw.values = regionValues[:0]
+	mw.recordSize = len(record)
+	return record
+}
+
+// Formats of addresses given by -addr-format.
+const (
+	addrFormatHex = "hex"
+	addrFormatDec = "dec"
+)
+
+// hexToDec returns the hex number s in decimal, or s itself if it is not
+// a hex number.
+func hexToDec(s string) string {
+	n, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return s
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+// regionSize returns the size of r in bytes in hex, or in decimal if dec
+// is true. It is empty if the addresses are invalid.
+func regionSize(r *region, dec bool) string {
+	start, end, err := r.addressRange()
+	if err != nil || end < start {
+		return ""
+	}
+	if dec {
+		return strconv.FormatUint(end-start, 10)
+	}
+	return strconv.FormatUint(end-start, 16)
+}
+
+// insertAfterPathname inserts values into a header or record right after
+// the Pathname column.
+func insertAfterPathname(record []string, values ...string) []string {
+	const pathnameIndex = 6
+	return insertValues(record, pathnameIndex+1, values...)
+}
+
+// insertValues inserts values into record at i, in place if record has
+// the capacity.
+func insertValues(record []string, i int, values ...string) []string {
+	if len(values) == 0 {
+		return record
+	}
+	record = append(record, values...)
+	copy(record[i+len(values):], record[i:])
+	copy(record[i:], values)
+	return record
+}
@@ -0,0 +1,188 @@
+//go:build !minimal
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of a worksheet of Excel.
+const (
+	xlsxMaxRows    = 1 << 20
+	xlsxMaxColumns = 1 << 14
+	xlsxMaxText    = 32767
+)
+
+// xlsxSheet is the name of the worksheet.
+const xlsxSheet = "mappings"
+
+// xlsxStaticParts are the parts of the workbook other than the worksheet,
+// which has a bold header row with the style 1.
+var xlsxStaticParts = []struct {
+	name, content string
+}{
+	{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	{"xl/styles.xml", `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="2"><font/><font><b/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border/></borders>` +
+		`<cellStyleXfs count="1"><xf/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf/><xf fontId="1" applyFont="1"/></cellXfs>` +
+		`</styleSheet>`},
+}
+
+// buildXLSXWorkbook returns an Excel workbook with a worksheet of the
+// columns and rows. The header row is bold and frozen with an
+// autofilter, and the values of numbers outside stringColumns are
+// numeric cells, so that they are not taken for text or dates.
+func buildXLSXWorkbook(columns []string, rows [][]string) ([]byte, error) {
+	if len(columns) > xlsxMaxColumns {
+		return nil, fmt.Errorf("%d columns exceed the limit of a worksheet, %d", len(columns), xlsxMaxColumns)
+	}
+	if len(rows)+1 > xlsxMaxRows {
+		return nil, fmt.Errorf("%d rows exceed the limit of a worksheet, %d including the header", len(rows), xlsxMaxRows)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	// A fixed time makes the same rows the same file.
+	modified := time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	add := func(name string, content []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	}
+	for _, part := range xlsxStaticParts {
+		if err := add(part.name, []byte(xml.Header+part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := add("xl/workbook.xml", []byte(xml.Header+xlsxWorkbook(columns, rows))); err != nil {
+		return nil, err
+	}
+	sheet, err := xlsxWorksheet(columns, rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := add("xl/worksheets/sheet1.xml", sheet); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// xlsxWorkbook returns the workbook part, which defines the range of the
+// autofilter.
+func xlsxWorkbook(columns []string, rows [][]string) string {
+	return `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="` + xlsxSheet + `" sheetId="1" r:id="rId1"/></sheets>` +
+		`<definedNames><definedName name="_xlnm._FilterDatabase" localSheetId="0" hidden="1">` +
+		xlsxSheet + `!` + xlsxRange(columns, rows, true) + `</definedName></definedNames>` +
+		`</workbook>`
+}
+
+// xlsxRange returns the range of the header and the rows, e.g. A1:K10,
+// with absolute references if absolute is true, e.g. $A$1:$K$10.
+func xlsxRange(columns []string, rows [][]string, absolute bool) string {
+	last := len(columns)
+	if last == 0 {
+		last = 1
+	}
+	if absolute {
+		return "$A$1:$" + xlsxColumnName(last-1) + "$" + strconv.Itoa(len(rows)+1)
+	}
+	return "A1:" + xlsxColumnName(last-1) + strconv.Itoa(len(rows)+1)
+}
+
+// xlsxWorksheet returns the worksheet part of the columns and rows.
+func xlsxWorksheet(columns []string, rows [][]string) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0">`)
+	b.WriteString(`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`)
+	b.WriteString(`</sheetView></sheetViews><sheetData>`)
+	b.WriteString(`<row r="1">`)
+	for i, name := range columns {
+		if err := appendXLSXText(&b, xlsxColumnName(i)+"1", name, ` s="1"`); err != nil {
+			return nil, err
+		}
+	}
+	b.WriteString(`</row>`)
+	for j, row := range rows {
+		r := strconv.Itoa(j + 2)
+		b.WriteString(`<row r="` + r + `">`)
+		for i, value := range row {
+			if i >= len(columns) || value == "" {
+				continue
+			}
+			ref := xlsxColumnName(i) + r
+			if !stringColumns[columns[i]] && isJSONNumber(value) {
+				b.WriteString(`<c r="` + ref + `"><v>` + value + `</v></c>`)
+				continue
+			}
+			if err := appendXLSXText(&b, ref, value, ""); err != nil {
+				return nil, err
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData>`)
+	if len(columns) > 0 {
+		b.WriteString(`<autoFilter ref="` + xlsxRange(columns, rows, false) + `"/>`)
+	}
+	b.WriteString(`</worksheet>`)
+	return b.Bytes(), nil
+}
+
+// appendXLSXText appends a cell of the text at ref with the attributes
+// attrs.
+func appendXLSXText(b *bytes.Buffer, ref, text, attrs string) error {
+	if len(text) > xlsxMaxText {
+		return fmt.Errorf("cell %s: %d bytes exceed the limit of a cell, %d", ref, len(text), xlsxMaxText)
+	}
+	b.WriteString(`<c r="` + ref + `" t="inlineStr"` + attrs + `><is><t`)
+	if strings.TrimSpace(text) != text {
+		b.WriteString(` xml:space="preserve"`)
+	}
+	b.WriteByte('>')
+	if err := xml.EscapeText(b, []byte(text)); err != nil {
+		return err
+	}
+	b.WriteString(`</t></is></c>`)
+	return nil
+}
+
+// xlsxColumnName returns the name of the i-th column counted from zero,
+// e.g. A, Z, AA.
+func xlsxColumnName(i int) string {
+	var name []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = append([]byte{byte('A' + (i-1)%26)}, name...)
+	}
+	return string(name)
+}
@@ -0,0 +1,131 @@
+//go:build !minimal
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testXLSXCell is a cell of a worksheet with its value.
+type testXLSXCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  string `xml:"s,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+type testXLSXWorksheet struct {
+	Pane struct {
+		YSplit string `xml:"ySplit,attr"`
+		State  string `xml:"state,attr"`
+	} `xml:"sheetViews>sheetView>pane"`
+	Rows []struct {
+		Cells []testXLSXCell `xml:"c"`
+	} `xml:"sheetData>row"`
+	AutoFilter struct {
+		Ref string `xml:"ref,attr"`
+	} `xml:"autoFilter"`
+}
+
+// readTestXLSXPart returns the part of name in the workbook.
+func readTestXLSXPart(t *testing.T, data []byte, name string) []byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBuildXLSXWorkbook(t *testing.T) {
+	columns := []string{"AddressStart", "Inode", "Pathname", "Rss", "Pss"}
+	rows := [][]string{
+		{"55d000", "1234", "/usr/bin/a&b", "4", "1.5"},
+		{"7ffd0000", "0", " [stack]", "8", ""},
+	}
+	data, err := buildXLSXWorkbook(columns, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ws testXLSXWorksheet
+	if err := xml.Unmarshal(readTestXLSXPart(t, data, "xl/worksheets/sheet1.xml"), &ws); err != nil {
+		t.Fatal(err)
+	}
+	if ws.Pane.YSplit != "1" || ws.Pane.State != "frozen" {
+		t.Errorf("header row is not frozen, got=%+v", ws.Pane)
+	}
+	if got, want := ws.AutoFilter.Ref, "A1:E3"; got != want {
+		t.Errorf("autofilter mismatch, got=%q, want=%q", got, want)
+	}
+	want := [][]testXLSXCell{
+		{
+			{Ref: "A1", Type: "inlineStr", Style: "1", Inline: "AddressStart"},
+			{Ref: "B1", Type: "inlineStr", Style: "1", Inline: "Inode"},
+			{Ref: "C1", Type: "inlineStr", Style: "1", Inline: "Pathname"},
+			{Ref: "D1", Type: "inlineStr", Style: "1", Inline: "Rss"},
+			{Ref: "E1", Type: "inlineStr", Style: "1", Inline: "Pss"},
+		},
+		{
+			{Ref: "A2", Type: "inlineStr", Inline: "55d000"},
+			{Ref: "B2", Type: "inlineStr", Inline: "1234"},
+			{Ref: "C2", Type: "inlineStr", Inline: "/usr/bin/a&b"},
+			{Ref: "D2", Value: "4"},
+			{Ref: "E2", Value: "1.5"},
+		},
+		{
+			{Ref: "A3", Type: "inlineStr", Inline: "7ffd0000"},
+			{Ref: "B3", Type: "inlineStr", Inline: "0"},
+			{Ref: "C3", Type: "inlineStr", Inline: " [stack]"},
+			{Ref: "D3", Value: "8"},
+		},
+	}
+	if len(ws.Rows) != len(want) {
+		t.Fatalf("row count mismatch, got=%d, want=%d", len(ws.Rows), len(want))
+	}
+	for i, w := range want {
+		if !reflect.DeepEqual(ws.Rows[i].Cells, w) {
+			t.Errorf("row %d mismatch,\n got=%+v,\nwant=%+v", i+1, ws.Rows[i].Cells, w)
+		}
+	}
+	if workbook := string(readTestXLSXPart(t, data, "xl/workbook.xml")); !strings.Contains(workbook, "mappings!$A$1:$E$3") {
+		t.Errorf("filter range is not defined, got=%s", workbook)
+	}
+
+	again, err := buildXLSXWorkbook(columns, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Error("workbooks of the same rows differ")
+	}
+}
+
+func TestBuildXLSXWorkbookLimits(t *testing.T) {
+	if _, err := buildXLSXWorkbook([]string{"Pathname"}, [][]string{{strings.Repeat("a", xlsxMaxText+1)}}); err == nil {
+		t.Error("want an error for a value exceeding the limit of a cell")
+	}
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA", xlsxMaxColumns - 1: "XFD"} {
+		if got := xlsxColumnName(i); got != want {
+			t.Errorf("column %d mismatch, got=%q, want=%q", i, got, want)
+		}
+	}
+}